@@ -0,0 +1,149 @@
+package apperrors
+
+// Package apperrors defines the typed errors shared by repositories, services, controllers and the WebSocket handler.
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Kind classifies an application error.
+type Kind string
+
+const (
+	KindNotFound              Kind = "NOT_FOUND"
+	KindValidation            Kind = "VALIDATION"
+	KindUnauthorized          Kind = "UNAUTHORIZED"
+	KindDependencyUnavailable Kind = "DEPENDENCY_UNAVAILABLE"
+	KindRateLimited           Kind = "RATE_LIMITED"
+	KindPayloadTooLarge       Kind = "PAYLOAD_TOO_LARGE"
+	KindUnsupportedMediaType  Kind = "UNSUPPORTED_MEDIA_TYPE"
+	KindInternal              Kind = "INTERNAL"
+)
+
+// Error is an application error carrying its Kind, a client-safe message and the underlying cause.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NotFound returns an error for a resource that does not exist.
+func NotFound(message string) *Error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+// Validation returns an error for invalid input. The cause may be nil.
+func Validation(message string, err error) *Error {
+	return &Error{Kind: KindValidation, Message: message, Err: err}
+}
+
+// Unauthorized returns an error for a caller that is not allowed to perform the operation.
+func Unauthorized(message string) *Error {
+	return &Error{Kind: KindUnauthorized, Message: message}
+}
+
+// DependencyUnavailable returns an error for a failing downstream dependency such as MongoDB or Redis.
+func DependencyUnavailable(message string, err error) *Error {
+	return &Error{Kind: KindDependencyUnavailable, Message: message, Err: err}
+}
+
+// RateLimited returns an error for an operation refused because it was performed too often.
+func RateLimited(message string) *Error {
+	return &Error{Kind: KindRateLimited, Message: message}
+}
+
+// PayloadTooLarge returns an error for a request body exceeding the size limit.
+func PayloadTooLarge(message string) *Error {
+	return &Error{Kind: KindPayloadTooLarge, Message: message}
+}
+
+// UnsupportedMediaType returns an error for a request body of a content type the endpoint does not accept.
+func UnsupportedMediaType(message string) *Error {
+	return &Error{Kind: KindUnsupportedMediaType, Message: message}
+}
+
+// Internal returns an error for an unexpected failure inside the service.
+func Internal(message string, err error) *Error {
+	return &Error{Kind: KindInternal, Message: message, Err: err}
+}
+
+// FromDatabase classifies an error returned by the MongoDB or Postgres driver. A missing document or row becomes a
+// NotFound error with the given message, and any other driver error becomes DependencyUnavailable.
+// Errors that are already application errors are returned unchanged.
+func FromDatabase(err error, notFoundMessage string) error {
+	if err == nil {
+		return nil
+	}
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, pgx.ErrNoRows) {
+		return NotFound(notFoundMessage)
+	}
+	return DependencyUnavailable("database operation failed", err)
+}
+
+// KindOf returns the Kind of the given error, or KindInternal if it is not an application error.
+func KindOf(err error) Kind {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Kind
+	}
+	return KindInternal
+}
+
+// Is reports whether the given error is an application error of the given Kind.
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
+
+// MessageOf returns the client-safe message of the given error. Errors that are not
+// application errors are reported with a generic message so internal details are not leaked.
+func MessageOf(err error) string {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		if appErr.Kind == KindValidation && appErr.Err != nil {
+			return appErr.Error()
+		}
+		return appErr.Message
+	}
+	return "internal server error"
+}
+
+// HTTPStatus maps the given error to the HTTP status code returned by the REST controllers.
+func HTTPStatus(err error) int {
+	switch KindOf(err) {
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindDependencyUnavailable:
+		return http.StatusServiceUnavailable
+	case KindRateLimited:
+		return http.StatusTooManyRequests
+	case KindPayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case KindUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,189 @@
+package breaker
+
+// Package breaker contains the circuit breakers guarding the calls to MongoDB, Postgres and Redis. When a
+// dependency keeps failing, its breaker opens and calls fail fast with a DependencyUnavailable error instead
+// of waiting for the driver timeouts, until a trial call succeeds again.
+
+import (
+	"errors"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker.
+type State string
+
+const (
+	// Closed breakers let every call through.
+	Closed State = "closed"
+	// Open breakers reject every call until the open timeout has passed.
+	Open State = "open"
+	// HalfOpen breakers let a single trial call through, which closes the breaker if it succeeds.
+	HalfOpen State = "half-open"
+)
+
+// ErrOpen is the cause of the errors returned for calls rejected by an open breaker.
+var ErrOpen = errors.New("circuit breaker open")
+
+// Breaker is a circuit breaker for a single dependency. It opens after CIRCUIT_BREAKER_FAILURE_THRESHOLD
+// consecutive failures and lets a trial call through after CIRCUIT_BREAKER_OPEN_SECONDS.
+type Breaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+	isFailure        func(error) bool
+	mutex            sync.Mutex
+	state            State
+	failures         int
+	openedAt         time.Time
+	trialRunning     bool
+}
+
+var (
+	registry      = make(map[string]*Breaker)
+	registryMutex sync.RWMutex
+)
+
+// New creates a closed breaker for the named dependency and registers it, so its state is reported by
+// States. isFailure decides which errors returned by the calls count as failures of the dependency;
+// other errors, such as a missing document, count as successful calls.
+func New(name string, isFailure func(error) bool) *Breaker {
+	cfg := config.LoadConfig()
+	breaker := &Breaker{
+		name:             name,
+		failureThreshold: max(cfg.CircuitBreakerFailureThreshold, 1),
+		openTimeout:      time.Duration(max(cfg.CircuitBreakerOpenSeconds, 1)) * time.Second,
+		isFailure:        isFailure,
+		state:            Closed,
+	}
+	registryMutex.Lock()
+	registry[name] = breaker
+	registryMutex.Unlock()
+	metrics.SetGauge("breaker."+name+".open", 0)
+	return breaker
+}
+
+// Execute runs the call unless the breaker is open, and records its outcome. Rejected calls return a
+// DependencyUnavailable error wrapping ErrOpen without running the call.
+func (b *Breaker) Execute(call func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := call()
+	b.record(err)
+	return err
+}
+
+// Call runs a call returning a value through the breaker, see Execute.
+func Call[T any](b *Breaker, call func() (T, error)) (T, error) {
+	var result T
+	err := b.Execute(func() error {
+		var err error
+		result, err = call()
+		return err
+	})
+	return result, err
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+// States returns the state of every registered breaker by dependency name.
+func States() map[string]State {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	states := make(map[string]State, len(registry))
+	for name, breaker := range registry {
+		states[name] = breaker.State()
+	}
+	return states
+}
+
+// allow decides whether a call may run. An open breaker becomes half-open once the open timeout has
+// passed, and a half-open breaker lets only one trial call run at a time.
+func (b *Breaker) allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == Open && time.Since(b.openedAt) >= b.openTimeout {
+		b.setState(HalfOpen)
+	}
+	switch b.state {
+	case Open:
+		metrics.Inc("breaker." + b.name + ".rejected")
+		return apperrors.DependencyUnavailable(b.name+" unavailable", ErrOpen)
+	case HalfOpen:
+		if b.trialRunning {
+			metrics.Inc("breaker." + b.name + ".rejected")
+			return apperrors.DependencyUnavailable(b.name+" unavailable", ErrOpen)
+		}
+		b.trialRunning = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a call.
+func (b *Breaker) record(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	failed := err != nil && b.isFailure(err)
+	switch b.state {
+	case HalfOpen:
+		b.trialRunning = false
+		if failed {
+			b.open(err)
+		} else {
+			b.failures = 0
+			b.setState(Closed)
+		}
+	case Closed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.failureThreshold {
+			b.open(err)
+		}
+	}
+}
+
+// open opens the breaker after the given failure.
+func (b *Breaker) open(err error) {
+	b.openedAt = time.Now()
+	b.setState(Open)
+	metrics.Inc("breaker." + b.name + ".opened")
+	logger.Log.Error(logger.LogPayload{
+		Component: "Circuit Breaker",
+		Operation: "Open",
+		Message:   "Circuit breaker for " + b.name + " opened, failing calls fast for " + b.openTimeout.String(),
+		Error:     err,
+	})
+}
+
+// setState changes the state of the breaker and reports it in the breaker.<name>.open gauge.
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	open := int64(0)
+	if state != Closed {
+		open = 1
+	}
+	metrics.SetGauge("breaker."+b.name+".open", open)
+	if state == Closed {
+		logger.Log.Info(logger.LogPayload{
+			Component: "Circuit Breaker",
+			Operation: "Close",
+			Message:   "Circuit breaker for " + b.name + " closed, " + b.name + " is available again",
+		})
+	}
+}
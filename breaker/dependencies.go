@@ -0,0 +1,59 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"r2-notify-server/apperrors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IsDatabaseFailure reports whether an error returned by a repository means the database is unavailable.
+// Missing documents and invalid input are answered by the database, and requests cancelled by the caller
+// say nothing about it, so neither counts as a failure.
+func IsDatabaseFailure(err error) bool {
+	return apperrors.Is(err, apperrors.KindDependencyUnavailable) && !errors.Is(err, context.Canceled)
+}
+
+// IsRedisFailure reports whether an error returned by a Redis command means Redis is unavailable. Error
+// replies, including redis.Nil for missing keys, are answered by Redis and do not count as failures.
+func IsRedisFailure(err error) bool {
+	var reply redis.Error
+	return !errors.As(err, &reply) && !errors.Is(err, context.Canceled)
+}
+
+// RedisHook returns a go-redis hook running every command and pipeline through the breaker. Commands
+// rejected by an open breaker fail with the breaker error without reaching Redis.
+func (b *Breaker) RedisHook() redis.Hook {
+	return redisHook{breaker: b}
+}
+
+type redisHook struct {
+	breaker *Breaker
+}
+
+func (h redisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := h.breaker.Execute(func() error { return next(ctx, cmd) })
+		if errors.Is(err, ErrOpen) {
+			cmd.SetErr(err)
+		}
+		return err
+	}
+}
+
+func (h redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := h.breaker.Execute(func() error { return next(ctx, cmds) })
+		if errors.Is(err, ErrOpen) {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,225 @@
+package watcher
+
+// Package watcher contains the MongoDB change stream watcher for notifications written directly to the database.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	"r2-notify-server/pipeline"
+	clientStore "r2-notify-server/services"
+	notificationService "r2-notify-server/services/notification"
+	"r2-notify-server/tracing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Delay before re-opening the change stream after it fails.
+const retryDelay = 5 * time.Second
+
+// Error code of MongoDB when a change stream cannot resume because the event is no longer in the oplog.
+const changeStreamHistoryLost = 286
+
+type changeEvent struct {
+	FullDocument models.Notification `bson:"fullDocument"`
+}
+
+// StartChangeStreamWatcher watches the notifications collection for inserts made by external producers
+// and pushes a newNotification frame to the user's connections in clients for each inserted document.
+// Documents written by this service carry the service origin and are skipped, since they are already delivered.
+// Inserted documents are given a sequence number before they are delivered.
+// The outcome of each delivery is recorded with the notification service.
+// If the stream cannot be opened, the error is returned and the watcher does not start. Once started, the
+// stream is re-opened after a failure until the context is cancelled, resuming after the last event it handled
+// so no insert made in between is missed.
+func StartChangeStreamWatcher(ctx context.Context, db *mongo.Database, service notificationService.NotificationService, clients *clientStore.ClientStore) error {
+	insertPipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"operationType":       "insert",
+			"fullDocument.origin": bson.M{"$ne": data.SERVICE_NAME},
+		}}},
+	}
+	collection := db.Collection("notifications")
+
+	stream, err := open(ctx, collection, insertPipeline, nil)
+	if err != nil {
+		return err
+	}
+	var resumeToken bson.Raw
+	for {
+		var err error
+		resumeToken, err = watch(ctx, stream, service, clients)
+		if ctx.Err() != nil {
+			break
+		}
+		logger.Log.Error(logger.LogPayload{
+			Message:   fmt.Sprintf("Change stream stopped, retrying in %s", retryDelay),
+			Component: "MongoDB Change Stream Watcher",
+			Operation: "StartChangeStreamWatcher",
+			Error:     err,
+		})
+		select {
+		case <-ctx.Done():
+		case <-time.After(retryDelay):
+		}
+		if stream, err = reopen(ctx, collection, insertPipeline, resumeToken); err != nil {
+			break
+		}
+	}
+
+	logger.Log.Info(logger.LogPayload{
+		Message:   "Shutting down change stream watcher",
+		Component: "MongoDB Change Stream Watcher",
+		Operation: "Shutdown Change Stream Watcher",
+	})
+	return nil
+}
+
+// open opens a change stream on the given collection with the given pipeline, starting after the event of the
+// given resume token if any.
+func open(ctx context.Context, collection *mongo.Collection, insertPipeline mongo.Pipeline, resumeToken bson.Raw) (*mongo.ChangeStream, error) {
+	opts := options.ChangeStream()
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+	stream, err := collection.Watch(ctx, insertPipeline, opts)
+	if err != nil {
+		return nil, apperrors.DependencyUnavailable("failed to open change stream", err)
+	}
+	logger.Log.Info(logger.LogPayload{
+		Message:   "Watching notifications collection for inserts",
+		Component: "MongoDB Change Stream Watcher",
+		Operation: "Watch",
+	})
+	return stream, nil
+}
+
+// reopen opens the change stream again after it failed, resuming after the event of the given resume token,
+// and retries every retryDelay until it is open. When the event is no longer in the oplog, the stream starts
+// from now instead and the inserts in between are not delivered. It returns an error only when the context is
+// cancelled.
+func reopen(ctx context.Context, collection *mongo.Collection, insertPipeline mongo.Pipeline, resumeToken bson.Raw) (*mongo.ChangeStream, error) {
+	for {
+		stream, err := open(ctx, collection, insertPipeline, resumeToken)
+		if err == nil || ctx.Err() != nil {
+			return stream, err
+		}
+		if resumeToken != nil && historyLost(err) {
+			logger.Log.Error(logger.LogPayload{
+				Message:   "Change stream cannot resume after the last delivered event, watching from now",
+				Component: "MongoDB Change Stream Watcher",
+				Operation: "StartChangeStreamWatcher",
+				Error:     err,
+			})
+			resumeToken = nil
+			continue
+		}
+		logger.Log.Error(logger.LogPayload{
+			Message:   fmt.Sprintf("Failed to reopen change stream, retrying in %s", retryDelay),
+			Component: "MongoDB Change Stream Watcher",
+			Operation: "StartChangeStreamWatcher",
+			Error:     err,
+		})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// watch delivers every matching event of the given stream until the stream fails or the context is
+// cancelled, and closes the stream. It returns the resume token of the last event handled.
+func watch(ctx context.Context, stream *mongo.ChangeStream, service notificationService.NotificationService, clients *clientStore.ClientStore) (bson.Raw, error) {
+	defer stream.Close(context.Background())
+
+	resumeToken := stream.ResumeToken()
+	for stream.Next(ctx) {
+		deliverChange(stream, service, clients)
+		resumeToken = stream.ResumeToken()
+	}
+
+	if err := stream.Err(); err != nil {
+		return resumeToken, apperrors.DependencyUnavailable("change stream failed", err)
+	}
+	return resumeToken, nil
+}
+
+// historyLost reports whether a change stream failed to open because the event to resume after is no
+// longer in the oplog.
+func historyLost(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(changeStreamHistoryLost)
+}
+
+// deliverChange delivers the notification inserted by the current event of the stream, traced as its own span.
+func deliverChange(stream *mongo.ChangeStream, service notificationService.NotificationService, clients *clientStore.ClientStore) {
+	ctx, span := tracing.Start(context.Background(), "changestream.deliver", trace.SpanKindConsumer,
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.collection.name", "notifications"),
+	)
+	defer span.End()
+	correlationId := tracing.CorrelationId(ctx)
+
+	var event changeEvent
+	if err := stream.Decode(&event); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Message:       "Invalid change event format",
+			Component:     "MongoDB Change Stream Watcher",
+			Operation:     "OnInsert",
+			Error:         err,
+			CorrelationId: correlationId,
+		})
+		return
+	}
+
+	m := event.FullDocument
+	logger.Log.Debug(logger.LogPayload{
+		Message:       "Received inserted notification " + m.Id.Hex(),
+		Component:     "MongoDB Change Stream Watcher",
+		Operation:     "OnInsert",
+		UserId:        m.UserId,
+		AppId:         m.AppId,
+		CorrelationId: correlationId,
+	})
+
+	// Documents inserted by other services are numbered here, with the same number on every instance. Without
+	// a number the notification is still delivered, since it is already stored.
+	if m.Sequence == 0 {
+		numbered, err := service.Number(ctx, m)
+		if err != nil {
+			logger.Log.Warn(logger.LogPayload{
+				Message:       "Delivering inserted notification " + m.Id.Hex() + " without a sequence number",
+				Component:     "MongoDB Change Stream Watcher",
+				Operation:     "OnInsert",
+				UserId:        m.UserId,
+				AppId:         m.AppId,
+				Error:         err,
+				CorrelationId: correlationId,
+			})
+		}
+		m = numbered
+	}
+
+	// Inserted documents are already persisted, so only the delivery hooks of the pipeline run
+	if delivery, err := pipeline.Deliver(pipeline.Context{Context: ctx, Source: data.SOURCE_CHANGE_STREAM, CorrelationId: correlationId}, service, clients, m); err != nil {
+		logger.Log.Debug(logger.LogPayload{
+			Message:       "Notification not delivered for inserted document " + m.Id.Hex() + ", " + delivery.Status,
+			Component:     "MongoDB Change Stream Watcher",
+			Operation:     "OnInsert",
+			UserId:        m.UserId,
+			AppId:         m.AppId,
+			Error:         err,
+			CorrelationId: correlationId,
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// Command doctor checks the environment of the server without starting it: it validates the configuration,
+// connects to the database, Redis and the event source, verifies the database indexes or migrations are in
+// place and prints a diagnostic report. It exits with status 1 if any check fails, so it can gate CI/CD
+// deployments; warnings, such as indexes the server creates on startup, do not fail it.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"r2-notify-server/data"
+	"r2-notify-server/doctor"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	timeout := flag.Duration("timeout", 10*time.Second, "time allowed for each check")
+	flag.Parse()
+
+	// Like the server, only load the .env file in local development
+	if os.Getenv("ENV") != data.PRODUCTION_ENV {
+		if err := godotenv.Load(); err != nil {
+			fmt.Fprintln(os.Stderr, "No .env file loaded, using the environment only")
+		}
+	}
+
+	report := doctor.Run(context.Background(), *timeout)
+	report.Write(os.Stdout)
+	if report.Failed() {
+		os.Exit(1)
+	}
+}
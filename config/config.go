@@ -1,62 +1,356 @@
 package config
 
 import (
+	"encoding/base64"
+	"fmt"
 	"os"
+	"r2-notify-server/data"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
-	Environment                   string
-	Port                          string
-	MongoHost                     string
-	MongoPort                     int
-	MongoDBName                   string
-	MongoUserName                 string
-	MongoPassword                 string
-	mongoRetryWrites              string
-	mongoSsl                      string
-	RedisHost                     string
-	RedisPort                     int
-	RedisUsername                 string
-	RedisPassword                 string
-	RedisTLSEnabled               string
-	EventHubNameSpaceConString    string
-	EventHubNotificationEventName string
-	AllowedOrigins                string
-	LogLevel                      string
-	LogMethod                     string
-	LogFilePath                   string
-	MaxLogFileSize                int
-	AppInsightsInstrumentationKey string
+	Environment                    string
+	Port                           string
+	DbDriver                       string
+	MongoHost                      string
+	MongoPort                      int
+	MongoDBName                    string
+	MongoUserName                  string
+	MongoPassword                  string
+	mongoRetryWrites               string
+	mongoSsl                       string
+	PostgresHost                   string
+	PostgresPort                   int
+	PostgresDBName                 string
+	PostgresUserName               string
+	PostgresPassword               string
+	PostgresSSLMode                string
+	RedisHost                      string
+	RedisPort                      int
+	RedisUsername                  string
+	RedisPassword                  string
+	RedisTLSEnabled                string
+	RedisMode                      string
+	RedisAddrs                     string
+	RedisMasterName                string
+	RedisSentinelPassword          string
+	EventHubNameSpaceConString     string
+	EventHubNotificationEventName  string
+	EventHubActionEventName        string
+	AllowedOrigins                 string
+	CorsAllowedMethods             string
+	CorsAllowedHeaders             string
+	CorsExposedHeaders             string
+	CorsMaxAgeSeconds              int
+	CorsAllowCredentials           bool
+	CorsRoutesFile                 string
+	LogLevel                       string
+	LogPiiMode                     string
+	LogMethod                      string
+	LogFilePath                    string
+	MaxLogFileSize                 int
+	AppInsightsInstrumentationKey  string
+	EnableChangeStreams            bool
+	WebhookMaxAttempts             int
+	WebhookWorkers                 int
+	WebhookQueueSize               int
+	WebhookTimeoutSeconds          int
+	EventHubWorkerPoolSize         int
+	EventHubWorkerQueueSize        int
+	EventHubDrainTimeoutSeconds    int
+	ClientInfoCacheTTLSeconds      int
+	RedisRetryIntervalSeconds      int
+	AdminApiKey                    string
+	IdleConnectionTimeoutMinutes   int
+	ConnectionHeartbeatTTLSeconds  int
+	DeletedRetentionDays           int
+	RetentionCleanupHour           int
+	PinLimitPerUser                int
+	RequireApiKeys                 bool
+	WsTicketSecret                 string
+	WsTicketTTLSeconds             int
+	RequireWsTickets               bool
+	MaxRequestBodySize             int
+	SendQueueSize                  int
+	SlowConsumerThreshold          int
+	SlowConsumerTimeoutSeconds     int
+	SendQueuePriorityBurst         int
+	ConfigReloadFile               string
+	NotificationDedupWindowSeconds int
+	OtelExporterEndpoint           string
+	OtelServiceName                string
+	OtelSampleRatio                float64
+	CircuitBreakerFailureThreshold int
+	CircuitBreakerOpenSeconds      int
+	ConnectionHistorySize          int
+	EventHubTopicMappingsFile      string
+	EventHubConsumerGroup          string
+	EventHubPartitionLeases        bool
+	EventHubLeaseTTLSeconds        int
+	EventHubIdempotencyTTLSeconds  int
+	EventSource                    string
+	ServiceBusConString            string
+	ServiceBusQueues               string
+	ServiceBusSessions             bool
+	ServiceBusConcurrency          int
+	OriginCacheTTLSeconds          int
+	AppCacheTTLSeconds             int
+	PolicyCacheTTLSeconds          int
+	ConfigurationCacheSize         int
+	ConfigurationCacheTTLSeconds   int
+	ListRefreshCoalesceMs          int
+	ListChunkSize                  int
+	ListHistoryDays                int
+	GroupSummaryThreshold          int
+	WebSocketReadBufferSize        int
+	WebSocketWriteBufferSize       int
+	WebSocketMaxMessageSize        int
+	EncryptedApps                  string
+	EncryptionKeys                 string
+	EncryptionKeyId                string
+	BroadcastMinIntervalSeconds    int
+	SimulationEnabled              bool
+	SimulationMaxCount             int
+	DrainWindowSeconds             int
+	DrainRetryAfterSeconds         int
+	MongoQueryTimeoutMs            int
+	MongoRetryMaxAttempts          int
+	MongoRetryBaseDelayMs          int
+	MongoRetryMaxDelayMs           int
+	MongoMaxPoolSize               int
+	MongoMinPoolSize               int
+	MongoMaxConnIdleSeconds        int
+	MongoServerSelectionTimeoutMs  int
+	MongoHealthCheckSeconds        int
+	MongoHealthFailureThreshold    int
+	ReminderLeadSeconds            int
+	ReminderCheckIntervalSeconds   int
+	MessageMaxLength               int
+	MessageOverflowPolicy          string
+	WebSocketMaxBatchSize          int
 }
 
 func LoadConfig() *Config {
 	return &Config{
-		Environment:                   GetEnv("ENV", "development"),
-		Port:                          GetEnv("PORT", "8081"),
-		MongoHost:                     GetEnv("MONGO_HOST", "localhost"),
-		MongoPort:                     GetEnvInt("MONGO_PORT", 27017),
-		MongoDBName:                   GetEnv("MONGO_DB_NAME", "go_rampup"),
-		MongoUserName:                 GetEnv("MONGO_USER_NAME", ""),
-		MongoPassword:                 GetEnv("MONGO_PASSWORD", ""),
-		mongoRetryWrites:              GetEnv("MONGO_RETRY_WRITES", "true"),
-		mongoSsl:                      GetEnv("MONGO_SSL", "false"),
-		RedisHost:                     GetEnv("REDIS_HOST", "localhost"),
-		RedisPort:                     GetEnvInt("REDIS_PORT", 6379),
-		RedisUsername:                 GetEnv("REDIS_USERNAME", ""),
-		RedisPassword:                 GetEnv("REDIS_PASSWORD", ""),
-		RedisTLSEnabled:               GetEnv("REDIS_TLS_ENABLED", "false"),
-		EventHubNameSpaceConString:    GetEnv("EVENT_HUB_NAMESPACE_CON_STRING", ""),
-		EventHubNotificationEventName: GetEnv("EVENT_HUB_NOTIFICATION_EVENT_NAME", ""),
-		AllowedOrigins:                GetEnv("ALLOWED_ORIGINS", "*"),
-		LogLevel:                      GetEnv("LOG_LEVEL", ""),
-		LogMethod:                     GetEnv("LOG_METHOD", "file"),
-		LogFilePath:                   GetEnv("LOG_FILE_PATH", "./logs/app.log"),
-		MaxLogFileSize:                GetEnvInt("MAX_LOG_FILE_SIZE", 10485760),
-		AppInsightsInstrumentationKey: GetEnv("APP_INSIGHTS_INSTRUMENTATION_KEY", ""),
+		Environment:                    GetEnv("ENV", "development"),
+		Port:                           GetEnv("PORT", "8081"),
+		DbDriver:                       GetEnv("DB_DRIVER", "mongo"),
+		MongoHost:                      GetEnv("MONGO_HOST", "localhost"),
+		MongoPort:                      GetEnvInt("MONGO_PORT", 27017),
+		MongoDBName:                    GetEnv("MONGO_DB_NAME", "go_rampup"),
+		MongoUserName:                  GetEnv("MONGO_USER_NAME", ""),
+		MongoPassword:                  GetEnv("MONGO_PASSWORD", ""),
+		mongoRetryWrites:               GetEnv("MONGO_RETRY_WRITES", "true"),
+		mongoSsl:                       GetEnv("MONGO_SSL", "false"),
+		PostgresHost:                   GetEnv("POSTGRES_HOST", "localhost"),
+		PostgresPort:                   GetEnvInt("POSTGRES_PORT", 5432),
+		PostgresDBName:                 GetEnv("POSTGRES_DB_NAME", "r2_notify"),
+		PostgresUserName:               GetEnv("POSTGRES_USER_NAME", ""),
+		PostgresPassword:               GetEnv("POSTGRES_PASSWORD", ""),
+		PostgresSSLMode:                GetEnv("POSTGRES_SSL_MODE", "disable"),
+		RedisHost:                      GetEnv("REDIS_HOST", "localhost"),
+		RedisPort:                      GetEnvInt("REDIS_PORT", 6379),
+		RedisUsername:                  GetEnv("REDIS_USERNAME", ""),
+		RedisPassword:                  GetEnv("REDIS_PASSWORD", ""),
+		RedisTLSEnabled:                GetEnv("REDIS_TLS_ENABLED", "false"),
+		RedisMode:                      GetEnv("REDIS_MODE", data.REDIS_MODE_STANDALONE),
+		RedisAddrs:                     GetEnv("REDIS_ADDRS", ""),
+		RedisMasterName:                GetEnv("REDIS_MASTER_NAME", ""),
+		RedisSentinelPassword:          GetEnv("REDIS_SENTINEL_PASSWORD", ""),
+		EventHubNameSpaceConString:     GetEnv("EVENT_HUB_NAMESPACE_CON_STRING", ""),
+		EventHubNotificationEventName:  GetEnv("EVENT_HUB_NOTIFICATION_EVENT_NAME", ""),
+		EventHubActionEventName:        GetEnv("EVENT_HUB_ACTION_EVENT_NAME", ""),
+		AllowedOrigins:                 GetEnv("ALLOWED_ORIGINS", "*"),
+		CorsAllowedMethods:             GetEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS"),
+		CorsAllowedHeaders:             GetEnv("CORS_ALLOWED_HEADERS", "Content-Type,X-User-ID,X-Tenant-ID,X-Correlation-ID,X-App-ID,X-Api-Key,traceparent,tracestate"),
+		CorsExposedHeaders:             GetEnv("CORS_EXPOSED_HEADERS", "Retry-After"),
+		CorsMaxAgeSeconds:              GetEnvInt("CORS_MAX_AGE_SECONDS", 600),
+		CorsAllowCredentials:           GetEnvBool("CORS_ALLOW_CREDENTIALS", true),
+		CorsRoutesFile:                 GetEnv("CORS_ROUTES_FILE", ""),
+		LogLevel:                       GetEnv("LOG_LEVEL", ""),
+		LogPiiMode:                     GetEnv("LOG_PII_MODE", "off"),
+		LogMethod:                      GetEnv("LOG_METHOD", "file"),
+		LogFilePath:                    GetEnv("LOG_FILE_PATH", "./logs/app.log"),
+		MaxLogFileSize:                 GetEnvInt("MAX_LOG_FILE_SIZE", 10485760),
+		AppInsightsInstrumentationKey:  GetEnv("APP_INSIGHTS_INSTRUMENTATION_KEY", ""),
+		EnableChangeStreams:            GetEnvBool("ENABLE_CHANGE_STREAMS", false),
+		WebhookMaxAttempts:             GetEnvInt("WEBHOOK_MAX_ATTEMPTS", 4),
+		WebhookWorkers:                 GetEnvInt("WEBHOOK_WORKERS", 4),
+		WebhookQueueSize:               GetEnvInt("WEBHOOK_QUEUE_SIZE", 1000),
+		WebhookTimeoutSeconds:          GetEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+		EventHubWorkerPoolSize:         GetEnvInt("EVENT_HUB_WORKER_POOL_SIZE", 8),
+		EventHubWorkerQueueSize:        GetEnvInt("EVENT_HUB_WORKER_QUEUE_SIZE", 100),
+		EventHubDrainTimeoutSeconds:    GetEnvInt("EVENT_HUB_DRAIN_TIMEOUT_SECONDS", 10),
+		ClientInfoCacheTTLSeconds:      GetEnvInt("CLIENT_INFO_CACHE_TTL_SECONDS", 300),
+		RedisRetryIntervalSeconds:      GetEnvInt("REDIS_RETRY_INTERVAL_SECONDS", 5),
+		AdminApiKey:                    GetEnv("ADMIN_API_KEY", ""),
+		IdleConnectionTimeoutMinutes:   GetEnvInt("IDLE_CONNECTION_TIMEOUT_MINUTES", 0),
+		ConnectionHeartbeatTTLSeconds:  GetEnvInt("CONNECTION_HEARTBEAT_TTL_SECONDS", 90),
+		DeletedRetentionDays:           GetEnvInt("DELETED_NOTIFICATION_RETENTION_DAYS", 30),
+		RetentionCleanupHour:           GetEnvInt("RETENTION_CLEANUP_HOUR", 3),
+		PinLimitPerUser:                GetEnvInt("PIN_LIMIT_PER_USER", 10),
+		RequireApiKeys:                 GetEnvBool("REQUIRE_API_KEYS", false),
+		WsTicketSecret:                 GetEnv("WS_TICKET_SECRET", ""),
+		WsTicketTTLSeconds:             GetEnvInt("WS_TICKET_TTL_SECONDS", 30),
+		RequireWsTickets:               GetEnvBool("REQUIRE_WS_TICKETS", false),
+		MaxRequestBodySize:             GetEnvInt("MAX_REQUEST_BODY_SIZE", 1048576),
+		SendQueueSize:                  GetEnvInt("SEND_QUEUE_SIZE", 256),
+		SlowConsumerThreshold:          GetEnvInt("SLOW_CONSUMER_THRESHOLD", 64),
+		SlowConsumerTimeoutSeconds:     GetEnvInt("SLOW_CONSUMER_TIMEOUT_SECONDS", 10),
+		SendQueuePriorityBurst:         GetEnvInt("SEND_QUEUE_PRIORITY_BURST", 16),
+		ConfigReloadFile:               GetEnv("CONFIG_RELOAD_FILE", ".env"),
+		NotificationDedupWindowSeconds: GetEnvInt("NOTIFICATION_DEDUP_WINDOW_SECONDS", 0),
+		OtelExporterEndpoint:           GetEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		OtelServiceName:                GetEnv("OTEL_SERVICE_NAME", data.SERVICE_NAME),
+		OtelSampleRatio:                GetEnvFloat("OTEL_TRACES_SAMPLE_RATIO", 1),
+		CircuitBreakerFailureThreshold: GetEnvInt("CIRCUIT_BREAKER_FAILURE_THRESHOLD", 5),
+		CircuitBreakerOpenSeconds:      GetEnvInt("CIRCUIT_BREAKER_OPEN_SECONDS", 30),
+		ConnectionHistorySize:          GetEnvInt("CONNECTION_HISTORY_SIZE", 0),
+		EventHubTopicMappingsFile:      GetEnv("EVENT_HUB_TOPIC_MAPPINGS_FILE", ""),
+		EventHubConsumerGroup:          GetEnv("EVENT_HUB_CONSUMER_GROUP", "$Default"),
+		EventHubPartitionLeases:        GetEnvBool("EVENT_HUB_PARTITION_LEASES", false),
+		EventHubLeaseTTLSeconds:        GetEnvInt("EVENT_HUB_LEASE_TTL_SECONDS", 30),
+		EventHubIdempotencyTTLSeconds:  GetEnvInt("EVENT_HUB_IDEMPOTENCY_TTL_SECONDS", 86400),
+		EventSource:                    GetEnv("EVENT_SOURCE", data.SOURCE_EVENT_HUB),
+		ServiceBusConString:            GetEnv("SERVICE_BUS_CON_STRING", ""),
+		ServiceBusQueues:               GetEnv("SERVICE_BUS_QUEUES", ""),
+		ServiceBusSessions:             GetEnvBool("SERVICE_BUS_SESSIONS", false),
+		ServiceBusConcurrency:          GetEnvInt("SERVICE_BUS_CONCURRENCY", 8),
+		OriginCacheTTLSeconds:          GetEnvInt("ORIGIN_CACHE_TTL_SECONDS", 60),
+		AppCacheTTLSeconds:             GetEnvInt("APP_CACHE_TTL_SECONDS", 60),
+		PolicyCacheTTLSeconds:          GetEnvInt("POLICY_CACHE_TTL_SECONDS", 30),
+		ConfigurationCacheSize:         GetEnvInt("CONFIGURATION_CACHE_SIZE", 10000),
+		ConfigurationCacheTTLSeconds:   GetEnvInt("CONFIGURATION_CACHE_TTL_SECONDS", 60),
+		ListRefreshCoalesceMs:          GetEnvInt("LIST_REFRESH_COALESCE_MS", 200),
+		ListChunkSize:                  GetEnvInt("LIST_CHUNK_SIZE", 200),
+		ListHistoryDays:                GetEnvInt("LIST_HISTORY_DAYS", 30),
+		GroupSummaryThreshold:          GetEnvInt("GROUP_SUMMARY_THRESHOLD", 0),
+		WebSocketReadBufferSize:        GetEnvInt("WS_READ_BUFFER_SIZE", 1024),
+		WebSocketWriteBufferSize:       GetEnvInt("WS_WRITE_BUFFER_SIZE", 1024),
+		WebSocketMaxMessageSize:        GetEnvInt("WS_MAX_MESSAGE_SIZE", 131072),
+		EncryptedApps:                  GetEnv("ENCRYPTED_APPS", ""),
+		EncryptionKeys:                 GetEnv("ENCRYPTION_KEYS", ""),
+		EncryptionKeyId:                GetEnv("ENCRYPTION_KEY_ID", ""),
+		BroadcastMinIntervalSeconds:    GetEnvInt("BROADCAST_MIN_INTERVAL_SECONDS", 10),
+		SimulationEnabled:              GetEnvBool("SIMULATION_ENABLED", false),
+		SimulationMaxCount:             GetEnvInt("SIMULATION_MAX_COUNT", 500),
+		DrainWindowSeconds:             GetEnvInt("DRAIN_WINDOW_SECONDS", 30),
+		DrainRetryAfterSeconds:         GetEnvInt("DRAIN_RETRY_AFTER_SECONDS", 5),
+		MongoQueryTimeoutMs:            GetEnvInt("MONGO_QUERY_TIMEOUT_MS", 5000),
+		MongoRetryMaxAttempts:          GetEnvInt("MONGO_RETRY_MAX_ATTEMPTS", 3),
+		MongoRetryBaseDelayMs:          GetEnvInt("MONGO_RETRY_BASE_DELAY_MS", 50),
+		MongoRetryMaxDelayMs:           GetEnvInt("MONGO_RETRY_MAX_DELAY_MS", 1000),
+		MongoMaxPoolSize:               GetEnvInt("MONGO_MAX_POOL_SIZE", 100),
+		MongoMinPoolSize:               GetEnvInt("MONGO_MIN_POOL_SIZE", 0),
+		MongoMaxConnIdleSeconds:        GetEnvInt("MONGO_MAX_CONN_IDLE_SECONDS", 0),
+		MongoServerSelectionTimeoutMs:  GetEnvInt("MONGO_SERVER_SELECTION_TIMEOUT_MS", 30000),
+		MongoHealthCheckSeconds:        GetEnvInt("MONGO_HEALTH_CHECK_SECONDS", 10),
+		MongoHealthFailureThreshold:    GetEnvInt("MONGO_HEALTH_FAILURE_THRESHOLD", 3),
+		ReminderLeadSeconds:            GetEnvInt("REMINDER_LEAD_SECONDS", 300),
+		ReminderCheckIntervalSeconds:   GetEnvInt("REMINDER_CHECK_INTERVAL_SECONDS", 30),
+		MessageMaxLength:               GetEnvInt("MESSAGE_MAX_LENGTH", 4000),
+		MessageOverflowPolicy:          GetEnv("MESSAGE_OVERFLOW_POLICY", data.MESSAGE_OVERFLOW_REJECT),
+		WebSocketMaxBatchSize:          GetEnvInt("WS_MAX_BATCH_SIZE", 100),
 	}
 }
 
+// CorsMethods returns the methods allowed in CORS requests, listed comma-separated in CORS_ALLOWED_METHODS.
+func (c *Config) CorsMethods() []string {
+	return splitList(c.CorsAllowedMethods)
+}
+
+// CorsHeaders returns the request headers allowed in CORS requests, listed comma-separated in CORS_ALLOWED_HEADERS.
+func (c *Config) CorsHeaders() []string {
+	return splitList(c.CorsAllowedHeaders)
+}
+
+// CorsExposedHeaderNames returns the response headers exposed to CORS requests, listed comma-separated in
+// CORS_EXPOSED_HEADERS.
+func (c *Config) CorsExposedHeaderNames() []string {
+	return splitList(c.CorsExposedHeaders)
+}
+
+// RedisAddresses returns the Redis nodes to connect to, listed comma-separated as host:port in REDIS_ADDRS:
+// the seed nodes of a cluster or the sentinels. REDIS_HOST and REDIS_PORT are used if the list is empty.
+func (c *Config) RedisAddresses() []string {
+	if addrs := splitList(c.RedisAddrs); len(addrs) > 0 {
+		return addrs
+	}
+	return []string{c.RedisHost + ":" + strconv.Itoa(c.RedisPort)}
+}
+
+// splitList returns the non-empty, trimmed items of a comma-separated list.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// NotificationHubs returns the Event Hubs notifications are consumed from, listed comma-separated in
+// EVENT_HUB_NOTIFICATION_EVENT_NAME.
+func (c *Config) NotificationHubs() []string {
+	var hubs []string
+	for _, hub := range strings.Split(c.EventHubNotificationEventName, ",") {
+		if hub = strings.TrimSpace(hub); hub != "" {
+			hubs = append(hubs, hub)
+		}
+	}
+	return hubs
+}
+
+// NotificationQueues returns the Service Bus queues notifications are consumed from, listed comma-separated in
+// SERVICE_BUS_QUEUES.
+func (c *Config) NotificationQueues() []string {
+	var queues []string
+	for _, queue := range strings.Split(c.ServiceBusQueues, ",") {
+		if queue = strings.TrimSpace(queue); queue != "" {
+			queues = append(queues, queue)
+		}
+	}
+	return queues
+}
+
+// EncryptedAppIds returns the apps whose notification messages are encrypted at rest, listed comma-separated
+// in ENCRYPTED_APPS.
+func (c *Config) EncryptedAppIds() []string {
+	var appIds []string
+	for _, appId := range strings.Split(c.EncryptedApps, ",") {
+		if appId = strings.TrimSpace(appId); appId != "" {
+			appIds = append(appIds, appId)
+		}
+	}
+	return appIds
+}
+
+// EncryptionKeySet returns the master keys listed in ENCRYPTION_KEYS as comma-separated keyId:key pairs,
+// with base64 encoded keys, keyed by ID. It returns an error if a pair is malformed or listed twice.
+func (c *Config) EncryptionKeySet() (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(c.EncryptionKeys, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		keyId, encoded, ok := strings.Cut(pair, ":")
+		if !ok || keyId == "" {
+			return nil, fmt.Errorf("encryption key %q must be formatted as keyId:key", pair)
+		}
+		if _, ok := keys[keyId]; ok {
+			return nil, fmt.Errorf("encryption key %s is listed twice", keyId)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s is not base64 encoded", keyId)
+		}
+		keys[keyId] = key
+	}
+	return keys, nil
+}
+
 func GetEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -72,3 +366,21 @@ func GetEnvInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func GetEnvBool(key string, fallback bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func GetEnvFloat(key string, fallback float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
@@ -8,6 +8,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 func MongoConnection() *mongo.Database {
@@ -15,37 +16,62 @@ func MongoConnection() *mongo.Database {
 	port := LoadConfig().MongoPort
 	dbName := LoadConfig().MongoDBName
 	username := LoadConfig().MongoUserName
-	password := LoadConfig().MongoPassword
 	mongoRetryWrites := LoadConfig().mongoRetryWrites
 	mongoSsl := LoadConfig().mongoSsl
 
 	log.Printf("Mongo Configurations: host=%s, port=%d, dbName=%s, username=%s, password=***, mongoRetryWrites=%s, mongoSsl=%s", host, port, dbName, username, mongoRetryWrites, mongoSsl)
-	uri := fmt.Sprintf(
-		"mongodb://%s:%s@%s:%d/?ssl=%s&retrywrites=%s",
-		username,
-		password,
-		host,
-		port,
-		mongoSsl,
-		mongoRetryWrites,
-	)
+	log.Printf("Mongo Pool Configurations: maxPoolSize=%d, minPoolSize=%d, maxConnIdleSeconds=%d, serverSelectionTimeoutMs=%d",
+		LoadConfig().MongoMaxPoolSize, LoadConfig().MongoMinPoolSize, LoadConfig().MongoMaxConnIdleSeconds, LoadConfig().MongoServerSelectionTimeoutMs)
+	log.Printf("Mongo Connection URI: %s", mongoURI())
 
-	log.Printf("Mongo Connection URI: %s", uri)
-
-	clientOptions := options.Client().ApplyURI(uri).SetDirect(true)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	db, err := ConnectMongo(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Connected to MongoDB at %s:%d, using database: %s", host, port, dbName)
+	return db
+}
+
+// ConnectMongo connects to the configured MongoDB database and pings it, returning an error instead of
+// exiting when MongoDB cannot be reached.
+func ConnectMongo(ctx context.Context) (*mongo.Database, error) {
+	cfg := LoadConfig()
+	// The monitor records every command as a span with the collection as attribute. The command itself is left
+	// out, as it carries notification contents and user IDs that must not leave the service unredacted.
+	clientOptions := options.Client().ApplyURI(mongoURI()).SetDirect(true).SetMonitor(otelmongo.NewMonitor()).
+		SetMaxPoolSize(uint64(cfg.MongoMaxPoolSize)).
+		SetMinPoolSize(uint64(cfg.MongoMinPoolSize)).
+		SetMaxConnIdleTime(time.Duration(cfg.MongoMaxConnIdleSeconds) * time.Second).
+		SetServerSelectionTimeout(time.Duration(cfg.MongoServerSelectionTimeoutMs) * time.Millisecond).
+		SetPoolMonitor(newMongoPoolMonitor(cfg.MongoMaxPoolSize))
+
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		log.Fatalf("MongoDB connection error: %v", err)
+		return nil, fmt.Errorf("MongoDB connection error: %w", err)
 	}
 
 	// Ping to verify connection
 	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatalf("MongoDB ping error: %v", err)
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("MongoDB ping error: %w", err)
 	}
+	return client.Database(cfg.MongoDBName), nil
+}
 
-	log.Printf("Connected to MongoDB at %s:%d, using database: %s", host, port, dbName)
-	return client.Database(dbName)
+// mongoURI returns the connection URI of the configured MongoDB server.
+func mongoURI() string {
+	cfg := LoadConfig()
+	return fmt.Sprintf(
+		"mongodb://%s:%s@%s:%d/?ssl=%s&retrywrites=%s",
+		cfg.MongoUserName,
+		cfg.MongoPassword,
+		cfg.MongoHost,
+		cfg.MongoPort,
+		cfg.mongoSsl,
+		cfg.mongoRetryWrites,
+	)
 }
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"log"
+	"r2-notify-server/metrics"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// mongoPool tracks the connections of the MongoDB connection pool, so saturation is reported once when every
+// connection is checked out rather than on every checkout.
+type mongoPool struct {
+	maxSize    int64
+	open       int64
+	checkedOut int64
+	saturated  bool
+	mutex      sync.Mutex
+}
+
+// newMongoPoolMonitor returns a pool monitor exporting the open and checked out connections of the pool as the
+// mongo.pool.open and mongo.pool.checked_out gauges. Checkouts timing out because the pool is exhausted are
+// counted and logged, so connection storms can be told apart from an unreachable server.
+func newMongoPoolMonitor(maxSize int) *event.PoolMonitor {
+	pool := &mongoPool{maxSize: int64(maxSize)}
+	return &event.PoolMonitor{Event: pool.handle}
+}
+
+// handle updates the pool gauges from a pool event.
+func (p *mongoPool) handle(evt *event.PoolEvent) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	switch evt.Type {
+	case event.ConnectionCreated:
+		p.open++
+	case event.ConnectionClosed:
+		p.open = max(p.open-1, 0)
+	case event.GetSucceeded:
+		p.checkedOut++
+	case event.ConnectionReturned:
+		p.checkedOut = max(p.checkedOut-1, 0)
+	case event.GetFailed:
+		metrics.Inc("mongo.pool.checkout.failed")
+		if evt.Reason == event.ReasonTimedOut {
+			metrics.Inc("mongo.pool.checkout.timeouts")
+			log.Printf("MongoDB connection checkout timed out with %d of %d connections checked out", p.checkedOut, p.maxSize)
+		}
+		return
+	case event.PoolCleared:
+		metrics.Inc("mongo.pool.cleared")
+		log.Printf("MongoDB connection pool of %s cleared", evt.Address)
+		return
+	default:
+		return
+	}
+	metrics.SetGauge("mongo.pool.open", p.open)
+	metrics.SetGauge("mongo.pool.checked_out", p.checkedOut)
+
+	saturated := p.checkedOut >= p.maxSize
+	if saturated && !p.saturated {
+		metrics.Inc("mongo.pool.saturated")
+		log.Printf("MongoDB connection pool saturated: all %d connections are checked out, operations wait for a free connection", p.maxSize)
+	}
+	p.saturated = saturated
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"r2-notify-server/data"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func PostgresConnection() *pgxpool.Pool {
+	host := LoadConfig().PostgresHost
+	port := LoadConfig().PostgresPort
+	dbName := LoadConfig().PostgresDBName
+	username := LoadConfig().PostgresUserName
+	sslMode := LoadConfig().PostgresSSLMode
+
+	log.Printf("Postgres Configurations: host=%s, port=%d, dbName=%s, username=%s, password=***, sslMode=%s", host, port, dbName, username, sslMode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pool, err := ConnectPostgres(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Connected to Postgres at %s:%d, using database: %s", host, port, dbName)
+	return pool
+}
+
+// ConnectPostgres connects to the configured Postgres database and pings it, returning an error instead of
+// exiting when Postgres cannot be reached.
+func ConnectPostgres(ctx context.Context) (*pgxpool.Pool, error) {
+	cfg := LoadConfig()
+	uri := fmt.Sprintf(
+		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
+		cfg.PostgresUserName,
+		cfg.PostgresPassword,
+		cfg.PostgresHost,
+		cfg.PostgresPort,
+		cfg.PostgresDBName,
+		cfg.PostgresSSLMode,
+	)
+
+	poolConfig, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return nil, fmt.Errorf("Postgres connection error: %w", err)
+	}
+	poolConfig.ConnConfig.Tracer = queryTracer{}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Postgres connection error: %w", err)
+	}
+
+	// Ping to verify connection
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("Postgres ping error: %w", err)
+	}
+	return pool, nil
+}
+
+// queryTracer records every query as a client span, the Postgres counterpart of the MongoDB command monitor.
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, query pgx.TraceQueryStartData) context.Context {
+	ctx, _ = otel.Tracer(data.SERVICE_NAME).Start(ctx, "postgres.query",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.namespace", conn.Config().Database),
+			attribute.String("db.query.text", query.SQL),
+		),
+	)
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, query pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if query.Err != nil {
+		span.RecordError(query.Err)
+		span.SetStatus(codes.Error, query.Err.Error())
+	}
+	span.SetAttributes(attribute.Int64("db.response.returned_rows", query.CommandTag.RowsAffected()))
+	span.End()
+}
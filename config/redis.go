@@ -3,53 +3,99 @@ package config
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"log"
-	"strconv"
+	"r2-notify-server/data"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 var (
-	RDB *redis.Client
+	// RDB is the Redis client of the configured topology: a single node, a cluster or a master found through
+	// sentinels. Keys used together in a transaction or script must hash to the same cluster slot.
+	RDB redis.UniversalClient
 	Ctx = context.Background()
 )
 
 func InitRedis() {
-	redisHost := LoadConfig().RedisHost
-	redisPort := LoadConfig().RedisPort
-	redisUsername := LoadConfig().RedisUsername
-	redisPassword := LoadConfig().RedisPassword
-	redisTLSEnabled := LoadConfig().RedisTLSEnabled
-	log.Printf("Redis Configurations: host=%s, port=%d, username=%s, password=***, tlsEnabled=%s", redisHost, redisPort, redisUsername, redisTLSEnabled)
-
-	options := &redis.Options{
-		Addr:         redisHost + ":" + strconv.Itoa(redisPort),
-		Username:     redisUsername,
-		Password:     redisPassword,
-		DB:           0,
-		DialTimeout:  10 * time.Second,
-		ReadTimeout:  3 * time.Second,
-		WriteTimeout: 3 * time.Second,
-		PoolSize:     20,
-		MinIdleConns: 5,
-	}
-
-	if redisTLSEnabled == "true" {
-		options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	cfg := LoadConfig()
+	log.Printf("Redis Configurations: mode=%s, addrs=%s, masterName=%s, username=%s, password=***, tlsEnabled=%s",
+		cfg.RedisMode, strings.Join(cfg.RedisAddresses(), ","), cfg.RedisMasterName, cfg.RedisUsername, cfg.RedisTLSEnabled)
+	if cfg.RedisTLSEnabled == "true" {
 		log.Println("TLS enabled for Redis connection")
 	} else {
 		log.Println("TLS disabled for Redis connection")
 	}
 
-	RDB = redis.NewClient(options)
-
 	ctx, cancel := context.WithTimeout(Ctx, 10*time.Second)
 	defer cancel()
 
-	if _, err := RDB.Ping(ctx).Result(); err != nil {
-		log.Fatalf("Redis connection failed: %v", err)
+	client, err := ConnectRedis(ctx)
+	if err != nil {
+		log.Fatal(err)
 	}
+	RDB = client
 
 	log.Printf("Connected to Redis successfully!")
 }
+
+// ConnectRedis connects to Redis with the topology selected by REDIS_MODE and pings it, returning an error
+// instead of exiting when Redis cannot be reached. The client is closed on failure.
+func ConnectRedis(ctx context.Context) (redis.UniversalClient, error) {
+	cfg := LoadConfig()
+	var tlsConfig *tls.Config
+	if cfg.RedisTLSEnabled == "true" {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	var client redis.UniversalClient
+	switch cfg.RedisMode {
+	case data.REDIS_MODE_CLUSTER:
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.RedisAddresses(),
+			Username:     cfg.RedisUsername,
+			Password:     cfg.RedisPassword,
+			DialTimeout:  10 * time.Second,
+			ReadTimeout:  3 * time.Second,
+			WriteTimeout: 3 * time.Second,
+			PoolSize:     20,
+			MinIdleConns: 5,
+			TLSConfig:    tlsConfig,
+		})
+	case data.REDIS_MODE_SENTINEL:
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.RedisMasterName,
+			SentinelAddrs:    cfg.RedisAddresses(),
+			SentinelPassword: cfg.RedisSentinelPassword,
+			Username:         cfg.RedisUsername,
+			Password:         cfg.RedisPassword,
+			DB:               0,
+			DialTimeout:      10 * time.Second,
+			ReadTimeout:      3 * time.Second,
+			WriteTimeout:     3 * time.Second,
+			PoolSize:         20,
+			MinIdleConns:     5,
+			TLSConfig:        tlsConfig,
+		})
+	default:
+		client = redis.NewClient(&redis.Options{
+			Addr:         cfg.RedisAddresses()[0],
+			Username:     cfg.RedisUsername,
+			Password:     cfg.RedisPassword,
+			DB:           0,
+			DialTimeout:  10 * time.Second,
+			ReadTimeout:  3 * time.Second,
+			WriteTimeout: 3 * time.Second,
+			PoolSize:     20,
+			MinIdleConns: 5,
+			TLSConfig:    tlsConfig,
+		})
+	}
+	if _, err := client.Ping(ctx).Result(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("Redis %s connection failed: %w", cfg.RedisMode, err)
+	}
+	return client, nil
+}
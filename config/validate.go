@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"r2-notify-server/data"
+	"strconv"
+	"strings"
+)
+
+// Environment variables parsed as integers. GetEnvInt falls back to the default for values that
+// are not numbers, so Validate reports them instead of letting the typo go unnoticed.
+var intEnvKeys = []string{
+	"PORT", "MONGO_PORT", "POSTGRES_PORT", "REDIS_PORT", "MAX_LOG_FILE_SIZE", "WEBHOOK_MAX_ATTEMPTS",
+	"WEBHOOK_TIMEOUT_SECONDS", "WEBHOOK_WORKERS", "WEBHOOK_QUEUE_SIZE", "EVENT_HUB_WORKER_POOL_SIZE", "EVENT_HUB_WORKER_QUEUE_SIZE",
+	"EVENT_HUB_DRAIN_TIMEOUT_SECONDS", "CLIENT_INFO_CACHE_TTL_SECONDS", "REDIS_RETRY_INTERVAL_SECONDS",
+	"IDLE_CONNECTION_TIMEOUT_MINUTES", "CONNECTION_HEARTBEAT_TTL_SECONDS", "DELETED_NOTIFICATION_RETENTION_DAYS", "SEND_QUEUE_SIZE",
+	"SLOW_CONSUMER_THRESHOLD", "SLOW_CONSUMER_TIMEOUT_SECONDS", "SEND_QUEUE_PRIORITY_BURST", "NOTIFICATION_DEDUP_WINDOW_SECONDS",
+	"CIRCUIT_BREAKER_FAILURE_THRESHOLD", "CIRCUIT_BREAKER_OPEN_SECONDS", "CONNECTION_HISTORY_SIZE",
+	"ORIGIN_CACHE_TTL_SECONDS", "APP_CACHE_TTL_SECONDS", "POLICY_CACHE_TTL_SECONDS", "LIST_REFRESH_COALESCE_MS", "LIST_CHUNK_SIZE", "LIST_HISTORY_DAYS", "GROUP_SUMMARY_THRESHOLD", "WS_READ_BUFFER_SIZE", "WS_WRITE_BUFFER_SIZE",
+	"WS_MAX_MESSAGE_SIZE", "BROADCAST_MIN_INTERVAL_SECONDS", "SIMULATION_MAX_COUNT", "DRAIN_WINDOW_SECONDS", "DRAIN_RETRY_AFTER_SECONDS", "MONGO_QUERY_TIMEOUT_MS", "MONGO_RETRY_MAX_ATTEMPTS", "MONGO_MAX_POOL_SIZE", "MONGO_MIN_POOL_SIZE", "MONGO_MAX_CONN_IDLE_SECONDS", "MONGO_SERVER_SELECTION_TIMEOUT_MS", "MONGO_HEALTH_CHECK_SECONDS", "MONGO_HEALTH_FAILURE_THRESHOLD",
+	"MONGO_RETRY_BASE_DELAY_MS", "MONGO_RETRY_MAX_DELAY_MS", "SERVICE_BUS_CONCURRENCY", "EVENT_HUB_LEASE_TTL_SECONDS",
+	"EVENT_HUB_IDEMPOTENCY_TTL_SECONDS", "RETENTION_CLEANUP_HOUR", "MAX_REQUEST_BODY_SIZE", "CORS_MAX_AGE_SECONDS",
+	"PIN_LIMIT_PER_USER", "CONFIGURATION_CACHE_SIZE", "CONFIGURATION_CACHE_TTL_SECONDS", "WS_TICKET_TTL_SECONDS",
+	"REMINDER_LEAD_SECONDS", "REMINDER_CHECK_INTERVAL_SECONDS", "MESSAGE_MAX_LENGTH", "WS_MAX_BATCH_SIZE",
+}
+
+// Environment variables parsed as decimal numbers.
+var floatEnvKeys = []string{"OTEL_TRACES_SAMPLE_RATIO"}
+
+// Environment variables parsed as booleans.
+var boolEnvKeys = []string{"MONGO_RETRY_WRITES", "MONGO_SSL", "REDIS_TLS_ENABLED", "ENABLE_CHANGE_STREAMS", "REQUIRE_API_KEYS", "REQUIRE_WS_TICKETS", "SERVICE_BUS_SESSIONS", "EVENT_HUB_PARTITION_LEASES", "CORS_ALLOW_CREDENTIALS", "SIMULATION_ENABLED"}
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(e.Problems, "; "))
+}
+
+// Validate checks the loaded configuration and returns a *ValidationError listing all problems at once,
+// or nil if the configuration is usable. Settings the service cannot run without are required in every
+// environment; in production, missing credentials and insecure defaults such as allowing all origins or
+// unencrypted database connections are rejected as well.
+func Validate() error {
+	cfg := LoadConfig()
+	production := cfg.Environment == data.PRODUCTION_ENV
+	var problems []string
+	require := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	for _, key := range intEnvKeys {
+		if value := os.Getenv(key); value != "" {
+			_, err := strconv.Atoi(value)
+			require(err == nil, "%s must be a number, got %q", key, value)
+		}
+	}
+	for _, key := range floatEnvKeys {
+		if value := os.Getenv(key); value != "" {
+			_, err := strconv.ParseFloat(value, 64)
+			require(err == nil, "%s must be a number, got %q", key, value)
+		}
+	}
+	for _, key := range boolEnvKeys {
+		if value := os.Getenv(key); value != "" {
+			_, err := strconv.ParseBool(value)
+			require(err == nil, "%s must be true or false, got %q", key, value)
+		}
+	}
+
+	// Service
+	port, err := strconv.Atoi(cfg.Port)
+	require(err == nil && port > 0 && port <= 65535, "PORT must be a valid port number, got %q", cfg.Port)
+	require(cfg.SendQueueSize > 0, "SEND_QUEUE_SIZE must be greater than 0")
+	require(cfg.SlowConsumerThreshold > 0 && cfg.SlowConsumerThreshold <= cfg.SendQueueSize,
+		"SLOW_CONSUMER_THRESHOLD must be between 1 and SEND_QUEUE_SIZE (%d)", cfg.SendQueueSize)
+	require(cfg.SendQueuePriorityBurst > 0, "SEND_QUEUE_PRIORITY_BURST must be greater than 0")
+	require(cfg.IdleConnectionTimeoutMinutes >= 0, "IDLE_CONNECTION_TIMEOUT_MINUTES must not be negative")
+	require(len(cfg.CorsMethods()) > 0, "CORS_ALLOWED_METHODS must list at least one method")
+	require(cfg.CorsMaxAgeSeconds >= 0, "CORS_MAX_AGE_SECONDS must not be negative")
+	if cfg.CorsRoutesFile != "" {
+		_, err := os.Stat(cfg.CorsRoutesFile)
+		require(err == nil, "CORS_ROUTES_FILE %q cannot be read", cfg.CorsRoutesFile)
+	}
+	require(cfg.ConnectionHeartbeatTTLSeconds == 0 || cfg.ConnectionHeartbeatTTLSeconds > 30,
+		"CONNECTION_HEARTBEAT_TTL_SECONDS must be 0 or longer than the 30 second ping interval")
+	require(cfg.NotificationDedupWindowSeconds >= 0, "NOTIFICATION_DEDUP_WINDOW_SECONDS must not be negative")
+	require(cfg.EventHubIdempotencyTTLSeconds >= 0, "EVENT_HUB_IDEMPOTENCY_TTL_SECONDS must not be negative")
+	require(cfg.ConnectionHistorySize >= 0, "CONNECTION_HISTORY_SIZE must not be negative")
+	require(cfg.OriginCacheTTLSeconds >= 0, "ORIGIN_CACHE_TTL_SECONDS must not be negative")
+	require(cfg.AppCacheTTLSeconds >= 0, "APP_CACHE_TTL_SECONDS must not be negative")
+	require(cfg.PolicyCacheTTLSeconds >= 0, "POLICY_CACHE_TTL_SECONDS must not be negative")
+	require(cfg.ConfigurationCacheSize >= 0, "CONFIGURATION_CACHE_SIZE must not be negative")
+	require(cfg.ConfigurationCacheTTLSeconds >= 0, "CONFIGURATION_CACHE_TTL_SECONDS must not be negative")
+	require(cfg.ListRefreshCoalesceMs >= 0, "LIST_REFRESH_COALESCE_MS must not be negative")
+	require(cfg.ListChunkSize >= 0, "LIST_CHUNK_SIZE must not be negative")
+	require(cfg.ListHistoryDays > 0, "LIST_HISTORY_DAYS must be positive")
+	require(cfg.GroupSummaryThreshold >= 0, "GROUP_SUMMARY_THRESHOLD must not be negative")
+	require(cfg.WebSocketReadBufferSize > 0, "WS_READ_BUFFER_SIZE must be greater than 0")
+	require(cfg.WebSocketWriteBufferSize > 0, "WS_WRITE_BUFFER_SIZE must be greater than 0")
+	require(cfg.WebSocketMaxMessageSize > 0, "WS_MAX_MESSAGE_SIZE must be greater than 0")
+	require(cfg.MaxRequestBodySize > 0, "MAX_REQUEST_BODY_SIZE must be greater than 0")
+	require(cfg.WsTicketTTLSeconds > 0, "WS_TICKET_TTL_SECONDS must be greater than 0")
+	require(cfg.WsTicketSecret == "" || len(cfg.WsTicketSecret) >= 32, "WS_TICKET_SECRET must be at least 32 characters long")
+	require(!cfg.RequireWsTickets || cfg.WsTicketSecret != "", "WS_TICKET_SECRET is required when REQUIRE_WS_TICKETS is enabled")
+	require(cfg.BroadcastMinIntervalSeconds >= 0, "BROADCAST_MIN_INTERVAL_SECONDS must not be negative")
+	require(cfg.SimulationMaxCount > 0, "SIMULATION_MAX_COUNT must be greater than 0")
+	require(!cfg.SimulationEnabled || !production, "SIMULATION_ENABLED must not be enabled in production")
+	require(cfg.DrainWindowSeconds >= 0, "DRAIN_WINDOW_SECONDS must not be negative")
+	require(cfg.DrainRetryAfterSeconds >= 0, "DRAIN_RETRY_AFTER_SECONDS must not be negative")
+	require(cfg.DeletedRetentionDays > 0, "DELETED_NOTIFICATION_RETENTION_DAYS must be greater than 0")
+	require(cfg.PinLimitPerUser >= 0, "PIN_LIMIT_PER_USER must not be negative")
+	require(cfg.RetentionCleanupHour >= 0 && cfg.RetentionCleanupHour <= 23, "RETENTION_CLEANUP_HOUR must be between 0 and 23")
+	require(cfg.CircuitBreakerFailureThreshold > 0, "CIRCUIT_BREAKER_FAILURE_THRESHOLD must be greater than 0")
+	require(cfg.CircuitBreakerOpenSeconds > 0, "CIRCUIT_BREAKER_OPEN_SECONDS must be greater than 0")
+
+	// Databases. MongoDB is always used, Postgres only stores notifications and configurations.
+	require(cfg.DbDriver == data.DB_DRIVER_MONGO || cfg.DbDriver == data.DB_DRIVER_POSTGRES,
+		"DB_DRIVER must be %q or %q, got %q", data.DB_DRIVER_MONGO, data.DB_DRIVER_POSTGRES, cfg.DbDriver)
+	require(cfg.MongoHost != "", "MONGO_HOST is required")
+	require(cfg.MongoDBName != "", "MONGO_DB_NAME is required")
+	require(cfg.MongoQueryTimeoutMs >= 0, "MONGO_QUERY_TIMEOUT_MS must not be negative")
+	require(cfg.MongoRetryMaxAttempts > 0, "MONGO_RETRY_MAX_ATTEMPTS must be greater than 0")
+	require(cfg.MongoRetryBaseDelayMs >= 0 && cfg.MongoRetryBaseDelayMs <= cfg.MongoRetryMaxDelayMs,
+		"MONGO_RETRY_BASE_DELAY_MS must be between 0 and MONGO_RETRY_MAX_DELAY_MS (%d)", cfg.MongoRetryMaxDelayMs)
+	require(cfg.MongoMaxPoolSize > 0, "MONGO_MAX_POOL_SIZE must be greater than 0")
+	require(cfg.MongoMinPoolSize >= 0 && cfg.MongoMinPoolSize <= cfg.MongoMaxPoolSize,
+		"MONGO_MIN_POOL_SIZE must be between 0 and MONGO_MAX_POOL_SIZE (%d)", cfg.MongoMaxPoolSize)
+	require(cfg.MongoMaxConnIdleSeconds >= 0, "MONGO_MAX_CONN_IDLE_SECONDS must not be negative")
+	require(cfg.MongoServerSelectionTimeoutMs > 0, "MONGO_SERVER_SELECTION_TIMEOUT_MS must be greater than 0")
+	require(cfg.MongoHealthCheckSeconds >= 0, "MONGO_HEALTH_CHECK_SECONDS must not be negative")
+	require(cfg.MongoHealthFailureThreshold > 0, "MONGO_HEALTH_FAILURE_THRESHOLD must be greater than 0")
+	require(cfg.ReminderLeadSeconds >= 0, "REMINDER_LEAD_SECONDS must not be negative")
+	require(cfg.ReminderCheckIntervalSeconds >= 0, "REMINDER_CHECK_INTERVAL_SECONDS must not be negative")
+	require(cfg.MessageMaxLength > 1, "MESSAGE_MAX_LENGTH must be greater than 1")
+	require(cfg.WebSocketMaxBatchSize > 0, "WS_MAX_BATCH_SIZE must be greater than 0")
+	require(cfg.MessageOverflowPolicy == data.MESSAGE_OVERFLOW_REJECT || cfg.MessageOverflowPolicy == data.MESSAGE_OVERFLOW_TRUNCATE,
+		"MESSAGE_OVERFLOW_POLICY must be %q or %q, got %q", data.MESSAGE_OVERFLOW_REJECT, data.MESSAGE_OVERFLOW_TRUNCATE, cfg.MessageOverflowPolicy)
+	if cfg.DbDriver == data.DB_DRIVER_POSTGRES {
+		require(cfg.PostgresHost != "", "POSTGRES_HOST is required when DB_DRIVER is postgres")
+		require(cfg.PostgresDBName != "", "POSTGRES_DB_NAME is required when DB_DRIVER is postgres")
+	}
+	require(cfg.RedisMode == data.REDIS_MODE_STANDALONE || cfg.RedisMode == data.REDIS_MODE_CLUSTER || cfg.RedisMode == data.REDIS_MODE_SENTINEL,
+		"REDIS_MODE must be %q, %q or %q, got %q", data.REDIS_MODE_STANDALONE, data.REDIS_MODE_CLUSTER, data.REDIS_MODE_SENTINEL, cfg.RedisMode)
+	require(cfg.RedisHost != "" || cfg.RedisAddrs != "", "REDIS_HOST or REDIS_ADDRS is required")
+	require(cfg.RedisMode != data.REDIS_MODE_STANDALONE || len(splitList(cfg.RedisAddrs)) <= 1, "REDIS_ADDRS must list a single node when REDIS_MODE is %s", data.REDIS_MODE_STANDALONE)
+	require(cfg.RedisMode != data.REDIS_MODE_SENTINEL || cfg.RedisMasterName != "", "REDIS_MASTER_NAME is required when REDIS_MODE is %s", data.REDIS_MODE_SENTINEL)
+	for _, addr := range splitList(cfg.RedisAddrs) {
+		_, port, err := net.SplitHostPort(addr)
+		_, portErr := strconv.Atoi(port)
+		require(err == nil && portErr == nil, "REDIS_ADDRS must list host:port addresses, got %q", addr)
+	}
+
+	// Event source. The service exits if the notification consumer cannot be started.
+	require(cfg.EventSource == data.SOURCE_EVENT_HUB || cfg.EventSource == data.SOURCE_SERVICE_BUS,
+		"EVENT_SOURCE must be %s or %s, got %q", data.SOURCE_EVENT_HUB, data.SOURCE_SERVICE_BUS, cfg.EventSource)
+	if cfg.EventSource == data.SOURCE_EVENT_HUB {
+		require(cfg.EventHubNameSpaceConString != "", "EVENT_HUB_NAMESPACE_CON_STRING is required")
+		require(len(cfg.NotificationHubs()) > 0, "EVENT_HUB_NOTIFICATION_EVENT_NAME is required")
+		require(!cfg.EventHubPartitionLeases || cfg.EventHubLeaseTTLSeconds >= 3, "EVENT_HUB_LEASE_TTL_SECONDS must be at least 3 when EVENT_HUB_PARTITION_LEASES is enabled")
+	}
+	require(cfg.EventHubNameSpaceConString == "" || strings.HasPrefix(cfg.EventHubNameSpaceConString, "Endpoint="),
+		"EVENT_HUB_NAMESPACE_CON_STRING must be an Event Hub namespace connection string starting with Endpoint=")
+	require(cfg.EventHubActionEventName == "" || cfg.EventHubNameSpaceConString != "",
+		"EVENT_HUB_NAMESPACE_CON_STRING is required when EVENT_HUB_ACTION_EVENT_NAME is set")
+	if cfg.EventSource == data.SOURCE_SERVICE_BUS {
+		require(strings.HasPrefix(cfg.ServiceBusConString, "Endpoint="),
+			"SERVICE_BUS_CON_STRING must be a Service Bus namespace connection string starting with Endpoint= when EVENT_SOURCE is %s", data.SOURCE_SERVICE_BUS)
+		require(len(cfg.NotificationQueues()) > 0, "SERVICE_BUS_QUEUES is required when EVENT_SOURCE is %s", data.SOURCE_SERVICE_BUS)
+		require(cfg.ServiceBusConcurrency > 0, "SERVICE_BUS_CONCURRENCY must be greater than 0")
+	}
+	if cfg.EventHubTopicMappingsFile != "" {
+		_, err := os.Stat(cfg.EventHubTopicMappingsFile)
+		require(err == nil, "EVENT_HUB_TOPIC_MAPPINGS_FILE %q cannot be read", cfg.EventHubTopicMappingsFile)
+	}
+	require(cfg.WebhookWorkers > 0, "WEBHOOK_WORKERS must be greater than 0")
+	require(cfg.WebhookQueueSize > 0, "WEBHOOK_QUEUE_SIZE must be greater than 0")
+	require(cfg.EventHubWorkerPoolSize > 0, "EVENT_HUB_WORKER_POOL_SIZE must be greater than 0")
+	require(cfg.EventHubWorkerQueueSize > 0, "EVENT_HUB_WORKER_QUEUE_SIZE must be greater than 0")
+
+	// Encryption. Keys are only needed when messages of some app are encrypted.
+	if len(cfg.EncryptedAppIds()) > 0 {
+		keys, err := cfg.EncryptionKeySet()
+		require(err == nil, "ENCRYPTION_KEYS is invalid: %v", err)
+		require(err != nil || len(keys) > 0, "ENCRYPTION_KEYS is required when ENCRYPTED_APPS is set")
+		for keyId, key := range keys {
+			require(len(key) == 32, "encryption key %s must be 32 bytes long, got %d", keyId, len(key))
+		}
+		_, ok := keys[cfg.EncryptionKeyId]
+		require(err != nil || ok, "ENCRYPTION_KEY_ID must be one of the keys in ENCRYPTION_KEYS, got %q", cfg.EncryptionKeyId)
+	}
+
+	// Tracing
+	require(cfg.OtelSampleRatio >= 0 && cfg.OtelSampleRatio <= 1, "OTEL_TRACES_SAMPLE_RATIO must be between 0 and 1")
+
+	// Logging
+	require(cfg.LogMethod == data.LOG_METHOD_FILE || cfg.LogMethod == data.LOG_METHOD_AZURE,
+		"LOG_METHOD must be %q or %q, got %q", data.LOG_METHOD_FILE, data.LOG_METHOD_AZURE, cfg.LogMethod)
+	switch cfg.LogLevel {
+	case "", data.DEBUG, data.INFO, data.WARN, data.ERROR:
+	default:
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL must be one of debug, info, warn or error, got %q", cfg.LogLevel))
+	}
+	require(cfg.LogPiiMode == data.LOG_PII_OFF || cfg.LogPiiMode == data.LOG_PII_HASH || cfg.LogPiiMode == data.LOG_PII_REDACT,
+		"LOG_PII_MODE must be %q, %q or %q, got %q", data.LOG_PII_OFF, data.LOG_PII_HASH, data.LOG_PII_REDACT, cfg.LogPiiMode)
+	require(cfg.LogMethod != data.LOG_METHOD_AZURE || cfg.AppInsightsInstrumentationKey != "",
+		"APP_INSIGHTS_INSTRUMENTATION_KEY is required when LOG_METHOD is azure")
+
+	if production {
+		require(cfg.MongoUserName != "" && cfg.MongoPassword != "", "MONGO_USER_NAME and MONGO_PASSWORD are required in production")
+		require(cfg.mongoSsl == "true", "MONGO_SSL must be enabled in production")
+		if cfg.DbDriver == data.DB_DRIVER_POSTGRES {
+			require(cfg.PostgresUserName != "" && cfg.PostgresPassword != "", "POSTGRES_USER_NAME and POSTGRES_PASSWORD are required in production")
+			require(cfg.PostgresSSLMode != "disable" && cfg.PostgresSSLMode != "allow" && cfg.PostgresSSLMode != "prefer",
+				"POSTGRES_SSL_MODE must be require, verify-ca or verify-full in production, got %q", cfg.PostgresSSLMode)
+		}
+		require(cfg.RedisPassword != "", "REDIS_PASSWORD is required in production")
+		require(cfg.RedisTLSEnabled == "true", "REDIS_TLS_ENABLED must be enabled in production")
+		for _, origin := range strings.Split(cfg.AllowedOrigins, ",") {
+			require(strings.TrimSpace(origin) != "*", "ALLOWED_ORIGINS must list the allowed origins in production instead of *")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	apiKeyService "r2-notify-server/services/apikey"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type ApiKeyController struct {
+	apiKeyService apiKeyService.ApiKeyService
+	validate      *validator.Validate
+}
+
+// NewApiKeyController returns a new instance of ApiKeyController.
+// It requires an apiKeyService and the validator.Validate instance checking request bodies to be injected for its
+// dependencies.
+func NewApiKeyController(service apiKeyService.ApiKeyService, validate *validator.Validate) *ApiKeyController {
+	return &ApiKeyController{apiKeyService: service, validate: validate}
+}
+
+// ListApiKeys returns the API keys issued for the app given by the appId query parameter, including
+// revoked keys. Only the key prefixes are returned.
+func (controller *ApiKeyController) ListApiKeys(ctx *gin.Context) {
+	appId := ctx.Query("appId")
+	if appId == "" {
+		respondWithError(ctx, apperrors.Validation("appId query parameter is required", nil))
+		return
+	}
+	apiKeys, err := controller.apiKeyService.FindAll(appId)
+	if err != nil {
+		controller.handleError(ctx, "ListApiKeys", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, apiKeys)
+}
+
+// CreateApiKey issues an API key for the appId in the request body. The response includes the key,
+// which is stored hashed and cannot be retrieved again.
+func (controller *ApiKeyController) CreateApiKey(ctx *gin.Context) {
+	var payload data.CreateApiKeyRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	if err := controller.validate.Struct(payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	apiKey, err := controller.apiKeyService.Create(payload)
+	if err != nil {
+		controller.handleError(ctx, "CreateApiKey", payload.AppId, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, apiKey)
+}
+
+// RevokeApiKey revokes the API key with the given ID. Requests using the key are rejected from then on.
+func (controller *ApiKeyController) RevokeApiKey(ctx *gin.Context) {
+	if err := controller.apiKeyService.Revoke(ctx.Param("id")); err != nil {
+		controller.handleError(ctx, "RevokeApiKey", "", err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// handleError writes the error response, logging failures other than a missing API key.
+func (controller *ApiKeyController) handleError(ctx *gin.Context, operation string, appId string, err error) {
+	if !apperrors.Is(err, apperrors.KindNotFound) {
+		correlationId, _ := ctx.Get(data.CORRELATION_ID)
+		logger.Log.Error(logger.LogPayload{
+			Component:     "ApiKeyController",
+			Operation:     operation,
+			Message:       "API key request failed",
+			AppId:         appId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+	}
+	respondWithError(ctx, err)
+}
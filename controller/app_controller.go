@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	appService "r2-notify-server/services/app"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AppController struct {
+	appService appService.AppService
+}
+
+// NewAppController returns a new instance of AppController.
+// It requires an appService to be injected for its dependencies.
+func NewAppController(service appService.AppService) *AppController {
+	return &AppController{appService: service}
+}
+
+// ListApps returns every app of the app registry.
+func (controller *AppController) ListApps(ctx *gin.Context) {
+	apps, err := controller.appService.FindAll()
+	if err != nil {
+		controller.handleError(ctx, "ListApps", "", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, apps)
+}
+
+// GetApp returns the app given by the appId path parameter.
+func (controller *AppController) GetApp(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	app, err := controller.appService.FindByAppId(appId)
+	if err != nil {
+		controller.handleError(ctx, "GetApp", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app)
+}
+
+// UpsertApp registers the app given by the appId path parameter, or replaces its metadata, with the display
+// name, icon URL, owner team and optionally the allowed origins in the request body.
+func (controller *AppController) UpsertApp(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	var payload data.UpsertAppRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	app, err := controller.appService.Upsert(appId, payload)
+	if err != nil {
+		controller.handleError(ctx, "UpsertApp", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app)
+}
+
+// DeleteApp removes the app given by the appId path parameter from the registry, together with its origin
+// allow-list.
+func (controller *AppController) DeleteApp(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	if err := controller.appService.Delete(appId); err != nil {
+		controller.handleError(ctx, "DeleteApp", appId, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// handleError writes the error response, logging failures other than invalid requests and unknown apps.
+func (controller *AppController) handleError(ctx *gin.Context, operation string, appId string, err error) {
+	if !apperrors.Is(err, apperrors.KindNotFound) && !apperrors.Is(err, apperrors.KindValidation) {
+		correlationId, _ := ctx.Get(data.CORRELATION_ID)
+		logger.Log.Error(logger.LogPayload{
+			Component:     "AppController",
+			Operation:     operation,
+			Message:       "App registry request failed",
+			AppId:         appId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+	}
+	respondWithError(ctx, err)
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	auditService "r2-notify-server/services/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	auditService auditService.AuditService
+}
+
+// NewAuditController returns a new instance of AuditController.
+// It requires an auditService to be injected for its dependencies.
+func NewAuditController(service auditService.AuditService) *AuditController {
+	return &AuditController{auditService: service}
+}
+
+// ListAuditEntries returns the audit log of the user given by the userId query parameter, newest first.
+// The from and to query parameters are RFC 3339 timestamps bounding the time range, and limit caps
+// the number of entries returned.
+func (controller *AuditController) ListAuditEntries(ctx *gin.Context) {
+
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	var query data.AuditLogQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid audit log query", err))
+		return
+	}
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "AuditController",
+		Operation:     "ListAuditEntries",
+		Message:       "ListAuditEntries called",
+		UserId:        query.UserId,
+		CorrelationId: correlationId.(string),
+	})
+
+	entries, err := controller.auditService.Find(query)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
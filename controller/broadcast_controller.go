@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	broadcastService "r2-notify-server/services/broadcast"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BroadcastController struct {
+	broadcastService broadcastService.BroadcastService
+}
+
+// NewBroadcastController returns a new instance of BroadcastController.
+// It requires a broadcastService to be injected for its dependencies.
+func NewBroadcastController(service broadcastService.BroadcastService) *BroadcastController {
+	return &BroadcastController{broadcastService: service}
+}
+
+// Broadcast sends the system announcement in the request body to every connected client, or only to the
+// clients connected for its optional appId. The response is a report of the broadcast, or 429 if another
+// broadcast was sent within BROADCAST_MIN_INTERVAL_SECONDS.
+func (controller *BroadcastController) Broadcast(ctx *gin.Context) {
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	var request data.BroadcastRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "BroadcastController",
+			Operation:     "Broadcast",
+			Message:       "Invalid request payload",
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "BroadcastController",
+		Operation:     "Broadcast",
+		Message:       "Broadcast called",
+		AppId:         request.AppId,
+		CorrelationId: correlationId.(string),
+	})
+
+	report, err := controller.broadcastService.Broadcast(request, correlationId.(string))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
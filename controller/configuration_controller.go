@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	clientStore "r2-notify-server/services"
+	configurationService "r2-notify-server/services/configuration"
+	"r2-notify-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type ConfigurationController struct {
+	configurationService configurationService.ConfigurationService
+	clients              *clientStore.ClientStore
+	validate             *validator.Validate
+}
+
+// NewConfigurationController returns a new instance of ConfigurationController.
+// It requires a configurationService, the client store pushing configurations and the validator.Validate instance
+// checking request bodies to be injected for its dependencies.
+func NewConfigurationController(service configurationService.ConfigurationService, clients *clientStore.ClientStore, validate *validator.Validate) *ConfigurationController {
+	return &ConfigurationController{configurationService: service, clients: clients, validate: validate}
+}
+
+// GetConfiguration returns the configuration of the user given by the X-User-ID and X-Tenant-ID headers.
+// The response is 404 if the user has no configuration yet.
+func (controller *ConfigurationController) GetConfiguration(ctx *gin.Context) {
+
+	userId := ctx.GetHeader("X-User-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "ConfigurationController",
+		Operation:     "GetConfiguration",
+		Message:       "GetConfiguration called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" {
+		respondWithError(ctx, apperrors.Validation("X-User-ID header is required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	configuration, err := controller.configurationService.FindByAppAndUser(ctx.Request.Context(), tenantId, userId)
+	if err != nil {
+		controller.handleLookupError(ctx, "GetConfiguration", userId, correlationId.(string), err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, configuration.Data)
+}
+
+// UpdateConfiguration creates or updates the configuration of the user given by the X-User-ID and X-Tenant-ID headers.
+// The request body must include enableNotification and may include digestApps, which replaces the
+// apps delivered as digests when present, and listScope, which selects the notifications of the full lists.
+// If the user is connected, the client info is refreshed and the updated configuration is pushed to the
+// user's connections as a listConfigurations event.
+func (controller *ConfigurationController) UpdateConfiguration(ctx *gin.Context) {
+
+	userId := ctx.GetHeader("X-User-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "ConfigurationController",
+		Operation:     "UpdateConfiguration",
+		Message:       "UpdateConfiguration called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" {
+		respondWithError(ctx, apperrors.Validation("X-User-ID header is required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	var payload data.UpdateConfigurationRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "ConfigurationController",
+			Operation:     "UpdateConfiguration",
+			Message:       "Invalid request payload",
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+
+	if err := controller.validate.Struct(payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+
+	m := models.Configuration{
+		TenantId:            tenantId,
+		UserId:              userId,
+		EnableNotifications: *payload.EnableNotification,
+		ListScope:           payload.ListScope,
+	}
+	if payload.DigestApps != nil {
+		m.DigestApps = make([]models.DigestSetting, 0, len(payload.DigestApps))
+		for _, setting := range payload.DigestApps {
+			m.DigestApps = append(m.DigestApps, models.DigestSetting{AppId: setting.AppId, WindowMinutes: setting.WindowMinutes})
+		}
+	}
+
+	_, err := controller.configurationService.GetOrCreate(ctx.Request.Context(), m)
+	if err == nil {
+		err = controller.configurationService.Update(ctx.Request.Context(), m)
+	}
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "ConfigurationController",
+			Operation:     "UpdateConfiguration",
+			Message:       "Failed to save configuration",
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, err)
+		return
+	}
+
+	configuration, err := controller.configurationService.FindByAppAndUser(ctx.Request.Context(), tenantId, userId)
+	if err != nil {
+		controller.handleLookupError(ctx, "UpdateConfiguration", userId, correlationId.(string), err)
+		return
+	}
+
+	controller.pushConfiguration(configuration, correlationId.(string))
+	ctx.JSON(http.StatusOK, configuration.Data)
+}
+
+// DeleteConfiguration deletes the configuration of the user given by the X-User-ID and X-Tenant-ID headers.
+// The response is 404 if the user has no configuration. A default configuration is created
+// again the next time the user connects.
+func (controller *ConfigurationController) DeleteConfiguration(ctx *gin.Context) {
+
+	userId := ctx.GetHeader("X-User-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "ConfigurationController",
+		Operation:     "DeleteConfiguration",
+		Message:       "DeleteConfiguration called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" {
+		respondWithError(ctx, apperrors.Validation("X-User-ID header is required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	if _, err := controller.configurationService.FindByAppAndUser(ctx.Request.Context(), tenantId, userId); err != nil {
+		controller.handleLookupError(ctx, "DeleteConfiguration", userId, correlationId.(string), err)
+		return
+	}
+
+	if err := controller.configurationService.Delete(ctx.Request.Context(), tenantId, userId); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "ConfigurationController",
+			Operation:     "DeleteConfiguration",
+			Message:       "Failed to delete configuration",
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// handleLookupError writes the error response for a failed configuration lookup, logging failures other than a missing configuration.
+func (controller *ConfigurationController) handleLookupError(ctx *gin.Context, operation string, userId string, correlationId string, err error) {
+	if !apperrors.Is(err, apperrors.KindNotFound) {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "ConfigurationController",
+			Operation:     operation,
+			Message:       "Failed to fetch configuration",
+			UserId:        userId,
+			CorrelationId: correlationId,
+			Error:         err,
+		})
+	}
+	respondWithError(ctx, err)
+}
+
+// pushConfiguration refreshes the stored client info and sends the configuration to the user
+// if the user is connected to this instance.
+func (controller *ConfigurationController) pushConfiguration(configuration data.Configuration, correlationId string) {
+	userId := configuration.Data.UserID
+	clientKey := clientStore.UserKey(configuration.Data.TenantId, userId)
+	if !controller.clients.IsConnected(clientKey) {
+		return
+	}
+	info, err := clientStore.GetClientInfo(clientKey)
+	if err == nil {
+		info.EnableNotification = configuration.Data.EnableNotification
+		info.DigestWindows = clientStore.DigestWindows(configuration.Data.DigestApps)
+		info.MutedGroups = clientStore.MutedGroups(configuration.Data.MutedGroups)
+		info.ListScope = configuration.Data.ListScope
+		err = clientStore.UpdateClientInfo(info)
+	}
+	if err == nil {
+		err = controller.clients.SendConfigurationToUser(configuration, true)
+	}
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "ConfigurationController",
+			Operation:     "PushConfiguration",
+			Message:       "Failed to push configuration to connected user",
+			UserId:        userId,
+			CorrelationId: correlationId,
+			Error:         err,
+		})
+	}
+}
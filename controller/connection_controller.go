@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	clientStore "r2-notify-server/services"
+	"r2-notify-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ConnectionController struct {
+	clients *clientStore.ClientStore
+}
+
+// NewConnectionController returns a new instance of ConnectionController reading the connections of the given client store.
+func NewConnectionController(clients *clientStore.ClientStore) *ConnectionController {
+	return &ConnectionController{clients: clients}
+}
+
+// GetConnectionHistory returns the frames last sent to each connection of the user given by the userId path
+// parameter and the X-Tenant-ID header, so support can check whether a notification reached the client.
+// Only connections to this instance are listed, and frames are only recorded while CONNECTION_HISTORY_SIZE is set.
+// The response is 404 if the user is not connected.
+func (controller *ConnectionController) GetConnectionHistory(ctx *gin.Context) {
+	userId := ctx.Param("userId")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "ConnectionController",
+		Operation:     "GetConnectionHistory",
+		Message:       "GetConnectionHistory called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	history, err := controller.clients.ConnectionHistory(clientStore.UserKey(tenantId, userId))
+	if err != nil {
+		logger.Log.Debug(logger.LogPayload{
+			Component:     "ConnectionController",
+			Operation:     "GetConnectionHistory",
+			Message:       "No connection history for userId: " + userId,
+			Error:         err,
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+		})
+		respondWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, history)
+}
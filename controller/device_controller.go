@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	clientStore "r2-notify-server/services"
+	"r2-notify-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeviceController struct {
+	clients *clientStore.ClientStore
+}
+
+// NewDeviceController returns a new instance of DeviceController reading the connections of the given client store.
+func NewDeviceController(clients *clientStore.ClientStore) *DeviceController {
+	return &DeviceController{clients: clients}
+}
+
+// ListDevices returns the active connections of the user given by the X-User-ID and X-Tenant-ID headers, oldest first.
+// Each device carries its connection ID, client-supplied deviceId, device type, User-Agent, IP and transport.
+func (controller *DeviceController) ListDevices(ctx *gin.Context) {
+	userId := ctx.GetHeader("X-User-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "DeviceController",
+		Operation:     "ListDevices",
+		Message:       "ListDevices called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" {
+		respondWithError(ctx, apperrors.Validation("X-User-ID header is required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, controller.clients.ListDevices(clientStore.UserKey(tenantId, userId)))
+}
+
+// DisconnectDevice force-disconnects the connection of the user given by the X-User-ID and X-Tenant-ID headers matching
+// the id path parameter, which is either a connection ID or a client-supplied deviceId.
+// The response is 404 if the user has no such device.
+func (controller *DeviceController) DisconnectDevice(ctx *gin.Context) {
+	userId := ctx.GetHeader("X-User-ID")
+	id := ctx.Param("id")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "DeviceController",
+		Operation:     "DisconnectDevice",
+		Message:       "DisconnectDevice called for device: " + id,
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" {
+		respondWithError(ctx, apperrors.Validation("X-User-ID header is required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	if err := controller.clients.DisconnectDevice(clientStore.UserKey(tenantId, userId), id); err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component:     "DeviceController",
+			Operation:     "DisconnectDevice",
+			Message:       "Failed to disconnect device: " + id,
+			Error:         err,
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+		})
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	clientStore "r2-notify-server/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DrainController struct {
+	clients *clientStore.ClientStore
+}
+
+// NewDrainController returns a new instance of DrainController draining the connections of the given client store.
+func NewDrainController(clients *clientStore.ClientStore) *DrainController {
+	return &DrainController{clients: clients}
+}
+
+// Drain puts the instance that serves the request into draining mode before it is replaced: readiness turns
+// false, new connections are refused and the open connections are asked to reconnect over DRAIN_WINDOW_SECONDS.
+// The response reports the connections still open, so it can be called again until none are left.
+func (controller *DrainController) Drain(ctx *gin.Context) {
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Info(logger.LogPayload{
+		Component:     "DrainController",
+		Operation:     "Drain",
+		Message:       "Drain called",
+		CorrelationId: correlationId.(string),
+	})
+
+	ctx.JSON(http.StatusOK, controller.clients.StartDraining())
+}
+
+// GetDrainStatus reports whether the instance that serves the request is draining and the connections still
+// open to it.
+func (controller *DrainController) GetDrainStatus(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, controller.clients.GetDrainStatus())
+}
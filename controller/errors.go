@@ -0,0 +1,17 @@
+package controller
+
+import (
+	"r2-notify-server/apperrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondWithError writes the error response for the given error. The status code is derived from the
+// error kind, and the body carries the client-safe message and the error code, e.g.
+// {"error": "webhook not found", "code": "NOT_FOUND"}.
+func respondWithError(ctx *gin.Context, err error) {
+	ctx.JSON(apperrors.HTTPStatus(err), gin.H{
+		"error": apperrors.MessageOf(err),
+		"code":  apperrors.KindOf(err),
+	})
+}
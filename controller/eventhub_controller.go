@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/event-hub/consumer"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EventHubController struct{}
+
+// NewEventHubController returns a new instance of EventHubController.
+func NewEventHubController() *EventHubController {
+	return &EventHubController{}
+}
+
+// GetLag returns how far the consumer of each Event Hub is behind, per partition, as of the last sample.
+func (controller *EventHubController) GetLag(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, consumer.Lag())
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"r2-notify-server/data"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Number of exported notifications written between two flushes of the response.
+const exportFlushInterval = 100
+
+// Columns of a CSV export. Actions and attachments are written as JSON arrays, and UI hints as a JSON object.
+var exportColumns = []string{"id", "tenantId", "appId", "userId", "groupKey", "message", "status", "readStatus", "createdAt", "updatedAt", "deletedAt", "actions", "senderId", "senderName", "attachments", "uiHints"}
+
+// notificationExport writes exported notifications to the response as they are read from the database.
+// The response headers are only written with the first notification, so an export failing before it can
+// still be answered with an error response.
+type notificationExport struct {
+	ctx     *gin.Context
+	format  string
+	csv     *csv.Writer
+	started bool
+	written int
+}
+
+// newNotificationExport returns an export writing to the response in the given format, csv or json.
+func newNotificationExport(ctx *gin.Context, format string) *notificationExport {
+	return &notificationExport{ctx: ctx, format: format}
+}
+
+// start writes the response headers and the CSV header row or the opening bracket of the JSON array.
+func (e *notificationExport) start() error {
+	e.started = true
+	filename := "notifications-" + time.Now().UTC().Format("20060102T150405Z") + "." + e.format
+	e.ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if e.format == data.EXPORT_FORMAT_CSV {
+		e.ctx.Header("Content-Type", "text/csv; charset=utf-8")
+		e.ctx.Status(http.StatusOK)
+		e.csv = csv.NewWriter(e.ctx.Writer)
+		return e.csv.Write(exportColumns)
+	}
+	e.ctx.Header("Content-Type", "application/json; charset=utf-8")
+	e.ctx.Status(http.StatusOK)
+	_, err := e.ctx.Writer.WriteString("[")
+	return err
+}
+
+// write writes a notification to the response, flushing it every exportFlushInterval notifications.
+func (e *notificationExport) write(notification data.ExportedNotification) error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	var err error
+	if e.format == data.EXPORT_FORMAT_CSV {
+		err = e.writeCSV(notification)
+	} else {
+		err = e.writeJSON(notification)
+	}
+	if err != nil {
+		return err
+	}
+	e.written++
+	if e.written%exportFlushInterval == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+// writeCSV writes a notification as a CSV row.
+func (e *notificationExport) writeCSV(notification data.ExportedNotification) error {
+	deletedAt := ""
+	if notification.DeletedAt != nil {
+		deletedAt = notification.DeletedAt.Format(time.RFC3339)
+	}
+	actions := ""
+	if len(notification.Actions) > 0 {
+		encoded, err := json.Marshal(notification.Actions)
+		if err != nil {
+			return err
+		}
+		actions = string(encoded)
+	}
+	attachments := ""
+	if len(notification.Attachments) > 0 {
+		encoded, err := json.Marshal(notification.Attachments)
+		if err != nil {
+			return err
+		}
+		attachments = string(encoded)
+	}
+	uiHints := ""
+	if notification.UIHints != nil {
+		encoded, err := json.Marshal(notification.UIHints)
+		if err != nil {
+			return err
+		}
+		uiHints = string(encoded)
+	}
+	return e.csv.Write([]string{
+		notification.Id,
+		notification.TenantId,
+		notification.AppId,
+		notification.UserId,
+		notification.GroupKey,
+		notification.Message,
+		notification.Status,
+		strconv.FormatBool(notification.ReadStatus),
+		notification.CreatedAt.Format(time.RFC3339),
+		notification.UpdatedAt.Format(time.RFC3339),
+		deletedAt,
+		actions,
+		notification.SenderId,
+		notification.SenderName,
+		attachments,
+		uiHints,
+	})
+}
+
+// writeJSON writes a notification as an element of the JSON array.
+func (e *notificationExport) writeJSON(notification data.ExportedNotification) error {
+	encoded, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	if e.written > 0 {
+		if _, err := e.ctx.Writer.WriteString(","); err != nil {
+			return err
+		}
+	}
+	_, err = e.ctx.Writer.Write(encoded)
+	return err
+}
+
+// finish completes the export, writing the headers of an empty export if no notification was written.
+func (e *notificationExport) finish() error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	if e.format == data.EXPORT_FORMAT_JSON {
+		if _, err := e.ctx.Writer.WriteString("]"); err != nil {
+			return err
+		}
+	}
+	return e.flush()
+}
+
+// flush sends the buffered part of the export to the client.
+func (e *notificationExport) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	e.ctx.Writer.Flush()
+	return nil
+}
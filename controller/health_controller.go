@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/breaker"
+	"r2-notify-server/data"
+	"r2-notify-server/event-hub/consumer"
+	"r2-notify-server/health"
+	clientStore "r2-notify-server/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct{}
+
+// NewHealthController returns a new instance of HealthController.
+func NewHealthController() *HealthController {
+	return &HealthController{}
+}
+
+// GetHealth reports the state of the dependency circuit breakers, of MongoDB and of the consumed Event Hub topics. It responds with 503 Service Unavailable
+// while the service is degraded, so load balancers can route clients to healthy instances.
+func (controller *HealthController) GetHealth(ctx *gin.Context) {
+	health := data.HealthStatus{
+		Status:         data.HEALTH_OK,
+		Breakers:       make(map[string]string),
+		RedisDegraded:  clientStore.IsDegraded(),
+		Draining:       clientStore.IsDraining(),
+		Mongo:          health.MongoStatus(),
+		EventHubTopics: consumer.Topics(),
+	}
+	for name, state := range breaker.States() {
+		health.Breakers[name] = string(state)
+		if state != breaker.Closed {
+			health.Status = data.HEALTH_DEGRADED
+		}
+	}
+	if health.RedisDegraded || !health.Mongo.Healthy {
+		health.Status = data.HEALTH_DEGRADED
+	}
+
+	status := http.StatusOK
+	if health.Status != data.HEALTH_OK {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, health)
+}
+
+// GetReadiness reports whether the instance accepts new connections. It responds with 503 Service Unavailable
+// once the instance is draining, so load balancers stop routing clients to it while its connections move to
+// other instances, and while the MongoDB pings keep failing.
+func (controller *HealthController) GetReadiness(ctx *gin.Context) {
+	mongo := health.MongoStatus()
+	draining := clientStore.IsDraining()
+	if draining || !mongo.Healthy {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"ready": false, "draining": draining, "mongo": mongo})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"ready": true, "draining": false, "mongo": mongo})
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct{}
+
+// NewMetricsController returns a new instance of MetricsController.
+func NewMetricsController() *MetricsController {
+	return &MetricsController{}
+}
+
+// GetMetrics returns a snapshot of the service counters, gauges and histograms. The optional prefix query
+// parameter limits the snapshot to the metrics whose name starts with it, such as ws.events. for the
+// WebSocket events.
+func (controller *MetricsController) GetMetrics(ctx *gin.Context) {
+	snapshot := metrics.GetSnapshot()
+	if prefix := ctx.Query("prefix"); prefix != "" {
+		snapshot = snapshot.WithPrefix(prefix)
+	}
+	ctx.JSON(http.StatusOK, snapshot)
+}
@@ -1,13 +1,17 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"r2-notify-server/apperrors"
 	"r2-notify-server/data"
 	"r2-notify-server/logger"
 	"r2-notify-server/models"
+	"r2-notify-server/pipeline"
 	clientStore "r2-notify-server/services"
 	notificationService "r2-notify-server/services/notification"
+	"r2-notify-server/utils"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,24 +20,29 @@ import (
 
 type NotificationController struct {
 	notificationService notificationService.NotificationService
+	clients             *clientStore.ClientStore
+	validate            *validator.Validate
 }
 
 // NewNotificationController returns a new instance of NotificationController.
-// It requires a notificationService to be injected for its dependencies.
-func NewNotificationController(service notificationService.NotificationService) *NotificationController {
-	return &NotificationController{notificationService: service}
+// It requires a notificationService, the client store delivering notifications and the validator.Validate
+// instance checking request bodies to be injected for its dependencies.
+func NewNotificationController(service notificationService.NotificationService, clients *clientStore.ClientStore, validate *validator.Validate) *NotificationController {
+	return &NotificationController{notificationService: service, clients: clients, validate: validate}
 }
 
 // CreateNotification creates a new notification based on the payload in the request body.
-// The request must include the X-User-ID and X-App-ID headers.
+// The request must include the X-User-ID and X-App-ID headers, and the X-Api-Key header when API keys
+// are required. The optional X-Tenant-ID header selects the tenant of the notification. Logs are attributed to the API key the request was authenticated with.
 // The request body must include the groupKey, message, and status.
-// The notification will be sent to the user with the given user ID.
-// The response will include the newly created notification.
+// The notification is passed through the delivery pipeline plugins and sent to the user with the given user ID.
+// The response will include the newly created notification, or no content if a plugin dropped it.
 func (controller *NotificationController) CreateNotification(ctx *gin.Context) {
 
 	userId := ctx.GetHeader("X-User-ID")
 	appId := ctx.GetHeader("X-App-ID")
 	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+	apiKeyId := ctx.GetString(data.API_KEY_ID)
 
 	logger.Log.Debug(logger.LogPayload{
 		Component:     "NotificationController",
@@ -41,6 +50,7 @@ func (controller *NotificationController) CreateNotification(ctx *gin.Context) {
 		Message:       "CreateNotification called",
 		UserId:        userId,
 		AppId:         appId,
+		ApiKeyId:      apiKeyId,
 		CorrelationId: correlationId.(string),
 	})
 
@@ -51,9 +61,16 @@ func (controller *NotificationController) CreateNotification(ctx *gin.Context) {
 			Message:       "Missing X-User-ID or X-App-ID header",
 			UserId:        userId,
 			AppId:         appId,
+			ApiKeyId:      apiKeyId,
 			CorrelationId: correlationId.(string),
 		})
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID and X-App-ID headers are required"})
+		respondWithError(ctx, apperrors.Validation("X-User-ID and X-App-ID headers are required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
 		return
 	}
 
@@ -65,32 +82,64 @@ func (controller *NotificationController) CreateNotification(ctx *gin.Context) {
 			Message:       "Invalid request payload",
 			UserId:        userId,
 			AppId:         appId,
+			ApiKeyId:      apiKeyId,
 			CorrelationId: correlationId.(string),
 			Error:         err,
 		})
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
 		return
 	}
 
-	if err := validator.New().Struct(payload); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := controller.validate.Struct(payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
 		return
 	}
 
 	m := models.Notification{
-		UserId:     userId,
-		AppId:      appId,
-		GroupKey:   payload.GroupKey,
-		Message:    payload.Message,
-		Status:     payload.Status,
-		ReadStatus: false,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+		TenantId:    tenantId,
+		UserId:      userId,
+		AppId:       appId,
+		GroupKey:    payload.GroupKey,
+		Message:     payload.Message,
+		Status:      payload.Status,
+		Actions:     payload.Actions,
+		CollapseKey: payload.CollapseKey,
+		Attachments: payload.Attachments,
+		UIHints:     payload.UIHints,
+		ExpiresAt:   payload.ExpiresAt,
+		RemindAt:    payload.RemindAt,
+		ParentId:    payload.ParentId,
+		Source:      &models.NotificationSource{Service: payload.SourceService, Instance: payload.SourceInstance},
+		ReadStatus:  false,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
 	}
 
-	recordId, err := controller.notificationService.Create(m)
-	m.Id = recordId
+	m, limitErr := notificationService.ApplyMessageLimit(m)
+	if limitErr != nil {
+		respondWithError(ctx, limitErr)
+		return
+	}
 
+	m, err := pipeline.Create(pipeline.Context{Context: ctx.Request.Context(), Source: data.SOURCE_REST, CorrelationId: correlationId.(string)}, controller.notificationService, controller.clients, m)
+
+	if errors.Is(err, notificationService.ErrDuplicate) {
+		logger.Log.Info(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "CreateNotification",
+			Message:       "Duplicate notification, returning original notification " + m.Id.Hex(),
+			UserId:        userId,
+			AppId:         appId,
+			ApiKeyId:      apiKeyId,
+			CorrelationId: correlationId.(string),
+		})
+		ctx.JSON(http.StatusOK, m)
+		return
+	}
+	if errors.Is(err, pipeline.ErrDropped) {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component:     "NotificationController",
@@ -98,43 +147,489 @@ func (controller *NotificationController) CreateNotification(ctx *gin.Context) {
 			Message:       "Failed to create notification",
 			UserId:        userId,
 			AppId:         appId,
+			ApiKeyId:      apiKeyId,
 			CorrelationId: correlationId.(string),
 			Error:         err,
 		})
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(ctx, err)
 		return
 	}
 
 	logger.Log.Debug(logger.LogPayload{
 		Component:     "NotificationController",
 		Operation:     "CreateNotification",
-		Message:       fmt.Sprintf("Notification created with payload %v", m),
+		Message:       "Notification " + m.Id.Hex() + " created and " + m.Delivery.Status,
 		UserId:        userId,
 		AppId:         appId,
+		ApiKeyId:      apiKeyId,
 		CorrelationId: correlationId.(string),
 	})
 
+	ctx.JSON(http.StatusCreated, m)
+}
+
+// CreateDirectNotification creates a notification sent by one user to another, such as a chat message.
+// The sender is the user given by the X-User-ID header, and the request must be authenticated with an API key
+// of the app given by the X-App-ID header, whatever REQUIRE_API_KEYS says, since the app vouches for the sender.
+// The optional X-Tenant-ID header selects the tenant of both users.
+// The request body must include the recipientId and message; the notification is created with the info status
+// and the sender's ID, name and avatar, passed through the delivery pipeline plugins and sent to the recipient.
+// The response will include the newly created notification, or no content if a plugin dropped it.
+func (controller *NotificationController) CreateDirectNotification(ctx *gin.Context) {
+
+	senderId := ctx.GetHeader("X-User-ID")
+	appId := ctx.GetHeader("X-App-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+	apiKeyId := ctx.GetString(data.API_KEY_ID)
+
 	logger.Log.Debug(logger.LogPayload{
 		Component:     "NotificationController",
-		Operation:     "CreateNotification",
-		Message:       "Sending notification to user",
-		UserId:        userId,
+		Operation:     "CreateDirectNotification",
+		Message:       "CreateDirectNotification called",
+		UserId:        senderId,
+		AppId:         appId,
+		ApiKeyId:      apiKeyId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if senderId == "" || appId == "" {
+		respondWithError(ctx, apperrors.Validation("X-User-ID and X-App-ID headers are required", nil))
+		return
+	}
+	if apiKeyId == "" {
+		logger.Log.Warn(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "CreateDirectNotification",
+			Message:       "Rejected direct notification without an API key from userId: " + senderId,
+			UserId:        senderId,
+			AppId:         appId,
+			CorrelationId: correlationId.(string),
+		})
+		respondWithError(ctx, apperrors.Unauthorized("direct notifications require an API key"))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	var payload data.DirectNotificationRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "CreateDirectNotification",
+			Message:       "Invalid request payload",
+			UserId:        senderId,
+			AppId:         appId,
+			ApiKeyId:      apiKeyId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+
+	if err := controller.validate.Struct(payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	if payload.RecipientId == senderId {
+		respondWithError(ctx, apperrors.Validation("recipientId must not be the sender", nil))
+		return
+	}
+	groupKey := payload.GroupKey
+	if groupKey == "" {
+		groupKey = data.DIRECT_GROUP_KEY_PREFIX + senderId
+	}
+
+	m := models.Notification{
+		TenantId:        tenantId,
+		UserId:          payload.RecipientId,
+		AppId:           appId,
+		GroupKey:        groupKey,
+		Message:         payload.Message,
+		Status:          data.STATUS_INFO,
+		Actions:         payload.Actions,
+		Attachments:     payload.Attachments,
+		UIHints:         payload.UIHints,
+		ExpiresAt:       payload.ExpiresAt,
+		RemindAt:        payload.RemindAt,
+		ParentId:        payload.ParentId,
+		ReadStatus:      false,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+		SenderId:        senderId,
+		SenderName:      payload.SenderName,
+		SenderAvatarUrl: payload.SenderAvatarUrl,
+	}
+
+	m, limitErr := notificationService.ApplyMessageLimit(m)
+	if limitErr != nil {
+		respondWithError(ctx, limitErr)
+		return
+	}
+
+	m, err := pipeline.Create(pipeline.Context{Context: ctx.Request.Context(), Source: data.SOURCE_DIRECT, CorrelationId: correlationId.(string)}, controller.notificationService, controller.clients, m)
+
+	if errors.Is(err, notificationService.ErrDuplicate) {
+		ctx.JSON(http.StatusOK, m)
+		return
+	}
+	if errors.Is(err, pipeline.ErrDropped) {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "CreateDirectNotification",
+			Message:       "Failed to create direct notification for userId: " + payload.RecipientId,
+			UserId:        senderId,
+			AppId:         appId,
+			ApiKeyId:      apiKeyId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, err)
+		return
+	}
+
+	logger.Log.Info(logger.LogPayload{
+		Component:     "NotificationController",
+		Operation:     "CreateDirectNotification",
+		Message:       "Direct notification " + m.Id.Hex() + " sent from userId: " + senderId + " to userId: " + payload.RecipientId + ", delivery " + m.Delivery.Status,
+		UserId:        senderId,
 		AppId:         appId,
+		ApiKeyId:      apiKeyId,
 		CorrelationId: correlationId.(string),
 	})
 
-	clientStore.SendNotificationToUser(data.EventNotification{
-		Event: data.Event{Event: "newNotification"},
-		Data: data.Notification{
-			Id:        recordId.Hex(),
-			UserID:    m.UserId,
-			AppId:     m.AppId,
-			GroupKey:  m.GroupKey,
-			Message:   m.Message,
-			Status:    m.Status,
-			CreatedAt: m.CreatedAt,
-			UpdatedAt: m.UpdatedAt,
-		},
-	}, false)
 	ctx.JSON(http.StatusCreated, m)
 }
+
+// SearchNotifications searches the notifications of the user given by the X-User-ID and X-Tenant-ID headers.
+// The query parameters q, appId, status, readStatus, from, to, page and pageSize narrow the search;
+// from and to are RFC 3339 timestamps bounding the creation date.
+// The response contains the requested page of notifications and the total number of matches.
+func (controller *NotificationController) SearchNotifications(ctx *gin.Context) {
+
+	userId := ctx.GetHeader("X-User-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "NotificationController",
+		Operation:     "SearchNotifications",
+		Message:       "SearchNotifications called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "SearchNotifications",
+			Message:       "Missing X-User-ID header",
+			CorrelationId: correlationId.(string),
+		})
+		respondWithError(ctx, apperrors.Validation("X-User-ID header is required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	var query data.NotificationSearchQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "SearchNotifications",
+			Message:       "Invalid search query",
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+
+	if err := controller.validate.Struct(query); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+
+	result, err := controller.notificationService.Search(ctx.Request.Context(), tenantId, userId, query)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "SearchNotifications",
+			Message:       "Failed to search notifications",
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result.Data)
+}
+
+// ExportNotifications streams the notification history of the user given by the X-User-ID and X-Tenant-ID headers
+// as a CSV or JSON download, selected with the format query parameter (csv by default). The export includes read
+// and deleted notifications that have not been purged, oldest first; the appId, from and to query parameters narrow it.
+// Notifications are written as they are read from the database. If the export fails after the first notification
+// was sent, the response is cut short and the failure is only logged.
+func (controller *NotificationController) ExportNotifications(ctx *gin.Context) {
+
+	userId := ctx.GetHeader("X-User-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "NotificationController",
+		Operation:     "ExportNotifications",
+		Message:       "ExportNotifications called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "ExportNotifications",
+			Message:       "Missing X-User-ID header",
+			CorrelationId: correlationId.(string),
+		})
+		respondWithError(ctx, apperrors.Validation("X-User-ID header is required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	var query data.NotificationExportQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	if query.Format == "" {
+		query.Format = data.EXPORT_FORMAT_CSV
+	}
+
+	export := newNotificationExport(ctx, query.Format)
+	err := controller.notificationService.Export(ctx.Request.Context(), tenantId, userId, query, export.write)
+	if err == nil {
+		err = export.finish()
+	}
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "ExportNotifications",
+			Message:       fmt.Sprintf("Failed to export notifications after %d notifications", export.written),
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		if !export.started {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.Abort()
+	}
+}
+
+// GetNotificationStats returns the statistics of the notifications of the user given by the X-User-ID and X-Tenant-ID headers:
+// the counts per appId, groupKey and status, the read and unread ratios and the age of the oldest unread notification.
+func (controller *NotificationController) GetNotificationStats(ctx *gin.Context) {
+
+	userId := ctx.GetHeader("X-User-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "NotificationController",
+		Operation:     "GetNotificationStats",
+		Message:       "GetNotificationStats called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "GetNotificationStats",
+			Message:       "Missing X-User-ID header",
+			CorrelationId: correlationId.(string),
+		})
+		respondWithError(ctx, apperrors.Validation("X-User-ID header is required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	stats, err := controller.notificationService.Stats(ctx.Request.Context(), tenantId, userId)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "GetNotificationStats",
+			Message:       "Failed to compute notification statistics",
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, stats)
+}
+
+// SyncReadState merges the read status changes a mobile or offline client made for the user given by the X-User-ID
+// and X-Tenant-ID headers with the stored read state, the last write winning. The request body holds up to 500 changes
+// with the notificationId, readStatus and the RFC 3339 readAt time of each change. The authoritative state after the
+// merge is returned in the response and sent to the user's connections as a readStateSynced event.
+func (controller *NotificationController) SyncReadState(ctx *gin.Context) {
+
+	userId := ctx.GetHeader("X-User-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "NotificationController",
+		Operation:     "SyncReadState",
+		Message:       "SyncReadState called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "SyncReadState",
+			Message:       "Missing X-User-ID header",
+			CorrelationId: correlationId.(string),
+		})
+		respondWithError(ctx, apperrors.Validation("X-User-ID header is required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	var request data.SyncReadStateRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	if err := controller.validate.Struct(request); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+
+	result, err := controller.notificationService.SyncReadState(ctx.Request.Context(), tenantId, userId, request, correlationId.(string))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "SyncReadState",
+			Message:       "Failed to sync read state",
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, err)
+		return
+	}
+
+	synced := data.ReadStateSynced{Event: data.Event{Event: data.READ_STATE_SYNCED}, Data: result}
+	if err := controller.clients.SendReadStateSyncedToUser(synced); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "SyncReadState",
+			Message:       "Failed to send synced read state to user",
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// RestoreDeleted restores the notifications of a user soft-deleted at or after the given time, undoing
+// accidental bulk deletions that have not been purged yet. The request body holds the userId, the
+// optional tenantId and the RFC 3339 since timestamp. The response contains the number of notifications restored.
+func (controller *NotificationController) RestoreDeleted(ctx *gin.Context) {
+
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	var request data.RestoreDeletedRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "NotificationController",
+			Operation:     "RestoreDeleted",
+			Message:       "Invalid request payload",
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "NotificationController",
+		Operation:     "RestoreDeleted",
+		Message:       "RestoreDeleted called",
+		UserId:        request.UserId,
+		CorrelationId: correlationId.(string),
+	})
+
+	restored, err := controller.notificationService.RestoreDeleted(ctx.Request.Context(), request, correlationId.(string))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, data.RestoreDeletedResponse{Restored: restored})
+}
+
+// GetNotificationTrace returns the notification given by the id path parameter of the user given by the userId
+// path parameter and the X-Tenant-ID header, with the outcome of its last delivery and its enqueue, persistence
+// and delivery timings, to troubleshoot reports of late notifications.
+func (controller *NotificationController) GetNotificationTrace(ctx *gin.Context) {
+	userId := ctx.Param("userId")
+	notificationId := ctx.Param("id")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "NotificationController",
+		Operation:     "GetNotificationTrace",
+		Message:       "GetNotificationTrace called for notification " + notificationId,
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	trace, err := controller.notificationService.Trace(ctx.Request.Context(), tenantId, userId, notificationId)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, trace)
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	originService "r2-notify-server/services/origin"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OriginController struct {
+	originService originService.OriginService
+}
+
+// NewOriginController returns a new instance of OriginController.
+// It requires an originService to be injected for its dependencies.
+func NewOriginController(service originService.OriginService) *OriginController {
+	return &OriginController{originService: service}
+}
+
+// ListOrigins returns the origin allow-lists of every app.
+func (controller *OriginController) ListOrigins(ctx *gin.Context) {
+	appOrigins, err := controller.originService.FindAll()
+	if err != nil {
+		controller.handleError(ctx, "ListOrigins", "", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, appOrigins)
+}
+
+// GetOrigins returns the origin allow-list of the app given by the appId path parameter.
+func (controller *OriginController) GetOrigins(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	appOrigins, err := controller.originService.FindByAppId(appId)
+	if err != nil {
+		controller.handleError(ctx, "GetOrigins", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, appOrigins)
+}
+
+// UpdateOrigins replaces the origin allow-list of the app given by the appId path parameter with the
+// origins in the request body. Origins are exact origins or wildcard patterns such as https://*.example.com.
+func (controller *OriginController) UpdateOrigins(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	var payload data.UpdateAppOriginsRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	appOrigins, err := controller.originService.Update(appId, payload)
+	if err != nil {
+		controller.handleError(ctx, "UpdateOrigins", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, appOrigins)
+}
+
+// DeleteOrigins removes the origin allow-list of the app given by the appId path parameter, so its
+// WebSocket connections are only accepted from ALLOWED_ORIGINS.
+func (controller *OriginController) DeleteOrigins(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	if err := controller.originService.Delete(appId); err != nil {
+		controller.handleError(ctx, "DeleteOrigins", appId, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// handleError writes the error response, logging failures other than invalid requests and missing allow-lists.
+func (controller *OriginController) handleError(ctx *gin.Context, operation string, appId string, err error) {
+	if !apperrors.Is(err, apperrors.KindNotFound) && !apperrors.Is(err, apperrors.KindValidation) {
+		correlationId, _ := ctx.Get(data.CORRELATION_ID)
+		logger.Log.Error(logger.LogPayload{
+			Component:     "OriginController",
+			Operation:     operation,
+			Message:       "Origin allow-list request failed",
+			AppId:         appId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+	}
+	respondWithError(ctx, err)
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	policyService "r2-notify-server/services/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PolicyController struct {
+	policyService policyService.PolicyService
+}
+
+// NewPolicyController returns a new instance of PolicyController.
+// It requires a policyService to be injected for its dependencies.
+func NewPolicyController(service policyService.PolicyService) *PolicyController {
+	return &PolicyController{policyService: service}
+}
+
+// ListPolicies returns the delivery policies of the app given by the appId path parameter, in evaluation order.
+func (controller *PolicyController) ListPolicies(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	policies, err := controller.policyService.FindAll(appId)
+	if err != nil {
+		controller.handleError(ctx, "ListPolicies", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, policies)
+}
+
+// GetPolicy returns the delivery policy given by the id path parameter of the app given by the appId path parameter.
+func (controller *PolicyController) GetPolicy(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	policy, err := controller.policyService.FindById(ctx.Param("id"), appId)
+	if err != nil {
+		controller.handleError(ctx, "GetPolicy", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, policy)
+}
+
+// CreatePolicy adds the delivery policy in the request body to the app given by the appId path parameter.
+func (controller *PolicyController) CreatePolicy(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	var payload data.DeliveryPolicyRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	policy, err := controller.policyService.Create(appId, payload)
+	if err != nil {
+		controller.handleError(ctx, "CreatePolicy", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, policy)
+}
+
+// UpdatePolicy replaces the delivery policy given by the id path parameter with the policy in the request body.
+func (controller *PolicyController) UpdatePolicy(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	var payload data.DeliveryPolicyRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	policy, err := controller.policyService.Update(ctx.Param("id"), appId, payload)
+	if err != nil {
+		controller.handleError(ctx, "UpdatePolicy", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, policy)
+}
+
+// DeletePolicy removes the delivery policy given by the id path parameter.
+func (controller *PolicyController) DeletePolicy(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	if err := controller.policyService.Delete(ctx.Param("id"), appId); err != nil {
+		controller.handleError(ctx, "DeletePolicy", appId, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// EvaluatePolicies is a dry run of the delivery policies of the app given by the appId path parameter against
+// the notification fields in the request body. It returns the action that would be applied without
+// persisting or delivering anything.
+func (controller *PolicyController) EvaluatePolicies(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	var payload data.PolicySubject
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	evaluation, err := controller.policyService.Evaluate(appId, payload)
+	if err != nil {
+		controller.handleError(ctx, "EvaluatePolicies", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, evaluation)
+}
+
+// handleError writes the error response, logging failures other than invalid requests and missing policies.
+func (controller *PolicyController) handleError(ctx *gin.Context, operation string, appId string, err error) {
+	if !apperrors.Is(err, apperrors.KindNotFound) && !apperrors.Is(err, apperrors.KindValidation) {
+		correlationId, _ := ctx.Get(data.CORRELATION_ID)
+		logger.Log.Error(logger.LogPayload{
+			Component:     "PolicyController",
+			Operation:     operation,
+			Message:       "Delivery policy request failed",
+			AppId:         appId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+	}
+	respondWithError(ctx, err)
+}
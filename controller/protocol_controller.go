@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/protocol"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProtocolController struct{}
+
+// NewProtocolController returns a new instance of ProtocolController.
+func NewProtocolController() *ProtocolController {
+	return &ProtocolController{}
+}
+
+// GetProtocol returns the protocol version, the supported WebSocket events, wire formats and feature flags.
+func (controller *ProtocolController) GetProtocol(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, protocol.Describe())
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	retentionService "r2-notify-server/services/retention"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RetentionController struct {
+	retentionService retentionService.RetentionService
+}
+
+// NewRetentionController returns a new instance of RetentionController.
+// It requires an retentionService to be injected for its dependencies.
+func NewRetentionController(service retentionService.RetentionService) *RetentionController {
+	return &RetentionController{retentionService: service}
+}
+
+// ListRetention returns the retention policies of every app.
+func (controller *RetentionController) ListRetention(ctx *gin.Context) {
+	appRetention, err := controller.retentionService.FindAll()
+	if err != nil {
+		controller.handleError(ctx, "ListRetention", "", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, appRetention)
+}
+
+// GetRetention returns the retention policy of the app given by the appId path parameter.
+func (controller *RetentionController) GetRetention(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	appRetention, err := controller.retentionService.FindByAppId(appId)
+	if err != nil {
+		controller.handleError(ctx, "GetRetention", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, appRetention)
+}
+
+// UpdateRetention replaces the retention policy of the app given by the appId path parameter with the
+// days to keep read and unread notifications in the request body. Zero keeps them forever.
+func (controller *RetentionController) UpdateRetention(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	var payload data.UpdateAppRetentionRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	appRetention, err := controller.retentionService.Update(appId, payload)
+	if err != nil {
+		controller.handleError(ctx, "UpdateRetention", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, appRetention)
+}
+
+// DeleteRetention removes the retention policy of the app given by the appId path parameter, so its
+// notifications are kept until they are deleted.
+func (controller *RetentionController) DeleteRetention(ctx *gin.Context) {
+	appId := ctx.Param("appId")
+	if err := controller.retentionService.Delete(appId); err != nil {
+		controller.handleError(ctx, "DeleteRetention", appId, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// handleError writes the error response, logging failures other than invalid requests and missing retention policies.
+func (controller *RetentionController) handleError(ctx *gin.Context, operation string, appId string, err error) {
+	if !apperrors.Is(err, apperrors.KindNotFound) && !apperrors.Is(err, apperrors.KindValidation) {
+		correlationId, _ := ctx.Get(data.CORRELATION_ID)
+		logger.Log.Error(logger.LogPayload{
+			Component:     "RetentionController",
+			Operation:     operation,
+			Message:       "Retention policy request failed",
+			AppId:         appId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+	}
+	respondWithError(ctx, err)
+}
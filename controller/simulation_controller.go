@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	simulationService "r2-notify-server/services/simulation"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SimulationController struct {
+	simulationService simulationService.SimulationService
+}
+
+// NewSimulationController returns a new instance of SimulationController.
+// It requires a simulationService to be injected for its dependencies.
+func NewSimulationController(service simulationService.SimulationService) *SimulationController {
+	return &SimulationController{simulationService: service}
+}
+
+// Simulate starts sending the burst of synthetic notifications described by the request body to a user.
+// The response is 202 with the started simulation, whose notifications are sent in the background, or 404
+// if simulations are disabled with SIMULATION_ENABLED.
+func (controller *SimulationController) Simulate(ctx *gin.Context) {
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	var request data.SimulateRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "SimulationController",
+			Operation:     "Simulate",
+			Message:       "Invalid request payload",
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "SimulationController",
+		Operation:     "Simulate",
+		Message:       "Simulate called",
+		UserId:        request.UserId,
+		CorrelationId: correlationId.(string),
+	})
+
+	simulation, err := controller.simulationService.Simulate(request, correlationId.(string))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, simulation)
+}
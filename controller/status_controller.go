@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	clientStore "r2-notify-server/services"
+	notificationService "r2-notify-server/services/notification"
+	"r2-notify-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type StatusController struct {
+	notificationService notificationService.NotificationService
+	clients             *clientStore.ClientStore
+	validate            *validator.Validate
+}
+
+// NewStatusController returns a new instance of StatusController.
+// It requires a notificationService, the client store sending status updates and the validator.Validate instance
+// checking request bodies to be injected for its dependencies.
+func NewStatusController(service notificationService.NotificationService, clients *clientStore.ClientStore, validate *validator.Validate) *StatusController {
+	return &StatusController{notificationService: service, clients: clients, validate: validate}
+}
+
+// UpdateNotificationStatus moves the notification with the given ID to the status in the request body, for
+// producer apps reporting the progress of the work a notification describes.
+// The request must include the X-User-ID and X-App-ID headers, and the X-Api-Key header when API keys
+// are required; only notifications of the given app can be updated. The optional X-Tenant-ID header selects the tenant.
+// The transition from the current status is validated by the notification service, and the updated notification
+// is sent to the user's connections as a notificationStatusUpdated event and returned in the response.
+func (controller *StatusController) UpdateNotificationStatus(ctx *gin.Context) {
+
+	userId := ctx.GetHeader("X-User-ID")
+	appId := ctx.GetHeader("X-App-ID")
+	notificationId := ctx.Param("id")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+	apiKeyId := ctx.GetString(data.API_KEY_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "StatusController",
+		Operation:     "UpdateNotificationStatus",
+		Message:       "UpdateNotificationStatus called for notification " + notificationId,
+		UserId:        userId,
+		AppId:         appId,
+		ApiKeyId:      apiKeyId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" || appId == "" {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "StatusController",
+			Operation:     "UpdateNotificationStatus",
+			Message:       "Missing X-User-ID or X-App-ID header",
+			UserId:        userId,
+			AppId:         appId,
+			ApiKeyId:      apiKeyId,
+			CorrelationId: correlationId.(string),
+		})
+		respondWithError(ctx, apperrors.Validation("X-User-ID and X-App-ID headers are required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	var payload data.UpdateNotificationStatusRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	if err := controller.validate.Struct(payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+
+	notification, err := controller.notificationService.UpdateStatus(ctx.Request.Context(), tenantId, userId, appId, notificationId, payload.Status, correlationId.(string))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "StatusController",
+			Operation:     "UpdateNotificationStatus",
+			Message:       "Failed to update status of notification " + notificationId,
+			UserId:        userId,
+			AppId:         appId,
+			ApiKeyId:      apiKeyId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+		respondWithError(ctx, err)
+		return
+	}
+
+	update := data.EventNotification{
+		Event: data.Event{Event: data.NOTIFICATION_STATUS_UPDATED},
+		Data:  notification,
+	}
+	if err := controller.clients.SendNotificationUpdateToUser(update); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "StatusController",
+			Operation:     "UpdateNotificationStatus",
+			Message:       "Failed to send status update of notification " + notificationId + " to user",
+			UserId:        userId,
+			AppId:         appId,
+			ApiKeyId:      apiKeyId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, notification)
+}
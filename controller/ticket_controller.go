@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	ticketService "r2-notify-server/services/ticket"
+	"r2-notify-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TicketController struct {
+	ticketService ticketService.TicketService
+}
+
+// NewTicketController returns a new instance of TicketController.
+// It requires a ticketService to be injected for its dependencies.
+func NewTicketController(service ticketService.TicketService) *TicketController {
+	return &TicketController{ticketService: service}
+}
+
+// CreateTicket issues a short-lived, single-use ticket for the user given by the X-User-ID and X-Tenant-ID
+// headers. The client passes it in the ticket query parameter of the WebSocket or SSE handshake instead of
+// its userId, so the connection is bound to the user the ticket was issued for.
+func (controller *TicketController) CreateTicket(ctx *gin.Context) {
+	userId := ctx.GetHeader("X-User-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "TicketController",
+		Operation:     "CreateTicket",
+		Message:       "CreateTicket called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	if userId == "" {
+		respondWithError(ctx, apperrors.Validation("X-User-ID header is required", nil))
+		return
+	}
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	ticket, err := controller.ticketService.Issue(tenantId, userId)
+	if err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component:     "TicketController",
+			Operation:     "CreateTicket",
+			Message:       "Failed to issue ticket",
+			Error:         err,
+			UserId:        userId,
+			CorrelationId: correlationId.(string),
+		})
+		respondWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, ticket)
+}
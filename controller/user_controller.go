@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	userService "r2-notify-server/services/user"
+	"r2-notify-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserController struct {
+	userService userService.UserService
+}
+
+// NewUserController returns a new instance of UserController.
+// It requires a userService to be injected for its dependencies.
+func NewUserController(service userService.UserService) *UserController {
+	return &UserController{userService: service}
+}
+
+// EraseUserData permanently erases the notifications, configuration and client state of the user given by the
+// userId path parameter, for right-to-be-forgotten requests. The optional X-Tenant-ID header selects the tenant.
+// The response is a report of the erased data.
+func (controller *UserController) EraseUserData(ctx *gin.Context) {
+	userId := ctx.Param("userId")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "UserController",
+		Operation:     "EraseUserData",
+		Message:       "EraseUserData called",
+		UserId:        userId,
+		CorrelationId: correlationId.(string),
+	})
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	report, err := controller.userService.EraseData(ctx.Request.Context(), tenantId, userId, correlationId.(string))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// GetReachability returns how a notification sent now to the user given by the userId path parameter would be
+// delivered, so producer services can fall back to other channels, like email, for users they cannot reach in
+// real time. The optional X-Tenant-ID header selects the tenant, and the optional appId and groupKey query
+// parameters select the group whose mute and digest settings are checked.
+func (controller *UserController) GetReachability(ctx *gin.Context) {
+	userId := ctx.Param("userId")
+	appId := ctx.Query("appId")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "UserController",
+		Operation:     "GetReachability",
+		Message:       "GetReachability called",
+		UserId:        userId,
+		AppId:         appId,
+		CorrelationId: correlationId.(string),
+	})
+
+	tenantId := ctx.GetHeader("X-Tenant-ID")
+	if !utils.ValidTenantId(tenantId) {
+		respondWithError(ctx, apperrors.Validation("invalid X-Tenant-ID header", nil))
+		return
+	}
+
+	reachability, err := controller.userService.Reachability(ctx.Request.Context(), tenantId, userId, appId, ctx.Query("groupKey"))
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, reachability)
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	webhookService "r2-notify-server/services/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type WebhookController struct {
+	webhookService webhookService.WebhookService
+	validate       *validator.Validate
+}
+
+// NewWebhookController returns a new instance of WebhookController.
+// It requires a webhookService and the validator.Validate instance checking request bodies to be injected for its
+// dependencies.
+func NewWebhookController(service webhookService.WebhookService, validate *validator.Validate) *WebhookController {
+	return &WebhookController{webhookService: service, validate: validate}
+}
+
+// ListWebhooks returns the webhooks registered for the app given by the X-App-ID header.
+func (controller *WebhookController) ListWebhooks(ctx *gin.Context) {
+	appId, ok := controller.requireAppId(ctx, "ListWebhooks")
+	if !ok {
+		return
+	}
+	webhooks, err := controller.webhookService.FindAll(appId)
+	if err != nil {
+		controller.handleError(ctx, "ListWebhooks", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, webhooks)
+}
+
+// GetWebhook returns the webhook with the given ID registered for the app given by the X-App-ID header.
+func (controller *WebhookController) GetWebhook(ctx *gin.Context) {
+	appId, ok := controller.requireAppId(ctx, "GetWebhook")
+	if !ok {
+		return
+	}
+	webhook, err := controller.webhookService.FindById(ctx.Param("id"), appId)
+	if err != nil {
+		controller.handleError(ctx, "GetWebhook", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, webhook)
+}
+
+// CreateWebhook registers a webhook for the app given by the X-App-ID header.
+// The request body must include the url and the events to subscribe to. The response includes
+// the signing secret, which is not returned by any other endpoint.
+func (controller *WebhookController) CreateWebhook(ctx *gin.Context) {
+	appId, ok := controller.requireAppId(ctx, "CreateWebhook")
+	if !ok {
+		return
+	}
+	var payload data.CreateWebhookRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	if err := controller.validate.Struct(payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	webhook, err := controller.webhookService.Create(appId, payload)
+	if err != nil {
+		controller.handleError(ctx, "CreateWebhook", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, webhook)
+}
+
+// UpdateWebhook updates the url, events or enabled flag of a webhook registered for the app
+// given by the X-App-ID header.
+func (controller *WebhookController) UpdateWebhook(ctx *gin.Context) {
+	appId, ok := controller.requireAppId(ctx, "UpdateWebhook")
+	if !ok {
+		return
+	}
+	var payload data.UpdateWebhookRequest
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	if err := controller.validate.Struct(payload); err != nil {
+		respondWithError(ctx, apperrors.Validation("invalid request payload", err))
+		return
+	}
+	webhook, err := controller.webhookService.Update(ctx.Param("id"), appId, payload)
+	if err != nil {
+		controller.handleError(ctx, "UpdateWebhook", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook deletes a webhook registered for the app given by the X-App-ID header.
+func (controller *WebhookController) DeleteWebhook(ctx *gin.Context) {
+	appId, ok := controller.requireAppId(ctx, "DeleteWebhook")
+	if !ok {
+		return
+	}
+	if err := controller.webhookService.Delete(ctx.Param("id"), appId); err != nil {
+		controller.handleError(ctx, "DeleteWebhook", appId, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListDeliveries returns the most recent delivery attempts of a webhook registered for the app
+// given by the X-App-ID header.
+func (controller *WebhookController) ListDeliveries(ctx *gin.Context) {
+	appId, ok := controller.requireAppId(ctx, "ListDeliveries")
+	if !ok {
+		return
+	}
+	deliveries, err := controller.webhookService.FindDeliveries(ctx.Param("id"), appId)
+	if err != nil {
+		controller.handleError(ctx, "ListDeliveries", appId, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+// requireAppId returns the X-App-ID header, writing a 400 response if it is missing.
+func (controller *WebhookController) requireAppId(ctx *gin.Context, operation string) (string, bool) {
+	appId := ctx.GetHeader("X-App-ID")
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebhookController",
+		Operation:     operation,
+		Message:       operation + " called",
+		AppId:         appId,
+		CorrelationId: correlationId.(string),
+	})
+	if appId == "" {
+		respondWithError(ctx, apperrors.Validation("X-App-ID header is required", nil))
+		return "", false
+	}
+	return appId, true
+}
+
+// handleError writes the error response for a failed webhook request, logging failures other than a missing webhook.
+func (controller *WebhookController) handleError(ctx *gin.Context, operation string, appId string, err error) {
+	correlationId, _ := ctx.Get(data.CORRELATION_ID)
+	if !apperrors.Is(err, apperrors.KindNotFound) {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebhookController",
+			Operation:     operation,
+			Message:       "Webhook request failed",
+			AppId:         appId,
+			CorrelationId: correlationId.(string),
+			Error:         err,
+		})
+	}
+	respondWithError(ctx, err)
+}
@@ -1,15 +1,236 @@
 package data
 
+import "time"
+
 // Application constants
 const SERVICE_NAME = "r2-notify-server"
 const PRODUCTION_ENV = "production"
 const DEFAULT_ORIGINS = "http://127.0.0.1:4200,http://localhost:4200"
 
+// Sources through which notifications enter the delivery pipeline
+const (
+	SOURCE_REST          = "rest"
+	SOURCE_EVENT_HUB     = "eventHub"
+	SOURCE_SERVICE_BUS   = "serviceBus"
+	SOURCE_CHANGE_STREAM = "changeStream"
+	SOURCE_DIRECT        = "direct"
+	SOURCE_SIMULATION    = "simulation"
+	SOURCE_UNKNOWN       = "unknown" // reported in statistics for notifications stored without a source
+)
+
+// Outcomes of the delivery of a notification to the user's connections
+const (
+	DELIVERY_DELIVERED = "delivered" // written to at least one connection of the user
+	DELIVERY_QUEUED    = "queued"    // held for the user's next digest
+	DELIVERY_PERSISTED = "persisted" // stored only: the user is offline, disabled notifications or muted the group, or delivery failed
+)
+
+// Prefix of the default group key of direct notifications, followed by the sender's userId
+const DIRECT_GROUP_KEY_PREFIX = "direct:"
+
+// Database drivers selected with DB_DRIVER
+const (
+	DB_DRIVER_MONGO    = "mongo"
+	DB_DRIVER_POSTGRES = "postgres"
+)
+
+// Redis topologies selected with REDIS_MODE
+const (
+	REDIS_MODE_STANDALONE = "standalone"
+	REDIS_MODE_CLUSTER    = "cluster"
+	REDIS_MODE_SENTINEL   = "sentinel"
+)
+
+// WebSocket wire formats
+const (
+	FORMAT_JSON    = "json"
+	FORMAT_MSGPACK = "msgpack"
+)
+
+// Envelope versions of the frames sent to clients, selected with the v query parameter. Version 1 frames
+// are sent to clients connecting without it.
+const (
+	ENVELOPE_V1             = 1
+	ENVELOPE_V2             = 2
+	LATEST_ENVELOPE_VERSION = ENVELOPE_V2
+)
+
 // WebSocket event types
 const (
 	NEW_NOTIFICATION    = "newNotification"
 	LIST_NOTIFICATIONS  = "listNotifications"
 	LIST_CONFIGURATIONS = "listConfigurations"
+	SEARCH_RESULTS      = "searchResults"
+	ERROR_EVENT         = "error"
+	DIGEST_NOTIFICATION = "digestNotification"
+
+	// Sent instead of a new notification of a group with more unread notifications than its app's threshold
+	GROUP_SUMMARY = "groupSummary"
+
+	// Sent after the last part of a notification list delivered in chunks
+	LIST_NOTIFICATIONS_SUMMARY = "listNotificationsSummary"
+
+	// Delta events sent instead of the full list after a change
+	NOTIFICATION_UPDATED      = "notificationUpdated"
+	NOTIFICATION_DELETED      = "notificationDeleted"
+	NOTIFICATIONS_MARKED_READ = "notificationsMarkedRead"
+
+	// Sent with the updated notification after its status changed
+	NOTIFICATION_STATUS_UPDATED = "notificationStatusUpdated"
+
+	// Response to the listDevices event, also sent after a device is disconnected
+	LIST_DEVICES = "listDevices"
+
+	// Sent instead of the full list when a client reconnects with a resume token
+	RESUME_NOTIFICATIONS = "resumeNotifications"
+
+	// Sent with the authoritative read state after a client synced its offline read status changes
+	READ_STATE_SYNCED = "readStateSynced"
+
+	// Response to the getNotificationsSince event
+	NOTIFICATIONS_SINCE = "notificationsSince"
+
+	// Announcement broadcast by an admin to every connected client
+	SYSTEM_ANNOUNCEMENT = "systemAnnouncement"
+
+	// Sent instead of newNotification when a notification replaced the previous one with the same collapse key
+	NOTIFICATION_REPLACED = "notificationReplaced"
+
+	// Sent while the instance is draining, asking the client to reconnect to another instance
+	RECONNECT_REQUESTED = "reconnectRequested"
+
+	// Sent with an unread notification shortly before it expires
+	NOTIFICATION_REMINDER = "notificationReminder"
+
+	// First frame of a connection opened with the welcome handshake parameter, sent instead of listConfigurations
+	CONNECTED = "connected"
+
+	// Response to the resyncFromSequence event
+	SEQUENCE_RESYNC = "sequenceResync"
+)
+
+// Margin subtracted from the time of a resume token, covering clock differences between instances
+// and frames in flight when the token was issued
+const RESUME_TOKEN_MARGIN = 5 * time.Second
+
+// WebSocket close reasons
+const (
+	// Sent when a connection with notifications disabled is closed for being idle
+	CONNECTION_IDLE_TIMEOUT       = "connectionIdleTimeout"
+	CONNECTION_IDLE_TIMEOUT_CLOSE = 4000
+
+	// Sent when a connection is closed by the user from another device
+	DEVICE_DISCONNECTED       = "deviceDisconnected"
+	DEVICE_DISCONNECTED_CLOSE = 4001
+
+	// Sent when a connection is dropped for not reading its messages fast enough
+	SLOW_CONSUMER       = "slowConsumer"
+	SLOW_CONSUMER_CLOSE = 4002
+
+	// Sent when a connection is refused because the configuration of the user cannot be loaded,
+	// for example while the database is unavailable
+	SERVICE_UNAVAILABLE       = "serviceUnavailable"
+	SERVICE_UNAVAILABLE_CLOSE = 4003
+
+	// Sent when a connection is closed because the data of its user was erased
+	USER_DATA_ERASED       = "userDataErased"
+	USER_DATA_ERASED_CLOSE = 4004
+
+	// Sent when a connection is refused because the instance is draining before a deployment
+	SERVER_DRAINING       = "serverDraining"
+	SERVER_DRAINING_CLOSE = 4005
+
+	// Sent when a connection is refused because its handshake ticket is missing, invalid, expired or used
+	INVALID_TICKET       = "invalidTicket"
+	INVALID_TICKET_CLOSE = 4006
+
+	// Sent when a connection is closed because the instance is shutting down (1001, going away)
+	SERVER_SHUTDOWN       = "serverShutdown"
+	SERVER_SHUTDOWN_CLOSE = 1001
+)
+
+// Outcomes of WebSocket handshakes, logged in their access records. Connections refused with a close reason,
+// such as serverDraining, are logged with that reason as outcome.
+const (
+	HANDSHAKE_ACCEPTED       = "accepted"
+	HANDSHAKE_UPGRADE_FAILED = "upgradeFailed"
+	HANDSHAKE_MISSING_USER   = "missingUserId"
+	HANDSHAKE_INVALID_TENANT = "invalidTenant"
+	HANDSHAKE_STORE_FAILED   = "storeFailed"
+)
+
+// Notification statuses. Lifecycle statuses move through the transitions allowed by the notification
+// service; info notifications carry no progress and keep their status.
+const (
+	STATUS_PENDING     = "pending"
+	STATUS_IN_PROGRESS = "in-progress"
+	STATUS_SUCCESS     = "success"
+	STATUS_FAILED      = "failed"
+	STATUS_INFO        = "info"
+)
+
+// Attachment types of a notification. Clients render images inline, links as previews and files as downloads.
+const (
+	ATTACHMENT_IMAGE = "image"
+	ATTACHMENT_LINK  = "link"
+	ATTACHMENT_FILE  = "file"
+)
+
+// Maximum number of attachments of a notification
+const MAX_ATTACHMENTS = 10
+
+// Maximum size in bytes of the UI hints of a notification, encoded as JSON
+const MAX_UI_HINTS_SIZE = 1024
+
+// Policies applied to notification messages longer than MESSAGE_MAX_LENGTH, selected with MESSAGE_OVERFLOW_POLICY
+const (
+	MESSAGE_OVERFLOW_REJECT   = "reject"   // the notification is rejected with a validation error
+	MESSAGE_OVERFLOW_TRUNCATE = "truncate" // the message is cut with an ellipsis and the notification flagged as truncated
+)
+
+// Appended to truncated notification messages
+const MESSAGE_ELLIPSIS = "…"
+
+// Statuses of the frames recorded in a connection's history
+const (
+	FRAME_SENT    = "sent"    // written to the connection
+	FRAME_FAILED  = "failed"  // the write failed and the connection was closed
+	FRAME_DROPPED = "dropped" // not queued because the send queue was full or closed
+)
+
+// States of the Event Hub topics consumed by the consumer supervisor
+const (
+	TOPIC_STARTING = "starting" // connecting to the Event Hub
+	TOPIC_RUNNING  = "running"  // receiving events
+	TOPIC_FAILED   = "failed"   // stopped by an error, restarted after a delay
+	TOPIC_STOPPED  = "stopped"  // stopped on shutdown
+)
+
+// Health statuses
+const (
+	HEALTH_OK       = "ok"
+	HEALTH_DEGRADED = "degraded"
+)
+
+// Connection transports
+const (
+	TRANSPORT_WEBSOCKET = "websocket"
+	TRANSPORT_SSE       = "sse"
+)
+
+// Type of the Event Hub and Service Bus events updating the status of an existing notification
+const EVENT_TYPE_STATUS_UPDATE = "notificationStatusUpdate"
+
+// Delivery channel of the notifications of apps batched into digests, listed in a user's reachability
+// next to the connection transports
+const CHANNEL_DIGEST = "digest"
+
+// Device types derived from the User-Agent header
+const (
+	DEVICE_TYPE_MOBILE  = "mobile"
+	DEVICE_TYPE_TABLET  = "tablet"
+	DEVICE_TYPE_DESKTOP = "desktop"
+	DEVICE_TYPE_UNKNOWN = "unknown"
 )
 
 // Notification event types
@@ -19,6 +240,8 @@ const (
 	MARK_APP_AS_READ          = "markAppAsRead"
 	MARK_GROUP_AS_READ        = "markGroupAsRead"
 	MARK_NOTIFICATION_AS_READ = "markNotificationAsRead"
+	SYNC_READ_STATE           = "syncReadState"
+	GROUP_OPENED              = "groupOpened"
 
 	// Delete events
 	DELETE_NOTIFICATIONS       = "deleteNotifications"
@@ -29,6 +252,128 @@ const (
 	// Other events
 	RELOAD_NOTIFICATIONS    = "reloadNotifications"
 	SET_NOTIFICATION_STATUS = "setNotificationStatus"
+	SEARCH_NOTIFICATIONS    = "searchNotifications"
+	GET_NOTIFICATIONS_SINCE = "getNotificationsSince"
+	FULL_RESYNC             = "fullResync"
+	RESYNC_FROM_SEQUENCE    = "resyncFromSequence"
+
+	// Status events
+	UPDATE_NOTIFICATION_STATUS = "updateNotificationStatus"
+
+	// Group mute events
+	MUTE_GROUP   = "muteGroup"
+	UNMUTE_GROUP = "unmuteGroup"
+
+	// Pin events
+	PIN_NOTIFICATION   = "pinNotification"
+	UNPIN_NOTIFICATION = "unpinNotification"
+
+	// Device events
+	DISCONNECT_DEVICE = "disconnectDevice"
+
+	// Sent when the user clicks an action button of a notification
+	NOTIFICATION_ACTION_TRIGGERED = "notificationActionTriggered"
+
+	// Handshake event, answered with the same event name
+	HELLO = "hello"
+
+	// Application-level heartbeat measuring the round-trip latency, answered with the same event name
+	HEARTBEAT = "heartbeat"
+)
+
+// Admin operations recorded in the audit log
+const (
+	RESTORE_DELETED = "restoreDeleted"
+	ERASE_USER_DATA = "eraseUserData"
+	BROADCAST       = "broadcast"
+	SIMULATE        = "simulate"
+)
+
+// User the broadcasts are recorded under in the audit log, since they target every user
+const BROADCAST_AUDIT_USER = "*"
+
+// App the simulated notifications are sent for when the simulation request does not list any
+const SIMULATION_DEFAULT_APP = "r2-simulator"
+
+// Levels of system announcements
+const (
+	ANNOUNCEMENT_INFO     = "info"
+	ANNOUNCEMENT_WARNING  = "warning"
+	ANNOUNCEMENT_CRITICAL = "critical"
+)
+
+// Search pagination
+const (
+	DEFAULT_SEARCH_PAGE_SIZE = 20
+	MAX_SEARCH_PAGE_SIZE     = 100
+)
+
+// Page sizes of the getNotificationsSince and resyncFromSequence events
+const (
+	DEFAULT_SINCE_LIMIT = 100
+	MAX_SINCE_LIMIT     = 500
+)
+
+// Notification export formats
+const (
+	EXPORT_FORMAT_CSV  = "csv"
+	EXPORT_FORMAT_JSON = "json"
+)
+
+// Audit log pagination
+const (
+	DEFAULT_AUDIT_LIMIT = 100
+	MAX_AUDIT_LIMIT     = 1000
+)
+
+// Scopes of the full notification lists of a user, selected with the listScope configuration. Lists of the
+// all scope hold the read notifications created in the last LIST_HISTORY_DAYS as well.
+const (
+	LIST_SCOPE_UNREAD = "unread"
+	LIST_SCOPE_ALL    = "all"
+)
+
+// Initial notification list filters, given by the include, since and limit handshake query parameters
+const (
+	INCLUDE_READ   = "read"
+	MAX_LIST_LIMIT = 1000
+)
+
+// Webhook lifecycle events
+const (
+	WEBHOOK_NOTIFICATION_CREATED  = "notification.created"
+	WEBHOOK_NOTIFICATION_REPLACED = "notification.replaced"
+	WEBHOOK_NOTIFICATION_READ     = "notification.read"
+	WEBHOOK_NOTIFICATION_DELETED  = "notification.deleted"
+	WEBHOOK_NOTIFICATION_ACTION   = "notification.action"
+	WEBHOOK_NOTIFICATION_ROUTED   = "notification.routed"
+)
+
+// Actions of a delivery policy. Notifications no policy matches are delivered as usual.
+const (
+	POLICY_SUPPRESS   = "suppress"  // neither stored nor delivered
+	POLICY_STORE_ONLY = "storeOnly" // stored but not pushed to the user's connections
+	POLICY_ROUTE      = "route"     // delivered and forwarded to webhooks as notification.routed
+	POLICY_DELIVER    = "deliver"   // outcome of a dry run no policy matched
+)
+
+// Operators of a delivery policy condition
+const (
+	POLICY_OP_EQ       = "eq"
+	POLICY_OP_NEQ      = "neq"
+	POLICY_OP_IN       = "in"
+	POLICY_OP_NOT_IN   = "notIn"
+	POLICY_OP_CONTAINS = "contains"
+	POLICY_OP_PREFIX   = "prefix"
+)
+
+// Scopes of a notification lifecycle change
+const (
+	SCOPE_ALL          = "all"
+	SCOPE_APP          = "app"
+	SCOPE_GROUP        = "group"
+	SCOPE_NOTIFICATION = "notification"
+	SCOPE_THREAD       = "thread"
 )
 
 const (
@@ -36,6 +381,13 @@ const (
 	LOG_METHOD_AZURE = "azure"
 )
 
+// Modes of LOG_PII_MODE, controlling how notification contents and user identifiers appear in logs
+const (
+	LOG_PII_OFF    = "off"    // logged verbatim
+	LOG_PII_HASH   = "hash"   // replaced by a truncated SHA-256 hash, so entries can still be correlated
+	LOG_PII_REDACT = "redact" // replaced by [REDACTED]
+)
+
 // Log Levels
 const (
 	DEBUG = "debug"
@@ -45,3 +397,14 @@ const (
 )
 
 const CORRELATION_ID = "correlationId"
+const API_KEY_ID = "apiKeyId"
+
+// Prefix of the Redis keys of the counters numbering the notifications of each user, followed by the user key
+const SEQUENCE_KEY_PREFIX = "notifications:sequence:"
+
+// API keys are the prefix followed by 64 hex characters. The first API_KEY_PREFIX_LENGTH
+// characters of a key identify it in listings and logs.
+const (
+	API_KEY_PREFIX        = "r2n_"
+	API_KEY_PREFIX_LENGTH = 12
+)
@@ -1,36 +1,112 @@
 package data
 
-import "time"
+import (
+	"encoding/json"
+	"r2-notify-server/models"
+	"time"
+)
 
 type EventHubNotificationPayload struct {
-	AppId    string `validate:"required" json:"appId"`
-	UserId   string `validate:"required" json:"userId"`
-	GroupKey string `validate:"required" json:"groupKey"`
-	Message  string `validate:"required" json:"message"`
-	Status   string `validate:"required" json:"status"`
+	TenantId string                      `validate:"omitempty,max=64,excludes=/" json:"tenantId,omitempty"`
+	AppId    string                      `validate:"required" json:"appId"`
+	UserId   string                      `validate:"required" json:"userId"`
+	GroupKey string                      `validate:"required" json:"groupKey"`
+	Message  string                      `validate:"required" json:"message"`
+	Status   string                      `validate:"required" json:"status"`
+	Actions  []models.NotificationAction `validate:"omitempty,max=5,dive" json:"actions,omitempty"`
+	// CollapseKey replaces the previous notification of the user and app with the same key instead of
+	// adding a new one.
+	CollapseKey string `validate:"max=200" json:"collapseKey,omitempty"`
+	// Attachments are validated when the notification is created.
+	Attachments []models.NotificationAttachment `json:"attachments,omitempty"`
+	// UIHints are validated when the notification is created.
+	UIHints *models.NotificationUIHints `json:"uiHints,omitempty"`
+	// SourceService and SourceInstance identify the publisher, recorded in the source of the notification.
+	SourceService  string `validate:"max=100" json:"sourceService,omitempty"`
+	SourceInstance string `validate:"max=100" json:"sourceInstance,omitempty"`
+	// ExpiresAt and RemindAt are validated when the notification is created.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RemindAt  *time.Time `json:"remindAt,omitempty"`
+	// ParentId makes the notification a follow-up to an earlier notification of the user.
+	ParentId string `json:"parentId,omitempty"`
 }
 
 type Notification struct {
-	Id         string    `json:"id"`
-	AppId      string    `json:"appId"`
-	UserID     string    `json:"userId"`
-	GroupKey   string    `json:"groupKey"`
-	Message    string    `json:"message"`
-	ReadStatus bool      `json:"readStatus"`
-	Status     string    `json:"status"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
+	Id         string                      `json:"id"`
+	TenantId   string                      `json:"tenantId,omitempty"`
+	AppId      string                      `json:"appId"`
+	UserID     string                      `json:"userId"`
+	GroupKey   string                      `json:"groupKey"`
+	Message    string                      `json:"message"`
+	ReadStatus bool                        `json:"readStatus"`
+	Status     string                      `json:"status"`
+	CreatedAt  time.Time                   `json:"createdAt"`
+	UpdatedAt  time.Time                   `json:"updatedAt"`
+	Actions    []models.NotificationAction `json:"actions,omitempty"`
+	Muted      bool                        `json:"muted,omitempty"`
+	ReadAt     *time.Time                  `json:"readAt,omitempty"`
+	// SenderId is set on direct notifications sent by another user, together with the sender's display metadata.
+	SenderId        string                          `json:"senderId,omitempty"`
+	SenderName      string                          `json:"senderName,omitempty"`
+	SenderAvatarUrl string                          `json:"senderAvatarUrl,omitempty"`
+	CollapseKey     string                          `json:"collapseKey,omitempty"`
+	Attachments     []models.NotificationAttachment `json:"attachments,omitempty"`
+	Pinned          bool                            `json:"pinned,omitempty"`
+	UIHints         *models.NotificationUIHints     `json:"uiHints,omitempty"`
+	ExpiresAt       *time.Time                      `json:"expiresAt,omitempty"`
+	RemindAt        *time.Time                      `json:"remindAt,omitempty"`
+	Truncated       bool                            `json:"truncated,omitempty"`
+	// ParentId is set on follow-ups to the ID of the root notification of their thread. ReplyCount and
+	// UnreadReplyCount are set on the roots of the notification lists.
+	ParentId         string `json:"parentId,omitempty"`
+	ReplyCount       int64  `json:"replyCount,omitempty"`
+	UnreadReplyCount int64  `json:"unreadReplyCount,omitempty"`
+	// Sequence is the per-user sequence number of the notification, see resyncFromSequence.
+	Sequence int64 `json:"sequence,omitempty"`
+	// App is the display metadata of the app from the app registry, set on the frames sent to clients.
+	App *AppInfo `json:"app,omitempty"`
+}
+
+// NotificationTrace is a notification as seen by admins troubleshooting its delivery, with the outcome of
+// its last delivery and the timings of its way to the user.
+type NotificationTrace struct {
+	Notification Notification                 `json:"notification"`
+	Source       *models.NotificationSource   `json:"source,omitempty"`
+	Delivery     *models.NotificationDelivery `json:"delivery,omitempty"`
+	Timings      *models.NotificationTimings  `json:"timings,omitempty"`
 }
 
+// NotificationStatusUpdate is an Event Hub or Service Bus event moving an existing notification to another
+// status. It is told apart from new notifications by its type, which is notificationStatusUpdate.
 type NotificationStatusUpdate struct {
-	Id     string `json:"id"`
-	AppId  string `json:"appId"`
-	UserId string `json:"userId"`
-	Status string `json:"status"`
+	Type     string `json:"type"`
+	TenantId string `json:"tenantId,omitempty"`
+	Id       string `json:"id"`
+	AppId    string `json:"appId"`
+	UserId   string `json:"userId"`
+	Status   string `json:"status"`
+}
+
+// EventBatch is a frame carrying several client events, which are dispatched in order. The notification
+// changes they make are sent to the client as a single list refresh once the whole batch is handled.
+type EventBatch struct {
+	Events []json.RawMessage `json:"events"`
 }
 
 type Event struct {
 	Event string `json:"event"`
+	// ResumeToken is set on frames carrying notifications. Clients pass the last token they received as
+	// the resumeToken query parameter when reconnecting to only receive the changes they missed.
+	ResumeToken string `json:"resumeToken,omitempty"`
+}
+
+// Envelope wraps every frame sent to clients that connected with envelope version 2 or later. V is the
+// envelope version, so clients can tell which payload shapes to expect.
+type Envelope struct {
+	V           int         `json:"v"`
+	Event       string      `json:"event"`
+	ResumeToken string      `json:"resumeToken,omitempty"`
+	Data        interface{} `json:"data"`
 }
 
 type EventNotification struct {
@@ -38,15 +114,251 @@ type EventNotification struct {
 	Data Notification `json:"data"`
 }
 
+type AppEvent struct {
+	Event
+	Data AppTarget `json:"data"`
+}
+
+type AppTarget struct {
+	AppId string `validate:"required" json:"appId"`
+}
+
+type GroupEvent struct {
+	Event
+	Data GroupTarget `json:"data"`
+}
+
+type GroupTarget struct {
+	AppId    string `validate:"required" json:"appId"`
+	GroupKey string `validate:"required" json:"groupKey"`
+}
+
+// GroupOpenedEvent is sent by a client when the user opens a group, to mark the notifications the user saw as read.
+type GroupOpenedEvent struct {
+	Event
+	Data GroupOpenedTarget `json:"data"`
+}
+
+// GroupOpenedTarget is the group opened by the user and the time it was opened. Only the notifications of the group
+// created at or before OpenedAt are marked as read, so notifications arriving while the group is open stay unread.
+type GroupOpenedTarget struct {
+	AppId    string    `validate:"required" json:"appId"`
+	GroupKey string    `validate:"required" json:"groupKey"`
+	OpenedAt time.Time `validate:"required" json:"openedAt"`
+}
+
+type NotificationEvent struct {
+	Event
+	Data NotificationTarget `json:"data"`
+}
+
+type NotificationTarget struct {
+	Id string `validate:"required" json:"id"`
+}
+
+// NotificationReadEvent is sent by a client to mark a notification as read. With Thread set, the unread
+// follow-ups of a thread root are marked as read too.
+type NotificationReadEvent struct {
+	Event
+	Data NotificationReadTarget `json:"data"`
+}
+
+type NotificationReadTarget struct {
+	Id     string `validate:"required" json:"id"`
+	Thread bool   `json:"thread,omitempty"`
+}
+
+// NotificationStatusEvent is sent by a client to move a notification to another status.
+type NotificationStatusEvent struct {
+	Event
+	Data NotificationStatusTarget `json:"data"`
+}
+
+type NotificationStatusTarget struct {
+	Id     string `validate:"required" json:"id"`
+	Status string `validate:"required" json:"status"`
+}
+
+// NotificationActionEvent is sent by a client when the user clicks an action button of a notification.
+type NotificationActionEvent struct {
+	Event
+	Data NotificationActionTarget `json:"data"`
+}
+
+type NotificationActionTarget struct {
+	Id       string `validate:"required" json:"id"`
+	ActionId string `validate:"required" json:"actionId"`
+}
+
+// NotificationActionTriggered tells the source app which action of a notification the user triggered.
+// It is delivered to the notification.action webhooks and the action Event Hub.
+type NotificationActionTriggered struct {
+	NotificationId string    `json:"notificationId"`
+	AppId          string    `json:"appId"`
+	UserId         string    `json:"userId"`
+	GroupKey       string    `json:"groupKey"`
+	ActionId       string    `json:"actionId"`
+	Label          string    `json:"label"`
+	Url            string    `json:"url,omitempty"`
+	TriggeredAt    time.Time `json:"triggeredAt"`
+}
+
+// DeviceEvent targets one of the user's own connections, by connection ID or client-supplied device ID.
+type DeviceEvent struct {
+	Event
+	Data DeviceTarget `json:"data"`
+}
+
+type DeviceTarget struct {
+	Id string `validate:"required" json:"id"`
+}
+
+// DeviceList lists the active connections of a user.
+type DeviceList struct {
+	Event
+	Data []models.DeviceInfo `json:"data"`
+}
+
+// NotificationChange is a delta event listing the IDs of the notifications affected by a change.
+type NotificationChange struct {
+	Event
+	Data NotificationChangeSet `json:"data"`
+}
+
+type NotificationChangeSet struct {
+	TenantId string   `json:"tenantId,omitempty"`
+	UserID   string   `json:"userId"`
+	Ids      []string `json:"ids"`
+}
+
+// NotificationList is the list of notifications of a user. Connections that opted into chunked lists receive
+// it split into parts of LIST_CHUNK_SIZE notifications, numbered from 1 to TotalParts, with Complete set on the
+// last part, followed by a NotificationListSummary. The markers are omitted from lists sent in a single frame.
 type NotificationList struct {
 	Event
-	Data []Notification `json:"data"`
+	Part       int            `json:"part,omitempty"`
+	TotalParts int            `json:"totalParts,omitempty"`
+	Complete   *bool          `json:"complete,omitempty"`
+	Data       []Notification `json:"data"`
+}
+
+// NotificationListSummary closes a notification list delivered in chunks.
+type NotificationListSummary struct {
+	Event
+	Data ListSummary `json:"data"`
+}
+
+// ListSummary counts the notifications and parts of a notification list delivered in chunks, so clients can
+// check they received all of them.
+type ListSummary struct {
+	Total      int `json:"total"`
+	TotalParts int `json:"totalParts"`
+}
+
+// NotificationsResumed is sent instead of the full list when a client reconnects with a resume token.
+// It holds the notifications created or changed since the token was issued, and the IDs of those deleted.
+type NotificationsResumed struct {
+	Event
+	Data NotificationResume `json:"data"`
+}
+
+type NotificationResume struct {
+	TenantId      string         `json:"tenantId,omitempty"`
+	UserID        string         `json:"userId"`
+	Since         time.Time      `json:"since"`
+	Notifications []Notification `json:"notifications"`
+	DeletedIds    []string       `json:"deletedIds"`
+}
+
+// NotificationsSinceQuery asks for the notifications changed after a position of a client's local cache, given
+// by the nextSince and nextAfterId of the previous page. The afterId may be left out on the first request.
+type NotificationsSinceQuery struct {
+	Since   time.Time `json:"since" validate:"required"`
+	AfterId string    `json:"afterId,omitempty"`
+	Limit   int       `json:"limit,omitempty" validate:"gte=0,lte=500"`
+}
+
+type GetNotificationsSinceEvent struct {
+	Event
+	Data NotificationsSinceQuery `json:"data"`
+}
+
+// NotificationsSincePage holds the notifications changed after the requested position, oldest change first,
+// and the IDs of those deleted. Clients pass nextSince and nextAfterId with the next request, at once while
+// hasMore is set, to fetch the following page.
+type NotificationsSincePage struct {
+	Notifications []Notification `json:"notifications"`
+	DeletedIds    []string       `json:"deletedIds"`
+	HasMore       bool           `json:"hasMore"`
+	NextSince     time.Time      `json:"nextSince"`
+	NextAfterId   string         `json:"nextAfterId,omitempty"`
+}
+
+// NotificationsSince answers the getNotificationsSince event.
+type NotificationsSince struct {
+	Event
+	Data NotificationsSincePage `json:"data"`
+}
+
+// SequenceResyncQuery requests the notifications a client missed, those with a sequence number greater than
+// the last one it received.
+type SequenceResyncQuery struct {
+	AfterSequence int64 `json:"afterSequence" validate:"gte=0"`
+	Limit         int   `json:"limit,omitempty" validate:"gte=0,lte=500"`
+}
+
+type ResyncFromSequenceEvent struct {
+	Event
+	Data SequenceResyncQuery `json:"data"`
+}
+
+// SequenceResyncPage holds the notifications after the requested sequence number, in sequence order.
+// lastSequence is the sequence number of the last notification of the page, or the requested one when the
+// page is empty, and clients request the next page after it at once while hasMore is set.
+type SequenceResyncPage struct {
+	Notifications []Notification `json:"notifications"`
+	HasMore       bool           `json:"hasMore"`
+	LastSequence  int64          `json:"lastSequence"`
+}
+
+// SequenceResync answers the resyncFromSequence event.
+type SequenceResync struct {
+	Event
+	Data SequenceResyncPage `json:"data"`
 }
 
 type NotificationConfig struct {
-	Id                 string `json:"id"`
-	UserID             string `json:"userId"`
-	EnableNotification bool   `json:"enableNotification"`
+	Id                 string          `json:"id"`
+	TenantId           string          `json:"tenantId,omitempty"`
+	UserID             string          `json:"userId"`
+	EnableNotification bool            `json:"enableNotification"`
+	DigestApps         []DigestSetting `json:"digestApps"`
+	MutedGroups        []MutedGroup    `json:"mutedGroups"`
+	ListScope          string          `json:"listScope"`
+}
+
+type DigestSetting struct {
+	AppId         string `validate:"required" json:"appId"`
+	WindowMinutes int    `validate:"min=1,max=1440" json:"windowMinutes"`
+}
+
+// MutedGroup is a group of an app whose notifications are not pushed until the given time.
+type MutedGroup struct {
+	AppId    string    `json:"appId"`
+	GroupKey string    `json:"groupKey"`
+	Until    time.Time `json:"until"`
+}
+
+type MuteGroupEvent struct {
+	Event
+	Data MuteGroupTarget `json:"data"`
+}
+
+// MuteGroupTarget mutes the notifications of a group of an app for DurationMinutes, at most 30 days.
+type MuteGroupTarget struct {
+	AppId           string `validate:"required" json:"appId"`
+	GroupKey        string `validate:"required" json:"groupKey"`
+	DurationMinutes int    `validate:"min=1,max=43200" json:"durationMinutes"`
 }
 
 type Configuration struct {
@@ -55,7 +367,737 @@ type Configuration struct {
 }
 
 type CreateNotificationRequest struct {
-	GroupKey string `validate:"required" json:"groupKey"`
-	Message  string `validate:"required" json:"message"`
-	Status   string `validate:"required" json:"status"`
+	GroupKey    string                          `validate:"required" json:"groupKey"`
+	Message     string                          `validate:"required" json:"message"`
+	Status      string                          `validate:"required" json:"status"`
+	Actions     []models.NotificationAction     `validate:"omitempty,max=5,dive" json:"actions,omitempty"`
+	CollapseKey string                          `validate:"max=200" json:"collapseKey,omitempty"`
+	Attachments []models.NotificationAttachment `json:"attachments,omitempty"`
+	UIHints     *models.NotificationUIHints     `json:"uiHints,omitempty"`
+	// SourceService and SourceInstance identify the publisher, recorded in the source of the notification.
+	SourceService  string `validate:"max=100" json:"sourceService,omitempty"`
+	SourceInstance string `validate:"max=100" json:"sourceInstance,omitempty"`
+	// ExpiresAt and RemindAt are validated when the notification is created.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RemindAt  *time.Time `json:"remindAt,omitempty"`
+	// ParentId makes the notification a follow-up to an earlier notification of the user.
+	ParentId string `json:"parentId,omitempty"`
+}
+
+// DirectNotificationRequest is the body of a direct notification sent by the user given by the X-User-ID header
+// to the user RecipientId. GroupKey defaults to a group per sender, so the notifications of a conversation are
+// grouped together. SenderName and SenderAvatarUrl are shown with the notification.
+type DirectNotificationRequest struct {
+	RecipientId     string                          `validate:"required" json:"recipientId"`
+	GroupKey        string                          `json:"groupKey,omitempty"`
+	Message         string                          `validate:"required" json:"message"`
+	SenderName      string                          `validate:"max=100" json:"senderName,omitempty"`
+	SenderAvatarUrl string                          `validate:"omitempty,url" json:"senderAvatarUrl,omitempty"`
+	Actions         []models.NotificationAction     `validate:"omitempty,max=5,dive" json:"actions,omitempty"`
+	Attachments     []models.NotificationAttachment `json:"attachments,omitempty"`
+	UIHints         *models.NotificationUIHints     `json:"uiHints,omitempty"`
+	ExpiresAt       *time.Time                      `json:"expiresAt,omitempty"`
+	RemindAt        *time.Time                      `json:"remindAt,omitempty"`
+	ParentId        string                          `json:"parentId,omitempty"`
+}
+
+// UpdateNotificationStatusRequest is the body of the REST request moving a notification to another status.
+type UpdateNotificationStatusRequest struct {
+	Status string `validate:"required" json:"status"`
+}
+
+type NotificationSearchQuery struct {
+	Query      string     `form:"q" json:"q"`
+	AppId      string     `form:"appId" json:"appId"`
+	Status     string     `form:"status" json:"status"`
+	ReadStatus *bool      `form:"readStatus" json:"readStatus"`
+	Source     string     `form:"source" validate:"omitempty,oneof=rest direct eventHub serviceBus changeStream simulation" json:"source"`
+	From       *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00" json:"from"`
+	To         *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00" json:"to"`
+	Page       int        `form:"page" validate:"gte=0" json:"page"`
+	PageSize   int        `form:"pageSize" validate:"gte=0,lte=100" json:"pageSize"`
+}
+
+// NotificationListQuery selects the notifications of the listNotifications event sent when a client connects,
+// from the include, since and limit query parameters of the handshake. The zero value selects every unread
+// notification, like FindAll.
+type NotificationListQuery struct {
+	IncludeRead bool       // include read notifications
+	Since       *time.Time // only notifications created at or after Since
+	Limit       int        // at most Limit notifications, newest first; 0 means no limit
+}
+
+// NotificationExportQuery selects the notifications of a user exported by GET /notifications/export.
+type NotificationExportQuery struct {
+	Format string     `form:"format" validate:"omitempty,oneof=csv json" json:"format"`
+	AppId  string     `form:"appId" json:"appId"`
+	From   *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00" json:"from"`
+	To     *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00" json:"to"`
+}
+
+// ExportedNotification is a notification as written to an export, including read and deleted notifications.
+type ExportedNotification struct {
+	Id          string                          `json:"id"`
+	TenantId    string                          `json:"tenantId,omitempty"`
+	AppId       string                          `json:"appId"`
+	UserId      string                          `json:"userId"`
+	GroupKey    string                          `json:"groupKey"`
+	Message     string                          `json:"message"`
+	Status      string                          `json:"status"`
+	ReadStatus  bool                            `json:"readStatus"`
+	CreatedAt   time.Time                       `json:"createdAt"`
+	UpdatedAt   time.Time                       `json:"updatedAt"`
+	DeletedAt   *time.Time                      `json:"deletedAt,omitempty"`
+	Actions     []models.NotificationAction     `json:"actions,omitempty"`
+	SenderId    string                          `json:"senderId,omitempty"`
+	SenderName  string                          `json:"senderName,omitempty"`
+	Attachments []models.NotificationAttachment `json:"attachments,omitempty"`
+	UIHints     *models.NotificationUIHints     `json:"uiHints,omitempty"`
+}
+
+type SearchNotificationsEvent struct {
+	Event
+	Data NotificationSearchQuery `json:"data"`
+}
+
+type NotificationSearchPage struct {
+	Items    []Notification `json:"items"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+}
+
+type NotificationSearchResult struct {
+	Event
+	Data NotificationSearchPage `json:"data"`
+}
+
+// NotificationStatsCount holds the number of notifications sharing the set appId, groupKey and status.
+type NotificationStatsCount struct {
+	AppId    string `json:"appId,omitempty"`
+	GroupKey string `json:"groupKey,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Total    int64  `json:"total"`
+	Read     int64  `json:"read"`
+	Unread   int64  `json:"unread"`
+}
+
+// NotificationStats summarises the notifications of a user. The ratios are 0 when the user has no
+// notifications, and OldestUnreadAt and OldestUnreadAgeSeconds are omitted when nothing is unread.
+type NotificationStats struct {
+	UserId                 string                   `json:"userId"`
+	Total                  int64                    `json:"total"`
+	Read                   int64                    `json:"read"`
+	Unread                 int64                    `json:"unread"`
+	ReadRatio              float64                  `json:"readRatio"`
+	UnreadRatio            float64                  `json:"unreadRatio"`
+	OldestUnreadAt         *time.Time               `json:"oldestUnreadAt,omitempty"`
+	OldestUnreadAgeSeconds int64                    `json:"oldestUnreadAgeSeconds,omitempty"`
+	Apps                   []NotificationStatsCount `json:"apps"`
+	Groups                 []NotificationStatsCount `json:"groups"`
+	Statuses               []NotificationStatsCount `json:"statuses"`
+	Sources                []NotificationStatsCount `json:"sources"`
+}
+
+// ErrorDetail describes a failed WebSocket event. Code is one of the apperrors kinds, and Event is the
+// event that failed, so clients can correlate the error with their request.
+type ErrorDetail struct {
+	Code          string `json:"code"`
+	Message       string `json:"message"`
+	Event         string `json:"event"`
+	CorrelationId string `json:"correlationId"`
+}
+
+type ErrorEvent struct {
+	Event
+	Data ErrorDetail `json:"data"`
+}
+
+type UpdateConfigurationRequest struct {
+	EnableNotification *bool           `validate:"required" json:"enableNotification"`
+	DigestApps         []DigestSetting `validate:"omitempty,dive" json:"digestApps"`
+	ListScope          string          `validate:"omitempty,oneof=unread all" json:"listScope,omitempty"`
+}
+
+// RestoreDeletedRequest restores the notifications of a user soft-deleted at or after Since.
+type RestoreDeletedRequest struct {
+	TenantId string    `validate:"omitempty,max=64,excludes=/" json:"tenantId,omitempty"`
+	UserId   string    `validate:"required" json:"userId"`
+	Since    time.Time `validate:"required" json:"since"`
+}
+
+type RestoreDeletedResponse struct {
+	Restored int64 `json:"restored"`
+}
+
+// UserDataErasureReport lists what was erased for a user by DELETE /users/:userId/data.
+// Connections counts the connections closed on the instance that handled the request.
+type UserDataErasureReport struct {
+	UserId         string    `json:"userId"`
+	TenantId       string    `json:"tenantId,omitempty"`
+	Notifications  int64     `json:"notifications"`
+	Configurations int64     `json:"configurations"`
+	RedisKeys      int64     `json:"redisKeys"`
+	Connections    int       `json:"connections"`
+	ErasedAt       time.Time `json:"erasedAt"`
+}
+
+// Reachability tells producer services how a notification sent to a user now would be delivered, returned by
+// GET /users/:userId/reachability. Channels lists where it would be pushed: the transports of the user's
+// connections, or digest when the app is batched; it is empty when the notification would only be stored.
+// Muted and Digest concern the app and group given in the request, if any.
+type Reachability struct {
+	UserId             string       `json:"userId"`
+	TenantId           string       `json:"tenantId,omitempty"`
+	Connected          bool         `json:"connected"`
+	Connections        int          `json:"connections"`
+	EnableNotification bool         `json:"enableNotification"`
+	MutedGroups        []MutedGroup `json:"mutedGroups"`
+	Muted              bool         `json:"muted"`
+	Digest             bool         `json:"digest"`
+	Channels           []string     `json:"channels"`
+}
+
+// AuditLogQuery holds the filters of an audit log query. From and To bound the creation date.
+type AuditLogQuery struct {
+	UserId string     `form:"userId" validate:"required"`
+	From   *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int        `form:"limit" validate:"omitempty,min=1,max=1000"`
+}
+
+type AuditEntry struct {
+	Id             string    `json:"id"`
+	UserId         string    `json:"userId"`
+	Event          string    `json:"event"`
+	AppId          string    `json:"appId,omitempty"`
+	GroupKey       string    `json:"groupKey,omitempty"`
+	NotificationId string    `json:"notificationId,omitempty"`
+	ActionId       string    `json:"actionId,omitempty"`
+	CorrelationId  string    `json:"correlationId,omitempty"`
+	Affected       int64     `json:"affected"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// ProtocolInfo advertises the protocol version, event names, wire formats and feature flags of the service.
+type ProtocolInfo struct {
+	Version          string          `json:"version"`
+	Events           ProtocolEvents  `json:"events"`
+	Formats          []string        `json:"formats"`
+	EnvelopeVersions []int           `json:"envelopeVersions"`
+	Features         map[string]bool `json:"features"`
+}
+
+type ProtocolEvents struct {
+	Client []string `json:"client"`
+	Server []string `json:"server"`
+}
+
+// HelloEvent is sent by a client to announce its SDK, and answered by the server with the protocol info.
+type HelloEvent struct {
+	Event
+	Data HelloData `json:"data"`
+}
+
+type HelloData struct {
+	ProtocolVersion string `json:"protocolVersion"`
+	Sdk             string `json:"sdk"`
+}
+
+type HelloResponse struct {
+	Event
+	Data ProtocolInfo `json:"data"`
+}
+
+type HeartbeatEvent struct {
+	Event
+	Data HeartbeatData `json:"data"`
+}
+
+// HeartbeatData is sent by the client with its send time in Unix milliseconds and, optionally, the
+// round-trip latency it measured for its previous heartbeat.
+type HeartbeatData struct {
+	Timestamp int64  `validate:"required,gt=0" json:"timestamp"`
+	LatencyMs *int64 `validate:"omitempty,gte=0,lte=60000" json:"latencyMs,omitempty"`
+}
+
+type HeartbeatResponse struct {
+	Event
+	Data HeartbeatAck `json:"data"`
+}
+
+// HeartbeatAck echoes the timestamp of a heartbeat with the server time in Unix milliseconds, so the
+// client can compute the round-trip latency on its own clock.
+type HeartbeatAck struct {
+	Timestamp  int64 `json:"timestamp"`
+	ServerTime int64 `json:"serverTime"`
+}
+
+// Connected is the first frame sent to a connection opened with the welcome handshake parameter.
+type Connected struct {
+	Event
+	Data ConnectedData `json:"data"`
+}
+
+// ConnectedData is the starting state of a connection: its ID, the protocol version and feature flags of the
+// server, the unread notification count, last sequence number and configuration of the user, and the server
+// time in Unix milliseconds. The last sequence number is the highest one of the user's stored notifications,
+// and is left out when it cannot be read.
+type ConnectedData struct {
+	ConnectionId    string             `json:"connectionId"`
+	ProtocolVersion string             `json:"protocolVersion"`
+	Features        map[string]bool    `json:"features"`
+	UnreadCount     int64              `json:"unreadCount"`
+	LastSequence    int64              `json:"lastSequence,omitempty"`
+	Configuration   NotificationConfig `json:"configuration"`
+	ServerTime      int64              `json:"serverTime"`
+}
+
+// SyncReadStateEvent is sent by a client to reconcile the read status changes it made while offline.
+type SyncReadStateEvent struct {
+	Event
+	Data SyncReadStateRequest `json:"data"`
+}
+
+// SyncReadStateRequest holds up to 500 read status changes, also accepted by POST /notifications/syncReadState.
+type SyncReadStateRequest struct {
+	Changes []ReadStateChange `validate:"required,min=1,max=500,dive" json:"changes"`
+}
+
+// ReadStateChange is a read status change made by a client at ReadAt, possibly while offline.
+type ReadStateChange struct {
+	NotificationId string    `validate:"required" json:"notificationId"`
+	ReadStatus     bool      `json:"readStatus"`
+	ReadAt         time.Time `validate:"required" json:"readAt"`
+}
+
+type ReadStateSynced struct {
+	Event
+	Data ReadStateSyncResult `json:"data"`
+}
+
+// ReadStateSyncResult is the authoritative read state after merging the changes of a client. Applied lists
+// the notifications whose read state was changed; changes that lost to a later write are not listed.
+// Notifications lists the current state of every notification targeted by the changes, and Missing the
+// notifications that do not exist or were deleted.
+type ReadStateSyncResult struct {
+	TenantId      string         `json:"tenantId,omitempty"`
+	UserID        string         `json:"userId"`
+	Applied       []string       `json:"applied"`
+	Notifications []Notification `json:"notifications"`
+	Missing       []string       `json:"missing"`
+}
+
+// BroadcastRequest is a system announcement sent by an admin to every connected client, or only to the
+// clients that connected for AppId. Level defaults to info.
+type BroadcastRequest struct {
+	Title   string `validate:"max=200" json:"title,omitempty"`
+	Message string `validate:"required,max=2000" json:"message"`
+	Level   string `validate:"omitempty,oneof=info warning critical" json:"level,omitempty"`
+	AppId   string `json:"appId,omitempty"`
+}
+
+// SimulateRequest asks for a burst of Count synthetic notifications for a user, sent IntervalMs apart.
+// The notifications are spread over AppIds in turn, or sent for data.SIMULATION_DEFAULT_APP if empty.
+type SimulateRequest struct {
+	TenantId   string   `validate:"max=64,excludesall=/" json:"tenantId,omitempty"`
+	UserId     string   `validate:"required,max=100" json:"userId"`
+	Count      int      `validate:"required,min=1" json:"count"`
+	IntervalMs int      `validate:"min=0,max=60000" json:"intervalMs"`
+	AppIds     []string `validate:"max=20,dive,required,max=100" json:"appIds,omitempty"`
+}
+
+// Simulation describes a started simulation. The notifications are sent in the background, until the last
+// one or the shutdown of the instance.
+type Simulation struct {
+	Id         string    `json:"id"`
+	TenantId   string    `json:"tenantId,omitempty"`
+	UserId     string    `json:"userId"`
+	Count      int       `json:"count"`
+	IntervalMs int       `json:"intervalMs"`
+	AppIds     []string  `json:"appIds"`
+	StartedAt  time.Time `json:"startedAt"`
+}
+
+type SystemAnnouncement struct {
+	Event
+	Data Announcement `json:"data"`
+}
+
+// Announcement is a system announcement as sent to clients.
+type Announcement struct {
+	Id      string    `json:"id"`
+	Title   string    `json:"title,omitempty"`
+	Message string    `json:"message"`
+	Level   string    `json:"level"`
+	AppId   string    `json:"appId,omitempty"`
+	SentAt  time.Time `json:"sentAt"`
+}
+
+// ReconnectRequested asks a client to close its connection and reconnect, so the load balancer routes it to
+// another instance.
+type ReconnectRequested struct {
+	Event
+	Data ReconnectRequest `json:"data"`
+}
+
+// ReconnectRequest tells why the client should reconnect, and how many seconds it should wait first.
+type ReconnectRequest struct {
+	Reason            string `json:"reason"`
+	RetryAfterSeconds int    `json:"retryAfterSeconds"`
+}
+
+// DrainStatus reports the draining of an instance. Connections and Users count the connections still open to
+// the instance, and Notified the connections that were sent a reconnectRequested event so far.
+type DrainStatus struct {
+	Draining      bool       `json:"draining"`
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	WindowSeconds int        `json:"windowSeconds"`
+	Notified      int        `json:"notified"`
+	Connections   int        `json:"connections"`
+	Users         int        `json:"users"`
+}
+
+// BroadcastReport reports a broadcast. Connections counts the connections reached on the instance that
+// handled the request; the connections to other instances receive the announcement through Redis.
+type BroadcastReport struct {
+	Id          string    `json:"id"`
+	AppId       string    `json:"appId,omitempty"`
+	Connections int       `json:"connections"`
+	SentAt      time.Time `json:"sentAt"`
+}
+
+type DigestNotification struct {
+	Event
+	Data Digest `json:"data"`
+}
+
+// Digest summarises the notifications of an app received during a digest window.
+type Digest struct {
+	UserID      string          `json:"userId"`
+	AppId       string          `json:"appId"`
+	Count       int             `json:"count"`
+	WindowStart time.Time       `json:"windowStart"`
+	WindowEnd   time.Time       `json:"windowEnd"`
+	Summaries   []DigestSummary `json:"summaries"`
+	App         *AppInfo        `json:"app,omitempty"`
+}
+
+// DigestSummary summarises the notifications of a single group within a digest.
+type DigestSummary struct {
+	GroupKey      string `json:"groupKey"`
+	Count         int    `json:"count"`
+	LatestMessage string `json:"latestMessage"`
+	LatestStatus  string `json:"latestStatus"`
+}
+
+// GroupSummaryNotification is sent instead of a new notification when its group has reached the group
+// summary threshold of its app.
+type GroupSummaryNotification struct {
+	Event
+	Data GroupSummary `json:"data"`
+}
+
+// GroupSummary summarises the unread notifications of a group of a user, the latest of them being the
+// notification that triggered the summary. LatestSequence is its sequence number, so clients can keep
+// detecting gaps.
+type GroupSummary struct {
+	TenantId         string    `json:"tenantId,omitempty"`
+	UserID           string    `json:"userId"`
+	AppId            string    `json:"appId"`
+	GroupKey         string    `json:"groupKey"`
+	Count            int64     `json:"count"`
+	LatestId         string    `json:"latestId"`
+	LatestMessage    string    `json:"latestMessage"`
+	LatestStatus     string    `json:"latestStatus"`
+	LatestSequence   int64     `json:"latestSequence,omitempty"`
+	EarliestUnreadAt time.Time `json:"earliestUnreadAt"`
+	App              *AppInfo  `json:"app,omitempty"`
+}
+
+type CreateApiKeyRequest struct {
+	AppId string `validate:"required" json:"appId"`
+	Name  string `json:"name"`
+}
+
+// ApiKey describes an issued API key. Key holds the plain key and is only set in the response
+// of the request that created it.
+type ApiKey struct {
+	Id        string     `json:"id"`
+	AppId     string     `json:"appId"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+type UpdateAppOriginsRequest struct {
+	Origins []string `validate:"required,max=100,dive,required" json:"origins"`
+}
+
+// AppOrigins lists the origins allowed to open WebSocket connections for an app, in addition to ALLOWED_ORIGINS.
+type AppOrigins struct {
+	AppId     string    `json:"appId"`
+	Origins   []string  `json:"origins"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// UpsertAppRequest is the body of the request registering an app or replacing its metadata. AllowedOrigins
+// replaces the origin allow-list of the app when it is given, and is left unchanged otherwise.
+// GroupSummaryThreshold overrides GROUP_SUMMARY_THRESHOLD for the app when it is given, 0 disabling group
+// summaries.
+type UpsertAppRequest struct {
+	DisplayName           string    `validate:"required,max=100" json:"displayName"`
+	IconUrl               string    `validate:"omitempty,http_url,max=2048" json:"iconUrl,omitempty"`
+	OwnerTeam             string    `validate:"max=100" json:"ownerTeam,omitempty"`
+	AllowedOrigins        *[]string `json:"allowedOrigins,omitempty"`
+	GroupSummaryThreshold *int      `validate:"omitempty,gte=0,lte=10000" json:"groupSummaryThreshold,omitempty"`
+}
+
+// App is an app of the app registry with its origin allow-list.
+type App struct {
+	AppId                 string    `json:"appId"`
+	DisplayName           string    `json:"displayName"`
+	IconUrl               string    `json:"iconUrl,omitempty"`
+	OwnerTeam             string    `json:"ownerTeam,omitempty"`
+	AllowedOrigins        []string  `json:"allowedOrigins"`
+	GroupSummaryThreshold *int      `json:"groupSummaryThreshold,omitempty"`
+	CreatedAt             time.Time `json:"createdAt"`
+	UpdatedAt             time.Time `json:"updatedAt"`
+}
+
+// AppInfo is the display metadata of a registered app, sent with its notifications so clients do not need
+// their own app catalog.
+type AppInfo struct {
+	DisplayName string `json:"displayName"`
+	IconUrl     string `json:"iconUrl,omitempty"`
+}
+
+type UpdateAppRetentionRequest struct {
+	ReadDays   *int `validate:"required,gte=0,lte=3650" json:"readDays"`
+	UnreadDays *int `validate:"required,gte=0,lte=3650" json:"unreadDays"`
+}
+
+// AppRetention is the retention policy of an app: the days read and unread notifications are kept before
+// the nightly cleanup deletes them. Zero keeps them forever.
+type AppRetention struct {
+	AppId      string    `json:"appId"`
+	ReadDays   int       `json:"readDays"`
+	UnreadDays int       `json:"unreadDays"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type CreateWebhookRequest struct {
+	Url     string   `validate:"required,url" json:"url"`
+	Events  []string `validate:"required,min=1,dive,oneof=notification.created notification.replaced notification.read notification.deleted notification.action notification.routed" json:"events"`
+	Secret  string   `json:"secret"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// DeliveryPolicyRequest is the body of the requests creating or replacing a delivery policy of an app.
+// Enabled defaults to true. Target is required by the route action.
+type DeliveryPolicyRequest struct {
+	Name       string                   `validate:"required,max=100" json:"name"`
+	Order      int                      `validate:"gte=0" json:"order"`
+	Enabled    *bool                    `json:"enabled,omitempty"`
+	Conditions []models.PolicyCondition `validate:"max=20,dive" json:"conditions"`
+	Action     string                   `validate:"required,oneof=suppress storeOnly route" json:"action"`
+	Target     string                   `validate:"required_if=Action route,max=100" json:"target,omitempty"`
+}
+
+// DeliveryPolicy is a delivery rule of an app, see models.DeliveryPolicy.
+type DeliveryPolicy struct {
+	Id         string                   `json:"id"`
+	AppId      string                   `json:"appId"`
+	Name       string                   `json:"name"`
+	Order      int                      `json:"order"`
+	Enabled    bool                     `json:"enabled"`
+	Conditions []models.PolicyCondition `json:"conditions"`
+	Action     string                   `json:"action"`
+	Target     string                   `json:"target,omitempty"`
+	CreatedAt  time.Time                `json:"createdAt"`
+	UpdatedAt  time.Time                `json:"updatedAt"`
+}
+
+// PolicySubject holds the fields delivery policy conditions are evaluated against: those of the notification,
+// the source it entered the pipeline from and the environment of the server. It is also the body of a dry run.
+type PolicySubject struct {
+	TenantId    string `json:"tenantId,omitempty"`
+	UserId      string `json:"userId,omitempty"`
+	GroupKey    string `json:"groupKey,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Status      string `json:"status,omitempty"`
+	CollapseKey string `json:"collapseKey,omitempty"`
+	SenderId    string `json:"senderId,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Environment string `json:"environment,omitempty"`
+}
+
+// PolicyEvaluation is the result of a dry run: the action applied to the notification, the policy that
+// decided it, if any, and whether each policy of the app matched, in evaluation order.
+type PolicyEvaluation struct {
+	Action  string          `json:"action"`
+	Target  string          `json:"target,omitempty"`
+	Policy  *DeliveryPolicy `json:"policy,omitempty"`
+	Matches []PolicyMatch   `json:"matches"`
+}
+
+// PolicyMatch reports whether a policy matched the notification of a dry run. Disabled policies never apply.
+type PolicyMatch struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Matched bool   `json:"matched"`
+}
+
+// NotificationRoutedEvent is the payload of the notification.routed webhook event, sent for notifications
+// matched by a delivery policy with the route action so the app can deliver them over the target channel.
+type NotificationRoutedEvent struct {
+	PolicyId     string       `json:"policyId"`
+	PolicyName   string       `json:"policyName"`
+	Target       string       `json:"target"`
+	Notification Notification `json:"notification"`
+}
+
+type UpdateWebhookRequest struct {
+	Url     string   `validate:"omitempty,url" json:"url"`
+	Events  []string `validate:"omitempty,min=1,dive,oneof=notification.created notification.replaced notification.read notification.deleted notification.action notification.routed" json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+type Webhook struct {
+	Id        string    `json:"id"`
+	AppId     string    `json:"appId"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type WebhookDelivery struct {
+	DeliveryId string    `json:"deliveryId"`
+	WebhookId  string    `json:"webhookId"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type WebhookPayload struct {
+	DeliveryId string      `json:"deliveryId"`
+	Event      string      `json:"event"`
+	AppId      string      `json:"appId"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Data       interface{} `json:"data"`
+}
+
+type NotificationLifecycleChange struct {
+	UserId         string `json:"userId"`
+	AppId          string `json:"appId,omitempty"`
+	GroupKey       string `json:"groupKey,omitempty"`
+	NotificationId string `json:"notificationId,omitempty"`
+	Scope          string `json:"scope"`
+}
+
+// HealthStatus reports the state of the circuit breaker of every dependency, whether the client store
+// is running without Redis, the outcome of the MongoDB pings and the state of the consumed Event Hub topics.
+// Status is degraded while any breaker is not closed, Redis is unavailable or MongoDB is unhealthy; failed topics do not affect connected clients and are
+// only reported.
+type HealthStatus struct {
+	Status         string                `json:"status"`
+	Breakers       map[string]string     `json:"breakers"`
+	RedisDegraded  bool                  `json:"redisDegraded"`
+	Draining       bool                  `json:"draining"`
+	Mongo          MongoHealth           `json:"mongo"`
+	EventHubTopics []EventHubTopicStatus `json:"eventHubTopics"`
+}
+
+// MongoHealth reports the outcome of the periodic MongoDB pings. Healthy turns false once
+// MONGO_HEALTH_FAILURE_THRESHOLD consecutive pings have failed and true again on the next successful ping.
+type MongoHealth struct {
+	Healthy             bool      `json:"healthy"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LatencyMs           int64     `json:"latencyMs"`
+	LastCheckedAt       time.Time `json:"lastCheckedAt"`
+	LastError           string    `json:"lastError,omitempty"`
+}
+
+// EventHubTopicStatus reports the health of an Event Hub or Service Bus queue consumed by the consumer
+// supervisor, told apart by Source. Lag is the number of events enqueued in the hub's partitions that
+// have not been processed yet, and is not sampled for queues.
+type EventHubTopicStatus struct {
+	Hub         string    `json:"hub"`
+	Source      string    `json:"source"`
+	State       string    `json:"state"`
+	Mapped      bool      `json:"mapped"`
+	Partitions  int       `json:"partitions"`
+	Lag         int64     `json:"lag"`
+	Processed   int64     `json:"processed"`
+	Failed      int64     `json:"failed"`
+	Restarts    int       `json:"restarts"`
+	LastEventAt time.Time `json:"lastEventAt"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// ConnectionHistory lists the frames last sent to a single connection, oldest first.
+type ConnectionHistory struct {
+	ConnectionId string            `json:"connectionId"`
+	DeviceId     string            `json:"deviceId,omitempty"`
+	Transport    string            `json:"transport"`
+	ConnectedAt  time.Time         `json:"connectedAt"`
+	Frames       []ConnectionFrame `json:"frames"`
+}
+
+// ConnectionFrame is a frame recorded in a connection's history. Payload is the decoded frame, or the
+// base64 encoded bytes if the frame could not be decoded.
+type ConnectionFrame struct {
+	SentAt  time.Time   `json:"sentAt"`
+	Status  string      `json:"status"`
+	Event   string      `json:"event,omitempty"`
+	Format  string      `json:"format"`
+	Size    int         `json:"size"`
+	Payload interface{} `json:"payload"`
+}
+
+// EventHubLag reports how far the consumer of an Event Hub is behind, per partition.
+type EventHubLag struct {
+	Hub           string                 `json:"hub"`
+	ConsumerGroup string                 `json:"consumerGroup"`
+	State         string                 `json:"state"`
+	Lag           int64                  `json:"lag"`
+	Partitions    []EventHubPartitionLag `json:"partitions"`
+}
+
+// EventHubPartitionLag compares the last event processed from a partition with the last event enqueued in
+// it. LagSeconds is the difference between their enqueued times, 0 while the partition is caught up.
+type EventHubPartitionLag struct {
+	PartitionId             string    `json:"partitionId"`
+	LastProcessedSequence   int64     `json:"lastProcessedSequence"`
+	LastProcessedEnqueuedAt time.Time `json:"lastProcessedEnqueuedAt"`
+	LastEnqueuedSequence    int64     `json:"lastEnqueuedSequence"`
+	LastEnqueuedAt          time.Time `json:"lastEnqueuedAt"`
+	Lag                     int64     `json:"lag"`
+	LagSeconds              float64   `json:"lagSeconds"`
+	CheckedAt               time.Time `json:"checkedAt"`
+}
+
+// WsTicket is a signed, single-use ticket authenticating a WebSocket or SSE handshake, passed in the ticket
+// query parameter before it expires.
+type WsTicket struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// WsTicketClaims identifies the user a handshake ticket was issued for.
+type WsTicketClaims struct {
+	TenantId  string `json:"tenantId,omitempty"`
+	UserId    string `json:"userId"`
+	Nonce     string `json:"nonce"`
+	ExpiresAt int64  `json:"exp"`
 }
@@ -0,0 +1,106 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/config"
+	"r2-notify-server/migrations"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Indexes created by the Mongo repositories on startup, by collection. Keep in sync with their CreateIndexes.
+var expectedIndexes = map[string][]string{
+	"notifications":     {"message_text", "deletedAt", "userId_updatedAt", "userId_appId_collapseKey", "appId_readStatus_createdAt", "remindAt", "userId_parentId", "userId_sequence", "userId_appId_groupKey_readStatus"},
+	"configurations":    {"tenantId_userId_unique"},
+	"audit_logs":        {"userId_createdAt"},
+	"api_keys":          {"keyHash", "appId_createdAt"},
+	"app_origins":       {"appId"},
+	"delivery_policies": {"appId_order_createdAt"},
+	"app_retention":     {"appId"},
+	"apps":              {"appId"},
+}
+
+// checkMongo connects to MongoDB and verifies the indexes of the repositories exist. Missing indexes are
+// reported as a warning, since the server creates them on startup.
+func checkMongo(ctx context.Context) (string, string) {
+	db, err := config.ConnectMongo(ctx)
+	if err != nil {
+		return STATUS_FAIL, err.Error()
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	collections := make([]string, 0, len(expectedIndexes))
+	for collection := range expectedIndexes {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	var missing []string
+	for _, collection := range collections {
+		cursor, err := db.Collection(collection).Indexes().List(ctx)
+		if err != nil {
+			return STATUS_FAIL, fmt.Sprintf("failed to list indexes of %s: %v", collection, err)
+		}
+		var indexes []bson.M
+		if err := cursor.All(ctx, &indexes); err != nil {
+			return STATUS_FAIL, fmt.Sprintf("failed to list indexes of %s: %v", collection, err)
+		}
+		existing := make(map[string]bool, len(indexes))
+		for _, index := range indexes {
+			if name, ok := index["name"].(string); ok {
+				existing[name] = true
+			}
+		}
+		for _, name := range expectedIndexes[collection] {
+			if !existing[name] {
+				missing = append(missing, collection+"."+name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return STATUS_WARN, fmt.Sprintf("connected to %s, missing indexes (created on startup): %s", db.Name(), strings.Join(missing, ", "))
+	}
+	return STATUS_OK, fmt.Sprintf("connected to %s, all indexes present", db.Name())
+}
+
+// checkPostgres connects to Postgres and verifies the schema migrations have been applied. Pending
+// migrations are reported as a warning, since the server applies them on startup.
+func checkPostgres(ctx context.Context) (string, string) {
+	pool, err := config.ConnectPostgres(ctx)
+	if err != nil {
+		return STATUS_FAIL, err.Error()
+	}
+	defer pool.Close()
+
+	pending, err := migrations.Pending(ctx, pool)
+	if err != nil {
+		return STATUS_FAIL, err.Error()
+	}
+	database := config.LoadConfig().PostgresDBName
+	if len(pending) > 0 {
+		return STATUS_WARN, fmt.Sprintf("connected to %s, pending migrations (applied on startup): %s", database, strings.Join(pending, ", "))
+	}
+	return STATUS_OK, fmt.Sprintf("connected to %s, all migrations applied", database)
+}
+
+// checkRedis connects to Redis with the configured topology and reports its version.
+func checkRedis(ctx context.Context) (string, string) {
+	client, err := config.ConnectRedis(ctx)
+	if err != nil {
+		return STATUS_FAIL, err.Error()
+	}
+	defer client.Close()
+
+	version := "unknown"
+	if info, err := client.Info(ctx, "server").Result(); err == nil {
+		for _, line := range strings.Split(info, "\n") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(line), "redis_version:"); ok {
+				version = value
+			}
+		}
+	}
+	return STATUS_OK, fmt.Sprintf("connected to %s, server version %s", config.LoadConfig().RedisMode, version)
+}
@@ -0,0 +1,105 @@
+// Package doctor checks that the environment of the service is usable without starting the server: the
+// configuration is valid, the database, Redis and the event source can be reached, and the database schema
+// is in place. It backs the cmd/doctor command.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"strings"
+	"time"
+)
+
+// Outcomes of a check.
+const (
+	STATUS_OK   = "ok"
+	STATUS_WARN = "warn"
+	STATUS_FAIL = "fail"
+)
+
+// Check is the outcome of a single diagnostic.
+type Check struct {
+	Name     string
+	Status   string
+	Detail   string
+	Duration time.Duration
+}
+
+// Report lists the outcome of every diagnostic, in the order they ran.
+type Report struct {
+	Checks []Check
+}
+
+// Failed reports whether any check failed. Warnings do not fail the report.
+func (r Report) Failed() bool {
+	for _, check := range r.Checks {
+		if check.Status == STATUS_FAIL {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints the report as one line per check followed by a summary.
+func (r Report) Write(w io.Writer) {
+	counts := make(map[string]int)
+	for _, check := range r.Checks {
+		counts[check.Status]++
+		fmt.Fprintf(w, "[%-4s] %-28s %s (%s)\n", strings.ToUpper(check.Status), check.Name, check.Detail, check.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "\n%d checks: %d ok, %d warnings, %d failed\n", len(r.Checks), counts[STATUS_OK], counts[STATUS_WARN], counts[STATUS_FAIL])
+}
+
+// probe runs a diagnostic and records its outcome under the given name.
+type probe func(ctx context.Context) (status string, detail string)
+
+// Run runs every diagnostic and returns their outcome. Each diagnostic is given at most timeout to complete,
+// and a failed diagnostic does not stop the others, so the report lists every problem at once.
+func Run(ctx context.Context, timeout time.Duration) Report {
+	cfg := config.LoadConfig()
+	var report Report
+	run := func(name string, check probe) {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		startedAt := time.Now()
+		status, detail := check(checkCtx)
+		report.Checks = append(report.Checks, Check{Name: name, Status: status, Detail: detail, Duration: time.Since(startedAt)})
+	}
+
+	run("configuration", checkConfiguration)
+	if cfg.DbDriver == data.DB_DRIVER_POSTGRES {
+		run("postgres", checkPostgres)
+	} else {
+		run("mongodb", checkMongo)
+	}
+	run("redis", checkRedis)
+	if cfg.EventSource == data.SOURCE_SERVICE_BUS {
+		for _, queue := range cfg.NotificationQueues() {
+			run("service bus queue "+queue, func(ctx context.Context) (string, string) {
+				return checkServiceBusQueue(ctx, queue)
+			})
+		}
+	} else {
+		for _, hub := range cfg.NotificationHubs() {
+			run("event hub "+hub, func(ctx context.Context) (string, string) {
+				return checkEventHub(ctx, hub)
+			})
+		}
+	}
+	return report
+}
+
+// checkConfiguration validates the configuration as the server does on startup.
+func checkConfiguration(ctx context.Context) (string, string) {
+	if err := config.Validate(); err != nil {
+		if validationErr, ok := err.(*config.ValidationError); ok {
+			return STATUS_FAIL, strings.Join(validationErr.Problems, "; ")
+		}
+		return STATUS_FAIL, err.Error()
+	}
+	cfg := config.LoadConfig()
+	return STATUS_OK, fmt.Sprintf("environment %q, database %s, event source %s", cfg.Environment, cfg.DbDriver, cfg.EventSource)
+}
@@ -0,0 +1,52 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/config"
+
+	"github.com/Azure/azure-amqp-common-go/v4/cbs"
+	"github.com/Azure/azure-amqp-common-go/v4/conn"
+	"github.com/Azure/azure-amqp-common-go/v4/sas"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"github.com/Azure/go-amqp"
+)
+
+// checkEventHub connects to the Event Hub and reads its partitions, as the consumer does before receiving.
+func checkEventHub(ctx context.Context, name string) (string, string) {
+	cfg := config.LoadConfig()
+	hub, err := eventhub.NewHubFromConnectionString(fmt.Sprintf("%s;EntityPath=%s", cfg.EventHubNameSpaceConString, name))
+	if err != nil {
+		return STATUS_FAIL, "failed to connect: " + err.Error()
+	}
+	defer hub.Close(context.Background())
+
+	runtimeInfo, err := hub.GetRuntimeInformation(ctx)
+	if err != nil {
+		return STATUS_FAIL, "failed to read runtime information: " + err.Error()
+	}
+	return STATUS_OK, fmt.Sprintf("connected, %d partitions", runtimeInfo.PartitionCount)
+}
+
+// checkServiceBusQueue connects to the Service Bus namespace and authorizes access to the queue, as the
+// consumer does before receiving.
+func checkServiceBusQueue(ctx context.Context, queue string) (string, string) {
+	parsed, err := conn.ParsedConnectionFromStr(config.LoadConfig().ServiceBusConString)
+	if err != nil {
+		return STATUS_FAIL, "invalid Service Bus connection string: " + err.Error()
+	}
+	provider, err := sas.NewTokenProvider(sas.TokenProviderWithKey(parsed.KeyName, parsed.Key))
+	if err != nil {
+		return STATUS_FAIL, "failed to create token provider: " + err.Error()
+	}
+
+	client, err := amqp.Dial(ctx, parsed.Host, &amqp.ConnOptions{SASLType: amqp.SASLTypeAnonymous()})
+	if err != nil {
+		return STATUS_FAIL, "failed to connect to namespace " + parsed.Namespace + ": " + err.Error()
+	}
+	defer client.Close()
+	if err := cbs.NegotiateClaim(ctx, parsed.Host+"/"+queue, client, provider); err != nil {
+		return STATUS_FAIL, "failed to authorize: " + err.Error()
+	}
+	return STATUS_OK, "connected to namespace " + parsed.Namespace
+}
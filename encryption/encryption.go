@@ -0,0 +1,115 @@
+package encryption
+
+// Package encryption contains the field-level encryption of notification content at rest. Values are
+// encrypted with AES-256-GCM under a key derived per user from a master key, so a value cannot be
+// decrypted for another user, and master keys are looked up by ID through a KeyProvider so they can be rotated.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"r2-notify-server/apperrors"
+	"strings"
+)
+
+// Prefix of encrypted values. Values without it are stored in plain text and returned as is, so
+// encryption can be turned on and off without migrating existing data.
+const prefix = "enc:v1:"
+
+// Size in bytes of master keys and of the derived per-user keys.
+const KeySize = 32
+
+// KeyProvider supplies the master keys. The keys can be read from the environment with EnvKeyProvider,
+// or from a secret store such as Azure Key Vault by another implementation.
+// Implementations must be safe for concurrent use by multiple goroutines.
+type KeyProvider interface {
+	// ActiveKeyId returns the ID of the master key new values are encrypted with.
+	ActiveKeyId() string
+	// Key returns the master key with the given ID, which must be KeySize bytes long.
+	Key(keyId string) ([]byte, error)
+}
+
+// Cipher encrypts and decrypts values with the keys of a KeyProvider.
+type Cipher struct {
+	keys KeyProvider
+}
+
+// NewCipher returns a Cipher using the master keys of the given provider.
+func NewCipher(keys KeyProvider) *Cipher {
+	return &Cipher{keys: keys}
+}
+
+// IsEncrypted reports whether the value was encrypted by a Cipher.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt encrypts the value for the given scope, such as the tenant and user the value belongs to, with
+// the active master key. The result records the ID of the master key, so it can still be decrypted after
+// the active key is rotated, and can only be decrypted for the same scope.
+func (c *Cipher) Encrypt(scope string, value string) (string, error) {
+	keyId := c.keys.ActiveKeyId()
+	aead, err := c.aead(keyId, scope)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", apperrors.Internal("failed to generate nonce", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(scope))
+	return prefix + keyId + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value encrypted for the given scope. Values that are not encrypted are returned as is.
+// It returns an error if the master key of the value is unknown or the value was tampered with or
+// encrypted for another scope.
+func (c *Cipher) Decrypt(scope string, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	keyId, encoded, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", apperrors.Internal("malformed encrypted value", nil)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", apperrors.Internal("malformed encrypted value", err)
+	}
+	aead, err := c.aead(keyId, scope)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", apperrors.Internal("malformed encrypted value", nil)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(scope))
+	if err != nil {
+		return "", apperrors.Internal("failed to decrypt value", err)
+	}
+	return string(plain), nil
+}
+
+// aead returns the AES-GCM cipher of the key derived for the scope from the given master key.
+func (c *Cipher) aead(keyId string, scope string) (cipher.AEAD, error) {
+	master, err := c.keys.Key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdf.Key(sha256.New, master, nil, "r2-notify:"+scope, KeySize)
+	if err != nil {
+		return nil, apperrors.Internal("failed to derive encryption key", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, apperrors.Internal("invalid encryption key", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, apperrors.Internal("invalid encryption key", err)
+	}
+	return aead, nil
+}
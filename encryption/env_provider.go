@@ -0,0 +1,39 @@
+package encryption
+
+import (
+	"fmt"
+	"r2-notify-server/apperrors"
+)
+
+// EnvKeyProvider serves master keys configured in the environment, with ENCRYPTION_KEYS and ENCRYPTION_KEY_ID.
+type EnvKeyProvider struct {
+	activeKeyId string
+	keys        map[string][]byte
+}
+
+// NewEnvKeyProvider returns a KeyProvider serving the given master keys, keyed by ID, which encrypts new
+// values with the key activeKeyId. It returns an error if the active key is missing or a key is not
+// KeySize bytes long.
+func NewEnvKeyProvider(keys map[string][]byte, activeKeyId string) (KeyProvider, error) {
+	if _, ok := keys[activeKeyId]; !ok {
+		return nil, apperrors.Validation("unknown active encryption key "+activeKeyId, nil)
+	}
+	for keyId, key := range keys {
+		if len(key) != KeySize {
+			return nil, apperrors.Validation(fmt.Sprintf("encryption key %s must be %d bytes long", keyId, KeySize), nil)
+		}
+	}
+	return &EnvKeyProvider{activeKeyId: activeKeyId, keys: keys}, nil
+}
+
+func (p *EnvKeyProvider) ActiveKeyId() string {
+	return p.activeKeyId
+}
+
+func (p *EnvKeyProvider) Key(keyId string) ([]byte, error) {
+	key, ok := p.keys[keyId]
+	if !ok {
+		return nil, apperrors.Internal("unknown encryption key "+keyId, nil)
+	}
+	return key, nil
+}
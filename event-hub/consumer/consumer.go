@@ -1,132 +1,422 @@
 package consumer
 
-// Package consumer contains the code for the Event Hub notification event consumers.
+// Package consumer contains the code for the Event Hub and Service Bus notification event consumers.
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"r2-notify-server/apperrors"
 	"r2-notify-server/config"
 	"r2-notify-server/data"
 	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
 	"r2-notify-server/models"
+	"r2-notify-server/pipeline"
 	clientStore "r2-notify-server/services"
 	notificationService "r2-notify-server/services/notification"
+	"r2-notify-server/tracing"
 	"r2-notify-server/utils"
 	"time"
 
 	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // StartEventHubConsumer starts the Event Hub consumer for notification events.
-// It starts a goroutine for each partition in the Event Hub and reads the events from the partition.
-// For each event received, it creates a notification record in the database and sends the notification to the connected client web socket.
-func StartEventHubConsumer(ctx context.Context, notificationService notificationService.NotificationService) error {
+// Every Event Hub listed in EVENT_HUB_NOTIFICATION_EVENT_NAME is consumed as a topic of its own, supervised
+// so a hub that fails is restarted without affecting the others. Hubs with a mapping in
+// EVENT_HUB_TOPIC_MAPPINGS_FILE publish their own payloads, which are mapped to notifications.
+// For each event processed, it creates a notification record in the database and sends the notification to the connected client web socket.
+// When the context is cancelled, the receivers are closed and the queued events are drained within
+// EVENT_HUB_DRAIN_TIMEOUT_SECONDS before the hubs are closed and the function returns.
+// It returns an error if the topic mappings cannot be loaded, or if events were still being processed at
+// the shutdown deadline.
+func StartEventHubConsumer(ctx context.Context, notificationService notificationService.NotificationService, clients *clientStore.ClientStore) error {
 
 	cfg := config.LoadConfig()
-	connectionString := fmt.Sprintf("%s;EntityPath=%s", cfg.EventHubNameSpaceConString, cfg.EventHubNotificationEventName)
+	mappings, err := loadTopicMappings(cfg.EventHubTopicMappingsFile)
+	if err != nil {
+		return apperrors.Validation("invalid Event Hub topic mappings", err)
+	}
+
+	hubs := cfg.NotificationHubs()
+	configured := make([]*topic, 0, len(hubs))
+	for _, hubName := range hubs {
+		configured = append(configured, newTopic(hubName, cfg.EventHubConsumerGroup, mappings[hubName]))
+		delete(mappings, hubName)
+	}
+	for hubName := range mappings {
+		logger.Log.Warn(logger.LogPayload{
+			Message:   "Ignoring mapping of Event Hub " + hubName + ", which is not listed in EVENT_HUB_NOTIFICATION_EVENT_NAME",
+			Component: "Azure EventHub Consumer",
+			Operation: "StartEventHubConsumer",
+		})
+	}
+	topicsMutex.Lock()
+	topics = configured
+	topicsMutex.Unlock()
+
+	var consumers lifecycle
+	for _, t := range configured {
+		consumers.Go(func() {
+			supervise(ctx, t, func(ctx context.Context, t *topic) error {
+				return consumeTopic(ctx, t, notificationService, clients, &consumers)
+			})
+		})
+	}
+	// Every topic drains within its own deadline, so there is no deadline to wait for here
+	if err := consumers.wait(time.Time{}); err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Message:   "Shut down event hub consumer before every received event was processed",
+			Component: "Azure EventHub Consumer Consumer",
+			Operation: "Shutdown EventHub Consumer",
+			Error:     err,
+		})
+		return err
+	}
+	logger.Log.Info(logger.LogPayload{
+		Message:   "Shut down event hub consumer",
+		Component: "Azure EventHub Consumer Consumer",
+		Operation: "Shutdown EventHub Consumer",
+	})
+	return nil
+}
+
+// consumeTopic consumes a single Event Hub until the context is cancelled or one of its partition
+// receivers stops with an error.
+// It starts a receiver for each partition in the Event Hub, or with EVENT_HUB_PARTITION_LEASES for the
+// partitions leased by this instance, and hands the received events to a bounded per-partition worker
+// pool, so a slow database write does not stall the partition receiver.
+// Before returning, the receivers are closed, the queued events are drained and the goroutines of the topic
+// are waited for within EVENT_HUB_DRAIN_TIMEOUT_SECONDS, and only then is the hub closed, so no handler uses
+// a closed hub. Events still being processed at the deadline are recorded as a failure of the consumers.
+func consumeTopic(ctx context.Context, t *topic, notificationService notificationService.NotificationService, clients *clientStore.ClientStore, consumers *lifecycle) error {
+
+	cfg := config.LoadConfig()
+	connectionString := fmt.Sprintf("%s;EntityPath=%s", cfg.EventHubNameSpaceConString, t.hub)
 
 	hub, err := eventhub.NewHubFromConnectionString(connectionString)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Event Hub: %w", err)
+		return apperrors.DependencyUnavailable("failed to connect to Event Hub "+t.hub, err)
 	}
 	logger.Log.Debug(logger.LogPayload{
-		Message:   "Connected to Event Hub",
+		Message:   "Connected to Event Hub " + t.hub,
 		Component: "Azure EventHub Consumer Consumer",
 		Operation: "StartEventHubConsumer",
 	})
 
-	// Default consumer group
 	runtimeInfo, err := hub.GetRuntimeInformation(ctx)
 	if err != nil {
-		return err
+		_ = closeWithin(hub.Close)
+		return apperrors.DependencyUnavailable("failed to read runtime information of Event Hub "+t.hub, err)
 	}
 
-	for _, partitionID := range runtimeInfo.PartitionIDs {
-		go func(pid string) {
-			hub.Receive(ctx, pid, func(ctx context.Context, event *eventhub.Event) error {
-
-				correlationId := utils.GenerateUUID()
-
-				logger.Log.Debug(logger.LogPayload{
-					Message:       fmt.Sprintf("Received event from Event Hub %s", string(event.Data)),
-					Component:     "Azure EventHub Consumer Consumer",
-					Operation:     "OnEventReceived",
-					CorrelationId: correlationId,
-				})
+	topicCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	receivers := newPartitionReceivers(topicCtx, hub, t, func(partitionID string, event *eventhub.Event) {
+		processEvent(notificationService, clients, t, partitionID, event)
+	})
+	receivers.lifecycle.Go(func() {
+		monitorLag(topicCtx, hub, t, receivers.owned)
+	})
 
-				var eventData data.EventHubNotificationPayload
-				if err := json.Unmarshal(event.Data, &eventData); err != nil {
-					logger.Log.Error(logger.LogPayload{
-						Message:       "Invalid message format",
-						Component:     "Azure EventHub Consumer Consumer",
-						Operation:     "OnEventReceived",
-						Error:         err,
-						CorrelationId: correlationId,
-					})
-					return nil
-				}
-				// Prepare notification model
-				m := models.Notification{
-					UserId:     eventData.UserId,
-					AppId:      eventData.AppId,
-					GroupKey:   eventData.GroupKey,
-					Message:    eventData.Message,
-					Status:     eventData.Status,
-					ReadStatus: false,
-					CreatedAt:  time.Now(),
-					UpdatedAt:  time.Now(),
-				}
-
-				// Create notification record in database
-				recordId, err := notificationService.Create(m)
-				if err != nil {
-					logger.Log.Error(logger.LogPayload{
-						Message:       "Notification entry insert error",
-						Component:     "Azure EventHub Consumer",
-						Operation:     "OnEventReceived",
-						Error:         err,
-						CorrelationId: correlationId,
-					})
-					return nil
-				}
-
-				// Send Notification to connected client web socket
-				payload := data.EventNotification{
-					Event: data.Event{Event: data.NEW_NOTIFICATION},
-					Data: data.Notification{
-						Id:        recordId.Hex(),
-						UserID:    eventData.UserId,
-						AppId:     eventData.AppId,
-						GroupKey:  eventData.GroupKey,
-						Message:   eventData.Message,
-						Status:    eventData.Status,
-						CreatedAt: m.CreatedAt,
-						UpdatedAt: m.UpdatedAt,
-					},
-				}
-				m.Id = recordId
-				clientStore.SendNotificationToUser(payload, false)
-
-				logger.Log.Info(logger.LogPayload{
-					Message:       fmt.Sprintf("Sending notification to user %v", m),
-					Component:     "Azure EventHub Consumer",
-					Operation:     "OnEventReceived",
-					CorrelationId: correlationId,
+	if cfg.EventHubPartitionLeases {
+		leases := newPartitionLeases(t, runtimeInfo.PartitionIDs, time.Duration(cfg.EventHubLeaseTTLSeconds)*time.Second)
+		err = consumeLeasedPartitions(ctx, receivers, leases)
+	} else {
+		for _, partitionID := range runtimeInfo.PartitionIDs {
+			if err := receivers.start(partitionID, ""); err != nil {
+				logger.Log.Error(logger.LogPayload{
+					Message:   "Failed to start receiver for partition " + partitionID + " of Event Hub " + t.hub,
+					Component: "Azure EventHub Consumer",
+					Operation: "StartEventHubConsumer",
+					Error:     err,
 				})
-
-				return nil
-			}, eventhub.ReceiveWithLatestOffset())
-		}(partitionID)
+			}
+		}
+		if len(receivers.owned()) > 0 {
+			select {
+			case <-ctx.Done():
+			case err = <-receivers.stopped:
+			}
+		} else {
+			err = apperrors.DependencyUnavailable("no receiver of Event Hub "+t.hub+" could be started", nil)
+		}
 	}
 
-	<-ctx.Done()
 	logger.Log.Info(logger.LogPayload{
-		Message:   "Shutting down event hub consumer",
+		Message:   "Shutting down consumer of Event Hub " + t.hub,
 		Component: "Azure EventHub Consumer Consumer",
 		Operation: "Shutdown EventHub Consumer",
 	})
-	hub.Close(context.Background())
+	// Stop receiving, drain queued events and wait for the goroutines of the topic before closing the hub
+	deadline := time.Now().Add(drainTimeout())
+	receivers.stopBy(deadline, receivers.owned()...)
+	cancel()
+	if shutdownErr := receivers.lifecycle.wait(deadline); shutdownErr != nil {
+		consumers.fail(shutdownErr)
+	}
+	if closeErr := closeWithin(hub.Close); closeErr != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Message:   "Failed to close Event Hub " + t.hub,
+			Component: "Azure EventHub Consumer",
+			Operation: "Shutdown EventHub Consumer",
+			Error:     closeErr,
+		})
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
 
+// processEvent creates a notification record for the received event and sends it to the connected client web socket,
+// or applies the status update the event carries, see handleEvent.
+// Each event is traced as a consumer span, continuing the trace of the publisher when the event carries
+// a traceparent application property; the trace ID is used as the correlation ID.
+// Events already processed by any instance, according to their partition and sequence number, are skipped.
+func processEvent(service notificationService.NotificationService, clients *clientStore.ClientStore, t *topic, partitionID string, event *eventhub.Event) {
+	ctx, span := tracing.Start(eventContext(event), "eventhub.process "+t.hub, trace.SpanKindConsumer,
+		attribute.String("messaging.system", "eventhubs"),
+		attribute.String("messaging.operation.type", "process"),
+		attribute.String("messaging.destination.name", t.hub),
+		attribute.String("messaging.destination.partition.id", partitionID),
+		attribute.String("messaging.message.id", event.ID),
+	)
+	key, processed := claimEvent(t, partitionID, event)
+	span.SetAttributes(attribute.Bool("messaging.duplicate", processed))
+	if processed {
+		metrics.Inc(t.metricPrefix() + ".events.duplicate")
+		logger.Log.Info(logger.LogPayload{
+			Message:       "Skipping event " + event.ID + " of partition " + partitionID + " of Event Hub " + t.hub + ", which was already processed",
+			Component:     t.component(),
+			Operation:     "OnEventReceived",
+			CorrelationId: tracing.CorrelationId(ctx),
+		})
+		t.recordEvent(partitionID, event, nil)
+		tracing.End(span, nil)
+		return
+	}
+	var enqueuedAt *time.Time
+	if event.SystemProperties != nil {
+		enqueuedAt = event.SystemProperties.EnqueuedTime
+	}
+	err := handleEvent(ctx, service, clients, t, event.Data, enqueuedAt)
+	if err != nil && !apperrors.Is(err, apperrors.KindValidation) {
+		// Let a redelivery of the event retry it
+		releaseEvent(key)
+	}
+	t.recordEvent(partitionID, event, err)
+	tracing.End(span, err)
+}
+
+// createNotification maps the body of an event or message received from the topic to a notification, see
+// decodeEvent, creates its record in the database and sends it to the connected client web socket.
+// Duplicates of a notification created within the deduplication window are skipped. enqueuedAt is the time
+// the publisher enqueued the event or message, if known, recorded in the timings of the notification.
+// It returns nil when the notification was created, skipped as a duplicate or dropped by the pipeline,
+// a validation error when the body is not a valid notification, which receiving it again would not fix,
+// and any other error when the notification could not be persisted.
+func createNotification(ctx context.Context, service notificationService.NotificationService, clients *clientStore.ClientStore, t *topic, body []byte, enqueuedAt *time.Time) error {
+	correlationId := tracing.CorrelationId(ctx)
+
+	logger.Log.Debug(logger.LogPayload{
+		Message:       "Received event from " + t.describe(),
+		Body:          string(body),
+		Component:     t.component(),
+		Operation:     "OnEventReceived",
+		CorrelationId: correlationId,
+	})
+
+	m, err := decodeEvent(t, body)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Message:       "Invalid message format",
+			Component:     t.component(),
+			Operation:     "OnEventReceived",
+			Error:         err,
+			CorrelationId: correlationId,
+		})
+		return apperrors.Validation("invalid message format", err)
+	}
+	if !utils.ValidTenantId(m.TenantId) {
+		logger.Log.Error(logger.LogPayload{
+			Message:       "Invalid tenant ID " + m.TenantId,
+			Component:     t.component(),
+			Operation:     "OnEventReceived",
+			UserId:        m.UserId,
+			AppId:         m.AppId,
+			CorrelationId: correlationId,
+		})
+		return apperrors.Validation("invalid tenant ID", nil)
+	}
+	m, err = notificationService.ApplyMessageLimit(m)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Message:       "Message too long",
+			Component:     t.component(),
+			Operation:     "OnEventReceived",
+			UserId:        m.UserId,
+			AppId:         m.AppId,
+			Error:         err,
+			CorrelationId: correlationId,
+		})
+		return err
+	}
+
+	if enqueuedAt != nil {
+		m.Timings = &models.NotificationTimings{EnqueuedAt: enqueuedAt}
+	}
+
+	// Create notification record in database and send it to the connected client web socket
+	m, err = pipeline.Create(pipeline.Context{Context: ctx, Source: t.source, CorrelationId: correlationId}, service, clients, m)
+	if errors.Is(err, notificationService.ErrDuplicate) {
+		logger.Log.Info(logger.LogPayload{
+			Message:       "Skipping duplicate of notification " + m.Id.Hex(),
+			Component:     t.component(),
+			Operation:     "OnEventReceived",
+			CorrelationId: correlationId,
+		})
+		return nil
+	}
+	if errors.Is(err, pipeline.ErrDropped) {
+		return nil
+	}
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Message:       "Notification entry insert error",
+			Component:     t.component(),
+			Operation:     "OnEventReceived",
+			Error:         err,
+			CorrelationId: correlationId,
+		})
+		return err
+	}
+
+	logger.Log.Info(logger.LogPayload{
+		Message:       "Notification " + m.Id.Hex() + " " + m.Delivery.Status + " for userId: " + m.UserId,
+		Component:     t.component(),
+		Operation:     "OnEventReceived",
+		UserId:        m.UserId,
+		AppId:         m.AppId,
+		CorrelationId: correlationId,
+	})
 	return nil
 }
+
+// orderingKey returns the key of the events of a partition that are processed in order: the partition key
+// set by the publisher, or else the tenant and user of the notification or status update the event carries.
+// Events whose user cannot be read share the empty key, so they are processed in order with each other.
+func orderingKey(t *topic, event *eventhub.Event) string {
+	if event.PartitionKey != nil && *event.PartitionKey != "" {
+		return *event.PartitionKey
+	}
+	if update, ok := statusUpdateOf(event.Data); ok {
+		return update.TenantId + "/" + update.UserId
+	}
+	if transformer, name, ok := transformerFor(event.Data); ok {
+		notification, err := transform(transformer, name, event.Data)
+		if err != nil {
+			return ""
+		}
+		return notification.TenantId + "/" + notification.UserId
+	}
+	var eventData data.EventHubNotificationPayload
+	var err error
+	if t.mapping != nil {
+		eventData, err = t.mapping.decode(event.Data)
+	} else {
+		err = json.Unmarshal(event.Data, &eventData)
+	}
+	if err != nil {
+		return ""
+	}
+	return eventData.TenantId + "/" + eventData.UserId
+}
+
+// decodeEvent maps the body of an event to a new notification. Events whose source and schemaVersion fields
+// match a registered transformer are mapped by the transformer, events of topics with a mapping by the
+// mapping, and any other event is decoded as the notification payload.
+func decodeEvent(t *topic, body []byte) (models.Notification, error) {
+	var notification models.Notification
+	if transformer, name, ok := transformerFor(body); ok {
+		transformed, err := transform(transformer, name, body)
+		if err != nil {
+			metrics.Inc("eventhub.transform.failed")
+			return notification, err
+		}
+		metrics.Inc("eventhub.transformed." + name)
+		notification = models.Notification{
+			TenantId:    transformed.TenantId,
+			UserId:      transformed.UserId,
+			AppId:       transformed.AppId,
+			GroupKey:    transformed.GroupKey,
+			Message:     transformed.Message,
+			Status:      transformed.Status,
+			Actions:     transformed.Actions,
+			CollapseKey: transformed.CollapseKey,
+			Attachments: transformed.Attachments,
+			UIHints:     transformed.UIHints,
+			ExpiresAt:   transformed.ExpiresAt,
+			RemindAt:    transformed.RemindAt,
+			ParentId:    transformed.ParentId,
+			Source:      transformed.Source,
+		}
+	} else {
+		var eventData data.EventHubNotificationPayload
+		var err error
+		if t.mapping != nil {
+			eventData, err = t.mapping.decode(body)
+		} else {
+			err = json.Unmarshal(body, &eventData)
+		}
+		if err != nil {
+			return notification, err
+		}
+		notification = models.Notification{
+			TenantId:    eventData.TenantId,
+			UserId:      eventData.UserId,
+			AppId:       eventData.AppId,
+			GroupKey:    eventData.GroupKey,
+			Message:     eventData.Message,
+			Status:      eventData.Status,
+			Actions:     eventData.Actions,
+			CollapseKey: eventData.CollapseKey,
+			Attachments: eventData.Attachments,
+			UIHints:     eventData.UIHints,
+			ExpiresAt:   eventData.ExpiresAt,
+			RemindAt:    eventData.RemindAt,
+			ParentId:    eventData.ParentId,
+			Source:      sourceOf(eventData.SourceService, eventData.SourceInstance),
+		}
+	}
+	notification.ReadStatus = false
+	notification.CreatedAt = time.Now()
+	notification.UpdatedAt = notification.CreatedAt
+	return notification, nil
+}
+
+// sourceOf returns the source of a notification published by the given service and instance, nil when the
+// publisher named neither. The type of the source is set by the pipeline.
+func sourceOf(service string, instance string) *models.NotificationSource {
+	if service == "" && instance == "" {
+		return nil
+	}
+	return &models.NotificationSource{Service: service, Instance: instance}
+}
+
+// eventContext returns a context with the remote span of the publisher, read from the string application
+// properties of the event such as traceparent.
+func eventContext(event *eventhub.Event) context.Context {
+	carrier := map[string]string{}
+	for key, value := range event.Properties {
+		if text, ok := value.(string); ok {
+			carrier[key] = text
+		}
+	}
+	return tracing.Extract(context.Background(), carrier)
+}
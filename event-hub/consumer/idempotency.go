@@ -0,0 +1,50 @@
+package consumer
+
+import (
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"strconv"
+	"time"
+
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+)
+
+// idempotencyKey returns the Redis key marking the event with the given sequence number of the partition
+// as processed by the consumer group.
+func idempotencyKey(t *topic, partitionID string, sequenceNumber int64) string {
+	return "eventhub:processed:" + t.consumerGroup + ":" + t.hub + ":" + partitionID + ":" + strconv.FormatInt(sequenceNumber, 10)
+}
+
+// claimEvent marks the event as processed for EVENT_HUB_IDEMPOTENCY_TTL_SECONDS and reports whether it
+// had already been processed, by this instance or another one, for example after its partition was taken
+// over. It returns the claimed key, or an empty key when the check is disabled, the event has no sequence
+// number or Redis is unavailable; the check fails open, so events are processed while Redis is unavailable.
+func claimEvent(t *topic, partitionID string, event *eventhub.Event) (key string, processed bool) {
+	ttl := time.Duration(config.LoadConfig().EventHubIdempotencyTTLSeconds) * time.Second
+	if ttl <= 0 || event.SystemProperties == nil || event.SystemProperties.SequenceNumber == nil {
+		return "", false
+	}
+	key = idempotencyKey(t, partitionID, *event.SystemProperties.SequenceNumber)
+	claimed, err := config.RDB.SetNX(config.Ctx, key, instanceId, ttl).Result()
+	if err != nil {
+		metrics.Inc(t.metricPrefix() + ".idempotency.errors")
+		logger.Log.Warn(logger.LogPayload{
+			Message:   "Failed to check whether event " + strconv.FormatInt(*event.SystemProperties.SequenceNumber, 10) + " of partition " + partitionID + " of Event Hub " + t.hub + " was processed, processing it",
+			Component: "Azure EventHub Consumer",
+			Operation: "ClaimEvent",
+			Error:     err,
+		})
+		return "", false
+	}
+	return key, !claimed
+}
+
+// releaseEvent releases the key claimed for an event that could not be processed, so it is processed when
+// it is received again.
+func releaseEvent(key string) {
+	if key == "" {
+		return
+	}
+	config.RDB.Del(config.Ctx, key)
+}
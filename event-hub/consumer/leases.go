@@ -0,0 +1,271 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/utils"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// instanceId identifies this instance as the owner of partition leases.
+var instanceId = utils.GenerateUUID()
+
+// renewLeaseScript extends a lease if it is still held by the given instance.
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLeaseScript deletes a lease if it is still held by the given instance.
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// partitionLeases coordinates which instance consumes each partition of an Event Hub. Every partition is
+// leased by a single instance with a Redis key expiring after EVENT_HUB_LEASE_TTL_SECONDS, which its owner
+// renews. Instances announce themselves in a sorted set scored by the time they expire, and each one aims
+// for an even share of the partitions: leases above its share are released, free partitions are acquired
+// up to it. The partitions of an instance that dies are taken over once their leases expire.
+type partitionLeases struct {
+	topic        *topic
+	partitionIDs []string
+	ttl          time.Duration
+}
+
+// newPartitionLeases returns the leases of the given partitions of the topic.
+func newPartitionLeases(t *topic, partitionIDs []string, ttl time.Duration) *partitionLeases {
+	sorted := slices.Clone(partitionIDs)
+	sortPartitions(sorted)
+	return &partitionLeases{topic: t, partitionIDs: sorted, ttl: ttl}
+}
+
+// leaseKey returns the Redis key holding the owner of the partition.
+func (l *partitionLeases) leaseKey(partitionID string) string {
+	return "eventhub:lease:" + l.topic.consumerGroup + ":" + l.topic.hub + ":" + partitionID
+}
+
+// checkpointKey returns the Redis key holding the offset up to which every event of the partition was processed.
+func (l *partitionLeases) checkpointKey(partitionID string) string {
+	return "eventhub:checkpoint:" + l.topic.consumerGroup + ":" + l.topic.hub + ":" + partitionID
+}
+
+// instancesKey returns the Redis key of the sorted set of the instances consuming the Event Hub.
+func (l *partitionLeases) instancesKey() string {
+	return "eventhub:instances:" + l.topic.consumerGroup + ":" + l.topic.hub
+}
+
+// consumeLeasedPartitions consumes the partitions leased by this instance until the context is cancelled or
+// a receiver stops with an error. Leases are renewed and the partitions rebalanced every third of the lease
+// TTL. A partition is released after its queued events are drained and its checkpoint is saved, so the next
+// owner resumes after the last processed event.
+func consumeLeasedPartitions(ctx context.Context, receivers *partitionReceivers, leases *partitionLeases) error {
+	interval := leases.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	receivers.topic.running(0)
+	for {
+		leases.rebalance(receivers)
+		select {
+		case <-ctx.Done():
+			leases.shutdown(receivers)
+			return nil
+		case err := <-receivers.stopped:
+			leases.shutdown(receivers)
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// rebalance announces this instance, renews the leases of its partitions and moves it towards its share of
+// the partitions. While Redis is unavailable, the running partitions are kept and no partition is acquired;
+// their leases may expire and be taken over meanwhile, in which case the events of those partitions are
+// processed by both instances until the lease is found lost.
+func (l *partitionLeases) rebalance(receivers *partitionReceivers) {
+	instances, err := l.announce()
+	if err != nil {
+		l.warn("Rebalance", "Failed to announce instance for Event Hub "+l.topic.hub+", keeping the current partitions", err)
+		return
+	}
+
+	// Renew the leases of the running partitions, stopping those taken over by another instance
+	owned := receivers.owned()
+	var lost []string
+	for _, partitionID := range owned {
+		renewed, err := renewLeaseScript.Run(config.Ctx, config.RDB, []string{l.leaseKey(partitionID)}, instanceId, l.ttl.Milliseconds()).Int()
+		if err != nil {
+			l.warn("RenewLease", "Failed to renew lease of partition "+partitionID+" of Event Hub "+l.topic.hub+", keeping the current partitions", err)
+			return
+		}
+		if renewed == 0 {
+			lost = append(lost, partitionID)
+		}
+	}
+	if len(lost) > 0 {
+		receivers.stop(lost...)
+		metrics.Add(l.topic.metricPrefix()+".leases.lost", int64(len(lost)))
+		logger.Log.Warn(logger.LogPayload{
+			Message:   fmt.Sprintf("Leases of partitions %s of Event Hub %s were taken over by another instance", strings.Join(lost, ","), l.topic.hub),
+			Component: "Azure EventHub Consumer",
+			Operation: "RenewLease",
+		})
+		owned = receivers.owned()
+	}
+	l.checkpoint(receivers.offsets())
+
+	share := l.share(instances)
+	if len(owned) > share {
+		l.release(receivers, owned[share:]...)
+	} else if len(owned) < share {
+		l.acquire(receivers, share-len(owned))
+	}
+	metrics.SetGauge(l.topic.metricPrefix()+".leases.owned", int64(len(receivers.owned())))
+	metrics.SetGauge(l.topic.metricPrefix()+".instances", int64(len(instances)))
+}
+
+// announce records this instance as alive for one lease TTL and returns the IDs of the live instances,
+// removing those that expired.
+func (l *partitionLeases) announce() ([]string, error) {
+	now := time.Now()
+	pipe := config.RDB.TxPipeline()
+	pipe.ZAdd(config.Ctx, l.instancesKey(), redis.Z{Score: float64(now.Add(l.ttl).UnixMilli()), Member: instanceId})
+	pipe.ZRemRangeByScore(config.Ctx, l.instancesKey(), "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	members := pipe.ZRange(config.Ctx, l.instancesKey(), 0, -1)
+	if _, err := pipe.Exec(config.Ctx); err != nil {
+		return nil, err
+	}
+	return members.Val(), nil
+}
+
+// share returns the number of partitions this instance should own. The partitions are split evenly among
+// the live instances, and the remainder goes to the instances with the lowest IDs, so the shares add up to
+// the number of partitions without the instances having to agree on them.
+func (l *partitionLeases) share(instances []string) int {
+	if len(instances) == 0 {
+		return len(l.partitionIDs)
+	}
+	share := len(l.partitionIDs) / len(instances)
+	slices.Sort(instances)
+	if rank := slices.Index(instances, instanceId); rank >= 0 && rank < len(l.partitionIDs)%len(instances) {
+		share++
+	}
+	return share
+}
+
+// acquire leases up to count free partitions and starts receiving them after their checkpoint. Partitions
+// whose receiver cannot be started are released again.
+func (l *partitionLeases) acquire(receivers *partitionReceivers, count int) {
+	owned := receivers.owned()
+	for _, partitionID := range l.partitionIDs {
+		if count == 0 {
+			return
+		}
+		if slices.Contains(owned, partitionID) {
+			continue
+		}
+		acquired, err := config.RDB.SetNX(config.Ctx, l.leaseKey(partitionID), instanceId, l.ttl).Result()
+		if err != nil {
+			l.warn("AcquireLease", "Failed to acquire lease of partition "+partitionID+" of Event Hub "+l.topic.hub, err)
+			return
+		}
+		if !acquired {
+			continue
+		}
+		offset, err := config.RDB.Get(config.Ctx, l.checkpointKey(partitionID)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			l.warn("AcquireLease", "Failed to read checkpoint of partition "+partitionID+" of Event Hub "+l.topic.hub+", receiving from the latest event", err)
+		}
+		if err := receivers.start(partitionID, offset); err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Message:   "Failed to start receiver for partition " + partitionID + " of Event Hub " + l.topic.hub,
+				Component: "Azure EventHub Consumer",
+				Operation: "AcquireLease",
+				Error:     err,
+			})
+			_ = releaseLeaseScript.Run(config.Ctx, config.RDB, []string{l.leaseKey(partitionID)}, instanceId).Err()
+			continue
+		}
+		count--
+		metrics.Inc(l.topic.metricPrefix() + ".leases.acquired")
+		logger.Log.Info(logger.LogPayload{
+			Message:   "Acquired lease of partition " + partitionID + " of Event Hub " + l.topic.hub + startingPosition(offset),
+			Component: "Azure EventHub Consumer",
+			Operation: "AcquireLease",
+		})
+	}
+}
+
+// release stops receiving the given partitions, saves their checkpoints once their queued events are
+// processed and releases their leases, so other instances can acquire them right away.
+func (l *partitionLeases) release(receivers *partitionReceivers, partitionIDs ...string) {
+	if len(partitionIDs) == 0 {
+		return
+	}
+	l.checkpoint(receivers.stop(partitionIDs...))
+	for _, partitionID := range partitionIDs {
+		if err := releaseLeaseScript.Run(config.Ctx, config.RDB, []string{l.leaseKey(partitionID)}, instanceId).Err(); err != nil {
+			l.warn("ReleaseLease", "Failed to release lease of partition "+partitionID+" of Event Hub "+l.topic.hub+", it is taken over when it expires", err)
+			continue
+		}
+		metrics.Inc(l.topic.metricPrefix() + ".leases.released")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Message:   "Released leases of partitions " + strings.Join(partitionIDs, ",") + " of Event Hub " + l.topic.hub,
+		Component: "Azure EventHub Consumer",
+		Operation: "ReleaseLease",
+	})
+}
+
+// checkpoint saves the offsets up to which every event of the partitions was processed.
+func (l *partitionLeases) checkpoint(offsets map[string]int64) {
+	if len(offsets) == 0 {
+		return
+	}
+	pipe := config.RDB.Pipeline()
+	for partitionID, offset := range offsets {
+		pipe.Set(config.Ctx, l.checkpointKey(partitionID), strconv.FormatInt(offset, 10), 0)
+	}
+	if _, err := pipe.Exec(config.Ctx); err != nil {
+		l.warn("Checkpoint", "Failed to save partition checkpoints of Event Hub "+l.topic.hub, err)
+	}
+}
+
+// shutdown releases every partition of this instance and removes it from the live instances, so the
+// remaining instances take over its partitions on their next rebalance.
+func (l *partitionLeases) shutdown(receivers *partitionReceivers) {
+	l.release(receivers, receivers.owned()...)
+	_ = config.RDB.ZRem(config.Ctx, l.instancesKey(), instanceId).Err()
+}
+
+// warn logs a failed lease operation.
+func (l *partitionLeases) warn(operation string, message string, err error) {
+	metrics.Inc(l.topic.metricPrefix() + ".leases.errors")
+	logger.Log.Warn(logger.LogPayload{
+		Message:   message,
+		Component: "Azure EventHub Consumer",
+		Operation: operation,
+		Error:     err,
+	})
+}
+
+// startingPosition describes where receiving a partition starts, for log messages.
+func startingPosition(offset string) string {
+	if offset == "" {
+		return ", receiving from the latest event"
+	}
+	return ", receiving after offset " + offset
+}
@@ -0,0 +1,89 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Time allowed to close the connection to the broker once the received events are processed.
+const closeTimeout = 5 * time.Second
+
+// lifecycle tracks the goroutines of a consumer, so it can shut down in order: stop receiving, wait for
+// the in-flight handlers until a deadline, and only then close the connection to the broker.
+type lifecycle struct {
+	wg      sync.WaitGroup
+	running atomic.Int64
+
+	mutex sync.Mutex
+	err   error // first shutdown failure, returned by wait
+}
+
+// Go runs fn in a goroutine tracked by the lifecycle.
+func (l *lifecycle) Go(fn func()) {
+	l.wg.Add(1)
+	l.running.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer l.running.Add(-1)
+		fn()
+	}()
+}
+
+// fail records a failure to shut down cleanly, such as events still being processed at the deadline.
+// The first failure is returned by wait.
+func (l *lifecycle) fail(err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+// wait waits until every tracked goroutine has returned, or until the deadline has passed when it is not
+// zero. It returns the first failure recorded with fail, or an error counting the goroutines still running
+// when the deadline passed first.
+func (l *lifecycle) wait(deadline time.Time) error {
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-done:
+	case <-expired:
+		l.fail(apperrors.Internal(fmt.Sprintf("%d goroutines still running at the shutdown deadline", l.running.Load()), nil))
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.err
+}
+
+// drainTimeout returns the time allowed to process the received events when receiving stops, see
+// EVENT_HUB_DRAIN_TIMEOUT_SECONDS.
+func drainTimeout() time.Duration {
+	return time.Duration(config.LoadConfig().EventHubDrainTimeoutSeconds) * time.Second
+}
+
+// ShutdownTimeout returns the time an event source takes at most to shut down once its context is
+// cancelled: the time allowed to process the received events, then to close the connection to the broker.
+func ShutdownTimeout() time.Duration {
+	return drainTimeout() + closeTimeout
+}
+
+// closeWithin calls close with a context cancelled after closeTimeout.
+func closeWithin(close func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	return close(ctx)
+}
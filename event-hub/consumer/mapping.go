@@ -0,0 +1,145 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"r2-notify-server/data"
+	"strings"
+	"text/template"
+)
+
+// Notification fields that can be mapped from the payload of an Event Hub. Templates render strings, so
+// actions, attachments and uiHints can only be copied from the payload.
+var mappableFields = map[string]bool{
+	"tenantId": true, "appId": true, "userId": true, "groupKey": true, "message": true, "status": true, "actions": true,
+	"collapseKey": true, "attachments": true, "uiHints": true, "sourceService": true, "sourceInstance": true,
+}
+
+// Mappable fields copied from the payload as they are, rather than as strings.
+var structuredFields = map[string]bool{"actions": true, "attachments": true, "uiHints": true}
+
+// topicMapping turns the payloads of an Event Hub that does not publish the notification payload into
+// notifications. Each notification field is taken from a template, a dotted path in the payload or a
+// default, in that order.
+type topicMapping struct {
+	Fields    map[string]string `json:"fields"`    // notification field -> dotted path in the payload, e.g. "customer.id"
+	Templates map[string]string `json:"templates"` // notification field -> text/template rendered with the payload
+	Defaults  map[string]string `json:"defaults"`  // notification field -> value used when the path is missing
+
+	templates map[string]*template.Template
+}
+
+// loadTopicMappings reads the mappings of the Event Hubs from the JSON file at path, keyed by hub name.
+// An empty path means every hub publishes the notification payload.
+func loadTopicMappings(path string) (map[string]*topicMapping, error) {
+	mappings := make(map[string]*topicMapping)
+	if path == "" {
+		return mappings, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &mappings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for hub, mapping := range mappings {
+		if err := mapping.compile(); err != nil {
+			return nil, fmt.Errorf("%s: mapping of %s: %w", path, hub, err)
+		}
+	}
+	return mappings, nil
+}
+
+// compile checks the mapped fields and parses the templates. Templates fail on missing keys, so an event
+// without the expected fields is rejected instead of producing a "<no value>" message.
+func (m *topicMapping) compile() error {
+	for _, fields := range []map[string]string{m.Fields, m.Templates, m.Defaults} {
+		for field := range fields {
+			if !mappableFields[field] {
+				return fmt.Errorf("unknown notification field %q", field)
+			}
+		}
+	}
+	for field := range structuredFields {
+		if _, ok := m.Templates[field]; ok {
+			return fmt.Errorf("%s cannot be rendered from a template", field)
+		}
+		if _, ok := m.Defaults[field]; ok {
+			return fmt.Errorf("%s cannot have a default", field)
+		}
+	}
+	m.templates = make(map[string]*template.Template, len(m.Templates))
+	for field, text := range m.Templates {
+		tmpl, err := template.New(field).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return fmt.Errorf("template of %s: %w", field, err)
+		}
+		m.templates[field] = tmpl
+	}
+	return nil
+}
+
+// decode maps the body of an event to the notification payload.
+func (m *topicMapping) decode(body []byte) (data.EventHubNotificationPayload, error) {
+	var payload data.EventHubNotificationPayload
+	var source map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&source); err != nil {
+		return payload, err
+	}
+
+	mapped := make(map[string]interface{}, len(mappableFields))
+	for field, value := range m.Defaults {
+		mapped[field] = value
+	}
+	for field, path := range m.Fields {
+		value, ok := lookup(source, path)
+		if !ok {
+			continue
+		}
+		if structuredFields[field] {
+			mapped[field] = value
+			continue
+		}
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return payload, fmt.Errorf("%s at %s is not a string", field, path)
+		case nil:
+			continue
+		}
+		mapped[field] = fmt.Sprint(value)
+	}
+	for field, tmpl := range m.templates {
+		var rendered strings.Builder
+		if err := tmpl.Execute(&rendered, source); err != nil {
+			return payload, err
+		}
+		mapped[field] = rendered.String()
+	}
+
+	normalized, err := json.Marshal(mapped)
+	if err != nil {
+		return payload, err
+	}
+	err = json.Unmarshal(normalized, &payload)
+	return payload, err
+}
+
+// lookup returns the value at the dotted path in the payload.
+func lookup(source map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = source
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,234 @@
+package consumer
+
+import (
+	"context"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+)
+
+// partitionReceiver receives the events of a single partition and processes them with its worker pool.
+type partitionReceiver struct {
+	listener *eventhub.ListenerHandle
+	pool     *workerPool
+	offset   atomic.Int64 // offset up to which every submitted event was processed, -1 before the first one
+	closing  atomic.Bool  // set when the receiver is stopped by the consumer rather than by a failure
+
+	mutex   sync.Mutex
+	pending []int64            // offsets of the submitted events not covered by offset yet, in submission order
+	done    map[int64]struct{} // offsets of the pending events that were processed
+}
+
+// submitted records the offset of an event about to be queued, in the order the events are received.
+func (r *partitionReceiver) submitted(event *eventhub.Event) {
+	if event.SystemProperties == nil || event.SystemProperties.Offset == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.pending = append(r.pending, *event.SystemProperties.Offset)
+	r.mutex.Unlock()
+}
+
+// processed records the offset of a processed event. Workers process events concurrently and finish them out
+// of order, so the offset only moves past the events submitted before it once they are processed too: a
+// checkpoint never skips an event that is still queued or being processed.
+func (r *partitionReceiver) processed(event *eventhub.Event) {
+	if event.SystemProperties == nil || event.SystemProperties.Offset == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.done[*event.SystemProperties.Offset] = struct{}{}
+	for len(r.pending) > 0 {
+		offset := r.pending[0]
+		if _, ok := r.done[offset]; !ok {
+			return
+		}
+		delete(r.done, offset)
+		r.pending = r.pending[1:]
+		r.offset.Store(offset)
+	}
+}
+
+// partitionReceivers are the receivers of the partitions of a topic consumed by this instance. Partitions
+// are started and stopped one by one, so they can be handed over to other instances while the topic runs.
+type partitionReceivers struct {
+	ctx     context.Context
+	hub     *eventhub.Hub
+	topic   *topic
+	process func(partitionID string, event *eventhub.Event)
+	stopped chan error // first failure of a receiver that stopped on its own
+	// lifecycle tracks the goroutines watching the receivers and sampling the lag, and records the worker
+	// pools that could not be drained in time.
+	lifecycle lifecycle
+
+	mutex     sync.Mutex
+	receivers map[string]*partitionReceiver
+}
+
+// newPartitionReceivers returns an empty set of receivers for the partitions of the topic, calling process
+// for every received event. Receivers are closed when the context is cancelled.
+func newPartitionReceivers(ctx context.Context, hub *eventhub.Hub, t *topic, process func(partitionID string, event *eventhub.Event)) *partitionReceivers {
+	return &partitionReceivers{
+		ctx:       ctx,
+		hub:       hub,
+		topic:     t,
+		process:   process,
+		stopped:   make(chan error, 1),
+		receivers: make(map[string]*partitionReceiver),
+	}
+}
+
+// start starts receiving the partition after the given offset, or from the latest event when the offset
+// is empty. It returns an error if the receiver cannot be started.
+func (r *partitionReceivers) start(partitionID string, offset string) error {
+	cfg := config.LoadConfig()
+	position := eventhub.ReceiveWithLatestOffset()
+	if offset != "" {
+		position = eventhub.ReceiveWithStartingOffset(offset)
+	} else if info, err := r.hub.GetPartitionInformation(r.ctx, partitionID); err == nil {
+		// Receiving starts at the latest offset, so the lag is counted from the last enqueued event
+		r.topic.baseline(partitionID, info)
+	}
+
+	receiver := &partitionReceiver{done: make(map[int64]struct{})}
+	receiver.offset.Store(-1)
+	receiver.pool = newWorkerPool(r.topic.hub, partitionID, cfg.EventHubWorkerPoolSize, cfg.EventHubWorkerQueueSize, func(event *eventhub.Event) string {
+		return orderingKey(r.topic, event)
+	}, func(event *eventhub.Event) {
+		r.process(partitionID, event)
+		receiver.processed(event)
+	})
+
+	listener, err := r.hub.Receive(r.ctx, partitionID, func(_ context.Context, event *eventhub.Event) error {
+		// An event that is not queued stays pending, so the partition is not checkpointed past it
+		receiver.submitted(event)
+		if err := receiver.pool.submit(r.ctx, event); err != nil {
+			logger.Log.Warn(logger.LogPayload{
+				Message:   "Event not queued for partition " + partitionID + " of Event Hub " + r.topic.hub,
+				Component: "Azure EventHub Consumer",
+				Operation: "OnEventReceived",
+				Error:     err,
+			})
+		}
+		return nil
+	}, eventhub.ReceiveWithConsumerGroup(r.topic.consumerGroup), position)
+	if err != nil {
+		_ = receiver.pool.drain(time.Time{})
+		r.topic.forget(partitionID)
+		return err
+	}
+	receiver.listener = listener
+	r.lifecycle.Go(func() {
+		<-listener.Done()
+		if receiver.closing.Load() || r.ctx.Err() != nil {
+			return
+		}
+		err := listener.Err()
+		if err == nil {
+			err = apperrors.DependencyUnavailable("receiver of partition "+partitionID+" of Event Hub "+r.topic.hub+" stopped", nil)
+		}
+		select {
+		case r.stopped <- err:
+		default:
+		}
+	})
+
+	r.mutex.Lock()
+	r.receivers[partitionID] = receiver
+	count := len(r.receivers)
+	r.mutex.Unlock()
+	r.topic.running(count)
+	return nil
+}
+
+// stop closes the receivers of the given partitions and drains their queued events within
+// EVENT_HUB_DRAIN_TIMEOUT_SECONDS. It returns the offset up to which every event of each partition was
+// processed, leaving out partitions on which no event was processed.
+func (r *partitionReceivers) stop(partitionIDs ...string) map[string]int64 {
+	return r.stopBy(time.Now().Add(drainTimeout()), partitionIDs...)
+}
+
+// stopBy closes the receivers of the given partitions and drains their queued events until the deadline.
+// Pools that are not drained by then are recorded as a shutdown failure of the lifecycle. It returns the
+// offset up to which every event of each partition was processed, leaving out partitions on which no event
+// was processed.
+func (r *partitionReceivers) stopBy(deadline time.Time, partitionIDs ...string) map[string]int64 {
+	r.mutex.Lock()
+	stopping := make(map[string]*partitionReceiver, len(partitionIDs))
+	for _, partitionID := range partitionIDs {
+		if receiver, ok := r.receivers[partitionID]; ok {
+			stopping[partitionID] = receiver
+			delete(r.receivers, partitionID)
+		}
+	}
+	count := len(r.receivers)
+	r.mutex.Unlock()
+
+	for _, receiver := range stopping {
+		receiver.closing.Store(true)
+		_ = receiver.listener.Close(context.Background())
+	}
+	var wg sync.WaitGroup
+	for _, receiver := range stopping {
+		wg.Add(1)
+		go func(p *workerPool) {
+			defer wg.Done()
+			if err := p.drain(deadline); err != nil {
+				r.lifecycle.fail(err)
+			}
+		}(receiver.pool)
+	}
+	wg.Wait()
+
+	offsets := make(map[string]int64, len(stopping))
+	for partitionID, receiver := range stopping {
+		if offset := receiver.offset.Load(); offset >= 0 {
+			offsets[partitionID] = offset
+		}
+		r.topic.forget(partitionID)
+	}
+	r.topic.running(count)
+	return offsets
+}
+
+// offsets returns the offset up to which every event of each running partition was processed, leaving out
+// partitions on which no event was processed yet.
+func (r *partitionReceivers) offsets() map[string]int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	offsets := make(map[string]int64, len(r.receivers))
+	for partitionID, receiver := range r.receivers {
+		if offset := receiver.offset.Load(); offset >= 0 {
+			offsets[partitionID] = offset
+		}
+	}
+	return offsets
+}
+
+// owned returns the IDs of the running partitions, ordered numerically.
+// It is safe to call this function concurrently from multiple goroutines.
+func (r *partitionReceivers) owned() []string {
+	r.mutex.Lock()
+	partitionIDs := make([]string, 0, len(r.receivers))
+	for partitionID := range r.receivers {
+		partitionIDs = append(partitionIDs, partitionID)
+	}
+	r.mutex.Unlock()
+	sortPartitions(partitionIDs)
+	return partitionIDs
+}
+
+// sortPartitions orders partition IDs, which are numbers, numerically.
+func sortPartitions(partitionIDs []string) {
+	sort.Slice(partitionIDs, func(i, j int) bool {
+		a, b := partitionIDs[i], partitionIDs[j]
+		return len(a) < len(b) || (len(a) == len(b) && a < b)
+	})
+}
@@ -0,0 +1,405 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	clientStore "r2-notify-server/services"
+	notificationService "r2-notify-server/services/notification"
+	"r2-notify-server/tracing"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/v4/auth"
+	"github.com/Azure/azure-amqp-common-go/v4/cbs"
+	"github.com/Azure/azure-amqp-common-go/v4/conn"
+	"github.com/Azure/azure-amqp-common-go/v4/sas"
+	"github.com/Azure/go-amqp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Link filter accepting the next available session of a session-enabled queue, and its descriptor code.
+const (
+	sessionFilterName = "com.microsoft:session-filter"
+	sessionFilterCode = uint64(0x00000137000000C)
+)
+
+// Condition returned when attaching a session receiver while no session has messages available.
+const sessionTimeoutCondition = "com.microsoft:timeout"
+
+// Condition of the rejected disposition dead-lettering a message.
+const deadLetterCondition = "com.microsoft:dead-letter"
+
+// Time a session receiver waits for the next message of its session before releasing the session,
+// so the receiver can accept another session with messages available.
+const sessionIdleTimeout = 30 * time.Second
+
+// Messages prefetched by a session receiver. Messages of a session are processed one at a time, in order.
+const sessionPrefetch = 10
+
+// Time allowed to complete, abandon or dead-letter a processed message.
+const messageSettleTimeout = 10 * time.Second
+
+// Interval at which the claim of a queue is negotiated again, before the SAS token expires after two hours.
+const claimRefreshInterval = 45 * time.Minute
+
+// serviceBusSource consumes the Service Bus queues listed in SERVICE_BUS_QUEUES.
+type serviceBusSource struct{}
+
+func (s *serviceBusSource) Name() string {
+	return data.SOURCE_SERVICE_BUS
+}
+
+// Start consumes every Service Bus queue listed in SERVICE_BUS_QUEUES as a topic of its own, supervised so a
+// queue that fails is restarted without affecting the others. Queues with a mapping in
+// EVENT_HUB_TOPIC_MAPPINGS_FILE publish their own payloads, which are mapped to notifications.
+// Messages are received in peek-lock mode and settled once processed: completed when the notification was
+// persisted, skipped as a duplicate or dropped, dead-lettered when the body is not a valid notification and
+// abandoned otherwise, so Service Bus redelivers them up to the max delivery count of the queue.
+// When the context is cancelled, the receivers stop and the messages being processed are settled before
+// the function returns. It returns an error if the topic mappings cannot be loaded.
+func (s *serviceBusSource) Start(ctx context.Context, notificationService notificationService.NotificationService, clients *clientStore.ClientStore) error {
+
+	cfg := config.LoadConfig()
+	mappings, err := loadTopicMappings(cfg.EventHubTopicMappingsFile)
+	if err != nil {
+		return apperrors.Validation("invalid topic mappings", err)
+	}
+
+	queues := cfg.NotificationQueues()
+	configured := make([]*topic, 0, len(queues))
+	for _, queue := range queues {
+		configured = append(configured, newQueueTopic(queue, mappings[queue]))
+		delete(mappings, queue)
+	}
+	for queue := range mappings {
+		logger.Log.Warn(logger.LogPayload{
+			Message:   "Ignoring mapping of " + queue + ", which is not listed in SERVICE_BUS_QUEUES",
+			Component: "Azure Service Bus Consumer",
+			Operation: "StartServiceBusConsumer",
+		})
+	}
+	topicsMutex.Lock()
+	topics = configured
+	topicsMutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, t := range configured {
+		wg.Add(1)
+		go func(t *topic) {
+			defer wg.Done()
+			supervise(ctx, t, func(ctx context.Context, t *topic) error {
+				return consumeQueue(ctx, t, notificationService, clients)
+			})
+		}(t)
+	}
+	wg.Wait()
+	logger.Log.Info(logger.LogPayload{
+		Message:   "Shut down Service Bus consumer",
+		Component: "Azure Service Bus Consumer",
+		Operation: "Shutdown Service Bus Consumer",
+	})
+	return nil
+}
+
+// consumeQueue consumes a single Service Bus queue until the context is cancelled or one of its receivers
+// stops with an error. With SERVICE_BUS_SESSIONS, SERVICE_BUS_CONCURRENCY sessions are received at once,
+// each processing its messages in order; otherwise up to SERVICE_BUS_CONCURRENCY messages are processed at once.
+// Before returning, the receivers are closed and the messages being processed are settled.
+func consumeQueue(ctx context.Context, t *topic, notificationService notificationService.NotificationService, clients *clientStore.ClientStore) error {
+
+	cfg := config.LoadConfig()
+	parsed, err := conn.ParsedConnectionFromStr(cfg.ServiceBusConString)
+	if err != nil {
+		return apperrors.Validation("invalid Service Bus connection string", err)
+	}
+	provider, err := sas.NewTokenProvider(sas.TokenProviderWithKey(parsed.KeyName, parsed.Key))
+	if err != nil {
+		return apperrors.Internal("failed to create Service Bus token provider", err)
+	}
+
+	client, err := amqp.Dial(ctx, parsed.Host, &amqp.ConnOptions{SASLType: amqp.SASLTypeAnonymous()})
+	if err != nil {
+		return apperrors.DependencyUnavailable("failed to connect to Service Bus namespace "+parsed.Namespace, err)
+	}
+	defer client.Close()
+	audience := parsed.Host + "/" + t.hub
+	if err := cbs.NegotiateClaim(ctx, audience, client, provider); err != nil {
+		return apperrors.DependencyUnavailable("failed to authorize "+t.describe(), err)
+	}
+	session, err := client.NewSession(ctx, nil)
+	if err != nil {
+		return apperrors.DependencyUnavailable("failed to open session to "+t.describe(), err)
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Message:   "Connected to " + t.describe(),
+		Component: "Azure Service Bus Consumer",
+		Operation: "StartServiceBusConsumer",
+	})
+
+	queueCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	concurrency := cfg.ServiceBusConcurrency
+	stopped := make(chan error, concurrency+1)
+	go func() {
+		stopped <- refreshClaim(queueCtx, client, audience, provider)
+	}()
+
+	var wg sync.WaitGroup
+	if cfg.ServiceBusSessions {
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				stopped <- receiveSessions(queueCtx, session, t, notificationService, clients)
+			}()
+		}
+	} else {
+		receiver, err := session.NewReceiver(ctx, t.hub, receiverOptions(int32(concurrency), false))
+		if err != nil {
+			return apperrors.DependencyUnavailable("failed to start receiver of "+t.describe(), err)
+		}
+		defer receiver.Close(context.Background())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopped <- receiveMessages(queueCtx, receiver, t, concurrency, notificationService, clients)
+		}()
+	}
+	t.running(concurrency)
+
+	select {
+	case <-ctx.Done():
+	case err = <-stopped:
+		if err == nil {
+			err = apperrors.DependencyUnavailable("receiver of "+t.describe()+" stopped", nil)
+		}
+	}
+
+	logger.Log.Info(logger.LogPayload{
+		Message:   "Shutting down consumer of " + t.describe(),
+		Component: "Azure Service Bus Consumer",
+		Operation: "Shutdown Service Bus Consumer",
+	})
+	cancel()
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// receiverOptions returns the options of a peek-lock receiver with the given credit. Session receivers
+// accept the next session with messages available.
+func receiverOptions(credit int32, sessions bool) *amqp.ReceiverOptions {
+	options := &amqp.ReceiverOptions{
+		Credit:                    credit,
+		SettlementMode:            amqp.ReceiverSettleModeSecond.Ptr(),
+		RequestedSenderSettleMode: amqp.SenderSettleModeUnsettled.Ptr(),
+	}
+	if sessions {
+		options.Filters = []amqp.LinkFilter{amqp.NewLinkFilter(sessionFilterName, sessionFilterCode, nil)}
+	}
+	return options
+}
+
+// receiveMessages receives the messages of a queue without sessions until the context is cancelled or the
+// receiver fails, processing up to concurrency messages at once. It returns once every message received
+// has been settled.
+func receiveMessages(ctx context.Context, receiver *amqp.Receiver, t *topic, concurrency int, notificationService notificationService.NotificationService, clients *clientStore.ClientStore) error {
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		msg, err := receiver.Receive(ctx, nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return apperrors.DependencyUnavailable("failed to receive from "+t.describe(), err)
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			processMessage(notificationService, clients, t, receiver, msg, "")
+		}()
+	}
+}
+
+// receiveSessions accepts the sessions of a session-enabled queue one after the other until the context is
+// cancelled or the receiver fails. Each session is received until it stays idle for sessionIdleTimeout.
+func receiveSessions(ctx context.Context, session *amqp.Session, t *topic, notificationService notificationService.NotificationService, clients *clientStore.ClientStore) error {
+	for {
+		receiver, err := session.NewReceiver(ctx, t.hub, receiverOptions(sessionPrefetch, true))
+		if ctx.Err() != nil {
+			return nil
+		}
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Condition == sessionTimeoutCondition {
+			// No session has messages available
+			continue
+		}
+		if err != nil {
+			return apperrors.DependencyUnavailable("failed to accept session of "+t.describe(), err)
+		}
+
+		sessionId, _ := receiver.LinkSourceFilterValue(sessionFilterName).(string)
+		metrics.Inc(t.metricPrefix() + ".sessions.accepted")
+		logger.Log.Debug(logger.LogPayload{
+			Message:   "Accepted session " + sessionId + " of " + t.describe(),
+			Component: "Azure Service Bus Consumer",
+			Operation: "ReceiveSessions",
+		})
+		err = receiveSession(ctx, receiver, t, sessionId, notificationService, clients)
+		_ = receiver.Close(context.Background())
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// receiveSession processes the messages of an accepted session in order, until the session stays idle for
+// sessionIdleTimeout or the context is cancelled.
+func receiveSession(ctx context.Context, receiver *amqp.Receiver, t *topic, sessionId string, notificationService notificationService.NotificationService, clients *clientStore.ClientStore) error {
+	for {
+		receiveCtx, cancel := context.WithTimeout(ctx, sessionIdleTimeout)
+		msg, err := receiver.Receive(receiveCtx, nil)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+				return nil
+			}
+			return apperrors.DependencyUnavailable("failed to receive session "+sessionId+" of "+t.describe(), err)
+		}
+		processMessage(notificationService, clients, t, receiver, msg, sessionId)
+	}
+}
+
+// processMessage creates a notification record for the received message or applies its status update, see handleEvent, and
+// settles the message based on the outcome. Each message is traced as a consumer span, continuing the trace
+// of the publisher when the message carries a traceparent application property.
+func processMessage(service notificationService.NotificationService, clients *clientStore.ClientStore, t *topic, receiver *amqp.Receiver, msg *amqp.Message, sessionId string) {
+	messageId := ""
+	if msg.Properties != nil && msg.Properties.MessageID != nil {
+		messageId = fmt.Sprint(msg.Properties.MessageID)
+	}
+	ctx, span := tracing.Start(messageContext(msg), "servicebus.process "+t.hub, trace.SpanKindConsumer,
+		attribute.String("messaging.system", "servicebus"),
+		attribute.String("messaging.operation.type", "process"),
+		attribute.String("messaging.destination.name", t.hub),
+		attribute.String("messaging.message.id", messageId),
+		attribute.String("messaging.servicebus.message.session_id", sessionId),
+	)
+	err := handleEvent(ctx, service, clients, t, messageBody(msg), messageEnqueuedAt(msg))
+	t.mutex.Lock()
+	t.recordOutcome(err)
+	t.mutex.Unlock()
+	tracing.End(span, err)
+	settleMessage(t, receiver, msg, messageId, err)
+}
+
+// settleMessage completes the message when err is nil, dead-letters it when err is a validation error and
+// abandons it otherwise, incrementing its delivery count. A message that cannot be settled is redelivered
+// once its lock expires.
+func settleMessage(t *topic, receiver *amqp.Receiver, msg *amqp.Message, messageId string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), messageSettleTimeout)
+	defer cancel()
+	var outcome string
+	var settleErr error
+	switch {
+	case err == nil:
+		outcome = "completed"
+		settleErr = receiver.AcceptMessage(ctx, msg)
+	case apperrors.Is(err, apperrors.KindValidation):
+		outcome = "deadlettered"
+		settleErr = receiver.RejectMessage(ctx, msg, &amqp.Error{
+			Condition: deadLetterCondition,
+			Info: map[string]any{
+				"DeadLetterReason":           "InvalidNotification",
+				"DeadLetterErrorDescription": err.Error(),
+			},
+		})
+	default:
+		outcome = "abandoned"
+		settleErr = receiver.ModifyMessage(ctx, msg, &amqp.ModifyMessageOptions{DeliveryFailed: true})
+	}
+	if settleErr != nil {
+		metrics.Inc(t.metricPrefix() + ".messages.settle_failed")
+		logger.Log.Warn(logger.LogPayload{
+			Message:   "Failed to settle message " + messageId + " of " + t.describe() + " as " + outcome,
+			Component: "Azure Service Bus Consumer",
+			Operation: "SettleMessage",
+			Error:     settleErr,
+		})
+		return
+	}
+	metrics.Inc(t.metricPrefix() + ".messages." + outcome)
+}
+
+// refreshClaim negotiates the claim of the queue again every claimRefreshInterval until the context is
+// cancelled. It returns an error if the claim cannot be renewed, which restarts the queue.
+func refreshClaim(ctx context.Context, client *amqp.Conn, audience string, provider auth.TokenProvider) error {
+	ticker := time.NewTicker(claimRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := cbs.NegotiateClaim(ctx, audience, client, provider); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return apperrors.DependencyUnavailable("failed to renew claim of "+audience, err)
+			}
+		}
+	}
+}
+
+// messageBody returns the body of a message: its first data section, as sent by the Service Bus SDKs, or
+// its value when the message carries a string or binary value instead.
+func messageBody(msg *amqp.Message) []byte {
+	if body := msg.GetData(); body != nil {
+		return body
+	}
+	switch value := msg.Value.(type) {
+	case string:
+		return []byte(value)
+	case []byte:
+		return value
+	}
+	return nil
+}
+
+// messageEnqueuedAt returns the time Service Bus enqueued the message, read from its x-opt-enqueued-time
+// annotation, or nil when the message does not carry it.
+func messageEnqueuedAt(msg *amqp.Message) *time.Time {
+	if enqueuedAt, ok := msg.Annotations["x-opt-enqueued-time"].(time.Time); ok {
+		return &enqueuedAt
+	}
+	return nil
+}
+
+// messageContext returns a context with the remote span of the publisher, read from the string application
+// properties of the message such as traceparent.
+func messageContext(msg *amqp.Message) context.Context {
+	carrier := map[string]string{}
+	for key, value := range msg.ApplicationProperties {
+		if text, ok := value.(string); ok {
+			carrier[key] = text
+		}
+	}
+	return tracing.Extract(context.Background(), carrier)
+}
@@ -0,0 +1,40 @@
+package consumer
+
+import (
+	"context"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	clientStore "r2-notify-server/services"
+	notificationService "r2-notify-server/services/notification"
+)
+
+// EventSource consumes notification events from a message broker and creates a notification for each of them.
+// The broker is selected on startup with EVENT_SOURCE, see NewEventSource.
+type EventSource interface {
+	// Name returns the name of the broker as configured in EVENT_SOURCE.
+	Name() string
+	// Start consumes the configured topics until the context is cancelled, delivering the notifications to
+	// the connections in clients, then finishes processing the received events before returning. It returns
+	// an error if the consumer cannot be started.
+	Start(ctx context.Context, notificationService notificationService.NotificationService, clients *clientStore.ClientStore) error
+}
+
+// NewEventSource returns the event source selected in EVENT_SOURCE: Azure Service Bus queues for
+// serviceBus and Azure Event Hubs otherwise.
+func NewEventSource(cfg *config.Config) EventSource {
+	if cfg.EventSource == data.SOURCE_SERVICE_BUS {
+		return &serviceBusSource{}
+	}
+	return &eventHubSource{}
+}
+
+// eventHubSource consumes the Event Hubs listed in EVENT_HUB_NOTIFICATION_EVENT_NAME.
+type eventHubSource struct{}
+
+func (s *eventHubSource) Name() string {
+	return data.SOURCE_EVENT_HUB
+}
+
+func (s *eventHubSource) Start(ctx context.Context, notificationService notificationService.NotificationService, clients *clientStore.ClientStore) error {
+	return StartEventHubConsumer(ctx, notificationService, clients)
+}
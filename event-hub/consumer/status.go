@@ -0,0 +1,99 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	clientStore "r2-notify-server/services"
+	notificationService "r2-notify-server/services/notification"
+	"r2-notify-server/tracing"
+	"r2-notify-server/utils"
+	"time"
+)
+
+// handleEvent handles the body of an event or message received from the topic: status updates of existing
+// notifications are applied by updateNotificationStatus, and any other body creates a notification, see
+// createNotification.
+func handleEvent(ctx context.Context, service notificationService.NotificationService, clients *clientStore.ClientStore, t *topic, body []byte, enqueuedAt *time.Time) error {
+	if update, ok := statusUpdateOf(body); ok {
+		return updateNotificationStatus(ctx, service, clients, t, update)
+	}
+	return createNotification(ctx, service, clients, t, body, enqueuedAt)
+}
+
+// statusUpdateOf decodes the body of an event as a status update, reporting false when the body is not an
+// object whose type is notificationStatusUpdate.
+func statusUpdateOf(body []byte) (data.NotificationStatusUpdate, bool) {
+	var update data.NotificationStatusUpdate
+	if err := json.Unmarshal(body, &update); err != nil || update.Type != data.EVENT_TYPE_STATUS_UPDATE {
+		return data.NotificationStatusUpdate{}, false
+	}
+	return update, true
+}
+
+// updateNotificationStatus moves the notification of the update to its status, like
+// PATCH /notifications/:id/status, and sends the updated notification to the user's connections as a
+// notificationStatusUpdated event. Only notifications of the app of the update can be updated.
+// It returns a validation error when the update is incomplete or the transition is not allowed, which
+// receiving it again would not fix, and any other error when the notification could not be updated, for
+// example because the event creating it has not been processed yet.
+func updateNotificationStatus(ctx context.Context, service notificationService.NotificationService, clients *clientStore.ClientStore, t *topic, update data.NotificationStatusUpdate) error {
+	correlationId := tracing.CorrelationId(ctx)
+	if update.Id == "" || update.AppId == "" || update.UserId == "" || update.Status == "" {
+		logger.Log.Error(logger.LogPayload{
+			Message:       "Status update without id, appId, userId or status",
+			Component:     t.component(),
+			Operation:     "OnStatusUpdateReceived",
+			UserId:        update.UserId,
+			AppId:         update.AppId,
+			CorrelationId: correlationId,
+		})
+		return apperrors.Validation("id, appId, userId and status are required", nil)
+	}
+	if !utils.ValidTenantId(update.TenantId) {
+		logger.Log.Error(logger.LogPayload{
+			Message:       "Invalid tenant ID " + update.TenantId,
+			Component:     t.component(),
+			Operation:     "OnStatusUpdateReceived",
+			UserId:        update.UserId,
+			AppId:         update.AppId,
+			CorrelationId: correlationId,
+		})
+		return apperrors.Validation("invalid tenant ID", nil)
+	}
+
+	notification, err := service.UpdateStatus(ctx, update.TenantId, update.UserId, update.AppId, update.Id, update.Status, correlationId)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Message:       "Failed to update status of notification " + update.Id,
+			Component:     t.component(),
+			Operation:     "OnStatusUpdateReceived",
+			UserId:        update.UserId,
+			AppId:         update.AppId,
+			Error:         err,
+			CorrelationId: correlationId,
+		})
+		return err
+	}
+	metrics.Inc(t.metricPrefix() + ".status_updates")
+
+	payload := data.EventNotification{
+		Event: data.Event{Event: data.NOTIFICATION_STATUS_UPDATED},
+		Data:  notification,
+	}
+	if err := clients.SendNotificationUpdateToUser(payload); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Message:       "Failed to send status update of notification " + update.Id + " to user",
+			Component:     t.component(),
+			Operation:     "OnStatusUpdateReceived",
+			UserId:        update.UserId,
+			AppId:         update.AppId,
+			Error:         err,
+			CorrelationId: correlationId,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package consumer
+
+import (
+	"context"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"sort"
+	"sync"
+	"time"
+
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+)
+
+// Delay before a failed topic is restarted.
+const topicRestartInterval = 30 * time.Second
+
+// Interval at which the lag of each running topic is sampled.
+const lagCheckInterval = 15 * time.Second
+
+// topic is an Event Hub or Service Bus queue consumed by the supervisor, with the health reported by
+// Topics and, for Event Hubs, the lag reported by Lag.
+type topic struct {
+	source        string // data.SOURCE_EVENT_HUB or data.SOURCE_SERVICE_BUS
+	hub           string // name of the Event Hub or queue
+	consumerGroup string
+	mapping       *topicMapping // nil when the hub publishes the notification payload
+
+	mutex      sync.Mutex
+	status     data.EventHubTopicStatus
+	partitions map[string]*data.EventHubPartitionLag // partition -> last processed and last enqueued event
+}
+
+var (
+	topics      []*topic
+	topicsMutex sync.RWMutex
+)
+
+// newTopic returns a topic for the given hub, read with the given consumer group. mapping may be nil.
+func newTopic(hub string, consumerGroup string, mapping *topicMapping) *topic {
+	return &topic{
+		source:        data.SOURCE_EVENT_HUB,
+		hub:           hub,
+		consumerGroup: consumerGroup,
+		mapping:       mapping,
+		status:        data.EventHubTopicStatus{Hub: hub, Source: data.SOURCE_EVENT_HUB, State: data.TOPIC_STARTING, Mapped: mapping != nil},
+		partitions:    make(map[string]*data.EventHubPartitionLag),
+	}
+}
+
+// newQueueTopic returns a topic for the given Service Bus queue. mapping may be nil.
+func newQueueTopic(queue string, mapping *topicMapping) *topic {
+	return &topic{
+		source:     data.SOURCE_SERVICE_BUS,
+		hub:        queue,
+		mapping:    mapping,
+		status:     data.EventHubTopicStatus{Hub: queue, Source: data.SOURCE_SERVICE_BUS, State: data.TOPIC_STARTING, Mapped: mapping != nil},
+		partitions: make(map[string]*data.EventHubPartitionLag),
+	}
+}
+
+// metricPrefix returns the prefix of the metrics of the topic: eventhub.<hub> or servicebus.<queue>.
+func (t *topic) metricPrefix() string {
+	if t.source == data.SOURCE_SERVICE_BUS {
+		return "servicebus." + t.hub
+	}
+	return "eventhub." + t.hub
+}
+
+// component returns the logger component of the topic's consumer.
+func (t *topic) component() string {
+	if t.source == data.SOURCE_SERVICE_BUS {
+		return "Azure Service Bus Consumer"
+	}
+	return "Azure EventHub Consumer"
+}
+
+// describe returns the topic's name for log messages, such as "Event Hub notifications".
+func (t *topic) describe() string {
+	if t.source == data.SOURCE_SERVICE_BUS {
+		return "Service Bus queue " + t.hub
+	}
+	return "Event Hub " + t.hub
+}
+
+// Topics returns the health of every consumed Event Hub, in the order they are configured.
+func Topics() []data.EventHubTopicStatus {
+	topicsMutex.RLock()
+	defer topicsMutex.RUnlock()
+	result := make([]data.EventHubTopicStatus, 0, len(topics))
+	for _, t := range topics {
+		t.mutex.Lock()
+		result = append(result, t.status)
+		t.mutex.Unlock()
+	}
+	return result
+}
+
+// Lag returns the lag of every consumed Event Hub per partition, as of the last sample taken every
+// lagCheckInterval, in the order the hubs are configured. Service Bus queues are not listed.
+func Lag() []data.EventHubLag {
+	topicsMutex.RLock()
+	defer topicsMutex.RUnlock()
+	result := make([]data.EventHubLag, 0, len(topics))
+	for _, t := range topics {
+		if t.source != data.SOURCE_EVENT_HUB {
+			continue
+		}
+		t.mutex.Lock()
+		lag := data.EventHubLag{
+			Hub:           t.hub,
+			ConsumerGroup: t.consumerGroup,
+			State:         t.status.State,
+			Lag:           t.status.Lag,
+			Partitions:    make([]data.EventHubPartitionLag, 0, len(t.partitions)),
+		}
+		for _, partition := range t.partitions {
+			lag.Partitions = append(lag.Partitions, *partition)
+		}
+		t.mutex.Unlock()
+		// Partition IDs are numbers, order them numerically
+		sort.Slice(lag.Partitions, func(i, j int) bool {
+			a, b := lag.Partitions[i].PartitionId, lag.Partitions[j].PartitionId
+			return len(a) < len(b) || (len(a) == len(b) && a < b)
+		})
+		result = append(result, lag)
+	}
+	return result
+}
+
+// supervise consumes the topic until the context is cancelled. A topic that cannot connect, or whose
+// receivers stop with an error, is marked as failed and restarted after topicRestartInterval, so a
+// broken hub or queue does not stop the other topics.
+func supervise(ctx context.Context, t *topic, consume func(ctx context.Context, t *topic) error) {
+	for {
+		t.setState(data.TOPIC_STARTING, nil)
+		err := consume(ctx, t)
+		if ctx.Err() != nil {
+			t.setState(data.TOPIC_STOPPED, nil)
+			return
+		}
+		t.setState(data.TOPIC_FAILED, err)
+		metrics.Inc(t.metricPrefix() + ".failures")
+		logger.Log.Error(logger.LogPayload{
+			Message:   "Consumer of " + t.describe() + " stopped, restarting in " + topicRestartInterval.String(),
+			Component: t.component(),
+			Operation: "SuperviseTopic",
+			Error:     err,
+		})
+		select {
+		case <-ctx.Done():
+			t.setState(data.TOPIC_STOPPED, nil)
+			return
+		case <-time.After(topicRestartInterval):
+		}
+		t.mutex.Lock()
+		t.status.Restarts++
+		t.mutex.Unlock()
+		metrics.Inc(t.metricPrefix() + ".restarts")
+	}
+}
+
+// monitorLag samples the lag of the partitions returned by partitionIDs every lagCheckInterval until the
+// context is cancelled. The total is reported in the eventhub.<hub>.lag gauge, the lag of each partition in
+// the eventhub.<hub>.partition.<id>.lag gauge and the largest time lag in the eventhub.<hub>.lag_seconds gauge.
+// With partition leases, only the partitions owned by this instance are sampled.
+func monitorLag(ctx context.Context, hub *eventhub.Hub, t *topic, partitionIDs func() []string) {
+	ticker := time.NewTicker(lagCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var lag int64
+			var lagSeconds float64
+			for _, partitionID := range partitionIDs() {
+				info, err := hub.GetPartitionInformation(ctx, partitionID)
+				if err != nil {
+					logger.Log.Warn(logger.LogPayload{
+						Message:   "Failed to read runtime information of partition " + partitionID + " of Event Hub " + t.hub,
+						Component: "Azure EventHub Consumer",
+						Operation: "MonitorLag",
+						Error:     err,
+					})
+					continue
+				}
+				partition := t.updateLag(partitionID, info)
+				metrics.SetGauge("eventhub."+t.hub+".partition."+partitionID+".lag", partition.Lag)
+				lag += partition.Lag
+				lagSeconds = max(lagSeconds, partition.LagSeconds)
+			}
+			t.mutex.Lock()
+			t.status.Lag = lag
+			t.mutex.Unlock()
+			metrics.SetGauge("eventhub."+t.hub+".lag", lag)
+			metrics.SetGauge("eventhub."+t.hub+".lag_seconds", int64(lagSeconds))
+		}
+	}
+}
+
+// setState changes the state of the topic, recording err as its last error.
+func (t *topic) setState(state string, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.status.State = state
+	if err != nil {
+		t.status.LastError = err.Error()
+	}
+}
+
+// running marks the topic as receiving events from the given number of partitions, or of concurrent
+// sessions for Service Bus queues.
+func (t *topic) running(partitions int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.status.State = data.TOPIC_RUNNING
+	t.status.Partitions = partitions
+}
+
+// baseline sets the event from which the lag of a partition is counted, the last enqueued event when
+// receiving starts. Receivers start at the latest offset after a restart too, so the baseline is reset.
+func (t *topic) baseline(partitionID string, info *eventhub.HubPartitionRuntimeInformation) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.partitions[partitionID] = &data.EventHubPartitionLag{
+		PartitionId:             partitionID,
+		LastProcessedSequence:   info.LastSequenceNumber,
+		LastProcessedEnqueuedAt: info.LastEnqueuedTimeUtc,
+		LastEnqueuedSequence:    info.LastSequenceNumber,
+		LastEnqueuedAt:          info.LastEnqueuedTimeUtc,
+		CheckedAt:               time.Now(),
+	}
+}
+
+// forget removes the lag of a partition that is no longer consumed by this instance.
+func (t *topic) forget(partitionID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.partitions, partitionID)
+	metrics.SetGauge("eventhub."+t.hub+".partition."+partitionID+".lag", 0)
+}
+
+// updateLag records the last event enqueued in the partition and returns its lag: the number of events
+// enqueued after the last processed one, and the difference between their enqueued times.
+func (t *topic) updateLag(partitionID string, info *eventhub.HubPartitionRuntimeInformation) data.EventHubPartitionLag {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	partition, ok := t.partitions[partitionID]
+	if !ok {
+		// The partition information could not be read when receiving started
+		partition = &data.EventHubPartitionLag{
+			PartitionId:             partitionID,
+			LastProcessedSequence:   info.LastSequenceNumber,
+			LastProcessedEnqueuedAt: info.LastEnqueuedTimeUtc,
+		}
+		t.partitions[partitionID] = partition
+	}
+	partition.LastEnqueuedSequence = info.LastSequenceNumber
+	partition.LastEnqueuedAt = info.LastEnqueuedTimeUtc
+	partition.CheckedAt = time.Now()
+	partition.Lag = max(partition.LastEnqueuedSequence-partition.LastProcessedSequence, 0)
+	partition.LagSeconds = 0
+	if partition.Lag > 0 {
+		partition.LagSeconds = max(partition.LastEnqueuedAt.Sub(partition.LastProcessedEnqueuedAt).Seconds(), 0)
+	}
+	return *partition
+}
+
+// recordEvent counts a processed event of the given partition and whether processing failed.
+func (t *topic) recordEvent(partitionID string, event *eventhub.Event, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if properties := event.SystemProperties; properties != nil && properties.SequenceNumber != nil {
+		partition, ok := t.partitions[partitionID]
+		if !ok {
+			partition = &data.EventHubPartitionLag{PartitionId: partitionID}
+			t.partitions[partitionID] = partition
+		}
+		if *properties.SequenceNumber > partition.LastProcessedSequence {
+			partition.LastProcessedSequence = *properties.SequenceNumber
+			if properties.EnqueuedTime != nil {
+				partition.LastProcessedEnqueuedAt = *properties.EnqueuedTime
+			}
+		}
+	}
+	t.recordOutcome(err)
+}
+
+// recordOutcome counts a processed event or message and whether processing failed. The caller must
+// hold the mutex.
+func (t *topic) recordOutcome(err error) {
+	t.status.LastEventAt = time.Now()
+	if err != nil {
+		t.status.Failed++
+		t.status.LastError = err.Error()
+		metrics.Inc(t.metricPrefix() + ".events.failed")
+		return
+	}
+	t.status.Processed++
+	metrics.Inc(t.metricPrefix() + ".events.processed")
+}
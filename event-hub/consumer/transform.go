@@ -0,0 +1,99 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	"sync"
+)
+
+// Transformer maps the raw payload of an event published in a producer specific format to a notification.
+// Only the tenantId, appId, userId, groupKey, message, status, actions, collapseKey, attachments, uiHints,
+// source, expiresAt, remindAt and parentId of the returned notification are used.
+type Transformer interface {
+	Transform(body []byte) (models.Notification, error)
+}
+
+// TransformerFunc adapts a function to the Transformer interface.
+type TransformerFunc func(body []byte) (models.Notification, error)
+
+// Transform calls f(body).
+func (f TransformerFunc) Transform(body []byte) (models.Notification, error) {
+	return f(body)
+}
+
+// transformerKey identifies the producer format a transformer handles. An empty schemaVersion matches
+// every version of the source.
+type transformerKey struct {
+	source        string
+	schemaVersion string
+}
+
+// transformerEnvelope holds the fields of an event selecting its transformer.
+type transformerEnvelope struct {
+	Source        string `json:"source"`
+	SchemaVersion string `json:"schemaVersion"`
+}
+
+var (
+	transformersMutex sync.RWMutex
+	transformers      = make(map[transformerKey]Transformer)
+)
+
+// RegisterTransformer registers the transformer of the events whose source and schemaVersion fields match
+// the given values. An empty schemaVersion registers the transformer for every version of the source that
+// has no transformer of its own. Registering a transformer for the same source and schemaVersion again
+// replaces it. Transformers should be registered on startup, before the consumer is started.
+func RegisterTransformer(source string, schemaVersion string, transformer Transformer) {
+	transformersMutex.Lock()
+	defer transformersMutex.Unlock()
+	transformers[transformerKey{source: source, schemaVersion: schemaVersion}] = transformer
+	logger.Log.Info(logger.LogPayload{
+		Component: "Azure EventHub Consumer",
+		Operation: "RegisterTransformer",
+		Message:   "Registered transformer for source " + describeTransformer(source, schemaVersion),
+	})
+}
+
+// transformerFor returns the transformer registered for the source and schemaVersion of the event body,
+// and the name it is reported under. It returns false if the event carries neither field, is not a JSON
+// object or no transformer matches, in which case the event is decoded as before.
+func transformerFor(body []byte) (Transformer, string, bool) {
+	transformersMutex.RLock()
+	defer transformersMutex.RUnlock()
+	if len(transformers) == 0 {
+		return nil, "", false
+	}
+	var envelope transformerEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil || (envelope.Source == "" && envelope.SchemaVersion == "") {
+		return nil, "", false
+	}
+	if transformer, ok := transformers[transformerKey{source: envelope.Source, schemaVersion: envelope.SchemaVersion}]; ok {
+		return transformer, describeTransformer(envelope.Source, envelope.SchemaVersion), true
+	}
+	if transformer, ok := transformers[transformerKey{source: envelope.Source}]; ok {
+		return transformer, describeTransformer(envelope.Source, ""), true
+	}
+	return nil, "", false
+}
+
+// transform maps the event body with the transformer and checks that the notification can be routed to a user.
+func transform(transformer Transformer, name string, body []byte) (models.Notification, error) {
+	notification, err := transformer.Transform(body)
+	if err != nil {
+		return models.Notification{}, fmt.Errorf("transformer %s: %w", name, err)
+	}
+	if notification.UserId == "" || notification.AppId == "" {
+		return models.Notification{}, fmt.Errorf("transformer %s: notification without userId or appId", name)
+	}
+	return notification, nil
+}
+
+// describeTransformer returns the name of the transformer of a source and schemaVersion used in logs and metrics.
+func describeTransformer(source string, schemaVersion string) string {
+	if schemaVersion == "" {
+		return source
+	}
+	return source + "@" + schemaVersion
+}
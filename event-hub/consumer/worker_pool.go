@@ -0,0 +1,149 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"sync"
+	"time"
+
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+)
+
+// workerPool processes the events of a single partition of an Event Hub with a bounded number of workers.
+// Each worker has its own queue, and events are routed to a worker by hashing their ordering key, so the
+// events of a user are processed one at a time, in the order they were received, while the events of
+// different users are processed concurrently. When the queue of a worker is full, submit blocks the
+// partition receiver until the worker frees a slot, which applies backpressure to the Event Hub partition.
+type workerPool struct {
+	hub         string
+	partitionId string
+	queues      []chan *eventhub.Event
+	key         func(event *eventhub.Event) string
+	process     func(event *eventhub.Event)
+	workers     lifecycle
+	mutex       sync.RWMutex
+	closed      bool
+	closing     chan struct{}  // closed by drain to wake up submitters waiting for a free slot
+	submitting  sync.WaitGroup // submitters that may still send to a queue
+}
+
+// newWorkerPool starts size workers for the given partition of the hub, each calling process for the events
+// routed to it by their key. The queueSize slots are split evenly between the workers.
+func newWorkerPool(hub string, partitionId string, size int, queueSize int, key func(event *eventhub.Event) string, process func(event *eventhub.Event)) *workerPool {
+	size = max(size, 1)
+	pool := &workerPool{
+		hub:         hub,
+		partitionId: partitionId,
+		queues:      make([]chan *eventhub.Event, size),
+		key:         key,
+		process:     process,
+		closing:     make(chan struct{}),
+	}
+	for i := range pool.queues {
+		queue := make(chan *eventhub.Event, (max(queueSize, 0)+size-1)/size)
+		pool.queues[i] = queue
+		pool.workers.Go(func() { pool.work(queue) })
+	}
+	return pool
+}
+
+// submit queues an event for processing by the worker of its key. It blocks while the queue of the worker is
+// full and returns an error if the context is cancelled or the pool is drained before the event could be queued.
+func (p *workerPool) submit(ctx context.Context, event *eventhub.Event) error {
+	p.mutex.RLock()
+	if p.closed {
+		p.mutex.RUnlock()
+		return apperrors.Internal("worker pool closed", nil)
+	}
+	// The lock is not held while waiting for a free slot, so drain is not held up by a full queue
+	p.submitting.Add(1)
+	p.mutex.RUnlock()
+	defer p.submitting.Done()
+
+	queue := p.queues[p.worker(event)]
+	select {
+	case queue <- event:
+	default:
+		// Queue is full, wait for the worker to free a slot
+		metrics.Inc("eventhub.backpressure.blocked")
+		start := time.Now()
+		select {
+		case queue <- event:
+			metrics.Add("eventhub.backpressure.blocked_ms", time.Since(start).Milliseconds())
+		case <-ctx.Done():
+			metrics.Inc("eventhub.events.dropped")
+			return ctx.Err()
+		case <-p.closing:
+			metrics.Inc("eventhub.events.dropped")
+			return apperrors.Internal("worker pool closed", nil)
+		}
+	}
+	metrics.AddGauge("eventhub.queue.depth", 1)
+	return nil
+}
+
+// worker returns the index of the worker processing the events with the key of the given event.
+func (p *workerPool) worker(event *eventhub.Event) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(p.key(event)))
+	return int(hash.Sum32() % uint32(len(p.queues)))
+}
+
+// queued returns the number of events waiting in the queues of the workers.
+func (p *workerPool) queued() int {
+	queued := 0
+	for _, queue := range p.queues {
+		queued += len(queue)
+	}
+	return queued
+}
+
+// drain stops accepting new events and waits until every queued event has been processed, or until the
+// deadline. It returns an error if events were still queued or being processed at the deadline; they go on
+// being processed in the background.
+func (p *workerPool) drain(deadline time.Time) error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+	} else {
+		p.closed = true
+		p.mutex.Unlock()
+		// Wake up the submitters waiting for a free slot and close the queues once none can send anymore
+		close(p.closing)
+		p.submitting.Wait()
+		for _, queue := range p.queues {
+			close(queue)
+		}
+	}
+	if err := p.workers.wait(deadline); err != nil {
+		metrics.Inc("eventhub.drain.timeouts")
+		logger.Log.Warn(logger.LogPayload{
+			Message:   fmt.Sprintf("Timed out draining worker pool for partition %s of Event Hub %s with %d events queued", p.partitionId, p.hub, p.queued()),
+			Component: "Azure EventHub Consumer",
+			Operation: "DrainWorkerPool",
+			Error:     err,
+		})
+		return apperrors.Internal("events of partition "+p.partitionId+" of Event Hub "+p.hub+" were still being processed at the shutdown deadline", err)
+	}
+	logger.Log.Info(logger.LogPayload{
+		Message:   "Drained worker pool for partition " + p.partitionId + " of Event Hub " + p.hub,
+		Component: "Azure EventHub Consumer",
+		Operation: "DrainWorkerPool",
+	})
+	return nil
+}
+
+// work processes the events of the queue of a worker until the queue is closed and empty.
+func (p *workerPool) work(queue chan *eventhub.Event) {
+	for event := range queue {
+		metrics.AddGauge("eventhub.queue.depth", -1)
+		metrics.AddGauge("eventhub.workers.busy", 1)
+		p.process(event)
+		metrics.AddGauge("eventhub.workers.busy", -1)
+		metrics.Inc("eventhub.events.processed")
+	}
+}
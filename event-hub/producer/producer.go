@@ -0,0 +1,71 @@
+package producer
+
+// Package producer contains the code publishing notification action events to Event Hub.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"time"
+
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+)
+
+// Timeout for sending a single action event to Event Hub.
+const publishTimeout = 10 * time.Second
+
+// ActionPublisher publishes the notification actions triggered by users to the Event Hub configured
+// in EVENT_HUB_ACTION_EVENT_NAME, so source apps can react to the button the user clicked.
+type ActionPublisher struct {
+	hub *eventhub.Hub
+}
+
+// NewActionPublisher connects to the action Event Hub. It returns nil without an error if no action
+// Event Hub is configured.
+func NewActionPublisher() (*ActionPublisher, error) {
+	cfg := config.LoadConfig()
+	if cfg.EventHubActionEventName == "" {
+		return nil, nil
+	}
+	connectionString := fmt.Sprintf("%s;EntityPath=%s", cfg.EventHubNameSpaceConString, cfg.EventHubActionEventName)
+	hub, err := eventhub.NewHubFromConnectionString(connectionString)
+	if err != nil {
+		return nil, apperrors.DependencyUnavailable("failed to connect to action Event Hub", err)
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Message:   "Connected to action Event Hub",
+		Component: "Azure EventHub Producer",
+		Operation: "NewActionPublisher",
+	})
+	return &ActionPublisher{hub: hub}, nil
+}
+
+// Publish sends the triggered action to Event Hub, partitioned by the user ID so the actions of a user
+// are received in order.
+func (p *ActionPublisher) Publish(action data.NotificationActionTriggered) error {
+	body, err := json.Marshal(action)
+	if err != nil {
+		return apperrors.Internal("failed to encode action event", err)
+	}
+	event := eventhub.NewEvent(body)
+	event.PartitionKey = &action.UserId
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := p.hub.Send(ctx, event); err != nil {
+		metrics.Inc("eventhub.actions.failed")
+		return apperrors.DependencyUnavailable("failed to publish action event", err)
+	}
+	metrics.Inc("eventhub.actions.published")
+	return nil
+}
+
+// Close closes the connection to Event Hub.
+func (p *ActionPublisher) Close() {
+	_ = p.hub.Close(context.Background())
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+)
+
+// eventBatch records the notification changes made by the events of a batch frame, which are sent to the
+// client as a single list refresh once every event of the batch has been handled.
+type eventBatch struct {
+	refresh           bool
+	bypassStatusCheck bool
+}
+
+// deferToBatch records that the notifications of the client changed while handling an event of a batch,
+// and reports whether the event is part of a batch, in which case the change is not sent on its own.
+func (ctx eventContext) deferToBatch(bypassStatusCheck bool) bool {
+	if ctx.batch == nil {
+		return false
+	}
+	ctx.batch.refresh = true
+	ctx.batch.bypassStatusCheck = ctx.batch.bypassStatusCheck || bypassStatusCheck
+	return true
+}
+
+// handleBatch dispatches the events of a batch frame in order, like frames received one by one, except
+// that the notificationUpdated, notificationsMarkedRead, notificationDeleted and list refresh frames they
+// would send are replaced by a single list refresh at the end of the batch. Events answered with their own
+// frame, like searches, are answered as usual, and a failing event is reported with an error frame without
+// stopping the batch. Batches of more than WS_MAX_BATCH_SIZE events are rejected as a whole.
+func (h *WebSocketHandler) handleBatch(ctx eventContext, events []json.RawMessage) {
+	if len(events) > h.maxBatchSize {
+		metrics.Inc("ws.batches.rejected")
+		sendErrorToClient(ctx, "", apperrors.Validation(fmt.Sprintf("batch of %d events exceeds the limit of %d", len(events), h.maxBatchSize), nil))
+		return
+	}
+	metrics.Inc("ws.batches.received")
+	metrics.ObserveSize("ws.batches.events", int64(len(events)))
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Event Handler",
+		Operation:     "HandleBatch",
+		Message:       fmt.Sprintf("Processing batch of %d events", len(events)),
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+
+	batch := &eventBatch{}
+	ctx.batch = batch
+	for _, message := range events {
+		var event data.Event
+		if err := json.Unmarshal(message, &event); err != nil {
+			metrics.Inc("ws.events.invalid")
+			sendErrorToClient(ctx, "", apperrors.Validation("invalid event format", err))
+			continue
+		}
+		h.dispatcher.dispatch(ctx, event.Event, message)
+	}
+	if batch.refresh {
+		ctx.batch = nil
+		requestNotificationListRefresh(h.notificationService, ctx, batch.bypassStatusCheck)
+	}
+}
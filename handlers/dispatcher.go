@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	clientStore "r2-notify-server/services"
+	"r2-notify-server/tracing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// eventContext identifies the client, its tenant, the connection the event was received on and the
+// correlation ID of an event being dispatched, and holds the client store the connection is registered in.
+// The embedded context carries the span of the connection or event, and is passed on to the services.
+// batch is set while dispatching the events of a batch frame.
+type eventContext struct {
+	context.Context
+	clients       *clientStore.ClientStore
+	tenantId      string
+	clientID      string
+	conn          clientStore.Connection
+	correlationId string
+	batch         *eventBatch
+}
+
+// clientKey returns the key under which the connections of the client are stored.
+func (ctx eventContext) clientKey() string {
+	return clientStore.UserKey(ctx.tenantId, ctx.clientID)
+}
+
+// eventHandler handles a raw WebSocket event. Handlers registered with on decode and validate
+// the event payload before the typed handler runs.
+type eventHandler func(ctx eventContext, message []byte) error
+
+// eventDispatcher routes incoming WebSocket events to the handler registered for the event name.
+// Every dispatched event is counted, timed and measured under the ws.events.<event> metrics, failures
+// are logged and reported to the client as error frames, and a panicking handler is recovered so it
+// cannot close the connection.
+type eventDispatcher struct {
+	handlers map[string]eventHandler
+	validate *validator.Validate
+}
+
+func newEventDispatcher() *eventDispatcher {
+	return &eventDispatcher{
+		handlers: make(map[string]eventHandler),
+		validate: validator.New(),
+	}
+}
+
+// on registers a typed handler for the given event. The event message is unmarshalled into T and
+// validated before the handler is called; an invalid message is reported as a validation error.
+func on[T any](dispatcher *eventDispatcher, event string, handler func(ctx eventContext, payload T) error) {
+	dispatcher.handlers[event] = func(ctx eventContext, message []byte) error {
+		var payload T
+		if err := json.Unmarshal(message, &payload); err != nil {
+			return apperrors.Validation("invalid event format", err)
+		}
+		if err := dispatcher.validate.Struct(payload); err != nil {
+			return apperrors.Validation("invalid event payload", err)
+		}
+		return handler(ctx, payload)
+	}
+}
+
+// dispatch runs the handler registered for the event and reports unknown events, handler errors
+// and panics to the client as error frames. Each event is traced as a new trace linked to the span of
+// the connection, since a connection can stay open for hours; its trace ID is the correlation ID of
+// the event. The handler runs under the context of the connection, so it is cancelled when the
+// connection is closed or the server shuts down.
+func (dispatcher *eventDispatcher) dispatch(ctx eventContext, event string, message []byte) {
+	var span trace.Span
+	ctx.Context, span = tracing.Tracer().Start(ctx.Context, "websocket.event "+event,
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithLinks(trace.LinkFromContext(ctx.Context)),
+		trace.WithAttributes(
+			attribute.String("websocket.event", event),
+			attribute.String("enduser.id", ctx.clientID),
+			attribute.String("tenant.id", ctx.tenantId),
+		),
+	)
+	ctx.correlationId = tracing.CorrelationId(ctx)
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	handler, ok := dispatcher.handlers[event]
+	if !ok {
+		// Unknown event names are counted together, so clients cannot add metrics
+		err = apperrors.Validation("unknown event type: "+event, nil)
+		metrics.Inc("ws.events.unknown")
+		logger.Log.Warn(logger.LogPayload{
+			Component:     "WebSocket Event Dispatcher",
+			Operation:     "Dispatch",
+			Message:       "Unknown event type: " + event,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+		})
+		sendErrorToClient(ctx, event, err)
+		return
+	}
+
+	start := time.Now()
+	err = dispatcher.run(ctx, event, handler, message)
+	recordEvent(event, len(message), time.Since(start), err)
+	if err == nil {
+		return
+	}
+
+	logger.Log.Error(logger.LogPayload{
+		Component:     "WebSocket Event Dispatcher",
+		Operation:     "Dispatch",
+		Message:       "Failed to handle event: " + event,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+		Error:         err,
+	})
+	sendErrorToClient(ctx, event, err)
+}
+
+// run calls the handler and converts a panic into an internal error.
+func (dispatcher *eventDispatcher) run(ctx eventContext, event string, handler eventHandler, message []byte) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			metrics.Inc("ws.events." + event + ".panics")
+			err = apperrors.Internal("failed to handle event", fmt.Errorf("panic: %v", recovered))
+		}
+	}()
+	return handler(ctx, message)
+}
+
+// recordEvent records the metrics of a handled event under ws.events.<event>: the received and failed
+// counts, the failures per error kind, the handling latency and the payload size.
+func recordEvent(event string, size int, duration time.Duration, err error) {
+	prefix := "ws.events." + event
+	metrics.Inc("ws.events.received")
+	metrics.Inc(prefix + ".received")
+	metrics.Observe(prefix+".latency_ms", duration.Milliseconds())
+	metrics.ObserveSize(prefix+".payload_bytes", int64(size))
+	if err != nil {
+		metrics.Inc("ws.events.failed")
+		metrics.Inc(prefix + ".failed")
+		metrics.Inc(prefix + ".errors." + string(apperrors.KindOf(err)))
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// dispatchBlocking dispatches an event to a handler waiting for its context to be cancelled, and returns
+// the context the handler received.
+func dispatchBlocking(t *testing.T, ctx eventContext) context.Context {
+	t.Helper()
+	received := make(chan context.Context, 1)
+	dispatcher := newEventDispatcher()
+	on(dispatcher, "wait", func(ctx eventContext, _ struct{}) error {
+		received <- ctx
+		<-ctx.Done()
+		return nil
+	})
+	go dispatcher.dispatch(ctx, "wait", []byte(`{}`))
+
+	select {
+	case handlerCtx := <-received:
+		return handlerCtx
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+		return nil
+	}
+}
+
+// assertDone fails the test unless ctx is cancelled shortly.
+func assertDone(t *testing.T, ctx context.Context) {
+	t.Helper()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context of the handler was not cancelled")
+	}
+}
+
+func TestDispatchCancelsHandlerWhenConnectionCloses(t *testing.T) {
+	h := &WebSocketHandler{root: context.Background()}
+	connection, closeConnection := h.connectionContext(eventContext{Context: context.Background(), clientID: "user"})
+
+	handlerCtx := dispatchBlocking(t, connection)
+	if handlerCtx.Err() != nil {
+		t.Fatal("context of the handler was cancelled before the connection was closed")
+	}
+	closeConnection()
+	assertDone(t, handlerCtx)
+}
+
+func TestDispatchCancelsHandlerOnShutdown(t *testing.T) {
+	root, shutdown := context.WithCancel(context.Background())
+	h := &WebSocketHandler{root: root}
+	connection, closeConnection := h.connectionContext(eventContext{Context: context.Background(), clientID: "user"})
+	defer closeConnection()
+
+	handlerCtx := dispatchBlocking(t, connection)
+	shutdown()
+	assertDone(t, handlerCtx)
+}
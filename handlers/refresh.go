@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	notificationService "r2-notify-server/services/notification"
+	"sync"
+	"time"
+)
+
+// pendingRefresh is a full list refresh of a user waiting for its coalescing window to end.
+type pendingRefresh struct {
+	ctx               eventContext
+	bypassStatusCheck bool
+	timer             *time.Timer
+}
+
+var (
+	pendingRefreshes = make(map[string]*pendingRefresh)
+	refreshesMutex   sync.Mutex
+)
+
+// requestNotificationListRefresh sends the full notification list to all connections of the client, like
+// sendAllNotificationsToClient, but coalesces the refreshes requested for the same user: the list is sent once
+// LIST_REFRESH_COALESCE_MS after the first request, however many requests arrive in the meantime, so a burst of
+// reloads, resyncs and reconnects costs a single query and push. The status check is bypassed if any of the
+// coalesced requests bypassed it. A window of 0 sends every refresh immediately. Refreshes requested by the events
+// of a batch frame are deferred to the end of the batch.
+func requestNotificationListRefresh(notificationService notificationService.NotificationService, ctx eventContext, bypassStatusCheck bool) {
+	if ctx.deferToBatch(bypassStatusCheck) {
+		return
+	}
+	window := time.Duration(config.LoadConfig().ListRefreshCoalesceMs) * time.Millisecond
+	if window <= 0 {
+		sendAllNotificationsToClient(notificationService, ctx, bypassStatusCheck)
+		return
+	}
+	// The refresh outlives the event or connection request that triggered it.
+	ctx.Context = context.WithoutCancel(ctx.Context)
+	key := ctx.clientKey()
+
+	refreshesMutex.Lock()
+	defer refreshesMutex.Unlock()
+	if pending, ok := pendingRefreshes[key]; ok {
+		pending.ctx = ctx
+		pending.bypassStatusCheck = pending.bypassStatusCheck || bypassStatusCheck
+		metrics.Inc("notifications.refresh.coalesced")
+		logger.Log.Debug(logger.LogPayload{
+			Component:     "WebSocket Notification Handler",
+			Operation:     "RequestNotificationListRefresh",
+			Message:       "Coalesced notification list refresh for client: " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+		})
+		return
+	}
+	pending := &pendingRefresh{ctx: ctx, bypassStatusCheck: bypassStatusCheck}
+	pending.timer = time.AfterFunc(window, func() {
+		flushNotificationListRefresh(notificationService, key, pending)
+	})
+	pendingRefreshes[key] = pending
+}
+
+// cancelNotificationListRefresh drops the pending refresh of the client, for example when the client disabled
+// notifications and was sent an empty list instead.
+func cancelNotificationListRefresh(ctx eventContext) {
+	refreshesMutex.Lock()
+	defer refreshesMutex.Unlock()
+	if pending, ok := pendingRefreshes[ctx.clientKey()]; ok {
+		pending.timer.Stop()
+		delete(pendingRefreshes, ctx.clientKey())
+	}
+}
+
+// flushNotificationListRefresh sends the pending refresh of a user once its window ended. Users that
+// disconnected in the meantime are skipped without querying their notifications.
+func flushNotificationListRefresh(notificationService notificationService.NotificationService, key string, pending *pendingRefresh) {
+	refreshesMutex.Lock()
+	if pendingRefreshes[key] != pending {
+		refreshesMutex.Unlock()
+		return
+	}
+	delete(pendingRefreshes, key)
+	ctx, bypassStatusCheck := pending.ctx, pending.bypassStatusCheck
+	refreshesMutex.Unlock()
+
+	if !ctx.clients.IsConnected(key) {
+		metrics.Inc("notifications.refresh.skipped")
+		return
+	}
+	metrics.Inc("notifications.refresh.sent")
+	sendAllNotificationsToClient(notificationService, ctx, bypassStatusCheck)
+}
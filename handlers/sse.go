@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	clientStore "r2-notify-server/services"
+	configurationService "r2-notify-server/services/configuration"
+	notificationService "r2-notify-server/services/notification"
+	ticketService "r2-notify-server/services/ticket"
+	"r2-notify-server/tracing"
+	"r2-notify-server/utils"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// sseConnection adapts a Server-Sent Events response stream to the clientStore.Connection interface.
+// Each text message is written as a single SSE "data" frame and flushed immediately.
+type sseConnection struct {
+	writer  http.ResponseWriter
+	flusher http.Flusher
+	mutex   sync.Mutex
+	closed  bool
+	done    chan struct{}
+}
+
+// WriteMessage writes the payload as an SSE data frame. Only text messages are supported.
+func (c *sseConnection) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.TextMessage {
+		return apperrors.Internal("unsupported message type for SSE connection", nil)
+	}
+	return c.write(fmt.Sprintf("data: %s\n\n", data))
+}
+
+// Close ends the SSE stream. It is safe to call more than once.
+func (c *sseConnection) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+	return nil
+}
+
+// write writes a raw frame to the stream and flushes it to the client.
+func (c *sseConnection) write(frame string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return apperrors.Internal("SSE connection closed", nil)
+	}
+	if _, err := fmt.Fprint(c.writer, frame); err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+// NewSSEHandler creates a new HTTP handler function serving notification events over Server-Sent Events.
+// It is an alternative to the WebSocket endpoint for clients behind proxies that block WebSockets.
+// The stream is registered in clients like a WebSocket connection, so it receives the same
+// newNotification, listNotifications and listConfigurations payloads. The stream is one-way; the
+// connection is kept alive with periodic comment frames and removed from clients when the client
+// disconnects. Streams opened with a handshake ticket are redeemed with ticketService, and streams
+// without one are refused if REQUIRE_WS_TICKETS is enabled. Streams are closed when ctx, the root context
+// of the server, is cancelled, so they do not hold up the shutdown of the HTTP server.
+func NewSSEHandler(ctx context.Context, clients *clientStore.ClientStore, notificationService notificationService.NotificationService, configurationService configurationService.ConfigurationService, ticketService ticketService.TicketService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantId, clientID, err := identityFromRequest(r, ticketService, config.LoadConfig().RequireWsTickets)
+		if err != nil {
+			logger.Log.Warn(logger.LogPayload{
+				Message:   "Refused stream with invalid handshake ticket",
+				Component: "SSE",
+				Operation: "NewSSEHandler",
+				Error:     err,
+			})
+			http.Error(w, apperrors.MessageOf(err), apperrors.HTTPStatus(err))
+			return
+		}
+		if clientID == "" {
+			logger.Log.Error(logger.LogPayload{
+				Message:   "Missing user ID",
+				Component: "SSE",
+				Operation: "NewSSEHandler",
+			})
+			http.Error(w, "userId query parameter is required", http.StatusBadRequest)
+			return
+		}
+		if !utils.ValidTenantId(tenantId) {
+			logger.Log.Error(logger.LogPayload{
+				Message:   "Invalid tenant ID for client " + clientID,
+				Component: "SSE",
+				Operation: "NewSSEHandler",
+				UserId:    clientID,
+			})
+			http.Error(w, "invalid tenantId", http.StatusBadRequest)
+			return
+		}
+		clientKey := clientStore.UserKey(tenantId, clientID)
+
+		// A draining instance refuses new streams, asking the client to retry so it reaches another instance
+		if clientStore.IsDraining() {
+			metrics.Inc("connections.drain.refused")
+			w.Header().Set("Retry-After", strconv.Itoa(config.LoadConfig().DrainRetryAfterSeconds))
+			http.Error(w, "instance is draining", http.StatusServiceUnavailable)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			logger.Log.Error(logger.LogPayload{
+				Message:   "Streaming unsupported by response writer",
+				Component: "SSE",
+				Operation: "NewSSEHandler",
+				UserId:    clientID,
+			})
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		connection, span := startConnection(r, clients, "sse.connect", tenantId, clientID)
+		correlationId := connection.correlationId
+
+		configuration, err := resolveConfiguration(configurationService, connection)
+		if err != nil {
+			tracing.End(span, err)
+			http.Error(w, "failed to load configuration", apperrors.HTTPStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		conn := &sseConnection{writer: w, flusher: flusher, done: make(chan struct{})}
+
+		info := models.ClientInfo{
+			ID:                 clientKey,
+			ConnectedAt:        time.Now(),
+			EnableNotification: configuration.EnableNotification,
+			DigestWindows:      clientStore.DigestWindows(configuration.DigestApps),
+			MutedGroups:        clientStore.MutedGroups(configuration.MutedGroups),
+			ListScope:          configuration.ListScope,
+		}
+		device := deviceFromRequest(r, data.TRANSPORT_SSE)
+		if err := clients.StoreClient(info, conn, clientStore.VersionedEncoder(clientStore.JSONEncoder, device.EnvelopeVersion), device); err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component:     "SSE Redis Store",
+				Operation:     "Redis Store Client",
+				Message:       "Failed to store client in Redis for client " + clientID,
+				UserId:        clientID,
+				Error:         err,
+				CorrelationId: correlationId,
+			})
+			tracing.End(span, err)
+			return
+		}
+
+		connection.conn = conn
+
+		logger.Log.Info(logger.LogPayload{
+			Component:     "SSE Store",
+			Operation:     "SSE Store Client",
+			Message:       fmt.Sprintf("Client %s connected successfully over SSE", clientID),
+			UserId:        clientID,
+			CorrelationId: correlationId,
+		})
+
+		// Fetch and send all notifications for the client, or only the changes it missed when resuming
+		sendInitialNotificationsToClient(notificationService, connection, r.URL.Query().Get("resumeToken"), listQueryFromRequest(r, clientID))
+
+		// Send Client Configurations
+		sendConfigurationsToClient(configurationService, connection)
+		span.End()
+
+		// Keep the stream open until the client disconnects, the stream is closed or the server shuts down
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				logger.Log.Info(logger.LogPayload{
+					Component:     "SSE Store",
+					Operation:     "SSE Store Client",
+					Message:       fmt.Sprintf("Client %s disconnected from SSE", clientID),
+					UserId:        clientID,
+					CorrelationId: correlationId,
+				})
+				conn.Close()
+				clients.RemoveConnection(clientKey, conn)
+				return
+			case <-ctx.Done():
+				logger.Log.Info(logger.LogPayload{
+					Component:     "SSE Store",
+					Operation:     "SSE Store Client",
+					Message:       fmt.Sprintf("SSE stream of client %s closed by the server", clientID),
+					UserId:        clientID,
+					CorrelationId: correlationId,
+				})
+				conn.Close()
+				clients.RemoveConnection(clientKey, conn)
+				return
+			case <-conn.done:
+				clients.RemoveConnection(clientKey, conn)
+				return
+			case <-ticker.C:
+				if err := conn.write(": ping\n\n"); err != nil {
+					logger.Log.Error(logger.LogPayload{
+						Component: "SSE Ping Handler",
+						Operation: "PingHandler",
+						Message:   "Ping failed for client " + clientID,
+						UserId:    clientID,
+						Error:     err,
+					})
+					conn.Close()
+					clients.RemoveConnection(clientKey, conn)
+					return
+				}
+				clients.RefreshConnectionHeartbeat(clientKey, conn)
+			}
+		}
+	}
+}
@@ -1,267 +1,709 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"r2-notify-server/apperrors"
 	"r2-notify-server/config"
 	"r2-notify-server/data"
 	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
 	"r2-notify-server/models"
+	"r2-notify-server/protocol"
 	clientStore "r2-notify-server/services"
 	configurationService "r2-notify-server/services/configuration"
 	notificationService "r2-notify-server/services/notification"
+	originService "r2-notify-server/services/origin"
+	ticketService "r2-notify-server/services/ticket"
+	"r2-notify-server/tracing"
 	"r2-notify-server/utils"
 	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var upgrader = websocket.Upgrader{}
-var allowedOrigins []string
+// allowedOrigins holds the origins allowed to open WebSocket connections. It is replaced by SetAllowedOrigins
+// when the configuration is reloaded.
+var allowedOrigins atomic.Pointer[[]string]
 
-// NewWebSocketHandler creates a new HTTP handler function for handling WebSocket connections.
-// It upgrades HTTP connections to WebSocket connections, validates request origins, and manages
-// client connections by storing them in the client store. The handler retrieves or creates
-// notification configurations for clients, sends notifications and configurations to clients,
-// and listens for incoming WebSocket messages to handle various client events. If a connection
-// error occurs or the client disconnects, the connection is closed and removed from the client store.
-func NewWebSocketHandler(notificationService notificationService.NotificationService, configurationService configurationService.ConfigurationService) http.HandlerFunc {
+// SetAllowedOrigins replaces the allowed origins with the comma separated list of origins.
+func SetAllowedOrigins(origins string) {
+	processed := utils.ProcessAllowedOrigins(origins)
+	allowedOrigins.Store(&processed)
+}
+
+// newUpgrader returns the WebSocket upgrader of the handler, with the I/O buffer sizes configured by
+// WS_READ_BUFFER_SIZE and WS_WRITE_BUFFER_SIZE. Connections are accepted from the origins allowed by allowWebSocketOrigin.
+func newUpgrader(cfg *config.Config, originService originService.OriginService) Upgrader {
+	return gorillaUpgrader{upgrader: &websocket.Upgrader{
+		ReadBufferSize:  cfg.WebSocketReadBufferSize,
+		WriteBufferSize: cfg.WebSocketWriteBufferSize,
+		Subprotocols:    []string{data.FORMAT_MSGPACK, data.FORMAT_JSON},
+		CheckOrigin: func(r *http.Request) bool {
+			return allowWebSocketOrigin(originService, r)
+		},
+	}}
+}
+
+// AllowedOrigins returns the origins currently allowed to connect.
+func AllowedOrigins() []string {
+	if origins := allowedOrigins.Load(); origins != nil {
+		return *origins
+	}
+	return nil
+}
+
+// IsAllowedOrigin reports whether CORS requests from the origin are allowed. Unlike WebSocket connections,
+// CORS requests are allowed from every origin when the allowed origins contain "*".
+func IsAllowedOrigin(origin string) bool {
+	origins := AllowedOrigins()
+	return slices.Contains(origins, "*") || matchesOrigin(origins, origin)
+}
+
+// matchesOrigin reports whether the origin matches one of the allowed origins, which may be wildcard
+// patterns such as https://*.example.com.
+func matchesOrigin(origins []string, origin string) bool {
+	return slices.ContainsFunc(origins, func(pattern string) bool { return utils.MatchOrigin(pattern, origin) })
+}
+
+// allowWebSocketOrigin reports whether a WebSocket connection may be opened from the origin of the request.
+// Origins matching ALLOWED_ORIGINS are always allowed; other origins are allowed if they match the
+// allow-list of the app given by the appId query parameter.
+func allowWebSocketOrigin(originService originService.OriginService, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if matchesOrigin(AllowedOrigins(), origin) {
+		return true
+	}
+	appId := r.URL.Query().Get("appId")
+	return appId != "" && originService.IsAllowed(appId, origin)
+}
+
+// Time allowed to read the next pong from the client; each pong extends the read deadline by this much.
+const pongWait = 60 * time.Second
+
+// Interval at which the handler pings its connections, shorter than pongWait so a live client answers in time.
+const pingInterval = 30 * time.Second
+
+// Deadline for writing a ping, after which the connection is considered dead.
+const pingWriteWait = 10 * time.Second
+
+// WebSocketDependencies are the collaborators of the WebSocket handler that tests replace with fakes.
+type WebSocketDependencies struct {
+	Context  context.Context          // root context of the server, cancelled on shutdown
+	Clients  *clientStore.ClientStore // client store the frames of the connections are sent through
+	Registry ClientRegistry
+	Clock    Clock
+	Upgrader Upgrader
+	Tickets  ticketService.TicketService
+}
+
+// WebSocketHandler handles WebSocket connections. It upgrades HTTP connections to WebSocket connections,
+// validates request origins, and manages client connections by registering them in the ClientRegistry.
+// The handler retrieves or creates notification configurations for clients, sends notifications and
+// configurations to clients, and listens for incoming WebSocket messages to handle various client events.
+// If a connection error occurs or the client disconnects, the connection is closed and removed from the
+// registry. Clients can opt in to MessagePack frames with the "msgpack" subprotocol or the format=msgpack
+// query parameter; JSON is used otherwise. Clients passing the appId query parameter may also connect from
+// the origins allowed for that app.
+type WebSocketHandler struct {
+	notificationService  notificationService.NotificationService
+	configurationService configurationService.ConfigurationService
+	dispatcher           *eventDispatcher
+	clients              *clientStore.ClientStore
+	registry             ClientRegistry
+	clock                Clock
+	upgrader             Upgrader
+	tickets              ticketService.TicketService
+	requireTickets       bool
+	maxMessageSize       int64
+	maxBatchSize         int
+	root                 context.Context // cancelled when the server shuts down
+}
+
+// NewWebSocketHandler returns a WebSocketHandler registering connections in the given client store, with the
+// upgrader and message size limit configured in cfg, redeeming handshake tickets with ticketService.
+// Connections are closed when ctx, the root context of the server, is cancelled.
+func NewWebSocketHandler(ctx context.Context, cfg *config.Config, clients *clientStore.ClientStore, notificationService notificationService.NotificationService, configurationService configurationService.ConfigurationService, originService originService.OriginService, ticketService ticketService.TicketService) *WebSocketHandler {
+	return NewWebSocketHandlerWithDependencies(cfg, notificationService, configurationService, WebSocketDependencies{
+		Context:  ctx,
+		Clients:  clients,
+		Registry: ClientStoreRegistry(clients),
+		Clock:    SystemClock(),
+		Upgrader: newUpgrader(cfg, originService),
+		Tickets:  ticketService,
+	})
+}
+
+// NewWebSocketHandlerWithDependencies returns a WebSocketHandler with the given root context, client store,
+// registry, clock, upgrader and ticket service. Connections without a handshake ticket are refused if
+// REQUIRE_WS_TICKETS is enabled in cfg. A nil root context is never cancelled.
+func NewWebSocketHandlerWithDependencies(cfg *config.Config, notificationService notificationService.NotificationService, configurationService configurationService.ConfigurationService, dependencies WebSocketDependencies) *WebSocketHandler {
+	root := dependencies.Context
+	if root == nil {
+		root = context.Background()
+	}
+	return &WebSocketHandler{
+		notificationService:  notificationService,
+		configurationService: configurationService,
+		dispatcher:           newWebSocketDispatcher(notificationService, configurationService),
+		clients:              dependencies.Clients,
+		registry:             dependencies.Registry,
+		clock:                dependencies.Clock,
+		upgrader:             dependencies.Upgrader,
+		tickets:              dependencies.Tickets,
+		requireTickets:       cfg.RequireWsTickets,
+		maxMessageSize:       int64(cfg.WebSocketMaxMessageSize),
+		maxBatchSize:         cfg.WebSocketMaxBatchSize,
+		root:                 root,
+	}
+}
+
+// ServeHTTP upgrades the request and registers the connection. Events of the client are then read and
+// dispatched by readEvents, while keepAlive pings the client, until the connection is closed. Every
+// connection has its own context, derived from the root context of the handler and cancelled when the
+// connection is closed or the server shuts down; closeWhenDone then removes and closes the connection, so
+// each of these goroutines and the writer of the connection's send queue exit.
+func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := h.clock.Now()
+	conn, err := h.upgrader.Upgrade(w, r)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Message:   "Upgrade error, origin not allowed. Allowed origins: " + fmt.Sprint(AllowedOrigins()) + ". Received Origin: " + r.Header.Get("Origin"),
+			Component: "WebSocket",
+			Operation: "NewWebSocketHandler",
+			AppId:     r.URL.Query().Get("appId"),
+			Error:     err,
+		})
+		h.logHandshake(w, r, start, data.HANDSHAKE_UPGRADE_FAILED, "", tracing.CorrelationId(r.Context()))
+		return
+	}
+
+	tenantId, clientID, err := identityFromRequest(r, h.tickets, h.requireTickets)
+	if err != nil {
+		reason := h.refuseTicket(conn, err)
+		h.logHandshake(w, r, start, reason, "", tracing.CorrelationId(r.Context()))
+		return
+	}
+	if clientID == "" {
+		logger.Log.Error(logger.LogPayload{
+			Message:   "Missing user ID",
+			Component: "WebSocket",
+			Operation: "NewWebSocketHandler",
+		})
+		conn.Close()
+		h.logHandshake(w, r, start, data.HANDSHAKE_MISSING_USER, "", tracing.CorrelationId(r.Context()))
+		return
+	}
+	if !utils.ValidTenantId(tenantId) {
+		logger.Log.Error(logger.LogPayload{
+			Message:   "Invalid tenant ID for client " + clientID,
+			Component: "WebSocket",
+			Operation: "NewWebSocketHandler",
+			UserId:    clientID,
+		})
+		conn.Close()
+		h.logHandshake(w, r, start, data.HANDSHAKE_INVALID_TENANT, clientID, tracing.CorrelationId(r.Context()))
+		return
+	}
+	clientKey := clientStore.UserKey(tenantId, clientID)
+	connection, span := startConnection(r, h.clients, "websocket.connect", tenantId, clientID)
+	defer span.End()
+	correlationId := connection.correlationId
+	connection, cancel := h.connectionContext(connection)
+
+	// Negotiate the wire format, preferring the subprotocol over the query parameter
+	format := conn.Subprotocol()
+	if format == "" {
+		format = r.URL.Query().Get("format")
+	}
+	// Frames are wrapped in the envelope version requested by the client
+	device := deviceFromRequest(r, data.TRANSPORT_WEBSOCKET)
+	device.ConnectedAt = h.clock.Now()
+	encoder := clientStore.VersionedEncoder(clientStore.EncoderFor(format), device.EnvelopeVersion)
+
+	// A draining instance refuses new connections, asking the client to retry so it reaches another instance
+	if clientStore.IsDraining() {
+		cancel()
+		h.refuseDraining(conn, encoder, clientID, correlationId)
+		h.logHandshake(w, r, start, data.SERVER_DRAINING, clientID, correlationId)
+		return
+	}
+
+	// Frames larger than the limit are rejected before they are buffered; the connection is then closed
+	// with 1009 (message too big)
+	conn.SetReadLimit(h.maxMessageSize)
+
+	// Set pong handler to keep connection alive
+	conn.SetReadDeadline(h.clock.Now().Add(pongWait)) // initial deadline
+	conn.SetPongHandler(func(string) error {
+		logger.Log.Debug(logger.LogPayload{
+			Component: "WebSocket Pong Handler",
+			Operation: "SetPongHandler",
+			Message:   "Pong received from client " + clientID,
+			UserId:    clientID,
+		})
+		conn.SetReadDeadline(h.clock.Now().Add(pongWait)) // reset on pong
+		h.registry.RefreshConnectionHeartbeat(clientKey, conn)
+		return nil
+	})
+
+	// Ping the client until the connection is closed
+	go h.keepAlive(connection, cancel, conn)
 
-	origins := config.LoadConfig().AllowedOrigins
-	allowedOrigins = utils.ProcessAllowedOrigins(origins)
+	// Handle Enable Notification Configuration
+	configuration, err := resolveConfiguration(h.configurationService, connection)
+	if err != nil {
+		span.RecordError(err)
+		// Tell the client why the connection is refused, so it can retry later instead of reconnecting at once
+		closeFrame := websocket.FormatCloseMessage(data.SERVICE_UNAVAILABLE_CLOSE, data.SERVICE_UNAVAILABLE)
+		_ = conn.WriteControl(websocket.CloseMessage, closeFrame, h.clock.Now().Add(time.Second))
+		conn.Close()
+		cancel()
+		h.logHandshake(w, r, start, data.SERVICE_UNAVAILABLE, clientID, correlationId)
+		return
+	}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		upgrader.CheckOrigin = func(r *http.Request) bool {
-			origin := r.Header.Get("Origin")
-			return slices.Contains(allowedOrigins, origin)
+	info := models.ClientInfo{
+		ID:                 clientKey,
+		ConnectedAt:        h.clock.Now(),
+		EnableNotification: configuration.EnableNotification,
+		DigestWindows:      clientStore.DigestWindows(configuration.DigestApps),
+		MutedGroups:        clientStore.MutedGroups(configuration.MutedGroups),
+		ListScope:          configuration.ListScope,
+	}
+
+	if err := h.registry.StoreClient(info, conn, encoder, device); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Redis Store",
+			Operation:     "Redis Store Client",
+			Message:       "Failed to store client in Redis for client " + clientID,
+			UserId:        clientID,
+			Error:         err,
+			CorrelationId: correlationId,
+		})
+		span.RecordError(err)
+		conn.Close()
+		cancel()
+		h.logHandshake(w, r, start, data.HANDSHAKE_STORE_FAILED, clientID, correlationId)
+		return
+	}
+
+	connection.conn = conn
+	h.logHandshake(w, r, start, data.HANDSHAKE_ACCEPTED, clientID, correlationId)
+
+	logger.Log.Info(logger.LogPayload{
+		Component:     "WebSocket Websocket Store",
+		Operation:     "WebSocket Store Client",
+		Message:       fmt.Sprintf("Client %s connected successfully using %s", clientID, encoder.Format()),
+		UserId:        clientID,
+		CorrelationId: correlationId,
+	})
+
+	// Clients opting in with the welcome parameter receive their starting state in a single connected frame first
+	welcomed := r.URL.Query().Get("welcome") == "true" && sendWelcomeToClient(h.notificationService, connection, device.ConnectionId, configuration)
+
+	// Fetch and send all notifications for the client, or only the changes it missed when resuming
+	sendInitialNotificationsToClient(h.notificationService, connection, r.URL.Query().Get("resumeToken"), listQueryFromRequest(r, clientID))
+
+	// Send Client Configurations, unless the connected frame already carried them
+	if !welcomed {
+		sendConfigurationsToClient(h.configurationService, connection)
+	}
+
+	// Connection close if client disconnect or error occurs, or the server shuts down
+	go h.closeWhenDone(connection, conn)
+	go h.readEvents(connection, cancel, conn, encoder)
+}
+
+// connectionContext returns the context of a new connection, carrying the values and span of ctx, with the
+// function cancelling it. The context is cancelled as well when the root context of the handler is.
+func (h *WebSocketHandler) connectionContext(ctx eventContext) (eventContext, context.CancelFunc) {
+	var cancel context.CancelFunc
+	ctx.Context, cancel = context.WithCancel(ctx.Context)
+	stop := context.AfterFunc(h.root, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// closeWhenDone waits for the context of a registered connection to be cancelled, then removes the connection
+// from the registry, which stops the writer of its send queue, and closes it, which ends readEvents. When the
+// server is shutting down, the client is first sent a close frame with the serverShutdown reason.
+func (h *WebSocketHandler) closeWhenDone(ctx eventContext, conn WebSocketConn) {
+	<-ctx.Done()
+	if h.root.Err() != nil {
+		closeFrame := websocket.FormatCloseMessage(data.SERVER_SHUTDOWN_CLOSE, data.SERVER_SHUTDOWN)
+		_ = conn.WriteControl(websocket.CloseMessage, closeFrame, h.clock.Now().Add(time.Second))
+		logger.Log.Debug(logger.LogPayload{
+			Component:     "WebSocket",
+			Operation:     "CloseWhenDone",
+			Message:       "Closing connection of client " + ctx.clientID + " on shutdown",
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+		})
+	}
+	h.registry.RemoveConnection(ctx.clientKey(), conn)
+	conn.Close()
+}
+
+// refuseDraining sends the reconnectRequested event with the delay the client should wait before
+// reconnecting, then closes the connection with the serverDraining reason.
+func (h *WebSocketHandler) refuseDraining(conn WebSocketConn, encoder clientStore.Encoder, clientID string, correlationId string) {
+	metrics.Inc("connections.drain.refused")
+	logger.Log.Info(logger.LogPayload{
+		Component:     "WebSocket",
+		Operation:     "NewWebSocketHandler",
+		Message:       "Refused connection of client " + clientID + " while draining",
+		UserId:        clientID,
+		CorrelationId: correlationId,
+	})
+	if frame, err := encoder.Marshal(clientStore.ReconnectRequest(true)); err == nil {
+		_ = conn.WriteMessage(encoder.MessageType(), frame)
+	}
+	closeFrame := websocket.FormatCloseMessage(data.SERVER_DRAINING_CLOSE, data.SERVER_DRAINING)
+	_ = conn.WriteControl(websocket.CloseMessage, closeFrame, h.clock.Now().Add(time.Second))
+	conn.Close()
+}
+
+// refuseTicket closes a connection whose handshake ticket was refused with the invalidTicket reason, or with
+// the serviceUnavailable reason if the ticket could not be checked, so the client can retry later.
+// Returns the close reason.
+func (h *WebSocketHandler) refuseTicket(conn WebSocketConn, err error) string {
+	logger.Log.Warn(logger.LogPayload{
+		Component: "WebSocket",
+		Operation: "NewWebSocketHandler",
+		Message:   "Refused connection with invalid handshake ticket",
+		Error:     err,
+	})
+	code, reason := data.INVALID_TICKET_CLOSE, data.INVALID_TICKET
+	if apperrors.Is(err, apperrors.KindDependencyUnavailable) {
+		code, reason = data.SERVICE_UNAVAILABLE_CLOSE, data.SERVICE_UNAVAILABLE
+	}
+	closeFrame := websocket.FormatCloseMessage(code, reason)
+	_ = conn.WriteControl(websocket.CloseMessage, closeFrame, h.clock.Now().Add(time.Second))
+	conn.Close()
+	return reason
+}
+
+// logHandshake logs the access record of a WebSocket handshake started at start with the given outcome, through
+// the structured logger like the access records of HTTP requests. Upgraded connections are logged with status
+// 101 whatever their outcome, and failed upgrades with the status written by the upgrader. Handshakes that were
+// not accepted are logged as warnings.
+func (h *WebSocketHandler) logHandshake(w http.ResponseWriter, r *http.Request, start time.Time, outcome string, userId string, correlationId string) {
+	status := http.StatusSwitchingProtocols
+	if outcome == data.HANDSHAKE_UPGRADE_FAILED {
+		status = http.StatusBadRequest
+		if recorder, ok := w.(interface{ Status() int }); ok {
+			status = recorder.Status()
 		}
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			logger.Log.Error(logger.LogPayload{
-				Message:   "Upgrade error, origin not allowed. Allowed origins: " + fmt.Sprint(allowedOrigins) + ". Received Origin: " + r.Header.Get("Origin"),
-				Component: "WebSocket",
-				Operation: "NewWebSocketHandler",
-				Error:     err,
-			})
+	}
+	payload := logger.LogPayload{
+		Component:     "Access Log",
+		Operation:     "WebSocketHandshake",
+		Message:       r.Method + " " + r.URL.Path + " " + outcome,
+		CorrelationId: correlationId,
+		UserId:        userId,
+		AppId:         r.URL.Query().Get("appId"),
+		Access: &logger.Access{
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Status:   status,
+			Latency:  h.clock.Now().Sub(start),
+			ClientIP: utils.ClientIP(r),
+			Outcome:  outcome,
+		},
+	}
+	if outcome == data.HANDSHAKE_ACCEPTED {
+		logger.Log.Info(payload)
+	} else {
+		logger.Log.Warn(payload)
+	}
+}
+
+// keepAlive pings the client every pingInterval until the context of the connection is cancelled. If a ping
+// cannot be written, the context is cancelled, closing the connection.
+func (h *WebSocketHandler) keepAlive(ctx eventContext, cancel context.CancelFunc, conn WebSocketConn) {
+	ticker := h.clock.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C():
 		}
-
-		clientID := r.URL.Query().Get("userId")
-		if clientID == "" {
+		logger.Log.Debug(logger.LogPayload{
+			Component: "WebSocket Ping Handler",
+			Operation: "SetPongHandler",
+			Message:   "Ping sent to client " + ctx.clientID,
+			UserId:    ctx.clientID,
+		})
+		// Pings are written as control frames, which may be written concurrently with the send queue's writer
+		if err := conn.WriteControl(websocket.PingMessage, nil, h.clock.Now().Add(pingWriteWait)); err != nil {
 			logger.Log.Error(logger.LogPayload{
-				Message:   "Missing user ID",
-				Component: "WebSocket",
-				Operation: "NewWebSocketHandler",
+				Component: "WebSocket Pong Handler",
+				Operation: "PingHandler",
+				Message:   "Ping failed for client " + ctx.clientID,
+				UserId:    ctx.clientID,
 				Error:     err,
 			})
-			conn.Close()
+			cancel()
 			return
 		}
+	}
+}
 
-		// Set pong handler to keep connection alive
-		conn.SetReadDeadline(time.Now().Add(60 * time.Second)) // initial deadline
-		conn.SetPongHandler(func(string) error {
-			logger.Log.Debug(logger.LogPayload{
-				Component: "WebSocket Pong Handler",
-				Operation: "SetPongHandler",
-				Message:   "Pong received from client " + clientID,
-				UserId:    clientID,
+// readEvents reads the events of the client and dispatches them until reading fails, because the client
+// disconnected or the connection was closed, then cancels the context of the connection.
+func (h *WebSocketHandler) readEvents(ctx eventContext, cancel context.CancelFunc, conn WebSocketConn, encoder clientStore.Encoder) {
+	defer cancel()
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if errors.Is(err, websocket.ErrReadLimit) {
+			metrics.Inc("ws.messages.too_large")
+			logger.Log.Warn(logger.LogPayload{
+				Component:     "WebSocket Event Handler",
+				Operation:     "ReadMessage",
+				Message:       fmt.Sprintf("Client %s sent a message larger than %d bytes, closing connection", ctx.clientID, h.maxMessageSize),
+				UserId:        ctx.clientID,
+				CorrelationId: ctx.correlationId,
+				Error:         err,
 			})
-			conn.SetReadDeadline(time.Now().Add(60 * time.Second)) // reset on pong
-			return nil
-		})
-
-		// Start pinging client every 30 seconds
-		go func() {
-			ticker := time.NewTicker(30 * time.Second)
-			defer ticker.Stop()
-			for {
-				<-ticker.C
-				logger.Log.Debug(logger.LogPayload{
-					Component: "WebSocket Ping Handler",
-					Operation: "SetPongHandler",
-					Message:   "Ping sent to client " + clientID,
-					UserId:    clientID,
-				})
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					logger.Log.Error(logger.LogPayload{
-						Component: "WebSocket Pong Handler",
-						Operation: "PingHandler",
-						Message:   "Ping failed for client " + clientID,
-						UserId:    clientID,
-						Error:     err,
-					})
-					clientStore.RemoveConnection(clientID, conn)
-					return
-				}
-			}
-		}()
-
-		// Generate correlation ID
-		correlationId := utils.GenerateUUID()
-
-		// Handle Enable Notification Configuration
-		isEnableNotification := true
-		logger.Log.Info(logger.LogPayload{
-			Component:     "WebSocket Configuration Handler",
-			Operation:     "User Configuration Fetch",
-			Message:       "Fetching configuration for client " + clientID,
-			UserId:        clientID,
-			CorrelationId: correlationId,
-		})
-		configuration, err := configurationService.FindByAppAndUser(clientID)
+		}
 		if err != nil {
-			_, err = configurationService.Create(models.Configuration{
-				UserId:              clientID,
-				EnableNotifications: isEnableNotification,
-			})
+			message := fmt.Sprintf("Client %s disconnected", ctx.clientID)
+			if ctx.Err() != nil {
+				message = fmt.Sprintf("Connection of client %s closed by the server", ctx.clientID)
+			}
 			logger.Log.Info(logger.LogPayload{
-				Component:     "WebSocket Configuration Handler",
-				Operation:     "User Configuration Create",
-				Message:       "Creating configuration for client " + clientID,
-				UserId:        clientID,
-				CorrelationId: correlationId,
+				Component:     "WebSocket Websocket Store",
+				Operation:     "WebSocket Store Client",
+				Message:       message,
+				UserId:        ctx.clientID,
+				CorrelationId: ctx.correlationId,
 			})
-			if err != nil {
-				logger.Log.Error(logger.LogPayload{
-					Component:     "WebSocket Configuration Handler",
-					Operation:     "User Configuration Create",
-					Message:       "Failed to create configuration for client " + clientID,
-					Error:         err,
-					UserId:        clientID,
-					CorrelationId: correlationId,
-				})
-				conn.Close()
-				return
-			}
-		} else {
-			isEnableNotification = configuration.Data.EnableNotification
+			return
 		}
+		h.handleMessage(ctx, conn, encoder, messageType, message)
+	}
+}
 
-		info := models.ClientInfo{
-			ID:                 clientID,
-			ConnectedAt:        time.Now(),
-			EnableNotification: isEnableNotification,
-		}
+// handleMessage decodes a data frame of the client and dispatches the event it carries. Control frames
+// and empty messages are ignored; invalid events are answered with an error event.
+func (h *WebSocketHandler) handleMessage(ctx eventContext, conn WebSocketConn, encoder clientStore.Encoder, messageType int, message []byte) {
+	// Skip control messages (ping, pong, close)
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		return
+	}
 
-		if err := clientStore.StoreClient(info, conn); err != nil {
+	// Skip empty messages
+	if len(message) == 0 {
+		return
+	}
+	h.registry.TouchConnection(conn)
+
+	// Convert binary events to JSON so the event actions are format agnostic
+	if messageType == websocket.BinaryMessage {
+		var err error
+		message, err = toJSON(encoder, message)
+		if err != nil {
+			metrics.Inc("ws.events.invalid")
 			logger.Log.Error(logger.LogPayload{
-				Component:     "WebSocket Redis Store",
-				Operation:     "Redis Store Client",
-				Message:       "Failed to store client in Redis for client " + clientID,
-				UserId:        clientID,
+				Component:     "WebSocket Event Handler",
+				Operation:     "DecodeEvent",
+				Message:       "Invalid " + encoder.Format() + " event",
 				Error:         err,
-				CorrelationId: correlationId,
+				UserId:        ctx.clientID,
+				CorrelationId: ctx.correlationId,
 			})
-			conn.Close()
+			sendErrorToClient(ctx, "", apperrors.Validation("invalid event format", err))
 			return
 		}
+	}
 
-		logger.Log.Info(logger.LogPayload{
-			Component:     "WebSocket Websocket Store",
-			Operation:     "WebSocket Store Client",
-			Message:       fmt.Sprintf("Client %s connected successfully", clientID),
+	// Parse events
+	var event data.Event
+	if err := json.Unmarshal(message, &event); err != nil {
+		metrics.Inc("ws.events.invalid")
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Event Handler",
+			Operation:     "ParseEvent",
+			Message:       "Invalid event format",
+			Error:         err,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+		})
+		sendErrorToClient(ctx, "", apperrors.Validation("invalid event format", err))
+		return
+	}
+	if event.Event == "" {
+		var batch data.EventBatch
+		if err := json.Unmarshal(message, &batch); err == nil && batch.Events != nil {
+			h.handleBatch(ctx, batch.Events)
+			return
+		}
+	}
+
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Event Handler",
+		Operation:     "HandleEvent",
+		Message:       "Processing event: " + event.Event,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+
+	h.dispatcher.dispatch(ctx, event.Event, message)
+}
+
+// resolveConfiguration fetches the notification configuration of the given client of the tenant. If the client has
+// no configuration yet, a configuration with notifications enabled is created atomically, so concurrent
+// connections of a new user share a single configuration. Returns an error if the configuration cannot be fetched or created.
+func resolveConfiguration(configurationService configurationService.ConfigurationService, ctx eventContext) (data.NotificationConfig, error) {
+	tenantId, clientID, correlationId := ctx.tenantId, ctx.clientID, ctx.correlationId
+	logger.Log.Info(logger.LogPayload{
+		Component:     "WebSocket Configuration Handler",
+		Operation:     "User Configuration Fetch",
+		Message:       "Fetching configuration for client " + clientID,
+		UserId:        clientID,
+		CorrelationId: correlationId,
+	})
+	configuration, err := configurationService.GetOrCreate(ctx, models.Configuration{
+		TenantId:            tenantId,
+		UserId:              clientID,
+		EnableNotifications: true,
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Configuration Handler",
+			Operation:     "User Configuration Fetch",
+			Message:       "Failed to fetch or create configuration for client " + clientID,
+			Error:         err,
 			UserId:        clientID,
 			CorrelationId: correlationId,
 		})
+		return data.NotificationConfig{}, err
+	}
+	return configuration.Data, nil
+}
 
-		// Fetch and send all notifications for the client
-		sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
-
-		// Send Client Configurations
-		sendConfigurationsToClient(configurationService, clientID, correlationId)
-
-		// Connection close if client disconnect or error occurs
-		go func() {
-			defer conn.Close()
-			for {
-				messageType, message, err := conn.ReadMessage()
-				if err != nil {
-					logger.Log.Info(logger.LogPayload{
-						Component:     "WebSocket Websocket Store",
-						Operation:     "WebSocket Store Client",
-						Message:       fmt.Sprintf("Client %s disconnected", clientID),
-						UserId:        clientID,
-						CorrelationId: correlationId,
-					})
-					clientStore.RemoveConnection(clientID, conn)
-					break
-				}
-
-				// Skip control messages (ping, pong, close)
-				if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
-					continue
-				}
-
-				// Skip empty messages
-				if len(message) == 0 {
-					continue
-				}
-
-				// Parse events
-				var event data.Event
-				if err := json.Unmarshal(message, &event); err != nil {
-					logger.Log.Error(logger.LogPayload{
-						Component:     "WebSocket Event Handler",
-						Operation:     "ParseEvent",
-						Message:       "Invalid event format",
-						Error:         err,
-						UserId:        clientID,
-						CorrelationId: correlationId,
-					})
-					continue
-				}
-
-				logger.Log.Debug(logger.LogPayload{
-					Component:     "WebSocket Event Handler",
-					Operation:     "HandleEvent",
-					Message:       "Processing event: " + event.Event,
-					UserId:        clientID,
-					CorrelationId: correlationId,
-				})
-
-				// Handle events
-				switch event.Event {
-				// Mark as Read Events
-				case data.MARK_AS_READ:
-					markAsReadAction(notificationService, clientID, correlationId)
-				case data.MARK_APP_AS_READ:
-					markAppReadAction(message, notificationService, clientID, correlationId)
-				case data.MARK_GROUP_AS_READ:
-					markGroupAsReadAction(message, notificationService, clientID, correlationId)
-				case data.MARK_NOTIFICATION_AS_READ:
-					markNotificationAsReadAction(message, notificationService, clientID, correlationId)
-
-				// Delete Events
-				case data.DELETE_NOTIFICATIONS:
-					deleteNotificationsAction(notificationService, clientID, correlationId)
-				case data.DELETE_APP_NOTIFICATIONS:
-					deleteAppNotificationsAction(message, notificationService, clientID, correlationId)
-				case data.DELETE_GROUP_NOTIFICATIONS:
-					deleteGroupNotificationAction(message, notificationService, clientID, correlationId)
-				case data.DELETE_NOTIFICATION:
-					deleteNotificationAction(message, notificationService, clientID, correlationId)
-
-				// Other Events
-				case data.RELOAD_NOTIFICATIONS:
-					sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
-				case data.SET_NOTIFICATION_STATUS:
-					setNotificationStatusAction(message, configurationService, notificationService, clientID, correlationId)
-				default:
-					fmt.Printf("Unknown event -----------------> %+v\n", event)
-					logger.Log.Warn(logger.LogPayload{
-						Component:     "WebSocket Event Handler",
-						Operation:     "HandleEvent",
-						Message:       "Unknown event type: " + event.Event,
-						UserId:        clientID,
-						CorrelationId: correlationId,
-					})
-				}
-			}
-		}()
+// startConnection starts the span of a new connection, which covers loading the configuration of the client
+// and sending the initial notifications, and returns the context for the connection, registered in clients.
+// The trace ID of the span is the correlation ID of the connection. The context outlives the handshake
+// request, since the events of the connection are linked to the span.
+func startConnection(r *http.Request, clients *clientStore.ClientStore, name string, tenantId string, clientID string) (eventContext, trace.Span) {
+	ctx, span := tracing.Start(context.WithoutCancel(r.Context()), name, trace.SpanKindInternal,
+		attribute.String("enduser.id", clientID),
+		attribute.String("tenant.id", tenantId),
+	)
+	return eventContext{Context: ctx, clients: clients, tenantId: tenantId, clientID: clientID, correlationId: tracing.CorrelationId(ctx)}, span
+}
+
+// tenantFromRequest returns the tenant of a new connection, given by the tenantId query parameter or the
+// X-Tenant-ID header. Connections without a tenant belong to the default tenant.
+func tenantFromRequest(r *http.Request) string {
+	if tenantId := r.URL.Query().Get("tenantId"); tenantId != "" {
+		return tenantId
+	}
+	return r.Header.Get("X-Tenant-ID")
+}
+
+// identityFromRequest returns the tenant and user of a new connection. A connection presenting the ticket
+// query parameter belongs to the user the ticket was issued for and consumes the ticket; a userId or tenant
+// given alongside must match it. Otherwise the user is given by the userId query parameter and the tenant by
+// tenantFromRequest, unless requireTickets is set. Returns an unauthorized error if the ticket is refused, or
+// missing while required.
+func identityFromRequest(r *http.Request, tickets ticketService.TicketService, requireTickets bool) (string, string, error) {
+	ticket := r.URL.Query().Get("ticket")
+	if ticket == "" {
+		if requireTickets {
+			return "", "", apperrors.Unauthorized("a handshake ticket is required")
+		}
+		return tenantFromRequest(r), r.URL.Query().Get("userId"), nil
+	}
+	if tickets == nil {
+		return "", "", apperrors.Unauthorized("WebSocket tickets are not enabled")
+	}
+	claims, err := tickets.Redeem(ticket)
+	if err != nil {
+		return "", "", err
+	}
+	if userId := r.URL.Query().Get("userId"); userId != "" && userId != claims.UserId {
+		return "", "", apperrors.Unauthorized("ticket was issued for another user")
+	}
+	if tenantId := tenantFromRequest(r); tenantId != "" && tenantId != claims.TenantId {
+		return "", "", apperrors.Unauthorized("ticket was issued for another tenant")
+	}
+	return claims.TenantId, claims.UserId, nil
+}
+
+// deviceFromRequest captures the metadata of a new connection from the handshake request: the
+// client-supplied deviceId query parameter, the User-Agent and derived device type, the client IP, the
+// envelope version requested with the v query parameter and whether the client accepts notification lists in
+// chunks, with chunkedLists=true. Each connection is assigned a unique connection ID,
+// so devices without a deviceId can be targeted too.
+func deviceFromRequest(r *http.Request, transport string) models.DeviceInfo {
+	userAgent := r.UserAgent()
+	return models.DeviceInfo{
+		ConnectionId:    utils.GenerateUUID(),
+		DeviceId:        r.URL.Query().Get("deviceId"),
+		DeviceType:      utils.DeviceType(userAgent),
+		AppId:           r.URL.Query().Get("appId"),
+		UserAgent:       userAgent,
+		IP:              utils.ClientIP(r),
+		Transport:       transport,
+		ConnectedAt:     time.Now(),
+		EnvelopeVersion: clientStore.EnvelopeVersion(r.URL.Query().Get("v")),
+		ChunkedLists:    r.URL.Query().Get("chunkedLists") == "true",
+	}
+}
+
+// listQueryFromRequest reads the filters of the initial notification list from the handshake request: include=read
+// adds read notifications, since=<RFC 3339 time> keeps notifications created at or after that time and limit=<n> keeps
+// the n newest. Invalid values are logged and ignored, so a client with a bad filter still receives its unread list.
+func listQueryFromRequest(r *http.Request, clientID string) data.NotificationListQuery {
+	var query data.NotificationListQuery
+	params := r.URL.Query()
+	for _, include := range strings.Split(params.Get("include"), ",") {
+		if strings.TrimSpace(include) == data.INCLUDE_READ {
+			query.IncludeRead = true
+		}
+	}
+	if since := params.Get("since"); since != "" {
+		if parsed, err := time.Parse(time.RFC3339, since); err == nil {
+			query.Since = &parsed
+		} else {
+			logger.Log.Warn(logger.LogPayload{
+				Component: "WebSocket",
+				Operation: "ListQueryFromRequest",
+				Message:   "Ignoring invalid since parameter for client " + clientID,
+				Error:     err,
+				UserId:    clientID,
+			})
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if parsed, err := strconv.Atoi(limit); err == nil && parsed > 0 {
+			query.Limit = parsed
+		} else {
+			logger.Log.Warn(logger.LogPayload{
+				Component: "WebSocket",
+				Operation: "ListQueryFromRequest",
+				Message:   "Ignoring invalid limit parameter for client " + clientID,
+				Error:     err,
+				UserId:    clientID,
+			})
+		}
 	}
+	return query
 }
 
 // sendAllNotificationsToClient sends all the notifications of a user to the corresponding client identified by the given clientId.
@@ -269,9 +711,12 @@ func NewWebSocketHandler(notificationService notificationService.NotificationSer
 // encapsulating the notifications. If the fetch operation fails, it logs an error and does not send the notifications. If the fetch
 // operation is successful, it sends the constructed payload to the client using the clientStore. If the send operation fails, it logs
 // an error.
+// The list holds the notifications of the list scope stored in the client info, the unread ones if it is unknown.
 // If bypassStatusCheck is true, it will skip the notification status check when sending notifications.
-func sendAllNotificationsToClient(notificationService notificationService.NotificationService, clientId string, correlationId string, bypassStatusCheck bool) {
-	notifications, err := notificationService.FindAll(clientId)
+func sendAllNotificationsToClient(notificationService notificationService.NotificationService, ctx eventContext, bypassStatusCheck bool) {
+	tenantId, clientId, correlationId := ctx.tenantId, ctx.clientID, ctx.correlationId
+	info, _ := clientStore.GetClientInfo(ctx.clientKey())
+	notifications, err := notificationService.FindAll(ctx, tenantId, clientId, configurationService.ListScope(info.ListScope))
 	payload := data.NotificationList{
 		Event: data.Event{Event: data.LIST_NOTIFICATIONS},
 		Data:  notifications,
@@ -291,7 +736,7 @@ func sendAllNotificationsToClient(notificationService notificationService.Notifi
 			Message:       "Sending all notifications to client: " + clientId,
 			CorrelationId: correlationId,
 		})
-		if err := clientStore.SendNotificationListToUser(clientId, payload, bypassStatusCheck); err != nil {
+		if err := ctx.clients.SendNotificationListToUser(clientStore.UserKey(tenantId, clientId), payload, bypassStatusCheck); err != nil {
 			logger.Log.Error(logger.LogPayload{
 				Component:     "WebSocket Notification Handler",
 				Operation:     "SendNotifications",
@@ -303,17 +748,103 @@ func sendAllNotificationsToClient(notificationService notificationService.Notifi
 	}
 }
 
+// sendInitialNotificationsToClient sends the notifications of a newly connected client. Clients reconnecting
+// with a resume token only receive the notifications changed since the token was issued, as a
+// resumeNotifications event. The list selected by the handshake filters is sent if the token is missing,
+// invalid, older than the retention of deleted notifications, or if fetching the changes fails.
+func sendInitialNotificationsToClient(notificationService notificationService.NotificationService, ctx eventContext, resumeToken string, query data.NotificationListQuery) {
+	tenantId, clientId, correlationId := ctx.tenantId, ctx.clientID, ctx.correlationId
+	if resumeToken == "" {
+		sendInitialListToClient(notificationService, ctx, query)
+		return
+	}
+	since, err := clientStore.ParseResumeToken(resumeToken)
+	if err == nil && time.Since(since) > time.Duration(config.LoadConfig().DeletedRetentionDays)*24*time.Hour {
+		err = apperrors.Validation("resume token expired", nil)
+	}
+	var resume data.NotificationResume
+	if err == nil {
+		resume, err = notificationService.FindChangedSince(ctx, tenantId, clientId, since)
+	}
+	if err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component:     "WebSocket Notification Handler",
+			Operation:     "ResumeNotifications",
+			Message:       "Cannot resume client " + clientId + ", sending all notifications",
+			UserId:        clientId,
+			Error:         err,
+			CorrelationId: correlationId,
+		})
+		metrics.Inc("connections.resume.fallback")
+		sendInitialListToClient(notificationService, ctx, query)
+		return
+	}
+	metrics.Inc("connections.resumed")
+	payload := data.NotificationsResumed{
+		Event: data.Event{Event: data.RESUME_NOTIFICATIONS},
+		Data:  resume,
+	}
+	if err := ctx.clients.SendNotificationsResumedToUser(payload); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Notification Handler",
+			Operation:     "ResumeNotifications",
+			Message:       "Failed to send changed notifications to client " + clientId,
+			UserId:        clientId,
+			Error:         err,
+			CorrelationId: correlationId,
+		})
+	}
+}
+
+// sendInitialListToClient sends the listNotifications event of a newly connected client. Without handshake filters
+// the unread list is requested like any other refresh, so it is coalesced with the refreshes of the user's other
+// connections. A filtered list only concerns the new connection, so it is fetched at once and sent to it alone.
+func sendInitialListToClient(notificationService notificationService.NotificationService, ctx eventContext, query data.NotificationListQuery) {
+	if query == (data.NotificationListQuery{}) {
+		requestNotificationListRefresh(notificationService, ctx, false)
+		return
+	}
+	tenantId, clientId, correlationId := ctx.tenantId, ctx.clientID, ctx.correlationId
+	notifications, err := notificationService.FindList(ctx, tenantId, clientId, query)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Notification Handler",
+			Operation:     "FetchNotifications",
+			Message:       "Failed to fetch filtered notifications for client " + clientId,
+			UserId:        clientId,
+			CorrelationId: correlationId,
+			Error:         err,
+		})
+		return
+	}
+	metrics.Inc("notifications.list.filtered")
+	payload := data.NotificationList{
+		Event: data.Event{Event: data.LIST_NOTIFICATIONS},
+		Data:  notifications,
+	}
+	if err := ctx.clients.SendNotificationListToConnection(ctx.clientKey(), ctx.conn, payload, false); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Notification Handler",
+			Operation:     "SendNotifications",
+			Message:       "Failed to send filtered notifications to client " + clientId,
+			UserId:        clientId,
+			CorrelationId: correlationId,
+			Error:         err,
+		})
+	}
+}
+
 // sendEmptyNotificationListToClient sends all the notifications of a user to the corresponding client identified by the given clientId.
 // It first fetches all the notifications of the user using the notificationService, then constructs a payload of type NotificationList
 // encapsulating the notifications. If the fetch operation fails, it logs an error and does not send the notifications. If the fetch
 // operation is successful, it sends the constructed payload to the client using the clientStore. If the send operation fails, it logs
 // an error.
-func sendEmptyNotificationListToClient(clientId string, correlationId string, bypassNotificationStatus bool) {
+func sendEmptyNotificationListToClient(clients *clientStore.ClientStore, tenantId string, clientId string, correlationId string, bypassNotificationStatus bool) {
 	payload := data.NotificationList{
 		Event: data.Event{Event: data.LIST_NOTIFICATIONS},
 		Data:  []data.Notification{},
 	}
-	if err := clientStore.SendNotificationListToUser(clientId, payload, bypassNotificationStatus); err != nil {
+	if err := clients.SendNotificationListToUser(clientStore.UserKey(tenantId, clientId), payload, bypassNotificationStatus); err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component:     "WebSocket Notification Handler",
 			Operation:     "SendNotifications",
@@ -328,13 +859,18 @@ func sendEmptyNotificationListToClient(clientId string, correlationId string, by
 // identified by the given clientId. If the user is not connected or if the configuration fetch fails,
 // the function logs an error and does not attempt to send the configuration. If the configuration is
 // successfully sent, it will bypass the notification status check.
-func sendConfigurationsToClient(configurationService configurationService.ConfigurationService, clientId string, correlationId string) {
-	configuration, err := configurationService.FindByAppAndUser(clientId)
+func sendConfigurationsToClient(configurationService configurationService.ConfigurationService, ctx eventContext) {
+	tenantId, clientId, correlationId := ctx.tenantId, ctx.clientID, ctx.correlationId
+	configuration, err := configurationService.FindByAppAndUser(ctx, tenantId, clientId)
 	payload := data.Configuration{
 		Event: data.Event{Event: data.LIST_CONFIGURATIONS},
 		Data: data.NotificationConfig{
+			TenantId:           tenantId,
 			UserID:             clientId,
 			EnableNotification: configuration.Data.EnableNotification,
+			DigestApps:         configuration.Data.DigestApps,
+			MutedGroups:        configuration.Data.MutedGroups,
+			ListScope:          configuration.Data.ListScope,
 			Id:                 configuration.Data.Id,
 		},
 	}
@@ -355,7 +891,7 @@ func sendConfigurationsToClient(configurationService configurationService.Config
 			UserId:        clientId,
 			CorrelationId: correlationId,
 		})
-		if err := clientStore.SendConfigurationToUser(payload, true); err != nil {
+		if err := ctx.clients.SendConfigurationToUser(payload, true); err != nil {
 			logger.Log.Error(logger.LogPayload{
 				Component:     "WebSocket Configuration Handler",
 				Operation:     "SendConfigurations",
@@ -368,339 +904,537 @@ func sendConfigurationsToClient(configurationService configurationService.Config
 	}
 }
 
-// markAsReadAction handles the event to mark all notifications as read for a given client.
-// It marks all notifications as read and then sends the updated list of notifications back to the client.
-// Logs errors if the update operation fails.
-func markAsReadAction(notificationService notificationService.NotificationService, clientID string, correlationId string) {
-	logger.Log.Debug(logger.LogPayload{
-		Component:     "WebSocket Mark As Read Action",
-		Operation:     "MarkAllAsRead",
-		Message:       "Marking all notifications as read for client: " + clientID,
-		UserId:        clientID,
-		CorrelationId: correlationId,
-	})
-	err := notificationService.MarkAsRead(clientID)
+// ConfigurationChangeHandler returns the handler applying a configuration changed on another instance, by an
+// admin or by another service to the user's connections in clients. The stored client info is refreshed,
+// so delivery follows the new settings, and the configuration is resent as a listConfigurations event.
+// Users without connections on this instance and deleted configurations are skipped.
+func ConfigurationChangeHandler(configurationService configurationService.ConfigurationService, clients *clientStore.ClientStore) configurationService.ChangeHandler {
+	return func(tenantId string, userId string) {
+		userKey := clientStore.UserKey(tenantId, userId)
+		if !clients.IsConnected(userKey) {
+			return
+		}
+		configuration, err := configurationService.FindByAppAndUser(context.Background(), tenantId, userId)
+		if apperrors.Is(err, apperrors.KindNotFound) {
+			return
+		}
+		if err == nil {
+			var info models.ClientInfo
+			if info, err = clientStore.GetClientInfo(userKey); err == nil {
+				info.EnableNotification = configuration.Data.EnableNotification
+				info.DigestWindows = clientStore.DigestWindows(configuration.Data.DigestApps)
+				info.MutedGroups = clientStore.MutedGroups(configuration.Data.MutedGroups)
+				info.ListScope = configuration.Data.ListScope
+				err = clientStore.UpdateClientInfo(info)
+			}
+		}
+		if err == nil {
+			err = clients.SendConfigurationToUser(configuration, true)
+		}
+		if err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component: "WebSocket Configuration Handler",
+				Operation: "ApplyConfigurationChange",
+				Message:   "Failed to apply changed configuration to client " + userId,
+				UserId:    userId,
+				Error:     err,
+			})
+			return
+		}
+		metrics.Inc("configurations.changes.applied")
+	}
+}
+
+// sendWelcomeToClient sends the connected frame of a new connection, carrying the connection ID, the protocol
+// version and features of the server, the unread count, last sequence number and configuration of the user
+// and the server time.
+// Returns false if the unread count cannot be computed or the frame cannot be sent, in which case the
+// configuration is sent in a listConfigurations frame as for other clients.
+func sendWelcomeToClient(notificationService notificationService.NotificationService, ctx eventContext, connectionId string, configuration data.NotificationConfig) bool {
+	tenantId, clientId, correlationId := ctx.tenantId, ctx.clientID, ctx.correlationId
+	stats, err := notificationService.Stats(ctx, tenantId, clientId)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Mark As Read Action",
-			Operation:     "MarkAllAsRead",
-			Message:       "Failed to mark all notifications as read for client " + clientID,
-			UserId:        clientID,
+			Component:     "WebSocket Welcome Handler",
+			Operation:     "CountUnread",
+			Message:       "Failed to count unread notifications for client " + clientId + ", skipping connected frame",
+			UserId:        clientId,
 			CorrelationId: correlationId,
 			Error:         err,
 		})
+		return false
 	}
-	sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
-}
-
-// markAppReadAction handles the event to mark all notifications for a specific app as read for a given client.
-// It unmarshals the incoming message to extract the appId, then uses the notificationService to update the read status
-// of the notifications in the database. If successful, it sends the updated list of notifications back to the client.
-// Logs errors if the message format is invalid or if the update operation fails.
-func markAppReadAction(message []byte, notificationService notificationService.NotificationService, clientID string, correlationId string) {
-	var event data.EventNotification
-	if err := json.Unmarshal(message, &event); err != nil {
+	// Sequence numbers are optional; the connected frame is sent without one if it cannot be read
+	lastSequence, _ := notificationService.LastSequence(ctx, tenantId, clientId)
+	configuration.TenantId = tenantId
+	configuration.UserID = clientId
+	payload := data.Connected{
+		Event: data.Event{Event: data.CONNECTED},
+		Data: data.ConnectedData{
+			ConnectionId:    connectionId,
+			ProtocolVersion: protocol.Version,
+			Features:        protocol.Describe().Features,
+			UnreadCount:     stats.Unread,
+			LastSequence:    lastSequence,
+			Configuration:   configuration,
+			ServerTime:      time.Now().UnixMilli(),
+		},
+	}
+	if err := ctx.clients.SendConnectedToConnection(ctx.clientKey(), ctx.conn, payload); err != nil {
 		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Mark App As Read Event",
-			Operation:     "ParseEvent",
-			Message:       "Invalid event format",
-			UserId:        clientID,
+			Component:     "WebSocket Welcome Handler",
+			Operation:     "SendConnected",
+			Message:       "Failed to send connected frame to client " + clientId,
+			UserId:        clientId,
 			CorrelationId: correlationId,
 			Error:         err,
 		})
-		return
+		return false
 	}
+	metrics.Inc("connections.welcomed")
+	return true
+}
+
+// newWebSocketDispatcher registers the handlers of the client events on a new event dispatcher.
+func newWebSocketDispatcher(notificationService notificationService.NotificationService, configurationService configurationService.ConfigurationService) *eventDispatcher {
+	dispatcher := newEventDispatcher()
+
+	// Mark as Read Events
+	on(dispatcher, data.MARK_AS_READ, func(ctx eventContext, _ data.Event) error {
+		return markAsReadAction(notificationService, ctx)
+	})
+	on(dispatcher, data.MARK_APP_AS_READ, func(ctx eventContext, event data.AppEvent) error {
+		return markAppReadAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.MARK_GROUP_AS_READ, func(ctx eventContext, event data.GroupEvent) error {
+		return markGroupAsReadAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.GROUP_OPENED, func(ctx eventContext, event data.GroupOpenedEvent) error {
+		return groupOpenedAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.MARK_NOTIFICATION_AS_READ, func(ctx eventContext, event data.NotificationReadEvent) error {
+		return markNotificationAsReadAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.SYNC_READ_STATE, func(ctx eventContext, event data.SyncReadStateEvent) error {
+		return syncReadStateAction(notificationService, ctx, event.Data)
+	})
+
+	// Delete Events
+	on(dispatcher, data.DELETE_NOTIFICATIONS, func(ctx eventContext, _ data.Event) error {
+		return deleteNotificationsAction(notificationService, ctx)
+	})
+	on(dispatcher, data.DELETE_APP_NOTIFICATIONS, func(ctx eventContext, event data.AppEvent) error {
+		return deleteAppNotificationsAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.DELETE_GROUP_NOTIFICATIONS, func(ctx eventContext, event data.GroupEvent) error {
+		return deleteGroupNotificationAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.DELETE_NOTIFICATION, func(ctx eventContext, event data.NotificationEvent) error {
+		return deleteNotificationAction(notificationService, ctx, event.Data)
+	})
+
+	// Other Events
+	on(dispatcher, data.RELOAD_NOTIFICATIONS, func(ctx eventContext, _ data.Event) error {
+		requestNotificationListRefresh(notificationService, ctx, false)
+		return nil
+	})
+	on(dispatcher, data.FULL_RESYNC, func(ctx eventContext, _ data.Event) error {
+		return fullResyncAction(notificationService, configurationService, ctx)
+	})
+	on(dispatcher, data.SET_NOTIFICATION_STATUS, func(ctx eventContext, event data.Configuration) error {
+		return setNotificationStatusAction(configurationService, notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.UPDATE_NOTIFICATION_STATUS, func(ctx eventContext, event data.NotificationStatusEvent) error {
+		return updateNotificationStatusAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.PIN_NOTIFICATION, func(ctx eventContext, event data.NotificationEvent) error {
+		return setNotificationPinnedAction(notificationService, ctx, event.Data, true)
+	})
+	on(dispatcher, data.UNPIN_NOTIFICATION, func(ctx eventContext, event data.NotificationEvent) error {
+		return setNotificationPinnedAction(notificationService, ctx, event.Data, false)
+	})
+	on(dispatcher, data.MUTE_GROUP, func(ctx eventContext, event data.MuteGroupEvent) error {
+		return muteGroupAction(configurationService, ctx, event.Data)
+	})
+	on(dispatcher, data.UNMUTE_GROUP, func(ctx eventContext, event data.GroupEvent) error {
+		return unmuteGroupAction(configurationService, ctx, event.Data)
+	})
+	on(dispatcher, data.SEARCH_NOTIFICATIONS, func(ctx eventContext, event data.SearchNotificationsEvent) error {
+		return searchNotificationsAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.GET_NOTIFICATIONS_SINCE, func(ctx eventContext, event data.GetNotificationsSinceEvent) error {
+		return getNotificationsSinceAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.RESYNC_FROM_SEQUENCE, func(ctx eventContext, event data.ResyncFromSequenceEvent) error {
+		return resyncFromSequenceAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.NOTIFICATION_ACTION_TRIGGERED, func(ctx eventContext, event data.NotificationActionEvent) error {
+		return notificationActionTriggeredAction(notificationService, ctx, event.Data)
+	})
+	on(dispatcher, data.LIST_DEVICES, func(ctx eventContext, _ data.Event) error {
+		return listDevicesAction(ctx)
+	})
+	on(dispatcher, data.DISCONNECT_DEVICE, func(ctx eventContext, event data.DeviceEvent) error {
+		return disconnectDeviceAction(ctx, event.Data)
+	})
+	on(dispatcher, data.HELLO, func(ctx eventContext, event data.HelloEvent) error {
+		return helloAction(ctx, event.Data)
+	})
+	on(dispatcher, data.HEARTBEAT, func(ctx eventContext, event data.HeartbeatEvent) error {
+		return heartbeatAction(ctx, event.Data)
+	})
+
+	return dispatcher
+}
+
+// markAsReadAction handles the event to mark all notifications as read for a given client.
+// It marks all notifications as read and then sends a delta event with the affected IDs to the client.
+// Returns an error if the update operation fails.
+func markAsReadAction(notificationService notificationService.NotificationService, ctx eventContext) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Mark As Read Action",
+		Operation:     "MarkAllAsRead",
+		Message:       "Marking all notifications as read for client: " + ctx.clientID,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	ids, err := notificationService.MarkAsRead(ctx, ctx.tenantId, ctx.clientID, ctx.correlationId)
+	if err != nil {
+		return err
+	}
+	sendNotificationChangeToClient(ctx, data.NOTIFICATIONS_MARKED_READ, ids)
+	return nil
+}
+
+// markAppReadAction handles the event to mark all notifications for a specific app as read for a given client.
+// It uses the notificationService to update the read status of the notifications in the database and then
+// sends a delta event with the affected IDs to the client. Returns an error if the update operation fails.
+func markAppReadAction(notificationService notificationService.NotificationService, ctx eventContext, target data.AppTarget) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component:     "WebSocket Mark App As Read Event",
 		Operation:     "MarkAppAsRead",
-		Message:       "Marking all notifications for app as read for client: " + clientID + ", App ID: " + event.Data.AppId,
-		UserId:        clientID,
-		CorrelationId: correlationId,
+		Message:       "Marking all notifications for app as read for client: " + ctx.clientID + ", App ID: " + target.AppId,
+		UserId:        ctx.clientID,
+		AppId:         target.AppId,
+		CorrelationId: ctx.correlationId,
 	})
-	err := notificationService.MarkAppAsRead(clientID, event.Data.AppId)
+	ids, err := notificationService.MarkAppAsRead(ctx, ctx.tenantId, ctx.clientID, target.AppId, ctx.correlationId)
 	if err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Mark App As Read Event",
-			Operation:     "MarkAppAsRead",
-			Message:       "Failed to mark app as read for client " + clientID + ", App ID: " + event.Data.AppId,
-			UserId:        clientID,
-			CorrelationId: correlationId,
-			AppId:         event.Data.AppId,
-			Error:         err,
-		})
+		return err
 	}
-	sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
+	sendNotificationChangeToClient(ctx, data.NOTIFICATIONS_MARKED_READ, ids)
+	return nil
 }
 
 // markGroupAsReadAction handles the event to mark all notifications with a given appId and groupKey as read for a given client.
-// It unmarshals the incoming message to extract the appId and groupKey, then uses the notificationService to
-// update the read status of the notifications in the database. If successful, it sends the updated list of
-// notifications back to the client. Logs errors if the message format is invalid or if the update operation fails.
-func markGroupAsReadAction(message []byte, notificationService notificationService.NotificationService, clientID string, correlationId string) {
-	var event data.EventNotification
-	if err := json.Unmarshal(message, &event); err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Mark Group As Read Event",
-			Operation:     "ParseEvent",
-			Message:       "Invalid event format",
-			UserId:        clientID,
-			AppId:         event.Data.AppId,
-			CorrelationId: correlationId,
-			Error:         err,
-		})
-		return
-	}
+// It uses the notificationService to update the read status of the notifications in the database and then
+// sends a delta event with the affected IDs to the client. Returns an error if the update operation fails.
+func markGroupAsReadAction(notificationService notificationService.NotificationService, ctx eventContext, target data.GroupTarget) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component:     "WebSocket Mark Group As Read Event",
 		Operation:     "MarkGroupAsRead",
-		Message:       "Marking group as read for client: " + clientID + ", App ID: " + event.Data.AppId + ", Group Key: " + event.Data.GroupKey,
-		UserId:        clientID,
-		AppId:         event.Data.AppId,
-		CorrelationId: correlationId,
+		Message:       "Marking group as read for client: " + ctx.clientID + ", App ID: " + target.AppId + ", Group Key: " + target.GroupKey,
+		UserId:        ctx.clientID,
+		AppId:         target.AppId,
+		CorrelationId: ctx.correlationId,
 	})
-	err := notificationService.MarkGroupAsRead(clientID, event.Data.AppId, event.Data.GroupKey)
+	ids, err := notificationService.MarkGroupAsRead(ctx, ctx.tenantId, ctx.clientID, target.AppId, target.GroupKey, ctx.correlationId)
 	if err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Mark Group As Read Event",
-			Operation:     "MarkGroupAsRead",
-			Message:       "Failed to mark group as read for client " + clientID + ", App ID: " + event.Data.AppId + ", Group Key: " + event.Data.GroupKey,
-			UserId:        clientID,
-			AppId:         event.Data.AppId,
-			CorrelationId: correlationId,
-			Error:         err,
-		})
+		return err
 	}
-	sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
+	sendNotificationChangeToClient(ctx, data.NOTIFICATIONS_MARKED_READ, ids)
+	return nil
 }
 
-// markNotificationAsReadAction handles the event to mark a specific notification as read for a given client.
-// It unmarshals the incoming message to extract the notification ID, then uses the notificationService to
-// update the read status of the notification in the database. If successful, it sends the updated list of
-// notifications back to the client. Logs errors if the message format is invalid or if the update operation fails.
-func markNotificationAsReadAction(message []byte, notificationService notificationService.NotificationService, clientID string, correlationId string) {
-	var event data.EventNotification
-	if err := json.Unmarshal(message, &event); err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Mark Notification As Read Event",
-			Operation:     "ParseEvent",
-			Message:       "Invalid event format",
-			UserId:        clientID,
-			CorrelationId: correlationId,
-			Error:         err,
-		})
-		return
+// groupOpenedAction handles the event sent when the user opens a group. It marks the notifications of the group created
+// at or before the time the group was opened as read and sends a delta event with the affected IDs to the client, leaving
+// notifications that arrived while the group was open unread. Returns an error if the update operation fails.
+func groupOpenedAction(notificationService notificationService.NotificationService, ctx eventContext, target data.GroupOpenedTarget) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Group Opened Event",
+		Operation:     "GroupOpened",
+		Message:       "Marking opened group as read for client: " + ctx.clientID + ", App ID: " + target.AppId + ", Group Key: " + target.GroupKey,
+		UserId:        ctx.clientID,
+		AppId:         target.AppId,
+		CorrelationId: ctx.correlationId,
+	})
+	ids, err := notificationService.MarkGroupOpened(ctx, ctx.tenantId, ctx.clientID, target.AppId, target.GroupKey, target.OpenedAt, ctx.correlationId)
+	if err != nil {
+		return err
 	}
+	sendNotificationChangeToClient(ctx, data.NOTIFICATIONS_MARKED_READ, ids)
+	return nil
+}
+
+// markNotificationAsReadAction handles the event to mark a specific notification as read for a given client.
+// It uses the notificationService to update the read status of the notification in the database and then
+// sends the updated notification to the client as a notificationUpdated event. When the client asks for the
+// thread, the follow-ups of a thread root are marked too and sent as a notificationsMarkedRead event.
+// Returns an error if the update operation fails.
+func markNotificationAsReadAction(notificationService notificationService.NotificationService, ctx eventContext, target data.NotificationReadTarget) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component:     "WebSocket Mark Notification As Read Event",
 		Operation:     "MarkNotificationAsRead",
-		Message:       "Marking notification as read for client: " + clientID + ", Notification ID: " + event.Data.Id,
-		UserId:        clientID,
-		CorrelationId: correlationId,
+		Message:       "Marking notification as read for client: " + ctx.clientID + ", Notification ID: " + target.Id + ", Thread: " + strconv.FormatBool(target.Thread),
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	if !target.Thread {
+		notification, err := notificationService.MarkNotificationAsRead(ctx, ctx.tenantId, ctx.clientID, target.Id)
+		if err != nil {
+			return err
+		}
+		sendNotificationUpdateToClient(ctx, data.NOTIFICATION_UPDATED, notification)
+		return nil
+	}
+	notification, ids, err := notificationService.MarkThreadAsRead(ctx, ctx.tenantId, ctx.clientID, target.Id)
+	if notification.Id != "" {
+		// The root is read even if marking its follow-ups failed.
+		sendNotificationUpdateToClient(ctx, data.NOTIFICATION_UPDATED, notification)
+	}
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		sendNotificationChangeToClient(ctx, data.NOTIFICATIONS_MARKED_READ, ids)
+	}
+	return nil
+}
+
+// syncReadStateAction handles the event sent by a client to reconcile the read status changes it made while offline.
+// The notification service merges the changes with the stored read state, the last write winning, and the
+// authoritative state is sent to all connections of the client as a readStateSynced event, so its other devices
+// converge on the same state. Returns an error if a notification ID is invalid or the update fails.
+func syncReadStateAction(notificationService notificationService.NotificationService, ctx eventContext, request data.SyncReadStateRequest) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Sync Read State Event",
+		Operation:     "SyncReadState",
+		Message:       fmt.Sprintf("Syncing %d read state changes for client: %s", len(request.Changes), ctx.clientID),
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
 	})
-	err := notificationService.MarkNotificationAsRead(clientID, event.Data.Id)
+	result, err := notificationService.SyncReadState(ctx, ctx.tenantId, ctx.clientID, request, ctx.correlationId)
 	if err != nil {
+		return err
+	}
+	payload := data.ReadStateSynced{Event: data.Event{Event: data.READ_STATE_SYNCED}, Data: result}
+	if err := ctx.clients.SendReadStateSyncedToUser(payload); err != nil {
 		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Mark Notification As Read Event",
-			Operation:     "MarkNotificationAsRead",
-			Message:       "Failed to mark notification as read for client " + clientID + ", Notification ID: " + event.Data.Id,
-			UserId:        clientID,
-			CorrelationId: correlationId,
+			Component:     "WebSocket Sync Read State Event",
+			Operation:     "SendReadStateSynced",
+			Message:       "Failed to send synced read state to client " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
 			Error:         err,
 		})
 	}
-	sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
+	return nil
+}
+
+// updateNotificationStatusAction handles the event to move a specific notification to another status for a given client.
+// The notification service validates the transition from the current status, then the updated notification is sent
+// to the client as a notificationStatusUpdated event. Returns an error if the transition is not allowed or the update fails.
+func updateNotificationStatusAction(notificationService notificationService.NotificationService, ctx eventContext, target data.NotificationStatusTarget) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Update Notification Status Event",
+		Operation:     "UpdateNotificationStatus",
+		Message:       "Updating status of notification for client: " + ctx.clientID + ", Notification ID: " + target.Id + ", Status: " + target.Status,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	notification, err := notificationService.UpdateStatus(ctx, ctx.tenantId, ctx.clientID, "", target.Id, target.Status, ctx.correlationId)
+	if err != nil {
+		return err
+	}
+	sendNotificationUpdateToClient(ctx, data.NOTIFICATION_STATUS_UPDATED, notification)
+	return nil
+}
+
+// setNotificationPinnedAction handles the events sent by a client to pin or unpin a notification. The updated
+// notification is sent to all connections of the client as a notificationUpdated event, so they move it to or
+// from the top of their list. Returns an error if the notification is not found or the pin limit is reached.
+func setNotificationPinnedAction(notificationService notificationService.NotificationService, ctx eventContext, target data.NotificationTarget, pinned bool) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Pin Notification Event",
+		Operation:     "SetNotificationPinned",
+		Message:       fmt.Sprintf("Setting pinned to %t for client: %s, Notification ID: %s", pinned, ctx.clientID, target.Id),
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	notification, err := notificationService.SetPinned(ctx, ctx.tenantId, ctx.clientID, target.Id, pinned, ctx.correlationId)
+	if err != nil {
+		return err
+	}
+	sendNotificationUpdateToClient(ctx, data.NOTIFICATION_UPDATED, notification)
+	return nil
 }
 
 // deleteNotificationsAction handles the event to delete all notifications for a given client.
-// It uses the notificationService to delete the notifications
-// in the database. If successful, it sends the updated list of notifications back to the client.
-// Logs errors if the message format is invalid or if the update operation fails.
-func deleteNotificationsAction(notificationService notificationService.NotificationService, clientID string, correlationId string) {
+// It uses the notificationService to delete the notifications in the database and then sends a
+// delta event with the affected IDs to the client. Returns an error if the deletion operation fails.
+func deleteNotificationsAction(notificationService notificationService.NotificationService, ctx eventContext) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component:     "WebSocket Delete Notifications Action",
 		Operation:     "DeleteAllNotifications",
-		Message:       "Deleting notifications for client: " + clientID,
-		UserId:        clientID,
-		CorrelationId: correlationId,
+		Message:       "Deleting notifications for client: " + ctx.clientID,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
 	})
-	err := notificationService.DeleteNotifications(clientID)
+	ids, err := notificationService.DeleteNotifications(ctx, ctx.tenantId, ctx.clientID, ctx.correlationId)
 	if err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Delete Notifications Action",
-			Operation:     "DeleteAllNotifications",
-			Message:       "Failed to delete all notifications for client " + clientID,
-			UserId:        clientID,
-			CorrelationId: correlationId,
-			Error:         err,
-		})
+		return err
 	}
-	sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
+	sendNotificationChangeToClient(ctx, data.NOTIFICATION_DELETED, ids)
+	return nil
 }
 
 // deleteAppNotificationsAction handles the event to delete all notifications for a specific app for a given client.
-// It unmarshals the incoming message to extract the appId, then uses the notificationService to delete the notifications
-// in the database. If successful, it sends the updated list of notifications back to the client.
-// Logs errors if the message format is invalid or if the update operation fails.
-func deleteAppNotificationsAction(message []byte, notificationService notificationService.NotificationService, clientID string, correlationId string) {
-	var event data.EventNotification
-	if err := json.Unmarshal(message, &event); err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Delete App Notifications Event",
-			Operation:     "ParseEvent",
-			Message:       "Invalid event format",
-			UserId:        clientID,
-			AppId:         event.Data.AppId,
-			CorrelationId: correlationId,
-			Error:         err,
-		})
-		return
-	}
+// It uses the notificationService to delete the notifications in the database and then sends a
+// delta event with the affected IDs to the client. Returns an error if the deletion operation fails.
+func deleteAppNotificationsAction(notificationService notificationService.NotificationService, ctx eventContext, target data.AppTarget) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component:     "WebSocket Delete App Notifications Event",
 		Operation:     "DeleteAppNotifications",
-		Message:       "Deleting all notifications for app for client: " + clientID + ", App ID: " + event.Data.AppId,
-		UserId:        clientID,
-		AppId:         event.Data.AppId,
-		CorrelationId: correlationId,
+		Message:       "Deleting all notifications for app for client: " + ctx.clientID + ", App ID: " + target.AppId,
+		UserId:        ctx.clientID,
+		AppId:         target.AppId,
+		CorrelationId: ctx.correlationId,
 	})
-	err := notificationService.DeleteAppNotifications(clientID, event.Data.AppId)
+	ids, err := notificationService.DeleteAppNotifications(ctx, ctx.tenantId, ctx.clientID, target.AppId, ctx.correlationId)
 	if err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Delete App Notifications Event",
-			Operation:     "DeleteAppNotifications",
-			Message:       "Failed to delete app notifications for client " + clientID + ", App ID: " + event.Data.AppId,
-			UserId:        clientID,
-			AppId:         event.Data.AppId,
-			CorrelationId: correlationId,
-			Error:         err,
-		})
+		return err
 	}
-	sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
+	sendNotificationChangeToClient(ctx, data.NOTIFICATION_DELETED, ids)
+	return nil
 }
 
 // deleteGroupNotificationAction handles the event to delete all notifications with a given appId and groupKey for a given client.
-// It unmarshals the incoming message to extract the appId and groupKey, then uses the notificationService to
-// delete the notifications in the database. If successful, it sends the updated list of
-// notifications back to the client. Logs errors if the message format is invalid or if the deletion operation fails.
-func deleteGroupNotificationAction(message []byte, notificationService notificationService.NotificationService, clientID string, correlationId string) {
-	var event data.EventNotification
-	if err := json.Unmarshal(message, &event); err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Delete Group Notifications Event",
-			Operation:     "ParseEvent",
-			Message:       "Invalid event format",
-			UserId:        clientID,
-			AppId:         event.Data.AppId,
-			CorrelationId: correlationId,
-			Error:         err,
-		})
-		return
-	}
+// It uses the notificationService to delete the notifications in the database and then sends a
+// delta event with the affected IDs to the client. Returns an error if the deletion operation fails.
+func deleteGroupNotificationAction(notificationService notificationService.NotificationService, ctx eventContext, target data.GroupTarget) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component:     "WebSocket Delete Group Notifications Event",
 		Operation:     "DeleteGroupNotifications",
-		Message:       "Deleting group notifications for client: " + clientID + ", App ID: " + event.Data.AppId + ", Group Key: " + event.Data.GroupKey,
-		UserId:        clientID,
-		AppId:         event.Data.AppId,
-		CorrelationId: correlationId,
+		Message:       "Deleting group notifications for client: " + ctx.clientID + ", App ID: " + target.AppId + ", Group Key: " + target.GroupKey,
+		UserId:        ctx.clientID,
+		AppId:         target.AppId,
+		CorrelationId: ctx.correlationId,
 	})
-	err := notificationService.DeleteGroupNotifications(clientID, event.Data.AppId, event.Data.GroupKey)
+	ids, err := notificationService.DeleteGroupNotifications(ctx, ctx.tenantId, ctx.clientID, target.AppId, target.GroupKey, ctx.correlationId)
 	if err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Delete Group Notifications Event",
-			Operation:     "DeleteGroupNotifications",
-			Message:       "Failed to delete group notifications for client " + clientID + ", App ID: " + event.Data.AppId + ", Group Key: " + event.Data.GroupKey,
-			UserId:        clientID,
-			AppId:         event.Data.AppId,
-			CorrelationId: correlationId,
-			Error:         err,
-		})
+		return err
 	}
-	sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
+	sendNotificationChangeToClient(ctx, data.NOTIFICATION_DELETED, ids)
+	return nil
 }
 
 // deleteNotificationAction handles the event to delete a specific notification for a given client.
-// It unmarshals the incoming message to extract the notification ID, then uses the notificationService to
-// delete the notification from the database. If successful, it sends the updated list of
-// notifications back to the client. Logs errors if the message format is invalid or if the deletion operation fails.
-func deleteNotificationAction(message []byte, notificationService notificationService.NotificationService, clientID string, correlationId string) {
-	var event data.EventNotification
-	if err := json.Unmarshal(message, &event); err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Delete Notification Event",
-			Operation:     "ParseEvent",
-			Message:       "Invalid event format",
-			UserId:        clientID,
-			CorrelationId: correlationId,
-			Error:         err,
-		})
-		return
-	}
+// It uses the notificationService to delete the notification from the database and then sends a
+// delta event with the affected IDs to the client. Returns an error if the deletion operation fails.
+func deleteNotificationAction(notificationService notificationService.NotificationService, ctx eventContext, target data.NotificationTarget) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component:     "WebSocket Delete Notification Event",
 		Operation:     "DeleteNotification",
-		Message:       "Deleting notification for client: " + clientID + ", Notification ID: " + event.Data.Id,
-		UserId:        clientID,
-		CorrelationId: correlationId,
+		Message:       "Deleting notification for client: " + ctx.clientID + ", Notification ID: " + target.Id,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
 	})
-	err := notificationService.DeleteNotification(clientID, event.Data.Id)
+	ids, err := notificationService.DeleteNotification(ctx, ctx.tenantId, ctx.clientID, target.Id, ctx.correlationId)
 	if err != nil {
+		return err
+	}
+	sendNotificationChangeToClient(ctx, data.NOTIFICATION_DELETED, ids)
+	return nil
+}
+
+// fullResyncAction handles the event a client sends when its local state may have diverged from the
+// delta events, for example after a missed frame. It resends the full notification list and the configuration.
+func fullResyncAction(notificationService notificationService.NotificationService, configurationService configurationService.ConfigurationService, ctx eventContext) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Full Resync Event",
+		Operation:     "FullResync",
+		Message:       "Resending all notifications and configurations to client: " + ctx.clientID,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	requestNotificationListRefresh(notificationService, ctx, false)
+	sendConfigurationsToClient(configurationService, ctx)
+	return nil
+}
+
+// sendNotificationChangeToClient sends a delta event listing the notifications affected by a change to
+// all connections of the client, on this and every other instance. Nothing is sent if no notification
+// was affected.
+func sendNotificationChangeToClient(ctx eventContext, event string, ids []string) {
+	if len(ids) == 0 || ctx.deferToBatch(false) {
+		return
+	}
+	payload := data.NotificationChange{
+		Event: data.Event{Event: event},
+		Data:  data.NotificationChangeSet{TenantId: ctx.tenantId, UserID: ctx.clientID, Ids: ids},
+	}
+	if err := ctx.clients.SendNotificationChangeToUser(payload); err != nil {
 		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Delete Notification Event",
-			Operation:     "DeleteNotification",
-			Message:       "Failed to delete notification for client " + clientID + ", Notification ID: " + event.Data.Id,
-			UserId:        clientID,
-			CorrelationId: correlationId,
+			Component:     "WebSocket Notification Handler",
+			Operation:     "SendNotificationChange",
+			Message:       "Failed to send " + event + " to client " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
 			Error:         err,
 		})
 	}
-	sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
 }
 
-// setNotificationStatusAction handles the toggle notification status event.
-// It unmarshals the incoming message to extract the configuration data, updates the user's
-// notification settings in the configuration service, and updates the client information in
-// the client store. If notifications are enabled, it sends all notifications to the client.
-// Finally, it sends the updated configuration back to the client.
-func setNotificationStatusAction(message []byte, configurationService configurationService.ConfigurationService, notificationService notificationService.NotificationService, clientID string, correlationId string) {
-	var event data.Configuration
-	if err := json.Unmarshal(message, &event); err != nil {
+// sendNotificationUpdateToClient sends the updated notification as a delta event with the given name, such
+// as notificationUpdated, to all connections of the client, on this and every other instance.
+func sendNotificationUpdateToClient(ctx eventContext, event string, notification data.Notification) {
+	if ctx.deferToBatch(false) {
+		return
+	}
+	payload := data.EventNotification{
+		Event: data.Event{Event: event},
+		Data:  notification,
+	}
+	if err := ctx.clients.SendNotificationUpdateToUser(payload); err != nil {
 		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Toggle Notification Status Event",
-			Operation:     "ParseEvent",
-			Message:       "Invalid event format",
-			UserId:        clientID,
-			CorrelationId: correlationId,
+			Component:     "WebSocket Notification Handler",
+			Operation:     "SendNotificationUpdate",
+			Message:       "Failed to send notification update to client " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
 			Error:         err,
 		})
-		return
 	}
-	err := configurationService.Update(models.Configuration{
+}
+
+// setNotificationStatusAction handles the toggle notification status event.
+// It updates the user's notification settings in the configuration service and the client information
+// in the client store. If notifications are enabled, it sends all notifications to the client, otherwise
+// an empty list. Finally, it sends the updated configuration back to the client.
+// Returns an error if the configuration cannot be updated.
+func setNotificationStatusAction(configurationService configurationService.ConfigurationService, notificationService notificationService.NotificationService, ctx eventContext, status data.NotificationConfig) error {
+	tenantId, clientID, correlationId := ctx.tenantId, ctx.clientID, ctx.correlationId
+	err := configurationService.Update(ctx, models.Configuration{
+		TenantId:            tenantId,
 		UserId:              clientID,
-		EnableNotifications: event.Data.EnableNotification,
+		EnableNotifications: status.EnableNotification,
 	})
 	if err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component:     "WebSocket Toggle Notification Status Event",
-			Operation:     "UpdateConfiguration",
-			Message:       "Failed to update configuration for client " + clientID,
-			UserId:        clientID,
-			CorrelationId: correlationId,
-			Error:         err,
-		})
+		return err
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component:     "WebSocket Toggle Notification Status Event",
 		Operation:     "UpdateConfiguration",
-		Message:       "Updated configuration for client: " + clientID + ", EnableNotification: " + fmt.Sprintf("%v", event.Data.EnableNotification),
+		Message:       "Updated configuration for client: " + clientID + ", EnableNotification: " + fmt.Sprintf("%v", status.EnableNotification),
 		UserId:        clientID,
 		CorrelationId: correlationId,
 	})
-	clientStore.UpdateClientInfo(models.ClientInfo{
-		ID:                 clientID,
-		EnableNotification: event.Data.EnableNotification,
-	})
-	if event.Data.EnableNotification {
+	// Keep the connection time and digest windows of the stored client info
+	info, _ := clientStore.GetClientInfo(ctx.clientKey())
+	info.ID = ctx.clientKey()
+	info.EnableNotification = status.EnableNotification
+	clientStore.UpdateClientInfo(info)
+	if status.EnableNotification {
 		logger.Log.Debug(logger.LogPayload{
 			Component:     "WebSocket Toggle Notification Status Event",
 			Operation:     "SendNotifications",
@@ -708,7 +1442,7 @@ func setNotificationStatusAction(message []byte, configurationService configurat
 			UserId:        clientID,
 			CorrelationId: correlationId,
 		})
-		sendAllNotificationsToClient(notificationService, clientID, correlationId, false)
+		requestNotificationListRefresh(notificationService, ctx, false)
 	} else {
 		// Send empty notification list to client
 		logger.Log.Debug(logger.LogPayload{
@@ -718,8 +1452,319 @@ func setNotificationStatusAction(message []byte, configurationService configurat
 			UserId:        clientID,
 			CorrelationId: correlationId,
 		})
-		sendEmptyNotificationListToClient(clientID, correlationId, true)
+		cancelNotificationListRefresh(ctx)
+		sendEmptyNotificationListToClient(ctx.clients, tenantId, clientID, correlationId, true)
 	}
 	// Send updated configuration to client
-	sendConfigurationsToClient(configurationService, clientID, correlationId)
+	sendConfigurationsToClient(configurationService, ctx)
+	return nil
+}
+
+// muteGroupAction handles the event to mute a group of an app for a number of minutes. Notifications of the
+// group are still stored, but not pushed to the client until the mute expires, and are flagged as muted in
+// notification lists. The updated configuration is sent back to the client.
+// Returns an error if the configuration cannot be updated.
+func muteGroupAction(configurationService configurationService.ConfigurationService, ctx eventContext, target data.MuteGroupTarget) error {
+	until := time.Now().Add(time.Duration(target.DurationMinutes) * time.Minute)
+	configuration, err := configurationService.MuteGroup(ctx, ctx.tenantId, ctx.clientID, target.AppId, target.GroupKey, until)
+	if err != nil {
+		return err
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component:     "WebSocket Mute Group Event",
+		Operation:     "MuteGroup",
+		Message:       fmt.Sprintf("Muted group %s for client: %s until %s", target.GroupKey, ctx.clientID, until.Format(time.RFC3339)),
+		UserId:        ctx.clientID,
+		AppId:         target.AppId,
+		CorrelationId: ctx.correlationId,
+	})
+	applyMutedGroups(ctx, configuration)
+	return nil
+}
+
+// unmuteGroupAction handles the event to resume the pushes of a muted group before its mute expires.
+// The updated configuration is sent back to the client.
+// Returns an error if the configuration cannot be updated.
+func unmuteGroupAction(configurationService configurationService.ConfigurationService, ctx eventContext, target data.GroupTarget) error {
+	configuration, err := configurationService.UnmuteGroup(ctx, ctx.tenantId, ctx.clientID, target.AppId, target.GroupKey)
+	if err != nil {
+		return err
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component:     "WebSocket Mute Group Event",
+		Operation:     "UnmuteGroup",
+		Message:       "Unmuted group " + target.GroupKey + " for client: " + ctx.clientID,
+		UserId:        ctx.clientID,
+		AppId:         target.AppId,
+		CorrelationId: ctx.correlationId,
+	})
+	applyMutedGroups(ctx, configuration)
+	return nil
+}
+
+// applyMutedGroups stores the muted groups of the updated configuration in the client info, which
+// delivery checks on every instance, and sends the configuration to the client.
+func applyMutedGroups(ctx eventContext, configuration data.Configuration) {
+	// Keep the connection time, notification status and digest windows of the stored client info
+	info, _ := clientStore.GetClientInfo(ctx.clientKey())
+	info.ID = ctx.clientKey()
+	info.MutedGroups = clientStore.MutedGroups(configuration.Data.MutedGroups)
+	clientStore.UpdateClientInfo(info)
+	if err := ctx.clients.SendConfigurationToUser(configuration, true); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Mute Group Event",
+			Operation:     "SendConfigurations",
+			Message:       "Failed to send configurations to client " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+			Error:         err,
+		})
+	}
+}
+
+// searchNotificationsAction handles the event to search the notifications of a given client.
+// It runs the search through the notificationService and sends the resulting page back to the
+// client as a searchResults event. Returns an error if the search operation fails.
+func searchNotificationsAction(notificationService notificationService.NotificationService, ctx eventContext, query data.NotificationSearchQuery) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Search Notifications Event",
+		Operation:     "SearchNotifications",
+		Message:       "Searching notifications for client: " + ctx.clientID + ", Query: " + query.Query,
+		UserId:        ctx.clientID,
+		AppId:         query.AppId,
+		CorrelationId: ctx.correlationId,
+	})
+	results, err := notificationService.Search(ctx, ctx.tenantId, ctx.clientID, query)
+	if err != nil {
+		return err
+	}
+	if err := ctx.clients.SendSearchResultsToConnection(ctx.clientKey(), ctx.conn, results); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Search Notifications Event",
+			Operation:     "SendSearchResults",
+			Message:       "Failed to send search results to client " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+			Error:         err,
+		})
+	}
+	return nil
+}
+
+// getNotificationsSinceAction handles the event to fetch the notifications of a given client changed since the
+// last one in its local cache. It fetches a page of changes through the notificationService and sends it back to
+// the client as a notificationsSince event. Returns an error if the query is invalid or the fetch fails.
+func getNotificationsSinceAction(notificationService notificationService.NotificationService, ctx eventContext, query data.NotificationsSinceQuery) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Get Notifications Since Event",
+		Operation:     "GetNotificationsSince",
+		Message:       "Fetching notifications changed since " + query.Since.Format(time.RFC3339Nano) + " for client: " + ctx.clientID,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	payload, err := notificationService.FindSince(ctx, ctx.tenantId, ctx.clientID, query)
+	if err != nil {
+		return err
+	}
+	if err := ctx.clients.SendNotificationsSinceToConnection(ctx.clientKey(), ctx.conn, payload); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Get Notifications Since Event",
+			Operation:     "SendNotificationsSince",
+			Message:       "Failed to send notifications since to client " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+			Error:         err,
+		})
+	}
+	return nil
+}
+
+// resyncFromSequenceAction handles the event sent by clients that noticed a gap in the sequence numbers of
+// the notifications they received. It sends a sequenceResync event with a page of the notifications of the
+// client numbered after the sequence number of the query.
+// Returns an error if the query is invalid or the notifications cannot be retrieved.
+func resyncFromSequenceAction(notificationService notificationService.NotificationService, ctx eventContext, query data.SequenceResyncQuery) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Resync From Sequence Event",
+		Operation:     "ResyncFromSequence",
+		Message:       fmt.Sprintf("Fetching notifications after sequence %d for client: %s", query.AfterSequence, ctx.clientID),
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	payload, err := notificationService.FindAfterSequence(ctx, ctx.tenantId, ctx.clientID, query)
+	if err != nil {
+		return err
+	}
+	metrics.Inc("notifications.sequence.resyncs")
+	if err := ctx.clients.SendSequenceResyncToConnection(ctx.clientKey(), ctx.conn, payload); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Resync From Sequence Event",
+			Operation:     "SendSequenceResync",
+			Message:       "Failed to send sequence resync to client " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+			Error:         err,
+		})
+	}
+	return nil
+}
+
+// helloAction handles the hello event sent by client SDKs when they connect.
+// It logs the SDK and protocol version announced by the client and answers the connection that sent it
+// with a hello event advertising the server protocol version, supported events, wire formats and feature flags.
+func helloAction(ctx eventContext, hello data.HelloData) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Hello Event",
+		Operation:     "Hello",
+		Message:       "Hello received from client: " + ctx.clientID + ", SDK: " + hello.Sdk + ", Protocol Version: " + hello.ProtocolVersion,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	payload := data.HelloResponse{
+		Event: data.Event{Event: data.HELLO},
+		Data:  protocol.Describe(),
+	}
+	if err := ctx.clients.SendHelloToConnection(ctx.clientKey(), ctx.conn, payload); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Hello Event",
+			Operation:     "SendHello",
+			Message:       "Failed to send hello to client " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+			Error:         err,
+		})
+	}
+	return nil
+}
+
+// heartbeatAction handles the application-level heartbeat sent by clients to measure their latency.
+// The latency reported for the previous heartbeat is recorded for the connection, and the heartbeat is
+// answered on the same connection with its timestamp and the server time.
+func heartbeatAction(ctx eventContext, heartbeat data.HeartbeatData) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Heartbeat Event",
+		Operation:     "Heartbeat",
+		Message:       "Heartbeat received from client: " + ctx.clientID,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	ctx.clients.RecordHeartbeat(ctx.clientKey(), ctx.conn, heartbeat.LatencyMs)
+	payload := data.HeartbeatResponse{
+		Event: data.Event{Event: data.HEARTBEAT},
+		Data:  data.HeartbeatAck{Timestamp: heartbeat.Timestamp, ServerTime: time.Now().UnixMilli()},
+	}
+	if err := ctx.clients.SendHeartbeatToConnection(ctx.clientKey(), ctx.conn, payload); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Heartbeat Event",
+			Operation:     "SendHeartbeat",
+			Message:       "Failed to send heartbeat to client " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+			Error:         err,
+		})
+	}
+	return nil
+}
+
+// notificationActionTriggeredAction handles the event sent when the user clicks an action button of a
+// notification. The notificationService records the action and forwards it to the source app.
+// Returns an error if the notification or the action does not exist.
+func notificationActionTriggeredAction(notificationService notificationService.NotificationService, ctx eventContext, target data.NotificationActionTarget) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Notification Action Event",
+		Operation:     "NotificationActionTriggered",
+		Message:       "Action " + target.ActionId + " triggered for client: " + ctx.clientID + ", Notification ID: " + target.Id,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	_, err := notificationService.TriggerAction(ctx, ctx.tenantId, ctx.clientID, target, ctx.correlationId)
+	return err
+}
+
+// listDevicesAction handles the event to list the active connections of a given client.
+// It answers with a listDevices event carrying the device metadata of each connection.
+func listDevicesAction(ctx eventContext) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket List Devices Event",
+		Operation:     "ListDevices",
+		Message:       "Listing devices for client: " + ctx.clientID,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	sendDevicesToClient(ctx)
+	return nil
+}
+
+// disconnectDeviceAction handles the event to force-disconnect one of the client's own connections,
+// identified by its connection ID or deviceId. The targeted socket is closed with the deviceDisconnected
+// reason and the updated device list is sent to the remaining connections.
+// Returns an error if the client has no such device.
+func disconnectDeviceAction(ctx eventContext, target data.DeviceTarget) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "WebSocket Disconnect Device Event",
+		Operation:     "DisconnectDevice",
+		Message:       "Disconnecting device " + target.Id + " for client: " + ctx.clientID,
+		UserId:        ctx.clientID,
+		CorrelationId: ctx.correlationId,
+	})
+	if err := ctx.clients.DisconnectDevice(ctx.clientKey(), target.Id); err != nil {
+		return err
+	}
+	if ctx.clients.IsConnected(ctx.clientKey()) {
+		sendDevicesToClient(ctx)
+	}
+	return nil
+}
+
+// sendDevicesToClient sends the active connections of the client as a listDevices event.
+func sendDevicesToClient(ctx eventContext) {
+	payload := data.DeviceList{
+		Event: data.Event{Event: data.LIST_DEVICES},
+		Data:  ctx.clients.ListDevices(ctx.clientKey()),
+	}
+	if err := ctx.clients.SendDeviceListToUser(ctx.clientKey(), payload); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket List Devices Event",
+			Operation:     "SendDevices",
+			Message:       "Failed to send devices to client " + ctx.clientID,
+			UserId:        ctx.clientID,
+			CorrelationId: ctx.correlationId,
+			Error:         err,
+		})
+	}
+}
+
+// sendErrorToClient sends an error frame for the given failed event to the connection of the client that sent it, so the
+// client can react to the failure instead of waiting for a response that never arrives. The other devices of the user
+// are not told. The frame carries the error code and client-safe message of the error along with the correlation ID.
+func sendErrorToClient(ctx eventContext, event string, err error) {
+	clientKey, correlationId := ctx.clientKey(), ctx.correlationId
+	payload := data.ErrorEvent{
+		Event: data.Event{Event: data.ERROR_EVENT},
+		Data: data.ErrorDetail{
+			Code:          string(apperrors.KindOf(err)),
+			Message:       apperrors.MessageOf(err),
+			Event:         event,
+			CorrelationId: correlationId,
+		},
+	}
+	if sendErr := ctx.clients.SendErrorToConnection(clientKey, ctx.conn, payload); sendErr != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "WebSocket Error Handler",
+			Operation:     "SendError",
+			Message:       "Failed to send error frame to client " + clientKey,
+			UserId:        clientKey,
+			CorrelationId: correlationId,
+			Error:         sendErr,
+		})
+	}
+}
+
+// toJSON decodes a binary event with the connection's encoder and re-encodes it as JSON.
+func toJSON(encoder clientStore.Encoder, message []byte) ([]byte, error) {
+	var event map[string]interface{}
+	if err := encoder.Unmarshal(message, &event); err != nil {
+		return nil, err
+	}
+	return json.Marshal(event)
 }
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"r2-notify-server/models"
+	clientStore "r2-notify-server/services"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketConn is the WebSocket connection the handler reads events from and writes frames to.
+// *websocket.Conn implements it; tests can drive the handler with a fake connection instead of a real socket.
+type WebSocketConn interface {
+	clientStore.Connection
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadLimit(limit int64)
+	SetReadDeadline(t time.Time) error
+	SetPongHandler(handler func(appData string) error)
+	Subprotocol() string
+}
+
+// Upgrader upgrades HTTP requests to WebSocket connections. On failure, the upgrader has already
+// replied to the request.
+type Upgrader interface {
+	Upgrade(w http.ResponseWriter, r *http.Request) (WebSocketConn, error)
+}
+
+// gorillaUpgrader upgrades requests with gorilla/websocket.
+type gorillaUpgrader struct {
+	upgrader *websocket.Upgrader
+}
+
+func (u gorillaUpgrader) Upgrade(w http.ResponseWriter, r *http.Request) (WebSocketConn, error) {
+	conn, err := u.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ClientRegistry registers the connections accepted by the WebSocket handler and records their activity.
+// ClientStoreRegistry is backed by a client store.
+type ClientRegistry interface {
+	// StoreClient registers a connection of the client, see clientStore.StoreClient.
+	StoreClient(info models.ClientInfo, conn clientStore.Connection, encoder clientStore.Encoder, device models.DeviceInfo) error
+	// RemoveConnection unregisters a connection of the user, see clientStore.RemoveConnection.
+	RemoveConnection(userId string, conn clientStore.Connection)
+	// TouchConnection records activity on the connection, see clientStore.TouchConnection.
+	TouchConnection(conn clientStore.Connection)
+	// RefreshConnectionHeartbeat extends the heartbeat key of the connection, see clientStore.RefreshConnectionHeartbeat.
+	RefreshConnectionHeartbeat(userId string, conn clientStore.Connection)
+}
+
+// clientStoreRegistry registers connections in a client store.
+type clientStoreRegistry struct {
+	clients *clientStore.ClientStore
+}
+
+// ClientStoreRegistry returns the ClientRegistry backed by the given client store.
+func ClientStoreRegistry(clients *clientStore.ClientStore) ClientRegistry {
+	return clientStoreRegistry{clients: clients}
+}
+
+func (r clientStoreRegistry) StoreClient(info models.ClientInfo, conn clientStore.Connection, encoder clientStore.Encoder, device models.DeviceInfo) error {
+	return r.clients.StoreClient(info, conn, encoder, device)
+}
+
+func (r clientStoreRegistry) RemoveConnection(userId string, conn clientStore.Connection) {
+	r.clients.RemoveConnection(userId, conn)
+}
+
+func (clientStoreRegistry) TouchConnection(conn clientStore.Connection) {
+	clientStore.TouchConnection(conn)
+}
+
+func (r clientStoreRegistry) RefreshConnectionHeartbeat(userId string, conn clientStore.Connection) {
+	r.clients.RefreshConnectionHeartbeat(userId, conn)
+}
+
+// Clock tells the time and creates tickers, so tests can control the keep-alive of connections.
+type Clock interface {
+	Now() time.Time
+	NewTicker(interval time.Duration) Ticker
+}
+
+// Ticker delivers ticks on C until it is stopped.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// systemClock is the Clock of the system.
+type systemClock struct{}
+
+// SystemClock returns the Clock of the system.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(interval time.Duration) Ticker {
+	return systemTicker{time.NewTicker(interval)}
+}
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t systemTicker) Stop() {
+	t.ticker.Stop()
+}
@@ -0,0 +1,105 @@
+package health
+
+// Package health contains the monitors pinging the dependencies in the background, so readiness checks report
+// their state without calling them on every probe.
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	mongoStatus = data.MongoHealth{Healthy: true}
+	mongoMutex  sync.RWMutex
+)
+
+// MongoStatus returns the result of the last MongoDB pings. MongoDB is reported healthy until
+// MONGO_HEALTH_FAILURE_THRESHOLD consecutive pings have failed, and while the monitor is disabled.
+// It is safe to call this function concurrently from multiple goroutines.
+func MongoStatus() data.MongoHealth {
+	mongoMutex.RLock()
+	defer mongoMutex.RUnlock()
+	return mongoStatus
+}
+
+// StartMongoMonitor pings MongoDB every MONGO_HEALTH_CHECK_SECONDS and records the outcome reported by
+// MongoStatus, along with the ping latency in the mongo.ping.latency histogram. The monitor is disabled
+// when the interval is 0 and otherwise runs until the context is cancelled.
+func StartMongoMonitor(ctx context.Context, client *mongo.Client) {
+	cfg := config.LoadConfig()
+	if cfg.MongoHealthCheckSeconds <= 0 {
+		logger.Log.Info(logger.LogPayload{
+			Message:   "MongoDB health check interval not configured, readiness does not report MongoDB",
+			Component: "Health",
+			Operation: "StartMongoMonitor",
+		})
+		return
+	}
+	interval := time.Duration(cfg.MongoHealthCheckSeconds) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down MongoDB health monitor",
+				Component: "Health",
+				Operation: "Shutdown MongoDB Monitor",
+			})
+			return
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, interval)
+			start := time.Now()
+			err := client.Ping(pingCtx, nil)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			recordMongoPing(time.Since(start), err, cfg.MongoHealthFailureThreshold)
+		}
+	}
+}
+
+// recordMongoPing updates the MongoDB status with the outcome of a ping, logging the transitions between
+// healthy and unhealthy.
+func recordMongoPing(latency time.Duration, err error, failureThreshold int) {
+	metrics.Observe("mongo.ping.latency", latency.Milliseconds())
+	mongoMutex.Lock()
+	defer mongoMutex.Unlock()
+	mongoStatus.LastCheckedAt = time.Now().UTC()
+	mongoStatus.LatencyMs = latency.Milliseconds()
+	if err == nil {
+		if !mongoStatus.Healthy {
+			logger.Log.Info(logger.LogPayload{
+				Message:   fmt.Sprintf("MongoDB is reachable again after %d failed pings", mongoStatus.ConsecutiveFailures),
+				Component: "Health",
+				Operation: "PingMongo",
+			})
+		}
+		mongoStatus.Healthy = true
+		mongoStatus.ConsecutiveFailures = 0
+		mongoStatus.LastError = ""
+		return
+	}
+
+	metrics.Inc("mongo.ping.failed")
+	mongoStatus.ConsecutiveFailures++
+	mongoStatus.LastError = err.Error()
+	if mongoStatus.Healthy && mongoStatus.ConsecutiveFailures >= failureThreshold {
+		mongoStatus.Healthy = false
+		logger.Log.Error(logger.LogPayload{
+			Message:   fmt.Sprintf("MongoDB is unhealthy after %d failed pings", mongoStatus.ConsecutiveFailures),
+			Component: "Health",
+			Operation: "PingMongo",
+			Error:     err,
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Access is the access record of a served HTTP request or WebSocket handshake. Path is the route of the
+// request, such as /notifications/:id/status, so user identifiers in the URL are not logged. Outcome
+// describes how a WebSocket handshake ended and is empty for HTTP requests.
+type Access struct {
+	Method   string
+	Path     string
+	Status   int
+	Latency  time.Duration
+	ClientIP string
+	Outcome  string
+}
+
+// MarshalLogObject writes the access record as the fields of the access object of a log entry.
+func (a *Access) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	encoder.AddString("method", a.Method)
+	encoder.AddString("path", a.Path)
+	encoder.AddInt("status", a.Status)
+	encoder.AddFloat64("latencyMs", latencyMs(a.Latency))
+	if a.ClientIP != "" {
+		encoder.AddString("clientIp", a.ClientIP)
+	}
+	if a.Outcome != "" {
+		encoder.AddString("outcome", a.Outcome)
+	}
+	return nil
+}
+
+// addAccessProperties adds the access record of the payload, if any, to the custom properties of a telemetry item.
+func addAccessProperties(properties map[string]string, payload LogPayload) {
+	if payload.Access == nil {
+		return
+	}
+	properties["method"] = payload.Access.Method
+	properties["path"] = payload.Access.Path
+	properties["status"] = strconv.Itoa(payload.Access.Status)
+	properties["latencyMs"] = strconv.FormatFloat(latencyMs(payload.Access.Latency), 'f', 3, 64)
+	if payload.Access.ClientIP != "" {
+		properties["clientIp"] = payload.Access.ClientIP
+	}
+	if payload.Access.Outcome != "" {
+		properties["outcome"] = payload.Access.Outcome
+	}
+}
+
+// latencyMs returns the latency in milliseconds, with microsecond precision.
+func latencyMs(latency time.Duration) float64 {
+	return float64(latency.Microseconds()) / 1000
+}
@@ -26,7 +26,8 @@ type Logger struct {
 	zapLogger *zap.Logger
 	aiClient  ai.TelemetryClient
 	useAzure  bool
-	minLevel  zapcore.Level
+	level     zap.AtomicLevel
+	piiMode   string // one of data.LOG_PII_*, see sanitize
 }
 
 type LogPayload struct {
@@ -36,6 +37,9 @@ type LogPayload struct {
 	CorrelationId string    // trace ID for distributed tracing
 	UserId        string    // optional
 	AppId         string    // optional
+	ApiKeyId      string    // optional, the API key a request was authenticated with
+	Body          string    // optional, a received payload such as an event body, sanitized with LOG_PII_MODE
+	Access        *Access   // optional, the access record of a served HTTP request or WebSocket handshake
 	Error         error     // optional
 	Timestamp     time.Time // auto-populated
 }
@@ -83,10 +87,13 @@ func Init() {
 //	    Message:   "Connected to Event Hub",
 //	})
 func NewLogger() *Logger {
+	// Get filtered log level from config, it can be changed at runtime with SetLevel
+	level := zap.NewAtomicLevelAt(parseLogLevel(config.LoadConfig().LogLevel))
+
 	instrumentationKey := config.LoadConfig().AppInsightsInstrumentationKey
 	if config.LoadConfig().LogMethod == data.LOG_METHOD_AZURE && instrumentationKey != "" {
 		client := ai.NewTelemetryClient(instrumentationKey)
-		return &Logger{aiClient: client, useAzure: true}
+		return &Logger{aiClient: client, useAzure: true, level: level, piiMode: config.LoadConfig().LogPiiMode}
 	}
 
 	// File logger with rotation
@@ -105,24 +112,21 @@ func NewLogger() *Logger {
 	encoderCfg.TimeKey = "timestamp"
 	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
 
-	// Get filtered log level from config
-	filteredLevel := getLogLevel()
-
 	fileCore := zapcore.NewCore(
 		zapcore.NewJSONEncoder(encoderCfg),
 		fileWriter,
-		filteredLevel,
+		level,
 	)
 
 	consoleCore := zapcore.NewCore(
 		zapcore.NewConsoleEncoder(encoderCfg),
 		consoleWriter,
-		filteredLevel,
+		level,
 	)
 
 	core := zapcore.NewTee(fileCore, consoleCore)
 
-	return &Logger{zapLogger: zap.New(core), useAzure: false}
+	return &Logger{zapLogger: zap.New(core), useAzure: false, level: level, piiMode: config.LoadConfig().LogPiiMode}
 }
 
 func NewTestSink(level zapcore.Level) *TestSink {
@@ -141,7 +145,7 @@ func NewTestSink(level zapcore.Level) *TestSink {
 
 	return &TestSink{
 		Buffer: buf,
-		Logger: &Logger{zapLogger: zap.New(core), useAzure: false},
+		Logger: &Logger{zapLogger: zap.New(core), useAzure: false, level: zap.NewAtomicLevelAt(level)},
 	}
 }
 
@@ -179,6 +183,7 @@ func (l *Logger) Info(payload LogPayload) {
 		return
 	}
 	payload.Timestamp = time.Now()
+	payload = l.sanitize(payload)
 	if l.useAzure {
 		trace := ai.NewTraceTelemetry(payload.Message, ai.Information)
 		trace.Properties["service"] = data.SERVICE_NAME
@@ -187,6 +192,13 @@ func (l *Logger) Info(payload LogPayload) {
 		trace.Properties["correlationId"] = payload.CorrelationId
 		trace.Properties["userId"] = payload.UserId
 		trace.Properties["appId"] = payload.AppId
+		if payload.ApiKeyId != "" {
+			trace.Properties["apiKeyId"] = payload.ApiKeyId
+		}
+		if payload.Body != "" {
+			trace.Properties["body"] = payload.Body
+		}
+		addAccessProperties(trace.Properties, payload)
 		l.aiClient.Track(trace)
 	} else {
 		l.zapLogger.Info(payload.Message,
@@ -196,6 +208,9 @@ func (l *Logger) Info(payload LogPayload) {
 			zap.String("correlationId", payload.CorrelationId),
 			zap.String("userId", payload.UserId),
 			zap.String("appId", payload.AppId),
+			apiKeyField(payload),
+			bodyField(payload),
+			accessField(payload),
 			zap.Time("timestamp", payload.Timestamp),
 		)
 	}
@@ -235,6 +250,7 @@ func (l *Logger) Debug(payload LogPayload) {
 		return
 	}
 	payload.Timestamp = time.Now()
+	payload = l.sanitize(payload)
 	if l.useAzure {
 		trace := ai.NewTraceTelemetry(payload.Message, ai.Verbose)
 		trace.Properties["service"] = data.SERVICE_NAME
@@ -243,6 +259,13 @@ func (l *Logger) Debug(payload LogPayload) {
 		trace.Properties["correlationId"] = payload.CorrelationId
 		trace.Properties["userId"] = payload.UserId
 		trace.Properties["appId"] = payload.AppId
+		if payload.ApiKeyId != "" {
+			trace.Properties["apiKeyId"] = payload.ApiKeyId
+		}
+		if payload.Body != "" {
+			trace.Properties["body"] = payload.Body
+		}
+		addAccessProperties(trace.Properties, payload)
 		l.aiClient.Track(trace)
 	} else {
 		l.zapLogger.Debug(payload.Message,
@@ -252,6 +275,9 @@ func (l *Logger) Debug(payload LogPayload) {
 			zap.String("correlationId", payload.CorrelationId),
 			zap.String("userId", payload.UserId),
 			zap.String("appId", payload.AppId),
+			apiKeyField(payload),
+			bodyField(payload),
+			accessField(payload),
 			zap.Time("timestamp", payload.Timestamp),
 		)
 	}
@@ -290,6 +316,7 @@ func (l *Logger) Warn(payload LogPayload) {
 		return
 	}
 	payload.Timestamp = time.Now()
+	payload = l.sanitize(payload)
 	if l.useAzure {
 		trace := ai.NewTraceTelemetry(payload.Message, ai.Warning)
 		trace.Properties["service"] = data.SERVICE_NAME
@@ -298,6 +325,13 @@ func (l *Logger) Warn(payload LogPayload) {
 		trace.Properties["correlationId"] = payload.CorrelationId
 		trace.Properties["userId"] = payload.UserId
 		trace.Properties["appId"] = payload.AppId
+		if payload.ApiKeyId != "" {
+			trace.Properties["apiKeyId"] = payload.ApiKeyId
+		}
+		if payload.Body != "" {
+			trace.Properties["body"] = payload.Body
+		}
+		addAccessProperties(trace.Properties, payload)
 		l.aiClient.Track(trace)
 	} else {
 		l.zapLogger.Warn(payload.Message,
@@ -307,6 +341,9 @@ func (l *Logger) Warn(payload LogPayload) {
 			zap.String("correlationId", payload.CorrelationId),
 			zap.String("userId", payload.UserId),
 			zap.String("appId", payload.AppId),
+			apiKeyField(payload),
+			bodyField(payload),
+			accessField(payload),
 			zap.Time("timestamp", payload.Timestamp),
 		)
 	}
@@ -347,6 +384,7 @@ func (l *Logger) Error(payload LogPayload) {
 		return
 	}
 	payload.Timestamp = time.Now()
+	payload = l.sanitize(payload)
 	if l.useAzure {
 		trace := ai.NewTraceTelemetry(payload.Message, ai.Error)
 		trace.Properties["service"] = data.SERVICE_NAME
@@ -355,6 +393,13 @@ func (l *Logger) Error(payload LogPayload) {
 		trace.Properties["correlationId"] = payload.CorrelationId
 		trace.Properties["userId"] = payload.UserId
 		trace.Properties["appId"] = payload.AppId
+		if payload.ApiKeyId != "" {
+			trace.Properties["apiKeyId"] = payload.ApiKeyId
+		}
+		if payload.Body != "" {
+			trace.Properties["body"] = payload.Body
+		}
+		addAccessProperties(trace.Properties, payload)
 		if payload.Error != nil {
 			trace.Properties["error"] = payload.Error.Error()
 		}
@@ -367,6 +412,9 @@ func (l *Logger) Error(payload LogPayload) {
 			zap.String("correlationId", payload.CorrelationId),
 			zap.String("userId", payload.UserId),
 			zap.String("appId", payload.AppId),
+			apiKeyField(payload),
+			bodyField(payload),
+			accessField(payload),
 			zap.Time("timestamp", payload.Timestamp),
 		}
 		if payload.Error != nil {
@@ -376,9 +424,14 @@ func (l *Logger) Error(payload LogPayload) {
 	}
 }
 
-// Get log level from config
-func getLogLevel() zapcore.Level {
-	switch config.LoadConfig().LogLevel {
+// SetLevel changes the minimum level of the logger at runtime. Unknown levels fall back to info.
+func SetLevel(value string) {
+	Log.level.SetLevel(parseLogLevel(value))
+}
+
+// Parse the configured log level, defaulting to info
+func parseLogLevel(value string) zapcore.Level {
+	switch value {
 	case data.DEBUG:
 		return zapcore.DebugLevel
 	case data.INFO:
@@ -394,7 +447,7 @@ func getLogLevel() zapcore.Level {
 
 // Should log checks if the given log level meets the minimum level set in the logger.
 func (l *Logger) shouldLog(level zapcore.Level) bool {
-	return level >= l.minLevel
+	return l.level.Enabled(level)
 }
 
 // Flush ensures logs are written before shutdown
@@ -405,3 +458,27 @@ func (l *Logger) Flush() {
 		_ = l.zapLogger.Sync()
 	}
 }
+
+// apiKeyField returns the apiKeyId log field, which is omitted when the payload carries no API key.
+func apiKeyField(payload LogPayload) zap.Field {
+	if payload.ApiKeyId == "" {
+		return zap.Skip()
+	}
+	return zap.String("apiKeyId", payload.ApiKeyId)
+}
+
+// bodyField returns the body log field, which is omitted when the payload carries no body.
+func bodyField(payload LogPayload) zap.Field {
+	if payload.Body == "" {
+		return zap.Skip()
+	}
+	return zap.String("body", payload.Body)
+}
+
+// accessField returns the access log field, which is omitted when the payload carries no access record.
+func accessField(payload LogPayload) zap.Field {
+	if payload.Access == nil {
+		return zap.Skip()
+	}
+	return zap.Object("access", payload.Access)
+}
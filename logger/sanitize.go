@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"r2-notify-server/data"
+)
+
+// Replacement of the values removed with LOG_PII_MODE=redact.
+const redacted = "[REDACTED]"
+
+// Minimum length of a user ID replaced inside free text, so short IDs do not mangle unrelated words.
+const minUserIdLength = 3
+
+// piiFields matches the JSON string values of the fields carrying notification contents or user identifiers,
+// such as those of the event payloads logged by the consumers.
+var piiFields = regexp.MustCompile(`"(message|title|userId|recipientId|senderId|senderName|senderAvatarUrl)"(\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+
+// sanitizedError replaces an error whose message was sanitized, keeping the error field of the log entry.
+type sanitizedError string
+
+func (e sanitizedError) Error() string {
+	return string(e)
+}
+
+// sanitize removes the notification contents and user identifiers from the payload according to the PII
+// mode of the logger. The UserId field is replaced by its hash or redacted, and so are its occurrences in
+// Message, Body and Error, as well as the JSON values of the notification and user fields of piiFields.
+// The client IP of an access record is masked too. Payloads are left unchanged with LOG_PII_MODE=off.
+func (l *Logger) sanitize(payload LogPayload) LogPayload {
+	if l.piiMode != data.LOG_PII_HASH && l.piiMode != data.LOG_PII_REDACT {
+		return payload
+	}
+	userId := payload.UserId
+	if userId != "" {
+		payload.UserId = l.mask(userId)
+	}
+	payload.Message = l.sanitizeText(payload.Message, userId)
+	payload.Body = l.sanitizeText(payload.Body, userId)
+	if payload.Error != nil {
+		payload.Error = sanitizedError(l.sanitizeText(payload.Error.Error(), userId))
+	}
+	if payload.Access != nil && payload.Access.ClientIP != "" {
+		access := *payload.Access
+		access.ClientIP = l.mask(access.ClientIP)
+		payload.Access = &access
+	}
+	return payload
+}
+
+// sanitizeText masks the user ID and the values of the piiFields in free text.
+func (l *Logger) sanitizeText(text string, userId string) string {
+	if text == "" {
+		return text
+	}
+	text = piiFields.ReplaceAllStringFunc(text, func(field string) string {
+		groups := piiFields.FindStringSubmatch(field)
+		return `"` + groups[1] + `"` + groups[2] + `"` + l.mask(groups[3]) + `"`
+	})
+	if len(userId) >= minUserIdLength {
+		text = strings.ReplaceAll(text, userId, l.mask(userId))
+	}
+	return text
+}
+
+// mask returns the hash of the value with LOG_PII_MODE=hash, so the log entries of the same user can still be
+// correlated, or the redacted placeholder otherwise.
+func (l *Logger) mask(value string) string {
+	if l.piiMode != data.LOG_PII_HASH {
+		return redacted
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])[:16]
+}
@@ -7,25 +7,56 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"r2-notify-server/breaker"
+	"r2-notify-server/change-stream/watcher"
 	"r2-notify-server/config"
 	"r2-notify-server/controller"
 	"r2-notify-server/data"
+	"r2-notify-server/encryption"
 	"r2-notify-server/event-hub/consumer"
+	"r2-notify-server/event-hub/producer"
 	"r2-notify-server/handlers"
+	"r2-notify-server/health"
 	"r2-notify-server/logger"
 	"r2-notify-server/middleware"
+	"r2-notify-server/migrations"
+	"r2-notify-server/pipeline"
+	"r2-notify-server/reminder"
+	apiKeyRepository "r2-notify-server/repository/apikey"
+	appRepository "r2-notify-server/repository/app"
+	auditRepository "r2-notify-server/repository/audit"
+	baseRepository "r2-notify-server/repository/base"
 	configurationRepository "r2-notify-server/repository/configuration"
 	notificationRepository "r2-notify-server/repository/notification"
+	originRepository "r2-notify-server/repository/origin"
+	policyRepository "r2-notify-server/repository/policy"
+	retentionRepository "r2-notify-server/repository/retention"
+	webhookRepository "r2-notify-server/repository/webhook"
+	"r2-notify-server/retention"
+	"r2-notify-server/retry"
 	"r2-notify-server/router"
+	clientStore "r2-notify-server/services"
+	apiKeyService "r2-notify-server/services/apikey"
+	appService "r2-notify-server/services/app"
+	auditService "r2-notify-server/services/audit"
+	broadcastService "r2-notify-server/services/broadcast"
 	configurationService "r2-notify-server/services/configuration"
 	notificationService "r2-notify-server/services/notification"
-	"r2-notify-server/utils"
+	originService "r2-notify-server/services/origin"
+	policyService "r2-notify-server/services/policy"
+	retentionService "r2-notify-server/services/retention"
+	simulationService "r2-notify-server/services/simulation"
+	ticketService "r2-notify-server/services/ticket"
+	userService "r2-notify-server/services/user"
+	webhookService "r2-notify-server/services/webhook"
+	"r2-notify-server/tracing"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"github.com/rs/cors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
 	"github.com/joho/godotenv"
 )
@@ -39,6 +70,16 @@ func main() {
 		}
 	}
 
+	// Validate configuration before connecting to any dependency
+	if err := config.Validate(); err != nil {
+		if validationErr, ok := err.(*config.ValidationError); ok {
+			for _, problem := range validationErr.Problems {
+				log.Printf("Configuration error: %s", problem)
+			}
+		}
+		log.Fatalf("Refusing to start with %s", err)
+	}
+
 	// Initiate MongoDB
 	mongoDb := config.MongoConnection()
 	// Init Redis
@@ -49,15 +90,179 @@ func main() {
 	if os.Getenv("ENV") == data.PRODUCTION_ENV {
 		gin.SetMode(gin.ReleaseMode)
 	}
-	// Create Gin router
-	r := gin.Default()
+	// Create Gin router, logging requests through the structured logger instead of the plain text gin logger.
+	// WebSocket handshakes are logged by the WebSocket handler.
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(otelgin.Middleware(config.LoadConfig().OtelServiceName))
 	r.Use(middleware.CorrelationIDMiddleware())
+	r.Use(middleware.AccessLogMiddleware("/ws"))
 
 	logger.Init()
 	defer logger.Log.Flush()
 
-	notificationRepository := notificationRepository.NewNotificationRepositoryImpl(mongoDb)
-	notificationService, err := notificationService.NewNotificationServiceImpl(notificationRepository, validate)
+	// Init tracing
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatalf("Tracing initialization error: %v", err)
+	}
+
+	// Fail MongoDB and Redis calls fast while they are unavailable
+	mongoBreaker := breaker.New(data.DB_DRIVER_MONGO, breaker.IsDatabaseFailure)
+	config.RDB.AddHook(breaker.New("redis", breaker.IsRedisFailure).RedisHook())
+
+	notificationRepository, configurationRepository, transactor := newRepositories(mongoDb, mongoBreaker)
+	if err := notificationRepository.CreateIndexes(); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "NotificationRepository",
+			Message:   "Failed to create notification indexes, search will be unavailable",
+			Error:     err,
+		})
+	}
+	webhookRepository := webhookRepository.NewWebhookRepositoryImpl(mongoDb)
+	webhookService, err := webhookService.NewWebhookServiceImpl(webhookRepository, validate)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "WebhookService",
+			Message:   "Failed to initialize webhook service",
+			Error:     err,
+		})
+		os.Exit(1)
+	}
+	auditRepository := auditRepository.NewAuditRepositoryImpl(mongoDb)
+	if err := auditRepository.CreateIndexes(); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "AuditRepository",
+			Message:   "Failed to create audit log indexes",
+			Error:     err,
+		})
+	}
+	auditService, err := auditService.NewAuditServiceImpl(auditRepository, validate)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "AuditService",
+			Message:   "Failed to initialize audit service",
+			Error:     err,
+		})
+		os.Exit(1)
+	}
+	apiKeyRepository := apiKeyRepository.NewApiKeyRepositoryBreaker(apiKeyRepository.NewApiKeyRepositoryImpl(mongoDb), mongoBreaker)
+	if err := apiKeyRepository.CreateIndexes(); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "ApiKeyRepository",
+			Message:   "Failed to create API key indexes",
+			Error:     err,
+		})
+	}
+	apiKeyService, err := apiKeyService.NewApiKeyServiceImpl(apiKeyRepository, validate)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "ApiKeyService",
+			Message:   "Failed to initialize API key service",
+			Error:     err,
+		})
+		os.Exit(1)
+	}
+	ticketService := ticketService.NewTicketServiceImpl(config.LoadConfig().WsTicketSecret, time.Duration(config.LoadConfig().WsTicketTTLSeconds)*time.Second)
+	originRepository := originRepository.NewOriginRepositoryBreaker(originRepository.NewOriginRepositoryImpl(mongoDb), mongoBreaker)
+	if err := originRepository.CreateIndexes(); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "OriginRepository",
+			Message:   "Failed to create origin allow-list indexes",
+			Error:     err,
+		})
+	}
+	originService, err := originService.NewOriginServiceImpl(originRepository, validate)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "OriginService",
+			Message:   "Failed to initialize origin service",
+			Error:     err,
+		})
+		os.Exit(1)
+	}
+	appRepository := appRepository.NewAppRepositoryBreaker(appRepository.NewAppRepositoryImpl(mongoDb), mongoBreaker)
+	if err := appRepository.CreateIndexes(); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "AppRepository",
+			Message:   "Failed to create app indexes",
+			Error:     err,
+		})
+	}
+	appService, err := appService.NewAppServiceImpl(appRepository, originService, validate)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "AppService",
+			Message:   "Failed to initialize app service",
+			Error:     err,
+		})
+		os.Exit(1)
+	}
+	policyRepository := policyRepository.NewPolicyRepositoryBreaker(policyRepository.NewPolicyRepositoryImpl(mongoDb), mongoBreaker)
+	if err := policyRepository.CreateIndexes(); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "PolicyRepository",
+			Message:   "Failed to create delivery policy indexes",
+			Error:     err,
+		})
+	}
+	deliveryPolicyService, err := policyService.NewPolicyServiceImpl(policyRepository, validate)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "PolicyService",
+			Message:   "Failed to initialize policy service",
+			Error:     err,
+		})
+		os.Exit(1)
+	}
+	retentionRepository := retentionRepository.NewRetentionRepositoryBreaker(retentionRepository.NewRetentionRepositoryImpl(mongoDb), mongoBreaker)
+	if err := retentionRepository.CreateIndexes(); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "RetentionRepository",
+			Message:   "Failed to create retention policy indexes",
+			Error:     err,
+		})
+	}
+	retentionService, err := retentionService.NewRetentionServiceImpl(retentionRepository, validate)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "RetentionService",
+			Message:   "Failed to initialize retention service",
+			Error:     err,
+		})
+		os.Exit(1)
+	}
+	// Apply the delivery policies of the apps to every new notification
+	pipeline.Register(policyService.NewPolicyPlugin(deliveryPolicyService, webhookService))
+	// Connect the optional Event Hub forwarding notification actions to the source apps
+	var actionPublisher notificationService.ActionPublisher
+	publisher, err := producer.NewActionPublisher()
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "ActionPublisher",
+			Message:   "Failed to connect to action Event Hub, actions are only delivered to webhooks",
+			Error:     err,
+		})
+	} else if publisher != nil {
+		actionPublisher = publisher
+		defer publisher.Close()
+	}
+	notificationService, err := notificationService.NewNotificationServiceImpl(notificationRepository, webhookService, auditService, transactor, actionPublisher, validate)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Main",
@@ -67,8 +272,15 @@ func main() {
 		})
 		os.Exit(1)
 	}
-	configurationRepository := configurationRepository.NewConfigurationRepositoryImpl(mongoDb)
-	configurationService, err := configurationService.NewConfigurationServiceImpl(configurationRepository, validate)
+	if err := configurationRepository.CreateIndexes(); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "ConfigurationRepository",
+			Message:   "Failed to create configuration indexes, duplicate configurations are possible",
+			Error:     err,
+		})
+	}
+	userConfigurationService, err := configurationService.NewConfigurationServiceImpl(configurationRepository, validate)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Main",
@@ -79,39 +291,211 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Start Event Hub consumer in a goroutuine to avoid blocking
+	// Register the connections to this instance in memory, and send the display metadata of the registered apps
+	// with their notifications
+	clients := clientStore.NewClientStore(clientStore.NewInMemoryClientRegistry(), appService)
+
+	userService := userService.NewUserServiceImpl(notificationRepository, configurationRepository, userConfigurationService, auditService, transactor, clients)
+
+	broadcastService := broadcastService.NewBroadcastServiceImpl(auditService, clients, validate)
+
+	// Start the consumer of the configured event source in a goroutuine to avoid blocking
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	consumerDone := make(chan struct{})
+	eventSource := consumer.NewEventSource(config.LoadConfig())
 	go func() {
-		if err := consumer.StartEventHubConsumer(ctx, notificationService); err != nil {
+		defer close(consumerDone)
+		err := eventSource.Start(ctx, notificationService, clients)
+		if err != nil && ctx.Err() != nil {
+			// The consumer was shut down, but not every received event was processed in time
+			logger.Log.Warn(logger.LogPayload{
+				Component: "Main",
+				Operation: "Shutdown",
+				Message:   eventSource.Name() + " consumer did not shut down cleanly",
+				Error:     err,
+			})
+			return
+		}
+		if err != nil {
 			logger.Log.Error(logger.LogPayload{
 				Component: "Main",
-				Operation: "EventHubConsumer",
-				Message:   "Failed to start Event Hub consumer",
+				Operation: "EventSourceConsumer",
+				Message:   "Failed to start " + eventSource.Name() + " consumer",
 				Error:     err,
 			})
 			os.Exit(1)
 		}
 	}()
 
+	// Start Redis retry loop flushing client writes queued during a Redis outage
+	go clientStore.StartRedisRetryLoop(ctx)
+
+	// Start webhook delivery workers sending the queued lifecycle events to the webhooks of the apps
+	go webhookService.StartDeliveryWorkers(ctx)
+
+	// Start digest scheduler delivering batched notifications at the end of each digest window
+	go clients.StartDigestScheduler(ctx)
+
+	// Start purge worker removing soft-deleted notifications after the retention period
+	go retention.StartPurgeWorker(ctx, notificationService)
+
+	// Start retention worker deleting notifications of each app after its retention period, nightly
+	go retention.StartRetentionWorker(ctx, retentionService, notificationService)
+
+	// Start reminder scheduler sending the reminders of unread notifications about to expire
+	go reminder.StartReminderScheduler(ctx, notificationService, clients)
+
+	// Start idle connection sweeper closing idle connections of users with notifications disabled
+	go clients.StartIdleConnectionSweeper(ctx)
+
+	// Start dead connection sweeper closing connections whose heartbeat key expired in Redis
+	go clients.StartDeadConnectionSweeper(ctx)
+
+	// Start slow consumer monitor dropping connections that stopped reading their messages
+	go clients.StartSlowConsumerMonitor(ctx)
+
+	// Start read state subscriber syncing read and delete actions to devices connected to other instances
+	go clients.StartReadStateSubscriber(ctx)
+
+	// Start configuration change subscriber dropping the configurations changed on other instances or by other
+	// services from the cache and resending them to the connected users
+	go configurationService.StartChangeSubscriber(ctx, handlers.ConfigurationChangeHandler(userConfigurationService, clients))
+
+	// Start MongoDB health monitor pinging MongoDB for the readiness checks
+	go health.StartMongoMonitor(ctx, mongoDb.Client())
+
+	// Start MongoDB change stream watcher for notifications inserted directly into the database
+	if config.LoadConfig().EnableChangeStreams && config.LoadConfig().DbDriver == data.DB_DRIVER_POSTGRES {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Main",
+			Operation: "ChangeStreamWatcher",
+			Message:   "Change streams are only supported with MongoDB, ignoring ENABLE_CHANGE_STREAMS",
+		})
+	} else if config.LoadConfig().EnableChangeStreams {
+		go func() {
+			if err := watcher.StartChangeStreamWatcher(ctx, mongoDb, notificationService, clients); err != nil {
+				logger.Log.Error(logger.LogPayload{
+					Component: "Main",
+					Operation: "ChangeStreamWatcher",
+					Message:   "Failed to start change stream watcher",
+					Error:     err,
+				})
+			}
+		}()
+	}
+
 	// Create Notification Controller
-	notificationController := controller.NewNotificationController(notificationService)
+	notificationController := controller.NewNotificationController(notificationService, clients, validate)
+
+	// Create Status Controller
+	statusController := controller.NewStatusController(notificationService, clients, validate)
+
+	// Create Configuration Controller
+	configurationController := controller.NewConfigurationController(userConfigurationService, clients, validate)
+
+	// Create Webhook Controller
+	webhookController := controller.NewWebhookController(webhookService, validate)
+
+	// Create Metrics Controller
+	metricsController := controller.NewMetricsController()
+	healthController := controller.NewHealthController()
+
+	// Create Audit Controller
+	auditController := controller.NewAuditController(auditService)
+
+	// Create API Key Controller
+	apiKeyController := controller.NewApiKeyController(apiKeyService, validate)
+
+	// Create Origin Controller
+	originController := controller.NewOriginController(originService)
+
+	// Create App Controller
+	appController := controller.NewAppController(appService)
+
+	// Create Policy Controller
+	policyController := controller.NewPolicyController(deliveryPolicyService)
+
+	// Create Retention Controller
+	retentionController := controller.NewRetentionController(retentionService)
+
+	// Create User Controller
+	userController := controller.NewUserController(userService)
+
+	// Create Broadcast Controller
+	broadcastController := controller.NewBroadcastController(broadcastService)
+
+	// Create Simulation Controller, whose simulations stop on shutdown
+	simulationService := simulationService.NewSimulationServiceImpl(ctx, notificationService, auditService, clients, validate)
+	simulationController := controller.NewSimulationController(simulationService)
+
+	// Create Protocol Controller
+	protocolController := controller.NewProtocolController()
+
+	// Create Device Controller
+	deviceController := controller.NewDeviceController(clients)
+
+	// Create Connection Controller
+	connectionController := controller.NewConnectionController(clients)
+	drainController := controller.NewDrainController(clients)
+
+	// Create Event Hub Controller
+	eventHubController := controller.NewEventHubController()
+
+	// Create Ticket Controller
+	ticketController := controller.NewTicketController(ticketService)
 
 	// Register routes
-	router.RegisterNotificationRoutes(r, notificationController)
+	router.RegisterNotificationRoutes(r, notificationController, apiKeyService)
+	router.RegisterStatusRoutes(r, statusController, apiKeyService)
+	router.RegisterConfigurationRoutes(r, configurationController)
+	router.RegisterWebhookRoutes(r, webhookController, apiKeyService)
+	router.RegisterMetricsRoutes(r, metricsController)
+	router.RegisterHealthRoutes(r, healthController)
+	router.RegisterProtocolRoutes(r, protocolController)
+	router.RegisterAuditRoutes(r, auditController)
+	router.RegisterApiKeyRoutes(r, apiKeyController)
+	router.RegisterOriginRoutes(r, originController)
+	router.RegisterAppRoutes(r, appController)
+	router.RegisterPolicyRoutes(r, policyController)
+	router.RegisterRetentionRoutes(r, retentionController)
+	router.RegisterUserRoutes(r, userController, apiKeyService)
+	router.RegisterBroadcastRoutes(r, broadcastController)
+	router.RegisterSimulationRoutes(r, simulationController)
+	router.RegisterDeviceRoutes(r, deviceController)
+	router.RegisterConnectionRoutes(r, connectionController)
+	router.RegisterDrainRoutes(r, drainController)
+	router.RegisterEventHubRoutes(r, eventHubController)
+	router.RegisterTicketRoutes(r, ticketController, apiKeyService)
+
+	// Allowed origins are shared by the WebSocket origin check and CORS, and can be reloaded with SIGHUP
+	handlers.SetAllowedOrigins(config.LoadConfig().AllowedOrigins)
+	go watchConfigReload(ctx)
 
 	// Register WebSocket route
+	webSocketHandler := handlers.NewWebSocketHandler(ctx, config.LoadConfig(), clients, notificationService, userConfigurationService, originService, ticketService)
 	r.GET("/ws", func(c *gin.Context) {
-		handlers.NewWebSocketHandler(notificationService, configurationService)(c.Writer, c.Request)
+		webSocketHandler.ServeHTTP(c.Writer, c.Request)
+	})
+
+	// Register Server-Sent Events route for clients that cannot use WebSockets
+	sseHandler := handlers.NewSSEHandler(ctx, clients, notificationService, userConfigurationService, ticketService)
+	r.GET("/sse", func(c *gin.Context) {
+		sseHandler(c.Writer, c.Request)
 	})
 
-	// Enable CORS for all origins
-	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   utils.ProcessAllowedOrigins(config.LoadConfig().AllowedOrigins),
-		AllowedMethods:   []string{"POST", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "X-User-ID", "X-Correlation-ID", "X-App-ID"},
-		AllowCredentials: true,
-	}).Handler(r)
+	// Apply the CORS policy, with the overrides of CORS_ROUTES_FILE, to every route
+	corsRoutes, err := middleware.LoadCORSRoutes(config.LoadConfig().CorsRoutesFile)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "CORS",
+			Message:   "Failed to load CORS route overrides",
+			Error:     err,
+		})
+		os.Exit(1)
+	}
+	corsHandler := middleware.CORSHandler(r, config.LoadConfig(), handlers.IsAllowedOrigin, corsRoutes)
 
 	srv := &http.Server{
 		Addr:    ":" + config.LoadConfig().Port,
@@ -148,6 +532,18 @@ func main() {
 	})
 	cancel()
 
+	// Wait for the event source consumer to drain queued events and close its connections. The consumer
+	// bounds its own shutdown, the timeout only guards against a consumer that hangs.
+	select {
+	case <-consumerDone:
+	case <-time.After(consumer.ShutdownTimeout() + time.Second):
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Main",
+			Operation: "Shutdown",
+			Message:   "Timed out waiting for " + eventSource.Name() + " consumer to drain",
+		})
+	}
+
 	// Gracefully shutdown HTTP server
 	ctxShutdown, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancelShutdown()
@@ -160,6 +556,16 @@ func main() {
 		})
 		os.Exit(1)
 	}
+
+	// Export the spans that are still buffered
+	if err := shutdownTracing(ctxShutdown); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "Shutdown",
+			Message:   "Failed to flush traces",
+			Error:     err,
+		})
+	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Main",
 		Operation: "Exit",
@@ -167,3 +573,103 @@ func main() {
 	})
 
 }
+
+// watchConfigReload re-reads ALLOWED_ORIGINS and LOG_LEVEL from CONFIG_RELOAD_FILE whenever the process
+// receives SIGHUP and applies them without a restart. Values missing from the file are taken from the
+// environment. Other settings still require a restart. It runs until the context is cancelled.
+func watchConfigReload(ctx context.Context) {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+		}
+		file := config.LoadConfig().ConfigReloadFile
+		values, err := godotenv.Read(file)
+		if err != nil {
+			logger.Log.Warn(logger.LogPayload{
+				Component: "Main",
+				Operation: "ConfigReload",
+				Message:   "Failed to read " + file + ", reloading from the environment",
+				Error:     err,
+			})
+			values = map[string]string{}
+		}
+		origins := values["ALLOWED_ORIGINS"]
+		if origins == "" {
+			origins = config.LoadConfig().AllowedOrigins
+		}
+		level := values["LOG_LEVEL"]
+		if level == "" {
+			level = config.LoadConfig().LogLevel
+		}
+		handlers.SetAllowedOrigins(origins)
+		logger.SetLevel(level)
+		logger.Log.Info(logger.LogPayload{
+			Component: "Main",
+			Operation: "ConfigReload",
+			Message:   fmt.Sprintf("Reloaded configuration, allowed origins: %v, log level: %s", handlers.AllowedOrigins(), level),
+		})
+	}
+}
+
+// newRepositories returns the notification and configuration repositories for the database selected
+// with DB_DRIVER, guarded by the circuit breaker of that database. MongoDB notification queries are retried
+// on transient errors before they count as failures of the breaker. With postgres, the schema migrations are
+// applied before the repositories are returned; the remaining repositories always use MongoDB. The Transactor
+// runs multi-document operations in MongoDB transactions, or without transactions with postgres.
+func newRepositories(mongoDb *mongo.Database, mongoBreaker *breaker.Breaker) (notificationRepository.NotificationRepository, configurationRepository.ConfigurationRepository, baseRepository.Transactor) {
+	if config.LoadConfig().DbDriver != data.DB_DRIVER_POSTGRES {
+		mongoNotifications := notificationRepository.NewNotificationRepositoryRetry(notificationRepository.NewNotificationRepositoryImpl(mongoDb), retry.MongoPolicy())
+		return withEncryption(notificationRepository.NewNotificationRepositoryBreaker(mongoNotifications, mongoBreaker)),
+			configurationRepository.NewConfigurationRepositoryBreaker(configurationRepository.NewConfigurationRepositoryImpl(mongoDb), mongoBreaker),
+			baseRepository.NewMongoTransactor(mongoDb, retry.MongoPolicy())
+	}
+	postgresDb := config.PostgresConnection()
+	if err := migrations.Run(context.Background(), postgresDb); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "PostgresMigrations",
+			Message:   "Failed to apply Postgres migrations",
+			Error:     err,
+		})
+		os.Exit(1)
+	}
+	postgresBreaker := breaker.New(data.DB_DRIVER_POSTGRES, breaker.IsDatabaseFailure)
+	return withEncryption(notificationRepository.NewNotificationRepositoryBreaker(notificationRepository.NewNotificationRepositoryPostgres(postgresDb), postgresBreaker)),
+		configurationRepository.NewConfigurationRepositoryBreaker(configurationRepository.NewConfigurationRepositoryPostgres(postgresDb), postgresBreaker),
+		baseRepository.NewDirectTransactor()
+}
+
+// withEncryption wraps the notification repository so the messages of the apps listed in ENCRYPTED_APPS are encrypted
+// at rest with the keys of ENCRYPTION_KEYS. The repository is returned as is when no app is listed.
+func withEncryption(repository notificationRepository.NotificationRepository) notificationRepository.NotificationRepository {
+	cfg := config.LoadConfig()
+	appIds := cfg.EncryptedAppIds()
+	if len(appIds) == 0 {
+		return repository
+	}
+	keys, err := cfg.EncryptionKeySet()
+	var provider encryption.KeyProvider
+	if err == nil {
+		provider, err = encryption.NewEnvKeyProvider(keys, cfg.EncryptionKeyId)
+	}
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Main",
+			Operation: "NotificationEncryption",
+			Message:   "Failed to load the notification encryption keys",
+			Error:     err,
+		})
+		os.Exit(1)
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Main",
+		Operation: "NotificationEncryption",
+		Message:   fmt.Sprintf("Encrypting notification messages of %d apps with key %s", len(appIds), provider.ActiveKeyId()),
+	})
+	return notificationRepository.NewNotificationRepositoryEncryption(repository, encryption.NewCipher(provider), appIds)
+}
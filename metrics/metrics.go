@@ -0,0 +1,165 @@
+package metrics
+
+// Package metrics holds the in-process counters and gauges exported by the service.
+
+import (
+	"strings"
+	"sync"
+)
+
+// Upper bounds of the buckets of the histograms recording latencies in milliseconds.
+var histogramBuckets = []int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Upper bounds of the buckets of the histograms recording sizes in bytes, up to 1 MiB.
+var sizeBuckets = []int64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// histogram counts the observed values per bucket. Values above the last bound are only
+// included in the total count and sum.
+type histogram struct {
+	bounds  []int64
+	buckets []int64
+	count   int64
+	sum     int64
+}
+
+var (
+	counters   = make(map[string]int64)
+	gauges     = make(map[string]int64)
+	histograms = make(map[string]*histogram)
+	mutex      sync.RWMutex
+)
+
+// Snapshot is a point-in-time copy of all counters, gauges and histograms.
+type Snapshot struct {
+	Counters   map[string]int64             `json:"counters"`
+	Gauges     map[string]int64             `json:"gauges"`
+	Histograms map[string]HistogramSnapshot `json:"histograms"`
+}
+
+// HistogramSnapshot is a copy of a histogram. Bucket counts are cumulative: each bucket counts the
+// values lower than or equal to its bound.
+type HistogramSnapshot struct {
+	Buckets []Bucket `json:"buckets"`
+	Count   int64    `json:"count"`
+	Sum     int64    `json:"sum"`
+}
+
+// Bucket is the number of observed values lower than or equal to Le.
+type Bucket struct {
+	Le    int64 `json:"le"`
+	Count int64 `json:"count"`
+}
+
+// Inc increments the named counter by one.
+// It is safe to call this function concurrently from multiple goroutines.
+func Inc(name string) {
+	Add(name, 1)
+}
+
+// Add increments the named counter by the given delta.
+// It is safe to call this function concurrently from multiple goroutines.
+func Add(name string, delta int64) {
+	mutex.Lock()
+	counters[name] += delta
+	mutex.Unlock()
+}
+
+// SetGauge sets the named gauge to the given value.
+// It is safe to call this function concurrently from multiple goroutines.
+func SetGauge(name string, value int64) {
+	mutex.Lock()
+	gauges[name] = value
+	mutex.Unlock()
+}
+
+// AddGauge adjusts the named gauge by the given delta.
+// It is safe to call this function concurrently from multiple goroutines.
+func AddGauge(name string, delta int64) {
+	mutex.Lock()
+	gauges[name] += delta
+	mutex.Unlock()
+}
+
+// Observe records a latency in milliseconds in the named histogram.
+// It is safe to call this function concurrently from multiple goroutines.
+func Observe(name string, value int64) {
+	observe(name, histogramBuckets, value)
+}
+
+// ObserveSize records a size in bytes in the named histogram.
+// It is safe to call this function concurrently from multiple goroutines.
+func ObserveSize(name string, value int64) {
+	observe(name, sizeBuckets, value)
+}
+
+// observe records a value in the named histogram, created with the given bucket bounds on first use.
+func observe(name string, bounds []int64, value int64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	h, ok := histograms[name]
+	if !ok {
+		h = &histogram{bounds: bounds, buckets: make([]int64, len(bounds))}
+		histograms[name] = h
+	}
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.buckets[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// GetSnapshot returns a copy of all counters, gauges and histograms.
+// It is safe to call this function concurrently from multiple goroutines.
+func GetSnapshot() Snapshot {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	snapshot := Snapshot{
+		Counters:   make(map[string]int64, len(counters)),
+		Gauges:     make(map[string]int64, len(gauges)),
+		Histograms: make(map[string]HistogramSnapshot, len(histograms)),
+	}
+	for name, value := range counters {
+		snapshot.Counters[name] = value
+	}
+	for name, value := range gauges {
+		snapshot.Gauges[name] = value
+	}
+	for name, h := range histograms {
+		buckets := make([]Bucket, len(h.bounds))
+		var cumulative int64
+		for i, bound := range h.bounds {
+			cumulative += h.buckets[i]
+			buckets[i] = Bucket{Le: bound, Count: cumulative}
+		}
+		snapshot.Histograms[name] = HistogramSnapshot{Buckets: buckets, Count: h.count, Sum: h.sum}
+	}
+	return snapshot
+}
+
+// WithPrefix returns the counters, gauges and histograms of the snapshot whose name starts with the prefix.
+func (s Snapshot) WithPrefix(prefix string) Snapshot {
+	filtered := Snapshot{
+		Counters:   make(map[string]int64),
+		Gauges:     make(map[string]int64),
+		Histograms: make(map[string]HistogramSnapshot),
+	}
+	for name, value := range s.Counters {
+		if strings.HasPrefix(name, prefix) {
+			filtered.Counters[name] = value
+		}
+	}
+	for name, value := range s.Gauges {
+		if strings.HasPrefix(name, prefix) {
+			filtered.Gauges[name] = value
+		}
+	}
+	for name, value := range s.Histograms {
+		if strings.HasPrefix(name, prefix) {
+			filtered.Histograms[name] = value
+		}
+	}
+	return filtered
+}
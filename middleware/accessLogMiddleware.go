@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLogMiddleware logs an access record of every served request through the structured logger, with the
+// method, route, status, latency and client IP of the request, its correlation ID, the user and app given by
+// the X-User-ID and X-App-ID headers and the API key it was authenticated with. Server errors are logged at
+// the error level. Requests to the given paths are not logged, for routes such as /ws that log their
+// handshakes themselves. It must be registered after CorrelationIDMiddleware.
+func AccessLogMiddleware(skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+	return func(c *gin.Context) {
+		if skip[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+
+		// Unmatched requests have no route, so their path is logged instead
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		status := c.Writer.Status()
+		payload := logger.LogPayload{
+			Component:     "Access Log",
+			Operation:     "HTTPRequest",
+			Message:       c.Request.Method + " " + path + " " + http.StatusText(status),
+			CorrelationId: c.GetString(data.CORRELATION_ID),
+			UserId:        c.Request.Header.Get("X-User-ID"),
+			AppId:         c.Request.Header.Get("X-App-ID"),
+			ApiKeyId:      c.GetString(data.API_KEY_ID),
+			Access: &logger.Access{
+				Method:   c.Request.Method,
+				Path:     path,
+				Status:   status,
+				Latency:  time.Since(start),
+				ClientIP: utils.ClientIP(c.Request),
+			},
+		}
+		if status >= http.StatusInternalServerError {
+			logger.Log.Error(payload)
+		} else {
+			logger.Log.Info(payload)
+		}
+	}
+}
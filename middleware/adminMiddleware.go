@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminKeyMiddleware restricts a route to admins presenting the X-Admin-Key header matching ADMIN_API_KEY.
+// If no admin key is configured, the admin routes are disabled and every request is rejected.
+func AdminKeyMiddleware() gin.HandlerFunc {
+	adminKey := config.LoadConfig().AdminApiKey
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get("X-Admin-Key")
+		if adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+			correlationId, _ := c.Get("correlationId")
+			logger.Log.Warn(logger.LogPayload{
+				Component:     "Admin Middleware",
+				Operation:     "AdminKeyMiddleware",
+				Message:       "Rejected admin request to " + c.Request.URL.Path,
+				CorrelationId: correlationId.(string),
+			})
+			respondWithError(c, apperrors.Unauthorized("a valid X-Admin-Key header is required"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// respondWithError aborts the request with the status and error body of the given error.
+func respondWithError(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(apperrors.HTTPStatus(err), gin.H{"error": apperrors.MessageOf(err), "code": apperrors.KindOf(err)})
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	apiKeyService "r2-notify-server/services/apikey"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ApiKeyMiddleware authenticates publishers with the X-Api-Key header, which must hold an active API key
+// issued for the app given by the X-App-ID header. The ID of the key is stored in the context under
+// data.API_KEY_ID so the request can be attributed in logs.
+// Unless REQUIRE_API_KEYS is enabled, requests without an X-Api-Key header are let through unauthenticated.
+func ApiKeyMiddleware(service apiKeyService.ApiKeyService) gin.HandlerFunc {
+	return apiKeyMiddleware(service, config.LoadConfig().RequireApiKeys)
+}
+
+// RequiredApiKeyMiddleware authenticates requests like ApiKeyMiddleware, but always requires the X-Api-Key
+// header whatever REQUIRE_API_KEYS is set to. It guards the endpoints that manage the resources of an app,
+// which must not be reachable by anyone who merely knows the ID of the app.
+func RequiredApiKeyMiddleware(service apiKeyService.ApiKeyService) gin.HandlerFunc {
+	return apiKeyMiddleware(service, true)
+}
+
+// apiKeyMiddleware authenticates requests with the X-Api-Key header, letting requests without one through
+// unless required is true.
+func apiKeyMiddleware(service apiKeyService.ApiKeyService, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get("X-Api-Key")
+		appId := c.Request.Header.Get("X-App-ID")
+		correlationId, _ := c.Get(data.CORRELATION_ID)
+		if key == "" && !required {
+			c.Next()
+			return
+		}
+		apiKey, err := service.Authenticate(appId, key)
+		if err != nil {
+			logger.Log.Warn(logger.LogPayload{
+				Component:     "ApiKey Middleware",
+				Operation:     "ApiKeyMiddleware",
+				Message:       "Rejected request to " + c.Request.URL.Path,
+				AppId:         appId,
+				CorrelationId: correlationId.(string),
+				Error:         err,
+			})
+			respondWithError(c, err)
+			return
+		}
+		c.Set(data.API_KEY_ID, apiKey.Id)
+		logger.Log.Info(logger.LogPayload{
+			Component:     "ApiKey Middleware",
+			Operation:     "ApiKeyMiddleware",
+			Message:       "Authenticated request to " + c.Request.URL.Path + " with API key " + apiKey.Prefix,
+			AppId:         appId,
+			ApiKeyId:      apiKey.Id,
+			CorrelationId: correlationId.(string),
+		})
+		c.Next()
+	}
+}
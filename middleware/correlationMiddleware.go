@@ -2,11 +2,16 @@ package middleware
 
 import (
 	"r2-notify-server/logger"
-	"r2-notify-server/utils"
+	"r2-notify-server/tracing"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// CorrelationIDMiddleware stores the correlation ID of the request in the gin context. Requests without an
+// X-Correlation-ID header use the trace ID of the request span, so the logs of a request can be found from
+// its trace; a given header is recorded on the span instead.
 func CorrelationIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Try to get correlation ID from header
@@ -20,15 +25,17 @@ func CorrelationIDMiddleware() gin.HandlerFunc {
 			CorrelationId: correlationID,
 		})
 		if correlationID == "" {
-			correlationID = utils.GenerateUUID()
+			correlationID = tracing.CorrelationId(c.Request.Context())
 			logger.Log.Info(logger.LogPayload{
 				Component:     "Correlation Middleware",
 				Operation:     "CorrelationIDMiddleware",
-				Message:       "X-Correlation-ID is missing, generated new correlation ID",
+				Message:       "X-Correlation-ID is missing, using the trace ID as correlation ID",
 				UserId:        c.Request.Header.Get("X-User-ID"),
 				AppId:         c.Request.Header.Get("X-App-ID"),
 				CorrelationId: correlationID,
 			})
+		} else {
+			trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("correlation.id", correlationID))
 		}
 
 		// Store in gin.Context
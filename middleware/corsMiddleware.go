@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"r2-notify-server/config"
+	"r2-notify-server/utils"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+// CORSRoute overrides the CORS policy for the requests whose path is Path or starts with Path followed by a
+// slash. Omitted fields keep the value of the default policy; allowedOrigins set to an empty list refuses
+// every cross-origin request to the route.
+type CORSRoute struct {
+	Path             string   `json:"path"`
+	AllowedOrigins   []string `json:"allowedOrigins"`
+	AllowedMethods   []string `json:"allowedMethods"`
+	AllowedHeaders   []string `json:"allowedHeaders"`
+	ExposedHeaders   []string `json:"exposedHeaders"`
+	MaxAgeSeconds    *int     `json:"maxAgeSeconds"`
+	AllowCredentials *bool    `json:"allowCredentials"`
+}
+
+// corsPolicy is the handler applying the CORS policy of the requests under a path prefix.
+type corsPolicy struct {
+	prefix  string
+	handler http.Handler
+}
+
+// LoadCORSRoutes reads the per-route CORS overrides from the JSON array in the file at path. An empty path
+// means every route uses the default policy.
+func LoadCORSRoutes(path string) ([]CORSRoute, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var routes []CORSRoute
+	if err := json.Unmarshal(content, &routes); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return nil, fmt.Errorf("%s: route path %q must start with /", path, route.Path)
+		}
+		if route.MaxAgeSeconds != nil && *route.MaxAgeSeconds < 0 {
+			return nil, fmt.Errorf("%s: maxAgeSeconds of %s must not be negative", path, route.Path)
+		}
+	}
+	return routes, nil
+}
+
+// CORSHandler wraps the handler with the CORS policy configured with the CORS_* variables, which answers
+// preflight requests and adds the CORS headers to the responses. The origins of the default policy are
+// checked with allowOrigin, so they follow reloads of ALLOWED_ORIGINS. Requests matching one of the routes
+// use the policy of the route with the longest matching path instead.
+func CORSHandler(handler http.Handler, cfg *config.Config, allowOrigin func(origin string) bool, routes []CORSRoute) http.Handler {
+	defaults := cors.Options{
+		AllowOriginFunc:  allowOrigin,
+		AllowedMethods:   cfg.CorsMethods(),
+		AllowedHeaders:   cfg.CorsHeaders(),
+		ExposedHeaders:   cfg.CorsExposedHeaderNames(),
+		MaxAge:           cfg.CorsMaxAgeSeconds,
+		AllowCredentials: cfg.CorsAllowCredentials,
+	}
+	fallback := cors.New(defaults).Handler(handler)
+	policies := make([]corsPolicy, 0, len(routes))
+	for _, route := range routes {
+		policies = append(policies, corsPolicy{
+			prefix:  strings.TrimSuffix(route.Path, "/"),
+			handler: cors.New(route.options(defaults)).Handler(handler),
+		})
+	}
+	// Longest prefixes first, so the most specific route wins
+	sort.SliceStable(policies, func(i, j int) bool { return len(policies[i].prefix) > len(policies[j].prefix) })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, policy := range policies {
+			if r.URL.Path == policy.prefix || strings.HasPrefix(r.URL.Path, policy.prefix+"/") {
+				policy.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+// options returns the CORS options of the route, taking the omitted fields from the default options.
+func (route CORSRoute) options(defaults cors.Options) cors.Options {
+	options := defaults
+	if route.AllowedOrigins != nil {
+		origins := route.AllowedOrigins
+		options.AllowOriginFunc = func(origin string) bool {
+			return slices.Contains(origins, "*") || slices.ContainsFunc(origins, func(pattern string) bool { return utils.MatchOrigin(pattern, origin) })
+		}
+	}
+	if route.AllowedMethods != nil {
+		options.AllowedMethods = route.AllowedMethods
+	}
+	if route.AllowedHeaders != nil {
+		options.AllowedHeaders = route.AllowedHeaders
+	}
+	if route.ExposedHeaders != nil {
+		options.ExposedHeaders = route.ExposedHeaders
+	}
+	if route.MaxAgeSeconds != nil {
+		options.MaxAge = *route.MaxAgeSeconds
+	}
+	if route.AllowCredentials != nil {
+		options.AllowCredentials = *route.AllowCredentials
+	}
+	return options
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestBodyMiddleware validates the JSON body of the request before it reaches the handler. Bodies larger
+// than MAX_REQUEST_BODY_SIZE bytes are rejected with 413, bodies that are not application/json with 415 and
+// bodies that do not decode into T, for example because they hold a field T does not define, with 400.
+// The body is restored afterwards so the handler can bind it as usual.
+func RequestBodyMiddleware[T any]() gin.HandlerFunc {
+	limit := int64(config.LoadConfig().MaxRequestBodySize)
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			rejectBody(c, apperrors.PayloadTooLarge(fmt.Sprintf("request body must not exceed %d bytes", limit)))
+			return
+		}
+		mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			rejectBody(c, apperrors.UnsupportedMediaType("Content-Type must be application/json"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				rejectBody(c, apperrors.PayloadTooLarge(fmt.Sprintf("request body must not exceed %d bytes", limit)))
+				return
+			}
+			rejectBody(c, apperrors.Validation("failed to read request body", err))
+			return
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		var payload T
+		if err := decoder.Decode(&payload); err != nil {
+			rejectBody(c, apperrors.Validation("invalid request payload", err))
+			return
+		}
+		if decoder.More() {
+			rejectBody(c, apperrors.Validation("request body must hold a single JSON object", nil))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+// rejectBody logs why the request body was rejected and aborts the request with the error.
+func rejectBody(c *gin.Context, err error) {
+	logger.Log.Warn(logger.LogPayload{
+		Component:     "Request Body Middleware",
+		Operation:     "RequestBodyMiddleware",
+		Message:       "Rejected request body of " + c.Request.Method + " " + c.FullPath() + ": " + apperrors.MessageOf(err),
+		AppId:         c.GetHeader("X-App-ID"),
+		CorrelationId: c.GetString(data.CORRELATION_ID),
+		Error:         err,
+	})
+	respondWithError(c, err)
+}
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id          CHAR(24) PRIMARY KEY,
+    app_id      TEXT NOT NULL,
+    user_id     TEXT NOT NULL,
+    group_key   TEXT NOT NULL,
+    message     TEXT NOT NULL,
+    status      TEXT NOT NULL,
+    read_status BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    origin      TEXT NOT NULL DEFAULT '',
+    deleted_at  TIMESTAMPTZ,
+    actions     JSONB,
+    search      TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', message)) STORED
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_created_at ON notifications (user_id, created_at DESC) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS notifications_deleted_at ON notifications (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS notifications_search ON notifications USING GIN (search);
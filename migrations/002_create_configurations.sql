@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS configurations (
+    id                   CHAR(24) PRIMARY KEY,
+    user_id              TEXT NOT NULL UNIQUE,
+    enable_notifications BOOLEAN NOT NULL,
+    digest_apps          JSONB
+);
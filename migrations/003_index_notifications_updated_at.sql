@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS notifications_user_id_updated_at ON notifications (user_id, updated_at);
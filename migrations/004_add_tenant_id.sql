@@ -0,0 +1,5 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE configurations ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE configurations DROP CONSTRAINT IF EXISTS configurations_user_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS configurations_tenant_id_user_id ON configurations (tenant_id, user_id);
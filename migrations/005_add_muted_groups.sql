@@ -0,0 +1 @@
+ALTER TABLE configurations ADD COLUMN IF NOT EXISTS muted_groups JSONB;
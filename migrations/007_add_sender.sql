@@ -0,0 +1,3 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS sender_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS sender_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS sender_avatar_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS collapse_key TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS notifications_collapse_key ON notifications (tenant_id, user_id, app_id, collapse_key) WHERE collapse_key <> '';
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS notifications_app_id_read_status_created_at ON notifications (app_id, read_status, created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS notifications_pinned ON notifications (tenant_id, user_id) WHERE pinned;
@@ -0,0 +1,4 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS remind_at TIMESTAMPTZ;
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS reminded_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS notifications_remind_at ON notifications (remind_at) WHERE reminded_at IS NULL AND read_status = FALSE AND deleted_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS parent_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS notifications_parent_id ON notifications (tenant_id, user_id, parent_id) WHERE parent_id <> '';
@@ -0,0 +1 @@
+ALTER TABLE configurations ADD COLUMN IF NOT EXISTS list_scope TEXT NOT NULL DEFAULT '';
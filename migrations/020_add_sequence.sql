@@ -0,0 +1,2 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS sequence BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS notifications_sequence ON notifications (tenant_id, user_id, sequence) WHERE sequence > 0;
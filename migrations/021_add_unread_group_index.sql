@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS notifications_unread_groups ON notifications (tenant_id, user_id, app_id, group_key) WHERE NOT read_status AND deleted_at IS NULL;
@@ -0,0 +1,142 @@
+package migrations
+
+// Package migrations contains the Postgres schema used when DB_DRIVER is set to postgres.
+
+import (
+	"context"
+	"embed"
+	"path"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/logger"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Run applies the embedded migrations that have not been applied yet, in file name order.
+// Applied migrations are recorded in the schema_migrations table, and each migration runs in its own
+// transaction, so it is safe to call on every startup and from several instances.
+func Run(ctx context.Context, db *pgxpool.Pool) error {
+	if _, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())`); err != nil {
+		return apperrors.DependencyUnavailable("failed to create schema_migrations table", err)
+	}
+
+	versions, err := embeddedVersions()
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		if err := apply(ctx, db, version); err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Postgres Migrations",
+				Operation: "Run",
+				Message:   "Failed to apply migration " + version,
+				Error:     err,
+			})
+			return err
+		}
+	}
+	return nil
+}
+
+// Pending returns the embedded migrations that have not been applied to the database yet, in file name
+// order, without applying them. All migrations are pending if the schema_migrations table does not exist.
+func Pending(ctx context.Context, db *pgxpool.Pool) ([]string, error) {
+	versions, err := embeddedVersions()
+	if err != nil {
+		return nil, err
+	}
+	var exists bool
+	if err := db.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, apperrors.DependencyUnavailable("failed to look up schema_migrations table", err)
+	}
+	if !exists {
+		return versions, nil
+	}
+
+	rows, err := db.Query(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, apperrors.DependencyUnavailable("failed to read schema_migrations", err)
+	}
+	defer rows.Close()
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, apperrors.DependencyUnavailable("failed to read schema_migrations", err)
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.DependencyUnavailable("failed to read schema_migrations", err)
+	}
+
+	var pending []string
+	for _, version := range versions {
+		if !applied[version] {
+			pending = append(pending, version)
+		}
+	}
+	return pending, nil
+}
+
+// embeddedVersions returns the names of the embedded migrations in file name order.
+func embeddedVersions() ([]string, error) {
+	names, err := files.ReadDir(".")
+	if err != nil {
+		return nil, apperrors.Internal("failed to read migrations", err)
+	}
+	versions := make([]string, 0, len(names))
+	for _, entry := range names {
+		if path.Ext(entry.Name()) == ".sql" {
+			versions = append(versions, entry.Name())
+		}
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// apply runs a single migration unless it has already been applied. An advisory lock serializes
+// instances starting at the same time.
+func apply(ctx context.Context, db *pgxpool.Pool, version string) error {
+	script, err := files.ReadFile(version)
+	if err != nil {
+		return apperrors.Internal("failed to read migration "+version, err)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return apperrors.DependencyUnavailable("failed to start migration "+version, err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))`); err != nil {
+		return apperrors.DependencyUnavailable("failed to lock schema_migrations", err)
+	}
+	var applied bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil {
+		return apperrors.DependencyUnavailable("failed to read schema_migrations", err)
+	}
+	if applied {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, string(script)); err != nil {
+		return apperrors.DependencyUnavailable("failed to apply migration "+version, err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+		return apperrors.DependencyUnavailable("failed to record migration "+version, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return apperrors.DependencyUnavailable("failed to commit migration "+version, err)
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Postgres Migrations",
+		Operation: "Run",
+		Message:   "Applied migration " + version,
+	})
+	return nil
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ApiKey is an API key allowed to publish notifications for an app. Only the SHA-256 hash of the
+// key is stored; the prefix identifies the key in listings and logs.
+type ApiKey struct {
+	Id        primitive.ObjectID `bson:"_id,omitempty"`
+	AppId     string             `bson:"appId"`
+	Name      string             `bson:"name"`
+	Prefix    string             `bson:"prefix"`
+	KeyHash   string             `bson:"keyHash"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	RevokedAt *time.Time         `bson:"revokedAt,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// App is the metadata of an app registered in the app registry, shown to users next to the notifications
+// of the app. The origins allowed for the app are kept in its AppOrigins. GroupSummaryThreshold overrides
+// GROUP_SUMMARY_THRESHOLD for the notifications of the app when it is set.
+type App struct {
+	Id                    primitive.ObjectID `bson:"_id,omitempty"`
+	AppId                 string             `bson:"appId"`
+	DisplayName           string             `bson:"displayName"`
+	IconUrl               string             `bson:"iconUrl,omitempty"`
+	OwnerTeam             string             `bson:"ownerTeam,omitempty"`
+	GroupSummaryThreshold *int               `bson:"groupSummaryThreshold,omitempty"`
+	CreatedAt             time.Time          `bson:"createdAt"`
+	UpdatedAt             time.Time          `bson:"updatedAt"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEntry records a destructive or bulk notification operation performed by a user.
+type AuditEntry struct {
+	Id             primitive.ObjectID `bson:"_id,omitempty"`
+	UserId         string             `bson:"userId"`
+	Event          string             `bson:"event"`
+	AppId          string             `bson:"appId,omitempty"`
+	GroupKey       string             `bson:"groupKey,omitempty"`
+	NotificationId string             `bson:"notificationId,omitempty"`
+	ActionId       string             `bson:"actionId,omitempty"`
+	CorrelationId  string             `bson:"correlationId,omitempty"`
+	Affected       int64              `bson:"affected"`
+	CreatedAt      time.Time          `bson:"createdAt"`
+}
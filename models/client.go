@@ -3,7 +3,28 @@ package models
 import "time"
 
 type ClientInfo struct {
-	ID                 string    `json:"id"`
-	ConnectedAt        time.Time `json:"connectedAt"`
-	EnableNotification bool      `json:"enableNotification"`
+	ID                 string         `json:"id"`
+	ConnectedAt        time.Time      `json:"connectedAt"`
+	EnableNotification bool           `json:"enableNotification"`
+	DigestWindows      map[string]int `json:"digestWindows,omitempty"`
+	MutedGroups        []MutedGroup   `json:"mutedGroups,omitempty"`
+	ListScope          string         `json:"listScope,omitempty"`
+}
+
+// DeviceInfo describes a single connection of a user, as captured at handshake time. AppId is the app the
+// client connected for with the appId query parameter, if any. LatencyMs is the round-trip latency last
+// reported by the client with a heartbeat event, received at LastHeartbeatAt.
+type DeviceInfo struct {
+	ConnectionId    string     `json:"connectionId"`
+	DeviceId        string     `json:"deviceId,omitempty"`
+	DeviceType      string     `json:"deviceType"`
+	AppId           string     `json:"appId,omitempty"`
+	UserAgent       string     `json:"userAgent,omitempty"`
+	IP              string     `json:"ip,omitempty"`
+	Transport       string     `json:"transport"`
+	ConnectedAt     time.Time  `json:"connectedAt"`
+	EnvelopeVersion int        `json:"envelopeVersion"`
+	ChunkedLists    bool       `json:"chunkedLists,omitempty"`
+	LatencyMs       *int64     `json:"latencyMs,omitempty"`
+	LastHeartbeatAt *time.Time `json:"lastHeartbeatAt,omitempty"`
 }
@@ -1,11 +1,30 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Configuration struct {
 	Id                  primitive.ObjectID `bson:"_id,omitempty"`
+	TenantId            string             `bson:"tenantId,omitempty"`
 	UserId              string             `bson:"userId"`
 	EnableNotifications bool               `bson:"enableNotifications"`
+	DigestApps          []DigestSetting    `bson:"digestApps,omitempty"`
+	MutedGroups         []MutedGroup       `bson:"mutedGroups,omitempty"`
+	ListScope           string             `bson:"listScope,omitempty"`
+}
+
+// DigestSetting batches the notifications of an app into a digest delivered every WindowMinutes.
+type DigestSetting struct {
+	AppId         string `bson:"appId" json:"appId"`
+	WindowMinutes int    `bson:"windowMinutes" json:"windowMinutes"`
+}
+
+// MutedGroup suppresses the real-time delivery of the notifications of a group of an app until the given time.
+type MutedGroup struct {
+	AppId    string    `bson:"appId" json:"appId"`
+	GroupKey string    `bson:"groupKey" json:"groupKey"`
+	Until    time.Time `bson:"until" json:"until"`
 }
@@ -7,13 +7,141 @@ import (
 )
 
 type Notification struct {
-	Id         primitive.ObjectID `bson:"_id,omitempty"`
-	AppId      string             `bson:"appId"`
-	UserId     string             `bson:"userId"`
-	GroupKey   string             `bson:"groupKey"`
-	Message    string             `bson:"message"`
-	Status     string             `bson:"status"`
-	ReadStatus bool               `bson:"readStatus"`
-	CreatedAt  time.Time          `bson:"createdAt"`
-	UpdatedAt  time.Time          `bson:"updatedAt"`
+	Id         primitive.ObjectID   `bson:"_id,omitempty"`
+	TenantId   string               `bson:"tenantId,omitempty"`
+	AppId      string               `bson:"appId"`
+	UserId     string               `bson:"userId"`
+	GroupKey   string               `bson:"groupKey"`
+	Message    string               `bson:"message"`
+	Status     string               `bson:"status"`
+	ReadStatus bool                 `bson:"readStatus"`
+	CreatedAt  time.Time            `bson:"createdAt"`
+	UpdatedAt  time.Time            `bson:"updatedAt"`
+	Origin     string               `bson:"origin,omitempty"`
+	DeletedAt  *time.Time           `bson:"deletedAt,omitempty"`
+	Actions    []NotificationAction `bson:"actions,omitempty"`
+	// ReadAt is the time the read status was last changed. It is not set on notifications that were
+	// never read.
+	ReadAt *time.Time `bson:"readAt,omitempty"`
+	// SenderId is the user who sent a direct notification, shown with SenderName and SenderAvatarUrl.
+	// Notifications sent by apps have no sender.
+	SenderId        string `bson:"senderId,omitempty"`
+	SenderName      string `bson:"senderName,omitempty"`
+	SenderAvatarUrl string `bson:"senderAvatarUrl,omitempty"`
+	// CollapseKey groups successive notifications that supersede each other, like the progress updates of
+	// a build. A new notification with the same collapse key replaces the previous one of the user and app.
+	CollapseKey string `bson:"collapseKey,omitempty"`
+	// Attachments are the images, links and files shown with the notification.
+	Attachments []NotificationAttachment `bson:"attachments,omitempty"`
+	// Delivery is the outcome of the last attempt to deliver the notification to the user's connections.
+	// It is not set on notifications that were never delivered, like those stored while the server was down.
+	Delivery *NotificationDelivery `bson:"delivery,omitempty"`
+	// Timings records when the notification was enqueued, persisted and delivered, to troubleshoot late
+	// notifications. It is not set on notifications stored before timings were recorded.
+	Timings *NotificationTimings `bson:"timings,omitempty"`
+	// Pinned notifications are listed first and are left out of the operations marking or deleting all
+	// notifications of a user, an app or a group.
+	Pinned bool `bson:"pinned,omitempty"`
+	// UIHints tell clients how to render the notification of the app. They are passed through as they are.
+	UIHints *NotificationUIHints `bson:"uiHints,omitempty"`
+	// Source tells which pipeline and which producer created the notification, to trace unexpected
+	// notifications back to their publisher. It is not set on notifications stored before sources were
+	// recorded, nor on those inserted directly into the database.
+	Source *NotificationSource `bson:"source,omitempty"`
+	// ExpiresAt is the deadline of a notification acting on which is time-limited, like an approval or a
+	// one-time password. RemindAt is when the user is reminded of it if it is still unread, and RemindedAt
+	// when the reminder was sent, so it is sent once.
+	ExpiresAt  *time.Time `bson:"expiresAt,omitempty"`
+	RemindAt   *time.Time `bson:"remindAt,omitempty"`
+	RemindedAt *time.Time `bson:"remindedAt,omitempty"`
+	// Truncated is set when the message was longer than MESSAGE_MAX_LENGTH and was cut.
+	Truncated bool `bson:"truncated,omitempty"`
+	// ParentId is the ID of the root notification of the thread a follow-up belongs to. Threads are one
+	// level deep: a follow-up to a follow-up belongs to the thread of its root.
+	ParentId string `bson:"parentId,omitempty"`
+	// Sequence numbers the notifications of a user in the order they were persisted, so clients can detect
+	// the notifications they missed. A notification replacing another with the same collapse key takes a new
+	// sequence number. Notifications inserted directly into the database are numbered by the change stream
+	// watcher when they are delivered.
+	Sequence int64 `bson:"sequence,omitempty"`
+}
+
+// NotificationDelivery records whether a notification reached the user. Status is one of data.DELIVERY_*;
+// Reason explains why a notification that was only persisted could not be delivered.
+type NotificationDelivery struct {
+	Status string    `bson:"status" json:"status"`
+	Reason string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// NotificationTimings are the timestamps of a notification on its way to the user. EnqueuedAt is the time
+// the publisher enqueued it on Event Hub or Service Bus, and is not set on notifications published over
+// REST. DeliveredAt and LatencyMs, the time from EnqueuedAt, or PersistedAt without it, to DeliveredAt, are
+// only set once the notification was delivered to a connection of the user.
+type NotificationTimings struct {
+	EnqueuedAt  *time.Time `bson:"enqueuedAt,omitempty" json:"enqueuedAt,omitempty"`
+	PersistedAt time.Time  `bson:"persistedAt" json:"persistedAt"`
+	DeliveredAt *time.Time `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+	LatencyMs   *int64     `bson:"latencyMs,omitempty" json:"latencyMs,omitempty"`
+}
+
+// NotificationAction is a button shown with a notification. When the user clicks it, the source app is
+// told which actionId was triggered; the optional URL is opened by the client.
+type NotificationAction struct {
+	Label    string `bson:"label" json:"label" validate:"required"`
+	ActionId string `bson:"actionId" json:"actionId" validate:"required"`
+	Url      string `bson:"url,omitempty" json:"url,omitempty" validate:"omitempty,url"`
+}
+
+// NotificationAttachment is rich media shown with a notification: an image, a link or a file, with an
+// optional thumbnail and size in bytes. Attachments are validated by the notification service.
+type NotificationAttachment struct {
+	Type         string `bson:"type" json:"type"`
+	Url          string `bson:"url" json:"url"`
+	ThumbnailUrl string `bson:"thumbnailUrl,omitempty" json:"thumbnailUrl,omitempty"`
+	Size         int64  `bson:"size,omitempty" json:"size,omitempty"`
+}
+
+// NotificationUIHints are app-specific visuals of a notification, so clients can render it without asking the
+// source app: an icon name or URL, a hex color, a sound name or URL, and whether the notification stays on
+// screen until dismissed. UI hints are validated by the notification service.
+type NotificationUIHints struct {
+	Icon   string `bson:"icon,omitempty" json:"icon,omitempty"`
+	Color  string `bson:"color,omitempty" json:"color,omitempty"`
+	Sound  string `bson:"sound,omitempty" json:"sound,omitempty"`
+	Sticky bool   `bson:"sticky,omitempty" json:"sticky,omitempty"`
+}
+
+// NotificationSource is where a notification came from: the pipeline it entered through, one of
+// data.SOURCE_*, and the service and instance that published it, as given by the publisher.
+type NotificationSource struct {
+	Type     string `bson:"type" json:"type"`
+	Service  string `bson:"service,omitempty" json:"service,omitempty"`
+	Instance string `bson:"instance,omitempty" json:"instance,omitempty"`
+}
+
+// NotificationCount is the number of a user's notifications sharing an appId, groupKey, status, source
+// type and read status, together with the creation time of the oldest of them.
+type NotificationCount struct {
+	AppId      string    `bson:"appId"`
+	GroupKey   string    `bson:"groupKey"`
+	Status     string    `bson:"status"`
+	Source     string    `bson:"source"`
+	ReadStatus bool      `bson:"readStatus"`
+	Count      int64     `bson:"count"`
+	OldestAt   time.Time `bson:"oldestAt"`
+}
+
+// ThreadCount counts the follow-ups of the root notification with the given ID that are not deleted.
+type ThreadCount struct {
+	RootId  string `bson:"_id"`
+	Replies int64  `bson:"replies"`
+	Unread  int64  `bson:"unread"`
+}
+
+// ReadStateChange is a read status change made by a client, possibly while offline, at the given time.
+type ReadStateChange struct {
+	Id         primitive.ObjectID
+	ReadStatus bool
+	ReadAt     time.Time
 }
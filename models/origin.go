@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AppOrigins lists the origins from which WebSocket connections of an app are accepted in addition to
+// ALLOWED_ORIGINS. Origins are exact origins or wildcard patterns such as https://*.example.com.
+type AppOrigins struct {
+	Id        primitive.ObjectID `bson:"_id,omitempty"`
+	AppId     string             `bson:"appId"`
+	Origins   []string           `bson:"origins"`
+	UpdatedAt time.Time          `bson:"updatedAt"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeliveryPolicy is a delivery rule of an app. The enabled policies of an app are evaluated in the delivery
+// pipeline by ascending Order, and the first one whose conditions all match a notification applies its Action.
+type DeliveryPolicy struct {
+	Id         primitive.ObjectID `bson:"_id,omitempty"`
+	AppId      string             `bson:"appId"`
+	Name       string             `bson:"name"`
+	Order      int                `bson:"order"`
+	Enabled    bool               `bson:"enabled"`
+	Conditions []PolicyCondition  `bson:"conditions"`
+	Action     string             `bson:"action"`
+	// Target is the channel notifications are routed to by the route action, such as email.
+	Target    string    `bson:"target,omitempty"`
+	CreatedAt time.Time `bson:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// PolicyCondition compares a field of a notification, or of where it was received, with the given values.
+type PolicyCondition struct {
+	Field    string   `bson:"field" json:"field" validate:"required,oneof=tenantId userId groupKey message status collapseKey senderId source environment"`
+	Operator string   `bson:"operator" json:"operator" validate:"required,oneof=eq neq in notIn contains prefix"`
+	Values   []string `bson:"values" json:"values" validate:"required,min=1,max=50"`
+}
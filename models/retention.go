@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AppRetention is the retention policy of an app: read and unread notifications are deleted once they
+// are older than ReadDays and UnreadDays respectively. Zero keeps them forever.
+type AppRetention struct {
+	Id         primitive.ObjectID `bson:"_id,omitempty"`
+	AppId      string             `bson:"appId"`
+	ReadDays   int                `bson:"readDays"`
+	UnreadDays int                `bson:"unreadDays"`
+	UpdatedAt  time.Time          `bson:"updatedAt"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Webhook struct {
+	Id        primitive.ObjectID `bson:"_id,omitempty"`
+	AppId     string             `bson:"appId"`
+	Url       string             `bson:"url"`
+	Secret    string             `bson:"secret"`
+	Events    []string           `bson:"events"`
+	Enabled   bool               `bson:"enabled"`
+	CreatedAt time.Time          `bson:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt"`
+}
+
+type WebhookDelivery struct {
+	Id         primitive.ObjectID `bson:"_id,omitempty"`
+	DeliveryId string             `bson:"deliveryId"`
+	WebhookId  primitive.ObjectID `bson:"webhookId"`
+	AppId      string             `bson:"appId"`
+	Event      string             `bson:"event"`
+	Attempt    int                `bson:"attempt"`
+	StatusCode int                `bson:"statusCode"`
+	Success    bool               `bson:"success"`
+	Error      string             `bson:"error,omitempty"`
+	CreatedAt  time.Time          `bson:"createdAt"`
+}
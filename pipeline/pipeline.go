@@ -0,0 +1,343 @@
+package pipeline
+
+// Package pipeline runs the registered plugins around the persistence and delivery of new notifications,
+// whether they are published over REST, Event Hub or inserted directly into MongoDB.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	clientStore "r2-notify-server/services"
+	notificationService "r2-notify-server/services/notification"
+	"r2-notify-server/tracing"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrDropped is returned by a BeforePersist or BeforeDeliver hook to filter out a notification and skip the
+// remaining plugins. Notifications dropped before persistence are neither stored nor delivered, those
+// dropped before delivery are stored but not delivered.
+var ErrDropped = errors.New("notification dropped by plugin")
+
+// Context describes where a notification entered the pipeline. The embedded context carries the span of
+// the request or event the notification was received with.
+type Context struct {
+	context.Context
+	Source        string
+	CorrelationId string
+}
+
+// Plugin hooks into the notification pipeline. Plugins are called in the order they were registered.
+// The Before hooks may modify the notification or payload, and abort the pipeline by returning an error;
+// ErrDropped silently filters the notification out, any other error is reported to the publisher.
+// The After hooks are informational. Embed BasePlugin to implement only the hooks a plugin needs.
+type Plugin interface {
+	Name() string
+	BeforePersist(ctx Context, notification *models.Notification) error
+	AfterPersist(ctx Context, notification models.Notification)
+	BeforeDeliver(ctx Context, payload *data.EventNotification) error
+	AfterDeliver(ctx Context, payload data.EventNotification, err error)
+}
+
+// BasePlugin implements every hook of Plugin as a no-op.
+type BasePlugin struct{}
+
+func (BasePlugin) BeforePersist(Context, *models.Notification) error    { return nil }
+func (BasePlugin) AfterPersist(Context, models.Notification)            {}
+func (BasePlugin) BeforeDeliver(Context, *data.EventNotification) error { return nil }
+func (BasePlugin) AfterDeliver(Context, data.EventNotification, error)  {}
+
+var (
+	pluginsMutex sync.RWMutex
+	plugins      []Plugin
+)
+
+// Register adds a plugin to the pipeline. Plugins should be registered on startup, before notifications
+// are received.
+func Register(plugin Plugin) {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+	plugins = append(plugins, plugin)
+	logger.Log.Info(logger.LogPayload{
+		Component: "Pipeline",
+		Operation: "Register",
+		Message:   "Registered pipeline plugin " + plugin.Name(),
+	})
+}
+
+// registered returns the registered plugins.
+func registered() []Plugin {
+	pluginsMutex.RLock()
+	defer pluginsMutex.RUnlock()
+	return plugins
+}
+
+// Create persists a new notification with the notification service and delivers it to the user's
+// connections in clients, running the plugin hooks around both steps. It returns the persisted notification with the
+// outcome and timings of its delivery, which are also recorded on the stored notification.
+// Errors of the BeforePersist hooks and of the notification service, including
+// notificationService.ErrDuplicate, are returned; delivery failures are reported in the delivery outcome
+// rather than as an error, since the notification has been persisted. A notification that replaced the previous one with the same collapse
+// key is returned with the ID of the replaced notification and delivered as a notificationReplaced event.
+// The source of the notification is recorded as the source of the context, along with the producing service
+// and instance given by the caller. Notifications that expire are delivered with the time of their reminder.
+func Create(ctx Context, service notificationService.NotificationService, clients *clientStore.ClientStore, notification models.Notification) (models.Notification, error) {
+	notification.Source = stampSource(ctx, notification.Source)
+	for _, plugin := range registered() {
+		if err := runHook(plugin, "BeforePersist", func() error { return plugin.BeforePersist(ctx, &notification) }); err != nil {
+			reportAbort(ctx, plugin, "BeforePersist", notification.UserId, err)
+			return notification, err
+		}
+	}
+	notification.Timings = persistedTimings(notification.Timings)
+	notification = notificationService.ScheduleReminder(notification)
+	created, err := service.Create(ctx, notification)
+	notification.Id, notification.Sequence = created.Id, created.Sequence
+	event := data.NEW_NOTIFICATION
+	if errors.Is(err, notificationService.ErrReplaced) {
+		event = data.NOTIFICATION_REPLACED
+	} else if err != nil {
+		return notification, err
+	}
+	for _, plugin := range registered() {
+		runHook(plugin, "AfterPersist", func() error { plugin.AfterPersist(ctx, notification); return nil })
+	}
+	delivery, _ := deliver(ctx, service, clients, event, notification)
+	notification.Delivery, notification.Timings = recordDelivery(ctx, service, notification, delivery)
+	return notification, nil
+}
+
+// Deliver sends a persisted notification to the user's connections in clients as a newNotification event, running
+// the BeforeDeliver and AfterDeliver hooks around the delivery, and records the outcome of the delivery
+// with the notification service. It returns the outcome and the error of the delivery or of the
+// BeforeDeliver hook that aborted it.
+func Deliver(ctx Context, service notificationService.NotificationService, clients *clientStore.ClientStore, notification models.Notification) (models.NotificationDelivery, error) {
+	delivery, err := deliver(ctx, service, clients, data.NEW_NOTIFICATION, notification)
+	recordDelivery(ctx, service, notification, delivery)
+	return delivery, err
+}
+
+// recordDelivery stores the outcome of the delivery and the timings of the notification on the notification,
+// counts it in notifications.delivery.<status> and observes the latency of delivered notifications in the
+// notifications.delivery.latency_ms histograms. Failures to store them are only logged, since the delivery
+// happened.
+func recordDelivery(ctx Context, service notificationService.NotificationService, notification models.Notification, delivery models.NotificationDelivery) (*models.NotificationDelivery, *models.NotificationTimings) {
+	metrics.Inc("notifications.delivery." + delivery.Status)
+	timings := deliveryTimings(notification, delivery)
+	if timings.LatencyMs != nil {
+		metrics.Observe("notifications.delivery.latency_ms", *timings.LatencyMs)
+		metrics.Observe("notifications.delivery.latency_ms."+ctx.Source, *timings.LatencyMs)
+	}
+	if err := service.RecordDelivery(ctx, notification.TenantId, notification.UserId, notification.Id, delivery, timings); err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component:     "Pipeline",
+			Operation:     "RecordDelivery",
+			Message:       "Failed to record delivery of notification " + notification.Id.Hex() + " as " + delivery.Status,
+			Error:         err,
+			UserId:        notification.UserId,
+			AppId:         notification.AppId,
+			CorrelationId: ctx.CorrelationId,
+		})
+	}
+	return &delivery, &timings
+}
+
+// stampSource returns the source of a notification entering the pipeline through the source of the context,
+// keeping the producing service and instance given by the publisher.
+func stampSource(ctx Context, source *models.NotificationSource) *models.NotificationSource {
+	stamped := models.NotificationSource{Type: ctx.Source}
+	if source != nil {
+		stamped.Service = source.Service
+		stamped.Instance = source.Instance
+	}
+	return &stamped
+}
+
+// persistedTimings returns the timings of a notification about to be persisted, keeping the time it was
+// enqueued by its publisher.
+func persistedTimings(timings *models.NotificationTimings) *models.NotificationTimings {
+	persisted := models.NotificationTimings{PersistedAt: time.Now()}
+	if timings != nil {
+		persisted.EnqueuedAt = timings.EnqueuedAt
+	}
+	return &persisted
+}
+
+// deliveryTimings returns the timings of the notification after the delivery. Notifications inserted into
+// the database by other writers have no timings and are considered persisted when they were created.
+// The latency is measured from the time the notification was enqueued by its publisher, or persisted when
+// it was published over REST, to its delivery.
+func deliveryTimings(notification models.Notification, delivery models.NotificationDelivery) models.NotificationTimings {
+	timings := models.NotificationTimings{PersistedAt: notification.CreatedAt}
+	if notification.Timings != nil {
+		timings = *notification.Timings
+	}
+	if delivery.Status != data.DELIVERY_DELIVERED {
+		return timings
+	}
+	deliveredAt := delivery.At
+	start := timings.PersistedAt
+	if timings.EnqueuedAt != nil {
+		start = *timings.EnqueuedAt
+	}
+	latency := max(deliveredAt.Sub(start).Milliseconds(), 0)
+	timings.DeliveredAt = &deliveredAt
+	timings.LatencyMs = &latency
+	return timings
+}
+
+// deliver sends a persisted notification to the user's connections as the given event, or as a groupSummary
+// if it is a new notification whose group has reached the group summary threshold of its app. It returns the
+// outcome of the delivery, with the reason a notification was only persisted, and the error behind it.
+func deliver(ctx Context, service notificationService.NotificationService, clients *clientStore.ClientStore, event string, notification models.Notification) (models.NotificationDelivery, error) {
+	var span trace.Span
+	ctx.Context, span = tracing.Start(ctx, "pipeline.deliver", trace.SpanKindInternal,
+		attribute.String("notification.id", notification.Id.Hex()),
+		attribute.String("notification.source", ctx.Source),
+		attribute.String("notification.event", event),
+	)
+	defer span.End()
+
+	payload := data.EventNotification{
+		Event: data.Event{Event: event},
+		Data: data.Notification{
+			Id:              notification.Id.Hex(),
+			TenantId:        notification.TenantId,
+			UserID:          notification.UserId,
+			AppId:           notification.AppId,
+			GroupKey:        notification.GroupKey,
+			Message:         notification.Message,
+			Status:          notification.Status,
+			ReadStatus:      notification.ReadStatus,
+			CreatedAt:       notification.CreatedAt,
+			UpdatedAt:       notification.UpdatedAt,
+			Actions:         notification.Actions,
+			SenderId:        notification.SenderId,
+			SenderName:      notification.SenderName,
+			SenderAvatarUrl: notification.SenderAvatarUrl,
+			CollapseKey:     notification.CollapseKey,
+			Attachments:     notification.Attachments,
+			UIHints:         notification.UIHints,
+			ExpiresAt:       notification.ExpiresAt,
+			RemindAt:        notification.RemindAt,
+			Truncated:       notification.Truncated,
+			ParentId:        notification.ParentId,
+			Sequence:        notification.Sequence,
+		},
+	}
+	for _, plugin := range registered() {
+		if err := runHook(plugin, "BeforeDeliver", func() error { return plugin.BeforeDeliver(ctx, &payload) }); err != nil {
+			reportAbort(ctx, plugin, "BeforeDeliver", notification.UserId, err)
+			return models.NotificationDelivery{Status: data.DELIVERY_PERSISTED, Reason: deliveryReason(err), At: time.Now()}, err
+		}
+	}
+	var status string
+	var err error
+	if summary, ok := summarize(ctx, service, clients, event, notification); ok {
+		status, err = clients.SendGroupSummaryToUser(payload, summary)
+		span.SetAttributes(attribute.Int64("notification.group_count", summary.Count))
+	} else {
+		status, err = clients.SendNotificationToUser(payload, false)
+	}
+	span.SetAttributes(attribute.Bool("notification.delivered", status == data.DELIVERY_DELIVERED), attribute.String("notification.delivery", status))
+	if err != nil {
+		logger.Log.Debug(logger.LogPayload{
+			Component:     "Pipeline",
+			Operation:     "Deliver",
+			Message:       "Notification " + payload.Data.Id + " not delivered",
+			Error:         err,
+			UserId:        payload.Data.UserID,
+			AppId:         payload.Data.AppId,
+			CorrelationId: ctx.CorrelationId,
+		})
+	}
+	for _, plugin := range registered() {
+		runHook(plugin, "AfterDeliver", func() error { plugin.AfterDeliver(ctx, payload, err); return nil })
+	}
+	delivery := models.NotificationDelivery{Status: status, At: time.Now()}
+	if err != nil {
+		delivery.Reason = deliveryReason(err)
+	}
+	return delivery, err
+}
+
+// summarize returns the summary of the group of a new notification when the group has as many unread
+// notifications as the group summary threshold of its app, or more. Notifications of users not connected to
+// this instance are not counted, and when counting fails the notification is sent on its own.
+func summarize(ctx Context, service notificationService.NotificationService, clients *clientStore.ClientStore, event string, notification models.Notification) (data.GroupSummary, bool) {
+	if event != data.NEW_NOTIFICATION || notification.GroupKey == "" {
+		return data.GroupSummary{}, false
+	}
+	threshold := clients.GroupSummaryThreshold(notification.AppId)
+	if threshold <= 0 || !clients.IsConnected(clientStore.UserKey(notification.TenantId, notification.UserId)) {
+		return data.GroupSummary{}, false
+	}
+	summary, err := service.SummarizeGroup(ctx, notification)
+	if err != nil {
+		metrics.Inc("notifications.group_summaries.failed")
+		logger.Log.Warn(logger.LogPayload{
+			Component:     "Pipeline",
+			Operation:     "SummarizeGroup",
+			Message:       "Failed to count the unread notifications of group " + notification.GroupKey + ", sending notification " + notification.Id.Hex() + " on its own",
+			Error:         err,
+			UserId:        notification.UserId,
+			AppId:         notification.AppId,
+			CorrelationId: ctx.CorrelationId,
+		})
+		return data.GroupSummary{}, false
+	}
+	return summary, summary.Count >= int64(threshold)
+}
+
+// deliveryReason returns the reason a notification was not delivered. Application errors are described by
+// their client-safe message, the sentinel errors of the pipeline and client store by their text.
+func deliveryReason(err error) string {
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+	return err.Error()
+}
+
+// runHook calls a hook of the plugin, turning a panic into an internal error so a faulty plugin cannot
+// take down the consumer.
+func runHook(plugin Plugin, hook string, call func() error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			metrics.Inc("pipeline.plugin.panics")
+			err = apperrors.Internal(fmt.Sprintf("plugin %s failed in %s", plugin.Name(), hook), fmt.Errorf("%v", recovered))
+			logger.Log.Error(logger.LogPayload{
+				Component: "Pipeline",
+				Operation: hook,
+				Message:   "Plugin " + plugin.Name() + " panicked",
+				Error:     err,
+			})
+		}
+	}()
+	return call()
+}
+
+// reportAbort logs and counts a notification whose pipeline was aborted by a plugin hook.
+func reportAbort(ctx Context, plugin Plugin, hook string, userId string, err error) {
+	if errors.Is(err, ErrDropped) {
+		metrics.Inc("pipeline.dropped")
+	} else {
+		metrics.Inc("pipeline.rejected")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component:     "Pipeline",
+		Operation:     hook,
+		Message:       "Plugin " + plugin.Name() + " stopped notification from " + ctx.Source + " for userId: " + userId,
+		Error:         err,
+		UserId:        userId,
+		CorrelationId: ctx.CorrelationId,
+	})
+}
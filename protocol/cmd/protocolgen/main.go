@@ -0,0 +1,32 @@
+// Command protocolgen writes the TypeScript definitions of the WebSocket protocol for the client SDKs.
+// With -check, it fails instead if the file differs from the definitions of the current protocol, so
+// builds catch a contract change whose definitions were not regenerated.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"r2-notify-server/protocol"
+)
+
+func main() {
+	out := flag.String("out", "sdk/typescript/protocol.ts", "file the TypeScript definitions are written to")
+	check := flag.Bool("check", false, "fail if the file is not up to date instead of writing it")
+	flag.Parse()
+
+	definitions := protocol.TypeScript()
+	if *check {
+		current, err := os.ReadFile(*out)
+		if err != nil || !bytes.Equal(current, definitions) {
+			fmt.Fprintf(os.Stderr, "%s is out of date, run go generate ./protocol\n", *out)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := os.WriteFile(*out, definitions, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
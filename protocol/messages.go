@@ -0,0 +1,84 @@
+package protocol
+
+import "r2-notify-server/data"
+
+// Message pairs a WebSocket event with the frame it is sent in. Frame is the zero value of the Go type the
+// frame is encoded from or decoded into, so the generated client definitions follow the Go types.
+type Message struct {
+	Event string
+	Frame any
+}
+
+// ClientMessages returns the events sent by clients with the frames the WebSocket handler decodes them into,
+// in the order they are advertised by Describe.
+func ClientMessages() []Message {
+	return []Message{
+		{data.HELLO, data.HelloEvent{}},
+		{data.MARK_AS_READ, data.Event{}},
+		{data.MARK_APP_AS_READ, data.AppEvent{}},
+		{data.MARK_GROUP_AS_READ, data.GroupEvent{}},
+		{data.GROUP_OPENED, data.GroupOpenedEvent{}},
+		{data.MARK_NOTIFICATION_AS_READ, data.NotificationReadEvent{}},
+		{data.SYNC_READ_STATE, data.SyncReadStateEvent{}},
+		{data.UPDATE_NOTIFICATION_STATUS, data.NotificationStatusEvent{}},
+		{data.DELETE_NOTIFICATIONS, data.Event{}},
+		{data.DELETE_APP_NOTIFICATIONS, data.AppEvent{}},
+		{data.DELETE_GROUP_NOTIFICATIONS, data.GroupEvent{}},
+		{data.DELETE_NOTIFICATION, data.NotificationEvent{}},
+		{data.RELOAD_NOTIFICATIONS, data.Event{}},
+		{data.SET_NOTIFICATION_STATUS, data.Configuration{}},
+		{data.PIN_NOTIFICATION, data.NotificationEvent{}},
+		{data.UNPIN_NOTIFICATION, data.NotificationEvent{}},
+		{data.MUTE_GROUP, data.MuteGroupEvent{}},
+		{data.UNMUTE_GROUP, data.GroupEvent{}},
+		{data.SEARCH_NOTIFICATIONS, data.SearchNotificationsEvent{}},
+		{data.GET_NOTIFICATIONS_SINCE, data.GetNotificationsSinceEvent{}},
+		{data.FULL_RESYNC, data.Event{}},
+		{data.RESYNC_FROM_SEQUENCE, data.ResyncFromSequenceEvent{}},
+		{data.NOTIFICATION_ACTION_TRIGGERED, data.NotificationActionEvent{}},
+		{data.LIST_DEVICES, data.Event{}},
+		{data.DISCONNECT_DEVICE, data.DeviceEvent{}},
+		{data.HEARTBEAT, data.HeartbeatEvent{}},
+	}
+}
+
+// ServerMessages returns the events sent by the server with the frames they are encoded from, in the order
+// they are advertised by Describe. Clients connecting with envelope version 2 receive the frames wrapped in
+// a data.Envelope.
+func ServerMessages() []Message {
+	return []Message{
+		{data.HELLO, data.HelloResponse{}},
+		{data.CONNECTED, data.Connected{}},
+		{data.NEW_NOTIFICATION, data.EventNotification{}},
+		{data.NOTIFICATION_REPLACED, data.EventNotification{}},
+		{data.LIST_NOTIFICATIONS, data.NotificationList{}},
+		{data.LIST_NOTIFICATIONS_SUMMARY, data.NotificationListSummary{}},
+		{data.RESUME_NOTIFICATIONS, data.NotificationsResumed{}},
+		{data.NOTIFICATION_UPDATED, data.EventNotification{}},
+		{data.NOTIFICATION_STATUS_UPDATED, data.EventNotification{}},
+		{data.NOTIFICATION_DELETED, data.NotificationChange{}},
+		{data.NOTIFICATIONS_MARKED_READ, data.NotificationChange{}},
+		{data.READ_STATE_SYNCED, data.ReadStateSynced{}},
+		{data.SYSTEM_ANNOUNCEMENT, data.SystemAnnouncement{}},
+		{data.RECONNECT_REQUESTED, data.ReconnectRequested{}},
+		{data.LIST_CONFIGURATIONS, data.Configuration{}},
+		{data.SEARCH_RESULTS, data.NotificationSearchResult{}},
+		{data.NOTIFICATIONS_SINCE, data.NotificationsSince{}},
+		{data.SEQUENCE_RESYNC, data.SequenceResync{}},
+		{data.DIGEST_NOTIFICATION, data.DigestNotification{}},
+		{data.GROUP_SUMMARY, data.GroupSummaryNotification{}},
+		{data.NOTIFICATION_REMINDER, data.EventNotification{}},
+		{data.LIST_DEVICES, data.DeviceList{}},
+		{data.HEARTBEAT, data.HeartbeatResponse{}},
+		{data.ERROR_EVENT, data.ErrorEvent{}},
+	}
+}
+
+// events returns the event names of the messages.
+func events(messages []Message) []string {
+	result := make([]string, 0, len(messages))
+	for _, message := range messages {
+		result = append(result, message.Event)
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package protocol
+
+// Package protocol describes the WebSocket protocol spoken by the service, so client SDKs can
+// negotiate capabilities instead of hard-coding them. The TypeScript definitions of the protocol in
+// sdk/typescript are generated from it with go generate.
+
+import "r2-notify-server/data"
+
+//go:generate go run ./cmd/protocolgen -out ../sdk/typescript/protocol.ts
+
+// Version of the WebSocket protocol. It is increased when events or payloads change incompatibly.
+const Version = "1.0"
+
+// Describe returns the protocol version, the supported event names, wire formats, envelope versions and feature flags.
+func Describe() data.ProtocolInfo {
+	return data.ProtocolInfo{
+		Version: Version,
+		Events: data.ProtocolEvents{
+			Client: events(ClientMessages()),
+			Server: events(ServerMessages()),
+		},
+		Formats:          []string{data.FORMAT_JSON, data.FORMAT_MSGPACK},
+		EnvelopeVersions: []int{data.ENVELOPE_V1, data.ENVELOPE_V2},
+		Features: map[string]bool{
+			"acks":           false,
+			"compression":    false,
+			"pagination":     true,
+			"search":         true,
+			"digests":        true,
+			"deltaSync":      true,
+			"errorFrames":    true,
+			"sse":            true,
+			"devices":        true,
+			"actions":        true,
+			"resume":         true,
+			"mute":           true,
+			"statuses":       true,
+			"heartbeat":      true,
+			"readStateSync":  true,
+			"announcements":  true,
+			"collapse":       true,
+			"attachments":    true,
+			"uiHints":        true,
+			"since":          true,
+			"apps":           true,
+			"chunkedLists":   true,
+			"reminders":      true,
+			"threads":        true,
+			"eventBatches":   true,
+			"welcome":        true,
+			"sequences":      true,
+			"groupSummaries": true,
+		},
+	}
+}
@@ -0,0 +1,163 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"r2-notify-server/data"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types encoded as strings by encoding/json, whatever their kind.
+var stringTypes = map[reflect.Type]bool{
+	reflect.TypeOf(time.Time{}): true,
+}
+
+// TypeScript returns the TypeScript definitions of the protocol: the protocol version, the event names,
+// an interface for every frame and the types they reference, and the unions of the client and server
+// messages discriminated by their event name. Field names and optionality follow the json tags of the
+// Go types, so the definitions match what is sent on the wire.
+func TypeScript() []byte {
+	emitter := &typeScriptEmitter{declared: make(map[reflect.Type]string), names: make(map[string]reflect.Type)}
+	clientMessages := ClientMessages()
+	serverMessages := ServerMessages()
+	for _, message := range append(append([]Message{}, clientMessages...), serverMessages...) {
+		emitter.declare(reflect.TypeOf(message.Frame))
+	}
+	emitter.declare(reflect.TypeOf(data.Envelope{}))
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by protocol/cmd/protocolgen. DO NOT EDIT.\n")
+	out.WriteString("// Definitions of the WebSocket protocol of " + data.SERVICE_NAME + ", see GET /protocol.\n\n")
+	fmt.Fprintf(&out, "export const PROTOCOL_VERSION = %s;\n\n", strconv.Quote(Version))
+	writeEventNames(&out, "ClientEvents", clientMessages)
+	writeEventNames(&out, "ServerEvents", serverMessages)
+	out.WriteString(emitter.declarations.String())
+	writeMessageUnion(&out, emitter, "ClientMessage", "ClientEvents", clientMessages)
+	writeMessageUnion(&out, emitter, "ServerMessage", "ServerEvents", serverMessages)
+	return out.Bytes()
+}
+
+// writeEventNames writes the event names of the messages as a constant object keyed by event name, and the
+// union type of its values.
+func writeEventNames(out *bytes.Buffer, name string, messages []Message) {
+	fmt.Fprintf(out, "export const %s = {\n", name)
+	for _, event := range events(messages) {
+		fmt.Fprintf(out, "  %s: %s,\n", event, strconv.Quote(event))
+	}
+	fmt.Fprintf(out, "} as const;\n\nexport type %sName = (typeof %s)[keyof typeof %s];\n\n", strings.TrimSuffix(name, "s"), name, name)
+}
+
+// writeMessageUnion writes the union of the frames of the messages, each narrowed to its event name.
+func writeMessageUnion(out *bytes.Buffer, emitter *typeScriptEmitter, name string, eventNames string, messages []Message) {
+	fmt.Fprintf(out, "export type %s =\n", name)
+	for i, message := range messages {
+		separator := ""
+		if i == len(messages)-1 {
+			separator = ";"
+		}
+		fmt.Fprintf(out, "  | (%s & { event: (typeof %s)[%s] })%s\n", emitter.declared[reflect.TypeOf(message.Frame)], eventNames, strconv.Quote(message.Event), separator)
+	}
+	out.WriteString("\n")
+}
+
+// typeScriptEmitter declares an interface for every struct type reachable from the frames, once.
+type typeScriptEmitter struct {
+	declarations bytes.Buffer
+	declared     map[reflect.Type]string // struct type -> interface name
+	names        map[string]reflect.Type // interface name -> struct type, to tell apart types with the same name
+}
+
+// declare writes the interface of the struct type and of the struct types it references, unless it has
+// already been written, and returns its name.
+func (e *typeScriptEmitter) declare(t reflect.Type) string {
+	if name, ok := e.declared[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if other, taken := e.names[name]; taken && other != t {
+		// Types of different packages sharing a name, such as data.MutedGroup and models.MutedGroup
+		pkg := path.Base(t.PkgPath())
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	e.declared[t] = name
+	e.names[name] = t
+
+	var body bytes.Buffer
+	e.writeFields(&body, t)
+	fmt.Fprintf(&e.declarations, "export interface %s {\n%s}\n\n", name, body.String())
+	return name
+}
+
+// writeFields writes the fields of the struct type as encoded by encoding/json, inlining embedded structs
+// without a json name.
+func (e *typeScriptEmitter) writeFields(body *bytes.Buffer, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			e.writeFields(body, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		optional := ""
+		if strings.Contains(options, "omitempty") {
+			optional = "?"
+		}
+		fieldType := e.typeOf(field.Type)
+		if field.Type.Kind() == reflect.Pointer && optional == "" {
+			fieldType += " | null"
+		}
+		fmt.Fprintf(body, "  %s%s: %s;\n", name, optional, fieldType)
+	}
+}
+
+// typeOf returns the TypeScript type of a Go type as encoded by encoding/json.
+func (e *typeScriptEmitter) typeOf(t reflect.Type) string {
+	if stringTypes[t] {
+		return "string"
+	}
+	if t.PkgPath() == "go.mongodb.org/mongo-driver/bson/primitive" && t.Name() == "ObjectID" {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return e.typeOf(t.Elem())
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string" // []byte is encoded as base64
+		}
+		return arrayOf(e.typeOf(t.Elem()))
+	case reflect.Map:
+		return "Record<string, " + e.typeOf(t.Elem()) + ">"
+	case reflect.Struct:
+		return e.declare(t)
+	default:
+		return "unknown"
+	}
+}
+
+// arrayOf returns the array type of the element type, parenthesising unions.
+func arrayOf(element string) string {
+	if strings.Contains(element, " ") {
+		return "(" + element + ")[]"
+	}
+	return element + "[]"
+}
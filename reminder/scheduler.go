@@ -0,0 +1,106 @@
+package reminder
+
+// Package reminder sends the reminders of unread notifications that are about to expire, like approvals and
+// one-time passwords, so users act on them before their deadline.
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	clientStore "r2-notify-server/services"
+	notificationService "r2-notify-server/services/notification"
+	"r2-notify-server/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Number of due reminders claimed at once. Batches are claimed until fewer reminders are due.
+const reminderBatchSize = 100
+
+// StartReminderScheduler sends a notificationReminder event for every unread notification whose reminder is
+// due, every REMINDER_CHECK_INTERVAL_SECONDS until the context is cancelled. Every instance runs the scheduler;
+// each reminder is claimed by a single instance and delivered through clients to the user's connections on all
+// instances. The scheduler is disabled when the interval is 0.
+func StartReminderScheduler(ctx context.Context, service notificationService.NotificationService, clients *clientStore.ClientStore) {
+	interval := time.Duration(config.LoadConfig().ReminderCheckIntervalSeconds) * time.Second
+	if interval <= 0 {
+		logger.Log.Info(logger.LogPayload{
+			Message:   "Reminder check interval not configured, notification reminders are disabled",
+			Component: "Reminder Scheduler",
+			Operation: "StartReminderScheduler",
+		})
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down reminder scheduler",
+				Component: "Reminder Scheduler",
+				Operation: "Shutdown Reminder Scheduler",
+			})
+			return
+		case now := <-ticker.C:
+			sendDueReminders(ctx, service, clients, now)
+		}
+	}
+}
+
+// sendDueReminders claims and sends the reminders due at the given time, traced as its own span.
+func sendDueReminders(ctx context.Context, service notificationService.NotificationService, clients *clientStore.ClientStore, now time.Time) {
+	ctx, span := tracing.Start(ctx, "reminder.send", trace.SpanKindInternal)
+	sent := 0
+	var err error
+	for ctx.Err() == nil {
+		var due []data.Notification
+		due, err = service.ClaimDueReminders(ctx, now, reminderBatchSize)
+		for _, notification := range due {
+			sendReminder(clients, notification)
+		}
+		sent += len(due)
+		if err != nil || len(due) < reminderBatchSize {
+			break
+		}
+	}
+	tracing.End(span, err)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Reminder Scheduler",
+			Operation: "SendDueReminders",
+			Message:   "Failed to claim due notification reminders",
+			Error:     err,
+		})
+	}
+	if sent > 0 {
+		logger.Log.Info(logger.LogPayload{
+			Component: "Reminder Scheduler",
+			Operation: "SendDueReminders",
+			Message:   fmt.Sprintf("Sent %d notification reminders", sent),
+		})
+	}
+}
+
+// sendReminder sends the reminder of a notification to the user's connections. Reminders of users that are
+// not connected are dropped; the notification remains stored and keeps its expiry.
+func sendReminder(clients *clientStore.ClientStore, notification data.Notification) {
+	payload := data.EventNotification{Event: data.Event{Event: data.NOTIFICATION_REMINDER}, Data: notification}
+	if err := clients.SendReminderToUser(payload); err != nil {
+		metrics.Inc("reminders.failed")
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Reminder Scheduler",
+			Operation: "SendReminder",
+			Message:   "Failed to send the reminder of notification " + notification.Id,
+			Error:     err,
+			UserId:    notification.UserID,
+			AppId:     notification.AppId,
+		})
+		return
+	}
+	metrics.Inc("reminders.sent")
+}
@@ -0,0 +1,15 @@
+package apiKeyRepository
+
+import (
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ApiKeyRepository interface {
+	FindAll(appId string) ([]models.ApiKey, error)
+	FindActiveByHash(keyHash string) (models.ApiKey, error)
+	Create(apiKey models.ApiKey) (primitive.ObjectID, error)
+	Revoke(id primitive.ObjectID) error
+	CreateIndexes() error
+}
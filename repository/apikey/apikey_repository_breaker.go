@@ -0,0 +1,36 @@
+package apiKeyRepository
+
+import (
+	"r2-notify-server/breaker"
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ApiKeyRepositoryBreaker guards the calls of a ApiKeyRepository with a circuit breaker, so they fail fast
+// while the database is unavailable.
+type ApiKeyRepositoryBreaker struct {
+	ApiKeyRepository
+	breaker *breaker.Breaker
+}
+
+// NewApiKeyRepositoryBreaker wraps the repository with the given circuit breaker.
+func NewApiKeyRepositoryBreaker(repository ApiKeyRepository, circuitBreaker *breaker.Breaker) ApiKeyRepository {
+	return &ApiKeyRepositoryBreaker{ApiKeyRepository: repository, breaker: circuitBreaker}
+}
+
+func (t *ApiKeyRepositoryBreaker) FindAll(appId string) ([]models.ApiKey, error) {
+	return breaker.Call(t.breaker, func() ([]models.ApiKey, error) { return t.ApiKeyRepository.FindAll(appId) })
+}
+
+func (t *ApiKeyRepositoryBreaker) FindActiveByHash(keyHash string) (models.ApiKey, error) {
+	return breaker.Call(t.breaker, func() (models.ApiKey, error) { return t.ApiKeyRepository.FindActiveByHash(keyHash) })
+}
+
+func (t *ApiKeyRepositoryBreaker) Create(apiKey models.ApiKey) (primitive.ObjectID, error) {
+	return breaker.Call(t.breaker, func() (primitive.ObjectID, error) { return t.ApiKeyRepository.Create(apiKey) })
+}
+
+func (t *ApiKeyRepositoryBreaker) Revoke(id primitive.ObjectID) error {
+	return t.breaker.Execute(func() error { return t.ApiKeyRepository.Revoke(id) })
+}
@@ -0,0 +1,174 @@
+package apiKeyRepository
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ApiKeyRepositoryImpl struct {
+	Db *mongo.Database
+}
+
+// NewApiKeyRepositoryImpl creates a new instance of ApiKeyRepositoryImpl
+// with the given mongo Db instance.
+func NewApiKeyRepositoryImpl(Db *mongo.Database) ApiKeyRepository {
+	return &ApiKeyRepositoryImpl{Db: Db}
+}
+
+// FindAll retrieves the API keys issued for the given appId, including revoked keys, newest first.
+func (t ApiKeyRepositoryImpl) FindAll(appId string) ([]models.ApiKey, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "ApiKey Repository",
+		Operation: "FindAll",
+		Message:   "Fetching API keys for appId: " + appId,
+		AppId:     appId,
+	})
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := t.Db.Collection("api_keys").Find(context.Background(), bson.M{"appId": appId}, opts)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "ApiKey Repository",
+			Operation: "FindAll",
+			Message:   "Failed to fetch API keys for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return nil, apperrors.FromDatabase(err, "API key not found")
+	}
+	defer cursor.Close(context.Background())
+
+	apiKeys := []models.ApiKey{}
+	if err := cursor.All(context.Background(), &apiKeys); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "ApiKey Repository",
+			Operation: "FindAll",
+			Message:   "Failed to decode API keys for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return nil, apperrors.FromDatabase(err, "API key not found")
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "ApiKey Repository",
+		Operation: "FindAll",
+		Message:   fmt.Sprintf("Found %d API keys for appId: %s", len(apiKeys), appId),
+		AppId:     appId,
+	})
+	return apiKeys, nil
+}
+
+// FindActiveByHash retrieves the API key with the given key hash that has not been revoked.
+// It returns a not found error if no such key exists.
+func (t ApiKeyRepositoryImpl) FindActiveByHash(keyHash string) (apiKey models.ApiKey, err error) {
+	filter := bson.M{"keyHash": keyHash, "revokedAt": bson.M{"$exists": false}}
+	if err := t.Db.Collection("api_keys").FindOne(context.Background(), filter).Decode(&apiKey); err != nil {
+		if err != mongo.ErrNoDocuments {
+			logger.Log.Error(logger.LogPayload{
+				Component: "ApiKey Repository",
+				Operation: "FindActiveByHash",
+				Message:   "Failed to fetch API key",
+				Error:     err,
+			})
+		}
+		return models.ApiKey{}, apperrors.FromDatabase(err, "API key not found")
+	}
+	return apiKey, nil
+}
+
+// Create inserts a new API key into the "api_keys" collection and returns its ID.
+func (t *ApiKeyRepositoryImpl) Create(apiKey models.ApiKey) (primitive.ObjectID, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "ApiKey Repository",
+		Operation: "Create",
+		Message:   "Creating API key " + apiKey.Prefix + " for appId: " + apiKey.AppId,
+		AppId:     apiKey.AppId,
+	})
+	result, err := t.Db.Collection("api_keys").InsertOne(context.Background(), apiKey)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "ApiKey Repository",
+			Operation: "Create",
+			Message:   "Failed to create API key for appId: " + apiKey.AppId,
+			Error:     err,
+			AppId:     apiKey.AppId,
+		})
+		return primitive.NilObjectID, apperrors.FromDatabase(err, "API key not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "ApiKey Repository",
+		Operation: "Create",
+		Message:   "Successfully created API key " + apiKey.Prefix + " for appId: " + apiKey.AppId,
+		AppId:     apiKey.AppId,
+	})
+	return result.InsertedID.(primitive.ObjectID), nil
+}
+
+// Revoke marks the API key with the given ID as revoked. Revoked keys are kept for attribution
+// but are no longer accepted. It returns a not found error if no active key has the given ID.
+func (t *ApiKeyRepositoryImpl) Revoke(id primitive.ObjectID) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "ApiKey Repository",
+		Operation: "Revoke",
+		Message:   "Revoking API key: " + id.Hex(),
+	})
+	filter := bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}}
+	result, err := t.Db.Collection("api_keys").UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "ApiKey Repository",
+			Operation: "Revoke",
+			Message:   "Failed to revoke API key: " + id.Hex(),
+			Error:     err,
+		})
+		return apperrors.FromDatabase(err, "API key not found")
+	}
+	if result.MatchedCount == 0 {
+		return apperrors.NotFound("API key not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "ApiKey Repository",
+		Operation: "Revoke",
+		Message:   "Successfully revoked API key: " + id.Hex(),
+	})
+	return nil
+}
+
+// CreateIndexes creates the unique index on the key hash used to authenticate requests and the
+// index backing the listing of an app's keys.
+// Creating an index that already exists is a no-op, so it is safe to call on every startup.
+func (t *ApiKeyRepositoryImpl) CreateIndexes() error {
+	_, err := t.Db.Collection("api_keys").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "keyHash", Value: 1}},
+			Options: options.Index().SetName("keyHash").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "appId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("appId_createdAt"),
+		},
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "ApiKey Repository",
+			Operation: "CreateIndexes",
+			Message:   "Failed to create API key indexes",
+			Error:     err,
+		})
+		return apperrors.FromDatabase(err, "API key not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "ApiKey Repository",
+		Operation: "CreateIndexes",
+		Message:   "Successfully created API key indexes",
+	})
+	return nil
+}
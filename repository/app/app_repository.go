@@ -0,0 +1,13 @@
+package appRepository
+
+import (
+	"r2-notify-server/models"
+)
+
+type AppRepository interface {
+	FindAll() ([]models.App, error)
+	FindByAppId(appId string) (models.App, error)
+	Upsert(app models.App) error
+	Delete(appId string) error
+	CreateIndexes() error
+}
@@ -0,0 +1,34 @@
+package appRepository
+
+import (
+	"r2-notify-server/breaker"
+	"r2-notify-server/models"
+)
+
+// AppRepositoryBreaker guards the calls of a AppRepository with a circuit breaker, so they fail fast
+// while the database is unavailable.
+type AppRepositoryBreaker struct {
+	AppRepository
+	breaker *breaker.Breaker
+}
+
+// NewAppRepositoryBreaker wraps the repository with the given circuit breaker.
+func NewAppRepositoryBreaker(repository AppRepository, circuitBreaker *breaker.Breaker) AppRepository {
+	return &AppRepositoryBreaker{AppRepository: repository, breaker: circuitBreaker}
+}
+
+func (t *AppRepositoryBreaker) FindAll() ([]models.App, error) {
+	return breaker.Call(t.breaker, func() ([]models.App, error) { return t.AppRepository.FindAll() })
+}
+
+func (t *AppRepositoryBreaker) FindByAppId(appId string) (models.App, error) {
+	return breaker.Call(t.breaker, func() (models.App, error) { return t.AppRepository.FindByAppId(appId) })
+}
+
+func (t *AppRepositoryBreaker) Upsert(app models.App) error {
+	return t.breaker.Execute(func() error { return t.AppRepository.Upsert(app) })
+}
+
+func (t *AppRepositoryBreaker) Delete(appId string) error {
+	return t.breaker.Execute(func() error { return t.AppRepository.Delete(appId) })
+}
@@ -0,0 +1,176 @@
+package appRepository
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AppRepositoryImpl struct {
+	Db *mongo.Database
+}
+
+// NewAppRepositoryImpl creates a new instance of AppRepositoryImpl
+// with the given mongo Db instance.
+func NewAppRepositoryImpl(Db *mongo.Database) AppRepository {
+	return &AppRepositoryImpl{Db: Db}
+}
+
+// FindAll retrieves every registered app, ordered by appId.
+func (t AppRepositoryImpl) FindAll() ([]models.App, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "App Repository",
+		Operation: "FindAll",
+		Message:   "Fetching registered apps",
+	})
+	opts := options.Find().SetSort(bson.D{{Key: "appId", Value: 1}})
+	cursor, err := t.Db.Collection("apps").Find(context.Background(), bson.M{}, opts)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "App Repository",
+			Operation: "FindAll",
+			Message:   "Failed to fetch registered apps",
+			Error:     err,
+		})
+		return nil, apperrors.FromDatabase(err, "app not found")
+	}
+	defer cursor.Close(context.Background())
+
+	apps := []models.App{}
+	if err := cursor.All(context.Background(), &apps); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "App Repository",
+			Operation: "FindAll",
+			Message:   "Failed to decode registered apps",
+			Error:     err,
+		})
+		return nil, apperrors.FromDatabase(err, "app not found")
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "App Repository",
+		Operation: "FindAll",
+		Message:   fmt.Sprintf("Found %d registered apps", len(apps)),
+	})
+	return apps, nil
+}
+
+// FindByAppId retrieves the registered app with the given appId.
+// It returns a not found error if the app is not registered.
+func (t AppRepositoryImpl) FindByAppId(appId string) (app models.App, err error) {
+	if err := t.Db.Collection("apps").FindOne(context.Background(), bson.M{"appId": appId}).Decode(&app); err != nil {
+		if err != mongo.ErrNoDocuments {
+			logger.Log.Error(logger.LogPayload{
+				Component: "App Repository",
+				Operation: "FindByAppId",
+				Message:   "Failed to fetch app for appId: " + appId,
+				Error:     err,
+				AppId:     appId,
+			})
+		}
+		return models.App{}, apperrors.FromDatabase(err, "app not found")
+	}
+	return app, nil
+}
+
+// Upsert replaces the metadata of the app, registering it if it is not registered yet. The creation time
+// of a registered app is kept.
+func (t *AppRepositoryImpl) Upsert(app models.App) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "App Repository",
+		Operation: "Upsert",
+		Message:   "Saving app for appId: " + app.AppId,
+		AppId:     app.AppId,
+	})
+	set := bson.M{
+		"displayName": app.DisplayName,
+		"iconUrl":     app.IconUrl,
+		"ownerTeam":   app.OwnerTeam,
+		"updatedAt":   app.UpdatedAt,
+	}
+	update := bson.M{"$set": set, "$setOnInsert": bson.M{"createdAt": app.CreatedAt}}
+	if app.GroupSummaryThreshold != nil {
+		set["groupSummaryThreshold"] = *app.GroupSummaryThreshold
+	} else {
+		update["$unset"] = bson.M{"groupSummaryThreshold": ""}
+	}
+	_, err := t.Db.Collection("apps").UpdateOne(context.Background(), bson.M{"appId": app.AppId}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "App Repository",
+			Operation: "Upsert",
+			Message:   "Failed to save app for appId: " + app.AppId,
+			Error:     err,
+			AppId:     app.AppId,
+		})
+		return apperrors.FromDatabase(err, "app not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "App Repository",
+		Operation: "Upsert",
+		Message:   "Successfully saved app for appId: " + app.AppId,
+		AppId:     app.AppId,
+	})
+	return nil
+}
+
+// Delete removes the registered app with the given appId.
+// It returns a not found error if the app is not registered.
+func (t *AppRepositoryImpl) Delete(appId string) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "App Repository",
+		Operation: "Delete",
+		Message:   "Deleting app for appId: " + appId,
+		AppId:     appId,
+	})
+	result, err := t.Db.Collection("apps").DeleteOne(context.Background(), bson.M{"appId": appId})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "App Repository",
+			Operation: "Delete",
+			Message:   "Failed to delete app for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return apperrors.FromDatabase(err, "app not found")
+	}
+	if result.DeletedCount == 0 {
+		return apperrors.NotFound("app not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "App Repository",
+		Operation: "Delete",
+		Message:   "Successfully deleted app for appId: " + appId,
+		AppId:     appId,
+	})
+	return nil
+}
+
+// CreateIndexes creates the unique index on the appId, so each app is registered once.
+// Creating an index that already exists is a no-op, so it is safe to call on every startup.
+func (t *AppRepositoryImpl) CreateIndexes() error {
+	_, err := t.Db.Collection("apps").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "appId", Value: 1}},
+		Options: options.Index().SetName("appId").SetUnique(true),
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "App Repository",
+			Operation: "CreateIndexes",
+			Message:   "Failed to create app indexes",
+			Error:     err,
+		})
+		return apperrors.FromDatabase(err, "app not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "App Repository",
+		Operation: "CreateIndexes",
+		Message:   "Successfully created app indexes",
+	})
+	return nil
+}
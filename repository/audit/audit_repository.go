@@ -0,0 +1,13 @@
+package auditRepository
+
+import (
+	"context"
+	"r2-notify-server/data"
+	"r2-notify-server/models"
+)
+
+type AuditRepository interface {
+	Create(ctx context.Context, entry models.AuditEntry) error
+	Find(query data.AuditLogQuery) ([]models.AuditEntry, error)
+	CreateIndexes() error
+}
@@ -0,0 +1,121 @@
+package auditRepository
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AuditRepositoryImpl struct {
+	Db *mongo.Database
+}
+
+// NewAuditRepositoryImpl creates a new instance of AuditRepositoryImpl
+// with the given mongo Db instance.
+func NewAuditRepositoryImpl(Db *mongo.Database) AuditRepository {
+	return &AuditRepositoryImpl{Db: Db}
+}
+
+// Create inserts a new audit entry into the "audit_logs" collection. The entry joins the transaction of
+// the context, if any.
+func (t *AuditRepositoryImpl) Create(ctx context.Context, entry models.AuditEntry) error {
+	_, err := t.Db.Collection("audit_logs").InsertOne(ctx, entry)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "Audit Repository",
+			Operation:     "Create",
+			Message:       "Failed to create audit entry for event: " + entry.Event,
+			Error:         err,
+			UserId:        entry.UserId,
+			AppId:         entry.AppId,
+			CorrelationId: entry.CorrelationId,
+		})
+		return apperrors.FromDatabase(err, "audit entry not found")
+	}
+	return nil
+}
+
+// Find retrieves the audit entries of the user in the query, newest first. The createdAt range is
+// bounded by the query's From and To when set, and at most query.Limit entries are returned.
+func (t AuditRepositoryImpl) Find(query data.AuditLogQuery) ([]models.AuditEntry, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Audit Repository",
+		Operation: "Find",
+		Message:   "Fetching audit entries for userId: " + query.UserId,
+		UserId:    query.UserId,
+	})
+	filter := bson.M{"userId": query.UserId}
+	createdAt := bson.M{}
+	if query.From != nil {
+		createdAt["$gte"] = *query.From
+	}
+	if query.To != nil {
+		createdAt["$lte"] = *query.To
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(int64(query.Limit))
+	cursor, err := t.Db.Collection("audit_logs").Find(context.Background(), filter, opts)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Audit Repository",
+			Operation: "Find",
+			Message:   "Failed to fetch audit entries for userId: " + query.UserId,
+			Error:     err,
+			UserId:    query.UserId,
+		})
+		return nil, apperrors.FromDatabase(err, "audit entry not found")
+	}
+	defer cursor.Close(context.Background())
+
+	entries := []models.AuditEntry{}
+	if err := cursor.All(context.Background(), &entries); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Audit Repository",
+			Operation: "Find",
+			Message:   "Failed to decode audit entries for userId: " + query.UserId,
+			Error:     err,
+			UserId:    query.UserId,
+		})
+		return nil, apperrors.FromDatabase(err, "audit entry not found")
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Audit Repository",
+		Operation: "Find",
+		Message:   fmt.Sprintf("Found %d audit entries for userId: %s", len(entries), query.UserId),
+		UserId:    query.UserId,
+	})
+	return entries, nil
+}
+
+// CreateIndexes creates the index backing the audit log queries by userId and time range.
+// Creating an index that already exists is a no-op, so it is safe to call on every startup.
+func (t *AuditRepositoryImpl) CreateIndexes() error {
+	_, err := t.Db.Collection("audit_logs").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+		Options: options.Index().SetName("userId_createdAt"),
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Audit Repository",
+			Operation: "CreateIndexes",
+			Message:   "Failed to create audit log index",
+			Error:     err,
+		})
+		return apperrors.FromDatabase(err, "audit entry not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Audit Repository",
+		Operation: "CreateIndexes",
+		Message:   "Successfully created audit log indexes",
+	})
+	return nil
+}
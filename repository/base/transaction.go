@@ -0,0 +1,143 @@
+package baseRepository
+
+// Package baseRepository holds what the repositories share, such as running the writes of several
+// repositories in a single database transaction.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/retry"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Code of the MongoDB error returned when a transaction is started on a standalone server.
+const illegalOperationCode = 20
+
+// Transactor runs a function in a database transaction, so the writes of several repositories, possibly to
+// several collections, are applied together or not at all. Repositories join the transaction through the
+// context passed to the function, which must be used for every call made within the transaction.
+type Transactor interface {
+	// WithTransaction runs fn in a transaction and commits it if fn returns nil, or aborts it and returns the
+	// error of fn otherwise. The transaction may be retried, running fn again, so fn must not have effects
+	// outside the database such as sending events; they belong after WithTransaction returns.
+	WithTransaction(ctx context.Context, name string, fn func(ctx context.Context) error) error
+}
+
+// MongoTransactor runs functions in MongoDB transactions. Transactions that fail with a transient
+// transaction error, such as a write conflict or a replica set election, are retried with the attempts
+// and backoff of the retry policy. Transactions require a replica set or a sharded cluster: on a standalone
+// server, functions are run without a transaction.
+type MongoTransactor struct {
+	client      *mongo.Client
+	policy      retry.Policy
+	unsupported atomic.Bool // set once the server refused to start a transaction
+}
+
+// NewMongoTransactor returns a Transactor running functions in transactions of the client of the database,
+// retried with the given policy.
+func NewMongoTransactor(db *mongo.Database, policy retry.Policy) Transactor {
+	return &MongoTransactor{client: db.Client(), policy: policy}
+}
+
+func (t *MongoTransactor) WithTransaction(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	if t.unsupported.Load() {
+		return fn(ctx)
+	}
+	var err error
+	delay := t.policy.BaseDelay
+	for attempt := 1; attempt <= t.policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			metrics.Inc("db.transactions.retries")
+			logger.Log.Warn(logger.LogPayload{
+				Component: "Transaction",
+				Operation: name,
+				Message:   fmt.Sprintf("Retrying %s transaction after transient error, attempt %d of %d", name, attempt, t.policy.MaxAttempts),
+				Error:     err,
+			})
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+			delay = min(delay*2, t.policy.MaxDelay)
+		}
+		err = t.run(ctx, fn)
+		if err == nil {
+			metrics.Inc("db.transactions.committed")
+			return nil
+		}
+		if transactionsUnsupported(err) {
+			t.unsupported.Store(true)
+			logger.Log.Warn(logger.LogPayload{
+				Component: "Transaction",
+				Operation: name,
+				Message:   "MongoDB does not support transactions, running multi-document operations without them",
+				Error:     err,
+			})
+			return fn(ctx)
+		}
+		if !hasErrorLabel(err, "TransientTransactionError") || ctx.Err() != nil {
+			break
+		}
+	}
+	metrics.Inc("db.transactions.failed")
+	return err
+}
+
+// run runs fn in a single transaction, retrying the commit while its result is unknown.
+func (t *MongoTransactor) run(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	return mongo.WithSession(ctx, session, func(sessionCtx mongo.SessionContext) error {
+		if err := session.StartTransaction(); err != nil {
+			return err
+		}
+		if err := fn(sessionCtx); err != nil {
+			_ = session.AbortTransaction(context.Background())
+			return err
+		}
+		for attempt := 1; ; attempt++ {
+			err := session.CommitTransaction(sessionCtx)
+			if err == nil || !hasErrorLabel(err, "UnknownTransactionCommitResult") || attempt >= t.policy.MaxAttempts {
+				return err
+			}
+		}
+	})
+}
+
+// transactionsUnsupported reports whether the server refused the transaction because it is a standalone server.
+func transactionsUnsupported(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(illegalOperationCode)
+}
+
+// hasErrorLabel reports whether the error, possibly wrapped in an application error, carries the label.
+func hasErrorLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
+
+// directTransactor runs functions without a transaction.
+type directTransactor struct{}
+
+// NewDirectTransactor returns a Transactor running functions without a transaction, for databases whose
+// repositories do not join transactions, such as Postgres.
+func NewDirectTransactor() Transactor {
+	return directTransactor{}
+}
+
+func (directTransactor) WithTransaction(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
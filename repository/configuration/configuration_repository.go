@@ -1,14 +1,17 @@
 package configurationRepository
 
 import (
+	"context"
 	"r2-notify-server/models"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ConfigurationRepository interface {
-	FindByAppAndUser(userId string) (configurations models.Configuration, err error)
-	Create(configuration models.Configuration) (primitive.ObjectID, error)
-	Update(configuration models.Configuration) error
-	Delete(userId string) error
+	FindByAppAndUser(ctx context.Context, tenantId string, userId string) (configurations models.Configuration, err error)
+	Create(ctx context.Context, configuration models.Configuration) (primitive.ObjectID, error)
+	Update(ctx context.Context, configuration models.Configuration) error
+	Delete(ctx context.Context, tenantId string, userId string) error
+	GetOrCreate(ctx context.Context, configuration models.Configuration) (models.Configuration, error)
+	CreateIndexes() error
 }
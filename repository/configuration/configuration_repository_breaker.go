@@ -0,0 +1,43 @@
+package configurationRepository
+
+import (
+	"context"
+	"r2-notify-server/breaker"
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ConfigurationRepositoryBreaker guards the calls of a ConfigurationRepository with a circuit breaker, so they fail fast
+// while the database is unavailable.
+type ConfigurationRepositoryBreaker struct {
+	ConfigurationRepository
+	breaker *breaker.Breaker
+}
+
+// NewConfigurationRepositoryBreaker wraps the repository with the given circuit breaker.
+func NewConfigurationRepositoryBreaker(repository ConfigurationRepository, circuitBreaker *breaker.Breaker) ConfigurationRepository {
+	return &ConfigurationRepositoryBreaker{ConfigurationRepository: repository, breaker: circuitBreaker}
+}
+
+func (t *ConfigurationRepositoryBreaker) FindByAppAndUser(ctx context.Context, tenantId string, userId string) (models.Configuration, error) {
+	return breaker.Call(t.breaker, func() (models.Configuration, error) {
+		return t.ConfigurationRepository.FindByAppAndUser(ctx, tenantId, userId)
+	})
+}
+
+func (t *ConfigurationRepositoryBreaker) Create(ctx context.Context, configuration models.Configuration) (primitive.ObjectID, error) {
+	return breaker.Call(t.breaker, func() (primitive.ObjectID, error) { return t.ConfigurationRepository.Create(ctx, configuration) })
+}
+
+func (t *ConfigurationRepositoryBreaker) Update(ctx context.Context, configuration models.Configuration) error {
+	return t.breaker.Execute(func() error { return t.ConfigurationRepository.Update(ctx, configuration) })
+}
+
+func (t *ConfigurationRepositoryBreaker) Delete(ctx context.Context, tenantId string, userId string) error {
+	return t.breaker.Execute(func() error { return t.ConfigurationRepository.Delete(ctx, tenantId, userId) })
+}
+
+func (t *ConfigurationRepositoryBreaker) GetOrCreate(ctx context.Context, configuration models.Configuration) (models.Configuration, error) {
+	return breaker.Call(t.breaker, func() (models.Configuration, error) { return t.ConfigurationRepository.GetOrCreate(ctx, configuration) })
+}
@@ -3,6 +3,7 @@ package configurationRepository
 import (
 	"context"
 	"errors"
+	"r2-notify-server/apperrors"
 	"r2-notify-server/logger"
 	"r2-notify-server/models"
 
@@ -10,6 +11,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ConfigurationRepositoryImpl struct {
@@ -23,10 +25,10 @@ func NewConfigurationRepositoryImpl(Db *mongo.Database) ConfigurationRepository
 }
 
 // FindByAppAndUser retrieves a configuration document from the "configurations" collection
-// for the given userId. It returns the configuration if found, or an error if the operation
-// fails or no configuration is found for the specified userId.
+// for the given tenantId and userId. It returns the configuration if found, or an error if the operation
+// fails or no configuration is found for the specified user.
 
-func (t ConfigurationRepositoryImpl) FindByAppAndUser(userId string) (models.Configuration, error) {
+func (t ConfigurationRepositoryImpl) FindByAppAndUser(ctx context.Context, tenantId string, userId string) (models.Configuration, error) {
 	var configuration models.Configuration
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Configuration Repository",
@@ -35,8 +37,8 @@ func (t ConfigurationRepositoryImpl) FindByAppAndUser(userId string) (models.Con
 		UserId:    userId,
 	})
 	err := t.Db.Collection("configurations").FindOne(
-		context.Background(),
-		bson.M{"userId": userId},
+		ctx,
+		bson.M{"tenantId": tenantFilter(tenantId), "userId": userId},
 	).Decode(&configuration)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
@@ -46,7 +48,7 @@ func (t ConfigurationRepositoryImpl) FindByAppAndUser(userId string) (models.Con
 			Error:     err,
 			UserId:    userId,
 		})
-		return models.Configuration{}, err
+		return models.Configuration{}, apperrors.FromDatabase(err, "configuration not found")
 	}
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Configuration Repository",
@@ -60,14 +62,14 @@ func (t ConfigurationRepositoryImpl) FindByAppAndUser(userId string) (models.Con
 // Create inserts a new configuration document into the "configurations"
 // collection. It returns the inserted document's ObjectID if the operation
 // is successful, or an error if the operation fails.
-func (t *ConfigurationRepositoryImpl) Create(configuration models.Configuration) (primitive.ObjectID, error) {
+func (t *ConfigurationRepositoryImpl) Create(ctx context.Context, configuration models.Configuration) (primitive.ObjectID, error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Configuration Repository",
 		Operation: "Create",
 		Message:   "Creating configuration for userId: " + configuration.UserId,
 		UserId:    configuration.UserId,
 	})
-	result, err := t.Db.Collection("configurations").InsertOne(context.Background(), configuration)
+	result, err := t.Db.Collection("configurations").InsertOne(ctx, configuration)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Configuration Repository",
@@ -76,11 +78,11 @@ func (t *ConfigurationRepositoryImpl) Create(configuration models.Configuration)
 			Error:     err,
 			UserId:    configuration.UserId,
 		})
-		return primitive.NilObjectID, err
+		return primitive.NilObjectID, apperrors.FromDatabase(err, "configuration not found")
 	}
 	id, ok := result.InsertedID.(primitive.ObjectID)
 	if !ok {
-		convertErr := errors.New("failed to convert inserted ID to ObjectID")
+		convertErr := apperrors.Internal("failed to convert inserted ID to ObjectID", nil)
 		logger.Log.Error(logger.LogPayload{
 			Component: "Configuration Repository",
 			Operation: "Create",
@@ -100,9 +102,11 @@ func (t *ConfigurationRepositoryImpl) Create(configuration models.Configuration)
 }
 
 // Update updates a configuration document in the "configurations" collection
-// with the given models.Configuration document. It returns an error if the
-// operation fails, or if no document is found to update.
-func (t *ConfigurationRepositoryImpl) Update(configuration models.Configuration) error {
+// with the given models.Configuration document. The digest settings and muted groups are only
+// replaced if DigestApps and MutedGroups are not nil, and the list scope if ListScope is set, so callers
+// toggling notifications keep them.
+// It returns an error if the operation fails, or if no document is found to update.
+func (t *ConfigurationRepositoryImpl) Update(ctx context.Context, configuration models.Configuration) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Configuration Repository",
 		Operation: "Update",
@@ -110,12 +114,26 @@ func (t *ConfigurationRepositoryImpl) Update(configuration models.Configuration)
 		UserId:    configuration.UserId,
 	})
 	filter := bson.M{
-		"userId": configuration.UserId,
+		"tenantId": tenantFilter(configuration.TenantId),
+		"userId":   configuration.UserId,
+	}
+	fields := bson.M{
+		"userId":              configuration.UserId,
+		"enableNotifications": configuration.EnableNotifications,
+	}
+	if configuration.DigestApps != nil {
+		fields["digestApps"] = configuration.DigestApps
+	}
+	if configuration.MutedGroups != nil {
+		fields["mutedGroups"] = configuration.MutedGroups
+	}
+	if configuration.ListScope != "" {
+		fields["listScope"] = configuration.ListScope
 	}
 	update := bson.M{
-		"$set": configuration,
+		"$set": fields,
 	}
-	result, err := t.Db.Collection("configurations").UpdateOne(context.Background(), filter, update)
+	result, err := t.Db.Collection("configurations").UpdateOne(ctx, filter, update)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Configuration Repository",
@@ -124,10 +142,10 @@ func (t *ConfigurationRepositoryImpl) Update(configuration models.Configuration)
 			Error:     err,
 			UserId:    configuration.UserId,
 		})
-		return err
+		return apperrors.FromDatabase(err, "configuration not found")
 	}
 	if result.MatchedCount == 0 {
-		notFoundErr := errors.New("no document found to update")
+		notFoundErr := apperrors.NotFound("configuration not found")
 		logger.Log.Error(logger.LogPayload{
 			Component: "Configuration Repository",
 			Operation: "Update",
@@ -147,9 +165,9 @@ func (t *ConfigurationRepositoryImpl) Update(configuration models.Configuration)
 }
 
 // Delete deletes a configuration document from the "configurations" collection
-// for the given userId. It returns an error if the operation fails, or if no
+// for the given tenantId and userId. It returns an error if the operation fails, or if no
 // document is found to delete.
-func (t *ConfigurationRepositoryImpl) Delete(userId string) error {
+func (t *ConfigurationRepositoryImpl) Delete(ctx context.Context, tenantId string, userId string) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Configuration Repository",
 		Operation: "Delete",
@@ -157,9 +175,10 @@ func (t *ConfigurationRepositoryImpl) Delete(userId string) error {
 		UserId:    userId,
 	})
 	filter := bson.M{
-		"userId": userId,
+		"tenantId": tenantFilter(tenantId),
+		"userId":   userId,
 	}
-	result, err := t.Db.Collection("configurations").DeleteOne(context.Background(), filter)
+	result, err := t.Db.Collection("configurations").DeleteOne(ctx, filter)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Configuration Repository",
@@ -168,10 +187,10 @@ func (t *ConfigurationRepositoryImpl) Delete(userId string) error {
 			Error:     err,
 			UserId:    userId,
 		})
-		return err
+		return apperrors.FromDatabase(err, "configuration not found")
 	}
 	if result.DeletedCount == 0 {
-		notFoundErr := errors.New("no document found to delete")
+		notFoundErr := apperrors.NotFound("configuration not found")
 		logger.Log.Error(logger.LogPayload{
 			Component: "Configuration Repository",
 			Operation: "Delete",
@@ -189,3 +208,104 @@ func (t *ConfigurationRepositoryImpl) Delete(userId string) error {
 	})
 	return nil
 }
+
+// GetOrCreate atomically fetches the configuration document for the configuration's tenantId and userId, inserting
+// the given configuration if none exists. The upsert only sets fields on insert, so an existing
+// configuration is returned unchanged. Together with the unique tenantId and userId index this guarantees that
+// concurrent connections for a new user never produce duplicate configuration documents; an upsert
+// that loses the race on the unique index is retried once and then reads the winner's document.
+func (t *ConfigurationRepositoryImpl) GetOrCreate(ctx context.Context, configuration models.Configuration) (models.Configuration, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "GetOrCreate",
+		Message:   "Fetching or creating configuration for userId: " + configuration.UserId,
+		UserId:    configuration.UserId,
+	})
+	filter := bson.M{"tenantId": tenantFilter(configuration.TenantId), "userId": configuration.UserId}
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"userId":              configuration.UserId,
+			"enableNotifications": configuration.EnableNotifications,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var result models.Configuration
+	err := t.Db.Collection("configurations").FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+	if mongo.IsDuplicateKeyError(err) {
+		err = t.Db.Collection("configurations").FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+	}
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Repository",
+			Operation: "GetOrCreate",
+			Message:   "Failed to fetch or create configuration for userId: " + configuration.UserId,
+			Error:     err,
+			UserId:    configuration.UserId,
+		})
+		return models.Configuration{}, apperrors.FromDatabase(err, "configuration not found")
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "GetOrCreate",
+		Message:   "Successfully fetched or created configuration for userId: " + configuration.UserId,
+		UserId:    configuration.UserId,
+	})
+	return result, nil
+}
+
+// CreateIndexes creates a unique index on tenantId and userId in the "configurations" collection so
+// that at most one configuration document exists per user of a tenant, replacing the unique userId
+// index of earlier versions. It is safe to call on every startup. Creating the index fails if
+// duplicate configurations already exist; they must be removed first.
+func (t *ConfigurationRepositoryImpl) CreateIndexes() error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "CreateIndexes",
+		Message:   "Creating configuration indexes",
+	})
+	indexes := t.Db.Collection("configurations").Indexes()
+	if _, err := indexes.DropOne(context.Background(), "userId_unique"); err != nil && !isIndexNotFound(err) {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Repository",
+			Operation: "CreateIndexes",
+			Message:   "Failed to drop unique userId index",
+			Error:     err,
+		})
+		return apperrors.FromDatabase(err, "configuration not found")
+	}
+	_, err := indexes.CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}},
+		Options: options.Index().SetName("tenantId_userId_unique").SetUnique(true),
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Repository",
+			Operation: "CreateIndexes",
+			Message:   "Failed to create unique tenantId and userId index",
+			Error:     err,
+		})
+		return apperrors.FromDatabase(err, "configuration not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "CreateIndexes",
+		Message:   "Successfully created configuration indexes",
+	})
+	return nil
+}
+
+// tenantFilter matches the documents of the given tenant. Configurations of the default tenant are
+// stored without a tenantId, so an empty tenantId matches documents where the field is missing or empty.
+func tenantFilter(tenantId string) interface{} {
+	if tenantId == "" {
+		return bson.M{"$in": bson.A{nil, ""}}
+	}
+	return tenantId
+}
+
+// isIndexNotFound reports whether dropping an index failed because the index or collection does not exist.
+func isIndexNotFound(err error) bool {
+	var commandErr mongo.CommandError
+	return errors.As(err, &commandErr) && (commandErr.Code == 27 || commandErr.Code == 26)
+}
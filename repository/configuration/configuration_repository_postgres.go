@@ -0,0 +1,247 @@
+package configurationRepository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Columns selected for a configuration, in the order scanned by scanConfiguration.
+const configurationColumns = "id, tenant_id, user_id, enable_notifications, digest_apps, muted_groups, list_scope"
+
+type ConfigurationRepositoryPostgres struct {
+	Db *pgxpool.Pool
+}
+
+// NewConfigurationRepositoryPostgres creates a new instance of ConfigurationRepositoryPostgres
+// backed by the "configurations" table.
+func NewConfigurationRepositoryPostgres(Db *pgxpool.Pool) ConfigurationRepository {
+	return &ConfigurationRepositoryPostgres{Db: Db}
+}
+
+// FindByAppAndUser retrieves the configuration of the given userId of the tenant. It returns a not found
+// error if the user has no configuration.
+func (t ConfigurationRepositoryPostgres) FindByAppAndUser(ctx context.Context, tenantId string, userId string) (models.Configuration, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "FindByAppAndUser",
+		Message:   "Fetching configuration for userId: " + userId,
+		UserId:    userId,
+	})
+	row := t.Db.QueryRow(ctx,
+		"SELECT "+configurationColumns+" FROM configurations WHERE tenant_id = $1 AND user_id = $2", tenantId, userId)
+	configuration, err := scanConfiguration(row)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Repository",
+			Operation: "FindByAppAndUser",
+			Message:   "Failed to fetch configuration for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return models.Configuration{}, apperrors.FromDatabase(err, "configuration not found")
+	}
+	return configuration, nil
+}
+
+// Create inserts a new configuration and returns its ID.
+func (t *ConfigurationRepositoryPostgres) Create(ctx context.Context, configuration models.Configuration) (primitive.ObjectID, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "Create",
+		Message:   "Creating configuration for userId: " + configuration.UserId,
+		UserId:    configuration.UserId,
+	})
+	digestApps, err := marshalList(configuration.DigestApps)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode digest settings", err)
+	}
+	mutedGroups, err := marshalList(configuration.MutedGroups)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode muted groups", err)
+	}
+	id := primitive.NewObjectID()
+	_, err = t.Db.Exec(ctx,
+		"INSERT INTO configurations (id, tenant_id, user_id, enable_notifications, digest_apps, muted_groups, list_scope) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		id.Hex(), configuration.TenantId, configuration.UserId, configuration.EnableNotifications, digestApps, mutedGroups, configuration.ListScope)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Repository",
+			Operation: "Create",
+			Message:   "Failed to create configuration for userId: " + configuration.UserId,
+			Error:     err,
+			UserId:    configuration.UserId,
+		})
+		return primitive.NilObjectID, apperrors.FromDatabase(err, "configuration not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "Create",
+		Message:   "Successfully created configuration for userId: " + configuration.UserId,
+		UserId:    configuration.UserId,
+	})
+	return id, nil
+}
+
+// Update updates the configuration of the configuration's tenantId and userId. The digest settings and muted groups
+// are only replaced if DigestApps and MutedGroups are not nil, and the list scope if ListScope is set, so callers
+// toggling notifications keep them.
+// It returns a not found error if the user has no configuration.
+func (t *ConfigurationRepositoryPostgres) Update(ctx context.Context, configuration models.Configuration) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "Update",
+		Message:   "Updating configuration for userId: " + configuration.UserId,
+		UserId:    configuration.UserId,
+	})
+	assignments := "enable_notifications = $3"
+	args := []any{configuration.TenantId, configuration.UserId, configuration.EnableNotifications}
+	if configuration.DigestApps != nil {
+		digestApps, err := marshalList(configuration.DigestApps)
+		if err != nil {
+			return apperrors.Internal("failed to encode digest settings", err)
+		}
+		args = append(args, digestApps)
+		assignments += fmt.Sprintf(", digest_apps = $%d", len(args))
+	}
+	if configuration.MutedGroups != nil {
+		mutedGroups, err := marshalList(configuration.MutedGroups)
+		if err != nil {
+			return apperrors.Internal("failed to encode muted groups", err)
+		}
+		args = append(args, mutedGroups)
+		assignments += fmt.Sprintf(", muted_groups = $%d", len(args))
+	}
+	if configuration.ListScope != "" {
+		args = append(args, configuration.ListScope)
+		assignments += fmt.Sprintf(", list_scope = $%d", len(args))
+	}
+	result, err := t.Db.Exec(ctx, "UPDATE configurations SET "+assignments+" WHERE tenant_id = $1 AND user_id = $2", args...)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Repository",
+			Operation: "Update",
+			Message:   "Failed to update configuration for userId: " + configuration.UserId,
+			Error:     err,
+			UserId:    configuration.UserId,
+		})
+		return apperrors.FromDatabase(err, "configuration not found")
+	}
+	if result.RowsAffected() == 0 {
+		return apperrors.NotFound("configuration not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "Update",
+		Message:   "Successfully updated configuration for userId: " + configuration.UserId,
+		UserId:    configuration.UserId,
+	})
+	return nil
+}
+
+// Delete deletes the configuration of the given userId of the tenant. It returns a not found error if
+// the user has no configuration.
+func (t *ConfigurationRepositoryPostgres) Delete(ctx context.Context, tenantId string, userId string) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "Delete",
+		Message:   "Deleting configuration for userId: " + userId,
+		UserId:    userId,
+	})
+	result, err := t.Db.Exec(ctx, "DELETE FROM configurations WHERE tenant_id = $1 AND user_id = $2", tenantId, userId)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Repository",
+			Operation: "Delete",
+			Message:   "Failed to delete configuration for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return apperrors.FromDatabase(err, "configuration not found")
+	}
+	if result.RowsAffected() == 0 {
+		return apperrors.NotFound("configuration not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "Delete",
+		Message:   "Successfully deleted configuration for userId: " + userId,
+		UserId:    userId,
+	})
+	return nil
+}
+
+// GetOrCreate atomically fetches the configuration of the configuration's tenantId and userId, inserting
+// the given configuration if none exists. The unique (tenant_id, user_id) constraint makes concurrent
+// inserts for a new user collapse into a single row; the no-op update on conflict returns the existing row unchanged.
+func (t *ConfigurationRepositoryPostgres) GetOrCreate(ctx context.Context, configuration models.Configuration) (models.Configuration, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Repository",
+		Operation: "GetOrCreate",
+		Message:   "Fetching or creating configuration for userId: " + configuration.UserId,
+		UserId:    configuration.UserId,
+	})
+	row := t.Db.QueryRow(ctx,
+		`INSERT INTO configurations (id, tenant_id, user_id, enable_notifications) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (tenant_id, user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		 RETURNING `+configurationColumns,
+		primitive.NewObjectID().Hex(), configuration.TenantId, configuration.UserId, configuration.EnableNotifications)
+	result, err := scanConfiguration(row)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Repository",
+			Operation: "GetOrCreate",
+			Message:   "Failed to fetch or create configuration for userId: " + configuration.UserId,
+			Error:     err,
+			UserId:    configuration.UserId,
+		})
+		return models.Configuration{}, apperrors.FromDatabase(err, "configuration not found")
+	}
+	return result, nil
+}
+
+// CreateIndexes is a no-op for Postgres. The unique constraint on tenant_id and user_id is created by the schema migrations.
+func (t *ConfigurationRepositoryPostgres) CreateIndexes() error {
+	return nil
+}
+
+// scanConfiguration scans a row selected with configurationColumns into a configuration model.
+func scanConfiguration(row pgx.Row) (models.Configuration, error) {
+	var configuration models.Configuration
+	var id string
+	var digestApps, mutedGroups []byte
+	if err := row.Scan(&id, &configuration.TenantId, &configuration.UserId, &configuration.EnableNotifications, &digestApps, &mutedGroups, &configuration.ListScope); err != nil {
+		return models.Configuration{}, err
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Configuration{}, apperrors.Internal("invalid configuration ID in database", err)
+	}
+	configuration.Id = objID
+	if len(digestApps) > 0 {
+		if err := json.Unmarshal(digestApps, &configuration.DigestApps); err != nil {
+			return models.Configuration{}, apperrors.Internal("failed to decode digest settings", err)
+		}
+	}
+	if len(mutedGroups) > 0 {
+		if err := json.Unmarshal(mutedGroups, &configuration.MutedGroups); err != nil {
+			return models.Configuration{}, apperrors.Internal("failed to decode muted groups", err)
+		}
+	}
+	return configuration, nil
+}
+
+// marshalList encodes the digest settings or muted groups of a configuration as JSON, or nil when there are none.
+func marshalList[T any](list []T) ([]byte, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(list)
+}
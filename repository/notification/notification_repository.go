@@ -1,21 +1,54 @@
 package notificationRepository
 
 import (
+	"context"
+	"r2-notify-server/data"
 	"r2-notify-server/models"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type NotificationRepository interface {
-	FindAll(userId string) ([]models.Notification, error)
-	FindById(id primitive.ObjectID, userId string) (models.Notification, error)
-	Create(notification models.Notification) (primitive.ObjectID, error)
-	MarkAsRead(clientId string) error
-	MarkAppAsRead(clientId string, appId string) error
-	MarkGroupAsRead(clientId string, appId string, groupKey string) error
-	MarkNotificationAsRead(clientId string, notificationId string) error
-	DeleteNotifications(clientId string) error
-	DeleteAppNotifications(clientId string, appId string) error
-	DeleteGroupNotifications(clientId string, appId string, groupKey string) error
-	DeleteNotification(clientId string, notificationId string) error
+	FindAll(ctx context.Context, tenantId string, userId string) ([]models.Notification, error)
+	FindHistory(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error)
+	FindList(ctx context.Context, tenantId string, userId string, query data.NotificationListQuery) ([]models.Notification, error)
+	FindById(ctx context.Context, tenantId string, id primitive.ObjectID, userId string) (models.Notification, error)
+	Create(ctx context.Context, notification models.Notification) (primitive.ObjectID, error)
+	Collapse(ctx context.Context, notification models.Notification) (primitive.ObjectID, error)
+	SetSequence(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, sequence int64) error
+	Discard(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID) error
+	MarkAsRead(ctx context.Context, tenantId string, clientId string) (int64, error)
+	MarkAppAsRead(ctx context.Context, tenantId string, clientId string, appId string) (int64, error)
+	MarkGroupAsRead(ctx context.Context, tenantId string, clientId string, appId string, groupKey string) (int64, error)
+	MarkGroupAsReadBefore(ctx context.Context, tenantId string, clientId string, appId string, groupKey string, before time.Time) ([]string, error)
+	MarkThreadAsRead(ctx context.Context, tenantId string, userId string, rootId string) ([]string, error)
+	MarkNotificationAsRead(ctx context.Context, tenantId string, clientId string, notificationId string) (int64, error)
+	UpdateStatus(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, from string, to string) (int64, error)
+	RecordDelivery(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, delivery models.NotificationDelivery, timings models.NotificationTimings) error
+	DeleteNotifications(ctx context.Context, tenantId string, clientId string) (int64, error)
+	DeleteAppNotifications(ctx context.Context, tenantId string, clientId string, appId string) (int64, error)
+	DeleteGroupNotifications(ctx context.Context, tenantId string, clientId string, appId string, groupKey string) (int64, error)
+	DeleteNotification(ctx context.Context, tenantId string, clientId string, notificationId string) (int64, error)
+	FindAppIds(ctx context.Context, tenantId string, userId string) ([]string, error)
+	FindIds(ctx context.Context, tenantId string, userId string, appId string, groupKey string, unreadOnly bool) ([]string, error)
+	RestoreDeleted(ctx context.Context, tenantId string, userId string, since time.Time) (int64, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	DeleteExpired(ctx context.Context, appId string, readStatus bool, before time.Time) (int64, error)
+	Erase(ctx context.Context, tenantId string, userId string) (int64, error)
+	CreateIndexes() error
+	Export(ctx context.Context, tenantId string, userId string, query data.NotificationExportQuery, yield func(models.Notification) error) error
+	Search(ctx context.Context, tenantId string, userId string, query data.NotificationSearchQuery) ([]models.Notification, int64, error)
+	CountReplies(ctx context.Context, tenantId string, userId string, rootIds []string) ([]models.ThreadCount, error)
+	CountByGroup(ctx context.Context, tenantId string, userId string) ([]models.NotificationCount, error)
+	CountUnreadInGroup(ctx context.Context, tenantId string, userId string, appId string, groupKey string) (models.NotificationCount, error)
+	FindChangedSince(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error)
+	FindSince(ctx context.Context, tenantId string, userId string, since time.Time, afterId primitive.ObjectID, limit int) ([]models.Notification, error)
+	FindAfterSequence(ctx context.Context, tenantId string, userId string, afterSequence int64, limit int) ([]models.Notification, error)
+	FindLastSequence(ctx context.Context, tenantId string, userId string) (int64, error)
+	SyncReadState(ctx context.Context, tenantId string, userId string, changes []models.ReadStateChange) ([]string, []models.Notification, error)
+	SetPinned(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, pinned bool) (int64, error)
+	CountPinned(ctx context.Context, tenantId string, userId string) (int64, error)
+	FindDueReminders(ctx context.Context, now time.Time, limit int) ([]models.Notification, error)
+	MarkReminded(ctx context.Context, notificationId primitive.ObjectID, at time.Time) (int64, error)
 }
@@ -0,0 +1,251 @@
+package notificationRepository
+
+import (
+	"context"
+	"r2-notify-server/breaker"
+	"r2-notify-server/data"
+	"r2-notify-server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NotificationRepositoryBreaker guards the calls of a NotificationRepository with a circuit breaker, so they fail fast
+// while the database is unavailable.
+type NotificationRepositoryBreaker struct {
+	NotificationRepository
+	breaker *breaker.Breaker
+}
+
+// NewNotificationRepositoryBreaker wraps the repository with the given circuit breaker.
+func NewNotificationRepositoryBreaker(repository NotificationRepository, circuitBreaker *breaker.Breaker) NotificationRepository {
+	return &NotificationRepositoryBreaker{NotificationRepository: repository, breaker: circuitBreaker}
+}
+
+func (t *NotificationRepositoryBreaker) FindAll(ctx context.Context, tenantId string, userId string) ([]models.Notification, error) {
+	return breaker.Call(t.breaker, func() ([]models.Notification, error) { return t.NotificationRepository.FindAll(ctx, tenantId, userId) })
+}
+
+func (t *NotificationRepositoryBreaker) FindHistory(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error) {
+	return breaker.Call(t.breaker, func() ([]models.Notification, error) {
+		return t.NotificationRepository.FindHistory(ctx, tenantId, userId, since)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) FindList(ctx context.Context, tenantId string, userId string, query data.NotificationListQuery) ([]models.Notification, error) {
+	return breaker.Call(t.breaker, func() ([]models.Notification, error) {
+		return t.NotificationRepository.FindList(ctx, tenantId, userId, query)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) FindById(ctx context.Context, tenantId string, id primitive.ObjectID, userId string) (models.Notification, error) {
+	return breaker.Call(t.breaker, func() (models.Notification, error) {
+		return t.NotificationRepository.FindById(ctx, tenantId, id, userId)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) Create(ctx context.Context, notification models.Notification) (primitive.ObjectID, error) {
+	return breaker.Call(t.breaker, func() (primitive.ObjectID, error) { return t.NotificationRepository.Create(ctx, notification) })
+}
+
+func (t *NotificationRepositoryBreaker) Collapse(ctx context.Context, notification models.Notification) (primitive.ObjectID, error) {
+	return breaker.Call(t.breaker, func() (primitive.ObjectID, error) { return t.NotificationRepository.Collapse(ctx, notification) })
+}
+
+func (t *NotificationRepositoryBreaker) MarkAsRead(ctx context.Context, tenantId string, clientId string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) { return t.NotificationRepository.MarkAsRead(ctx, tenantId, clientId) })
+}
+
+func (t *NotificationRepositoryBreaker) MarkAppAsRead(ctx context.Context, tenantId string, clientId string, appId string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) { return t.NotificationRepository.MarkAppAsRead(ctx, tenantId, clientId, appId) })
+}
+
+func (t *NotificationRepositoryBreaker) MarkGroupAsRead(ctx context.Context, tenantId string, clientId string, appId string, groupKey string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) {
+		return t.NotificationRepository.MarkGroupAsRead(ctx, tenantId, clientId, appId, groupKey)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) MarkGroupAsReadBefore(ctx context.Context, tenantId string, clientId string, appId string, groupKey string, before time.Time) ([]string, error) {
+	return breaker.Call(t.breaker, func() ([]string, error) {
+		return t.NotificationRepository.MarkGroupAsReadBefore(ctx, tenantId, clientId, appId, groupKey, before)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) MarkThreadAsRead(ctx context.Context, tenantId string, userId string, rootId string) ([]string, error) {
+	return breaker.Call(t.breaker, func() ([]string, error) {
+		return t.NotificationRepository.MarkThreadAsRead(ctx, tenantId, userId, rootId)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) MarkNotificationAsRead(ctx context.Context, tenantId string, clientId string, notificationId string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) {
+		return t.NotificationRepository.MarkNotificationAsRead(ctx, tenantId, clientId, notificationId)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) UpdateStatus(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, from string, to string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) {
+		return t.NotificationRepository.UpdateStatus(ctx, tenantId, userId, notificationId, from, to)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) RecordDelivery(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, delivery models.NotificationDelivery, timings models.NotificationTimings) error {
+	return t.breaker.Execute(func() error {
+		return t.NotificationRepository.RecordDelivery(ctx, tenantId, userId, notificationId, delivery, timings)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) SetSequence(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, sequence int64) error {
+	return t.breaker.Execute(func() error {
+		return t.NotificationRepository.SetSequence(ctx, tenantId, userId, notificationId, sequence)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) Discard(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID) error {
+	return t.breaker.Execute(func() error {
+		return t.NotificationRepository.Discard(ctx, tenantId, userId, notificationId)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) DeleteNotifications(ctx context.Context, tenantId string, clientId string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) { return t.NotificationRepository.DeleteNotifications(ctx, tenantId, clientId) })
+}
+
+func (t *NotificationRepositoryBreaker) DeleteAppNotifications(ctx context.Context, tenantId string, clientId string, appId string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) {
+		return t.NotificationRepository.DeleteAppNotifications(ctx, tenantId, clientId, appId)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) DeleteGroupNotifications(ctx context.Context, tenantId string, clientId string, appId string, groupKey string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) {
+		return t.NotificationRepository.DeleteGroupNotifications(ctx, tenantId, clientId, appId, groupKey)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) DeleteNotification(ctx context.Context, tenantId string, clientId string, notificationId string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) {
+		return t.NotificationRepository.DeleteNotification(ctx, tenantId, clientId, notificationId)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) FindAppIds(ctx context.Context, tenantId string, userId string) ([]string, error) {
+	return breaker.Call(t.breaker, func() ([]string, error) { return t.NotificationRepository.FindAppIds(ctx, tenantId, userId) })
+}
+
+func (t *NotificationRepositoryBreaker) FindIds(ctx context.Context, tenantId string, userId string, appId string, groupKey string, unreadOnly bool) ([]string, error) {
+	return breaker.Call(t.breaker, func() ([]string, error) {
+		return t.NotificationRepository.FindIds(ctx, tenantId, userId, appId, groupKey, unreadOnly)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) RestoreDeleted(ctx context.Context, tenantId string, userId string, since time.Time) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) { return t.NotificationRepository.RestoreDeleted(ctx, tenantId, userId, since) })
+}
+
+func (t *NotificationRepositoryBreaker) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) { return t.NotificationRepository.PurgeDeleted(ctx, before) })
+}
+
+func (t *NotificationRepositoryBreaker) DeleteExpired(ctx context.Context, appId string, readStatus bool, before time.Time) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) {
+		return t.NotificationRepository.DeleteExpired(ctx, appId, readStatus, before)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) Erase(ctx context.Context, tenantId string, userId string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) { return t.NotificationRepository.Erase(ctx, tenantId, userId) })
+}
+
+func (t *NotificationRepositoryBreaker) Export(ctx context.Context, tenantId string, userId string, query data.NotificationExportQuery, yield func(models.Notification) error) error {
+	return t.breaker.Execute(func() error {
+		return t.NotificationRepository.Export(ctx, tenantId, userId, query, yield)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) Search(ctx context.Context, tenantId string, userId string, query data.NotificationSearchQuery) ([]models.Notification, int64, error) {
+	var result []models.Notification
+	var total int64
+	err := t.breaker.Execute(func() error {
+		var err error
+		result, total, err = t.NotificationRepository.Search(ctx, tenantId, userId, query)
+		return err
+	})
+	return result, total, err
+}
+
+func (t *NotificationRepositoryBreaker) CountReplies(ctx context.Context, tenantId string, userId string, rootIds []string) ([]models.ThreadCount, error) {
+	return breaker.Call(t.breaker, func() ([]models.ThreadCount, error) {
+		return t.NotificationRepository.CountReplies(ctx, tenantId, userId, rootIds)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) CountByGroup(ctx context.Context, tenantId string, userId string) ([]models.NotificationCount, error) {
+	return breaker.Call(t.breaker, func() ([]models.NotificationCount, error) {
+		return t.NotificationRepository.CountByGroup(ctx, tenantId, userId)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) FindChangedSince(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error) {
+	return breaker.Call(t.breaker, func() ([]models.Notification, error) {
+		return t.NotificationRepository.FindChangedSince(ctx, tenantId, userId, since)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) FindAfterSequence(ctx context.Context, tenantId string, userId string, afterSequence int64, limit int) ([]models.Notification, error) {
+	return breaker.Call(t.breaker, func() ([]models.Notification, error) {
+		return t.NotificationRepository.FindAfterSequence(ctx, tenantId, userId, afterSequence, limit)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) FindLastSequence(ctx context.Context, tenantId string, userId string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) {
+		return t.NotificationRepository.FindLastSequence(ctx, tenantId, userId)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) FindSince(ctx context.Context, tenantId string, userId string, since time.Time, afterId primitive.ObjectID, limit int) ([]models.Notification, error) {
+	return breaker.Call(t.breaker, func() ([]models.Notification, error) {
+		return t.NotificationRepository.FindSince(ctx, tenantId, userId, since, afterId, limit)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) SyncReadState(ctx context.Context, tenantId string, userId string, changes []models.ReadStateChange) ([]string, []models.Notification, error) {
+	var applied []string
+	var notifications []models.Notification
+	err := t.breaker.Execute(func() error {
+		var err error
+		applied, notifications, err = t.NotificationRepository.SyncReadState(ctx, tenantId, userId, changes)
+		return err
+	})
+	return applied, notifications, err
+}
+
+func (t *NotificationRepositoryBreaker) SetPinned(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, pinned bool) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) {
+		return t.NotificationRepository.SetPinned(ctx, tenantId, userId, notificationId, pinned)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) CountPinned(ctx context.Context, tenantId string, userId string) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) {
+		return t.NotificationRepository.CountPinned(ctx, tenantId, userId)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) CountUnreadInGroup(ctx context.Context, tenantId string, userId string, appId string, groupKey string) (models.NotificationCount, error) {
+	return breaker.Call(t.breaker, func() (models.NotificationCount, error) {
+		return t.NotificationRepository.CountUnreadInGroup(ctx, tenantId, userId, appId, groupKey)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) FindDueReminders(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	return breaker.Call(t.breaker, func() ([]models.Notification, error) {
+		return t.NotificationRepository.FindDueReminders(ctx, now, limit)
+	})
+}
+
+func (t *NotificationRepositoryBreaker) MarkReminded(ctx context.Context, notificationId primitive.ObjectID, at time.Time) (int64, error) {
+	return breaker.Call(t.breaker, func() (int64, error) { return t.NotificationRepository.MarkReminded(ctx, notificationId, at) })
+}
@@ -0,0 +1,211 @@
+package notificationRepository
+
+import (
+	"context"
+	"r2-notify-server/data"
+	"r2-notify-server/encryption"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NotificationRepositoryEncryption encrypts the message of the notifications of the configured apps before they are
+// stored and decrypts the messages of the notifications read back, so the content of sensitive apps is encrypted at rest.
+// Messages are encrypted per user: the tenantId and userId of the notification scope the key.
+type NotificationRepositoryEncryption struct {
+	NotificationRepository
+	cipher *encryption.Cipher
+	appIds map[string]bool
+}
+
+// NewNotificationRepositoryEncryption wraps the repository, encrypting the messages of the given apps with the cipher.
+// Encrypted messages are decrypted whatever their app, so an app can be removed from the list without losing access to
+// its stored messages.
+func NewNotificationRepositoryEncryption(repository NotificationRepository, cipher *encryption.Cipher, appIds []string) NotificationRepository {
+	apps := make(map[string]bool, len(appIds))
+	for _, appId := range appIds {
+		apps[appId] = true
+	}
+	return &NotificationRepositoryEncryption{NotificationRepository: repository, cipher: cipher, appIds: apps}
+}
+
+func (t *NotificationRepositoryEncryption) FindAll(ctx context.Context, tenantId string, userId string) ([]models.Notification, error) {
+	notifications, err := t.NotificationRepository.FindAll(ctx, tenantId, userId)
+	if err != nil {
+		return nil, err
+	}
+	return t.decryptAll(notifications)
+}
+
+func (t *NotificationRepositoryEncryption) FindHistory(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error) {
+	notifications, err := t.NotificationRepository.FindHistory(ctx, tenantId, userId, since)
+	if err != nil {
+		return nil, err
+	}
+	return t.decryptAll(notifications)
+}
+
+func (t *NotificationRepositoryEncryption) FindList(ctx context.Context, tenantId string, userId string, query data.NotificationListQuery) ([]models.Notification, error) {
+	notifications, err := t.NotificationRepository.FindList(ctx, tenantId, userId, query)
+	if err != nil {
+		return nil, err
+	}
+	return t.decryptAll(notifications)
+}
+
+func (t *NotificationRepositoryEncryption) FindById(ctx context.Context, tenantId string, id primitive.ObjectID, userId string) (models.Notification, error) {
+	notification, err := t.NotificationRepository.FindById(ctx, tenantId, id, userId)
+	if err != nil {
+		return models.Notification{}, err
+	}
+	if err := t.decrypt(&notification); err != nil {
+		return models.Notification{}, err
+	}
+	return notification, nil
+}
+
+func (t *NotificationRepositoryEncryption) Create(ctx context.Context, notification models.Notification) (primitive.ObjectID, error) {
+	if err := t.encrypt(&notification); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return t.NotificationRepository.Create(ctx, notification)
+}
+
+func (t *NotificationRepositoryEncryption) Collapse(ctx context.Context, notification models.Notification) (primitive.ObjectID, error) {
+	if err := t.encrypt(&notification); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return t.NotificationRepository.Collapse(ctx, notification)
+}
+
+func (t *NotificationRepositoryEncryption) Export(ctx context.Context, tenantId string, userId string, query data.NotificationExportQuery, yield func(models.Notification) error) error {
+	return t.NotificationRepository.Export(ctx, tenantId, userId, query, func(notification models.Notification) error {
+		if err := t.decrypt(&notification); err != nil {
+			return err
+		}
+		return yield(notification)
+	})
+}
+
+// Search finds the notifications matching the query. The text of encrypted messages cannot be searched, so only the
+// notifications with a plain text message match a text query.
+func (t *NotificationRepositoryEncryption) Search(ctx context.Context, tenantId string, userId string, query data.NotificationSearchQuery) ([]models.Notification, int64, error) {
+	notifications, total, err := t.NotificationRepository.Search(ctx, tenantId, userId, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	notifications, err = t.decryptAll(notifications)
+	if err != nil {
+		return nil, 0, err
+	}
+	return notifications, total, nil
+}
+
+func (t *NotificationRepositoryEncryption) FindChangedSince(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error) {
+	notifications, err := t.NotificationRepository.FindChangedSince(ctx, tenantId, userId, since)
+	if err != nil {
+		return nil, err
+	}
+	return t.decryptAll(notifications)
+}
+
+func (t *NotificationRepositoryEncryption) FindAfterSequence(ctx context.Context, tenantId string, userId string, afterSequence int64, limit int) ([]models.Notification, error) {
+	notifications, err := t.NotificationRepository.FindAfterSequence(ctx, tenantId, userId, afterSequence, limit)
+	if err != nil {
+		return nil, err
+	}
+	return t.decryptAll(notifications)
+}
+
+func (t *NotificationRepositoryEncryption) FindSince(ctx context.Context, tenantId string, userId string, since time.Time, afterId primitive.ObjectID, limit int) ([]models.Notification, error) {
+	notifications, err := t.NotificationRepository.FindSince(ctx, tenantId, userId, since, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	return t.decryptAll(notifications)
+}
+
+func (t *NotificationRepositoryEncryption) SyncReadState(ctx context.Context, tenantId string, userId string, changes []models.ReadStateChange) ([]string, []models.Notification, error) {
+	applied, notifications, err := t.NotificationRepository.SyncReadState(ctx, tenantId, userId, changes)
+	if err != nil {
+		return nil, nil, err
+	}
+	notifications, err = t.decryptAll(notifications)
+	if err != nil {
+		return nil, nil, err
+	}
+	return applied, notifications, nil
+}
+
+func (t *NotificationRepositoryEncryption) FindDueReminders(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	notifications, err := t.NotificationRepository.FindDueReminders(ctx, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return t.decryptAll(notifications)
+}
+
+// decryptAll decrypts the messages of the notifications in place and returns them.
+func (t *NotificationRepositoryEncryption) decryptAll(notifications []models.Notification) ([]models.Notification, error) {
+	for i := range notifications {
+		if err := t.decrypt(&notifications[i]); err != nil {
+			return nil, err
+		}
+	}
+	return notifications, nil
+}
+
+// encrypt encrypts the message of the notification in place when its app is configured for encryption.
+// Messages that are already encrypted are left unchanged.
+func (t *NotificationRepositoryEncryption) encrypt(notification *models.Notification) error {
+	if !t.appIds[notification.AppId] || encryption.IsEncrypted(notification.Message) {
+		return nil
+	}
+	encrypted, err := t.cipher.Encrypt(encryptionScope(*notification), notification.Message)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "EncryptMessage",
+			Message:   "Failed to encrypt notification message for userId: " + notification.UserId + ", appId: " + notification.AppId,
+			Error:     err,
+			UserId:    notification.UserId,
+			AppId:     notification.AppId,
+		})
+		metrics.Inc("notifications.encrypt.failed")
+		return err
+	}
+	notification.Message = encrypted
+	metrics.Inc("notifications.encrypted")
+	return nil
+}
+
+// decrypt decrypts the message of the notification in place. Plain text messages are left unchanged.
+// It returns an Internal error if the message cannot be decrypted, for example because its key was removed.
+func (t *NotificationRepositoryEncryption) decrypt(notification *models.Notification) error {
+	if !encryption.IsEncrypted(notification.Message) {
+		return nil
+	}
+	message, err := t.cipher.Decrypt(encryptionScope(*notification), notification.Message)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "DecryptMessage",
+			Message:   "Failed to decrypt message of notification " + notification.Id.Hex() + " for userId: " + notification.UserId,
+			Error:     err,
+			UserId:    notification.UserId,
+			AppId:     notification.AppId,
+		})
+		metrics.Inc("notifications.decrypt.failed")
+		return err
+	}
+	notification.Message = message
+	return nil
+}
+
+// encryptionScope returns the encryption scope of the notification, which binds its message to its tenant and user.
+func encryptionScope(notification models.Notification) string {
+	return notification.TenantId + "/" + notification.UserId
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
 	"r2-notify-server/logger"
 	"r2-notify-server/models"
 	"strings"
@@ -13,6 +15,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type NotificationRepositoryImpl struct {
@@ -26,17 +29,19 @@ func NewNotificationRepositoryImpl(Db *mongo.Database) NotificationRepository {
 	return &NotificationRepositoryImpl{Db: Db}
 }
 
-// FindAll finds all unread notifications for a given user.
+// FindAll finds all unread and pinned notifications for a given user, pinned notifications first.
 // The notifications are retrieved from the database, and the function returns a slice of Notification
 // objects. If an error occurs during the retrieval process, the function returns an error.
-func (t NotificationRepositoryImpl) FindAll(userId string) (notifications []models.Notification, err error) {
+func (t NotificationRepositoryImpl) FindAll(ctx context.Context, tenantId string, userId string) (notifications []models.Notification, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Repository",
 		Operation: "FindAll",
 		Message:   "Fetching all unread notifications for userId: " + userId,
 		UserId:    userId,
 	})
-	cursor, err := t.Db.Collection("notifications").Find(context.Background(), bson.M{"userId": userId, "readStatus": false})
+	filter := notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": userId, "$or": unreadOrPinned()})
+	opts := options.Find().SetSort(bson.D{{Key: "pinned", Value: -1}, {Key: "createdAt", Value: 1}})
+	cursor, err := t.Db.Collection("notifications").Find(ctx, filter, opts)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
@@ -45,11 +50,11 @@ func (t NotificationRepositoryImpl) FindAll(userId string) (notifications []mode
 			Error:     err,
 			UserId:    userId,
 		})
-		return nil, err
+		return nil, apperrors.FromDatabase(err, "notification not found")
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var notification models.Notification
 		if err := cursor.Decode(&notification); err != nil {
 			logger.Log.Error(logger.LogPayload{
@@ -59,7 +64,7 @@ func (t NotificationRepositoryImpl) FindAll(userId string) (notifications []mode
 				Error:     err,
 				UserId:    userId,
 			})
-			return nil, err
+			return nil, apperrors.FromDatabase(err, "notification not found")
 		}
 		notifications = append(notifications, notification)
 	}
@@ -72,7 +77,7 @@ func (t NotificationRepositoryImpl) FindAll(userId string) (notifications []mode
 			Error:     err,
 			UserId:    userId,
 		})
-		return nil, err
+		return nil, apperrors.FromDatabase(err, "notification not found")
 	}
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Repository",
@@ -83,19 +88,108 @@ func (t NotificationRepositoryImpl) FindAll(userId string) (notifications []mode
 	return notifications, nil
 }
 
+// FindHistory finds the unread and pinned notifications for a given user together with the read ones created
+// at or after since, pinned notifications first and then oldest first.
+func (t NotificationRepositoryImpl) FindHistory(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindHistory",
+		Message:   "Fetching notifications created since " + since.Format(time.RFC3339) + " for userId: " + userId,
+		UserId:    userId,
+	})
+	filter := notDeleted(bson.M{
+		"tenantId": tenantFilter(tenantId),
+		"userId":   userId,
+		"$or":      append(unreadOrPinned(), bson.M{"createdAt": bson.M{"$gte": since}}),
+	})
+	opts := options.Find().SetSort(bson.D{{Key: "pinned", Value: -1}, {Key: "createdAt", Value: 1}})
+	cursor, err := t.Db.Collection("notifications").Find(ctx, filter, opts)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindHistory",
+			Message:   "Failed to fetch notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindHistory",
+			Message:   "Failed to decode notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	return notifications, nil
+}
+
+// FindList finds the notifications of a given user selected by the query, pinned notifications first and then
+// newest first. Only unread and pinned notifications are returned unless the query includes read ones; the since
+// and limit filters are applied when set.
+func (t NotificationRepositoryImpl) FindList(ctx context.Context, tenantId string, userId string, query data.NotificationListQuery) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindList",
+		Message:   "Fetching notification list for userId: " + userId,
+		UserId:    userId,
+	})
+	filter := notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": userId})
+	if !query.IncludeRead {
+		filter["$or"] = unreadOrPinned()
+	}
+	if query.Since != nil {
+		filter["createdAt"] = bson.M{"$gte": *query.Since}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "pinned", Value: -1}, {Key: "createdAt", Value: -1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+	cursor, err := t.Db.Collection("notifications").Find(ctx, filter, opts)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindList",
+			Message:   "Failed to fetch notification list for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindList",
+			Message:   "Failed to decode notification list for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	return notifications, nil
+}
+
 // FindById retrieves a notification document from the database using the specified notificationId and userId.
 // It returns the notification if found, or an error if the notification is not found or if there is an issue with the database query.
-func (t NotificationRepositoryImpl) FindById(notificationId primitive.ObjectID, userId string) (notification models.Notification, err error) {
+func (t NotificationRepositoryImpl) FindById(ctx context.Context, tenantId string, notificationId primitive.ObjectID, userId string) (notification models.Notification, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Repository",
 		Operation: "FindById",
 		Message:   "Fetching notification by ID for userId: " + userId,
 		UserId:    userId,
 	})
-	result := t.Db.Collection("notifications").FindOne(context.Background(), bson.M{"_id": notificationId, "userId": userId})
+	result := t.Db.Collection("notifications").FindOne(ctx, notDeleted(bson.M{"_id": notificationId, "tenantId": tenantFilter(tenantId), "userId": userId}))
 	if err := result.Err(); err != nil {
 		if err == mongo.ErrNoDocuments {
-			notFoundErr := errors.New("notification not found")
+			notFoundErr := apperrors.NotFound("notification not found")
 			logger.Log.Error(logger.LogPayload{
 				Component: "Notification Repository",
 				Operation: "FindById",
@@ -112,7 +206,7 @@ func (t NotificationRepositoryImpl) FindById(notificationId primitive.ObjectID,
 			Error:     err,
 			UserId:    userId,
 		})
-		return models.Notification{}, err
+		return models.Notification{}, apperrors.FromDatabase(err, "notification not found")
 	}
 	if err := result.Decode(&notification); err != nil {
 		logger.Log.Error(logger.LogPayload{
@@ -122,7 +216,7 @@ func (t NotificationRepositoryImpl) FindById(notificationId primitive.ObjectID,
 			Error:     err,
 			UserId:    userId,
 		})
-		return models.Notification{}, err
+		return models.Notification{}, apperrors.FromDatabase(err, "notification not found")
 	}
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Repository",
@@ -134,14 +228,14 @@ func (t NotificationRepositoryImpl) FindById(notificationId primitive.ObjectID,
 }
 
 // Create creates a new notification document in the database and returns the ID of the newly created document, or an error if the creation fails.
-func (t *NotificationRepositoryImpl) Create(notification models.Notification) (primitive.ObjectID, error) {
+func (t *NotificationRepositoryImpl) Create(ctx context.Context, notification models.Notification) (primitive.ObjectID, error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Repository",
 		Operation: "Create",
 		Message:   "Creating notification for userId: " + notification.UserId,
 		UserId:    notification.UserId,
 	})
-	result, err := t.Db.Collection("notifications").InsertOne(context.Background(), notification)
+	result, err := t.Db.Collection("notifications").InsertOne(ctx, notification)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
@@ -150,11 +244,11 @@ func (t *NotificationRepositoryImpl) Create(notification models.Notification) (p
 			Error:     err,
 			UserId:    notification.UserId,
 		})
-		return primitive.NilObjectID, err
+		return primitive.NilObjectID, apperrors.FromDatabase(err, "notification not found")
 	}
 	id, ok := result.InsertedID.(primitive.ObjectID)
 	if !ok {
-		convertErr := errors.New("failed to convert inserted ID to ObjectID")
+		convertErr := apperrors.Internal("failed to convert inserted ID to ObjectID", nil)
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
 			Operation: "Create",
@@ -173,18 +267,134 @@ func (t *NotificationRepositoryImpl) Create(notification models.Notification) (p
 	return id, nil
 }
 
-// MarkAsRead marks all unread notifications for a given user as read.
+// Collapse replaces the newest notification of the same user and app with the collapse key of the given
+// notification, keeping its ID, and returns that ID. The replaced notification takes the content, status,
+// actions, attachments, UI hints, sender and timestamps of the given notification and is unread again. It keeps
+// its sequence number until it is numbered again with SetSequence.
+// It returns a not found error if the user has no notification with the collapse key.
+func (t *NotificationRepositoryImpl) Collapse(ctx context.Context, notification models.Notification) (primitive.ObjectID, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Collapse",
+		Message:   "Replacing notification with collapseKey: " + notification.CollapseKey + " for userId: " + notification.UserId,
+		UserId:    notification.UserId,
+		AppId:     notification.AppId,
+	})
+	filter := notDeleted(bson.M{
+		"tenantId":    tenantFilter(notification.TenantId),
+		"userId":      notification.UserId,
+		"appId":       notification.AppId,
+		"collapseKey": notification.CollapseKey,
+	})
+	set := bson.M{
+		"groupKey":   notification.GroupKey,
+		"message":    notification.Message,
+		"status":     notification.Status,
+		"readStatus": false,
+		"createdAt":  notification.CreatedAt,
+		"updatedAt":  notification.UpdatedAt,
+		"origin":     notification.Origin,
+	}
+	// Fields stored with omitempty are removed when the new notification does not set them. The reminder
+	// of the replaced notification is sent again.
+	unset := bson.M{"readAt": "", "remindedAt": ""}
+	if len(notification.Actions) > 0 {
+		set["actions"] = notification.Actions
+	} else {
+		unset["actions"] = ""
+	}
+	if len(notification.Attachments) > 0 {
+		set["attachments"] = notification.Attachments
+	} else {
+		unset["attachments"] = ""
+	}
+	if notification.UIHints != nil {
+		set["uiHints"] = notification.UIHints
+	} else {
+		unset["uiHints"] = ""
+	}
+	if notification.Timings != nil {
+		set["timings"] = notification.Timings
+	} else {
+		unset["timings"] = ""
+	}
+	if notification.Source != nil {
+		set["source"] = notification.Source
+	} else {
+		unset["source"] = ""
+	}
+	if notification.ExpiresAt != nil {
+		set["expiresAt"] = notification.ExpiresAt
+	} else {
+		unset["expiresAt"] = ""
+	}
+	if notification.RemindAt != nil {
+		set["remindAt"] = notification.RemindAt
+	} else {
+		unset["remindAt"] = ""
+	}
+	if notification.Truncated {
+		set["truncated"] = true
+	} else {
+		unset["truncated"] = ""
+	}
+	if notification.ParentId != "" {
+		set["parentId"] = notification.ParentId
+	} else {
+		unset["parentId"] = ""
+	}
+	for field, value := range map[string]string{
+		"senderId":        notification.SenderId,
+		"senderName":      notification.SenderName,
+		"senderAvatarUrl": notification.SenderAvatarUrl,
+	} {
+		if value != "" {
+			set[field] = value
+		} else {
+			unset[field] = ""
+		}
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetProjection(bson.M{"_id": 1})
+	var replaced models.Notification
+	err := t.Db.Collection("notifications").FindOneAndUpdate(ctx, filter, bson.M{"$set": set, "$unset": unset}, opts).Decode(&replaced)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Notification Repository",
+				Operation: "Collapse",
+				Message:   "Failed to replace notification with collapseKey: " + notification.CollapseKey + " for userId: " + notification.UserId,
+				Error:     err,
+				UserId:    notification.UserId,
+				AppId:     notification.AppId,
+			})
+		}
+		return primitive.NilObjectID, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Collapse",
+		Message:   "Successfully replaced notification " + replaced.Id.Hex() + " for userId: " + notification.UserId,
+		UserId:    notification.UserId,
+		AppId:     notification.AppId,
+	})
+	return replaced.Id, nil
+}
+
+// MarkAsRead marks all unread notifications for a given user as read, except pinned notifications.
+// It returns the number of notifications modified.
 // It trims and removes any double quotes from the clientId,
 // and then updates all relevant notifications in the database with the current time and sets the readStatus to true.
 // It returns an error if there is an issue with the database query.
-func (t *NotificationRepositoryImpl) MarkAsRead(clientId string) error {
+func (t *NotificationRepositoryImpl) MarkAsRead(ctx context.Context, tenantId string, clientId string) (int64, error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Repository",
 		Operation: "MarkAsRead",
 		Message:   "Marking all notifications as read for userId: " + clientId,
 		UserId:    clientId,
 	})
-	updatedResults, err := t.Db.Collection("notifications").UpdateMany(context.Background(), bson.M{"userId": clientId}, bson.M{"$set": bson.M{"readStatus": true, "updatedAt": primitive.NewDateTimeFromTime(time.Now())}})
+	updatedResults, err := t.Db.Collection("notifications").UpdateMany(ctx, notPinned(notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": clientId})), markRead())
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
@@ -193,7 +403,7 @@ func (t *NotificationRepositoryImpl) MarkAsRead(clientId string) error {
 			Error:     err,
 			UserId:    clientId,
 		})
-		return err
+		return 0, apperrors.FromDatabase(err, "notification not found")
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Notification Repository",
@@ -201,11 +411,12 @@ func (t *NotificationRepositoryImpl) MarkAsRead(clientId string) error {
 		Message:   "Marked notifications as read for userId: " + clientId + " | Matched: " + fmt.Sprintf("%d", updatedResults.MatchedCount) + " Modified: " + fmt.Sprintf("%d", updatedResults.ModifiedCount),
 		UserId:    clientId,
 	})
-	return nil
+	return updatedResults.ModifiedCount, nil
 }
 
-// MarkAppAsRead marks all unread notifications for a given user and appId as read.
-func (t *NotificationRepositoryImpl) MarkAppAsRead(clientId string, appId string) error {
+// MarkAppAsRead marks all unread notifications for a given user and appId as read, except pinned notifications.
+// It returns the number of notifications modified.
+func (t *NotificationRepositoryImpl) MarkAppAsRead(ctx context.Context, tenantId string, clientId string, appId string) (int64, error) {
 	appId = strings.TrimSpace(appId)
 	appId = strings.Trim(appId, `"'`)
 	logger.Log.Debug(logger.LogPayload{
@@ -215,7 +426,7 @@ func (t *NotificationRepositoryImpl) MarkAppAsRead(clientId string, appId string
 		UserId:    clientId,
 		AppId:     appId,
 	})
-	updatedResults, err := t.Db.Collection("notifications").UpdateMany(context.Background(), bson.M{"userId": clientId, "appId": appId}, bson.M{"$set": bson.M{"readStatus": true, "updatedAt": primitive.NewDateTimeFromTime(time.Now())}})
+	updatedResults, err := t.Db.Collection("notifications").UpdateMany(ctx, notPinned(notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": clientId, "appId": appId})), markRead())
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
@@ -225,7 +436,7 @@ func (t *NotificationRepositoryImpl) MarkAppAsRead(clientId string, appId string
 			UserId:    clientId,
 			AppId:     appId,
 		})
-		return err
+		return 0, apperrors.FromDatabase(err, "notification not found")
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Notification Repository",
@@ -234,13 +445,14 @@ func (t *NotificationRepositoryImpl) MarkAppAsRead(clientId string, appId string
 		UserId:    clientId,
 		AppId:     appId,
 	})
-	return nil
+	return updatedResults.ModifiedCount, nil
 }
 
-// MarkGroupAsRead marks all unread notifications for a given user, appId and groupKey as read.
+// MarkGroupAsRead marks all unread notifications for a given user, appId and groupKey as read, except pinned notifications.
+// It returns the number of notifications modified.
 // It trims the appId and groupKey of any whitespace and removes any double quotes from the strings.
 // It then updates the relevant notifications in the database with the current time and sets the readStatus to true.
-func (t *NotificationRepositoryImpl) MarkGroupAsRead(clientId string, appId string, groupKey string) error {
+func (t *NotificationRepositoryImpl) MarkGroupAsRead(ctx context.Context, tenantId string, clientId string, appId string, groupKey string) (int64, error) {
 	appId = strings.TrimSpace(appId)
 	groupKey = strings.TrimSpace(groupKey)
 	appId = strings.Trim(appId, `"'`)
@@ -252,7 +464,7 @@ func (t *NotificationRepositoryImpl) MarkGroupAsRead(clientId string, appId stri
 		UserId:    clientId,
 		AppId:     appId,
 	})
-	updatedResults, err := t.Db.Collection("notifications").UpdateMany(context.Background(), bson.M{"userId": clientId, "appId": appId, "groupKey": groupKey}, bson.M{"$set": bson.M{"readStatus": true, "updatedAt": primitive.NewDateTimeFromTime(time.Now())}})
+	updatedResults, err := t.Db.Collection("notifications").UpdateMany(ctx, notPinned(notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": clientId, "appId": appId, "groupKey": groupKey})), markRead())
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
@@ -262,7 +474,7 @@ func (t *NotificationRepositoryImpl) MarkGroupAsRead(clientId string, appId stri
 			UserId:    clientId,
 			AppId:     appId,
 		})
-		return err
+		return 0, apperrors.FromDatabase(err, "notification not found")
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Notification Repository",
@@ -271,14 +483,145 @@ func (t *NotificationRepositoryImpl) MarkGroupAsRead(clientId string, appId stri
 		UserId:    clientId,
 		AppId:     appId,
 	})
-	return nil
+	return updatedResults.ModifiedCount, nil
+}
+
+// MarkGroupAsReadBefore marks the unread notifications for a given user, appId and groupKey created at or before
+// the given time as read, and returns the IDs of the notifications it marked. Notifications created later, for
+// example while the user was looking at the group, and pinned notifications are left unread.
+func (t *NotificationRepositoryImpl) MarkGroupAsReadBefore(ctx context.Context, tenantId string, clientId string, appId string, groupKey string, before time.Time) ([]string, error) {
+	appId = strings.Trim(strings.TrimSpace(appId), `"'`)
+	groupKey = strings.Trim(strings.TrimSpace(groupKey), `"'`)
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "MarkGroupAsReadBefore",
+		Message:   "Marking group notifications created before " + before.Format(time.RFC3339) + " as read for userId: " + clientId + ", appId: " + appId + ", groupKey: " + groupKey,
+		UserId:    clientId,
+		AppId:     appId,
+	})
+	collection := t.Db.Collection("notifications")
+	filter := notPinned(notDeleted(bson.M{
+		"tenantId":   tenantFilter(tenantId),
+		"userId":     clientId,
+		"appId":      appId,
+		"groupKey":   groupKey,
+		"readStatus": bson.M{"$ne": true},
+		"createdAt":  bson.M{"$lte": before},
+	}))
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "MarkGroupAsReadBefore",
+			Message:   "Failed to fetch group notifications for userId: " + clientId + ", appId: " + appId + ", groupKey: " + groupKey,
+			Error:     err,
+			UserId:    clientId,
+			AppId:     appId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+	var results []struct {
+		Id primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	if len(results) == 0 {
+		return []string{}, nil
+	}
+	objIds := make(bson.A, 0, len(results))
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		objIds = append(objIds, result.Id)
+		ids = append(ids, result.Id.Hex())
+	}
+	// Only the notifications found above are marked, so notifications arriving in between stay unread.
+	updatedResults, err := collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": objIds}, "readStatus": bson.M{"$ne": true}}, markRead())
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "MarkGroupAsReadBefore",
+			Message:   "Failed to mark group notifications as read for userId: " + clientId + ", appId: " + appId + ", groupKey: " + groupKey,
+			Error:     err,
+			UserId:    clientId,
+			AppId:     appId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "MarkGroupAsReadBefore",
+		Message:   "Marked group notifications as read for userId: " + clientId + ", appId: " + appId + ", groupKey: " + groupKey + " | Matched: " + fmt.Sprintf("%d", updatedResults.MatchedCount) + " Modified: " + fmt.Sprintf("%d", updatedResults.ModifiedCount),
+		UserId:    clientId,
+		AppId:     appId,
+	})
+	return ids, nil
+}
+
+// MarkThreadAsRead marks the unread follow-ups of the root notification with the given ID as read, and returns
+// the IDs of the notifications it marked. Pinned follow-ups are left unread.
+func (t *NotificationRepositoryImpl) MarkThreadAsRead(ctx context.Context, tenantId string, userId string, rootId string) ([]string, error) {
+	rootId = strings.Trim(strings.TrimSpace(rootId), `"'`)
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "MarkThreadAsRead",
+		Message:   "Marking follow-ups of notification " + rootId + " as read for userId: " + userId,
+		UserId:    userId,
+	})
+	collection := t.Db.Collection("notifications")
+	filter := notPinned(notDeleted(bson.M{
+		"tenantId":   tenantFilter(tenantId),
+		"userId":     userId,
+		"parentId":   rootId,
+		"readStatus": bson.M{"$ne": true},
+	}))
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "MarkThreadAsRead",
+			Message:   "Failed to fetch follow-ups of notification " + rootId + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+	var results []struct {
+		Id primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	if len(results) == 0 {
+		return []string{}, nil
+	}
+	objIds := make(bson.A, 0, len(results))
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		objIds = append(objIds, result.Id)
+		ids = append(ids, result.Id.Hex())
+	}
+	if _, err := collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": objIds}, "readStatus": bson.M{"$ne": true}}, markRead()); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "MarkThreadAsRead",
+			Message:   "Failed to mark follow-ups of notification " + rootId + " as read for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	return ids, nil
 }
 
 // MarkNotificationAsRead marks a notification as read for a given user.
+// It returns the number of notifications modified.
 // It takes a clientId and a notificationId as arguments, trims and removes any double quotes from the strings,
 // converts the notificationId to an ObjectID, and then updates the relevant notification in the database with the current time and sets the readStatus to true.
 // It returns an error if the notification is not found or if there is an issue with the database query.
-func (t *NotificationRepositoryImpl) MarkNotificationAsRead(clientId string, notificationId string) error {
+func (t *NotificationRepositoryImpl) MarkNotificationAsRead(ctx context.Context, tenantId string, clientId string, notificationId string) (int64, error) {
 	notificationId = strings.TrimSpace(notificationId)
 	notificationId = strings.Trim(notificationId, `"'`)
 	logger.Log.Debug(logger.LogPayload{
@@ -296,9 +639,9 @@ func (t *NotificationRepositoryImpl) MarkNotificationAsRead(clientId string, not
 			Error:     err,
 			UserId:    clientId,
 		})
-		return err
+		return 0, apperrors.Validation("invalid notification ID", err)
 	}
-	updatedResults, err := t.Db.Collection("notifications").UpdateByID(context.Background(), objID, bson.M{"$set": bson.M{"readStatus": true, "updatedAt": primitive.NewDateTimeFromTime(time.Now())}})
+	updatedResults, err := t.Db.Collection("notifications").UpdateOne(ctx, notDeleted(bson.M{"_id": objID, "tenantId": tenantFilter(tenantId), "userId": clientId}), markRead())
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
@@ -307,7 +650,7 @@ func (t *NotificationRepositoryImpl) MarkNotificationAsRead(clientId string, not
 			Error:     err,
 			UserId:    clientId,
 		})
-		return err
+		return 0, apperrors.FromDatabase(err, "notification not found")
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Notification Repository",
@@ -315,21 +658,100 @@ func (t *NotificationRepositoryImpl) MarkNotificationAsRead(clientId string, not
 		Message:   "Marked notification as read for userId: " + clientId + " | Matched: " + fmt.Sprintf("%d", updatedResults.MatchedCount) + " Modified: " + fmt.Sprintf("%d", updatedResults.ModifiedCount),
 		UserId:    clientId,
 	})
+	return updatedResults.ModifiedCount, nil
+}
+
+// UpdateStatus moves a notification of the given user from the from status to the to status.
+// The update only applies while the notification still has the from status, so concurrent changes
+// cannot skip a transition. It returns the number of notifications modified.
+func (t *NotificationRepositoryImpl) UpdateStatus(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, from string, to string) (int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "UpdateStatus",
+		Message:   "Updating status of notification " + notificationId.Hex() + " from " + from + " to " + to + " for userId: " + userId,
+		UserId:    userId,
+	})
+	updatedResults, err := t.Db.Collection("notifications").UpdateOne(ctx, notDeleted(bson.M{"_id": notificationId, "tenantId": tenantFilter(tenantId), "userId": userId, "status": from}), bson.M{"$set": bson.M{"status": to, "updatedAt": primitive.NewDateTimeFromTime(time.Now())}})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "UpdateStatus",
+			Message:   "Failed to update status of notification " + notificationId.Hex() + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "UpdateStatus",
+		Message:   "Updated status of notification " + notificationId.Hex() + " for userId: " + userId + " | Matched: " + fmt.Sprintf("%d", updatedResults.MatchedCount) + " Modified: " + fmt.Sprintf("%d", updatedResults.ModifiedCount),
+		UserId:    userId,
+	})
+	return updatedResults.ModifiedCount, nil
+}
+
+// RecordDelivery stores the outcome of the delivery of the notification and its timings. The update time of the
+// notification is left unchanged, since the notification itself did not change.
+func (t *NotificationRepositoryImpl) RecordDelivery(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, delivery models.NotificationDelivery, timings models.NotificationTimings) error {
+	_, err := t.Db.Collection("notifications").UpdateOne(ctx, bson.M{"_id": notificationId, "tenantId": tenantFilter(tenantId), "userId": userId}, bson.M{"$set": bson.M{"delivery": delivery, "timings": timings}})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "RecordDelivery",
+			Message:   "Failed to record delivery of notification " + notificationId.Hex() + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return apperrors.FromDatabase(err, "notification not found")
+	}
+	return nil
+}
+
+// SetSequence sets the sequence number of the notification with the given ID of the given userId.
+func (t *NotificationRepositoryImpl) SetSequence(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, sequence int64) error {
+	_, err := t.Db.Collection("notifications").UpdateOne(ctx, bson.M{"_id": notificationId, "tenantId": tenantFilter(tenantId), "userId": userId}, bson.M{"$set": bson.M{"sequence": sequence}})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "SetSequence",
+			Message:   "Failed to number notification " + notificationId.Hex() + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return apperrors.FromDatabase(err, "notification not found")
+	}
+	return nil
+}
+
+// Discard permanently deletes the notification with the given ID of the given userId, undoing its creation.
+func (t *NotificationRepositoryImpl) Discard(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID) error {
+	_, err := t.Db.Collection("notifications").DeleteOne(ctx, bson.M{"_id": notificationId, "tenantId": tenantFilter(tenantId), "userId": userId})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Discard",
+			Message:   "Failed to discard notification " + notificationId.Hex() + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return apperrors.FromDatabase(err, "notification not found")
+	}
 	return nil
 }
 
-// DeleteAllNotifications deletes all notifications for a given user.
+// DeleteAllNotifications soft-deletes all notifications for a given user, except pinned notifications.
 // It trims and removes any double quotes from the clientId,
-// and then deletes all relevant notifications in the database.
+// and then flags all relevant notifications in the database as deleted.
 // It returns an error if there is an issue with the database query.
-func (t *NotificationRepositoryImpl) DeleteNotifications(clientId string) error {
+func (t *NotificationRepositoryImpl) DeleteNotifications(ctx context.Context, tenantId string, clientId string) (int64, error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Repository",
 		Operation: "DeleteNotifications",
 		Message:   "Deleting all notifications for userId: " + clientId,
 		UserId:    clientId,
 	})
-	deleteResult, err := t.Db.Collection("notifications").DeleteMany(context.Background(), bson.M{"userId": clientId})
+	deleteResult, err := t.Db.Collection("notifications").UpdateMany(ctx, notPinned(notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": clientId})), softDelete())
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
@@ -338,19 +760,20 @@ func (t *NotificationRepositoryImpl) DeleteNotifications(clientId string) error
 			Error:     err,
 			UserId:    clientId,
 		})
-		return err
+		return 0, apperrors.FromDatabase(err, "notification not found")
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Notification Repository",
 		Operation: "DeleteNotifications",
-		Message:   "Deleted notifications for userId: " + clientId + " | Deleted: " + fmt.Sprintf("%d", deleteResult.DeletedCount),
+		Message:   "Deleted notifications for userId: " + clientId + " | Deleted: " + fmt.Sprintf("%d", deleteResult.ModifiedCount),
 		UserId:    clientId,
 	})
-	return nil
+	return deleteResult.ModifiedCount, nil
 }
 
-// DeleteAppNotifications deletes all notifications for a given user and appId.
-func (t *NotificationRepositoryImpl) DeleteAppNotifications(clientId string, appId string) error {
+// DeleteAppNotifications soft-deletes all notifications for a given user and appId, except pinned notifications.
+// It returns the number of notifications deleted.
+func (t *NotificationRepositoryImpl) DeleteAppNotifications(ctx context.Context, tenantId string, clientId string, appId string) (int64, error) {
 	appId = strings.TrimSpace(appId)
 	appId = strings.Trim(appId, `"'`)
 	logger.Log.Debug(logger.LogPayload{
@@ -360,7 +783,7 @@ func (t *NotificationRepositoryImpl) DeleteAppNotifications(clientId string, app
 		UserId:    clientId,
 		AppId:     appId,
 	})
-	deleteResult, err := t.Db.Collection("notifications").DeleteMany(context.Background(), bson.M{"userId": clientId, "appId": appId})
+	deleteResult, err := t.Db.Collection("notifications").UpdateMany(ctx, notPinned(notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": clientId, "appId": appId})), softDelete())
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
@@ -370,22 +793,22 @@ func (t *NotificationRepositoryImpl) DeleteAppNotifications(clientId string, app
 			UserId:    clientId,
 			AppId:     appId,
 		})
-		return err
+		return 0, apperrors.FromDatabase(err, "notification not found")
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Notification Repository",
 		Operation: "DeleteAppNotifications",
-		Message:   "Deleted app notifications for userId: " + clientId + ", appId: " + appId + " | Deleted: " + fmt.Sprintf("%d", deleteResult.DeletedCount),
+		Message:   "Deleted app notifications for userId: " + clientId + ", appId: " + appId + " | Deleted: " + fmt.Sprintf("%d", deleteResult.ModifiedCount),
 		UserId:    clientId,
 		AppId:     appId,
 	})
-	return nil
+	return deleteResult.ModifiedCount, nil
 }
 
-// DeleteGroupNotifications deletes all notifications for a given user, appId and groupKey.
+// DeleteGroupNotifications soft-deletes all notifications for a given user, appId and groupKey, except pinned notifications.
 // It trims the appId and groupKey of any whitespace and removes any double quotes from the strings.
-// It then deletes the relevant notifications in the database.
-func (t *NotificationRepositoryImpl) DeleteGroupNotifications(clientId string, appId string, groupKey string) error {
+// It then flags the relevant notifications in the database as deleted.
+func (t *NotificationRepositoryImpl) DeleteGroupNotifications(ctx context.Context, tenantId string, clientId string, appId string, groupKey string) (int64, error) {
 	appId = strings.TrimSpace(appId)
 	groupKey = strings.TrimSpace(groupKey)
 	appId = strings.Trim(appId, `"'`)
@@ -397,7 +820,7 @@ func (t *NotificationRepositoryImpl) DeleteGroupNotifications(clientId string, a
 		UserId:    clientId,
 		AppId:     appId,
 	})
-	deleteResult, err := t.Db.Collection("notifications").DeleteMany(context.Background(), bson.M{"userId": clientId, "appId": appId, "groupKey": groupKey})
+	deleteResult, err := t.Db.Collection("notifications").UpdateMany(ctx, notPinned(notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": clientId, "appId": appId, "groupKey": groupKey})), softDelete())
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
@@ -407,23 +830,23 @@ func (t *NotificationRepositoryImpl) DeleteGroupNotifications(clientId string, a
 			UserId:    clientId,
 			AppId:     appId,
 		})
-		return err
+		return 0, apperrors.FromDatabase(err, "notification not found")
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Notification Repository",
 		Operation: "DeleteGroupNotifications",
-		Message:   "Deleted group notifications for userId: " + clientId + ", appId: " + appId + ", groupKey: " + groupKey + " | Deleted: " + fmt.Sprintf("%d", deleteResult.DeletedCount),
+		Message:   "Deleted group notifications for userId: " + clientId + ", appId: " + appId + ", groupKey: " + groupKey + " | Deleted: " + fmt.Sprintf("%d", deleteResult.ModifiedCount),
 		UserId:    clientId,
 		AppId:     appId,
 	})
-	return nil
+	return deleteResult.ModifiedCount, nil
 }
 
-// DeleteNotification deletes a notification for a given user.
+// DeleteNotification soft-deletes a notification for a given user.
 // It takes a clientId and a notificationId as arguments, trims and removes any double quotes from the strings,
-// converts the notificationId to an ObjectID, and then deletes the relevant notification in the database.
+// converts the notificationId to an ObjectID, and then flags the relevant notification in the database as deleted.
 // It returns an error if the notification is not found or if there is an issue with the database query.
-func (t *NotificationRepositoryImpl) DeleteNotification(clientId string, notificationId string) error {
+func (t *NotificationRepositoryImpl) DeleteNotification(ctx context.Context, tenantId string, clientId string, notificationId string) (int64, error) {
 	notificationId = strings.TrimSpace(notificationId)
 	notificationId = strings.Trim(notificationId, `"'`)
 	logger.Log.Debug(logger.LogPayload{
@@ -441,9 +864,9 @@ func (t *NotificationRepositoryImpl) DeleteNotification(clientId string, notific
 			Error:     err,
 			UserId:    clientId,
 		})
-		return err
+		return 0, apperrors.Validation("invalid notification ID", err)
 	}
-	deleteResult, err := t.Db.Collection("notifications").DeleteOne(context.Background(), bson.M{"userId": clientId, "_id": objID})
+	deleteResult, err := t.Db.Collection("notifications").UpdateOne(ctx, notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": clientId, "_id": objID}), softDelete())
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Repository",
@@ -452,13 +875,971 @@ func (t *NotificationRepositoryImpl) DeleteNotification(clientId string, notific
 			Error:     err,
 			UserId:    clientId,
 		})
-		return err
+		return 0, apperrors.FromDatabase(err, "notification not found")
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Notification Repository",
 		Operation: "DeleteNotification",
-		Message:   "Deleted notification for userId: " + clientId + " | Deleted: " + fmt.Sprintf("%d", deleteResult.DeletedCount),
+		Message:   "Deleted notification for userId: " + clientId + " | Deleted: " + fmt.Sprintf("%d", deleteResult.ModifiedCount),
 		UserId:    clientId,
 	})
-	return nil
+	return deleteResult.ModifiedCount, nil
+}
+
+// FindAppIds returns the distinct appIds the given user has notifications from.
+func (t NotificationRepositoryImpl) FindAppIds(ctx context.Context, tenantId string, userId string) ([]string, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindAppIds",
+		Message:   "Fetching distinct appIds for userId: " + userId,
+		UserId:    userId,
+	})
+	values, err := t.Db.Collection("notifications").Distinct(ctx, "appId", notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": userId}))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindAppIds",
+			Message:   "Failed to fetch distinct appIds for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	appIds := make([]string, 0, len(values))
+	for _, value := range values {
+		if appId, ok := value.(string); ok {
+			appIds = append(appIds, appId)
+		}
+	}
+	return appIds, nil
+}
+
+// FindIds returns the IDs of the given user's notifications affected by the bulk operations, optionally restricted
+// to an appId, a groupKey within that app and to unread notifications. Empty appId and groupKey match all values.
+// Pinned notifications are left out, since the bulk operations skip them.
+func (t NotificationRepositoryImpl) FindIds(ctx context.Context, tenantId string, userId string, appId string, groupKey string, unreadOnly bool) ([]string, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindIds",
+		Message:   "Fetching notification IDs for userId: " + userId + ", appId: " + appId + ", groupKey: " + groupKey,
+		UserId:    userId,
+		AppId:     appId,
+	})
+	filter := notPinned(notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": userId}))
+	if appId = strings.Trim(strings.TrimSpace(appId), `"'`); appId != "" {
+		filter["appId"] = appId
+	}
+	if groupKey = strings.Trim(strings.TrimSpace(groupKey), `"'`); groupKey != "" {
+		filter["groupKey"] = groupKey
+	}
+	if unreadOnly {
+		filter["readStatus"] = bson.M{"$ne": true}
+	}
+	cursor, err := t.Db.Collection("notifications").Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindIds",
+			Message:   "Failed to fetch notification IDs for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+			AppId:     appId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+	var results []struct {
+		Id primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.Id.Hex())
+	}
+	return ids, nil
+}
+
+// RestoreDeleted restores the notifications of a given user soft-deleted at or after the given time.
+// It returns the number of notifications restored.
+func (t *NotificationRepositoryImpl) RestoreDeleted(ctx context.Context, tenantId string, userId string, since time.Time) (int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "RestoreDeleted",
+		Message:   "Restoring notifications deleted since " + since.Format(time.RFC3339) + " for userId: " + userId,
+		UserId:    userId,
+	})
+	filter := bson.M{"tenantId": tenantFilter(tenantId), "userId": userId, "deletedAt": bson.M{"$gte": primitive.NewDateTimeFromTime(since)}}
+	update := bson.M{"$unset": bson.M{"deletedAt": ""}, "$set": bson.M{"updatedAt": primitive.NewDateTimeFromTime(time.Now())}}
+	updatedResults, err := t.Db.Collection("notifications").UpdateMany(ctx, filter, update)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "RestoreDeleted",
+			Message:   "Failed to restore deleted notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "RestoreDeleted",
+		Message:   "Restored deleted notifications for userId: " + userId + " | Restored: " + fmt.Sprintf("%d", updatedResults.ModifiedCount),
+		UserId:    userId,
+	})
+	return updatedResults.ModifiedCount, nil
+}
+
+// PurgeDeleted permanently removes the notifications soft-deleted before the given time.
+// It returns the number of notifications removed.
+func (t *NotificationRepositoryImpl) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "PurgeDeleted",
+		Message:   "Purging notifications deleted before " + before.Format(time.RFC3339),
+	})
+	deleteResult, err := t.Db.Collection("notifications").DeleteMany(ctx, bson.M{"deletedAt": bson.M{"$lt": primitive.NewDateTimeFromTime(before)}})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "PurgeDeleted",
+			Message:   "Failed to purge deleted notifications",
+			Error:     err,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "PurgeDeleted",
+		Message:   "Purged deleted notifications | Deleted: " + fmt.Sprintf("%d", deleteResult.DeletedCount),
+	})
+	return deleteResult.DeletedCount, nil
+}
+
+// DeleteExpired permanently removes the notifications of the app with the given read status created
+// before the given time, including soft-deleted notifications. It returns the number of notifications removed.
+func (t *NotificationRepositoryImpl) DeleteExpired(ctx context.Context, appId string, readStatus bool, before time.Time) (int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "DeleteExpired",
+		Message:   fmt.Sprintf("Deleting notifications with readStatus %t created before %s for appId: %s", readStatus, before.Format(time.RFC3339), appId),
+		AppId:     appId,
+	})
+	filter := bson.M{"appId": appId, "readStatus": readStatus, "createdAt": bson.M{"$lt": primitive.NewDateTimeFromTime(before)}}
+	deleteResult, err := t.Db.Collection("notifications").DeleteMany(ctx, filter)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "DeleteExpired",
+			Message:   "Failed to delete expired notifications for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "DeleteExpired",
+		Message:   "Deleted expired notifications for appId: " + appId + " | Deleted: " + fmt.Sprintf("%d", deleteResult.DeletedCount),
+		AppId:     appId,
+	})
+	return deleteResult.DeletedCount, nil
+}
+
+// Erase permanently deletes every notification of the given user, including soft-deleted notifications.
+// It returns the number of notifications deleted.
+func (t *NotificationRepositoryImpl) Erase(ctx context.Context, tenantId string, userId string) (int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Erase",
+		Message:   "Erasing notifications for userId: " + userId,
+		UserId:    userId,
+	})
+	deleteResult, err := t.Db.Collection("notifications").DeleteMany(ctx, bson.M{"tenantId": tenantFilter(tenantId), "userId": userId})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Erase",
+			Message:   "Failed to erase notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Erase",
+		Message:   "Erased notifications for userId: " + userId + " | Deleted: " + fmt.Sprintf("%d", deleteResult.DeletedCount),
+		UserId:    userId,
+	})
+	return deleteResult.DeletedCount, nil
+}
+
+// SyncReadState merges read status changes made by a client, possibly while offline, with the stored read
+// state of the given user's notifications. The last write wins: a change is applied only if it was made after
+// the stored read state was last changed, or the notification was never read. Deleted notifications are skipped.
+// It returns the IDs of the notifications whose read state was changed and the current state of the
+// notifications targeted by the changes, in no particular order.
+func (t *NotificationRepositoryImpl) SyncReadState(ctx context.Context, tenantId string, userId string, changes []models.ReadStateChange) ([]string, []models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "SyncReadState",
+		Message:   fmt.Sprintf("Syncing read state of %d notifications for userId: %s", len(changes), userId),
+		UserId:    userId,
+	})
+	collection := t.Db.Collection("notifications")
+	now := primitive.NewDateTimeFromTime(time.Now())
+	applied := []string{}
+	ids := make(bson.A, 0, len(changes))
+	for _, change := range changes {
+		ids = append(ids, change.Id)
+		readAt := primitive.NewDateTimeFromTime(change.ReadAt)
+		filter := notDeleted(bson.M{
+			"_id":      change.Id,
+			"tenantId": tenantFilter(tenantId),
+			"userId":   userId,
+			"$or":      bson.A{bson.M{"readAt": nil}, bson.M{"readAt": bson.M{"$lt": readAt}}},
+		})
+		updatedResult, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"readStatus": change.ReadStatus, "readAt": readAt, "updatedAt": now}})
+		if err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Notification Repository",
+				Operation: "SyncReadState",
+				Message:   "Failed to sync read state of notification " + change.Id.Hex() + " for userId: " + userId,
+				Error:     err,
+				UserId:    userId,
+			})
+			return nil, nil, apperrors.FromDatabase(err, "notification not found")
+		}
+		if updatedResult.MatchedCount > 0 {
+			applied = append(applied, change.Id.Hex())
+		}
+	}
+
+	cursor, err := collection.Find(ctx, notDeleted(bson.M{"_id": bson.M{"$in": ids}, "tenantId": tenantFilter(tenantId), "userId": userId}))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "SyncReadState",
+			Message:   "Failed to fetch synced notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "SyncReadState",
+			Message:   "Failed to decode synced notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "SyncReadState",
+		Message:   "Synced read state for userId: " + userId + " | Changes: " + fmt.Sprintf("%d", len(changes)) + " Applied: " + fmt.Sprintf("%d", len(applied)),
+		UserId:    userId,
+	})
+	return applied, notifications, nil
+}
+
+// SetPinned pins or unpins a notification of the given user and returns the number of notifications
+// modified, 0 if the notification already had the given pinned state. The update time is changed, so
+// clients resuming later receive the notification again.
+func (t *NotificationRepositoryImpl) SetPinned(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, pinned bool) (int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "SetPinned",
+		Message:   fmt.Sprintf("Setting pinned to %t on notification %s for userId: %s", pinned, notificationId.Hex(), userId),
+		UserId:    userId,
+	})
+	filter := notDeleted(bson.M{"_id": notificationId, "tenantId": tenantFilter(tenantId), "userId": userId, "pinned": bson.M{"$ne": pinned}})
+	update := bson.M{"$set": bson.M{"pinned": true, "updatedAt": primitive.NewDateTimeFromTime(time.Now())}}
+	if !pinned {
+		update = bson.M{"$unset": bson.M{"pinned": ""}, "$set": bson.M{"updatedAt": primitive.NewDateTimeFromTime(time.Now())}}
+	}
+	updatedResults, err := t.Db.Collection("notifications").UpdateOne(ctx, filter, update)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "SetPinned",
+			Message:   "Failed to set pinned on notification " + notificationId.Hex() + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "SetPinned",
+		Message:   "Set pinned on notification " + notificationId.Hex() + " for userId: " + userId + " | Matched: " + fmt.Sprintf("%d", updatedResults.MatchedCount) + " Modified: " + fmt.Sprintf("%d", updatedResults.ModifiedCount),
+		UserId:    userId,
+	})
+	return updatedResults.ModifiedCount, nil
+}
+
+// CountPinned returns the number of notifications the given user has pinned.
+func (t NotificationRepositoryImpl) CountPinned(ctx context.Context, tenantId string, userId string) (int64, error) {
+	count, err := t.Db.Collection("notifications").CountDocuments(ctx, notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": userId, "pinned": true}))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "CountPinned",
+			Message:   "Failed to count pinned notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	return count, nil
+}
+
+// CountUnreadInGroup counts the unread notifications of the given group of the given user that are not
+// deleted, with the creation time of the oldest of them, using an aggregation pipeline. The count is zero
+// if the group has no unread notification.
+func (t NotificationRepositoryImpl) CountUnreadInGroup(ctx context.Context, tenantId string, userId string, appId string, groupKey string) (models.NotificationCount, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "CountUnreadInGroup",
+		Message:   "Counting unread notifications of group " + groupKey + " for userId: " + userId,
+		UserId:    userId,
+		AppId:     appId,
+	})
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": userId, "appId": appId, "groupKey": groupKey, "readStatus": false})}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      nil,
+			"count":    bson.M{"$sum": 1},
+			"oldestAt": bson.M{"$min": "$createdAt"},
+		}}},
+	}
+	count := models.NotificationCount{AppId: appId, GroupKey: groupKey}
+	cursor, err := t.Db.Collection("notifications").Aggregate(ctx, pipeline)
+	if err == nil {
+		defer cursor.Close(ctx)
+		if cursor.Next(ctx) {
+			err = cursor.Decode(&count)
+		} else {
+			err = cursor.Err()
+		}
+	}
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "CountUnreadInGroup",
+			Message:   "Failed to count unread notifications of group " + groupKey + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+			AppId:     appId,
+		})
+		return models.NotificationCount{}, apperrors.FromDatabase(err, "notification not found")
+	}
+	return count, nil
+}
+
+// FindDueReminders finds at most limit unread notifications of any user whose reminder is due at the given
+// time and was not sent yet, oldest reminder first. Notifications that already expired are skipped.
+func (t NotificationRepositoryImpl) FindDueReminders(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindDueReminders",
+		Message:   "Fetching notifications to remind at " + now.Format(time.RFC3339),
+	})
+	nowDate := primitive.NewDateTimeFromTime(now)
+	filter := notDeleted(bson.M{
+		"remindAt":   bson.M{"$lte": nowDate},
+		"remindedAt": bson.M{"$exists": false},
+		"readStatus": false,
+		"$or":        bson.A{bson.M{"expiresAt": bson.M{"$exists": false}}, bson.M{"expiresAt": bson.M{"$gt": nowDate}}},
+	})
+	findOptions := options.Find().SetSort(bson.D{{Key: "remindAt", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := t.Db.Collection("notifications").Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindDueReminders",
+			Message:   "Failed to fetch notifications to remind",
+			Error:     err,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindDueReminders",
+			Message:   "Failed to decode notifications to remind",
+			Error:     err,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	return notifications, nil
+}
+
+// MarkReminded records that the reminder of the notification was sent at the given time. It returns 0 if the
+// reminder was already recorded, for example by another instance, so each reminder is sent once.
+func (t *NotificationRepositoryImpl) MarkReminded(ctx context.Context, notificationId primitive.ObjectID, at time.Time) (int64, error) {
+	filter := bson.M{"_id": notificationId, "remindedAt": bson.M{"$exists": false}}
+	updatedResults, err := t.Db.Collection("notifications").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"remindedAt": primitive.NewDateTimeFromTime(at)}})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "MarkReminded",
+			Message:   "Failed to record the reminder of notification " + notificationId.Hex(),
+			Error:     err,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	return updatedResults.ModifiedCount, nil
+}
+
+// notDeleted restricts a filter to notifications that have not been soft-deleted.
+func notDeleted(filter bson.M) bson.M {
+	filter["deletedAt"] = bson.M{"$exists": false}
+	return filter
+}
+
+// notPinned restricts a filter to notifications that are not pinned, which the bulk operations skip.
+func notPinned(filter bson.M) bson.M {
+	filter["pinned"] = bson.M{"$ne": true}
+	return filter
+}
+
+// unreadOrPinned returns the $or clause matching unread notifications and pinned notifications, which
+// are listed whether they were read or not.
+func unreadOrPinned() bson.A {
+	return bson.A{bson.M{"readStatus": false}, bson.M{"pinned": true}}
+}
+
+// tenantFilter matches the documents of the given tenant. Documents of the default tenant are stored
+// without a tenantId, so an empty tenantId matches documents where the field is missing or empty.
+func tenantFilter(tenantId string) interface{} {
+	if tenantId == "" {
+		return bson.M{"$in": bson.A{nil, ""}}
+	}
+	return tenantId
+}
+
+// softDelete returns the update flagging notifications as deleted. Soft-deleted notifications are
+// hidden from all queries until they are restored or purged.
+func softDelete() bson.M {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	return bson.M{"$set": bson.M{"deletedAt": now, "updatedAt": now}}
+}
+
+// markRead returns the update marking notifications as read now. The read time is kept so read state
+// changes synced later by offline clients can be merged with the last write winning.
+func markRead() bson.M {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	return bson.M{"$set": bson.M{"readStatus": true, "readAt": now, "updatedAt": now}}
+}
+
+// CreateIndexes creates the indexes required by the notification queries.
+// It creates a text index on the message field which backs the full-text search, an index
+// on deletedAt used to purge soft-deleted notifications, an index on userId and updatedAt
+// used to resume clients, an index on appId, readStatus and createdAt used by the per-app retention, a
+// sparse index on remindAt used by the reminder scheduler, a sparse index on userId and sequence used by
+// sequence resyncs and an index on userId, appId, groupKey and readStatus used to count group summaries.
+// Creating an index that already exists is a no-op, so it is safe to call on every startup.
+func (t *NotificationRepositoryImpl) CreateIndexes() error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "CreateIndexes",
+		Message:   "Creating notification indexes",
+	})
+	_, err := t.Db.Collection("notifications").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "message", Value: "text"}},
+			Options: options.Index().SetName("message_text"),
+		},
+		{
+			Keys:    bson.D{{Key: "deletedAt", Value: 1}},
+			Options: options.Index().SetName("deletedAt").SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "updatedAt", Value: 1}},
+			Options: options.Index().SetName("userId_updatedAt"),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "appId", Value: 1}, {Key: "collapseKey", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("userId_appId_collapseKey").SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "appId", Value: 1}, {Key: "readStatus", Value: 1}, {Key: "createdAt", Value: 1}},
+			Options: options.Index().SetName("appId_readStatus_createdAt"),
+		},
+		{
+			Keys:    bson.D{{Key: "remindAt", Value: 1}},
+			Options: options.Index().SetName("remindAt").SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "parentId", Value: 1}},
+			Options: options.Index().SetName("userId_parentId").SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "sequence", Value: 1}},
+			Options: options.Index().SetName("userId_sequence").SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "appId", Value: 1}, {Key: "groupKey", Value: 1}, {Key: "readStatus", Value: 1}},
+			Options: options.Index().SetName("userId_appId_groupKey_readStatus"),
+		},
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "CreateIndexes",
+			Message:   "Failed to create notification indexes",
+			Error:     err,
+		})
+		return apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "CreateIndexes",
+		Message:   "Successfully created notification indexes",
+	})
+	return nil
+}
+
+// Export passes the notifications of a given user to yield one at a time, oldest first, including read
+// and soft-deleted notifications. The appId and createdAt range filters are applied when set. Documents
+// are decoded from the cursor as they arrive, so the notifications are never all held in memory.
+// An error returned by yield stops the export and is returned as is.
+func (t *NotificationRepositoryImpl) Export(ctx context.Context, tenantId string, userId string, query data.NotificationExportQuery, yield func(models.Notification) error) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Export",
+		Message:   "Exporting notifications for userId: " + userId,
+		UserId:    userId,
+		AppId:     query.AppId,
+	})
+	filter := bson.M{"tenantId": tenantFilter(tenantId), "userId": userId}
+	if query.AppId != "" {
+		filter["appId"] = query.AppId
+	}
+	createdAt := bson.M{}
+	if query.From != nil {
+		createdAt["$gte"] = *query.From
+	}
+	if query.To != nil {
+		createdAt["$lte"] = *query.To
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+
+	cursor, err := t.Db.Collection("notifications").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Export",
+			Message:   "Failed to export notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+
+	var exported int64
+	for cursor.Next(ctx) {
+		var notification models.Notification
+		if err := cursor.Decode(&notification); err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Notification Repository",
+				Operation: "Export",
+				Message:   "Failed to decode notification for userId: " + userId,
+				Error:     err,
+				UserId:    userId,
+			})
+			return apperrors.FromDatabase(err, "notification not found")
+		}
+		if err := yield(notification); err != nil {
+			return err
+		}
+		exported++
+	}
+	if err := cursor.Err(); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Export",
+			Message:   "Failed to read notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Export",
+		Message:   "Exported " + fmt.Sprintf("%d", exported) + " notifications for userId: " + userId,
+		UserId:    userId,
+	})
+	return nil
+}
+
+// Search finds the notifications of a given user matching the search query.
+// The free-text query is matched against the message text index and results are ordered by relevance,
+// otherwise results are ordered by newest first. The appId, status, readStatus, source type and createdAt
+// range filters are applied when set. It returns the requested page along with the total number of matches.
+func (t *NotificationRepositoryImpl) Search(ctx context.Context, tenantId string, userId string, query data.NotificationSearchQuery) ([]models.Notification, int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Search",
+		Message:   "Searching notifications for userId: " + userId,
+		UserId:    userId,
+		AppId:     query.AppId,
+	})
+	filter := notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": userId})
+	if query.Query != "" {
+		filter["$text"] = bson.M{"$search": query.Query}
+	}
+	if query.AppId != "" {
+		filter["appId"] = query.AppId
+	}
+	if query.Status != "" {
+		filter["status"] = query.Status
+	}
+	if query.ReadStatus != nil {
+		filter["readStatus"] = *query.ReadStatus
+	}
+	if query.Source != "" {
+		filter["source.type"] = query.Source
+	}
+	createdAt := bson.M{}
+	if query.From != nil {
+		createdAt["$gte"] = *query.From
+	}
+	if query.To != nil {
+		createdAt["$lte"] = *query.To
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+
+	total, err := t.Db.Collection("notifications").CountDocuments(ctx, filter)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Search",
+			Message:   "Failed to count notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, 0, apperrors.FromDatabase(err, "notification not found")
+	}
+
+	findOptions := options.Find().
+		SetSkip(int64((query.Page - 1) * query.PageSize)).
+		SetLimit(int64(query.PageSize))
+	if query.Query != "" {
+		findOptions.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}})
+		findOptions.SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "createdAt", Value: -1}})
+	} else {
+		findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	}
+
+	cursor, err := t.Db.Collection("notifications").Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Search",
+			Message:   "Failed to search notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Search",
+			Message:   "Failed to decode notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Search",
+		Message:   "Found " + fmt.Sprintf("%d", total) + " notifications for userId: " + userId,
+		UserId:    userId,
+	})
+	return notifications, total, nil
+}
+
+// CountByGroup counts the notifications of the given userId that are not deleted, grouped by appId,
+// groupKey, status, source type and read status, using an aggregation pipeline. Notifications without a
+// source are counted under an empty source type.
+func (t *NotificationRepositoryImpl) CountByGroup(ctx context.Context, tenantId string, userId string) ([]models.NotificationCount, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "CountByGroup",
+		Message:   "Counting notifications for userId: " + userId,
+		UserId:    userId,
+	})
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": userId})}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"appId":      "$appId",
+				"groupKey":   "$groupKey",
+				"status":     "$status",
+				"source":     bson.M{"$ifNull": bson.A{"$source.type", ""}},
+				"readStatus": "$readStatus",
+			},
+			"count":    bson.M{"$sum": 1},
+			"oldestAt": bson.M{"$min": "$createdAt"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":        0,
+			"appId":      "$_id.appId",
+			"groupKey":   "$_id.groupKey",
+			"status":     "$_id.status",
+			"source":     "$_id.source",
+			"readStatus": "$_id.readStatus",
+			"count":      1,
+			"oldestAt":   1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "appId", Value: 1}, {Key: "groupKey", Value: 1}, {Key: "status", Value: 1}}}},
+	}
+	cursor, err := t.Db.Collection("notifications").Aggregate(ctx, pipeline)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "CountByGroup",
+			Message:   "Failed to count notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+
+	counts := []models.NotificationCount{}
+	if err := cursor.All(ctx, &counts); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "CountByGroup",
+			Message:   "Failed to decode notification counts for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	return counts, nil
+}
+
+// CountReplies counts the follow-ups of the given root notifications of the given userId that are not deleted,
+// and how many of them are unread, using an aggregation pipeline. Roots without follow-ups are left out.
+func (t *NotificationRepositoryImpl) CountReplies(ctx context.Context, tenantId string, userId string, rootIds []string) ([]models.ThreadCount, error) {
+	counts := []models.ThreadCount{}
+	if len(rootIds) == 0 {
+		return counts, nil
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: notDeleted(bson.M{"tenantId": tenantFilter(tenantId), "userId": userId, "parentId": bson.M{"$in": rootIds}})}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$parentId",
+			"replies": bson.M{"$sum": 1},
+			"unread":  bson.M{"$sum": bson.M{"$cond": bson.A{"$readStatus", 0, 1}}},
+		}}},
+	}
+	cursor, err := t.Db.Collection("notifications").Aggregate(ctx, pipeline)
+	if err == nil {
+		defer cursor.Close(ctx)
+		err = cursor.All(ctx, &counts)
+	}
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "CountReplies",
+			Message:   "Failed to count follow-ups for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	return counts, nil
+}
+
+// FindChangedSince finds the notifications of the given userId created or changed at or after the given
+// time, including those deleted since, ordered by the time of the change.
+func (t *NotificationRepositoryImpl) FindChangedSince(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindChangedSince",
+		Message:   "Fetching notifications changed since " + since.Format(time.RFC3339) + " for userId: " + userId,
+		UserId:    userId,
+	})
+	filter := bson.M{"tenantId": tenantFilter(tenantId), "userId": userId, "updatedAt": bson.M{"$gte": primitive.NewDateTimeFromTime(since)}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: 1}})
+	cursor, err := t.Db.Collection("notifications").Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindChangedSince",
+			Message:   "Failed to fetch changed notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindChangedSince",
+			Message:   "Failed to decode changed notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	return notifications, nil
+}
+
+// FindSince finds at most limit notifications of the given userId changed after the given position,
+// including those deleted since, ordered by the time of the change and then by ID. The position is the
+// updatedAt and ID of the last notification the client already has, since several notifications changed by
+// the same bulk action share their updatedAt; a zero afterId selects every notification changed at since.
+func (t *NotificationRepositoryImpl) FindSince(ctx context.Context, tenantId string, userId string, since time.Time, afterId primitive.ObjectID, limit int) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindSince",
+		Message:   "Fetching notifications changed since " + since.Format(time.RFC3339Nano) + " for userId: " + userId,
+		UserId:    userId,
+	})
+	sinceDate := primitive.NewDateTimeFromTime(since)
+	filter := bson.M{
+		"tenantId": tenantFilter(tenantId),
+		"userId":   userId,
+		"$or": bson.A{
+			bson.M{"updatedAt": bson.M{"$gt": sinceDate}},
+			bson.M{"updatedAt": sinceDate, "_id": bson.M{"$gt": afterId}},
+		},
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := t.Db.Collection("notifications").Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindSince",
+			Message:   "Failed to fetch changed notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindSince",
+			Message:   "Failed to decode changed notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	return notifications, nil
+}
+
+// FindAfterSequence finds at most limit notifications of the given userId with a sequence number greater than
+// afterSequence, in the order of their sequence numbers. Deleted notifications are left out.
+func (t *NotificationRepositoryImpl) FindAfterSequence(ctx context.Context, tenantId string, userId string, afterSequence int64, limit int) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindAfterSequence",
+		Message:   fmt.Sprintf("Fetching notifications after sequence %d for userId: %s", afterSequence, userId),
+		UserId:    userId,
+	})
+	filter := notDeleted(bson.M{
+		"tenantId": tenantFilter(tenantId),
+		"userId":   userId,
+		"sequence": bson.M{"$gt": afterSequence},
+	})
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "sequence", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := t.Db.Collection("notifications").Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindAfterSequence",
+			Message:   "Failed to fetch notifications after sequence for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindAfterSequence",
+			Message:   "Failed to decode notifications after sequence for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	return notifications, nil
+}
+
+// FindLastSequence returns the highest sequence number of the stored notifications of the given userId, 0 if
+// none is numbered. Deleted notifications are left out.
+func (t *NotificationRepositoryImpl) FindLastSequence(ctx context.Context, tenantId string, userId string) (int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindLastSequence",
+		Message:   "Fetching last sequence number for userId: " + userId,
+		UserId:    userId,
+	})
+	filter := notDeleted(bson.M{
+		"tenantId": tenantFilter(tenantId),
+		"userId":   userId,
+		"sequence": bson.M{"$gt": 0},
+	})
+	findOptions := options.FindOne().
+		SetSort(bson.D{{Key: "sequence", Value: -1}}).
+		SetProjection(bson.M{"sequence": 1})
+	var notification models.Notification
+	if err := t.Db.Collection("notifications").FindOne(ctx, filter, findOptions).Decode(&notification); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindLastSequence",
+			Message:   "Failed to fetch last sequence number for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	return notification.Sequence, nil
 }
@@ -0,0 +1,1024 @@
+package notificationRepository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Columns selected for a notification, in the order scanned by scanNotification.
+const notificationColumns = "id, tenant_id, app_id, user_id, group_key, message, status, read_status, created_at, updated_at, origin, deleted_at, actions, read_at, sender_id, sender_name, sender_avatar_url, collapse_key, attachments, delivery, timings, pinned, ui_hints, source, expires_at, remind_at, reminded_at, truncated, parent_id, sequence"
+
+type NotificationRepositoryPostgres struct {
+	Db *pgxpool.Pool
+}
+
+// NewNotificationRepositoryPostgres returns a new instance of NotificationRepositoryPostgres backed by the
+// "notifications" table. Notification IDs are generated as ObjectIDs, so IDs keep the same format
+// regardless of the database driver. The returned repository is safe to use concurrently.
+func NewNotificationRepositoryPostgres(Db *pgxpool.Pool) NotificationRepository {
+	return &NotificationRepositoryPostgres{Db: Db}
+}
+
+// FindAll finds all unread and pinned notifications for a given user, pinned notifications first.
+func (t NotificationRepositoryPostgres) FindAll(ctx context.Context, tenantId string, userId string) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindAll",
+		Message:   "Fetching all unread notifications for userId: " + userId,
+		UserId:    userId,
+	})
+	notifications, err := t.query(ctx, "FindAll", userId,
+		"SELECT "+notificationColumns+" FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND (read_status = FALSE OR pinned) AND deleted_at IS NULL ORDER BY pinned DESC, created_at",
+		tenantId, userId)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindAll",
+		Message:   "Successfully fetched notifications for userId: " + userId,
+		UserId:    userId,
+	})
+	return notifications, nil
+}
+
+// FindHistory finds the unread and pinned notifications for a given user together with the read ones created at or
+// after since, pinned notifications first.
+func (t NotificationRepositoryPostgres) FindHistory(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindHistory",
+		Message:   "Fetching notifications created since " + since.Format(time.RFC3339) + " for userId: " + userId,
+		UserId:    userId,
+	})
+	return t.query(ctx, "FindHistory", userId,
+		"SELECT "+notificationColumns+" FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND (read_status = FALSE OR pinned OR created_at >= $3) AND deleted_at IS NULL ORDER BY pinned DESC, created_at",
+		tenantId, userId, since)
+}
+
+// FindList finds the notifications of a given user selected by the query, pinned notifications first and then newest
+// first. Only unread and pinned notifications are returned unless the query includes read ones.
+func (t NotificationRepositoryPostgres) FindList(ctx context.Context, tenantId string, userId string, query data.NotificationListQuery) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindList",
+		Message:   "Fetching notification list for userId: " + userId,
+		UserId:    userId,
+	})
+	where := newConditions("tenant_id = $1 AND user_id = $2 AND deleted_at IS NULL", tenantId, userId)
+	if !query.IncludeRead {
+		where.add("(read_status = FALSE OR pinned)")
+	}
+	if query.Since != nil {
+		where.add("created_at >= $%d", *query.Since)
+	}
+	statement := "SELECT " + notificationColumns + " FROM notifications WHERE " + where.String() + " ORDER BY pinned DESC, created_at DESC"
+	args := where.args
+	if query.Limit > 0 {
+		args = append(args, query.Limit)
+		statement += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return t.query(ctx, "FindList", userId, statement, args...)
+}
+
+// FindById retrieves the notification with the given ID of the given user.
+// It returns a not found error if the notification does not exist or has been deleted.
+func (t NotificationRepositoryPostgres) FindById(ctx context.Context, tenantId string, notificationId primitive.ObjectID, userId string) (models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindById",
+		Message:   "Fetching notification for userId: " + userId,
+		UserId:    userId,
+	})
+	row := t.Db.QueryRow(ctx,
+		"SELECT "+notificationColumns+" FROM notifications WHERE tenant_id = $1 AND id = $2 AND user_id = $3 AND deleted_at IS NULL",
+		tenantId, notificationId.Hex(), userId)
+	notification, err := scanNotification(row)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindById",
+			Message:   "Error fetching notification for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return models.Notification{}, apperrors.FromDatabase(err, "notification not found")
+	}
+	return notification, nil
+}
+
+// Create inserts a new notification and returns its ID. A new ID is generated unless the notification
+// already has one.
+func (t *NotificationRepositoryPostgres) Create(ctx context.Context, notification models.Notification) (primitive.ObjectID, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Create",
+		Message:   "Creating notification for userId: " + notification.UserId,
+		UserId:    notification.UserId,
+	})
+	actions, err := marshalActions(notification.Actions)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode notification actions", err)
+	}
+	attachments, err := marshalAttachments(notification.Attachments)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode notification attachments", err)
+	}
+	timings, err := marshalTimings(notification.Timings)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode notification timings", err)
+	}
+	uiHints, err := marshalUIHints(notification.UIHints)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode notification UI hints", err)
+	}
+	source, err := marshalSource(notification.Source)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode notification source", err)
+	}
+	id := notification.Id
+	if id.IsZero() {
+		id = primitive.NewObjectID()
+	}
+	_, err = t.Db.Exec(ctx,
+		`INSERT INTO notifications (id, tenant_id, app_id, user_id, group_key, message, status, read_status, created_at, updated_at, origin, actions,
+		 sender_id, sender_name, sender_avatar_url, collapse_key, attachments, timings, ui_hints, source, expires_at, remind_at, truncated, parent_id, sequence)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)`,
+		id.Hex(), notification.TenantId, notification.AppId, notification.UserId, notification.GroupKey, notification.Message, notification.Status,
+		notification.ReadStatus, notification.CreatedAt, notification.UpdatedAt, notification.Origin, actions,
+		notification.SenderId, notification.SenderName, notification.SenderAvatarUrl, notification.CollapseKey, attachments, timings, uiHints, source,
+		notification.ExpiresAt, notification.RemindAt, notification.Truncated, notification.ParentId, notification.Sequence)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Create",
+			Message:   "Failed to create notification for userId: " + notification.UserId,
+			Error:     err,
+			UserId:    notification.UserId,
+		})
+		return primitive.NilObjectID, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Create",
+		Message:   "Successfully created notification for userId: " + notification.UserId,
+		UserId:    notification.UserId,
+	})
+	return id, nil
+}
+
+// Collapse replaces the newest notification of the same user and app with the collapse key of the given
+// notification, keeping its ID, and returns that ID. The replaced notification takes the content, status,
+// actions, attachments, UI hints, sender, source, timestamps and reminder of the given notification and is unread
+// again, so its reminder is sent again. It keeps its sequence number until it is numbered again with SetSequence.
+// It returns a not found error if the user has no notification with the collapse key.
+func (t *NotificationRepositoryPostgres) Collapse(ctx context.Context, notification models.Notification) (primitive.ObjectID, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Collapse",
+		Message:   "Replacing notification with collapseKey: " + notification.CollapseKey + " for userId: " + notification.UserId,
+		UserId:    notification.UserId,
+		AppId:     notification.AppId,
+	})
+	actions, err := marshalActions(notification.Actions)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode notification actions", err)
+	}
+	attachments, err := marshalAttachments(notification.Attachments)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode notification attachments", err)
+	}
+	timings, err := marshalTimings(notification.Timings)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode notification timings", err)
+	}
+	uiHints, err := marshalUIHints(notification.UIHints)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode notification UI hints", err)
+	}
+	source, err := marshalSource(notification.Source)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("failed to encode notification source", err)
+	}
+	var id string
+	err = t.Db.QueryRow(ctx,
+		`UPDATE notifications SET group_key = $5, message = $6, status = $7, read_status = FALSE, read_at = NULL, created_at = $8,
+		 updated_at = $9, origin = $10, actions = $11, sender_id = $12, sender_name = $13, sender_avatar_url = $14, attachments = $15,
+		 timings = $16, ui_hints = $17, source = $18, expires_at = $19, remind_at = $20, reminded_at = NULL, truncated = $21, parent_id = $22
+		 WHERE id = (SELECT id FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND app_id = $3 AND collapse_key = $4
+		 AND deleted_at IS NULL ORDER BY created_at DESC LIMIT 1)
+		 RETURNING id`,
+		notification.TenantId, notification.UserId, notification.AppId, notification.CollapseKey,
+		notification.GroupKey, notification.Message, notification.Status, notification.CreatedAt, notification.UpdatedAt,
+		notification.Origin, actions, notification.SenderId, notification.SenderName, notification.SenderAvatarUrl, attachments, timings, uiHints, source,
+		notification.ExpiresAt, notification.RemindAt, notification.Truncated, notification.ParentId).Scan(&id)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Notification Repository",
+				Operation: "Collapse",
+				Message:   "Failed to replace notification with collapseKey: " + notification.CollapseKey + " for userId: " + notification.UserId,
+				Error:     err,
+				UserId:    notification.UserId,
+				AppId:     notification.AppId,
+			})
+		}
+		return primitive.NilObjectID, apperrors.FromDatabase(err, "notification not found")
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, apperrors.Internal("invalid notification ID in database", err)
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Collapse",
+		Message:   "Successfully replaced notification " + id + " for userId: " + notification.UserId,
+		UserId:    notification.UserId,
+		AppId:     notification.AppId,
+	})
+	return objID, nil
+}
+
+// MarkAsRead marks all notifications of a given user as read, except pinned notifications, and returns the number of notifications modified.
+func (t *NotificationRepositoryPostgres) MarkAsRead(ctx context.Context, tenantId string, clientId string) (int64, error) {
+	clientId = strings.Trim(strings.TrimSpace(clientId), `"'`)
+	return t.exec(ctx, "MarkAsRead", clientId,
+		"UPDATE notifications SET read_status = TRUE, read_at = $3, updated_at = $3 WHERE tenant_id = $1 AND user_id = $2 AND NOT pinned AND deleted_at IS NULL",
+		tenantId, clientId, time.Now())
+}
+
+// MarkAppAsRead marks all notifications of a given app as read for a user, except pinned notifications, and returns the number of notifications modified.
+func (t *NotificationRepositoryPostgres) MarkAppAsRead(ctx context.Context, tenantId string, clientId string, appId string) (int64, error) {
+	clientId = strings.Trim(strings.TrimSpace(clientId), `"'`)
+	appId = strings.Trim(strings.TrimSpace(appId), `"'`)
+	return t.exec(ctx, "MarkAppAsRead", clientId,
+		"UPDATE notifications SET read_status = TRUE, read_at = $4, updated_at = $4 WHERE tenant_id = $1 AND user_id = $2 AND app_id = $3 AND NOT pinned AND deleted_at IS NULL",
+		tenantId, clientId, appId, time.Now())
+}
+
+// MarkGroupAsRead marks all notifications of a given group as read for a user, except pinned notifications, and returns the number of notifications modified.
+func (t *NotificationRepositoryPostgres) MarkGroupAsRead(ctx context.Context, tenantId string, clientId string, appId string, groupKey string) (int64, error) {
+	clientId = strings.Trim(strings.TrimSpace(clientId), `"'`)
+	appId = strings.Trim(strings.TrimSpace(appId), `"'`)
+	groupKey = strings.Trim(strings.TrimSpace(groupKey), `"'`)
+	return t.exec(ctx, "MarkGroupAsRead", clientId,
+		"UPDATE notifications SET read_status = TRUE, read_at = $5, updated_at = $5 WHERE tenant_id = $1 AND user_id = $2 AND app_id = $3 AND group_key = $4 AND NOT pinned AND deleted_at IS NULL",
+		tenantId, clientId, appId, groupKey, time.Now())
+}
+
+// MarkGroupAsReadBefore marks the unread notifications of a given user, appId and groupKey created at or before the
+// given time as read, and returns the IDs of the notifications it marked. Notifications created later and pinned
+// notifications are left unread.
+func (t *NotificationRepositoryPostgres) MarkGroupAsReadBefore(ctx context.Context, tenantId string, clientId string, appId string, groupKey string, before time.Time) ([]string, error) {
+	clientId = strings.Trim(strings.TrimSpace(clientId), `"'`)
+	appId = strings.Trim(strings.TrimSpace(appId), `"'`)
+	groupKey = strings.Trim(strings.TrimSpace(groupKey), `"'`)
+	return t.queryStrings(ctx, "MarkGroupAsReadBefore", clientId,
+		`UPDATE notifications SET read_status = TRUE, read_at = $6, updated_at = $6 WHERE tenant_id = $1 AND user_id = $2 AND app_id = $3
+		 AND group_key = $4 AND created_at <= $5 AND read_status = FALSE AND NOT pinned AND deleted_at IS NULL RETURNING id`,
+		tenantId, clientId, appId, groupKey, before, time.Now())
+}
+
+// MarkThreadAsRead marks the unread follow-ups of the root notification with the given ID as read, and returns
+// the IDs of the notifications it marked. Pinned follow-ups are left unread.
+func (t *NotificationRepositoryPostgres) MarkThreadAsRead(ctx context.Context, tenantId string, userId string, rootId string) ([]string, error) {
+	rootId = strings.Trim(strings.TrimSpace(rootId), `"'`)
+	return t.queryStrings(ctx, "MarkThreadAsRead", userId,
+		`UPDATE notifications SET read_status = TRUE, read_at = $4, updated_at = $4 WHERE tenant_id = $1 AND user_id = $2 AND parent_id = $3
+		 AND read_status = FALSE AND NOT pinned AND deleted_at IS NULL RETURNING id`,
+		tenantId, userId, rootId, time.Now())
+}
+
+// MarkNotificationAsRead marks a specific notification of a user as read and returns the number of notifications modified.
+// It returns a validation error if the notification ID is not a valid ObjectID.
+func (t *NotificationRepositoryPostgres) MarkNotificationAsRead(ctx context.Context, tenantId string, clientId string, notificationId string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(strings.Trim(strings.TrimSpace(notificationId), `"'`))
+	if err != nil {
+		return 0, apperrors.Validation("invalid notification ID", err)
+	}
+	return t.exec(ctx, "MarkNotificationAsRead", clientId,
+		"UPDATE notifications SET read_status = TRUE, read_at = $4, updated_at = $4 WHERE tenant_id = $1 AND id = $2 AND user_id = $3 AND deleted_at IS NULL",
+		tenantId, objID.Hex(), clientId, time.Now())
+}
+
+// UpdateStatus moves a notification of the given user from the from status to the to status and returns
+// the number of notifications modified. Notifications that no longer have the from status are not modified.
+func (t *NotificationRepositoryPostgres) UpdateStatus(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, from string, to string) (int64, error) {
+	return t.exec(ctx, "UpdateStatus", userId,
+		"UPDATE notifications SET status = $5, updated_at = $6 WHERE tenant_id = $1 AND id = $2 AND user_id = $3 AND status = $4 AND deleted_at IS NULL",
+		tenantId, notificationId.Hex(), userId, from, to, time.Now())
+}
+
+// RecordDelivery stores the outcome of the delivery of the notification and its timings, leaving its update time unchanged.
+func (t *NotificationRepositoryPostgres) RecordDelivery(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, delivery models.NotificationDelivery, timings models.NotificationTimings) error {
+	encoded, err := json.Marshal(delivery)
+	if err != nil {
+		return apperrors.Internal("failed to encode notification delivery", err)
+	}
+	encodedTimings, err := json.Marshal(timings)
+	if err != nil {
+		return apperrors.Internal("failed to encode notification timings", err)
+	}
+	_, err = t.exec(ctx, "RecordDelivery", userId,
+		"UPDATE notifications SET delivery = $4, timings = $5 WHERE tenant_id = $1 AND id = $2 AND user_id = $3",
+		tenantId, notificationId.Hex(), userId, encoded, encodedTimings)
+	return err
+}
+
+// SetSequence sets the sequence number of the notification with the given ID of the given userId.
+func (t *NotificationRepositoryPostgres) SetSequence(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, sequence int64) error {
+	_, err := t.exec(ctx, "SetSequence", userId,
+		"UPDATE notifications SET sequence = $4 WHERE tenant_id = $1 AND id = $2 AND user_id = $3",
+		tenantId, notificationId.Hex(), userId, sequence)
+	return err
+}
+
+// Discard permanently deletes the notification with the given ID of the given userId, undoing its creation.
+func (t *NotificationRepositoryPostgres) Discard(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID) error {
+	_, err := t.exec(ctx, "Discard", userId,
+		"DELETE FROM notifications WHERE tenant_id = $1 AND id = $2 AND user_id = $3",
+		tenantId, notificationId.Hex(), userId)
+	return err
+}
+
+// DeleteNotifications soft-deletes all notifications of a given user, except pinned notifications, and returns the number of notifications deleted.
+func (t *NotificationRepositoryPostgres) DeleteNotifications(ctx context.Context, tenantId string, clientId string) (int64, error) {
+	clientId = strings.Trim(strings.TrimSpace(clientId), `"'`)
+	return t.exec(ctx, "DeleteNotifications", clientId,
+		"UPDATE notifications SET deleted_at = $3, updated_at = $3 WHERE tenant_id = $1 AND user_id = $2 AND NOT pinned AND deleted_at IS NULL",
+		tenantId, clientId, time.Now())
+}
+
+// DeleteAppNotifications soft-deletes all notifications of a given app for a user, except pinned notifications, and returns the number of notifications deleted.
+func (t *NotificationRepositoryPostgres) DeleteAppNotifications(ctx context.Context, tenantId string, clientId string, appId string) (int64, error) {
+	clientId = strings.Trim(strings.TrimSpace(clientId), `"'`)
+	appId = strings.Trim(strings.TrimSpace(appId), `"'`)
+	return t.exec(ctx, "DeleteAppNotifications", clientId,
+		"UPDATE notifications SET deleted_at = $4, updated_at = $4 WHERE tenant_id = $1 AND user_id = $2 AND app_id = $3 AND NOT pinned AND deleted_at IS NULL",
+		tenantId, clientId, appId, time.Now())
+}
+
+// DeleteGroupNotifications soft-deletes all notifications of a given group for a user, except pinned notifications, and returns the number of notifications deleted.
+func (t *NotificationRepositoryPostgres) DeleteGroupNotifications(ctx context.Context, tenantId string, clientId string, appId string, groupKey string) (int64, error) {
+	clientId = strings.Trim(strings.TrimSpace(clientId), `"'`)
+	appId = strings.Trim(strings.TrimSpace(appId), `"'`)
+	groupKey = strings.Trim(strings.TrimSpace(groupKey), `"'`)
+	return t.exec(ctx, "DeleteGroupNotifications", clientId,
+		"UPDATE notifications SET deleted_at = $5, updated_at = $5 WHERE tenant_id = $1 AND user_id = $2 AND app_id = $3 AND group_key = $4 AND NOT pinned AND deleted_at IS NULL",
+		tenantId, clientId, appId, groupKey, time.Now())
+}
+
+// DeleteNotification soft-deletes a specific notification of a user and returns the number of notifications deleted.
+// It returns a validation error if the notification ID is not a valid ObjectID.
+func (t *NotificationRepositoryPostgres) DeleteNotification(ctx context.Context, tenantId string, clientId string, notificationId string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(strings.Trim(strings.TrimSpace(notificationId), `"'`))
+	if err != nil {
+		return 0, apperrors.Validation("invalid notification ID", err)
+	}
+	return t.exec(ctx, "DeleteNotification", clientId,
+		"UPDATE notifications SET deleted_at = $4, updated_at = $4 WHERE tenant_id = $1 AND id = $2 AND user_id = $3 AND deleted_at IS NULL",
+		tenantId, objID.Hex(), clientId, time.Now())
+}
+
+// FindAppIds returns the distinct appIds the given user has notifications from.
+func (t NotificationRepositoryPostgres) FindAppIds(ctx context.Context, tenantId string, userId string) ([]string, error) {
+	return t.queryStrings(ctx, "FindAppIds", userId,
+		"SELECT DISTINCT app_id FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND deleted_at IS NULL",
+		tenantId, userId)
+}
+
+// FindIds returns the IDs of the given user's notifications affected by the bulk operations, optionally restricted
+// to an appId, a groupKey within that app and to unread notifications. Empty appId and groupKey match all values.
+// Pinned notifications are left out, since the bulk operations skip them.
+func (t NotificationRepositoryPostgres) FindIds(ctx context.Context, tenantId string, userId string, appId string, groupKey string, unreadOnly bool) ([]string, error) {
+	where := newConditions("tenant_id = $1 AND user_id = $2 AND NOT pinned AND deleted_at IS NULL", tenantId, userId)
+	if appId = strings.Trim(strings.TrimSpace(appId), `"'`); appId != "" {
+		where.add("app_id = $%d", appId)
+	}
+	if groupKey = strings.Trim(strings.TrimSpace(groupKey), `"'`); groupKey != "" {
+		where.add("group_key = $%d", groupKey)
+	}
+	if unreadOnly {
+		where.add("read_status = FALSE")
+	}
+	return t.queryStrings(ctx, "FindIds", userId, "SELECT id FROM notifications WHERE "+where.String(), where.args...)
+}
+
+// RestoreDeleted restores the notifications of a given user soft-deleted at or after the given time.
+// It returns the number of notifications restored.
+func (t *NotificationRepositoryPostgres) RestoreDeleted(ctx context.Context, tenantId string, userId string, since time.Time) (int64, error) {
+	return t.exec(ctx, "RestoreDeleted", userId,
+		"UPDATE notifications SET deleted_at = NULL, updated_at = $4 WHERE tenant_id = $1 AND user_id = $2 AND deleted_at >= $3",
+		tenantId, userId, since, time.Now())
+}
+
+// PurgeDeleted permanently removes the notifications soft-deleted before the given time.
+// It returns the number of notifications removed.
+func (t *NotificationRepositoryPostgres) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return t.exec(ctx, "PurgeDeleted", "", "DELETE FROM notifications WHERE deleted_at < $1", before)
+}
+
+// DeleteExpired permanently removes the notifications of the app with the given read status created
+// before the given time, including soft-deleted notifications. It returns the number of notifications removed.
+func (t *NotificationRepositoryPostgres) DeleteExpired(ctx context.Context, appId string, readStatus bool, before time.Time) (int64, error) {
+	return t.exec(ctx, "DeleteExpired", "", "DELETE FROM notifications WHERE app_id = $1 AND read_status = $2 AND created_at < $3", appId, readStatus, before)
+}
+
+// Erase permanently deletes every notification of the given user, including soft-deleted notifications.
+func (t *NotificationRepositoryPostgres) Erase(ctx context.Context, tenantId string, userId string) (int64, error) {
+	return t.exec(ctx, "Erase", userId, "DELETE FROM notifications WHERE tenant_id = $1 AND user_id = $2", tenantId, userId)
+}
+
+// FindDueReminders finds at most limit unread notifications of any user whose reminder is due at the given
+// time and was not sent yet, oldest reminder first. Notifications that already expired are skipped.
+func (t NotificationRepositoryPostgres) FindDueReminders(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindDueReminders",
+		Message:   "Fetching notifications to remind at " + now.Format(time.RFC3339),
+	})
+	return t.query(ctx, "FindDueReminders", "",
+		"SELECT "+notificationColumns+` FROM notifications WHERE remind_at <= $1 AND reminded_at IS NULL AND read_status = FALSE
+		 AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > $1) ORDER BY remind_at LIMIT $2`,
+		now, limit)
+}
+
+// MarkReminded records that the reminder of the notification was sent at the given time. It returns 0 if the
+// reminder was already recorded, for example by another instance, so each reminder is sent once.
+func (t *NotificationRepositoryPostgres) MarkReminded(ctx context.Context, notificationId primitive.ObjectID, at time.Time) (int64, error) {
+	return t.exec(ctx, "MarkReminded", "", "UPDATE notifications SET reminded_at = $2 WHERE id = $1 AND reminded_at IS NULL", notificationId.Hex(), at)
+}
+
+// CreateIndexes is a no-op for Postgres. The indexes backing the notification queries and the
+// full-text search are created by the schema migrations.
+func (t *NotificationRepositoryPostgres) CreateIndexes() error {
+	return nil
+}
+
+// Export passes the notifications of a given user to yield one at a time, oldest first, including read
+// and soft-deleted notifications. The appId and createdAt range filters are applied when set. Rows are
+// scanned as they are read, so the notifications are never all held in memory.
+// An error returned by yield stops the export and is returned as is.
+func (t *NotificationRepositoryPostgres) Export(ctx context.Context, tenantId string, userId string, query data.NotificationExportQuery, yield func(models.Notification) error) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Export",
+		Message:   "Exporting notifications for userId: " + userId,
+		UserId:    userId,
+		AppId:     query.AppId,
+	})
+	where := newConditions("tenant_id = $1 AND user_id = $2", tenantId, userId)
+	if query.AppId != "" {
+		where.add("app_id = $%d", query.AppId)
+	}
+	if query.From != nil {
+		where.add("created_at >= $%d", *query.From)
+	}
+	if query.To != nil {
+		where.add("created_at <= $%d", *query.To)
+	}
+
+	rows, err := t.Db.Query(ctx, "SELECT "+notificationColumns+" FROM notifications WHERE "+where.String()+" ORDER BY created_at", where.args...)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Export",
+			Message:   "Failed to export notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return apperrors.FromDatabase(err, "notification not found")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Notification Repository",
+				Operation: "Export",
+				Message:   "Failed to decode notification for userId: " + userId,
+				Error:     err,
+				UserId:    userId,
+			})
+			return apperrors.FromDatabase(err, "notification not found")
+		}
+		if err := yield(notification); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Export",
+			Message:   "Failed to read notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return apperrors.FromDatabase(err, "notification not found")
+	}
+	return nil
+}
+
+// Search finds the notifications of a given user matching the search query.
+// The free-text query is matched against the message search vector and results are ordered by rank,
+// otherwise results are ordered by newest first. The appId, status, readStatus and createdAt range
+// filters are applied when set. It returns the requested page along with the total number of matches.
+func (t *NotificationRepositoryPostgres) Search(ctx context.Context, tenantId string, userId string, query data.NotificationSearchQuery) ([]models.Notification, int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Search",
+		Message:   "Searching notifications for userId: " + userId,
+		UserId:    userId,
+		AppId:     query.AppId,
+	})
+	where := newConditions("tenant_id = $1 AND user_id = $2 AND deleted_at IS NULL", tenantId, userId)
+	orderBy := "created_at DESC"
+	if query.Query != "" {
+		textArg := where.add("search @@ plainto_tsquery('english', $%d)", query.Query)
+		orderBy = fmt.Sprintf("ts_rank(search, plainto_tsquery('english', $%d)) DESC, created_at DESC", textArg)
+	}
+	if query.AppId != "" {
+		where.add("app_id = $%d", query.AppId)
+	}
+	if query.Status != "" {
+		where.add("status = $%d", query.Status)
+	}
+	if query.ReadStatus != nil {
+		where.add("read_status = $%d", *query.ReadStatus)
+	}
+	if query.Source != "" {
+		where.add("source->>'type' = $%d", query.Source)
+	}
+	if query.From != nil {
+		where.add("created_at >= $%d", *query.From)
+	}
+	if query.To != nil {
+		where.add("created_at <= $%d", *query.To)
+	}
+
+	var total int64
+	if err := t.Db.QueryRow(ctx, "SELECT COUNT(*) FROM notifications WHERE "+where.String(), where.args...).Scan(&total); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "Search",
+			Message:   "Failed to count notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, 0, apperrors.FromDatabase(err, "notification not found")
+	}
+
+	args := append(where.args, query.PageSize, (query.Page-1)*query.PageSize)
+	statement := fmt.Sprintf("SELECT %s FROM notifications WHERE %s ORDER BY %s LIMIT $%d OFFSET $%d",
+		notificationColumns, where.String(), orderBy, len(args)-1, len(args))
+	notifications, err := t.query(ctx, "Search", userId, statement, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "Search",
+		Message:   "Found " + fmt.Sprintf("%d", total) + " notifications for userId: " + userId,
+		UserId:    userId,
+	})
+	return notifications, total, nil
+}
+
+// CountByGroup counts the notifications of the given userId that are not deleted, grouped by appId,
+// groupKey, status, source type and read status. Notifications without a source are counted under an
+// empty source type.
+func (t NotificationRepositoryPostgres) CountByGroup(ctx context.Context, tenantId string, userId string) ([]models.NotificationCount, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "CountByGroup",
+		Message:   "Counting notifications for userId: " + userId,
+		UserId:    userId,
+	})
+	rows, err := t.Db.Query(ctx,
+		`SELECT app_id, group_key, status, COALESCE(source->>'type', '') AS source_type, read_status, COUNT(*), MIN(created_at) FROM notifications
+		 WHERE tenant_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		 GROUP BY app_id, group_key, status, source_type, read_status
+		 ORDER BY app_id, group_key, status`, tenantId, userId)
+	if err == nil {
+		var counts []models.NotificationCount
+		counts, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.NotificationCount, error) {
+			var count models.NotificationCount
+			err := row.Scan(&count.AppId, &count.GroupKey, &count.Status, &count.Source, &count.ReadStatus, &count.Count, &count.OldestAt)
+			return count, err
+		})
+		if err == nil {
+			return counts, nil
+		}
+	}
+	logger.Log.Error(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "CountByGroup",
+		Message:   "Failed to count notifications for userId: " + userId,
+		Error:     err,
+		UserId:    userId,
+	})
+	return nil, apperrors.FromDatabase(err, "notification not found")
+}
+
+// CountUnreadInGroup counts the unread notifications of the given group of the given user that are not
+// deleted, with the creation time of the oldest of them. The count is zero if the group has no unread
+// notification.
+func (t NotificationRepositoryPostgres) CountUnreadInGroup(ctx context.Context, tenantId string, userId string, appId string, groupKey string) (models.NotificationCount, error) {
+	count := models.NotificationCount{AppId: appId, GroupKey: groupKey}
+	var oldestAt *time.Time
+	err := t.Db.QueryRow(ctx,
+		`SELECT COUNT(*), MIN(created_at) FROM notifications
+		 WHERE tenant_id = $1 AND user_id = $2 AND app_id = $3 AND group_key = $4 AND NOT read_status AND deleted_at IS NULL`,
+		tenantId, userId, appId, groupKey).Scan(&count.Count, &oldestAt)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "CountUnreadInGroup",
+			Message:   "Failed to count unread notifications of group " + groupKey + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+			AppId:     appId,
+		})
+		return models.NotificationCount{}, apperrors.FromDatabase(err, "notification not found")
+	}
+	if oldestAt != nil {
+		count.OldestAt = *oldestAt
+	}
+	return count, nil
+}
+
+// CountReplies counts the follow-ups of the given root notifications of the given userId that are not deleted,
+// and how many of them are unread. Roots without follow-ups are left out.
+func (t NotificationRepositoryPostgres) CountReplies(ctx context.Context, tenantId string, userId string, rootIds []string) ([]models.ThreadCount, error) {
+	if len(rootIds) == 0 {
+		return []models.ThreadCount{}, nil
+	}
+	rows, err := t.Db.Query(ctx,
+		`SELECT parent_id, COUNT(*), COUNT(*) FILTER (WHERE NOT read_status) FROM notifications
+		 WHERE tenant_id = $1 AND user_id = $2 AND parent_id = ANY($3) AND deleted_at IS NULL
+		 GROUP BY parent_id`, tenantId, userId, rootIds)
+	if err == nil {
+		var counts []models.ThreadCount
+		counts, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ThreadCount, error) {
+			var count models.ThreadCount
+			err := row.Scan(&count.RootId, &count.Replies, &count.Unread)
+			return count, err
+		})
+		if err == nil {
+			return counts, nil
+		}
+	}
+	logger.Log.Error(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "CountReplies",
+		Message:   "Failed to count follow-ups for userId: " + userId,
+		Error:     err,
+		UserId:    userId,
+	})
+	return nil, apperrors.FromDatabase(err, "notification not found")
+}
+
+// FindChangedSince finds the notifications of the given userId created or changed at or after the given
+// time, including those deleted since, ordered by the time of the change.
+func (t NotificationRepositoryPostgres) FindChangedSince(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindChangedSince",
+		Message:   "Fetching notifications changed since " + since.Format(time.RFC3339) + " for userId: " + userId,
+		UserId:    userId,
+	})
+	return t.query(ctx, "FindChangedSince", userId,
+		"SELECT "+notificationColumns+" FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND updated_at >= $3 ORDER BY updated_at",
+		tenantId, userId, since)
+}
+
+// FindAfterSequence finds at most limit notifications of the given userId with a sequence number greater than
+// afterSequence, in the order of their sequence numbers. Deleted notifications are left out.
+func (t NotificationRepositoryPostgres) FindAfterSequence(ctx context.Context, tenantId string, userId string, afterSequence int64, limit int) ([]models.Notification, error) {
+	return t.query(ctx, "FindAfterSequence", userId,
+		"SELECT "+notificationColumns+" FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND sequence > $3 AND deleted_at IS NULL ORDER BY sequence LIMIT $4",
+		tenantId, userId, afterSequence, limit)
+}
+
+// FindLastSequence returns the highest sequence number of the stored notifications of the given userId, 0 if
+// none is numbered. Deleted notifications are left out.
+func (t NotificationRepositoryPostgres) FindLastSequence(ctx context.Context, tenantId string, userId string) (int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindLastSequence",
+		Message:   "Fetching last sequence number for userId: " + userId,
+		UserId:    userId,
+	})
+	var sequence int64
+	err := t.Db.QueryRow(ctx,
+		"SELECT COALESCE(MAX(sequence), 0) FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND deleted_at IS NULL",
+		tenantId, userId).Scan(&sequence)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "FindLastSequence",
+			Message:   "Failed to fetch last sequence number for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	return sequence, nil
+}
+
+// FindSince finds at most limit notifications of the given userId changed after the given position,
+// including those deleted since, ordered by the time of the change and then by ID. The position is the
+// updatedAt and ID of the last notification the client already has, since several notifications changed by
+// the same bulk action share their updatedAt; a zero afterId selects every notification changed at since.
+func (t NotificationRepositoryPostgres) FindSince(ctx context.Context, tenantId string, userId string, since time.Time, afterId primitive.ObjectID, limit int) ([]models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "FindSince",
+		Message:   "Fetching notifications changed since " + since.Format(time.RFC3339Nano) + " for userId: " + userId,
+		UserId:    userId,
+	})
+	return t.query(ctx, "FindSince", userId,
+		"SELECT "+notificationColumns+" FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND (updated_at > $3 OR (updated_at = $3 AND id > $4)) ORDER BY updated_at, id LIMIT $5",
+		tenantId, userId, since, afterId.Hex(), limit)
+}
+
+// SyncReadState merges read status changes made by a client, possibly while offline, with the stored read
+// state of the given user's notifications. The last write wins: a change is applied only if it was made after
+// the stored read state was last changed, or the notification was never read. Deleted notifications are skipped.
+// It returns the IDs of the notifications whose read state was changed and the current state of the
+// notifications targeted by the changes, in no particular order.
+func (t NotificationRepositoryPostgres) SyncReadState(ctx context.Context, tenantId string, userId string, changes []models.ReadStateChange) ([]string, []models.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "SyncReadState",
+		Message:   fmt.Sprintf("Syncing read state of %d notifications for userId: %s", len(changes), userId),
+		UserId:    userId,
+	})
+	ids := make([]string, 0, len(changes))
+	readStatuses := make([]bool, 0, len(changes))
+	readTimes := make([]time.Time, 0, len(changes))
+	for _, change := range changes {
+		ids = append(ids, change.Id.Hex())
+		readStatuses = append(readStatuses, change.ReadStatus)
+		readTimes = append(readTimes, change.ReadAt)
+	}
+	applied, err := t.queryStrings(ctx, "SyncReadState", userId,
+		`UPDATE notifications n SET read_status = c.read_status, read_at = c.read_at, updated_at = $3
+		 FROM unnest($4::text[], $5::boolean[], $6::timestamptz[]) AS c (id, read_status, read_at)
+		 WHERE n.tenant_id = $1 AND n.user_id = $2 AND n.id = c.id AND n.deleted_at IS NULL
+		   AND (n.read_at IS NULL OR n.read_at < c.read_at)
+		 RETURNING n.id`,
+		tenantId, userId, time.Now(), ids, readStatuses, readTimes)
+	if err != nil {
+		return nil, nil, err
+	}
+	notifications, err := t.query(ctx, "SyncReadState", userId,
+		"SELECT "+notificationColumns+" FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND id = ANY($3::text[]) AND deleted_at IS NULL",
+		tenantId, userId, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: "SyncReadState",
+		Message:   "Synced read state for userId: " + userId + " | Changes: " + fmt.Sprintf("%d", len(changes)) + " Applied: " + fmt.Sprintf("%d", len(applied)),
+		UserId:    userId,
+	})
+	if applied == nil {
+		applied = []string{}
+	}
+	return applied, notifications, nil
+}
+
+// SetPinned pins or unpins a notification of the given user and returns the number of notifications modified,
+// 0 if the notification already had the given pinned state.
+func (t *NotificationRepositoryPostgres) SetPinned(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, pinned bool) (int64, error) {
+	return t.exec(ctx, "SetPinned", userId,
+		"UPDATE notifications SET pinned = $4, updated_at = $5 WHERE tenant_id = $1 AND id = $2 AND user_id = $3 AND pinned <> $4 AND deleted_at IS NULL",
+		tenantId, notificationId.Hex(), userId, pinned, time.Now())
+}
+
+// CountPinned returns the number of notifications the given user has pinned.
+func (t NotificationRepositoryPostgres) CountPinned(ctx context.Context, tenantId string, userId string) (int64, error) {
+	var count int64
+	err := t.Db.QueryRow(ctx, "SELECT COUNT(*) FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND pinned AND deleted_at IS NULL", tenantId, userId).Scan(&count)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: "CountPinned",
+			Message:   "Failed to count pinned notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	return count, nil
+}
+
+// exec runs a statement modifying notifications and returns the number of rows affected.
+func (t *NotificationRepositoryPostgres) exec(ctx context.Context, operation string, userId string, statement string, args ...any) (int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: operation,
+		Message:   "Updating notifications for userId: " + userId,
+		UserId:    userId,
+	})
+	result, err := t.Db.Exec(ctx, statement, args...)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: operation,
+			Message:   "Failed to update notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, apperrors.FromDatabase(err, "notification not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: operation,
+		Message:   "Updated notifications for userId: " + userId + " | Affected: " + fmt.Sprintf("%d", result.RowsAffected()),
+		UserId:    userId,
+	})
+	return result.RowsAffected(), nil
+}
+
+// query runs a statement selecting notificationColumns and returns the scanned notifications.
+func (t NotificationRepositoryPostgres) query(ctx context.Context, operation string, userId string, statement string, args ...any) ([]models.Notification, error) {
+	rows, err := t.Db.Query(ctx, statement, args...)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: operation,
+			Message:   "Failed to fetch notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	notifications, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Notification, error) {
+		return scanNotification(row)
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Repository",
+			Operation: operation,
+			Message:   "Failed to decode notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, apperrors.FromDatabase(err, "notification not found")
+	}
+	return notifications, nil
+}
+
+// queryStrings runs a statement selecting a single text column and returns its values.
+func (t NotificationRepositoryPostgres) queryStrings(ctx context.Context, operation string, userId string, statement string, args ...any) ([]string, error) {
+	rows, err := t.Db.Query(ctx, statement, args...)
+	if err == nil {
+		var values []string
+		values, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err == nil {
+			return values, nil
+		}
+	}
+	logger.Log.Error(logger.LogPayload{
+		Component: "Notification Repository",
+		Operation: operation,
+		Message:   "Failed to fetch notifications for userId: " + userId,
+		Error:     err,
+		UserId:    userId,
+	})
+	return nil, apperrors.FromDatabase(err, "notification not found")
+}
+
+// scanNotification scans a row selected with notificationColumns into a notification model.
+func scanNotification(row pgx.Row) (models.Notification, error) {
+	var notification models.Notification
+	var id string
+	var actions, attachments, delivery, timings, uiHints, source []byte
+	if err := row.Scan(&id, &notification.TenantId, &notification.AppId, &notification.UserId, &notification.GroupKey, &notification.Message,
+		&notification.Status, &notification.ReadStatus, &notification.CreatedAt, &notification.UpdatedAt,
+		&notification.Origin, &notification.DeletedAt, &actions, &notification.ReadAt,
+		&notification.SenderId, &notification.SenderName, &notification.SenderAvatarUrl, &notification.CollapseKey, &attachments, &delivery, &timings,
+		&notification.Pinned, &uiHints, &source, &notification.ExpiresAt, &notification.RemindAt, &notification.RemindedAt, &notification.Truncated, &notification.ParentId,
+		&notification.Sequence); err != nil {
+		return models.Notification{}, err
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Notification{}, apperrors.Internal("invalid notification ID in database", err)
+	}
+	notification.Id = objID
+	if len(actions) > 0 {
+		if err := json.Unmarshal(actions, &notification.Actions); err != nil {
+			return models.Notification{}, apperrors.Internal("failed to decode notification actions", err)
+		}
+	}
+	if len(attachments) > 0 {
+		if err := json.Unmarshal(attachments, &notification.Attachments); err != nil {
+			return models.Notification{}, apperrors.Internal("failed to decode notification attachments", err)
+		}
+	}
+	if len(delivery) > 0 {
+		if err := json.Unmarshal(delivery, &notification.Delivery); err != nil {
+			return models.Notification{}, apperrors.Internal("failed to decode notification delivery", err)
+		}
+	}
+	if len(timings) > 0 {
+		if err := json.Unmarshal(timings, &notification.Timings); err != nil {
+			return models.Notification{}, apperrors.Internal("failed to decode notification timings", err)
+		}
+	}
+	if len(uiHints) > 0 {
+		if err := json.Unmarshal(uiHints, &notification.UIHints); err != nil {
+			return models.Notification{}, apperrors.Internal("failed to decode notification UI hints", err)
+		}
+	}
+	if len(source) > 0 {
+		if err := json.Unmarshal(source, &notification.Source); err != nil {
+			return models.Notification{}, apperrors.Internal("failed to decode notification source", err)
+		}
+	}
+	return notification, nil
+}
+
+// marshalActions encodes the notification actions as JSON, or nil when the notification has none.
+func marshalActions(actions []models.NotificationAction) ([]byte, error) {
+	if len(actions) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(actions)
+}
+
+// marshalAttachments encodes the notification attachments as JSON, or nil when the notification has none.
+func marshalAttachments(attachments []models.NotificationAttachment) ([]byte, error) {
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(attachments)
+}
+
+// marshalTimings encodes the notification timings as JSON, or nil when the notification has none.
+func marshalTimings(timings *models.NotificationTimings) ([]byte, error) {
+	if timings == nil {
+		return nil, nil
+	}
+	return json.Marshal(timings)
+}
+
+// marshalUIHints encodes the notification UI hints as JSON, or nil when the notification has none.
+func marshalUIHints(hints *models.NotificationUIHints) ([]byte, error) {
+	if hints == nil {
+		return nil, nil
+	}
+	return json.Marshal(hints)
+}
+
+// marshalSource encodes the notification source as JSON, or nil when the notification has none.
+func marshalSource(source *models.NotificationSource) ([]byte, error) {
+	if source == nil {
+		return nil, nil
+	}
+	return json.Marshal(source)
+}
+
+// conditions builds a WHERE clause with numbered placeholders.
+type conditions struct {
+	clauses []string
+	args    []any
+}
+
+// newConditions starts a WHERE clause with the given clause, whose placeholders refer to the given args.
+func newConditions(clause string, args ...any) *conditions {
+	return &conditions{clauses: []string{clause}, args: args}
+}
+
+// add appends a clause. If a value is given, the %d verb in the clause is replaced with the number of
+// its placeholder, which is returned.
+func (c *conditions) add(clause string, value ...any) int {
+	if len(value) == 0 {
+		c.clauses = append(c.clauses, clause)
+		return 0
+	}
+	c.args = append(c.args, value[0])
+	c.clauses = append(c.clauses, fmt.Sprintf(clause, len(c.args)))
+	return len(c.args)
+}
+
+func (c *conditions) String() string {
+	return strings.Join(c.clauses, " AND ")
+}
@@ -0,0 +1,279 @@
+package notificationRepository
+
+import (
+	"context"
+	"r2-notify-server/data"
+	"r2-notify-server/models"
+	"r2-notify-server/retry"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NotificationRepositoryRetry bounds the calls of a NotificationRepository with a query timeout and retries the idempotent
+// ones when they fail with a transient error. Creating a notification and changing its status are not idempotent and are
+// attempted once; exports stream their results and are neither bounded nor retried.
+type NotificationRepositoryRetry struct {
+	NotificationRepository
+	policy retry.Policy
+}
+
+// NewNotificationRepositoryRetry wraps the repository with the given retry policy.
+func NewNotificationRepositoryRetry(repository NotificationRepository, policy retry.Policy) NotificationRepository {
+	return &NotificationRepositoryRetry{NotificationRepository: repository, policy: policy}
+}
+
+// once returns the policy of operations that must not be retried, which keeps the query timeout.
+func (t *NotificationRepositoryRetry) once() retry.Policy {
+	policy := t.policy
+	policy.MaxAttempts = 1
+	return policy
+}
+
+func (t *NotificationRepositoryRetry) FindAll(ctx context.Context, tenantId string, userId string) ([]models.Notification, error) {
+	return retry.Call(ctx, "FindAll", t.policy, func(ctx context.Context) ([]models.Notification, error) {
+		return t.NotificationRepository.FindAll(ctx, tenantId, userId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) FindHistory(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error) {
+	return retry.Call(ctx, "FindHistory", t.policy, func(ctx context.Context) ([]models.Notification, error) {
+		return t.NotificationRepository.FindHistory(ctx, tenantId, userId, since)
+	})
+}
+
+func (t *NotificationRepositoryRetry) FindList(ctx context.Context, tenantId string, userId string, query data.NotificationListQuery) ([]models.Notification, error) {
+	return retry.Call(ctx, "FindList", t.policy, func(ctx context.Context) ([]models.Notification, error) {
+		return t.NotificationRepository.FindList(ctx, tenantId, userId, query)
+	})
+}
+
+func (t *NotificationRepositoryRetry) FindById(ctx context.Context, tenantId string, id primitive.ObjectID, userId string) (models.Notification, error) {
+	return retry.Call(ctx, "FindById", t.policy, func(ctx context.Context) (models.Notification, error) {
+		return t.NotificationRepository.FindById(ctx, tenantId, id, userId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) Create(ctx context.Context, notification models.Notification) (primitive.ObjectID, error) {
+	return retry.Call(ctx, "Create", t.once(), func(ctx context.Context) (primitive.ObjectID, error) {
+		return t.NotificationRepository.Create(ctx, notification)
+	})
+}
+
+func (t *NotificationRepositoryRetry) Collapse(ctx context.Context, notification models.Notification) (primitive.ObjectID, error) {
+	return retry.Call(ctx, "Collapse", t.policy, func(ctx context.Context) (primitive.ObjectID, error) {
+		return t.NotificationRepository.Collapse(ctx, notification)
+	})
+}
+
+func (t *NotificationRepositoryRetry) MarkAsRead(ctx context.Context, tenantId string, clientId string) (int64, error) {
+	return retry.Call(ctx, "MarkAsRead", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.MarkAsRead(ctx, tenantId, clientId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) MarkAppAsRead(ctx context.Context, tenantId string, clientId string, appId string) (int64, error) {
+	return retry.Call(ctx, "MarkAppAsRead", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.MarkAppAsRead(ctx, tenantId, clientId, appId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) MarkGroupAsRead(ctx context.Context, tenantId string, clientId string, appId string, groupKey string) (int64, error) {
+	return retry.Call(ctx, "MarkGroupAsRead", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.MarkGroupAsRead(ctx, tenantId, clientId, appId, groupKey)
+	})
+}
+
+func (t *NotificationRepositoryRetry) MarkGroupAsReadBefore(ctx context.Context, tenantId string, clientId string, appId string, groupKey string, before time.Time) ([]string, error) {
+	return retry.Call(ctx, "MarkGroupAsReadBefore", t.policy, func(ctx context.Context) ([]string, error) {
+		return t.NotificationRepository.MarkGroupAsReadBefore(ctx, tenantId, clientId, appId, groupKey, before)
+	})
+}
+
+func (t *NotificationRepositoryRetry) MarkThreadAsRead(ctx context.Context, tenantId string, userId string, rootId string) ([]string, error) {
+	return retry.Call(ctx, "MarkThreadAsRead", t.policy, func(ctx context.Context) ([]string, error) {
+		return t.NotificationRepository.MarkThreadAsRead(ctx, tenantId, userId, rootId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) MarkNotificationAsRead(ctx context.Context, tenantId string, clientId string, notificationId string) (int64, error) {
+	return retry.Call(ctx, "MarkNotificationAsRead", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.MarkNotificationAsRead(ctx, tenantId, clientId, notificationId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) UpdateStatus(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, from string, to string) (int64, error) {
+	return retry.Call(ctx, "UpdateStatus", t.once(), func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.UpdateStatus(ctx, tenantId, userId, notificationId, from, to)
+	})
+}
+
+func (t *NotificationRepositoryRetry) RecordDelivery(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, delivery models.NotificationDelivery, timings models.NotificationTimings) error {
+	return retry.Do(ctx, "RecordDelivery", t.policy, func(ctx context.Context) error {
+		return t.NotificationRepository.RecordDelivery(ctx, tenantId, userId, notificationId, delivery, timings)
+	})
+}
+
+func (t *NotificationRepositoryRetry) SetSequence(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, sequence int64) error {
+	return retry.Do(ctx, "SetSequence", t.policy, func(ctx context.Context) error {
+		return t.NotificationRepository.SetSequence(ctx, tenantId, userId, notificationId, sequence)
+	})
+}
+
+func (t *NotificationRepositoryRetry) Discard(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID) error {
+	return retry.Do(ctx, "Discard", t.policy, func(ctx context.Context) error {
+		return t.NotificationRepository.Discard(ctx, tenantId, userId, notificationId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) DeleteNotifications(ctx context.Context, tenantId string, clientId string) (int64, error) {
+	return retry.Call(ctx, "DeleteNotifications", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.DeleteNotifications(ctx, tenantId, clientId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) DeleteAppNotifications(ctx context.Context, tenantId string, clientId string, appId string) (int64, error) {
+	return retry.Call(ctx, "DeleteAppNotifications", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.DeleteAppNotifications(ctx, tenantId, clientId, appId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) DeleteGroupNotifications(ctx context.Context, tenantId string, clientId string, appId string, groupKey string) (int64, error) {
+	return retry.Call(ctx, "DeleteGroupNotifications", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.DeleteGroupNotifications(ctx, tenantId, clientId, appId, groupKey)
+	})
+}
+
+func (t *NotificationRepositoryRetry) DeleteNotification(ctx context.Context, tenantId string, clientId string, notificationId string) (int64, error) {
+	return retry.Call(ctx, "DeleteNotification", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.DeleteNotification(ctx, tenantId, clientId, notificationId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) FindAppIds(ctx context.Context, tenantId string, userId string) ([]string, error) {
+	return retry.Call(ctx, "FindAppIds", t.policy, func(ctx context.Context) ([]string, error) {
+		return t.NotificationRepository.FindAppIds(ctx, tenantId, userId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) FindIds(ctx context.Context, tenantId string, userId string, appId string, groupKey string, unreadOnly bool) ([]string, error) {
+	return retry.Call(ctx, "FindIds", t.policy, func(ctx context.Context) ([]string, error) {
+		return t.NotificationRepository.FindIds(ctx, tenantId, userId, appId, groupKey, unreadOnly)
+	})
+}
+
+func (t *NotificationRepositoryRetry) RestoreDeleted(ctx context.Context, tenantId string, userId string, since time.Time) (int64, error) {
+	return retry.Call(ctx, "RestoreDeleted", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.RestoreDeleted(ctx, tenantId, userId, since)
+	})
+}
+
+func (t *NotificationRepositoryRetry) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return retry.Call(ctx, "PurgeDeleted", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.PurgeDeleted(ctx, before)
+	})
+}
+
+func (t *NotificationRepositoryRetry) DeleteExpired(ctx context.Context, appId string, readStatus bool, before time.Time) (int64, error) {
+	return retry.Call(ctx, "DeleteExpired", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.DeleteExpired(ctx, appId, readStatus, before)
+	})
+}
+
+func (t *NotificationRepositoryRetry) Erase(ctx context.Context, tenantId string, userId string) (int64, error) {
+	return retry.Call(ctx, "Erase", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.Erase(ctx, tenantId, userId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) Export(ctx context.Context, tenantId string, userId string, query data.NotificationExportQuery, yield func(models.Notification) error) error {
+	return t.NotificationRepository.Export(ctx, tenantId, userId, query, yield)
+}
+
+func (t *NotificationRepositoryRetry) Search(ctx context.Context, tenantId string, userId string, query data.NotificationSearchQuery) ([]models.Notification, int64, error) {
+	var total int64
+	result, err := retry.Call(ctx, "Search", t.policy, func(ctx context.Context) ([]models.Notification, error) {
+		var result []models.Notification
+		var err error
+		result, total, err = t.NotificationRepository.Search(ctx, tenantId, userId, query)
+		return result, err
+	})
+	return result, total, err
+}
+
+func (t *NotificationRepositoryRetry) CountReplies(ctx context.Context, tenantId string, userId string, rootIds []string) ([]models.ThreadCount, error) {
+	return retry.Call(ctx, "CountReplies", t.policy, func(ctx context.Context) ([]models.ThreadCount, error) {
+		return t.NotificationRepository.CountReplies(ctx, tenantId, userId, rootIds)
+	})
+}
+
+func (t *NotificationRepositoryRetry) CountByGroup(ctx context.Context, tenantId string, userId string) ([]models.NotificationCount, error) {
+	return retry.Call(ctx, "CountByGroup", t.policy, func(ctx context.Context) ([]models.NotificationCount, error) {
+		return t.NotificationRepository.CountByGroup(ctx, tenantId, userId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) FindChangedSince(ctx context.Context, tenantId string, userId string, since time.Time) ([]models.Notification, error) {
+	return retry.Call(ctx, "FindChangedSince", t.policy, func(ctx context.Context) ([]models.Notification, error) {
+		return t.NotificationRepository.FindChangedSince(ctx, tenantId, userId, since)
+	})
+}
+
+func (t *NotificationRepositoryRetry) FindAfterSequence(ctx context.Context, tenantId string, userId string, afterSequence int64, limit int) ([]models.Notification, error) {
+	return retry.Call(ctx, "FindAfterSequence", t.policy, func(ctx context.Context) ([]models.Notification, error) {
+		return t.NotificationRepository.FindAfterSequence(ctx, tenantId, userId, afterSequence, limit)
+	})
+}
+
+func (t *NotificationRepositoryRetry) FindLastSequence(ctx context.Context, tenantId string, userId string) (int64, error) {
+	return retry.Call(ctx, "FindLastSequence", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.FindLastSequence(ctx, tenantId, userId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) FindSince(ctx context.Context, tenantId string, userId string, since time.Time, afterId primitive.ObjectID, limit int) ([]models.Notification, error) {
+	return retry.Call(ctx, "FindSince", t.policy, func(ctx context.Context) ([]models.Notification, error) {
+		return t.NotificationRepository.FindSince(ctx, tenantId, userId, since, afterId, limit)
+	})
+}
+
+func (t *NotificationRepositoryRetry) SyncReadState(ctx context.Context, tenantId string, userId string, changes []models.ReadStateChange) ([]string, []models.Notification, error) {
+	var applied []string
+	notifications, err := retry.Call(ctx, "SyncReadState", t.policy, func(ctx context.Context) ([]models.Notification, error) {
+		var notifications []models.Notification
+		var err error
+		applied, notifications, err = t.NotificationRepository.SyncReadState(ctx, tenantId, userId, changes)
+		return notifications, err
+	})
+	return applied, notifications, err
+}
+
+func (t *NotificationRepositoryRetry) SetPinned(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, pinned bool) (int64, error) {
+	return retry.Call(ctx, "SetPinned", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.SetPinned(ctx, tenantId, userId, notificationId, pinned)
+	})
+}
+
+func (t *NotificationRepositoryRetry) CountPinned(ctx context.Context, tenantId string, userId string) (int64, error) {
+	return retry.Call(ctx, "CountPinned", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.CountPinned(ctx, tenantId, userId)
+	})
+}
+
+func (t *NotificationRepositoryRetry) CountUnreadInGroup(ctx context.Context, tenantId string, userId string, appId string, groupKey string) (models.NotificationCount, error) {
+	return retry.Call(ctx, "CountUnreadInGroup", t.policy, func(ctx context.Context) (models.NotificationCount, error) {
+		return t.NotificationRepository.CountUnreadInGroup(ctx, tenantId, userId, appId, groupKey)
+	})
+}
+
+func (t *NotificationRepositoryRetry) FindDueReminders(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	return retry.Call(ctx, "FindDueReminders", t.policy, func(ctx context.Context) ([]models.Notification, error) {
+		return t.NotificationRepository.FindDueReminders(ctx, now, limit)
+	})
+}
+
+func (t *NotificationRepositoryRetry) MarkReminded(ctx context.Context, notificationId primitive.ObjectID, at time.Time) (int64, error) {
+	return retry.Call(ctx, "MarkReminded", t.policy, func(ctx context.Context) (int64, error) {
+		return t.NotificationRepository.MarkReminded(ctx, notificationId, at)
+	})
+}
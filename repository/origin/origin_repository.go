@@ -0,0 +1,13 @@
+package originRepository
+
+import (
+	"r2-notify-server/models"
+)
+
+type OriginRepository interface {
+	FindAll() ([]models.AppOrigins, error)
+	FindByAppId(appId string) (models.AppOrigins, error)
+	Upsert(appOrigins models.AppOrigins) error
+	Delete(appId string) error
+	CreateIndexes() error
+}
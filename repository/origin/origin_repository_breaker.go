@@ -0,0 +1,34 @@
+package originRepository
+
+import (
+	"r2-notify-server/breaker"
+	"r2-notify-server/models"
+)
+
+// OriginRepositoryBreaker guards the calls of a OriginRepository with a circuit breaker, so they fail fast
+// while the database is unavailable.
+type OriginRepositoryBreaker struct {
+	OriginRepository
+	breaker *breaker.Breaker
+}
+
+// NewOriginRepositoryBreaker wraps the repository with the given circuit breaker.
+func NewOriginRepositoryBreaker(repository OriginRepository, circuitBreaker *breaker.Breaker) OriginRepository {
+	return &OriginRepositoryBreaker{OriginRepository: repository, breaker: circuitBreaker}
+}
+
+func (t *OriginRepositoryBreaker) FindAll() ([]models.AppOrigins, error) {
+	return breaker.Call(t.breaker, func() ([]models.AppOrigins, error) { return t.OriginRepository.FindAll() })
+}
+
+func (t *OriginRepositoryBreaker) FindByAppId(appId string) (models.AppOrigins, error) {
+	return breaker.Call(t.breaker, func() (models.AppOrigins, error) { return t.OriginRepository.FindByAppId(appId) })
+}
+
+func (t *OriginRepositoryBreaker) Upsert(appOrigins models.AppOrigins) error {
+	return t.breaker.Execute(func() error { return t.OriginRepository.Upsert(appOrigins) })
+}
+
+func (t *OriginRepositoryBreaker) Delete(appId string) error {
+	return t.breaker.Execute(func() error { return t.OriginRepository.Delete(appId) })
+}
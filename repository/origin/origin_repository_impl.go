@@ -0,0 +1,164 @@
+package originRepository
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OriginRepositoryImpl struct {
+	Db *mongo.Database
+}
+
+// NewOriginRepositoryImpl creates a new instance of OriginRepositoryImpl
+// with the given mongo Db instance.
+func NewOriginRepositoryImpl(Db *mongo.Database) OriginRepository {
+	return &OriginRepositoryImpl{Db: Db}
+}
+
+// FindAll retrieves the origin allow-lists of every app, ordered by appId.
+func (t OriginRepositoryImpl) FindAll() ([]models.AppOrigins, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Origin Repository",
+		Operation: "FindAll",
+		Message:   "Fetching origin allow-lists",
+	})
+	opts := options.Find().SetSort(bson.D{{Key: "appId", Value: 1}})
+	cursor, err := t.Db.Collection("app_origins").Find(context.Background(), bson.M{}, opts)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Origin Repository",
+			Operation: "FindAll",
+			Message:   "Failed to fetch origin allow-lists",
+			Error:     err,
+		})
+		return nil, apperrors.FromDatabase(err, "origin allow-list not found")
+	}
+	defer cursor.Close(context.Background())
+
+	appOrigins := []models.AppOrigins{}
+	if err := cursor.All(context.Background(), &appOrigins); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Origin Repository",
+			Operation: "FindAll",
+			Message:   "Failed to decode origin allow-lists",
+			Error:     err,
+		})
+		return nil, apperrors.FromDatabase(err, "origin allow-list not found")
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Origin Repository",
+		Operation: "FindAll",
+		Message:   fmt.Sprintf("Found %d origin allow-lists", len(appOrigins)),
+	})
+	return appOrigins, nil
+}
+
+// FindByAppId retrieves the origin allow-list of the given appId.
+// It returns a not found error if the app has no allow-list.
+func (t OriginRepositoryImpl) FindByAppId(appId string) (appOrigins models.AppOrigins, err error) {
+	if err := t.Db.Collection("app_origins").FindOne(context.Background(), bson.M{"appId": appId}).Decode(&appOrigins); err != nil {
+		if err != mongo.ErrNoDocuments {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Origin Repository",
+				Operation: "FindByAppId",
+				Message:   "Failed to fetch origin allow-list for appId: " + appId,
+				Error:     err,
+				AppId:     appId,
+			})
+		}
+		return models.AppOrigins{}, apperrors.FromDatabase(err, "origin allow-list not found")
+	}
+	return appOrigins, nil
+}
+
+// Upsert replaces the origin allow-list of the app, creating it if the app has none.
+func (t *OriginRepositoryImpl) Upsert(appOrigins models.AppOrigins) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Origin Repository",
+		Operation: "Upsert",
+		Message:   "Saving origin allow-list for appId: " + appOrigins.AppId,
+		AppId:     appOrigins.AppId,
+	})
+	update := bson.M{"$set": bson.M{"origins": appOrigins.Origins, "updatedAt": appOrigins.UpdatedAt}}
+	_, err := t.Db.Collection("app_origins").UpdateOne(context.Background(), bson.M{"appId": appOrigins.AppId}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Origin Repository",
+			Operation: "Upsert",
+			Message:   "Failed to save origin allow-list for appId: " + appOrigins.AppId,
+			Error:     err,
+			AppId:     appOrigins.AppId,
+		})
+		return apperrors.FromDatabase(err, "origin allow-list not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Origin Repository",
+		Operation: "Upsert",
+		Message:   fmt.Sprintf("Saved %d allowed origins for appId: %s", len(appOrigins.Origins), appOrigins.AppId),
+		AppId:     appOrigins.AppId,
+	})
+	return nil
+}
+
+// Delete removes the origin allow-list of the given appId.
+// It returns a not found error if the app has no allow-list.
+func (t *OriginRepositoryImpl) Delete(appId string) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Origin Repository",
+		Operation: "Delete",
+		Message:   "Deleting origin allow-list for appId: " + appId,
+		AppId:     appId,
+	})
+	result, err := t.Db.Collection("app_origins").DeleteOne(context.Background(), bson.M{"appId": appId})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Origin Repository",
+			Operation: "Delete",
+			Message:   "Failed to delete origin allow-list for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return apperrors.FromDatabase(err, "origin allow-list not found")
+	}
+	if result.DeletedCount == 0 {
+		return apperrors.NotFound("origin allow-list not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Origin Repository",
+		Operation: "Delete",
+		Message:   "Successfully deleted origin allow-list for appId: " + appId,
+		AppId:     appId,
+	})
+	return nil
+}
+
+// CreateIndexes creates the unique index on the appId, so each app has a single allow-list.
+// Creating an index that already exists is a no-op, so it is safe to call on every startup.
+func (t *OriginRepositoryImpl) CreateIndexes() error {
+	_, err := t.Db.Collection("app_origins").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "appId", Value: 1}},
+		Options: options.Index().SetName("appId").SetUnique(true),
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Origin Repository",
+			Operation: "CreateIndexes",
+			Message:   "Failed to create origin allow-list indexes",
+			Error:     err,
+		})
+		return apperrors.FromDatabase(err, "origin allow-list not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Origin Repository",
+		Operation: "CreateIndexes",
+		Message:   "Successfully created origin allow-list indexes",
+	})
+	return nil
+}
@@ -0,0 +1,16 @@
+package policyRepository
+
+import (
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PolicyRepository interface {
+	FindAll(appId string) ([]models.DeliveryPolicy, error)
+	FindById(id primitive.ObjectID, appId string) (models.DeliveryPolicy, error)
+	Create(policy models.DeliveryPolicy) (primitive.ObjectID, error)
+	Update(policy models.DeliveryPolicy) error
+	Delete(id primitive.ObjectID, appId string) error
+	CreateIndexes() error
+}
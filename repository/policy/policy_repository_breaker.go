@@ -0,0 +1,40 @@
+package policyRepository
+
+import (
+	"r2-notify-server/breaker"
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PolicyRepositoryBreaker guards the calls of a PolicyRepository with a circuit breaker, so they fail fast
+// while the database is unavailable.
+type PolicyRepositoryBreaker struct {
+	PolicyRepository
+	breaker *breaker.Breaker
+}
+
+// NewPolicyRepositoryBreaker wraps the repository with the given circuit breaker.
+func NewPolicyRepositoryBreaker(repository PolicyRepository, circuitBreaker *breaker.Breaker) PolicyRepository {
+	return &PolicyRepositoryBreaker{PolicyRepository: repository, breaker: circuitBreaker}
+}
+
+func (t *PolicyRepositoryBreaker) FindAll(appId string) ([]models.DeliveryPolicy, error) {
+	return breaker.Call(t.breaker, func() ([]models.DeliveryPolicy, error) { return t.PolicyRepository.FindAll(appId) })
+}
+
+func (t *PolicyRepositoryBreaker) FindById(id primitive.ObjectID, appId string) (models.DeliveryPolicy, error) {
+	return breaker.Call(t.breaker, func() (models.DeliveryPolicy, error) { return t.PolicyRepository.FindById(id, appId) })
+}
+
+func (t *PolicyRepositoryBreaker) Create(policy models.DeliveryPolicy) (primitive.ObjectID, error) {
+	return breaker.Call(t.breaker, func() (primitive.ObjectID, error) { return t.PolicyRepository.Create(policy) })
+}
+
+func (t *PolicyRepositoryBreaker) Update(policy models.DeliveryPolicy) error {
+	return t.breaker.Execute(func() error { return t.PolicyRepository.Update(policy) })
+}
+
+func (t *PolicyRepositoryBreaker) Delete(id primitive.ObjectID, appId string) error {
+	return t.breaker.Execute(func() error { return t.PolicyRepository.Delete(id, appId) })
+}
@@ -0,0 +1,218 @@
+package policyRepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PolicyRepositoryImpl struct {
+	Db *mongo.Database
+}
+
+// NewPolicyRepositoryImpl creates a new instance of PolicyRepositoryImpl
+// with the given mongo Db instance.
+func NewPolicyRepositoryImpl(Db *mongo.Database) PolicyRepository {
+	return &PolicyRepositoryImpl{Db: Db}
+}
+
+// FindAll retrieves the delivery policies of the given appId from the "delivery_policies" collection, in
+// the order they are evaluated: by ascending order, then by creation time.
+// It returns an empty slice if the app has no policies.
+func (t PolicyRepositoryImpl) FindAll(appId string) ([]models.DeliveryPolicy, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Policy Repository",
+		Operation: "FindAll",
+		Message:   "Fetching delivery policies for appId: " + appId,
+		AppId:     appId,
+	})
+	opts := options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "createdAt", Value: 1}})
+	cursor, err := t.Db.Collection("delivery_policies").Find(context.Background(), bson.M{"appId": appId}, opts)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Policy Repository",
+			Operation: "FindAll",
+			Message:   "Failed to fetch delivery policies for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return nil, apperrors.FromDatabase(err, "delivery policy not found")
+	}
+	defer cursor.Close(context.Background())
+
+	policies := []models.DeliveryPolicy{}
+	if err := cursor.All(context.Background(), &policies); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Policy Repository",
+			Operation: "FindAll",
+			Message:   "Failed to decode delivery policies for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return nil, apperrors.FromDatabase(err, "delivery policy not found")
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Policy Repository",
+		Operation: "FindAll",
+		Message:   fmt.Sprintf("Found %d delivery policies for appId: %s", len(policies), appId),
+		AppId:     appId,
+	})
+	return policies, nil
+}
+
+// FindById retrieves the delivery policy with the given ID belonging to the given appId.
+// It returns a not found error if no such policy exists.
+func (t PolicyRepositoryImpl) FindById(id primitive.ObjectID, appId string) (models.DeliveryPolicy, error) {
+	var policy models.DeliveryPolicy
+	err := t.Db.Collection("delivery_policies").FindOne(context.Background(), bson.M{"_id": id, "appId": appId}).Decode(&policy)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Policy Repository",
+				Operation: "FindById",
+				Message:   "Failed to fetch delivery policy " + id.Hex() + " for appId: " + appId,
+				Error:     err,
+				AppId:     appId,
+			})
+		}
+		return models.DeliveryPolicy{}, apperrors.FromDatabase(err, "delivery policy not found")
+	}
+	return policy, nil
+}
+
+// Create inserts a new delivery policy and returns its ObjectID.
+func (t *PolicyRepositoryImpl) Create(policy models.DeliveryPolicy) (primitive.ObjectID, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Policy Repository",
+		Operation: "Create",
+		Message:   "Creating delivery policy " + policy.Name + " for appId: " + policy.AppId,
+		AppId:     policy.AppId,
+	})
+	result, err := t.Db.Collection("delivery_policies").InsertOne(context.Background(), policy)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Policy Repository",
+			Operation: "Create",
+			Message:   "Failed to create delivery policy for appId: " + policy.AppId,
+			Error:     err,
+			AppId:     policy.AppId,
+		})
+		return primitive.NilObjectID, apperrors.FromDatabase(err, "delivery policy not found")
+	}
+	id, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return primitive.NilObjectID, apperrors.Internal("failed to convert inserted ID to ObjectID", nil)
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Policy Repository",
+		Operation: "Create",
+		Message:   "Successfully created delivery policy " + id.Hex() + " for appId: " + policy.AppId,
+		AppId:     policy.AppId,
+	})
+	return id, nil
+}
+
+// Update replaces the name, order, enabled flag, conditions, action and target of the delivery policy
+// identified by the policy's Id and AppId. It returns a not found error if no such policy exists.
+func (t *PolicyRepositoryImpl) Update(policy models.DeliveryPolicy) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Policy Repository",
+		Operation: "Update",
+		Message:   "Updating delivery policy " + policy.Id.Hex() + " for appId: " + policy.AppId,
+		AppId:     policy.AppId,
+	})
+	update := bson.M{"$set": bson.M{
+		"name":       policy.Name,
+		"order":      policy.Order,
+		"enabled":    policy.Enabled,
+		"conditions": policy.Conditions,
+		"action":     policy.Action,
+		"target":     policy.Target,
+		"updatedAt":  policy.UpdatedAt,
+	}}
+	result, err := t.Db.Collection("delivery_policies").UpdateOne(context.Background(), bson.M{"_id": policy.Id, "appId": policy.AppId}, update)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Policy Repository",
+			Operation: "Update",
+			Message:   "Failed to update delivery policy " + policy.Id.Hex() + " for appId: " + policy.AppId,
+			Error:     err,
+			AppId:     policy.AppId,
+		})
+		return apperrors.FromDatabase(err, "delivery policy not found")
+	}
+	if result.MatchedCount == 0 {
+		return apperrors.NotFound("delivery policy not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Policy Repository",
+		Operation: "Update",
+		Message:   "Successfully updated delivery policy " + policy.Id.Hex() + " for appId: " + policy.AppId,
+		AppId:     policy.AppId,
+	})
+	return nil
+}
+
+// Delete deletes the delivery policy with the given ID belonging to the given appId.
+// It returns a not found error if no such policy exists.
+func (t *PolicyRepositoryImpl) Delete(id primitive.ObjectID, appId string) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Policy Repository",
+		Operation: "Delete",
+		Message:   "Deleting delivery policy " + id.Hex() + " for appId: " + appId,
+		AppId:     appId,
+	})
+	result, err := t.Db.Collection("delivery_policies").DeleteOne(context.Background(), bson.M{"_id": id, "appId": appId})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Policy Repository",
+			Operation: "Delete",
+			Message:   "Failed to delete delivery policy " + id.Hex() + " for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return apperrors.FromDatabase(err, "delivery policy not found")
+	}
+	if result.DeletedCount == 0 {
+		return apperrors.NotFound("delivery policy not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Policy Repository",
+		Operation: "Delete",
+		Message:   "Successfully deleted delivery policy " + id.Hex() + " for appId: " + appId,
+		AppId:     appId,
+	})
+	return nil
+}
+
+// CreateIndexes creates the index the policies of an app are read with, in evaluation order.
+// Creating an index that already exists is a no-op, so it is safe to call on every startup.
+func (t *PolicyRepositoryImpl) CreateIndexes() error {
+	_, err := t.Db.Collection("delivery_policies").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "appId", Value: 1}, {Key: "order", Value: 1}, {Key: "createdAt", Value: 1}},
+		Options: options.Index().SetName("appId_order_createdAt"),
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Policy Repository",
+			Operation: "CreateIndexes",
+			Message:   "Failed to create delivery policy indexes",
+			Error:     err,
+		})
+		return apperrors.FromDatabase(err, "delivery policy not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Policy Repository",
+		Operation: "CreateIndexes",
+		Message:   "Successfully created delivery policy indexes",
+	})
+	return nil
+}
@@ -0,0 +1,13 @@
+package retentionRepository
+
+import (
+	"r2-notify-server/models"
+)
+
+type RetentionRepository interface {
+	FindAll() ([]models.AppRetention, error)
+	FindByAppId(appId string) (models.AppRetention, error)
+	Upsert(appRetention models.AppRetention) error
+	Delete(appId string) error
+	CreateIndexes() error
+}
@@ -0,0 +1,34 @@
+package retentionRepository
+
+import (
+	"r2-notify-server/breaker"
+	"r2-notify-server/models"
+)
+
+// RetentionRepositoryBreaker guards the calls of a RetentionRepository with a circuit breaker, so they fail
+// fast while the database is unavailable.
+type RetentionRepositoryBreaker struct {
+	RetentionRepository
+	breaker *breaker.Breaker
+}
+
+// NewRetentionRepositoryBreaker wraps the repository with the given circuit breaker.
+func NewRetentionRepositoryBreaker(repository RetentionRepository, circuitBreaker *breaker.Breaker) RetentionRepository {
+	return &RetentionRepositoryBreaker{RetentionRepository: repository, breaker: circuitBreaker}
+}
+
+func (t *RetentionRepositoryBreaker) FindAll() ([]models.AppRetention, error) {
+	return breaker.Call(t.breaker, func() ([]models.AppRetention, error) { return t.RetentionRepository.FindAll() })
+}
+
+func (t *RetentionRepositoryBreaker) FindByAppId(appId string) (models.AppRetention, error) {
+	return breaker.Call(t.breaker, func() (models.AppRetention, error) { return t.RetentionRepository.FindByAppId(appId) })
+}
+
+func (t *RetentionRepositoryBreaker) Upsert(appRetention models.AppRetention) error {
+	return t.breaker.Execute(func() error { return t.RetentionRepository.Upsert(appRetention) })
+}
+
+func (t *RetentionRepositoryBreaker) Delete(appId string) error {
+	return t.breaker.Execute(func() error { return t.RetentionRepository.Delete(appId) })
+}
@@ -0,0 +1,164 @@
+package retentionRepository
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RetentionRepositoryImpl struct {
+	Db *mongo.Database
+}
+
+// NewRetentionRepositoryImpl creates a new instance of RetentionRepositoryImpl
+// with the given mongo Db instance.
+func NewRetentionRepositoryImpl(Db *mongo.Database) RetentionRepository {
+	return &RetentionRepositoryImpl{Db: Db}
+}
+
+// FindAll retrieves the retention policies of every app, ordered by appId.
+func (t RetentionRepositoryImpl) FindAll() ([]models.AppRetention, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Retention Repository",
+		Operation: "FindAll",
+		Message:   "Fetching retention policies",
+	})
+	opts := options.Find().SetSort(bson.D{{Key: "appId", Value: 1}})
+	cursor, err := t.Db.Collection("app_retention").Find(context.Background(), bson.M{}, opts)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Retention Repository",
+			Operation: "FindAll",
+			Message:   "Failed to fetch retention policies",
+			Error:     err,
+		})
+		return nil, apperrors.FromDatabase(err, "retention policy not found")
+	}
+	defer cursor.Close(context.Background())
+
+	appRetention := []models.AppRetention{}
+	if err := cursor.All(context.Background(), &appRetention); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Retention Repository",
+			Operation: "FindAll",
+			Message:   "Failed to decode retention policies",
+			Error:     err,
+		})
+		return nil, apperrors.FromDatabase(err, "retention policy not found")
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Retention Repository",
+		Operation: "FindAll",
+		Message:   fmt.Sprintf("Found %d retention policies", len(appRetention)),
+	})
+	return appRetention, nil
+}
+
+// FindByAppId retrieves the retention policy of the given appId.
+// It returns a not found error if the app has no retention policy.
+func (t RetentionRepositoryImpl) FindByAppId(appId string) (appRetention models.AppRetention, err error) {
+	if err := t.Db.Collection("app_retention").FindOne(context.Background(), bson.M{"appId": appId}).Decode(&appRetention); err != nil {
+		if err != mongo.ErrNoDocuments {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Retention Repository",
+				Operation: "FindByAppId",
+				Message:   "Failed to fetch retention policy for appId: " + appId,
+				Error:     err,
+				AppId:     appId,
+			})
+		}
+		return models.AppRetention{}, apperrors.FromDatabase(err, "retention policy not found")
+	}
+	return appRetention, nil
+}
+
+// Upsert replaces the retention policy of the app, creating it if the app has none.
+func (t *RetentionRepositoryImpl) Upsert(appRetention models.AppRetention) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Retention Repository",
+		Operation: "Upsert",
+		Message:   "Saving retention policy for appId: " + appRetention.AppId,
+		AppId:     appRetention.AppId,
+	})
+	update := bson.M{"$set": bson.M{"readDays": appRetention.ReadDays, "unreadDays": appRetention.UnreadDays, "updatedAt": appRetention.UpdatedAt}}
+	_, err := t.Db.Collection("app_retention").UpdateOne(context.Background(), bson.M{"appId": appRetention.AppId}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Retention Repository",
+			Operation: "Upsert",
+			Message:   "Failed to save retention policy for appId: " + appRetention.AppId,
+			Error:     err,
+			AppId:     appRetention.AppId,
+		})
+		return apperrors.FromDatabase(err, "retention policy not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Retention Repository",
+		Operation: "Upsert",
+		Message:   fmt.Sprintf("Saved retention policy for appId: %s, read: %d days, unread: %d days", appRetention.AppId, appRetention.ReadDays, appRetention.UnreadDays),
+		AppId:     appRetention.AppId,
+	})
+	return nil
+}
+
+// Delete removes the retention policy of the given appId.
+// It returns a not found error if the app has no retention policy.
+func (t *RetentionRepositoryImpl) Delete(appId string) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Retention Repository",
+		Operation: "Delete",
+		Message:   "Deleting retention policy for appId: " + appId,
+		AppId:     appId,
+	})
+	result, err := t.Db.Collection("app_retention").DeleteOne(context.Background(), bson.M{"appId": appId})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Retention Repository",
+			Operation: "Delete",
+			Message:   "Failed to delete retention policy for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return apperrors.FromDatabase(err, "retention policy not found")
+	}
+	if result.DeletedCount == 0 {
+		return apperrors.NotFound("retention policy not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Retention Repository",
+		Operation: "Delete",
+		Message:   "Successfully deleted retention policy for appId: " + appId,
+		AppId:     appId,
+	})
+	return nil
+}
+
+// CreateIndexes creates the unique index on the appId, so each app has a single retention policy.
+// Creating an index that already exists is a no-op, so it is safe to call on every startup.
+func (t *RetentionRepositoryImpl) CreateIndexes() error {
+	_, err := t.Db.Collection("app_retention").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "appId", Value: 1}},
+		Options: options.Index().SetName("appId").SetUnique(true),
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Retention Repository",
+			Operation: "CreateIndexes",
+			Message:   "Failed to create retention policy indexes",
+			Error:     err,
+		})
+		return apperrors.FromDatabase(err, "retention policy not found")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Retention Repository",
+		Operation: "CreateIndexes",
+		Message:   "Successfully created retention policy indexes",
+	})
+	return nil
+}
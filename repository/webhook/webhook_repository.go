@@ -0,0 +1,18 @@
+package webhookRepository
+
+import (
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebhookRepository interface {
+	FindAll(appId string) ([]models.Webhook, error)
+	FindById(id primitive.ObjectID, appId string) (models.Webhook, error)
+	FindByEvent(appId string, event string) ([]models.Webhook, error)
+	Create(webhook models.Webhook) (primitive.ObjectID, error)
+	Update(webhook models.Webhook) error
+	Delete(id primitive.ObjectID, appId string) error
+	LogDelivery(delivery models.WebhookDelivery) error
+	FindDeliveries(webhookId primitive.ObjectID, limit int64) ([]models.WebhookDelivery, error)
+}
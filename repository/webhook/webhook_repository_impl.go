@@ -0,0 +1,282 @@
+package webhookRepository
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookRepositoryImpl struct {
+	Db *mongo.Database
+}
+
+// NewWebhookRepositoryImpl creates a new instance of WebhookRepositoryImpl
+// with the given mongo Db instance.
+func NewWebhookRepositoryImpl(Db *mongo.Database) WebhookRepository {
+	return &WebhookRepositoryImpl{Db: Db}
+}
+
+// FindAll retrieves all webhooks registered for the given appId from the "webhooks" collection.
+// It returns an empty slice if the app has no webhooks, or an error if the query fails.
+func (t WebhookRepositoryImpl) FindAll(appId string) ([]models.Webhook, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: "FindAll",
+		Message:   "Fetching webhooks for appId: " + appId,
+		AppId:     appId,
+	})
+	return t.find("FindAll", appId, bson.M{"appId": appId})
+}
+
+// FindById retrieves the webhook with the given ID belonging to the given appId.
+// It returns a NotFound error if no such webhook exists.
+func (t WebhookRepositoryImpl) FindById(id primitive.ObjectID, appId string) (models.Webhook, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: "FindById",
+		Message:   "Fetching webhook " + id.Hex() + " for appId: " + appId,
+		AppId:     appId,
+	})
+	var webhook models.Webhook
+	err := t.Db.Collection("webhooks").FindOne(context.Background(), bson.M{"_id": id, "appId": appId}).Decode(&webhook)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: "FindById",
+			Message:   "Failed to fetch webhook " + id.Hex() + " for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return models.Webhook{}, apperrors.FromDatabase(err, "webhook not found")
+	}
+	return webhook, nil
+}
+
+// FindByEvent retrieves the enabled webhooks of the given appId subscribed to the given event.
+func (t WebhookRepositoryImpl) FindByEvent(appId string, event string) ([]models.Webhook, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: "FindByEvent",
+		Message:   "Fetching webhooks for appId: " + appId + ", event: " + event,
+		AppId:     appId,
+	})
+	return t.find("FindByEvent", appId, bson.M{"appId": appId, "events": event, "enabled": true})
+}
+
+// Create inserts a new webhook document into the "webhooks" collection and returns its ObjectID.
+func (t *WebhookRepositoryImpl) Create(webhook models.Webhook) (primitive.ObjectID, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: "Create",
+		Message:   "Creating webhook for appId: " + webhook.AppId,
+		AppId:     webhook.AppId,
+	})
+	result, err := t.Db.Collection("webhooks").InsertOne(context.Background(), webhook)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: "Create",
+			Message:   "Failed to create webhook for appId: " + webhook.AppId,
+			Error:     err,
+			AppId:     webhook.AppId,
+		})
+		return primitive.NilObjectID, apperrors.FromDatabase(err, "webhook not found")
+	}
+	id, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		convertErr := apperrors.Internal("failed to convert inserted ID to ObjectID", nil)
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: "Create",
+			Message:   "Failed to convert inserted ID for appId: " + webhook.AppId,
+			Error:     convertErr,
+			AppId:     webhook.AppId,
+		})
+		return primitive.NilObjectID, convertErr
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: "Create",
+		Message:   "Successfully created webhook " + id.Hex() + " for appId: " + webhook.AppId,
+		AppId:     webhook.AppId,
+	})
+	return id, nil
+}
+
+// Update updates the url, events and enabled flag of the webhook identified by the webhook's Id and AppId.
+// It returns a NotFound error if no such webhook exists.
+func (t *WebhookRepositoryImpl) Update(webhook models.Webhook) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: "Update",
+		Message:   "Updating webhook " + webhook.Id.Hex() + " for appId: " + webhook.AppId,
+		AppId:     webhook.AppId,
+	})
+	update := bson.M{"$set": bson.M{
+		"url":       webhook.Url,
+		"events":    webhook.Events,
+		"enabled":   webhook.Enabled,
+		"updatedAt": time.Now(),
+	}}
+	result, err := t.Db.Collection("webhooks").UpdateOne(context.Background(), bson.M{"_id": webhook.Id, "appId": webhook.AppId}, update)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: "Update",
+			Message:   "Failed to update webhook " + webhook.Id.Hex() + " for appId: " + webhook.AppId,
+			Error:     err,
+			AppId:     webhook.AppId,
+		})
+		return apperrors.FromDatabase(err, "webhook not found")
+	}
+	if result.MatchedCount == 0 {
+		notFoundErr := apperrors.NotFound("webhook not found")
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: "Update",
+			Message:   "No webhook document found to update for appId: " + webhook.AppId,
+			Error:     notFoundErr,
+			AppId:     webhook.AppId,
+		})
+		return notFoundErr
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: "Update",
+		Message:   "Successfully updated webhook " + webhook.Id.Hex() + " for appId: " + webhook.AppId,
+		AppId:     webhook.AppId,
+	})
+	return nil
+}
+
+// Delete deletes the webhook with the given ID belonging to the given appId.
+// It returns a NotFound error if no such webhook exists.
+func (t *WebhookRepositoryImpl) Delete(id primitive.ObjectID, appId string) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: "Delete",
+		Message:   "Deleting webhook " + id.Hex() + " for appId: " + appId,
+		AppId:     appId,
+	})
+	result, err := t.Db.Collection("webhooks").DeleteOne(context.Background(), bson.M{"_id": id, "appId": appId})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: "Delete",
+			Message:   "Failed to delete webhook " + id.Hex() + " for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return apperrors.FromDatabase(err, "webhook not found")
+	}
+	if result.DeletedCount == 0 {
+		notFoundErr := apperrors.NotFound("webhook not found")
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: "Delete",
+			Message:   "No webhook document found to delete for appId: " + appId,
+			Error:     notFoundErr,
+			AppId:     appId,
+		})
+		return notFoundErr
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: "Delete",
+		Message:   "Successfully deleted webhook " + id.Hex() + " for appId: " + appId,
+		AppId:     appId,
+	})
+	return nil
+}
+
+// LogDelivery records a single webhook delivery attempt in the "webhook_deliveries" collection.
+func (t *WebhookRepositoryImpl) LogDelivery(delivery models.WebhookDelivery) error {
+	_, err := t.Db.Collection("webhook_deliveries").InsertOne(context.Background(), delivery)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: "LogDelivery",
+			Message:   "Failed to log delivery " + delivery.DeliveryId + " for webhook " + delivery.WebhookId.Hex(),
+			Error:     err,
+			AppId:     delivery.AppId,
+		})
+		return apperrors.FromDatabase(err, "webhook not found")
+	}
+	return nil
+}
+
+// FindDeliveries retrieves the most recent delivery attempts of the given webhook, newest first.
+func (t WebhookRepositoryImpl) FindDeliveries(webhookId primitive.ObjectID, limit int64) ([]models.WebhookDelivery, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: "FindDeliveries",
+		Message:   "Fetching deliveries for webhook " + webhookId.Hex(),
+	})
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+	cursor, err := t.Db.Collection("webhook_deliveries").Find(context.Background(), bson.M{"webhookId": webhookId}, opts)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: "FindDeliveries",
+			Message:   "Failed to fetch deliveries for webhook " + webhookId.Hex(),
+			Error:     err,
+		})
+		return nil, apperrors.FromDatabase(err, "webhook not found")
+	}
+	defer cursor.Close(context.Background())
+
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(context.Background(), &deliveries); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: "FindDeliveries",
+			Message:   "Failed to decode deliveries for webhook " + webhookId.Hex(),
+			Error:     err,
+		})
+		return nil, apperrors.FromDatabase(err, "webhook not found")
+	}
+	return deliveries, nil
+}
+
+// find runs the given filter against the "webhooks" collection and decodes all matching documents.
+func (t WebhookRepositoryImpl) find(operation string, appId string, filter bson.M) ([]models.Webhook, error) {
+	cursor, err := t.Db.Collection("webhooks").Find(context.Background(), filter)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: operation,
+			Message:   "Failed to fetch webhooks for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return nil, apperrors.FromDatabase(err, "webhook not found")
+	}
+	defer cursor.Close(context.Background())
+
+	webhooks := []models.Webhook{}
+	if err := cursor.All(context.Background(), &webhooks); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Repository",
+			Operation: operation,
+			Message:   "Failed to decode webhooks for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return nil, apperrors.FromDatabase(err, "webhook not found")
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Webhook Repository",
+		Operation: operation,
+		Message:   fmt.Sprintf("Found %d webhooks for appId: %s", len(webhooks), appId),
+		AppId:     appId,
+	})
+	return webhooks, nil
+}
@@ -0,0 +1,133 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	notificationService "r2-notify-server/services/notification"
+	retentionService "r2-notify-server/services/retention"
+	"r2-notify-server/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartRetentionWorker deletes the notifications of every app with a retention policy once they are older
+// than the days configured for their read status. It runs every day at RETENTION_CLEANUP_HOUR (UTC) until
+// the context is cancelled. Only the first instance to claim the day's run in Redis runs it.
+func StartRetentionWorker(ctx context.Context, retention retentionService.RetentionService, notifications notificationService.NotificationService) {
+	hour := config.LoadConfig().RetentionCleanupHour
+	for {
+		next := nextCleanup(time.Now().UTC(), hour)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down retention worker",
+				Component: "Retention Worker",
+				Operation: "Shutdown Retention Worker",
+			})
+			return
+		case <-timer.C:
+		}
+		if claimCleanup(next) {
+			cleanupExpired(ctx, retention, notifications)
+		}
+	}
+}
+
+// nextCleanup returns the next time after now at the given hour of the day, in UTC.
+func nextCleanup(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// claimCleanup claims the cleanup of the given day, so it runs on a single instance. The claim fails open:
+// while Redis is unavailable every instance runs the cleanup, which only deletes the same notifications twice.
+func claimCleanup(day time.Time) bool {
+	claimed, err := config.RDB.SetNX(config.Ctx, "retention:cleanup:"+day.Format(time.DateOnly), true, 23*time.Hour).Result()
+	if err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Retention Worker",
+			Operation: "ClaimCleanup",
+			Message:   "Failed to claim the retention cleanup of " + day.Format(time.DateOnly) + ", running it anyway",
+			Error:     err,
+		})
+		return true
+	}
+	return claimed
+}
+
+// cleanupExpired applies the retention policy of every app, traced as its own span.
+func cleanupExpired(ctx context.Context, retention retentionService.RetentionService, notifications notificationService.NotificationService) {
+	ctx, span := tracing.Start(ctx, "retention.cleanup", trace.SpanKindInternal)
+	policies, err := retention.FindAll()
+	if err != nil {
+		tracing.End(span, err)
+		logger.Log.Error(logger.LogPayload{
+			Component: "Retention Worker",
+			Operation: "CleanupExpired",
+			Message:   "Failed to read retention policies, skipping the cleanup",
+			Error:     err,
+		})
+		return
+	}
+	var total int64
+	for _, policy := range policies {
+		read, readErr := deleteExpired(ctx, notifications, policy.AppId, true, policy.ReadDays)
+		unread, unreadErr := deleteExpired(ctx, notifications, policy.AppId, false, policy.UnreadDays)
+		if readErr != nil {
+			err = readErr
+		} else if unreadErr != nil {
+			err = unreadErr
+		}
+		total += read + unread
+		if read+unread > 0 {
+			logger.Log.Info(logger.LogPayload{
+				Component: "Retention Worker",
+				Operation: "CleanupExpired",
+				Message:   fmt.Sprintf("Deleted %d read notifications older than %d days and %d unread notifications older than %d days for appId: %s", read, policy.ReadDays, unread, policy.UnreadDays, policy.AppId),
+				AppId:     policy.AppId,
+			})
+		}
+	}
+	tracing.End(span, err)
+	logger.Log.Info(logger.LogPayload{
+		Component: "Retention Worker",
+		Operation: "CleanupExpired",
+		Message:   fmt.Sprintf("Retention cleanup of %d apps deleted %d notifications", len(policies), total),
+	})
+}
+
+// deleteExpired deletes the notifications of the app with the given read status older than days, and
+// counts them in retention.<appId>.deleted.read or retention.<appId>.deleted.unread and notifications.expired.
+// Zero days keeps the notifications forever.
+func deleteExpired(ctx context.Context, notifications notificationService.NotificationService, appId string, readStatus bool, days int) (int64, error) {
+	if days <= 0 {
+		return 0, nil
+	}
+	status := "unread"
+	if readStatus {
+		status = "read"
+	}
+	deleted, err := notifications.DeleteExpired(ctx, appId, readStatus, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Retention Worker",
+			Operation: "DeleteExpired",
+			Message:   "Failed to delete expired " + status + " notifications for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return 0, err
+	}
+	metrics.Add("retention."+appId+".deleted."+status, deleted)
+	metrics.Add("notifications.expired", deleted)
+	return deleted, nil
+}
@@ -0,0 +1,63 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	notificationService "r2-notify-server/services/notification"
+	"r2-notify-server/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Interval at which the purge worker removes expired soft-deleted notifications.
+const purgeInterval = time.Hour
+
+// StartPurgeWorker permanently removes soft-deleted notifications once they are older than
+// DELETED_NOTIFICATION_RETENTION_DAYS. It purges once at startup and then every hour until the
+// context is cancelled.
+func StartPurgeWorker(ctx context.Context, service notificationService.NotificationService) {
+	retention := time.Duration(max(config.LoadConfig().DeletedRetentionDays, 0)) * 24 * time.Hour
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		purgeDeleted(ctx, service, retention)
+		select {
+		case <-ctx.Done():
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down purge worker",
+				Component: "Purge Worker",
+				Operation: "Shutdown Purge Worker",
+			})
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDeleted runs a single purge, traced as its own span, and records the number of notifications removed.
+func purgeDeleted(ctx context.Context, service notificationService.NotificationService, retention time.Duration) {
+	ctx, span := tracing.Start(ctx, "retention.purge", trace.SpanKindInternal)
+	purged, err := service.PurgeDeleted(ctx, retention)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Purge Worker",
+			Operation: "PurgeDeleted",
+			Message:   "Failed to purge deleted notifications",
+			Error:     err,
+		})
+		return
+	}
+	metrics.Add("notifications.purged", purged)
+	if purged > 0 {
+		logger.Log.Info(logger.LogPayload{
+			Component: "Purge Worker",
+			Operation: "PurgeDeleted",
+			Message:   fmt.Sprintf("Purged %d notifications deleted more than %s ago", purged, retention),
+		})
+	}
+}
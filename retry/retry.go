@@ -0,0 +1,136 @@
+package retry
+
+// Package retry retries database operations that failed with a transient error, such as a dropped connection
+// or a replica set election, with capped exponential backoff, and bounds each attempt with a query timeout.
+// Only idempotent operations may be retried, since a failed attempt may still have been applied.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Codes of MongoDB server errors raised while the replica set elects a new primary or a node shuts down.
+var transientCodes = []int{
+	6,     // HostUnreachable
+	7,     // HostNotFound
+	89,    // NetworkTimeout
+	91,    // ShutdownInProgress
+	189,   // PrimarySteppedDown
+	262,   // ExceededTimeLimit
+	9001,  // SocketException
+	10107, // NotWritablePrimary
+	11600, // InterruptedAtShutdown
+	11602, // InterruptedDueToReplStateChange
+	13435, // NotPrimaryNoSecondaryOk
+	13436, // NotPrimaryOrSecondary
+}
+
+// Policy configures the retries of an operation. Attempt n waits BaseDelay * 2^(n-2), capped at MaxDelay,
+// before it starts. A zero Timeout does not bound the attempts.
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Timeout     time.Duration
+}
+
+// MongoPolicy returns the policy of MongoDB operations, configured with MONGO_QUERY_TIMEOUT_MS,
+// MONGO_RETRY_MAX_ATTEMPTS, MONGO_RETRY_BASE_DELAY_MS and MONGO_RETRY_MAX_DELAY_MS.
+func MongoPolicy() Policy {
+	cfg := config.LoadConfig()
+	return Policy{
+		MaxAttempts: max(cfg.MongoRetryMaxAttempts, 1),
+		BaseDelay:   time.Duration(cfg.MongoRetryBaseDelayMs) * time.Millisecond,
+		MaxDelay:    time.Duration(cfg.MongoRetryMaxDelayMs) * time.Millisecond,
+		Timeout:     time.Duration(cfg.MongoQueryTimeoutMs) * time.Millisecond,
+	}
+}
+
+// IsTransient reports whether an error returned by the MongoDB driver, possibly wrapped in an application
+// error, is likely to go away when the operation is retried: network errors, timeouts, failed server
+// selection and the errors raised while a new primary is elected. Cancelled operations are not transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) || errors.As(err, &topology.ServerSelectionError{}) {
+		return true
+	}
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		if serverErr.HasErrorLabel("RetryableWriteError") || serverErr.HasErrorLabel("TransientTransactionError") {
+			return true
+		}
+		for _, code := range transientCodes {
+			if serverErr.HasErrorCode(code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Call runs the named operation with the policy, passing each attempt a context bounded by the query timeout.
+// Transient errors are retried until the attempts are exhausted or the context is done; any other error, and
+// the error of the last attempt, is returned at once. Operations within a transaction are attempted once,
+// since a failed transaction is aborted and retried as a whole. Retries are counted in db.retries and
+// operations that still failed after retrying in db.retries.exhausted.
+func Call[T any](ctx context.Context, name string, policy Policy, operation func(ctx context.Context) (T, error)) (T, error) {
+	if mongo.SessionFromContext(ctx) != nil {
+		policy.MaxAttempts = 1
+	}
+	var result T
+	var err error
+	delay := policy.BaseDelay
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			metrics.Inc("db.retries")
+			logger.Log.Warn(logger.LogPayload{
+				Component: "Retry",
+				Operation: name,
+				Message:   fmt.Sprintf("Retrying %s after transient error, attempt %d of %d", name, attempt, policy.MaxAttempts),
+				Error:     err,
+			})
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return result, err
+			case <-timer.C:
+			}
+			delay = min(delay*2, policy.MaxDelay)
+		}
+		result, err = attemptWithTimeout(ctx, policy.Timeout, operation)
+		if err == nil || !IsTransient(err) || ctx.Err() != nil {
+			return result, err
+		}
+	}
+	if policy.MaxAttempts > 1 {
+		metrics.Inc("db.retries.exhausted")
+	}
+	return result, err
+}
+
+// Do runs the named operation like Call, for operations without a result.
+func Do(ctx context.Context, name string, policy Policy, operation func(ctx context.Context) error) error {
+	_, err := Call(ctx, name, policy, func(ctx context.Context) (struct{}, error) { return struct{}{}, operation(ctx) })
+	return err
+}
+
+// attemptWithTimeout runs a single attempt of an operation, bounded by the timeout if it is set.
+func attemptWithTimeout[T any](ctx context.Context, timeout time.Duration, operation func(ctx context.Context) (T, error)) (T, error) {
+	if timeout <= 0 {
+		return operation(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return operation(ctx)
+}
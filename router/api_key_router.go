@@ -0,0 +1,15 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterApiKeyRoutes(r *gin.Engine, apiKeyController *controller.ApiKeyController) {
+	apiKeyRoute := r.Group("/apiKeys", middleware.AdminKeyMiddleware())
+	apiKeyRoute.GET("", apiKeyController.ListApiKeys)
+	apiKeyRoute.POST("", apiKeyController.CreateApiKey)
+	apiKeyRoute.DELETE("/:id", apiKeyController.RevokeApiKey)
+}
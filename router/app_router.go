@@ -0,0 +1,16 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAppRoutes(r *gin.Engine, appController *controller.AppController) {
+	appRoute := r.Group("/admin/apps", middleware.AdminKeyMiddleware())
+	appRoute.GET("", appController.ListApps)
+	appRoute.GET("/:appId", appController.GetApp)
+	appRoute.PUT("/:appId", appController.UpsertApp)
+	appRoute.DELETE("/:appId", appController.DeleteApp)
+}
@@ -0,0 +1,13 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAuditRoutes(r *gin.Engine, auditController *controller.AuditController) {
+	auditRoute := r.Group("/audit", middleware.AdminKeyMiddleware())
+	auditRoute.GET("", auditController.ListAuditEntries)
+}
@@ -0,0 +1,13 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterBroadcastRoutes(r *gin.Engine, broadcastController *controller.BroadcastController) {
+	broadcastRoute := r.Group("/admin/broadcast", middleware.AdminKeyMiddleware())
+	broadcastRoute.POST("", broadcastController.Broadcast)
+}
@@ -0,0 +1,14 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterConfigurationRoutes(r *gin.Engine, configurationController *controller.ConfigurationController) {
+	configurationRoute := r.Group("/configurations")
+	configurationRoute.GET("", configurationController.GetConfiguration)
+	configurationRoute.PUT("", configurationController.UpdateConfiguration)
+	configurationRoute.DELETE("", configurationController.DeleteConfiguration)
+}
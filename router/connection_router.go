@@ -0,0 +1,13 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterConnectionRoutes(r *gin.Engine, connectionController *controller.ConnectionController) {
+	connectionRoute := r.Group("/admin/connections", middleware.AdminKeyMiddleware())
+	connectionRoute.GET("/:userId/history", connectionController.GetConnectionHistory)
+}
@@ -0,0 +1,13 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterDeviceRoutes(r *gin.Engine, deviceController *controller.DeviceController) {
+	deviceRoute := r.Group("/devices")
+	deviceRoute.GET("", deviceController.ListDevices)
+	deviceRoute.DELETE("/:id", deviceController.DisconnectDevice)
+}
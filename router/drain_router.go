@@ -0,0 +1,14 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterDrainRoutes(r *gin.Engine, drainController *controller.DrainController) {
+	drainRoute := r.Group("/admin/drain", middleware.AdminKeyMiddleware())
+	drainRoute.POST("", drainController.Drain)
+	drainRoute.GET("", drainController.GetDrainStatus)
+}
@@ -0,0 +1,13 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterEventHubRoutes(r *gin.Engine, eventHubController *controller.EventHubController) {
+	eventHubRoute := r.Group("/admin/eventhub", middleware.AdminKeyMiddleware())
+	eventHubRoute.GET("/lag", eventHubController.GetLag)
+}
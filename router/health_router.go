@@ -0,0 +1,12 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterHealthRoutes(r *gin.Engine, healthController *controller.HealthController) {
+	r.GET("/health", healthController.GetHealth)
+	r.GET("/ready", healthController.GetReadiness)
+}
@@ -0,0 +1,11 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterMetricsRoutes(r *gin.Engine, metricsController *controller.MetricsController) {
+	r.GET("/metrics", metricsController.GetMetrics)
+}
@@ -2,11 +2,25 @@ package router
 
 import (
 	"r2-notify-server/controller"
+	"r2-notify-server/data"
+	"r2-notify-server/middleware"
+	apiKeyService "r2-notify-server/services/apikey"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterNotificationRoutes(r *gin.Engine, notificationController *controller.NotificationController) {
-	notificationRoute := r.Group("/notification")
-	notificationRoute.POST("", notificationController.CreateNotification)
+func RegisterNotificationRoutes(r *gin.Engine, notificationController *controller.NotificationController, apiKeyService apiKeyService.ApiKeyService) {
+	notificationRoute := r.Group("/notification", middleware.ApiKeyMiddleware(apiKeyService))
+	notificationRoute.POST("", middleware.RequestBodyMiddleware[data.CreateNotificationRequest](), notificationController.CreateNotification)
+
+	notificationsRoute := r.Group("/notifications")
+	notificationsRoute.GET("/search", notificationController.SearchNotifications)
+	notificationsRoute.GET("/stats", notificationController.GetNotificationStats)
+	notificationsRoute.GET("/export", notificationController.ExportNotifications)
+	notificationsRoute.POST("/syncReadState", notificationController.SyncReadState)
+	notificationsRoute.POST("/direct", middleware.ApiKeyMiddleware(apiKeyService), middleware.RequestBodyMiddleware[data.DirectNotificationRequest](), notificationController.CreateDirectNotification)
+	notificationsRoute.POST("/restoreDeleted", middleware.AdminKeyMiddleware(), notificationController.RestoreDeleted)
+
+	adminNotificationRoute := r.Group("/admin/notifications", middleware.AdminKeyMiddleware())
+	adminNotificationRoute.GET("/:userId/:id", notificationController.GetNotificationTrace)
 }
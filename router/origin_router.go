@@ -0,0 +1,16 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterOriginRoutes(r *gin.Engine, originController *controller.OriginController) {
+	originRoute := r.Group("/admin/origins", middleware.AdminKeyMiddleware())
+	originRoute.GET("", originController.ListOrigins)
+	originRoute.GET("/:appId", originController.GetOrigins)
+	originRoute.PUT("/:appId", originController.UpdateOrigins)
+	originRoute.DELETE("/:appId", originController.DeleteOrigins)
+}
@@ -0,0 +1,18 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterPolicyRoutes(r *gin.Engine, policyController *controller.PolicyController) {
+	policyRoute := r.Group("/admin/policies", middleware.AdminKeyMiddleware())
+	policyRoute.GET("/:appId", policyController.ListPolicies)
+	policyRoute.POST("/:appId", policyController.CreatePolicy)
+	policyRoute.POST("/:appId/evaluate", policyController.EvaluatePolicies)
+	policyRoute.GET("/:appId/:id", policyController.GetPolicy)
+	policyRoute.PUT("/:appId/:id", policyController.UpdatePolicy)
+	policyRoute.DELETE("/:appId/:id", policyController.DeletePolicy)
+}
@@ -0,0 +1,11 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterProtocolRoutes(r *gin.Engine, protocolController *controller.ProtocolController) {
+	r.GET("/protocol", protocolController.GetProtocol)
+}
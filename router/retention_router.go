@@ -0,0 +1,16 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterRetentionRoutes(r *gin.Engine, retentionController *controller.RetentionController) {
+	retentionRoute := r.Group("/admin/retention", middleware.AdminKeyMiddleware())
+	retentionRoute.GET("", retentionController.ListRetention)
+	retentionRoute.GET("/:appId", retentionController.GetRetention)
+	retentionRoute.PUT("/:appId", retentionController.UpdateRetention)
+	retentionRoute.DELETE("/:appId", retentionController.DeleteRetention)
+}
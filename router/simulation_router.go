@@ -0,0 +1,13 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterSimulationRoutes(r *gin.Engine, simulationController *controller.SimulationController) {
+	simulationRoute := r.Group("/admin/simulate", middleware.AdminKeyMiddleware())
+	simulationRoute.POST("", simulationController.Simulate)
+}
@@ -0,0 +1,16 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+	apiKeyService "r2-notify-server/services/apikey"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterStatusRoutes(r *gin.Engine, statusController *controller.StatusController, apiKeyService apiKeyService.ApiKeyService) {
+	statusRoute := r.Group("", middleware.ApiKeyMiddleware(apiKeyService))
+	statusRoute.PATCH("/notifications/:id/status", statusController.UpdateNotificationStatus)
+	// Kept for producers written against the singular path
+	statusRoute.PATCH("/notification/:id/status", statusController.UpdateNotificationStatus)
+}
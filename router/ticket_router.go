@@ -0,0 +1,16 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+	apiKeyService "r2-notify-server/services/apikey"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterTicketRoutes registers the endpoint issuing handshake tickets. A ticket lets its holder connect as
+// any user of the app, so every request must carry an API key issued for the app given by the X-App-ID header.
+func RegisterTicketRoutes(r *gin.Engine, ticketController *controller.TicketController, apiKeyService apiKeyService.ApiKeyService) {
+	ticketRoute := r.Group("/ws", middleware.RequiredApiKeyMiddleware(apiKeyService))
+	ticketRoute.POST("/ticket", ticketController.CreateTicket)
+}
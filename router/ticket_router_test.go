@@ -0,0 +1,79 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/controller"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/middleware"
+	"r2-notify-server/models"
+	apiKeyService "r2-notify-server/services/apikey"
+	ticketService "r2-notify-server/services/ticket"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap/zapcore"
+)
+
+// unknownApiKeys is an API key repository without any key.
+type unknownApiKeys struct{}
+
+func (unknownApiKeys) FindAll(appId string) ([]models.ApiKey, error) { return nil, nil }
+func (unknownApiKeys) FindActiveByHash(keyHash string) (models.ApiKey, error) {
+	return models.ApiKey{}, apperrors.NotFound("api key not found")
+}
+func (unknownApiKeys) Create(apiKey models.ApiKey) (primitive.ObjectID, error) {
+	return primitive.NilObjectID, nil
+}
+func (unknownApiKeys) Revoke(id primitive.ObjectID) error { return nil }
+func (unknownApiKeys) CreateIndexes() error               { return nil }
+
+// issuedTickets is a ticket service counting the tickets it issued.
+type issuedTickets struct {
+	ticketService.TicketService
+	issued int
+}
+
+func (t *issuedTickets) Issue(tenantId string, userId string) (data.WsTicket, error) {
+	t.issued++
+	return data.WsTicket{Ticket: "ticket"}, nil
+}
+
+func TestCreateTicketRequiresApiKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Log = logger.NewTestSink(zapcore.ErrorLevel).Logger
+	t.Setenv("REQUIRE_API_KEYS", "false")
+
+	keys, err := apiKeyService.NewApiKeyServiceImpl(unknownApiKeys{}, validator.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tickets := &issuedTickets{}
+	r := gin.New()
+	r.Use(middleware.CorrelationIDMiddleware())
+	RegisterTicketRoutes(r, controller.NewTicketController(tickets), keys)
+
+	for name, key := range map[string]string{"without key": "", "with unknown key": "r2k_unknown"} {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/ws/ticket", nil)
+			request.Header.Set("X-User-ID", "user")
+			request.Header.Set("X-App-ID", "app")
+			if key != "" {
+				request.Header.Set("X-Api-Key", key)
+			}
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusUnauthorized {
+				t.Fatalf("got status %d, want %d", recorder.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+	if tickets.issued != 0 {
+		t.Fatalf("issued %d tickets to unauthenticated requests", tickets.issued)
+	}
+}
@@ -0,0 +1,15 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+	apiKeyService "r2-notify-server/services/apikey"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterUserRoutes(r *gin.Engine, userController *controller.UserController, apiKeyService apiKeyService.ApiKeyService) {
+	userRoute := r.Group("/users")
+	userRoute.DELETE("/:userId/data", middleware.AdminKeyMiddleware(), userController.EraseUserData)
+	userRoute.GET("/:userId/reachability", middleware.ApiKeyMiddleware(apiKeyService), userController.GetReachability)
+}
@@ -0,0 +1,21 @@
+package router
+
+import (
+	"r2-notify-server/controller"
+	"r2-notify-server/middleware"
+	apiKeyService "r2-notify-server/services/apikey"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterWebhookRoutes registers the webhook endpoints of apps. Webhooks receive the events of the users of
+// their app, so every request must carry an API key issued for the app given by the X-App-ID header.
+func RegisterWebhookRoutes(r *gin.Engine, webhookController *controller.WebhookController, apiKeyService apiKeyService.ApiKeyService) {
+	webhookRoute := r.Group("/webhooks", middleware.RequiredApiKeyMiddleware(apiKeyService))
+	webhookRoute.GET("", webhookController.ListWebhooks)
+	webhookRoute.POST("", webhookController.CreateWebhook)
+	webhookRoute.GET("/:id", webhookController.GetWebhook)
+	webhookRoute.PUT("/:id", webhookController.UpdateWebhook)
+	webhookRoute.DELETE("/:id", webhookController.DeleteWebhook)
+	webhookRoute.GET("/:id/deliveries", webhookController.ListDeliveries)
+}
@@ -0,0 +1,645 @@
+// Code generated by protocol/cmd/protocolgen. DO NOT EDIT.
+// Definitions of the WebSocket protocol of r2-notify-server, see GET /protocol.
+
+export const PROTOCOL_VERSION = "1.0";
+
+export const ClientEvents = {
+  hello: "hello",
+  markAsRead: "markAsRead",
+  markAppAsRead: "markAppAsRead",
+  markGroupAsRead: "markGroupAsRead",
+  groupOpened: "groupOpened",
+  markNotificationAsRead: "markNotificationAsRead",
+  syncReadState: "syncReadState",
+  updateNotificationStatus: "updateNotificationStatus",
+  deleteNotifications: "deleteNotifications",
+  deleteAppNotifications: "deleteAppNotifications",
+  deleteGroupNotifications: "deleteGroupNotifications",
+  deleteNotification: "deleteNotification",
+  reloadNotifications: "reloadNotifications",
+  setNotificationStatus: "setNotificationStatus",
+  pinNotification: "pinNotification",
+  unpinNotification: "unpinNotification",
+  muteGroup: "muteGroup",
+  unmuteGroup: "unmuteGroup",
+  searchNotifications: "searchNotifications",
+  getNotificationsSince: "getNotificationsSince",
+  fullResync: "fullResync",
+  resyncFromSequence: "resyncFromSequence",
+  notificationActionTriggered: "notificationActionTriggered",
+  listDevices: "listDevices",
+  disconnectDevice: "disconnectDevice",
+  heartbeat: "heartbeat",
+} as const;
+
+export type ClientEventName = (typeof ClientEvents)[keyof typeof ClientEvents];
+
+export const ServerEvents = {
+  hello: "hello",
+  connected: "connected",
+  newNotification: "newNotification",
+  notificationReplaced: "notificationReplaced",
+  listNotifications: "listNotifications",
+  listNotificationsSummary: "listNotificationsSummary",
+  resumeNotifications: "resumeNotifications",
+  notificationUpdated: "notificationUpdated",
+  notificationStatusUpdated: "notificationStatusUpdated",
+  notificationDeleted: "notificationDeleted",
+  notificationsMarkedRead: "notificationsMarkedRead",
+  readStateSynced: "readStateSynced",
+  systemAnnouncement: "systemAnnouncement",
+  reconnectRequested: "reconnectRequested",
+  listConfigurations: "listConfigurations",
+  searchResults: "searchResults",
+  notificationsSince: "notificationsSince",
+  sequenceResync: "sequenceResync",
+  digestNotification: "digestNotification",
+  groupSummary: "groupSummary",
+  notificationReminder: "notificationReminder",
+  listDevices: "listDevices",
+  heartbeat: "heartbeat",
+  error: "error",
+} as const;
+
+export type ServerEventName = (typeof ServerEvents)[keyof typeof ServerEvents];
+
+export interface HelloData {
+  protocolVersion: string;
+  sdk: string;
+}
+
+export interface HelloEvent {
+  event: string;
+  resumeToken?: string;
+  data: HelloData;
+}
+
+export interface Event {
+  event: string;
+  resumeToken?: string;
+}
+
+export interface AppTarget {
+  appId: string;
+}
+
+export interface AppEvent {
+  event: string;
+  resumeToken?: string;
+  data: AppTarget;
+}
+
+export interface GroupTarget {
+  appId: string;
+  groupKey: string;
+}
+
+export interface GroupEvent {
+  event: string;
+  resumeToken?: string;
+  data: GroupTarget;
+}
+
+export interface GroupOpenedTarget {
+  appId: string;
+  groupKey: string;
+  openedAt: string;
+}
+
+export interface GroupOpenedEvent {
+  event: string;
+  resumeToken?: string;
+  data: GroupOpenedTarget;
+}
+
+export interface NotificationReadTarget {
+  id: string;
+  thread?: boolean;
+}
+
+export interface NotificationReadEvent {
+  event: string;
+  resumeToken?: string;
+  data: NotificationReadTarget;
+}
+
+export interface ReadStateChange {
+  notificationId: string;
+  readStatus: boolean;
+  readAt: string;
+}
+
+export interface SyncReadStateRequest {
+  changes: ReadStateChange[];
+}
+
+export interface SyncReadStateEvent {
+  event: string;
+  resumeToken?: string;
+  data: SyncReadStateRequest;
+}
+
+export interface NotificationStatusTarget {
+  id: string;
+  status: string;
+}
+
+export interface NotificationStatusEvent {
+  event: string;
+  resumeToken?: string;
+  data: NotificationStatusTarget;
+}
+
+export interface NotificationTarget {
+  id: string;
+}
+
+export interface NotificationEvent {
+  event: string;
+  resumeToken?: string;
+  data: NotificationTarget;
+}
+
+export interface DigestSetting {
+  appId: string;
+  windowMinutes: number;
+}
+
+export interface MutedGroup {
+  appId: string;
+  groupKey: string;
+  until: string;
+}
+
+export interface NotificationConfig {
+  id: string;
+  tenantId?: string;
+  userId: string;
+  enableNotification: boolean;
+  digestApps: DigestSetting[];
+  mutedGroups: MutedGroup[];
+  listScope: string;
+}
+
+export interface Configuration {
+  event: string;
+  resumeToken?: string;
+  data: NotificationConfig;
+}
+
+export interface MuteGroupTarget {
+  appId: string;
+  groupKey: string;
+  durationMinutes: number;
+}
+
+export interface MuteGroupEvent {
+  event: string;
+  resumeToken?: string;
+  data: MuteGroupTarget;
+}
+
+export interface NotificationSearchQuery {
+  q: string;
+  appId: string;
+  status: string;
+  readStatus: boolean | null;
+  source: string;
+  from: string | null;
+  to: string | null;
+  page: number;
+  pageSize: number;
+}
+
+export interface SearchNotificationsEvent {
+  event: string;
+  resumeToken?: string;
+  data: NotificationSearchQuery;
+}
+
+export interface NotificationsSinceQuery {
+  since: string;
+  afterId?: string;
+  limit?: number;
+}
+
+export interface GetNotificationsSinceEvent {
+  event: string;
+  resumeToken?: string;
+  data: NotificationsSinceQuery;
+}
+
+export interface SequenceResyncQuery {
+  afterSequence: number;
+  limit?: number;
+}
+
+export interface ResyncFromSequenceEvent {
+  event: string;
+  resumeToken?: string;
+  data: SequenceResyncQuery;
+}
+
+export interface NotificationActionTarget {
+  id: string;
+  actionId: string;
+}
+
+export interface NotificationActionEvent {
+  event: string;
+  resumeToken?: string;
+  data: NotificationActionTarget;
+}
+
+export interface DeviceTarget {
+  id: string;
+}
+
+export interface DeviceEvent {
+  event: string;
+  resumeToken?: string;
+  data: DeviceTarget;
+}
+
+export interface HeartbeatData {
+  timestamp: number;
+  latencyMs?: number;
+}
+
+export interface HeartbeatEvent {
+  event: string;
+  resumeToken?: string;
+  data: HeartbeatData;
+}
+
+export interface ProtocolEvents {
+  client: string[];
+  server: string[];
+}
+
+export interface ProtocolInfo {
+  version: string;
+  events: ProtocolEvents;
+  formats: string[];
+  envelopeVersions: number[];
+  features: Record<string, boolean>;
+}
+
+export interface HelloResponse {
+  event: string;
+  resumeToken?: string;
+  data: ProtocolInfo;
+}
+
+export interface ConnectedData {
+  connectionId: string;
+  protocolVersion: string;
+  features: Record<string, boolean>;
+  unreadCount: number;
+  lastSequence?: number;
+  configuration: NotificationConfig;
+  serverTime: number;
+}
+
+export interface Connected {
+  event: string;
+  resumeToken?: string;
+  data: ConnectedData;
+}
+
+export interface NotificationAction {
+  label: string;
+  actionId: string;
+  url?: string;
+}
+
+export interface NotificationAttachment {
+  type: string;
+  url: string;
+  thumbnailUrl?: string;
+  size?: number;
+}
+
+export interface NotificationUIHints {
+  icon?: string;
+  color?: string;
+  sound?: string;
+  sticky?: boolean;
+}
+
+export interface AppInfo {
+  displayName: string;
+  iconUrl?: string;
+}
+
+export interface Notification {
+  id: string;
+  tenantId?: string;
+  appId: string;
+  userId: string;
+  groupKey: string;
+  message: string;
+  readStatus: boolean;
+  status: string;
+  createdAt: string;
+  updatedAt: string;
+  actions?: NotificationAction[];
+  muted?: boolean;
+  readAt?: string;
+  senderId?: string;
+  senderName?: string;
+  senderAvatarUrl?: string;
+  collapseKey?: string;
+  attachments?: NotificationAttachment[];
+  pinned?: boolean;
+  uiHints?: NotificationUIHints;
+  expiresAt?: string;
+  remindAt?: string;
+  truncated?: boolean;
+  parentId?: string;
+  replyCount?: number;
+  unreadReplyCount?: number;
+  sequence?: number;
+  app?: AppInfo;
+}
+
+export interface EventNotification {
+  event: string;
+  resumeToken?: string;
+  data: Notification;
+}
+
+export interface NotificationList {
+  event: string;
+  resumeToken?: string;
+  part?: number;
+  totalParts?: number;
+  complete?: boolean;
+  data: Notification[];
+}
+
+export interface ListSummary {
+  total: number;
+  totalParts: number;
+}
+
+export interface NotificationListSummary {
+  event: string;
+  resumeToken?: string;
+  data: ListSummary;
+}
+
+export interface NotificationResume {
+  tenantId?: string;
+  userId: string;
+  since: string;
+  notifications: Notification[];
+  deletedIds: string[];
+}
+
+export interface NotificationsResumed {
+  event: string;
+  resumeToken?: string;
+  data: NotificationResume;
+}
+
+export interface NotificationChangeSet {
+  tenantId?: string;
+  userId: string;
+  ids: string[];
+}
+
+export interface NotificationChange {
+  event: string;
+  resumeToken?: string;
+  data: NotificationChangeSet;
+}
+
+export interface ReadStateSyncResult {
+  tenantId?: string;
+  userId: string;
+  applied: string[];
+  notifications: Notification[];
+  missing: string[];
+}
+
+export interface ReadStateSynced {
+  event: string;
+  resumeToken?: string;
+  data: ReadStateSyncResult;
+}
+
+export interface Announcement {
+  id: string;
+  title?: string;
+  message: string;
+  level: string;
+  appId?: string;
+  sentAt: string;
+}
+
+export interface SystemAnnouncement {
+  event: string;
+  resumeToken?: string;
+  data: Announcement;
+}
+
+export interface ReconnectRequest {
+  reason: string;
+  retryAfterSeconds: number;
+}
+
+export interface ReconnectRequested {
+  event: string;
+  resumeToken?: string;
+  data: ReconnectRequest;
+}
+
+export interface NotificationSearchPage {
+  items: Notification[];
+  total: number;
+  page: number;
+  pageSize: number;
+}
+
+export interface NotificationSearchResult {
+  event: string;
+  resumeToken?: string;
+  data: NotificationSearchPage;
+}
+
+export interface NotificationsSincePage {
+  notifications: Notification[];
+  deletedIds: string[];
+  hasMore: boolean;
+  nextSince: string;
+  nextAfterId?: string;
+}
+
+export interface NotificationsSince {
+  event: string;
+  resumeToken?: string;
+  data: NotificationsSincePage;
+}
+
+export interface SequenceResyncPage {
+  notifications: Notification[];
+  hasMore: boolean;
+  lastSequence: number;
+}
+
+export interface SequenceResync {
+  event: string;
+  resumeToken?: string;
+  data: SequenceResyncPage;
+}
+
+export interface DigestSummary {
+  groupKey: string;
+  count: number;
+  latestMessage: string;
+  latestStatus: string;
+}
+
+export interface Digest {
+  userId: string;
+  appId: string;
+  count: number;
+  windowStart: string;
+  windowEnd: string;
+  summaries: DigestSummary[];
+  app?: AppInfo;
+}
+
+export interface DigestNotification {
+  event: string;
+  resumeToken?: string;
+  data: Digest;
+}
+
+export interface GroupSummary {
+  tenantId?: string;
+  userId: string;
+  appId: string;
+  groupKey: string;
+  count: number;
+  latestId: string;
+  latestMessage: string;
+  latestStatus: string;
+  latestSequence?: number;
+  earliestUnreadAt: string;
+  app?: AppInfo;
+}
+
+export interface GroupSummaryNotification {
+  event: string;
+  resumeToken?: string;
+  data: GroupSummary;
+}
+
+export interface DeviceInfo {
+  connectionId: string;
+  deviceId?: string;
+  deviceType: string;
+  appId?: string;
+  userAgent?: string;
+  ip?: string;
+  transport: string;
+  connectedAt: string;
+  envelopeVersion: number;
+  chunkedLists?: boolean;
+  latencyMs?: number;
+  lastHeartbeatAt?: string;
+}
+
+export interface DeviceList {
+  event: string;
+  resumeToken?: string;
+  data: DeviceInfo[];
+}
+
+export interface HeartbeatAck {
+  timestamp: number;
+  serverTime: number;
+}
+
+export interface HeartbeatResponse {
+  event: string;
+  resumeToken?: string;
+  data: HeartbeatAck;
+}
+
+export interface ErrorDetail {
+  code: string;
+  message: string;
+  event: string;
+  correlationId: string;
+}
+
+export interface ErrorEvent {
+  event: string;
+  resumeToken?: string;
+  data: ErrorDetail;
+}
+
+export interface Envelope {
+  v: number;
+  event: string;
+  resumeToken?: string;
+  data: unknown;
+}
+
+export type ClientMessage =
+  | (HelloEvent & { event: (typeof ClientEvents)["hello"] })
+  | (Event & { event: (typeof ClientEvents)["markAsRead"] })
+  | (AppEvent & { event: (typeof ClientEvents)["markAppAsRead"] })
+  | (GroupEvent & { event: (typeof ClientEvents)["markGroupAsRead"] })
+  | (GroupOpenedEvent & { event: (typeof ClientEvents)["groupOpened"] })
+  | (NotificationReadEvent & { event: (typeof ClientEvents)["markNotificationAsRead"] })
+  | (SyncReadStateEvent & { event: (typeof ClientEvents)["syncReadState"] })
+  | (NotificationStatusEvent & { event: (typeof ClientEvents)["updateNotificationStatus"] })
+  | (Event & { event: (typeof ClientEvents)["deleteNotifications"] })
+  | (AppEvent & { event: (typeof ClientEvents)["deleteAppNotifications"] })
+  | (GroupEvent & { event: (typeof ClientEvents)["deleteGroupNotifications"] })
+  | (NotificationEvent & { event: (typeof ClientEvents)["deleteNotification"] })
+  | (Event & { event: (typeof ClientEvents)["reloadNotifications"] })
+  | (Configuration & { event: (typeof ClientEvents)["setNotificationStatus"] })
+  | (NotificationEvent & { event: (typeof ClientEvents)["pinNotification"] })
+  | (NotificationEvent & { event: (typeof ClientEvents)["unpinNotification"] })
+  | (MuteGroupEvent & { event: (typeof ClientEvents)["muteGroup"] })
+  | (GroupEvent & { event: (typeof ClientEvents)["unmuteGroup"] })
+  | (SearchNotificationsEvent & { event: (typeof ClientEvents)["searchNotifications"] })
+  | (GetNotificationsSinceEvent & { event: (typeof ClientEvents)["getNotificationsSince"] })
+  | (Event & { event: (typeof ClientEvents)["fullResync"] })
+  | (ResyncFromSequenceEvent & { event: (typeof ClientEvents)["resyncFromSequence"] })
+  | (NotificationActionEvent & { event: (typeof ClientEvents)["notificationActionTriggered"] })
+  | (Event & { event: (typeof ClientEvents)["listDevices"] })
+  | (DeviceEvent & { event: (typeof ClientEvents)["disconnectDevice"] })
+  | (HeartbeatEvent & { event: (typeof ClientEvents)["heartbeat"] });
+
+export type ServerMessage =
+  | (HelloResponse & { event: (typeof ServerEvents)["hello"] })
+  | (Connected & { event: (typeof ServerEvents)["connected"] })
+  | (EventNotification & { event: (typeof ServerEvents)["newNotification"] })
+  | (EventNotification & { event: (typeof ServerEvents)["notificationReplaced"] })
+  | (NotificationList & { event: (typeof ServerEvents)["listNotifications"] })
+  | (NotificationListSummary & { event: (typeof ServerEvents)["listNotificationsSummary"] })
+  | (NotificationsResumed & { event: (typeof ServerEvents)["resumeNotifications"] })
+  | (EventNotification & { event: (typeof ServerEvents)["notificationUpdated"] })
+  | (EventNotification & { event: (typeof ServerEvents)["notificationStatusUpdated"] })
+  | (NotificationChange & { event: (typeof ServerEvents)["notificationDeleted"] })
+  | (NotificationChange & { event: (typeof ServerEvents)["notificationsMarkedRead"] })
+  | (ReadStateSynced & { event: (typeof ServerEvents)["readStateSynced"] })
+  | (SystemAnnouncement & { event: (typeof ServerEvents)["systemAnnouncement"] })
+  | (ReconnectRequested & { event: (typeof ServerEvents)["reconnectRequested"] })
+  | (Configuration & { event: (typeof ServerEvents)["listConfigurations"] })
+  | (NotificationSearchResult & { event: (typeof ServerEvents)["searchResults"] })
+  | (NotificationsSince & { event: (typeof ServerEvents)["notificationsSince"] })
+  | (SequenceResync & { event: (typeof ServerEvents)["sequenceResync"] })
+  | (DigestNotification & { event: (typeof ServerEvents)["digestNotification"] })
+  | (GroupSummaryNotification & { event: (typeof ServerEvents)["groupSummary"] })
+  | (EventNotification & { event: (typeof ServerEvents)["notificationReminder"] })
+  | (DeviceList & { event: (typeof ServerEvents)["listDevices"] })
+  | (HeartbeatResponse & { event: (typeof ServerEvents)["heartbeat"] })
+  | (ErrorEvent & { event: (typeof ServerEvents)["error"] });
+
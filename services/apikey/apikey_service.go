@@ -0,0 +1,12 @@
+package apiKeyService
+
+import (
+	"r2-notify-server/data"
+)
+
+type ApiKeyService interface {
+	FindAll(appId string) ([]data.ApiKey, error)
+	Create(request data.CreateApiKeyRequest) (data.ApiKey, error)
+	Revoke(id string) error
+	Authenticate(appId string, key string) (data.ApiKey, error)
+}
@@ -0,0 +1,142 @@
+package apiKeyService
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	apiKeyRepository "r2-notify-server/repository/apikey"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ApiKeyServiceImpl struct {
+	ApiKeyRepository apiKeyRepository.ApiKeyRepository
+	Validate         *validator.Validate
+}
+
+// NewApiKeyServiceImpl returns a new instance of ApiKeyService with the provided ApiKeyRepository
+// and validator.Validate instance. If the validator instance is nil, an error is returned.
+func NewApiKeyServiceImpl(apiKeyRepository apiKeyRepository.ApiKeyRepository, validate *validator.Validate) (service ApiKeyService, err error) {
+	if validate == nil {
+		return nil, apperrors.Internal("validator instance cannot be nil", nil)
+	}
+	return &ApiKeyServiceImpl{
+		ApiKeyRepository: apiKeyRepository,
+		Validate:         validate,
+	}, err
+}
+
+// FindAll returns the API keys issued for the given appId, including revoked keys.
+// The keys themselves are never returned, only their prefixes.
+func (t *ApiKeyServiceImpl) FindAll(appId string) ([]data.ApiKey, error) {
+	apiKeys, err := t.ApiKeyRepository.FindAll(appId)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]data.ApiKey, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		result = append(result, toApiKey(apiKey))
+	}
+	return result, nil
+}
+
+// Create issues a new API key for the requested appId. Only the hash of the key is stored, so the
+// returned data.ApiKey is the only time the plain key is available.
+func (t *ApiKeyServiceImpl) Create(request data.CreateApiKeyRequest) (data.ApiKey, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "ApiKey Service",
+		Operation: "Create",
+		Message:   "Creating API key for appId: " + request.AppId,
+		AppId:     request.AppId,
+	})
+	if err := t.Validate.Struct(request); err != nil {
+		return data.ApiKey{}, apperrors.Validation("invalid API key request", err)
+	}
+	key, err := generateKey()
+	if err != nil {
+		return data.ApiKey{}, apperrors.Internal("failed to generate API key", err)
+	}
+	m := models.ApiKey{
+		AppId:     request.AppId,
+		Name:      request.Name,
+		Prefix:    key[:data.API_KEY_PREFIX_LENGTH],
+		KeyHash:   hashKey(key),
+		CreatedAt: time.Now(),
+	}
+	id, err := t.ApiKeyRepository.Create(m)
+	if err != nil {
+		return data.ApiKey{}, err
+	}
+	m.Id = id
+	apiKey := toApiKey(m)
+	apiKey.Key = key
+	return apiKey, nil
+}
+
+// Revoke revokes the API key with the given ID. Requests using the key are rejected from then on.
+func (t *ApiKeyServiceImpl) Revoke(id string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return apperrors.NotFound("API key not found")
+	}
+	return t.ApiKeyRepository.Revoke(objID)
+}
+
+// Authenticate verifies that the key is an active API key issued for the given appId and returns it.
+// Unknown, revoked and mismatching keys are all reported as unauthorized, without revealing which.
+func (t *ApiKeyServiceImpl) Authenticate(appId string, key string) (data.ApiKey, error) {
+	if key == "" {
+		return data.ApiKey{}, apperrors.Unauthorized("a valid X-Api-Key header is required")
+	}
+	apiKey, err := t.ApiKeyRepository.FindActiveByHash(hashKey(key))
+	if err != nil {
+		if apperrors.Is(err, apperrors.KindNotFound) {
+			return data.ApiKey{}, apperrors.Unauthorized("invalid API key")
+		}
+		return data.ApiKey{}, err
+	}
+	if apiKey.AppId != appId {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "ApiKey Service",
+			Operation: "Authenticate",
+			Message:   "API key " + apiKey.Prefix + " of appId " + apiKey.AppId + " used for another app",
+			AppId:     appId,
+			ApiKeyId:  apiKey.Id.Hex(),
+		})
+		return data.ApiKey{}, apperrors.Unauthorized("invalid API key")
+	}
+	return toApiKey(apiKey), nil
+}
+
+// generateKey returns a new random API key.
+func generateKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return data.API_KEY_PREFIX + hex.EncodeToString(buf), nil
+}
+
+// hashKey returns the hex encoded SHA-256 hash under which a key is stored.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// toApiKey converts an API key model into its data.ApiKey representation, without the key.
+func toApiKey(value models.ApiKey) data.ApiKey {
+	return data.ApiKey{
+		Id:        value.Id.Hex(),
+		AppId:     value.AppId,
+		Name:      value.Name,
+		Prefix:    value.Prefix,
+		CreatedAt: value.CreatedAt,
+		RevokedAt: value.RevokedAt,
+	}
+}
@@ -0,0 +1,14 @@
+package appService
+
+import (
+	"r2-notify-server/data"
+)
+
+type AppService interface {
+	FindAll() ([]data.App, error)
+	FindByAppId(appId string) (data.App, error)
+	Upsert(appId string, request data.UpsertAppRequest) (data.App, error)
+	Delete(appId string) error
+	AppInfo(appId string) (data.AppInfo, bool)
+	GroupSummaryThreshold(appId string) (int, bool)
+}
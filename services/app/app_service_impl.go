@@ -0,0 +1,227 @@
+package appService
+
+import (
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	appRepository "r2-notify-server/repository/app"
+	originService "r2-notify-server/services/origin"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// catalogEntry is the cached display metadata and group summary threshold of a registered app.
+type catalogEntry struct {
+	info                  data.AppInfo
+	groupSummaryThreshold *int
+}
+
+type AppServiceImpl struct {
+	AppRepository appRepository.AppRepository
+	OriginService originService.OriginService
+	Validate      *validator.Validate
+
+	cacheTTL     time.Duration
+	catalog      map[string]catalogEntry // every registered app, nil until loaded
+	loadedAt     time.Time
+	cacheMutex   sync.RWMutex
+	refreshMutex sync.Mutex // held while the catalog is read from the database
+}
+
+// NewAppServiceImpl returns a new instance of AppService with the provided AppRepository, OriginService
+// and validator.Validate instance. The allowed origins of the apps are kept by the OriginService. The
+// display metadata and group summary threshold of every app are cached for APP_CACHE_TTL_SECONDS.
+// If the validator instance is nil, an error is returned.
+func NewAppServiceImpl(appRepository appRepository.AppRepository, originService originService.OriginService, validate *validator.Validate) (service AppService, err error) {
+	if validate == nil {
+		return nil, apperrors.Internal("validator instance cannot be nil", nil)
+	}
+	return &AppServiceImpl{
+		AppRepository: appRepository,
+		OriginService: originService,
+		Validate:      validate,
+		cacheTTL:      time.Duration(config.LoadConfig().AppCacheTTLSeconds) * time.Second,
+	}, err
+}
+
+// FindAll returns every registered app with its allowed origins.
+func (t *AppServiceImpl) FindAll() ([]data.App, error) {
+	apps, err := t.AppRepository.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	allowLists, err := t.OriginService.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	origins := make(map[string][]string, len(allowLists))
+	for _, allowList := range allowLists {
+		origins[allowList.AppId] = allowList.Origins
+	}
+	result := make([]data.App, 0, len(apps))
+	for _, app := range apps {
+		result = append(result, toApp(app, origins[app.AppId]))
+	}
+	return result, nil
+}
+
+// FindByAppId returns the registered app with the given appId and its allowed origins, or a not found error
+// if the app is not registered.
+func (t *AppServiceImpl) FindByAppId(appId string) (data.App, error) {
+	app, err := t.AppRepository.FindByAppId(appId)
+	if err != nil {
+		return data.App{}, err
+	}
+	allowList, err := t.OriginService.FindByAppId(appId)
+	if err != nil && !apperrors.Is(err, apperrors.KindNotFound) {
+		return data.App{}, err
+	}
+	return toApp(app, allowList.Origins), nil
+}
+
+// Upsert registers the app with the given appId or replaces its metadata. When the request lists allowed
+// origins, they replace the origin allow-list of the app first, so invalid origins leave the app unchanged.
+// The cached catalog of this instance is dropped, other instances pick up the change when their cache expires.
+func (t *AppServiceImpl) Upsert(appId string, request data.UpsertAppRequest) (data.App, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "App Service",
+		Operation: "Upsert",
+		Message:   "Saving app for appId: " + appId,
+		AppId:     appId,
+	})
+	request.DisplayName = strings.TrimSpace(request.DisplayName)
+	if err := t.Validate.Struct(request); err != nil {
+		return data.App{}, apperrors.Validation("invalid app", err)
+	}
+	if request.AllowedOrigins != nil {
+		if _, err := t.OriginService.Update(appId, data.UpdateAppOriginsRequest{Origins: *request.AllowedOrigins}); err != nil {
+			return data.App{}, err
+		}
+	}
+	now := time.Now()
+	app := models.App{
+		AppId:                 appId,
+		DisplayName:           request.DisplayName,
+		IconUrl:               request.IconUrl,
+		OwnerTeam:             request.OwnerTeam,
+		GroupSummaryThreshold: request.GroupSummaryThreshold,
+		CreatedAt:             now,
+		UpdatedAt:             now,
+	}
+	if err := t.AppRepository.Upsert(app); err != nil {
+		return data.App{}, err
+	}
+	t.invalidate()
+	return t.FindByAppId(appId)
+}
+
+// Delete removes the app with the given appId from the registry together with its origin allow-list, so
+// its connections are only accepted from ALLOWED_ORIGINS. It returns a not found error if the app is not
+// registered.
+func (t *AppServiceImpl) Delete(appId string) error {
+	if err := t.AppRepository.Delete(appId); err != nil {
+		return err
+	}
+	t.invalidate()
+	if err := t.OriginService.Delete(appId); err != nil && !apperrors.Is(err, apperrors.KindNotFound) {
+		return err
+	}
+	return nil
+}
+
+// AppInfo returns the display metadata of the app with the given appId, or false if the app is not
+// registered. The catalog of every app is served from the cache while it is fresh. When it cannot be read,
+// the expired catalog is used if there is one, otherwise no app is known.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *AppServiceImpl) AppInfo(appId string) (data.AppInfo, bool) {
+	entry, ok := t.lookup()[appId]
+	return entry.info, ok
+}
+
+// GroupSummaryThreshold returns the group summary threshold of the app with the given appId, or false if the
+// app is not registered or does not override GROUP_SUMMARY_THRESHOLD. It is served from the same cached
+// catalog as AppInfo.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *AppServiceImpl) GroupSummaryThreshold(appId string) (int, bool) {
+	entry, ok := t.lookup()[appId]
+	if !ok || entry.groupSummaryThreshold == nil {
+		return 0, false
+	}
+	return *entry.groupSummaryThreshold, true
+}
+
+// lookup returns the catalog of the registered apps, reading it from the database when it is not cached or
+// has expired. Concurrent callers wait for a single read.
+func (t *AppServiceImpl) lookup() map[string]catalogEntry {
+	if catalog, fresh := t.cached(); fresh {
+		metrics.Inc("apps.cache.hits")
+		return catalog
+	}
+	t.refreshMutex.Lock()
+	defer t.refreshMutex.Unlock()
+	catalog, fresh := t.cached()
+	if fresh {
+		metrics.Inc("apps.cache.hits")
+		return catalog
+	}
+	metrics.Inc("apps.cache.misses")
+
+	apps, err := t.AppRepository.FindAll()
+	if err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "App Service",
+			Operation: "AppInfo",
+			Message:   "Failed to read the app registry, using the cached catalog if any",
+			Error:     err,
+		})
+		return catalog
+	}
+	catalog = make(map[string]catalogEntry, len(apps))
+	for _, app := range apps {
+		catalog[app.AppId] = catalogEntry{
+			info:                  data.AppInfo{DisplayName: app.DisplayName, IconUrl: app.IconUrl},
+			groupSummaryThreshold: app.GroupSummaryThreshold,
+		}
+	}
+	t.cacheMutex.Lock()
+	t.catalog, t.loadedAt = catalog, time.Now()
+	t.cacheMutex.Unlock()
+	return catalog
+}
+
+// cached returns the cached catalog and whether it is still fresh.
+func (t *AppServiceImpl) cached() (map[string]catalogEntry, bool) {
+	t.cacheMutex.RLock()
+	defer t.cacheMutex.RUnlock()
+	return t.catalog, t.catalog != nil && time.Since(t.loadedAt) < t.cacheTTL
+}
+
+// invalidate expires the cached catalog, keeping it in case the database cannot be read.
+func (t *AppServiceImpl) invalidate() {
+	t.cacheMutex.Lock()
+	t.loadedAt = time.Time{}
+	t.cacheMutex.Unlock()
+}
+
+// toApp converts an app model and its allowed origins into its data.App representation.
+func toApp(value models.App, origins []string) data.App {
+	if origins == nil {
+		origins = []string{}
+	}
+	return data.App{
+		AppId:                 value.AppId,
+		DisplayName:           value.DisplayName,
+		IconUrl:               value.IconUrl,
+		OwnerTeam:             value.OwnerTeam,
+		AllowedOrigins:        origins,
+		GroupSummaryThreshold: value.GroupSummaryThreshold,
+		CreatedAt:             value.CreatedAt,
+		UpdatedAt:             value.UpdatedAt,
+	}
+}
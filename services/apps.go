@@ -0,0 +1,75 @@
+package clientStore
+
+import (
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+)
+
+// AppDirectory looks up the display metadata and settings of the apps of the app registry.
+// Implementations must be safe for concurrent use by multiple goroutines.
+type AppDirectory interface {
+	// AppInfo returns the display metadata of the app, or false if the app is not registered.
+	AppInfo(appId string) (data.AppInfo, bool)
+	// GroupSummaryThreshold returns the group summary threshold of the app, or false if the app is not
+	// registered or does not set one.
+	GroupSummaryThreshold(appId string) (int, bool)
+}
+
+// withAppInfo sets the display metadata of registered apps on frames carrying notifications or digests, so
+// clients do not need their own app catalog. Other frames, and all frames of a store without an app directory,
+// are returned unchanged.
+func (t *ClientStore) withAppInfo(payload interface{}) interface{} {
+	if t.apps == nil {
+		return payload
+	}
+	lookup := func(appId string) *data.AppInfo {
+		if info, ok := t.apps.AppInfo(appId); ok {
+			return &info
+		}
+		return nil
+	}
+	enrich := func(notifications []data.Notification) []data.Notification {
+		enriched := make([]data.Notification, len(notifications))
+		for i, notification := range notifications {
+			notification.App = lookup(notification.AppId)
+			enriched[i] = notification
+		}
+		return enriched
+	}
+	switch value := payload.(type) {
+	case data.EventNotification:
+		value.Data.App = lookup(value.Data.AppId)
+		return value
+	case data.NotificationList:
+		value.Data = enrich(value.Data)
+		return value
+	case data.NotificationsResumed:
+		value.Data.Notifications = enrich(value.Data.Notifications)
+		return value
+	case data.NotificationSearchResult:
+		value.Data.Items = enrich(value.Data.Items)
+		return value
+	case data.NotificationsSince:
+		value.Data.Notifications = enrich(value.Data.Notifications)
+		return value
+	case data.DigestNotification:
+		value.Data.App = lookup(value.Data.AppId)
+		return value
+	case data.GroupSummaryNotification:
+		value.Data.App = lookup(value.Data.AppId)
+		return value
+	}
+	return payload
+}
+
+// GroupSummaryThreshold returns the number of unread notifications of a group of the given app from which a
+// groupSummary is sent instead of each new notification: the threshold set for the app in the app registry,
+// otherwise GROUP_SUMMARY_THRESHOLD. Zero disables group summaries.
+func (t *ClientStore) GroupSummaryThreshold(appId string) int {
+	if t.apps != nil {
+		if threshold, ok := t.apps.GroupSummaryThreshold(appId); ok {
+			return threshold
+		}
+	}
+	return config.LoadConfig().GroupSummaryThreshold
+}
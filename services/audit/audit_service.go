@@ -0,0 +1,13 @@
+package auditService
+
+import (
+	"context"
+	"r2-notify-server/data"
+	"r2-notify-server/models"
+)
+
+type AuditService interface {
+	Record(entry models.AuditEntry)
+	RecordWithin(ctx context.Context, entry models.AuditEntry) error
+	Find(query data.AuditLogQuery) ([]data.AuditEntry, error)
+}
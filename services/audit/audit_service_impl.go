@@ -0,0 +1,94 @@
+package auditService
+
+import (
+	"context"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	auditRepository "r2-notify-server/repository/audit"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type AuditServiceImpl struct {
+	AuditRepository auditRepository.AuditRepository
+	Validate        *validator.Validate
+}
+
+// NewAuditServiceImpl returns a new instance of AuditService with the provided AuditRepository
+// and validator.Validate instance. If the validator instance is nil, an error is returned.
+func NewAuditServiceImpl(auditRepository auditRepository.AuditRepository, validate *validator.Validate) (service AuditService, err error) {
+	if validate == nil {
+		return nil, apperrors.Internal("validator instance cannot be nil", nil)
+	}
+	return &AuditServiceImpl{
+		AuditRepository: auditRepository,
+		Validate:        validate,
+	}, err
+}
+
+// Record stores the audit entry, stamping its creation time. A failure to store the entry is
+// logged and does not fail the audited operation.
+func (t *AuditServiceImpl) Record(entry models.AuditEntry) {
+	entry.CreatedAt = time.Now()
+	if err := t.AuditRepository.Create(context.Background(), entry); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "Audit Service",
+			Operation:     "Record",
+			Message:       "Failed to record audit entry for event: " + entry.Event,
+			Error:         err,
+			UserId:        entry.UserId,
+			AppId:         entry.AppId,
+			CorrelationId: entry.CorrelationId,
+		})
+	}
+}
+
+// RecordWithin stores the audit entry like Record, within the transaction of the context, so the entry is only
+// kept if the audited changes are committed. A failure to store the entry is returned, so the transaction is
+// aborted instead of committing changes that were not audited.
+func (t *AuditServiceImpl) RecordWithin(ctx context.Context, entry models.AuditEntry) error {
+	entry.CreatedAt = time.Now()
+	return t.AuditRepository.Create(ctx, entry)
+}
+
+// Find returns the audit entries of a user, newest first, optionally bounded by a time range.
+// A zero limit defaults to data.DEFAULT_AUDIT_LIMIT. If the query is invalid or the lookup fails,
+// the error is returned.
+func (t *AuditServiceImpl) Find(query data.AuditLogQuery) ([]data.AuditEntry, error) {
+	if err := t.Validate.Struct(query); err != nil {
+		return nil, apperrors.Validation("invalid audit log query", err)
+	}
+	if query.Limit == 0 {
+		query.Limit = data.DEFAULT_AUDIT_LIMIT
+	}
+	result, err := t.AuditRepository.Find(query)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Audit Service",
+			Operation: "Find",
+			Message:   "Failed to fetch audit entries for userId: " + query.UserId,
+			Error:     err,
+			UserId:    query.UserId,
+		})
+		return nil, err
+	}
+	entries := make([]data.AuditEntry, 0, len(result))
+	for _, entry := range result {
+		entries = append(entries, data.AuditEntry{
+			Id:             entry.Id.Hex(),
+			UserId:         entry.UserId,
+			Event:          entry.Event,
+			AppId:          entry.AppId,
+			GroupKey:       entry.GroupKey,
+			NotificationId: entry.NotificationId,
+			ActionId:       entry.ActionId,
+			CorrelationId:  entry.CorrelationId,
+			Affected:       entry.Affected,
+			CreatedAt:      entry.CreatedAt,
+		})
+	}
+	return entries, nil
+}
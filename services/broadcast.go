@@ -0,0 +1,98 @@
+package clientStore
+
+import (
+	"encoding/json"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+)
+
+// Broadcast sends a system announcement to every connection, including the connections held by other
+// instances. If the AppId of the announcement is set, only the connections opened for that app with the
+// appId query parameter receive it. Announcements are not notifications, so they bypass the notification
+// status check and mutes.
+// It returns the number of connections the announcement was queued on on this instance.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) Broadcast(payload data.SystemAnnouncement) (int, error) {
+	sent, err := t.broadcastToLocalConnections(payload)
+	if err != nil {
+		return 0, err
+	}
+	t.publishBroadcast(payload)
+	return sent, nil
+}
+
+// publishBroadcast shares a system announcement with the other instances on the read state channel.
+// Failures are logged; the connections to this instance have already received the announcement.
+func (t *ClientStore) publishBroadcast(payload data.SystemAnnouncement) {
+	body, err := json.Marshal(readStateMessage{InstanceId: instanceId, Broadcast: &payload})
+	if err == nil {
+		err = config.RDB.Publish(config.Ctx, readStateChannel, body).Err()
+	}
+	if err != nil {
+		metrics.Inc("broadcasts.publish.failed")
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "PublishBroadcast",
+			Message:   "Failed to publish announcement " + payload.Data.Id + " to the other instances",
+			Error:     err,
+			AppId:     payload.Data.AppId,
+		})
+	}
+}
+
+// broadcastToLocalConnections sends a system announcement to the matching connections on this instance.
+// The announcement is encoded once per negotiated format and envelope version. It returns the number of
+// connections the announcement was queued on.
+func (t *ClientStore) broadcastToLocalConnections(payload data.SystemAnnouncement) (int, error) {
+	encoded := make(map[Encoder][]byte)
+	sent := 0
+	for userId, conns := range t.registry.All() {
+		for _, registered := range conns {
+			if payload.Data.AppId != "" && registered.Device.AppId != payload.Data.AppId {
+				continue
+			}
+			encoder := registered.Encoder
+			if encoder == nil {
+				encoder = JSONEncoder
+			}
+			frame, ok := encoded[encoder]
+			if !ok {
+				var err error
+				frame, err = encoder.Marshal(payload)
+				if err != nil {
+					logger.Log.Error(logger.LogPayload{
+						Component: "Client Store",
+						Operation: "Broadcast",
+						Message:   "Failed to marshal " + encoder.Format() + " announcement " + payload.Data.Id,
+						Error:     err,
+					})
+					return sent, apperrors.Internal("failed to encode payload", err)
+				}
+				encoded[encoder] = frame
+			}
+			if err := writeToConnection(registered, priorityHigh, encoder.MessageType(), frame); err != nil {
+				logger.Log.Warn(logger.LogPayload{
+					Component: "Client Store",
+					Operation: "Broadcast",
+					Message:   "Failed to write announcement to connection for userId: " + userId,
+					Error:     err,
+					UserId:    userId,
+				})
+				continue
+			}
+			sent++
+		}
+	}
+	metrics.Add("broadcasts.delivered", int64(sent))
+	logger.Log.Info(logger.LogPayload{
+		Component: "Client Store",
+		Operation: "Broadcast",
+		Message:   fmt.Sprintf("Sent announcement %s to %d connections", payload.Data.Id, sent),
+		AppId:     payload.Data.AppId,
+	})
+	return sent, nil
+}
@@ -0,0 +1,9 @@
+package broadcastService
+
+import (
+	"r2-notify-server/data"
+)
+
+type BroadcastService interface {
+	Broadcast(request data.BroadcastRequest, correlationId string) (data.BroadcastReport, error)
+}
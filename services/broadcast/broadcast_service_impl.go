@@ -0,0 +1,108 @@
+package broadcastService
+
+import (
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	clientStore "r2-notify-server/services"
+	auditService "r2-notify-server/services/audit"
+	"r2-notify-server/utils"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Redis key claimed by each broadcast for BROADCAST_MIN_INTERVAL_SECONDS, shared by all instances.
+const rateLimitKey = "broadcast:rateLimit"
+
+type BroadcastServiceImpl struct {
+	AuditService auditService.AuditService
+	ClientStore  *clientStore.ClientStore
+	Validate     *validator.Validate
+}
+
+// NewBroadcastServiceImpl returns a new instance of BroadcastService with the AuditService recording broadcasts,
+// the ClientStore sending them to the connections of this instance and the validator checking the requests.
+func NewBroadcastServiceImpl(auditService auditService.AuditService, clients *clientStore.ClientStore, validate *validator.Validate) BroadcastService {
+	return &BroadcastServiceImpl{
+		AuditService: auditService,
+		ClientStore:  clients,
+		Validate:     validate,
+	}
+}
+
+// Broadcast sends a system announcement to every connected client, or only to the clients connected for the
+// appId of the request, on every instance. To protect clients from floods, a single broadcast is accepted per
+// BROADCAST_MIN_INTERVAL_SECONDS across all instances; broadcasts sent sooner are refused with a RateLimited error.
+// The broadcast is recorded in the audit log under the user data.BROADCAST_AUDIT_USER.
+func (t *BroadcastServiceImpl) Broadcast(request data.BroadcastRequest, correlationId string) (data.BroadcastReport, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "Broadcast Service",
+		Operation:     "Broadcast",
+		Message:       "Broadcasting announcement to appId: " + request.AppId,
+		AppId:         request.AppId,
+		CorrelationId: correlationId,
+	})
+	if err := t.Validate.Struct(request); err != nil {
+		return data.BroadcastReport{}, apperrors.Validation("invalid broadcast request", err)
+	}
+	if request.Level == "" {
+		request.Level = data.ANNOUNCEMENT_INFO
+	}
+
+	announcement := data.Announcement{
+		Id:      utils.GenerateUUID(),
+		Title:   request.Title,
+		Message: request.Message,
+		Level:   request.Level,
+		AppId:   request.AppId,
+		SentAt:  time.Now(),
+	}
+	if interval := time.Duration(config.LoadConfig().BroadcastMinIntervalSeconds) * time.Second; interval > 0 && !claimBroadcast(announcement.Id, interval, correlationId) {
+		metrics.Inc("broadcasts.rate_limited")
+		logger.Log.Warn(logger.LogPayload{
+			Component:     "Broadcast Service",
+			Operation:     "Broadcast",
+			Message:       "Refused broadcast sent within BROADCAST_MIN_INTERVAL_SECONDS of the previous one",
+			AppId:         request.AppId,
+			CorrelationId: correlationId,
+		})
+		return data.BroadcastReport{}, apperrors.RateLimited("a broadcast was sent recently, try again later")
+	}
+
+	connections, err := t.ClientStore.Broadcast(data.SystemAnnouncement{Event: data.Event{Event: data.SYSTEM_ANNOUNCEMENT}, Data: announcement})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "Broadcast Service",
+			Operation:     "Broadcast",
+			Message:       "Failed to broadcast announcement " + announcement.Id,
+			Error:         err,
+			AppId:         request.AppId,
+			CorrelationId: correlationId,
+		})
+		return data.BroadcastReport{}, err
+	}
+	metrics.Inc("broadcasts.sent")
+	t.AuditService.Record(models.AuditEntry{Event: data.BROADCAST, UserId: data.BROADCAST_AUDIT_USER, AppId: request.AppId, CorrelationId: correlationId, Affected: int64(connections)})
+	return data.BroadcastReport{Id: announcement.Id, AppId: announcement.AppId, Connections: connections, SentAt: announcement.SentAt}, nil
+}
+
+// claimBroadcast claims the broadcast rate limit for the given interval and reports whether it was claimed.
+// The rate limit fails open: if Redis is unavailable, the broadcast is let through.
+func claimBroadcast(id string, interval time.Duration, correlationId string) bool {
+	claimed, err := config.RDB.SetNX(config.Ctx, rateLimitKey, id, interval).Result()
+	if err == nil {
+		return claimed
+	}
+	logger.Log.Warn(logger.LogPayload{
+		Component:     "Broadcast Service",
+		Operation:     "Broadcast",
+		Message:       "Failed to check the broadcast rate limit, sending announcement " + id,
+		Error:         err,
+		CorrelationId: correlationId,
+	})
+	return true
+}
@@ -0,0 +1,64 @@
+package clientStore
+
+import (
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/metrics"
+)
+
+// chunkedListsFor reports whether notification lists are sent in chunks to the connection: the client opted in
+// with the chunkedLists handshake parameter and LIST_CHUNK_SIZE is greater than 0.
+func chunkedListsFor(state ConnectionState) bool {
+	return state.Device.ChunkedLists && config.LoadConfig().ListChunkSize > 0
+}
+
+// framesFor returns the frames a payload is sent in to a connection. Notification lists are split into parts of
+// LIST_CHUNK_SIZE notifications followed by a summary if chunked is true, even if they fit in a single part, so
+// clients opting in always receive the same sequence. Other payloads are sent in a single frame.
+func framesFor(payload interface{}, chunked bool) []interface{} {
+	list, ok := payload.(data.NotificationList)
+	if !ok || !chunked {
+		return []interface{}{payload}
+	}
+	size := config.LoadConfig().ListChunkSize
+	totalParts := max((len(list.Data)+size-1)/size, 1)
+	frames := make([]interface{}, 0, totalParts+1)
+	for part := 1; part <= totalParts; part++ {
+		chunk := list
+		chunk.Data = list.Data[(part-1)*size : min(part*size, len(list.Data))]
+		complete := part == totalParts
+		chunk.Part, chunk.TotalParts, chunk.Complete = part, totalParts, &complete
+		frames = append(frames, chunk)
+	}
+	return append(frames, data.NotificationListSummary{
+		Event: data.Event{Event: data.LIST_NOTIFICATIONS_SUMMARY},
+		Data:  data.ListSummary{Total: len(list.Data), TotalParts: totalParts},
+	})
+}
+
+// encodeFrames encodes each frame with the encoder.
+func encodeFrames(encoder Encoder, frames []interface{}) ([][]byte, error) {
+	encoded := make([][]byte, 0, len(frames))
+	for _, frame := range frames {
+		data, err := encoder.Marshal(frame)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, data)
+	}
+	return encoded, nil
+}
+
+// writeFrames queues the encoded frames on the tier of the given priority of the connection in order, stopping
+// at the first that cannot be written. Lists sent in more than one frame are counted in notifications.list.chunked.
+func writeFrames(registered RegisteredConnection, encoder Encoder, frames [][]byte, priority framePriority) error {
+	for _, frame := range frames {
+		if err := writeToConnection(registered, priority, encoder.MessageType(), frame); err != nil {
+			return err
+		}
+	}
+	if len(frames) > 1 {
+		metrics.Inc("notifications.list.chunked")
+	}
+	return nil
+}
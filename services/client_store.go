@@ -2,47 +2,82 @@ package clientStore
 
 import (
 	"encoding/json"
-	"errors"
+	"r2-notify-server/apperrors"
 	"r2-notify-server/config"
 	"r2-notify-server/data"
 	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
 	"r2-notify-server/models"
 	"sync"
-
-	"github.com/gorilla/websocket"
 )
 
-var (
-	clients      = make(map[string][]*websocket.Conn) // userID -> []connection
-	clientsMutex sync.RWMutex
-)
+// Connection is a client connection registered in the store. Both WebSocket connections and
+// Server-Sent Events streams implement it, so delivery logic is shared between transports.
+type Connection interface {
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// ClientStore delivers frames to the clients connected to this instance, whose connections it tracks in its
+// ClientRegistry, and keeps their client info in Redis. Frames carrying notifications are enriched with the
+// display metadata of their app from its AppDirectory. Both are given to NewClientStore, so handlers, services
+// and consumers can be built with a mock registry or another implementation.
+type ClientStore struct {
+	registry ClientRegistry
+	apps     AppDirectory
+}
+
+// NewClientStore returns a ClientStore tracking the connections of this instance in the given registry and
+// sending the display metadata of the apps in the given directory with their notifications. A nil directory
+// sends no app metadata and uses GROUP_SUMMARY_THRESHOLD for every app.
+func NewClientStore(registry ClientRegistry, apps AppDirectory) *ClientStore {
+	return &ClientStore{registry: registry, apps: apps}
+}
+
+// membershipLocks serialize the registration and removal of the connections of a user with the client info
+// writes they cause, so the client info of a user connecting while their last connection is removed is kept.
+// Users are spread over the locks like over the shards of the registry, so the connections of different
+// users rarely wait for each other.
+var membershipLocks [registryShards]sync.Mutex
+
+// membershipLock returns the lock serializing the membership changes of the user.
+func membershipLock(userId string) *sync.Mutex {
+	return &membershipLocks[shardOf(userId, registryShards)]
+}
+
+// UserKey returns the key under which the connections and client info of a user of the given tenant are
+// stored. Users of the default tenant are keyed by their userId alone, users of other tenants by
+// "tenantId/userId", so payloads routed by key never reach a connection of another tenant.
+// Tenant IDs cannot contain a slash, which keeps the keys of different tenants apart.
+func UserKey(tenantId string, userId string) string {
+	if tenantId == "" {
+		return userId
+	}
+	return tenantId + "/" + userId
+}
 
 // StoreClient adds a new connection to the list of connections for the given user
 // and stores the updated models.ClientInfo struct in Redis.
+// Payloads sent to the connection are serialized with the given encoder, and the device metadata
+// captured at handshake time is added to the devices hash of the user, listed by ConnectedDevices.
+// If Redis is unavailable, the client info is kept in memory and the write is retried later.
 // It is safe to call this function concurrently from multiple goroutines.
-func StoreClient(info models.ClientInfo, conn *websocket.Conn) error {
+func (t *ClientStore) StoreClient(info models.ClientInfo, conn Connection, encoder Encoder, device models.DeviceInfo) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Client Store",
 		Operation: "StoreClient",
 		Message:   "Storing client in memory for clientID: " + info.ID,
 		UserId:    info.ID,
 	})
-	clientsMutex.Lock()
-	clients[info.ID] = append(clients[info.ID], conn)
-	clientsMutex.Unlock()
-	// Marshal and store the updated ClientInfo struct in Redis
-	data, _ := json.Marshal(info)
-	err := config.RDB.Set(config.Ctx, "client:"+info.ID, data, 0).Err()
-	if err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component: "Client Store",
-			Operation: "StoreClient",
-			Message:   "Failed to store client in Redis for clientID: " + info.ID,
-			Error:     err,
-			UserId:    info.ID,
-		})
-		return err
-	}
+	lock := membershipLock(info.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	// The heartbeat is written before the connection is registered, so the sweeper never sees it without one
+	writeConnection(info.ID, device, heartbeatTTL())
+	t.registry.Add(info.ID, conn, ConnectionState{Encoder: encoder, Device: device, queue: newSendQueue(info.ID, conn)})
+	TouchConnection(conn)
+	// Cache and store the updated ClientInfo struct in Redis
+	storeClientInfo("StoreClient", info)
 	logger.Log.Info(logger.LogPayload{
 		Component: "Client Store",
 		Operation: "StoreClient",
@@ -52,29 +87,22 @@ func StoreClient(info models.ClientInfo, conn *websocket.Conn) error {
 	return nil
 }
 
-// DeleteClient removes the client with the given ID from the in-memory map and from Redis, where the client's info is stored.
+// DeleteClient removes the connections of the client with the given ID from the registry and the client info from Redis.
 // It is safe to call this function concurrently from multiple goroutines.
-func DeleteClient(id string) error {
+func (t *ClientStore) DeleteClient(id string) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Client Store",
 		Operation: "DeleteClient",
 		Message:   "Deleting client for clientID: " + id,
 		UserId:    id,
 	})
-	clientsMutex.Lock()
-	delete(clients, id)
-	clientsMutex.Unlock()
-	err := config.RDB.Del(config.Ctx, "client:"+id).Err()
-	if err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component: "Client Store",
-			Operation: "DeleteClient",
-			Message:   "Failed to delete client from Redis for clientID: " + id,
-			Error:     err,
-			UserId:    id,
-		})
-		return err
+	lock := membershipLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	for _, registered := range t.registry.RemoveUser(id) {
+		releaseConnection(id, registered)
 	}
+	deleteClientInfo("DeleteClient", id)
 	logger.Log.Info(logger.LogPayload{
 		Component: "Client Store",
 		Operation: "DeleteClient",
@@ -85,41 +113,34 @@ func DeleteClient(id string) error {
 }
 
 // RemoveConnection removes a single connection from the list of connections for the given user.
-// If the last connection is removed, it also removes the user from the in-memory map and from Redis.
+// If the last connection is removed, it also removes the client info of the user from Redis.
 // It is safe to call this function concurrently from multiple goroutines.
-func RemoveConnection(userId string, conn *websocket.Conn) {
+func (t *ClientStore) RemoveConnection(userId string, conn Connection) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Client Store",
 		Operation: "RemoveConnection",
 		Message:   "Removing connection for userId: " + userId,
 		UserId:    userId,
 	})
-	clientsMutex.Lock()
-	defer clientsMutex.Unlock()
+	lock := membershipLock(userId)
+	lock.Lock()
+	defer lock.Unlock()
 
-	conns, exists := clients[userId]
+	state, remaining, exists := t.registry.Remove(userId, conn)
 	if !exists {
-		logger.Log.Warn(logger.LogPayload{
+		logger.Log.Debug(logger.LogPayload{
 			Component: "Client Store",
 			Operation: "RemoveConnection",
-			Message:   "User not found in clients map for userId: " + userId,
+			Message:   "Connection already removed for userId: " + userId,
 			UserId:    userId,
 		})
 		return
 	}
+	releaseConnection(userId, RegisteredConnection{Conn: conn, ConnectionState: state})
 
-	// Filter out the closing connection
-	remaining := conns[:0]
-	for _, c := range conns {
-		if c != conn {
-			remaining = append(remaining, c)
-		}
-	}
-
-	if len(remaining) == 0 {
+	if remaining == 0 {
 		// No connections left, clean up completely
-		delete(clients, userId)
-		_ = config.RDB.Del(config.Ctx, "client:"+userId).Err()
+		deleteClientInfo("RemoveConnection", userId)
 		logger.Log.Info(logger.LogPayload{
 			Component: "Client Store",
 			Operation: "RemoveConnection",
@@ -127,7 +148,6 @@ func RemoveConnection(userId string, conn *websocket.Conn) {
 			UserId:    userId,
 		})
 	} else {
-		clients[userId] = remaining
 		logger.Log.Debug(logger.LogPayload{
 			Component: "Client Store",
 			Operation: "RemoveConnection",
@@ -137,7 +157,14 @@ func RemoveConnection(userId string, conn *websocket.Conn) {
 	}
 }
 
+// IsConnected reports whether the given user has at least one active connection on this instance.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) IsConnected(userId string) bool {
+	return len(t.registry.Connections(userId)) > 0
+}
+
 // GetClientInfo fetches the client information from Redis by the given user ID.
+// If Redis is unavailable, the latest client information known to this instance is returned instead.
 // It returns the models.ClientInfo struct and an error if the client does not exist.
 // It is safe to call this function concurrently from multiple goroutines.
 func GetClientInfo(id string) (models.ClientInfo, error) {
@@ -149,6 +176,11 @@ func GetClientInfo(id string) (models.ClientInfo, error) {
 	})
 	val, err := config.RDB.Get(config.Ctx, "client:"+id).Result()
 	if err != nil {
+		markDegraded("GetClientInfo", err)
+		if cached, ok := cachedClientInfoFor(id); ok {
+			metrics.Inc("redis.reads.cached")
+			return cached, nil
+		}
 		logger.Log.Error(logger.LogPayload{
 			Component: "Client Store",
 			Operation: "GetClientInfo",
@@ -156,7 +188,7 @@ func GetClientInfo(id string) (models.ClientInfo, error) {
 			Error:     err,
 			UserId:    id,
 		})
-		return models.ClientInfo{}, err
+		return models.ClientInfo{}, apperrors.DependencyUnavailable("failed to fetch client info", err)
 	}
 	var clientInfo models.ClientInfo
 	if err := json.Unmarshal([]byte(val), &clientInfo); err != nil {
@@ -167,8 +199,9 @@ func GetClientInfo(id string) (models.ClientInfo, error) {
 			Error:     err,
 			UserId:    id,
 		})
-		return models.ClientInfo{}, err
+		return models.ClientInfo{}, apperrors.Internal("failed to decode client info", err)
 	}
+	cacheClientInfo(clientInfo)
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Client Store",
 		Operation: "GetClientInfo",
@@ -180,7 +213,7 @@ func GetClientInfo(id string) (models.ClientInfo, error) {
 
 // UpdateClientInfo updates the client information stored in Redis for the given ClientInfo.
 // It serializes the ClientInfo struct to JSON and stores it under the key "client:<ID>".
-// Returns an error if the operation fails.
+// If Redis is unavailable, the client info is kept in memory and the write is retried later.
 func UpdateClientInfo(info models.ClientInfo) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Client Store",
@@ -188,18 +221,7 @@ func UpdateClientInfo(info models.ClientInfo) error {
 		Message:   "Updating client info for clientID: " + info.ID,
 		UserId:    info.ID,
 	})
-	data, _ := json.Marshal(info)
-	err := config.RDB.Set(config.Ctx, "client:"+info.ID, data, 0).Err()
-	if err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component: "Client Store",
-			Operation: "UpdateClientInfo",
-			Message:   "Failed to update client info in Redis for clientID: " + info.ID,
-			Error:     err,
-			UserId:    info.ID,
-		})
-		return err
-	}
+	storeClientInfo("UpdateClientInfo", info)
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Client Store",
 		Operation: "UpdateClientInfo",
@@ -212,18 +234,63 @@ func UpdateClientInfo(info models.ClientInfo) error {
 // SendNotificationToUser sends a notification to a user identified by the UserID field in the given
 // data.ActionNotification struct. It does not bypass the notification check, meaning the user's
 // notification status will be checked before sending the notification. If the user has disabled
-// If bypassStatusCheck is true, it will skip the notification status check.
 // notifications, the function will return an error.
-func SendNotificationToUser(payload data.EventNotification, bypassStatusCheck bool) error {
-	return sendToUser(payload.Data.UserID, payload, bypassStatusCheck)
+// If bypassStatusCheck is true, it will skip the notification status check.
+// If the user receives the notification's app as a digest, the notification is queued for the
+// next digestNotification instead of being sent immediately. Notifications of a group muted by the
+// user are not sent, ErrMuted is returned instead.
+// It returns the outcome of the delivery, one of data.DELIVERY_*, and for notifications that were not
+// delivered the error explaining why.
+func (t *ClientStore) SendNotificationToUser(payload data.EventNotification, bypassStatusCheck bool) (string, error) {
+	if status, held, err := t.holdNotification(payload.Data); held {
+		return status, err
+	}
+	if err := t.sendToUser(UserKey(payload.Data.TenantId, payload.Data.UserID), payload, bypassStatusCheck); err != nil {
+		return data.DELIVERY_PERSISTED, err
+	}
+	return data.DELIVERY_DELIVERED, nil
+}
+
+// SendGroupSummaryToUser sends a groupSummary in place of the notification of the given payload, whose group
+// has reached the group summary threshold of its app. Like the notification, the summary respects the
+// notification status check, and a notification muted or received as a digest by the user is held back the
+// same way instead. It returns the outcome of the delivery of the notification, one of data.DELIVERY_*,
+// and for notifications that were not delivered the error explaining why.
+func (t *ClientStore) SendGroupSummaryToUser(payload data.EventNotification, summary data.GroupSummary) (string, error) {
+	if status, held, err := t.holdNotification(payload.Data); held {
+		return status, err
+	}
+	frame := data.GroupSummaryNotification{
+		Event: data.Event{Event: data.GROUP_SUMMARY},
+		Data:  summary,
+	}
+	if err := t.sendToUser(UserKey(payload.Data.TenantId, payload.Data.UserID), frame, false); err != nil {
+		return data.DELIVERY_PERSISTED, err
+	}
+	metrics.Inc("notifications.group_summaries.sent")
+	return data.DELIVERY_DELIVERED, nil
+}
+
+// holdNotification holds back a notification of a group muted by the user, returning ErrMuted, or queues it
+// for the next digestNotification if the user receives its app as a digest. It returns the outcome of the
+// delivery, whether the notification was held back and the error explaining why.
+func (t *ClientStore) holdNotification(notification data.Notification) (string, bool, error) {
+	if t.mutedForUser(notification) {
+		return data.DELIVERY_PERSISTED, true, ErrMuted
+	}
+	if window, ok := t.digestWindow(UserKey(notification.TenantId, notification.UserID), notification.AppId); ok {
+		queueDigest(notification, window)
+		return data.DELIVERY_QUEUED, true, nil
+	}
+	return "", false, nil
 }
 
 // SendConfigurationToUser sends the user configuration to the user identified by the UserIdD field
 // in the given data.Configuration struct. If bypassNotificationCheck is true, the function will not
 // check the user's notification status before sending the configuration. Otherwise, it will check
 // the user's notification status and return an error if notifications are disabled.
-func SendConfigurationToUser(payload data.Configuration, bypassNotificationCheck bool) error {
-	return sendToUser(payload.Data.UserID, payload, bypassNotificationCheck)
+func (t *ClientStore) SendConfigurationToUser(payload data.Configuration, bypassNotificationCheck bool) error {
+	return t.sendToUser(UserKey(payload.Data.TenantId, payload.Data.UserID), payload, bypassNotificationCheck)
 }
 
 // SendNotificationListToUser sends a list of notifications to a user identified by the given userID.
@@ -231,17 +298,64 @@ func SendConfigurationToUser(payload data.Configuration, bypassNotificationCheck
 // The function will check the user's notification status before sending.
 // If bypassStatusCheck is true, it will skip the notification status check.
 // Returns an error if the user is not connected or if notifications are disabled.
-func SendNotificationListToUser(userID string, notifications data.NotificationList, bypassStatusCheck bool) error {
-	return sendToUser(userID, notifications, bypassStatusCheck)
+func (t *ClientStore) SendNotificationListToUser(userID string, notifications data.NotificationList, bypassStatusCheck bool) error {
+	return t.sendToUser(userID, notifications, bypassStatusCheck)
 }
 
-// getConnAndInfo retrieves the websocket connections and the client information for the given user ID.
+// SendNotificationListToConnection sends a list of notifications to a single connection of the user identified by
+// the given userID, for lists that only concern that connection, like the initial list filtered by the handshake
+// parameters of the connection. If bypassStatusCheck is true, it will skip the notification status check.
+// The list is sent in chunks if the connection opted into chunked lists.
+// Returns an error if the connection is no longer registered, notifications are disabled or encoding the payload fails.
+func (t *ClientStore) SendNotificationListToConnection(userID string, conn Connection, notifications data.NotificationList, bypassStatusCheck bool) error {
+	return t.sendToConnection(userID, conn, notifications, bypassStatusCheck)
+}
+
+// SendSearchResultsToConnection sends a page of notification search results to the connection of the user
+// identified by the given userID that searched. Search results are an explicit response to a user request, so
+// the notification status check is bypassed. Returns an error if the connection is no longer registered.
+func (t *ClientStore) SendSearchResultsToConnection(userID string, conn Connection, results data.NotificationSearchResult) error {
+	return t.sendToConnection(userID, conn, results, true)
+}
+
+// SendNotificationsSinceToConnection sends a page of the notifications changed since a client's local cache to
+// the connection of the user identified by the given userID that asked for it. The page is an explicit response
+// to a user request, so the notification status check is bypassed. Returns an error if the connection is no
+// longer registered.
+func (t *ClientStore) SendNotificationsSinceToConnection(userID string, conn Connection, payload data.NotificationsSince) error {
+	return t.sendToConnection(userID, conn, payload, true)
+}
+
+// SendSequenceResyncToConnection sends a page of the notifications numbered after a sequence number to the
+// connection of the user identified by the given userID that asked for it. The page is an explicit response to
+// a user request, so the notification status check is bypassed. Returns an error if the connection is no
+// longer registered.
+func (t *ClientStore) SendSequenceResyncToConnection(userID string, conn Connection, payload data.SequenceResync) error {
+	return t.sendToConnection(userID, conn, payload, true)
+}
+
+// SendHelloToConnection sends the protocol handshake response to the connection of the user identified by the
+// given userID that sent the hello event, since the negotiation only concerns that connection. The handshake is
+// an explicit response to a user request, so the notification status check is bypassed.
+// Returns an error if the connection is no longer registered.
+func (t *ClientStore) SendHelloToConnection(userID string, conn Connection, payload data.HelloResponse) error {
+	return t.sendToConnection(userID, conn, payload, true)
+}
+
+// SendErrorToConnection sends an error frame to the connection of the user identified by the given userID whose
+// event failed. Errors are an explicit response to a user request, so the notification status check is bypassed.
+// Returns an error if the connection is no longer registered.
+func (t *ClientStore) SendErrorToConnection(userID string, conn Connection, payload data.ErrorEvent) error {
+	return t.sendToConnection(userID, conn, payload, true)
+}
+
+// getConnAndInfo retrieves the connections and the client information for the given user ID.
 // If the user is not connected, it returns an error. Otherwise, it returns the connections and the client
 // information.
-func getConnAndInfo(userID string) ([]*websocket.Conn, *models.ClientInfo, error) {
-	conns, ok := clients[userID]
-	if !ok {
-		return nil, nil, errors.New("user not connected")
+func (t *ClientStore) getConnAndInfo(userID string) ([]RegisteredConnection, *models.ClientInfo, error) {
+	conns := t.registry.Connections(userID)
+	if len(conns) == 0 {
+		return nil, nil, apperrors.NotFound("user not connected")
 	}
 	clientInfo, err := GetClientInfo(userID)
 	if err != nil {
@@ -250,22 +364,59 @@ func getConnAndInfo(userID string) ([]*websocket.Conn, *models.ClientInfo, error
 	return conns, &clientInfo, nil
 }
 
-// sendToUser sends a payload to all active websocket connections for a specified user.
-// It locks the clients map for reading and retrieves the user's connections and client information.
+// sendToConnection sends a payload to a single connection of the user identified by the given userID, for
+// responses that only concern the connection that sent the request. It is enriched like the payloads of
+// sendToUser, encoded with the encoder negotiated by the connection and queued in the tier selected by priorityOf.
 // If notifications are disabled for the user and bypassNotificationCheck is false, it returns an error.
-// It serializes the payload to JSON and attempts to write it to each connection.
-// Connections that fail to receive the message are removed from the active list.
-// Returns an error if the user is not connected or if JSON marshalling fails.
-func sendToUser(userID string, payload interface{}, bypassNotificationCheck bool) error {
+// Returns an error if the connection is no longer registered or encoding the payload fails.
+func (t *ClientStore) sendToConnection(userID string, conn Connection, payload interface{}, bypassNotificationCheck bool) error {
+	state, ok := t.registry.Get(conn)
+	if !ok {
+		return apperrors.NotFound("connection not found")
+	}
+	clientInfo, err := GetClientInfo(userID)
+	if err != nil {
+		return err
+	}
+	if !bypassNotificationCheck && !clientInfo.EnableNotification {
+		return apperrors.Unauthorized("notifications are disabled for this user")
+	}
+	encoder := state.Encoder
+	if encoder == nil {
+		encoder = JSONEncoder
+	}
+	payload = t.withAppInfo(withMutedFlags(withResumeToken(payload), clientInfo))
+	frames, err := encodeFrames(encoder, framesFor(payload, chunkedListsFor(state)))
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "SendToConnection",
+			Message:   "Failed to marshal " + encoder.Format() + " payload for userId: " + userID,
+			Error:     err,
+			UserId:    userID,
+		})
+		return apperrors.Internal("failed to encode payload", err)
+	}
+	return writeFrames(RegisteredConnection{Conn: conn, ConnectionState: state}, encoder, frames, priorityOf(payload))
+}
+
+// sendToUser sends a payload to all active connections for a specified user.
+// It retrieves the user's connections from the registry and the client information.
+// If notifications are disabled for the user and bypassNotificationCheck is false, it returns an error.
+// It serializes the payload with the encoder negotiated by each connection and queues it on each connection's send queue,
+// in the tier selected by priorityOf.
+// Notification lists are sent in chunks to the connections that opted into chunked lists.
+// Connections that fail to receive the message, including slow consumers with a full send queue, are closed
+// and removed by their read loop.
+// Returns an error if the user is not connected, if encoding the payload fails or if no connection received it.
+func (t *ClientStore) sendToUser(userID string, payload interface{}, bypassNotificationCheck bool) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Client Store",
 		Operation: "SendToUser",
 		Message:   "Sending payload to userId: " + userID,
 		UserId:    userID,
 	})
-	clientsMutex.RLock()
-	defer clientsMutex.RUnlock()
-	conns, clientInfo, err := getConnAndInfo(userID)
+	conns, clientInfo, err := t.getConnAndInfo(userID)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Client Store",
@@ -277,7 +428,7 @@ func sendToUser(userID string, payload interface{}, bypassNotificationCheck bool
 		return err
 	}
 	if !bypassNotificationCheck && !clientInfo.EnableNotification {
-		notifyDisabledErr := errors.New("notifications are disabled for this user")
+		notifyDisabledErr := apperrors.Unauthorized("notifications are disabled for this user")
 		logger.Log.Warn(logger.LogPayload{
 			Component: "Client Store",
 			Operation: "SendToUser",
@@ -286,20 +437,38 @@ func sendToUser(userID string, payload interface{}, bypassNotificationCheck bool
 		})
 		return notifyDisabledErr
 	}
-	data, err := json.Marshal(payload)
-	if err != nil {
-		logger.Log.Error(logger.LogPayload{
-			Component: "Client Store",
-			Operation: "SendToUser",
-			Message:   "Failed to marshal payload for userId: " + userID,
-			Error:     err,
-			UserId:    userID,
-		})
-		return err
+	payload = t.withAppInfo(withMutedFlags(withResumeToken(payload), *clientInfo))
+	priority := priorityOf(payload)
+	// Encode the payload once per negotiated format, envelope version and chunking
+	type encoding struct {
+		encoder Encoder
+		chunked bool
 	}
-	var activeConns []*websocket.Conn
-	for _, conn := range conns {
-		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+	encoded := make(map[encoding][][]byte)
+	var written int
+	var writeErr error
+	for _, registered := range conns {
+		encoder := registered.Encoder
+		if encoder == nil {
+			encoder = JSONEncoder
+		}
+		key := encoding{encoder: encoder, chunked: chunkedListsFor(registered.ConnectionState)}
+		frames, ok := encoded[key]
+		if !ok {
+			frames, err = encodeFrames(encoder, framesFor(payload, key.chunked))
+			if err != nil {
+				logger.Log.Error(logger.LogPayload{
+					Component: "Client Store",
+					Operation: "SendToUser",
+					Message:   "Failed to marshal " + encoder.Format() + " payload for userId: " + userID,
+					Error:     err,
+					UserId:    userID,
+				})
+				return apperrors.Internal("failed to encode payload", err)
+			}
+			encoded[key] = frames
+		}
+		if err := writeFrames(registered, encoder, frames, priority); err != nil {
 			logger.Log.Warn(logger.LogPayload{
 				Component: "Client Store",
 				Operation: "SendToUser",
@@ -307,12 +476,14 @@ func sendToUser(userID string, payload interface{}, bypassNotificationCheck bool
 				Error:     err,
 				UserId:    userID,
 			})
+			writeErr = err
 			continue
 		}
-		activeConns = append(activeConns, conn)
+		written++
+	}
+	if written == 0 {
+		return apperrors.DependencyUnavailable("failed to write to the connections of the user", writeErr)
 	}
-	// Update with only active connections
-	clients[userID] = activeConns
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Client Store",
 		Operation: "SendToUser",
@@ -0,0 +1,119 @@
+package configurationService
+
+import (
+	"container/list"
+	"r2-notify-server/config"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"sync"
+	"time"
+)
+
+var (
+	cacheOnce sync.Once
+	cache     *configurationCache
+)
+
+// cachedConfiguration is the configuration of a user as last read from the database.
+type cachedConfiguration struct {
+	key           string
+	configuration models.Configuration
+	loadedAt      time.Time
+}
+
+// configurationCache holds the configurations of the most recently used users, up to a maximum number of
+// entries, for a limited time. The least recently used entry is evicted when the cache is full.
+type configurationCache struct {
+	size    int
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+}
+
+// sharedCache returns the configuration cache of the instance, sized with CONFIGURATION_CACHE_SIZE and
+// expiring entries after CONFIGURATION_CACHE_TTL_SECONDS. The cache is shared by the configuration
+// services of the instance, so the invalidations received from other instances reach all of them.
+func sharedCache() *configurationCache {
+	cacheOnce.Do(func() {
+		cfg := config.LoadConfig()
+		cache = newConfigurationCache(cfg.ConfigurationCacheSize, time.Duration(cfg.ConfigurationCacheTTLSeconds)*time.Second)
+	})
+	return cache
+}
+
+// newConfigurationCache returns an empty cache of the given size and TTL. A size or TTL of 0 disables the cache.
+func newConfigurationCache(size int, ttl time.Duration) *configurationCache {
+	return &configurationCache{size: size, ttl: ttl, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// enabled reports whether configurations are cached at all.
+func (c *configurationCache) enabled() bool {
+	return c.size > 0 && c.ttl > 0
+}
+
+// get returns the cached configuration of the user, unless it is missing or has expired.
+// It is safe to call this function concurrently from multiple goroutines.
+func (c *configurationCache) get(tenantId string, userId string) (models.Configuration, bool) {
+	if !c.enabled() {
+		return models.Configuration{}, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[cacheKey(tenantId, userId)]
+	if !ok {
+		metrics.Inc("configurations.cache.misses")
+		return models.Configuration{}, false
+	}
+	entry := element.Value.(*cachedConfiguration)
+	if time.Since(entry.loadedAt) >= c.ttl {
+		c.order.Remove(element)
+		delete(c.entries, entry.key)
+		metrics.Inc("configurations.cache.misses")
+		return models.Configuration{}, false
+	}
+	c.order.MoveToFront(element)
+	metrics.Inc("configurations.cache.hits")
+	return entry.configuration, true
+}
+
+// put caches the configuration of its user, evicting the least recently used configuration if the cache is full.
+// It is safe to call this function concurrently from multiple goroutines.
+func (c *configurationCache) put(configuration models.Configuration) {
+	if !c.enabled() {
+		return
+	}
+	key := cacheKey(configuration.TenantId, configuration.UserId)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value = &cachedConfiguration{key: key, configuration: configuration, loadedAt: time.Now()}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cachedConfiguration{key: key, configuration: configuration, loadedAt: time.Now()})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedConfiguration).key)
+		metrics.Inc("configurations.cache.evictions")
+	}
+	metrics.SetGauge("configurations.cache.size", int64(c.order.Len()))
+}
+
+// remove drops the cached configuration of the user.
+// It is safe to call this function concurrently from multiple goroutines.
+func (c *configurationCache) remove(tenantId string, userId string) {
+	key := cacheKey(tenantId, userId)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// cacheKey returns the key of the configuration of a user of a tenant.
+func cacheKey(tenantId string, userId string) string {
+	return tenantId + "/" + userId
+}
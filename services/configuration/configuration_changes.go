@@ -0,0 +1,97 @@
+package configurationService
+
+import (
+	"context"
+	"encoding/json"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/utils"
+)
+
+// Redis channel on which the configurations changed by an instance, an admin or another service are announced
+// to the instances, so they drop them from their cache and resend them to the connected users.
+const invalidationChannel = "configurations:invalidate"
+
+// instanceId identifies this instance, so it ignores the invalidations it published itself.
+var instanceId = utils.GenerateUUID()
+
+// invalidationMessage announces that the configuration of a user changed. Messages published outside the
+// service have no instanceId, so every instance handles them.
+type invalidationMessage struct {
+	InstanceId string `json:"instanceId,omitempty"`
+	TenantId   string `json:"tenantId,omitempty"`
+	UserId     string `json:"userId"`
+}
+
+// ChangeHandler applies the changed configuration of a user to the user's connections on this instance.
+type ChangeHandler func(tenantId string, userId string)
+
+// Invalidate drops the cached configuration of the user on this instance and announces the change to the
+// other instances. It must be called whenever a configuration is changed without the configuration service,
+// for example when the data of a user is erased. Failing to reach the other instances is logged; their
+// cache entry then expires after CONFIGURATION_CACHE_TTL_SECONDS, and their connections keep the previous
+// configuration until they reconnect.
+func Invalidate(tenantId string, userId string) {
+	sharedCache().remove(tenantId, userId)
+	body, err := json.Marshal(invalidationMessage{InstanceId: instanceId, TenantId: tenantId, UserId: userId})
+	if err == nil {
+		err = config.RDB.Publish(config.Ctx, invalidationChannel, body).Err()
+	}
+	if err != nil {
+		metrics.Inc("configurations.cache.publish.failed")
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Configuration Service",
+			Operation: "Invalidate",
+			Message:   "Failed to announce configuration change for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+	}
+}
+
+// StartChangeSubscriber handles the configuration changes announced by other instances, admins or other
+// services: the configuration is dropped from the cache of this instance and the given handler applies it
+// to the user's connections. It runs until the context is cancelled.
+func StartChangeSubscriber(ctx context.Context, handler ChangeHandler) {
+	shared := sharedCache()
+	subscription := config.RDB.Subscribe(ctx, invalidationChannel)
+	defer subscription.Close()
+	messages := subscription.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down configuration change subscriber",
+				Component: "Configuration Service",
+				Operation: "Shutdown Change Subscriber",
+			})
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var invalidation invalidationMessage
+			if err := json.Unmarshal([]byte(message.Payload), &invalidation); err != nil || invalidation.UserId == "" {
+				logger.Log.Warn(logger.LogPayload{
+					Component: "Configuration Service",
+					Operation: "StartChangeSubscriber",
+					Message:   "Ignoring malformed configuration invalidation",
+					Error:     err,
+				})
+				continue
+			}
+			if invalidation.InstanceId == instanceId {
+				continue
+			}
+			if shared.enabled() {
+				shared.remove(invalidation.TenantId, invalidation.UserId)
+				metrics.Inc("configurations.cache.invalidations")
+			}
+			metrics.Inc("configurations.changes.received")
+			if handler != nil {
+				handler(invalidation.TenantId, invalidation.UserId)
+			}
+		}
+	}
+}
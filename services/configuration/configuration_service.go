@@ -1,15 +1,20 @@
 package configurationService
 
 import (
+	"context"
 	"r2-notify-server/data"
 	"r2-notify-server/models"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ConfigurationService interface {
-	FindByAppAndUser(userId string) (configuration data.Configuration, err error)
-	Create(configuration models.Configuration) (primitive.ObjectID, error)
-	Update(configuration models.Configuration) error
-	Delete(userId string) error
+	FindByAppAndUser(ctx context.Context, tenantId string, userId string) (configuration data.Configuration, err error)
+	Create(ctx context.Context, configuration models.Configuration) (primitive.ObjectID, error)
+	Update(ctx context.Context, configuration models.Configuration) error
+	Delete(ctx context.Context, tenantId string, userId string) error
+	GetOrCreate(ctx context.Context, configuration models.Configuration) (data.Configuration, error)
+	MuteGroup(ctx context.Context, tenantId string, userId string, appId string, groupKey string, until time.Time) (data.Configuration, error)
+	UnmuteGroup(ctx context.Context, tenantId string, userId string, appId string, groupKey string) (data.Configuration, error)
 }
@@ -1,11 +1,13 @@
 package configurationService
 
 import (
-	"errors"
+	"context"
+	"r2-notify-server/apperrors"
 	"r2-notify-server/data"
 	"r2-notify-server/logger"
 	"r2-notify-server/models"
 	configurationRepository "r2-notify-server/repository/configuration"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -14,34 +16,42 @@ import (
 type ConfigurationServiceImpl struct {
 	ConfigurationRepository configurationRepository.ConfigurationRepository
 	Validate                *validator.Validate
+
+	cache *configurationCache
 }
 
 // NewConfigurationServiceImpl returns a new instance of ConfigurationService, which is used to manage application configurations of users.
 // The first parameter is the ConfigurationRepository, which is used to interact with the database to store and retrieve the configurations.
 // The second parameter is an instance of validator.Validate, which is used to validate the configuration struct before saving to or retrieving from the database.
 // If the second parameter is nil, the function will return an error.
+// Configurations are cached in memory, see sharedCache.
 func NewConfigurationServiceImpl(configurationRepository configurationRepository.ConfigurationRepository, validate *validator.Validate) (service ConfigurationService, err error) {
 	if validate == nil {
-		return nil, errors.New("validator instance cannot be nil")
+		return nil, apperrors.Internal("validator instance cannot be nil", nil)
 	}
 	return &ConfigurationServiceImpl{
 		ConfigurationRepository: configurationRepository,
 		Validate:                validate,
+		cache:                   sharedCache(),
 	}, err
 }
 
-// FindByAppAndUser retrieves the configuration for a specific user based on their user ID.
+// FindByAppAndUser retrieves the configuration for a specific user of a tenant based on their user ID.
 // It returns a data.Configuration object containing the user's configuration details,
 // including the configuration ID, user ID, and notification enablement status.
+// The configuration is served from the cache while it is fresh.
 // If no configuration is found or an error occurs during the retrieval, an error is returned.
-func (t ConfigurationServiceImpl) FindByAppAndUser(userId string) (data.Configuration, error) {
+func (t ConfigurationServiceImpl) FindByAppAndUser(ctx context.Context, tenantId string, userId string) (data.Configuration, error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Configuration Service",
 		Operation: "FindByAppAndUser",
 		Message:   "Fetching configuration for userId: " + userId,
 		UserId:    userId,
 	})
-	result, err := t.ConfigurationRepository.FindByAppAndUser(userId)
+	if cached, ok := t.cache.get(tenantId, userId); ok {
+		return toConfiguration(cached, time.Now()), nil
+	}
+	result, err := t.ConfigurationRepository.FindByAppAndUser(ctx, tenantId, userId)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Configuration Service",
@@ -53,14 +63,8 @@ func (t ConfigurationServiceImpl) FindByAppAndUser(userId string) (data.Configur
 		return data.Configuration{}, err
 	}
 
-	configuration := data.Configuration{
-		Event: data.Event{Event: data.LIST_CONFIGURATIONS},
-		Data: data.NotificationConfig{
-			Id:                 result.Id.Hex(),
-			UserID:             result.UserId,
-			EnableNotification: result.EnableNotifications,
-		},
-	}
+	t.cache.put(result)
+	configuration := toConfiguration(result, time.Now())
 	logger.Log.Info(logger.LogPayload{
 		Component: "Configuration Service",
 		Operation: "FindByAppAndUser",
@@ -72,14 +76,14 @@ func (t ConfigurationServiceImpl) FindByAppAndUser(userId string) (data.Configur
 
 // Create creates a new configuration for the user identified by the configuration's UserId field.
 // It returns the ObjectID of the newly created configuration document, or an error if the creation fails.
-func (t *ConfigurationServiceImpl) Create(configuration models.Configuration) (primitive.ObjectID, error) {
+func (t *ConfigurationServiceImpl) Create(ctx context.Context, configuration models.Configuration) (primitive.ObjectID, error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Configuration Service",
 		Operation: "Create",
 		Message:   "Creating configuration for userId: " + configuration.UserId,
 		UserId:    configuration.UserId,
 	})
-	recordId, err := t.ConfigurationRepository.Create(configuration)
+	recordId, err := t.ConfigurationRepository.Create(ctx, configuration)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Configuration Service",
@@ -90,6 +94,7 @@ func (t *ConfigurationServiceImpl) Create(configuration models.Configuration) (p
 		})
 		return primitive.NilObjectID, err
 	}
+	Invalidate(configuration.TenantId, configuration.UserId)
 	logger.Log.Info(logger.LogPayload{
 		Component: "Configuration Service",
 		Operation: "Create",
@@ -99,16 +104,16 @@ func (t *ConfigurationServiceImpl) Create(configuration models.Configuration) (p
 	return recordId, nil
 }
 
-// Update updates the configuration for a user identified by the configuration's UserId field.
-// It returns an error if the update fails.
-func (t *ConfigurationServiceImpl) Update(configuration models.Configuration) error {
+// Update updates the configuration for a user identified by the configuration's UserId field, and drops it
+// from the cache of every instance. It returns an error if the update fails.
+func (t *ConfigurationServiceImpl) Update(ctx context.Context, configuration models.Configuration) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Configuration Service",
 		Operation: "Update",
 		Message:   "Updating configuration for userId: " + configuration.UserId,
 		UserId:    configuration.UserId,
 	})
-	err := t.ConfigurationRepository.Update(configuration)
+	err := t.ConfigurationRepository.Update(ctx, configuration)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Configuration Service",
@@ -119,6 +124,7 @@ func (t *ConfigurationServiceImpl) Update(configuration models.Configuration) er
 		})
 		return err
 	}
+	Invalidate(configuration.TenantId, configuration.UserId)
 	logger.Log.Info(logger.LogPayload{
 		Component: "Configuration Service",
 		Operation: "Update",
@@ -128,16 +134,16 @@ func (t *ConfigurationServiceImpl) Update(configuration models.Configuration) er
 	return nil
 }
 
-// Delete deletes the configuration for a user identified by the configuration's UserId field.
-// It returns an error if the deletion fails.
-func (t *ConfigurationServiceImpl) Delete(userId string) error {
+// Delete deletes the configuration for a user of a tenant identified by the user ID, and drops it from the
+// cache of every instance. It returns an error if the deletion fails.
+func (t *ConfigurationServiceImpl) Delete(ctx context.Context, tenantId string, userId string) error {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Configuration Service",
 		Operation: "Delete",
 		Message:   "Deleting configuration for userId: " + userId,
 		UserId:    userId,
 	})
-	err := t.ConfigurationRepository.Delete(userId)
+	err := t.ConfigurationRepository.Delete(ctx, tenantId, userId)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Configuration Service",
@@ -148,6 +154,7 @@ func (t *ConfigurationServiceImpl) Delete(userId string) error {
 		})
 		return err
 	}
+	Invalidate(tenantId, userId)
 	logger.Log.Info(logger.LogPayload{
 		Component: "Configuration Service",
 		Operation: "Delete",
@@ -156,3 +163,163 @@ func (t *ConfigurationServiceImpl) Delete(userId string) error {
 	})
 	return nil
 }
+
+// GetOrCreate returns the configuration of the user identified by the configuration's TenantId and UserId fields,
+// creating it from the given configuration if the user has none. Concurrent calls for the same user
+// always resolve to a single configuration document. An existing configuration is served from the cache while
+// it is fresh. It returns an error if the operation fails.
+func (t *ConfigurationServiceImpl) GetOrCreate(ctx context.Context, configuration models.Configuration) (data.Configuration, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Service",
+		Operation: "GetOrCreate",
+		Message:   "Fetching or creating configuration for userId: " + configuration.UserId,
+		UserId:    configuration.UserId,
+	})
+	if cached, ok := t.cache.get(configuration.TenantId, configuration.UserId); ok {
+		return toConfiguration(cached, time.Now()), nil
+	}
+	result, err := t.ConfigurationRepository.GetOrCreate(ctx, configuration)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Service",
+			Operation: "GetOrCreate",
+			Message:   "Failed to fetch or create configuration for userId: " + configuration.UserId,
+			Error:     err,
+			UserId:    configuration.UserId,
+		})
+		return data.Configuration{}, err
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Configuration Service",
+		Operation: "GetOrCreate",
+		Message:   "Successfully fetched or created configuration for userId: " + configuration.UserId,
+		UserId:    configuration.UserId,
+	})
+	t.cache.put(result)
+	return toConfiguration(result, time.Now()), nil
+}
+
+// MuteGroup suppresses the real-time delivery of the notifications of the given app and group to the user
+// until the given time, replacing an earlier mute of the group. Mutes that have expired are removed.
+// It returns the updated configuration, or an error if the user has no configuration or the update fails.
+func (t *ConfigurationServiceImpl) MuteGroup(ctx context.Context, tenantId string, userId string, appId string, groupKey string, until time.Time) (data.Configuration, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Service",
+		Operation: "MuteGroup",
+		Message:   "Muting group " + groupKey + " of app " + appId + " until " + until.Format(time.RFC3339) + " for userId: " + userId,
+		UserId:    userId,
+		AppId:     appId,
+	})
+	return t.updateMutedGroups(ctx, "MuteGroup", tenantId, userId, appId, groupKey, &until)
+}
+
+// UnmuteGroup resumes the real-time delivery of the notifications of the given app and group to the user.
+// It returns the updated configuration, or an error if the user has no configuration or the update fails.
+func (t *ConfigurationServiceImpl) UnmuteGroup(ctx context.Context, tenantId string, userId string, appId string, groupKey string) (data.Configuration, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Configuration Service",
+		Operation: "UnmuteGroup",
+		Message:   "Unmuting group " + groupKey + " of app " + appId + " for userId: " + userId,
+		UserId:    userId,
+		AppId:     appId,
+	})
+	return t.updateMutedGroups(ctx, "UnmuteGroup", tenantId, userId, appId, groupKey, nil)
+}
+
+// updateMutedGroups removes the mute of the given app and group and the expired mutes from the user's
+// configuration, and mutes the group until the given time unless it is nil. The configuration is read from the
+// database rather than the cache, so concurrent changes made on other instances are not overwritten.
+func (t *ConfigurationServiceImpl) updateMutedGroups(ctx context.Context, operation string, tenantId string, userId string, appId string, groupKey string, until *time.Time) (data.Configuration, error) {
+	configuration, err := t.ConfigurationRepository.FindByAppAndUser(ctx, tenantId, userId)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Service",
+			Operation: operation,
+			Message:   "Failed to fetch configuration for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+			AppId:     appId,
+		})
+		return data.Configuration{}, err
+	}
+
+	now := time.Now()
+	mutedGroups := make([]models.MutedGroup, 0, len(configuration.MutedGroups)+1)
+	for _, muted := range configuration.MutedGroups {
+		if muted.Until.After(now) && (muted.AppId != appId || muted.GroupKey != groupKey) {
+			mutedGroups = append(mutedGroups, muted)
+		}
+	}
+	if until != nil {
+		mutedGroups = append(mutedGroups, models.MutedGroup{AppId: appId, GroupKey: groupKey, Until: until.UTC()})
+	}
+	configuration.MutedGroups = mutedGroups
+
+	if err := t.ConfigurationRepository.Update(ctx, configuration); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Configuration Service",
+			Operation: operation,
+			Message:   "Failed to update muted groups for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+			AppId:     appId,
+		})
+		return data.Configuration{}, err
+	}
+	Invalidate(tenantId, userId)
+	logger.Log.Info(logger.LogPayload{
+		Component: "Configuration Service",
+		Operation: operation,
+		Message:   "Successfully updated muted groups for userId: " + userId,
+		UserId:    userId,
+		AppId:     appId,
+	})
+	return toConfiguration(configuration, now), nil
+}
+
+// toConfiguration converts a configuration model into the listConfigurations payload, with the muted groups
+// that have not expired at the given time.
+func toConfiguration(configuration models.Configuration, now time.Time) data.Configuration {
+	return data.Configuration{
+		Event: data.Event{Event: data.LIST_CONFIGURATIONS},
+		Data: data.NotificationConfig{
+			Id:                 configuration.Id.Hex(),
+			TenantId:           configuration.TenantId,
+			UserID:             configuration.UserId,
+			EnableNotification: configuration.EnableNotifications,
+			DigestApps:         toDigestSettings(configuration.DigestApps),
+			MutedGroups:        toMutedGroups(configuration.MutedGroups, now),
+			ListScope:          ListScope(configuration.ListScope),
+		},
+	}
+}
+
+// toDigestSettings converts the stored digest settings of a configuration to their response representation.
+func toDigestSettings(settings []models.DigestSetting) []data.DigestSetting {
+	digests := make([]data.DigestSetting, 0, len(settings))
+	for _, setting := range settings {
+		digests = append(digests, data.DigestSetting{AppId: setting.AppId, WindowMinutes: setting.WindowMinutes})
+	}
+	return digests
+}
+
+// toMutedGroups converts the muted groups of a configuration that have not expired at the given time to
+// their response representation.
+func toMutedGroups(mutedGroups []models.MutedGroup, now time.Time) []data.MutedGroup {
+	result := make([]data.MutedGroup, 0, len(mutedGroups))
+	for _, muted := range mutedGroups {
+		if muted.Until.After(now) {
+			result = append(result, data.MutedGroup{AppId: muted.AppId, GroupKey: muted.GroupKey, Until: muted.Until})
+		}
+	}
+	return result
+}
+
+// ListScope returns the scope of the full notification lists of a user with the given configured scope,
+// unread unless the user chose all.
+func ListScope(scope string) string {
+	if scope == data.LIST_SCOPE_ALL {
+		return data.LIST_SCOPE_ALL
+	}
+	return data.LIST_SCOPE_UNREAD
+}
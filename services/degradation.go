@@ -0,0 +1,260 @@
+package clientStore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cachedClientInfo is a client info kept in memory so deliveries continue while Redis is unavailable.
+type cachedClientInfo struct {
+	info      models.ClientInfo
+	expiresAt time.Time
+}
+
+// pendingWrite is a Redis write that failed and is retried by the Redis retry loop.
+// Writes are coalesced per user, so only the latest state of a client is written. The version tells a
+// queued write apart from the one that replaced it.
+type pendingWrite struct {
+	info    models.ClientInfo
+	delete  bool
+	version uint64
+}
+
+var (
+	infoCache     = make(map[string]cachedClientInfo)
+	pendingWrites = make(map[string]pendingWrite)
+	writeVersion  uint64
+	degraded      bool
+	cacheMutex    sync.Mutex
+	infoCacheTTL  = 5 * time.Minute
+
+	// clientWriteLocks serialise the Redis writes of the client info of a user, so a retried write cannot
+	// land on top of a newer one. Users are spread over the locks by the hash of their ID.
+	clientWriteLocks [64]sync.Mutex
+)
+
+// clientWriteLock returns the lock serialising the Redis writes of the client info of the given user.
+func clientWriteLock(id string) *sync.Mutex {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return &clientWriteLocks[hash.Sum32()%uint32(len(clientWriteLocks))]
+}
+
+// IsDegraded reports whether the client store is running from its in-memory registry because Redis is unavailable.
+func IsDegraded() bool {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	return degraded
+}
+
+// StartRedisRetryLoop retries the Redis writes queued while Redis was unavailable and leaves the
+// degradation mode once Redis responds again. It runs until the context is cancelled.
+func StartRedisRetryLoop(ctx context.Context) {
+	cfg := config.LoadConfig()
+	cacheMutex.Lock()
+	infoCacheTTL = time.Duration(cfg.ClientInfoCacheTTLSeconds) * time.Second
+	cacheMutex.Unlock()
+
+	ticker := time.NewTicker(time.Duration(max(cfg.RedisRetryIntervalSeconds, 1)) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down Redis retry loop",
+				Component: "Client Store",
+				Operation: "Shutdown Redis Retry Loop",
+			})
+			return
+		case <-ticker.C:
+			if IsDegraded() {
+				retryRedisWrites()
+			}
+		}
+	}
+}
+
+// storeClientInfo caches the client info and writes it to Redis. If Redis is unavailable, the write
+// is queued for retry and the client store enters the degradation mode instead of failing. A successful
+// write replaces any write queued for the user.
+func storeClientInfo(operation string, info models.ClientInfo) {
+	lock := clientWriteLock(info.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	cacheClientInfo(info)
+	data, _ := json.Marshal(info)
+	if err := config.RDB.Set(config.Ctx, "client:"+info.ID, data, 0).Err(); err != nil {
+		queueRedisWrite(operation, info.ID, pendingWrite{info: info}, err)
+		return
+	}
+	clearRedisWrite(info.ID)
+}
+
+// deleteClientInfo evicts the cached client info and deletes it from Redis. If Redis is unavailable,
+// the delete is queued for retry. A successful delete replaces any write queued for the user.
+func deleteClientInfo(operation string, id string) {
+	lock := clientWriteLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	cacheMutex.Lock()
+	delete(infoCache, id)
+	cacheMutex.Unlock()
+	if err := config.RDB.Del(config.Ctx, "client:"+id).Err(); err != nil {
+		queueRedisWrite(operation, id, pendingWrite{info: models.ClientInfo{ID: id}, delete: true}, err)
+		return
+	}
+	clearRedisWrite(id)
+}
+
+// clearRedisWrite drops the write queued for the given user, once a newer write reached Redis.
+func clearRedisWrite(id string) {
+	cacheMutex.Lock()
+	delete(pendingWrites, id)
+	cacheMutex.Unlock()
+}
+
+// cacheClientInfo stores the client info in memory until the cache TTL expires.
+func cacheClientInfo(info models.ClientInfo) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	infoCache[info.ID] = cachedClientInfo{info: info, expiresAt: time.Now().Add(infoCacheTTL)}
+}
+
+// cachedClientInfoFor returns the latest known client info of the given user: a queued write if one
+// is pending, or the cached client info if it has not expired.
+func cachedClientInfoFor(id string) (models.ClientInfo, bool) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	if write, ok := pendingWrites[id]; ok {
+		return write.info, !write.delete
+	}
+	cached, ok := infoCache[id]
+	if !ok || time.Now().After(cached.expiresAt) {
+		return models.ClientInfo{}, false
+	}
+	return cached.info, true
+}
+
+// retryRedisWrite writes a queued client info to Redis and drops it from the queue, unless it was replaced
+// since it was read from the queue.
+func retryRedisWrite(id string, write pendingWrite) error {
+	lock := clientWriteLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	cacheMutex.Lock()
+	current, queued := pendingWrites[id]
+	cacheMutex.Unlock()
+	if !queued || current.version != write.version {
+		return nil
+	}
+
+	var err error
+	if write.delete {
+		err = config.RDB.Del(config.Ctx, "client:"+id).Err()
+	} else {
+		data, _ := json.Marshal(write.info)
+		err = config.RDB.Set(config.Ctx, "client:"+id, data, 0).Err()
+	}
+	if err != nil {
+		return err
+	}
+	clearRedisWrite(id)
+	metrics.Inc("redis.writes.retried")
+	return nil
+}
+
+// markDegraded switches the client store to the degradation mode after a Redis failure.
+// A missing key is not a Redis failure and is ignored.
+func markDegraded(operation string, err error) {
+	if errors.Is(err, redis.Nil) {
+		return
+	}
+	cacheMutex.Lock()
+	wasDegraded := degraded
+	degraded = true
+	cacheMutex.Unlock()
+	if !wasDegraded {
+		metrics.SetGauge("redis.degraded", 1)
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Client Store",
+			Operation: operation,
+			Message:   "Redis unavailable, serving clients from the in-memory registry",
+			Error:     err,
+		})
+	}
+}
+
+// queueRedisWrite queues a failed Redis write for retry and enters the degradation mode.
+func queueRedisWrite(operation string, id string, write pendingWrite, err error) {
+	cacheMutex.Lock()
+	writeVersion++
+	write.version = writeVersion
+	pendingWrites[id] = write
+	cacheMutex.Unlock()
+	metrics.Inc("redis.writes.queued")
+	logger.Log.Warn(logger.LogPayload{
+		Component: "Client Store",
+		Operation: operation,
+		Message:   "Queued Redis write for retry for clientID: " + id,
+		Error:     err,
+		UserId:    id,
+	})
+	markDegraded(operation, err)
+}
+
+// retryRedisWrites writes the queued client infos to Redis. Writes that fail again stay queued. A write
+// replaced while the retry ran, by a newer write or an erasure of the user, is skipped, so it cannot
+// overwrite the newer state. The degradation mode ends once no writes are pending and Redis answers a ping.
+func retryRedisWrites() {
+	cacheMutex.Lock()
+	writes := make(map[string]pendingWrite, len(pendingWrites))
+	for id, write := range pendingWrites {
+		writes[id] = write
+	}
+	cacheMutex.Unlock()
+
+	failed := 0
+	for id, write := range writes {
+		if err := retryRedisWrite(id, write); err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "RetryRedisWrites",
+			Message:   fmt.Sprintf("%d of %d queued Redis writes failed again", failed, len(writes)),
+		})
+		return
+	}
+	if err := config.RDB.Ping(config.Ctx).Err(); err != nil {
+		return
+	}
+
+	cacheMutex.Lock()
+	recovered := len(pendingWrites) == 0
+	if recovered {
+		degraded = false
+	}
+	cacheMutex.Unlock()
+	if recovered {
+		metrics.SetGauge("redis.degraded", 0)
+		logger.Log.Info(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "RetryRedisWrites",
+			Message:   fmt.Sprintf("Redis available again, flushed %d queued writes", len(writes)),
+		})
+	}
+}
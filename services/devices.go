@@ -0,0 +1,186 @@
+package clientStore
+
+import (
+	"encoding/json"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ListDevices returns the active connections of the given user on this instance, oldest first.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) ListDevices(userId string) []models.DeviceInfo {
+	return t.devicesOf(userId)
+}
+
+// ConnectedDevices returns the active connections of the given user on every instance: the devices stored in the
+// devices hash of the user in Redis, merged with the connections of this instance, oldest first. Devices of other
+// instances whose heartbeat key expired, left behind by an instance that stopped without removing them, are
+// dropped. If Redis is unavailable, only the connections of this instance are returned.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) ConnectedDevices(userId string) []models.DeviceInfo {
+	devices := t.devicesOf(userId)
+	fields, err := config.RDB.HGetAll(config.Ctx, devicesKey(userId)).Result()
+	if err != nil {
+		markDegraded("ConnectedDevices", err)
+		return devices
+	}
+	local := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		local[device.ConnectionId] = true
+	}
+	remote := make(map[string]models.DeviceInfo, len(fields))
+	for field, val := range fields {
+		var device models.DeviceInfo
+		if err := json.Unmarshal([]byte(val), &device); err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Client Store",
+				Operation: "ConnectedDevices",
+				Message:   "Failed to unmarshal device " + field + " for clientID: " + userId,
+				Error:     err,
+				UserId:    userId,
+			})
+			continue
+		}
+		if !local[device.ConnectionId] {
+			remote[field] = device
+		}
+	}
+	devices = append(devices, liveDevices(userId, remote)...)
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ConnectedAt.Before(devices[j].ConnectedAt)
+	})
+	return devices
+}
+
+// liveDevices returns the devices of the given fields of the devices hash of the user whose heartbeat key exists.
+// Fields of connections that have no heartbeat key for longer than the heartbeat TTL are deleted from the hash;
+// newer ones may not have their key yet and are only skipped. Every device is returned when heartbeat keys are
+// disabled or cannot be read.
+func liveDevices(userId string, fields map[string]models.DeviceInfo) []models.DeviceInfo {
+	devices := make([]models.DeviceInfo, 0, len(fields))
+	ttl := heartbeatTTL()
+	if ttl <= 0 || len(fields) == 0 {
+		for _, device := range fields {
+			devices = append(devices, device)
+		}
+		return devices
+	}
+
+	exists := make(map[string]*redis.IntCmd, len(fields))
+	pipe := config.RDB.Pipeline()
+	for field, device := range fields {
+		exists[field] = pipe.Exists(config.Ctx, heartbeatKey(device.ConnectionId))
+	}
+	if _, err := pipe.Exec(config.Ctx); err != nil {
+		markDegraded("ConnectedDevices", err)
+		for _, device := range fields {
+			devices = append(devices, device)
+		}
+		return devices
+	}
+	var stale []string
+	cutoff := time.Now().Add(-ttl)
+	for field, device := range fields {
+		if exists[field].Val() > 0 {
+			devices = append(devices, device)
+		} else if device.ConnectedAt.Before(cutoff) {
+			stale = append(stale, field)
+		}
+	}
+	if len(stale) > 0 {
+		_ = config.RDB.HDel(config.Ctx, devicesKey(userId), stale...).Err()
+		metrics.Add("connections.devices.expired", int64(len(stale)))
+	}
+	return devices
+}
+
+// DisconnectDevice closes the connections of the given user matching the id, which is either the
+// connection ID assigned by the server or the deviceId supplied by the client. WebSocket clients receive
+// a close frame with the deviceDisconnected reason so they do not reconnect automatically.
+// It returns a not found error if the user has no such connection.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) DisconnectDevice(userId string, id string) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Client Store",
+		Operation: "DisconnectDevice",
+		Message:   "Disconnecting device " + id + " for userId: " + userId,
+		UserId:    userId,
+	})
+	var targets []Connection
+	for _, registered := range t.registry.Connections(userId) {
+		device := registered.Device
+		if device.ConnectionId == id || (device.DeviceId != "" && device.DeviceId == id) {
+			targets = append(targets, registered.Conn)
+		}
+	}
+
+	if len(targets) == 0 {
+		return apperrors.NotFound("device not found")
+	}
+	for _, conn := range targets {
+		writeCloseFrame(conn, data.DEVICE_DISCONNECTED_CLOSE, data.DEVICE_DISCONNECTED)
+		if err := conn.Close(); err != nil {
+			logger.Log.Warn(logger.LogPayload{
+				Component: "Client Store",
+				Operation: "DisconnectDevice",
+				Message:   "Failed to close connection of device " + id + " for userId: " + userId,
+				Error:     err,
+				UserId:    userId,
+			})
+		}
+		t.RemoveConnection(userId, conn)
+		metrics.Inc("connections.devices.disconnected")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Client Store",
+		Operation: "DisconnectDevice",
+		Message:   "Successfully disconnected device " + id + " for userId: " + userId,
+		UserId:    userId,
+	})
+	return nil
+}
+
+// SendDeviceListToUser sends the list of active connections to the user identified by the given userID.
+// The list is an explicit response to a user request, so the notification status check is bypassed.
+// Returns an error if the user is not connected.
+func (t *ClientStore) SendDeviceListToUser(userID string, payload data.DeviceList) error {
+	return t.sendToUser(userID, payload, true)
+}
+
+// devicesOf returns the devices of the given user's connections, oldest first.
+func (t *ClientStore) devicesOf(userId string) []models.DeviceInfo {
+	return sortedDevices(t.registry.Connections(userId))
+}
+
+// sortedDevices returns the devices of the given connections, oldest first.
+func sortedDevices(conns []RegisteredConnection) []models.DeviceInfo {
+	result := make([]models.DeviceInfo, 0, len(conns))
+	for _, registered := range conns {
+		result = append(result, registered.Device)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ConnectedAt.Before(result[j].ConnectedAt)
+	})
+	return result
+}
+
+// devicesKey returns the Redis hash listing the devices of the given user on every instance. Each instance
+// stores the device of each of its connections in its own field, see deviceField, so instances never overwrite
+// the devices of each other.
+func devicesKey(userId string) string {
+	return "devices:" + userId
+}
+
+// deviceField returns the field of the devices hash holding the device of the connection of this instance with
+// the given ID.
+func deviceField(connectionId string) string {
+	return instanceId + "/" + connectionId
+}
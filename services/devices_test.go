@@ -0,0 +1,97 @@
+package clientStore
+
+import (
+	"context"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap/zapcore"
+)
+
+// testConnection is a connection that discards the frames written to it.
+type testConnection struct{}
+
+func (c *testConnection) WriteMessage(messageType int, data []byte) error { return nil }
+func (c *testConnection) Close() error                                    { return nil }
+
+// useMiniredis points the client stores at a new in-memory Redis server, shared by every store of the test like
+// a Redis server is shared by the instances of the service.
+func useMiniredis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	config.RDB = client
+	config.Ctx = context.Background()
+	logger.Log = logger.NewTestSink(zapcore.ErrorLevel).Logger
+	return server
+}
+
+// connect registers a new connection of the user in the store, with a device of the given connection ID.
+func connect(t *testing.T, store *ClientStore, userId string, connectionId string, connectedAt time.Time) Connection {
+	t.Helper()
+	conn := &testConnection{}
+	device := models.DeviceInfo{ConnectionId: connectionId, Transport: "websocket", ConnectedAt: connectedAt}
+	if err := store.StoreClient(models.ClientInfo{ID: userId, EnableNotification: true}, conn, JSONEncoder, device); err != nil {
+		t.Fatalf("StoreClient: %v", err)
+	}
+	return conn
+}
+
+// assertDevices fails the test unless the devices have the given connection IDs, in order.
+func assertDevices(t *testing.T, devices []models.DeviceInfo, connectionIds ...string) {
+	t.Helper()
+	if len(devices) != len(connectionIds) {
+		t.Fatalf("got %d devices %v, want %v", len(devices), devices, connectionIds)
+	}
+	for i, device := range devices {
+		if device.ConnectionId != connectionIds[i] {
+			t.Fatalf("device %d is %s, want %s", i, device.ConnectionId, connectionIds[i])
+		}
+	}
+}
+
+func TestConnectedDevicesAcrossInstances(t *testing.T) {
+	useMiniredis(t)
+	first := NewClientStore(NewInMemoryClientRegistry(), nil)
+	second := NewClientStore(NewInMemoryClientRegistry(), nil)
+	now := time.Now()
+
+	firstConn := connect(t, first, "user", "first-1", now.Add(-time.Minute))
+	connect(t, second, "user", "second-1", now)
+
+	assertDevices(t, first.ConnectedDevices("user"), "first-1", "second-1")
+	assertDevices(t, second.ConnectedDevices("user"), "first-1", "second-1")
+
+	// Removing the last connection of the first instance keeps the devices of the second one
+	first.RemoveConnection("user", firstConn)
+	assertDevices(t, first.ConnectedDevices("user"), "second-1")
+	assertDevices(t, second.ConnectedDevices("user"), "second-1")
+}
+
+func TestConnectedDevicesDropsDevicesWithoutHeartbeat(t *testing.T) {
+	server := useMiniredis(t)
+	ttl := heartbeatTTL()
+	if ttl <= 0 {
+		t.Skip("heartbeat keys are disabled")
+	}
+	store := NewClientStore(NewInMemoryClientRegistry(), nil)
+	other := NewClientStore(NewInMemoryClientRegistry(), nil)
+	now := time.Now()
+
+	// A connection of an instance that stopped without removing it
+	writeConnection("user", models.DeviceInfo{ConnectionId: "stopped-1", ConnectedAt: now.Add(-2 * ttl)}, ttl)
+	server.FastForward(ttl / 2)
+	connect(t, other, "user", "other-1", now)
+	server.FastForward(ttl/2 + time.Second)
+
+	assertDevices(t, store.ConnectedDevices("user"), "other-1")
+	if server.HGet(devicesKey("user"), deviceField("stopped-1")) != "" {
+		t.Fatal("device without heartbeat was not deleted")
+	}
+}
@@ -0,0 +1,164 @@
+package clientStore
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"sync"
+	"time"
+)
+
+// Interval at which the digest scheduler checks for digest windows that have ended.
+const digestFlushInterval = 30 * time.Second
+
+type digestKey struct {
+	userId string
+	appId  string
+}
+
+// digestBatch holds the notifications of a user and app received during the current digest window.
+type digestBatch struct {
+	windowStart   time.Time
+	windowEnd     time.Time
+	notifications []data.Notification
+}
+
+var (
+	digests      = make(map[digestKey]*digestBatch)
+	digestsMutex sync.Mutex
+)
+
+// DigestWindows converts the digest settings of a configuration to the per-app digest windows
+// stored in the client info, keyed by appId with the window length in minutes.
+func DigestWindows(settings []data.DigestSetting) map[string]int {
+	if len(settings) == 0 {
+		return nil
+	}
+	windows := make(map[string]int, len(settings))
+	for _, setting := range settings {
+		windows[setting.AppId] = setting.WindowMinutes
+	}
+	return windows
+}
+
+// StartDigestScheduler delivers a digestNotification for every digest window that has ended.
+// It checks the pending digests every 30 seconds until the context is cancelled.
+func (t *ClientStore) StartDigestScheduler(ctx context.Context) {
+	ticker := time.NewTicker(digestFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down digest scheduler",
+				Component: "Digest Scheduler",
+				Operation: "Shutdown Digest Scheduler",
+			})
+			return
+		case now := <-ticker.C:
+			t.flushDigests(now)
+		}
+	}
+}
+
+// digestWindow returns the digest window configured for the given app if the user is connected,
+// has notifications enabled and receives the app's notifications as a digest.
+func (t *ClientStore) digestWindow(userId string, appId string) (time.Duration, bool) {
+	if !t.IsConnected(userId) {
+		return 0, false
+	}
+	info, err := GetClientInfo(userId)
+	if err != nil || !info.EnableNotification {
+		return 0, false
+	}
+	minutes := info.DigestWindows[appId]
+	if minutes <= 0 {
+		return 0, false
+	}
+	return time.Duration(minutes) * time.Minute, true
+}
+
+// queueDigest adds the notification to the digest of its user and app. A new digest window is
+// aligned to the window length, so a 15 minute digest is delivered at :00, :15, :30 and :45.
+func queueDigest(notification data.Notification, window time.Duration) {
+	key := digestKey{userId: UserKey(notification.TenantId, notification.UserID), appId: notification.AppId}
+	digestsMutex.Lock()
+	defer digestsMutex.Unlock()
+	batch, ok := digests[key]
+	if !ok {
+		windowStart := time.Now().Truncate(window)
+		batch = &digestBatch{windowStart: windowStart, windowEnd: windowStart.Add(window)}
+		digests[key] = batch
+	}
+	batch.notifications = append(batch.notifications, notification)
+	metrics.Inc("digest.notifications.queued")
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Digest Scheduler",
+		Operation: "QueueDigest",
+		Message:   fmt.Sprintf("Queued notification %s for digest ending at %s", notification.Id, batch.windowEnd.Format(time.RFC3339)),
+		UserId:    notification.UserID,
+		AppId:     notification.AppId,
+	})
+}
+
+// flushDigests removes the digests whose window ended at or before now and sends them to their users.
+// Digests of users that are no longer connected are dropped; the notifications remain stored and are
+// listed the next time the user connects.
+func (t *ClientStore) flushDigests(now time.Time) {
+	due := make(map[digestKey]*digestBatch)
+	digestsMutex.Lock()
+	for key, batch := range digests {
+		if !batch.windowEnd.After(now) {
+			due[key] = batch
+			delete(digests, key)
+		}
+	}
+	digestsMutex.Unlock()
+
+	for key, batch := range due {
+		if err := t.sendToUser(key.userId, buildDigest(key, batch), false); err != nil {
+			metrics.Inc("digest.dropped")
+			logger.Log.Warn(logger.LogPayload{
+				Component: "Digest Scheduler",
+				Operation: "FlushDigests",
+				Message:   fmt.Sprintf("Digest of %d notifications not delivered", len(batch.notifications)),
+				UserId:    key.userId,
+				AppId:     key.appId,
+				Error:     err,
+			})
+			continue
+		}
+		metrics.Inc("digest.sent")
+	}
+}
+
+// buildDigest assembles the digestNotification payload for a batch, summarising the notifications
+// per group in the order the groups first appeared.
+func buildDigest(key digestKey, batch *digestBatch) data.DigestNotification {
+	summaries := []data.DigestSummary{}
+	index := make(map[string]int)
+	for _, notification := range batch.notifications {
+		i, ok := index[notification.GroupKey]
+		if !ok {
+			i = len(summaries)
+			index[notification.GroupKey] = i
+			summaries = append(summaries, data.DigestSummary{GroupKey: notification.GroupKey})
+		}
+		summaries[i].Count++
+		summaries[i].LatestMessage = notification.Message
+		summaries[i].LatestStatus = notification.Status
+	}
+	return data.DigestNotification{
+		Event: data.Event{Event: data.DIGEST_NOTIFICATION},
+		Data: data.Digest{
+			UserID:      key.userId,
+			AppId:       key.appId,
+			Count:       len(batch.notifications),
+			WindowStart: batch.windowStart,
+			WindowEnd:   batch.windowEnd,
+			Summaries:   summaries,
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package clientStore
+
+import (
+	"fmt"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"sync"
+	"time"
+)
+
+var (
+	drainMutex     sync.Mutex
+	drainStartedAt *time.Time // set once the instance starts draining
+	drainWindow    time.Duration
+	drainNotified  int // connections sent a reconnectRequested event so far
+)
+
+// IsDraining reports whether the instance is draining. A draining instance is not ready, refuses new
+// connections and asks its connections to reconnect to another instance.
+// It is safe to call this function concurrently from multiple goroutines.
+func IsDraining() bool {
+	drainMutex.Lock()
+	defer drainMutex.Unlock()
+	return drainStartedAt != nil
+}
+
+// StartDraining puts the instance into draining mode, typically before it is replaced in a blue/green
+// deployment. The connections to the instance are sent a reconnectRequested event, spread evenly over
+// DRAIN_WINDOW_SECONDS so the other instances are not flooded with reconnects. Draining lasts until the
+// instance stops; calling StartDraining again only reports the progress.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) StartDraining() data.DrainStatus {
+	drainMutex.Lock()
+	if drainStartedAt == nil {
+		now := time.Now()
+		drainStartedAt = &now
+		drainWindow = time.Duration(config.LoadConfig().DrainWindowSeconds) * time.Second
+		go t.requestReconnects(t.registry.All(), drainWindow)
+		logger.Log.Info(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "StartDraining",
+			Message:   fmt.Sprintf("Draining instance, asking connections to reconnect over %s", drainWindow),
+		})
+	}
+	drainMutex.Unlock()
+	return t.GetDrainStatus()
+}
+
+// GetDrainStatus reports whether the instance is draining and the connections still open to it.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) GetDrainStatus() data.DrainStatus {
+	connections := t.registry.All()
+	status := data.DrainStatus{Users: len(connections)}
+	for _, conns := range connections {
+		status.Connections += len(conns)
+	}
+
+	drainMutex.Lock()
+	defer drainMutex.Unlock()
+	if drainStartedAt != nil {
+		startedAt := *drainStartedAt
+		status.Draining = true
+		status.StartedAt = &startedAt
+		status.WindowSeconds = int(drainWindow / time.Second)
+		status.Notified = drainNotified
+	}
+	metrics.SetGauge("connections.drain.remaining", int64(status.Connections))
+	return status
+}
+
+// ReconnectRequest returns the reconnectRequested event sent to clients by a draining instance. Clients
+// refused a connection are asked to wait DRAIN_RETRY_AFTER_SECONDS, while the connections being drained
+// may reconnect at once, since their reconnects are already spread over the drain window.
+func ReconnectRequest(refused bool) data.ReconnectRequested {
+	payload := data.ReconnectRequested{
+		Event: data.Event{Event: data.RECONNECT_REQUESTED},
+		Data:  data.ReconnectRequest{Reason: data.SERVER_DRAINING},
+	}
+	if refused {
+		payload.Data.RetryAfterSeconds = config.LoadConfig().DrainRetryAfterSeconds
+	}
+	return payload
+}
+
+// requestReconnects sends the reconnectRequested event to the given connections, one at a time at even
+// intervals over the window. Connections closed meanwhile are skipped. The event is encoded once per
+// negotiated format and envelope version.
+func (t *ClientStore) requestReconnects(connections map[string][]RegisteredConnection, window time.Duration) {
+	var targets []RegisteredConnection
+	for _, conns := range connections {
+		targets = append(targets, conns...)
+	}
+	if len(targets) == 0 {
+		return
+	}
+	interval := window / time.Duration(len(targets))
+	payload := ReconnectRequest(false)
+	encoded := make(map[Encoder][]byte)
+	for i, registered := range targets {
+		if i > 0 && interval > 0 {
+			time.Sleep(interval)
+		}
+		if _, ok := t.registry.Get(registered.Conn); !ok {
+			continue
+		}
+		encoder := registered.Encoder
+		if encoder == nil {
+			encoder = JSONEncoder
+		}
+		frame, ok := encoded[encoder]
+		if !ok {
+			var err error
+			frame, err = encoder.Marshal(payload)
+			if err != nil {
+				logger.Log.Error(logger.LogPayload{
+					Component: "Client Store",
+					Operation: "RequestReconnects",
+					Message:   "Failed to marshal " + encoder.Format() + " reconnect request",
+					Error:     err,
+				})
+				continue
+			}
+			encoded[encoder] = frame
+		}
+		if err := writeToConnection(registered, priorityHigh, encoder.MessageType(), frame); err != nil {
+			logger.Log.Warn(logger.LogPayload{
+				Component: "Client Store",
+				Operation: "RequestReconnects",
+				Message:   "Failed to send reconnect request to connection " + registered.Device.ConnectionId,
+				Error:     err,
+			})
+			continue
+		}
+		drainMutex.Lock()
+		drainNotified++
+		drainMutex.Unlock()
+		metrics.Inc("connections.drain.notified")
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Client Store",
+		Operation: "RequestReconnects",
+		Message:   fmt.Sprintf("Asked %d connections to reconnect", len(targets)),
+	})
+}
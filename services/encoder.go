@@ -0,0 +1,80 @@
+package clientStore
+
+import (
+	"bytes"
+	"encoding/json"
+	"r2-notify-server/data"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encoder serializes the payloads sent to a connection and decodes the events it receives.
+// Each connection negotiates its encoder at the handshake, so JSON and binary clients coexist.
+type Encoder interface {
+	// Format returns the name of the wire format, as used in the format query parameter and subprotocol.
+	Format() string
+	// MessageType returns the WebSocket message type used for encoded payloads.
+	MessageType() int
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(message []byte, v interface{}) error
+}
+
+var (
+	JSONEncoder        Encoder = jsonEncoder{}
+	MessagePackEncoder Encoder = messagePackEncoder{}
+)
+
+// EncoderFor returns the encoder for the given format. Unknown or empty formats fall back to JSON.
+func EncoderFor(format string) Encoder {
+	if format == data.FORMAT_MSGPACK {
+		return MessagePackEncoder
+	}
+	return JSONEncoder
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Format() string {
+	return data.FORMAT_JSON
+}
+
+func (jsonEncoder) MessageType() int {
+	return websocket.TextMessage
+}
+
+func (jsonEncoder) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonEncoder) Unmarshal(message []byte, v interface{}) error {
+	return json.Unmarshal(message, v)
+}
+
+// messagePackEncoder encodes payloads as MessagePack using the json struct tags, so binary
+// clients receive the same field names as JSON clients.
+type messagePackEncoder struct{}
+
+func (messagePackEncoder) Format() string {
+	return data.FORMAT_MSGPACK
+}
+
+func (messagePackEncoder) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (messagePackEncoder) Marshal(v interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (messagePackEncoder) Unmarshal(message []byte, v interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(message))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
@@ -0,0 +1,70 @@
+package clientStore
+
+import (
+	"r2-notify-server/data"
+	"reflect"
+	"strconv"
+)
+
+// eventType is the type of the event name and resume token embedded in every payload.
+var eventType = reflect.TypeOf(data.Event{})
+
+// EnvelopeVersion returns the envelope version requested with the v query parameter. Clients that do not
+// pass it, or pass an invalid version, get version 1 frames. Versions newer than the latest supported
+// version are served the latest one, so new clients can connect to older servers and read the version
+// from the frames they receive.
+func EnvelopeVersion(value string) int {
+	version, err := strconv.Atoi(value)
+	if err != nil || version < data.ENVELOPE_V1 {
+		return data.ENVELOPE_V1
+	}
+	return min(version, data.LATEST_ENVELOPE_VERSION)
+}
+
+// VersionedEncoder returns the encoder writing the frames of a connection with the given envelope version.
+// Version 1 frames are the payloads as is; later versions wrap them in a data.Envelope. Payload changes that
+// would break older clients belong in the envelope encoder of a new version, so both can be served at once.
+func VersionedEncoder(encoder Encoder, version int) Encoder {
+	if version <= data.ENVELOPE_V1 {
+		return encoder
+	}
+	return envelopeEncoder{Encoder: encoder, version: version}
+}
+
+// envelopeEncoder wraps the payloads in a versioned envelope before encoding them. Events received from
+// the client are decoded by the underlying encoder; the v field of incoming events is ignored.
+type envelopeEncoder struct {
+	Encoder
+	version int
+}
+
+func (e envelopeEncoder) Marshal(v interface{}) ([]byte, error) {
+	return e.Encoder.Marshal(toEnvelope(v, e.version))
+}
+
+// toEnvelope moves the event name, resume token and data of a payload into an envelope of the given
+// version. Payloads that do not embed data.Event or have no Data field are returned unchanged.
+func toEnvelope(payload interface{}, version int) interface{} {
+	value := reflect.ValueOf(payload)
+	if value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return payload
+	}
+	eventField, ok := value.Type().FieldByName("Event")
+	if !ok || !eventField.Anonymous || eventField.Type != eventType {
+		return payload
+	}
+	dataField := value.FieldByName("Data")
+	if !dataField.IsValid() {
+		return payload
+	}
+	event := value.FieldByIndex(eventField.Index).Interface().(data.Event)
+	return data.Envelope{
+		V:           version,
+		Event:       event.Event,
+		ResumeToken: event.ResumeToken,
+		Data:        dataField.Interface(),
+	}
+}
@@ -0,0 +1,93 @@
+package clientStore
+
+import (
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+)
+
+// EraseUser removes the given user from the client store. The client info, the devices hash and the counter of
+// the user's notification sequence numbers are deleted from Redis, the client info from the in-memory cache too,
+// pending digests are dropped and the user's connections on every instance are closed with the
+// userDataErased reason. Unlike DeleteClient, the Redis delete is not queued while Redis is unavailable:
+// an error is returned instead so the erasure can be retried.
+// It returns the number of connections closed on this instance and the number of Redis keys deleted.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) EraseUser(userId string) (int, int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Client Store",
+		Operation: "EraseUser",
+		Message:   "Erasing client state for userId: " + userId,
+		UserId:    userId,
+	})
+	lock := clientWriteLock(userId)
+	lock.Lock()
+	cacheMutex.Lock()
+	delete(infoCache, userId)
+	delete(pendingWrites, userId)
+	cacheMutex.Unlock()
+	deleted, err := config.RDB.Del(config.Ctx, "client:"+userId, devicesKey(userId), data.SEQUENCE_KEY_PREFIX+userId).Result()
+	lock.Unlock()
+	if err != nil {
+		markDegraded("EraseUser", err)
+		logger.Log.Error(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "EraseUser",
+			Message:   "Failed to delete client info from Redis for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, 0, apperrors.DependencyUnavailable("failed to delete client info", err)
+	}
+
+	closed := t.closeUserConnections(userId)
+	dropped := dropDigests(userId)
+	publishReadState(userId, readStateMessage{InstanceId: instanceId, Erase: userId})
+	logger.Log.Info(logger.LogPayload{
+		Component: "Client Store",
+		Operation: "EraseUser",
+		Message:   fmt.Sprintf("Erased client state for userId: %s | Connections: %d | Keys: %d | Digests: %d", userId, closed, deleted, dropped),
+		UserId:    userId,
+	})
+	return closed, deleted, nil
+}
+
+// closeUserConnections closes every connection of the given user on this instance with the
+// userDataErased reason, so clients do not reconnect automatically. It returns the number of
+// connections closed.
+func (t *ClientStore) closeUserConnections(userId string) int {
+	targets := t.registry.Connections(userId)
+	for _, registered := range targets {
+		conn := registered.Conn
+		writeCloseFrame(conn, data.USER_DATA_ERASED_CLOSE, data.USER_DATA_ERASED)
+		if err := conn.Close(); err != nil {
+			logger.Log.Warn(logger.LogPayload{
+				Component: "Client Store",
+				Operation: "CloseUserConnections",
+				Message:   "Failed to close connection for userId: " + userId,
+				Error:     err,
+				UserId:    userId,
+			})
+		}
+		t.RemoveConnection(userId, conn)
+		metrics.Inc("connections.erased")
+	}
+	return len(targets)
+}
+
+// dropDigests discards the pending digests of the given user. It returns the number of digests dropped.
+func dropDigests(userId string) int {
+	digestsMutex.Lock()
+	defer digestsMutex.Unlock()
+	dropped := 0
+	for key := range digests {
+		if key.userId == userId {
+			delete(digests, key)
+			dropped++
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,59 @@
+package clientStore
+
+import (
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"time"
+)
+
+// RecordHeartbeat stores the time of the latest heartbeat received on the connection of the given user
+// and, when the client reported one, its round-trip latency, which is listed with the device and
+// recorded in the ws.heartbeat.latency_ms histogram. The heartbeat key of the connection is refreshed.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) RecordHeartbeat(userId string, conn Connection, latencyMs *int64) {
+	now := time.Now()
+	ok := t.registry.UpdateDevice(conn, func(device *models.DeviceInfo) {
+		device.LastHeartbeatAt = &now
+		if latencyMs != nil {
+			latency := *latencyMs
+			device.LatencyMs = &latency
+		}
+	})
+	if !ok {
+		return
+	}
+	t.RefreshConnectionHeartbeat(userId, conn)
+	metrics.Inc("ws.heartbeats")
+	if latencyMs != nil {
+		metrics.Observe("ws.heartbeat.latency_ms", *latencyMs)
+	}
+}
+
+// SendHeartbeatToConnection answers a heartbeat on the connection it was received on only, since the
+// latency is measured per connection. Heartbeats bypass the notification status check.
+// Returns an error if the connection is no longer registered or encoding the payload fails.
+func (t *ClientStore) SendHeartbeatToConnection(userId string, conn Connection, payload data.HeartbeatResponse) error {
+	state, ok := t.registry.Get(conn)
+	if !ok {
+		return apperrors.NotFound("connection not found")
+	}
+	encoder := state.Encoder
+	if encoder == nil {
+		encoder = JSONEncoder
+	}
+	encoded, err := encoder.Marshal(payload)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "SendHeartbeatToConnection",
+			Message:   "Failed to marshal " + encoder.Format() + " heartbeat for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return apperrors.Internal("failed to encode payload", err)
+	}
+	return writeToConnection(RegisteredConnection{Conn: conn, ConnectionState: state}, priorityHigh, encoder.MessageType(), encoded)
+}
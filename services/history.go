@@ -0,0 +1,129 @@
+package clientStore
+
+import (
+	"encoding/base64"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// historyEntry is a frame recorded in a connection's history.
+type historyEntry struct {
+	at          time.Time
+	status      string
+	messageType int
+	data        []byte
+}
+
+// frameHistory keeps the last frames sent to a connection in a ring buffer, so support can see what a
+// client was sent without raising the log level of the whole service.
+type frameHistory struct {
+	mutex   sync.Mutex
+	entries []historyEntry
+	next    int
+	full    bool
+}
+
+// newFrameHistory returns a history of the given size, or nil if the size is not positive and the
+// history is disabled.
+func newFrameHistory(size int) *frameHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &frameHistory{entries: make([]historyEntry, size)}
+}
+
+// add records a frame, overwriting the oldest one once the buffer is full. It is a no-op on a nil history.
+func (h *frameHistory) add(status string, messageType int, payload []byte) {
+	if h == nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.entries[h.next] = historyEntry{at: time.Now(), status: status, messageType: messageType, data: payload}
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// snapshot returns the recorded frames, oldest first.
+func (h *frameHistory) snapshot() []data.ConnectionFrame {
+	if h == nil {
+		return nil
+	}
+	h.mutex.Lock()
+	entries := append([]historyEntry(nil), h.entries[:h.next]...)
+	if h.full {
+		entries = append(append([]historyEntry(nil), h.entries[h.next:]...), entries...)
+	}
+	h.mutex.Unlock()
+
+	frames := make([]data.ConnectionFrame, 0, len(entries))
+	for _, entry := range entries {
+		frames = append(frames, describeFrame(entry))
+	}
+	return frames
+}
+
+// describeFrame decodes a recorded frame for the history endpoint. JSON and MessagePack payloads are
+// returned as JSON documents; payloads that cannot be decoded are returned base64 encoded.
+func describeFrame(entry historyEntry) data.ConnectionFrame {
+	frame := data.ConnectionFrame{
+		SentAt: entry.at,
+		Status: entry.status,
+		Format: data.FORMAT_JSON,
+		Size:   len(entry.data),
+	}
+	encoder := JSONEncoder
+	if entry.messageType == websocket.BinaryMessage {
+		frame.Format = data.FORMAT_MSGPACK
+		encoder = MessagePackEncoder
+	}
+	var payload interface{}
+	if err := encoder.Unmarshal(entry.data, &payload); err != nil {
+		frame.Payload = base64.StdEncoding.EncodeToString(entry.data)
+		return frame
+	}
+	frame.Payload = payload
+	if document, ok := payload.(map[string]interface{}); ok {
+		frame.Event, _ = document["event"].(string)
+	}
+	return frame
+}
+
+// ConnectionHistory returns the frames last sent to each connection of the given user on this instance,
+// oldest connection first. It returns a not found error if the user has no connection, and an empty frame
+// list for every connection while CONNECTION_HISTORY_SIZE is 0.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) ConnectionHistory(userId string) ([]data.ConnectionHistory, error) {
+	conns := t.registry.Connections(userId)
+	if len(conns) == 0 {
+		return nil, apperrors.NotFound("user not connected")
+	}
+	histories := make(map[string]*frameHistory, len(conns))
+	for _, registered := range conns {
+		if registered.queue != nil {
+			histories[registered.Device.ConnectionId] = registered.queue.history
+		}
+	}
+	connectionDevices := sortedDevices(conns)
+	result := make([]data.ConnectionHistory, 0, len(connectionDevices))
+	for _, device := range connectionDevices {
+		frames := histories[device.ConnectionId].snapshot()
+		if frames == nil {
+			frames = []data.ConnectionFrame{}
+		}
+		result = append(result, data.ConnectionHistory{
+			ConnectionId: device.ConnectionId,
+			DeviceId:     device.DeviceId,
+			Transport:    device.Transport,
+			ConnectedAt:  device.ConnectedAt,
+			Frames:       frames,
+		})
+	}
+	return result, nil
+}
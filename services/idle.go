@@ -0,0 +1,110 @@
+package clientStore
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"sync"
+	"time"
+)
+
+// Interval at which the idle connection sweeper checks for idle connections.
+const idleSweepInterval = time.Minute
+
+var (
+	lastActivity  = make(map[Connection]time.Time) // connection -> time of the last event received
+	activityMutex sync.Mutex
+)
+
+// TouchConnection records activity on the connection, resetting its idle time.
+// It is safe to call this function concurrently from multiple goroutines.
+func TouchConnection(conn Connection) {
+	activityMutex.Lock()
+	defer activityMutex.Unlock()
+	lastActivity[conn] = time.Now()
+}
+
+// forgetConnection stops tracking the activity of a removed connection.
+func forgetConnection(conn Connection) {
+	activityMutex.Lock()
+	defer activityMutex.Unlock()
+	delete(lastActivity, conn)
+}
+
+// StartIdleConnectionSweeper closes the connections of users with notifications disabled once they
+// have been idle for IDLE_CONNECTION_TIMEOUT_MINUTES. WebSocket clients receive a close frame with the
+// connectionIdleTimeout reason so they can reconnect when needed. The sweeper is disabled when the
+// timeout is 0 and otherwise runs until the context is cancelled.
+func (t *ClientStore) StartIdleConnectionSweeper(ctx context.Context) {
+	timeout := time.Duration(config.LoadConfig().IdleConnectionTimeoutMinutes) * time.Minute
+	if timeout <= 0 {
+		logger.Log.Info(logger.LogPayload{
+			Message:   "Idle connection timeout not configured, idle connections are kept open",
+			Component: "Client Store",
+			Operation: "Start Idle Connection Sweeper",
+		})
+		return
+	}
+
+	ticker := time.NewTicker(idleSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down idle connection sweeper",
+				Component: "Client Store",
+				Operation: "Shutdown Idle Connection Sweeper",
+			})
+			return
+		case now := <-ticker.C:
+			t.closeIdleConnections(now, timeout)
+		}
+	}
+}
+
+// closeIdleConnections closes the connections idle for longer than the timeout whose users have
+// notifications disabled. The read loop of each closed connection removes it from the store.
+func (t *ClientStore) closeIdleConnections(now time.Time, timeout time.Duration) {
+	for userId, conns := range t.registry.All() {
+		info, err := GetClientInfo(userId)
+		if err != nil || info.EnableNotification {
+			continue
+		}
+		for _, registered := range conns {
+			activityMutex.Lock()
+			last, ok := lastActivity[registered.Conn]
+			activityMutex.Unlock()
+			if !ok || now.Sub(last) < timeout {
+				continue
+			}
+			closeIdleConnection(userId, registered.Conn, now.Sub(last))
+		}
+	}
+}
+
+// closeIdleConnection sends the connectionIdleTimeout close frame and closes the connection.
+// Connections that do not support close frames, such as SSE streams, are closed directly.
+func closeIdleConnection(userId string, conn Connection, idle time.Duration) {
+	writeCloseFrame(conn, data.CONNECTION_IDLE_TIMEOUT_CLOSE, data.CONNECTION_IDLE_TIMEOUT)
+	if err := conn.Close(); err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "CloseIdleConnection",
+			Message:   "Failed to close idle connection for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+	}
+	forgetConnection(conn)
+	metrics.Inc("connections.idle.closed")
+	logger.Log.Info(logger.LogPayload{
+		Component: "Client Store",
+		Operation: "CloseIdleConnection",
+		Message:   fmt.Sprintf("Closed connection idle for %s with notifications disabled", idle.Round(time.Second)),
+		UserId:    userId,
+	})
+}
@@ -0,0 +1,201 @@
+package clientStore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Interval at which the dead connection sweeper checks the heartbeat keys of the connections.
+const deadConnectionSweepInterval = 30 * time.Second
+
+var (
+	heartbeatFailedAt time.Time // time a heartbeat key last failed to be written
+	heartbeatMutex    sync.Mutex
+)
+
+// heartbeatKey returns the Redis key holding the heartbeat of the connection with the given ID.
+func heartbeatKey(connectionId string) string {
+	return "heartbeat:" + connectionId
+}
+
+// heartbeatTTL returns how long a connection stays alive without a heartbeat, or 0 if heartbeat keys are disabled.
+func heartbeatTTL() time.Duration {
+	return time.Duration(config.LoadConfig().ConnectionHeartbeatTTLSeconds) * time.Second
+}
+
+// RefreshConnectionHeartbeat extends the heartbeat key of the connection in Redis and rewrites its device in the
+// devices hash of the user. It is called whenever the client proves the connection is alive: on WebSocket pongs,
+// heartbeat events and SSE pings written successfully.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *ClientStore) RefreshConnectionHeartbeat(userId string, conn Connection) {
+	ttl := heartbeatTTL()
+	if ttl <= 0 {
+		return
+	}
+	state, ok := t.registry.Get(conn)
+	if !ok {
+		return
+	}
+	writeConnection(userId, state.Device, ttl)
+}
+
+// writeConnection stores the device of a connection of this instance in the devices hash of the user and, when
+// the TTL is positive, sets the heartbeat key of the connection with the TTL and extends the hash to live as long,
+// so the hash of a user whose connections are all gone expires. Heartbeat failures are remembered, so the sweeper
+// does not close live connections whose key could not be refreshed.
+func writeConnection(userId string, device models.DeviceInfo, ttl time.Duration) {
+	encoded, err := json.Marshal(device)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "WriteConnection",
+			Message:   "Failed to marshal device of connection " + device.ConnectionId + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return
+	}
+	_, err = config.RDB.Pipelined(config.Ctx, func(pipe redis.Pipeliner) error {
+		if ttl > 0 {
+			pipe.Set(config.Ctx, heartbeatKey(device.ConnectionId), userId, ttl)
+		}
+		pipe.HSet(config.Ctx, devicesKey(userId), deviceField(device.ConnectionId), encoded)
+		if ttl > 0 {
+			pipe.Expire(config.Ctx, devicesKey(userId), ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		if ttl > 0 {
+			heartbeatMutex.Lock()
+			heartbeatFailedAt = time.Now()
+			heartbeatMutex.Unlock()
+		}
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "WriteConnection",
+			Message:   "Failed to write heartbeat and device of connection " + device.ConnectionId + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+	}
+}
+
+// deleteConnection removes the device of a removed connection from the devices hash of the user, and its
+// heartbeat key. Entries that cannot be deleted are dropped by ConnectedDevices once the heartbeat key expired.
+func deleteConnection(userId string, connectionId string) {
+	if connectionId == "" {
+		return
+	}
+	_, _ = config.RDB.Pipelined(config.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(config.Ctx, devicesKey(userId), deviceField(connectionId))
+		if heartbeatTTL() > 0 {
+			pipe.Del(config.Ctx, heartbeatKey(connectionId))
+		}
+		return nil
+	})
+}
+
+// StartDeadConnectionSweeper closes the connections whose heartbeat key expired because the client stopped
+// answering pings for CONNECTION_HEARTBEAT_TTL_SECONDS, for example half-open sockets whose reads never fail.
+// The sweeper is disabled when the TTL is 0 and otherwise runs until the context is cancelled.
+func (t *ClientStore) StartDeadConnectionSweeper(ctx context.Context) {
+	ttl := heartbeatTTL()
+	if ttl <= 0 {
+		logger.Log.Info(logger.LogPayload{
+			Message:   "Connection heartbeat TTL not configured, dead connections are closed by their read loop only",
+			Component: "Client Store",
+			Operation: "Start Dead Connection Sweeper",
+		})
+		return
+	}
+
+	ticker := time.NewTicker(deadConnectionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down dead connection sweeper",
+				Component: "Client Store",
+				Operation: "Shutdown Dead Connection Sweeper",
+			})
+			return
+		case now := <-ticker.C:
+			t.closeDeadConnections(now, ttl)
+		}
+	}
+}
+
+// closeDeadConnections closes and deregisters the connections of this instance whose heartbeat key expired.
+// The sweep is skipped while Redis is unavailable and for one TTL after a heartbeat failed to be written,
+// since the keys of live connections may have expired in the meantime.
+func (t *ClientStore) closeDeadConnections(now time.Time, ttl time.Duration) {
+	heartbeatMutex.Lock()
+	failedAt := heartbeatFailedAt
+	heartbeatMutex.Unlock()
+	if IsDegraded() || now.Sub(failedAt) < ttl {
+		return
+	}
+
+	type check struct {
+		userId     string
+		registered RegisteredConnection
+		exists     *redis.IntCmd
+	}
+	var checks []check
+	pipe := config.RDB.Pipeline()
+	for userId, conns := range t.registry.All() {
+		for _, registered := range conns {
+			checks = append(checks, check{userId: userId, registered: registered, exists: pipe.Exists(config.Ctx, heartbeatKey(registered.Device.ConnectionId))})
+		}
+	}
+	if len(checks) == 0 {
+		return
+	}
+	if _, err := pipe.Exec(config.Ctx); err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "CloseDeadConnections",
+			Message:   "Failed to read connection heartbeats, skipping sweep",
+			Error:     err,
+		})
+		return
+	}
+	for _, c := range checks {
+		if c.exists.Val() == 0 {
+			t.closeDeadConnection(c.userId, c.registered)
+		}
+	}
+}
+
+// closeDeadConnection force-closes a connection without a heartbeat and removes it from the store. No close
+// frame is sent, since the client is not reading anymore.
+func (t *ClientStore) closeDeadConnection(userId string, registered RegisteredConnection) {
+	if err := registered.Conn.Close(); err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "CloseDeadConnection",
+			Message:   "Failed to close dead connection for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+	}
+	t.RemoveConnection(userId, registered.Conn)
+	metrics.Inc("connections.dead.closed")
+	logger.Log.Info(logger.LogPayload{
+		Component: "Client Store",
+		Operation: "CloseDeadConnection",
+		Message:   fmt.Sprintf("Closed connection %s without heartbeat since %s", registered.Device.ConnectionId, registered.Device.ConnectedAt.Format(time.RFC3339)),
+		UserId:    userId,
+	})
+}
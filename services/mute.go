@@ -0,0 +1,81 @@
+package clientStore
+
+import (
+	"errors"
+	"r2-notify-server/data"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"time"
+)
+
+// ErrMuted is returned by SendNotificationToUser for notifications of a group muted by the user.
+var ErrMuted = errors.New("notification group muted by the user")
+
+// MutedGroups converts the muted groups of a configuration to the muted groups stored in the client info.
+func MutedGroups(mutedGroups []data.MutedGroup) []models.MutedGroup {
+	if len(mutedGroups) == 0 {
+		return nil
+	}
+	result := make([]models.MutedGroup, 0, len(mutedGroups))
+	for _, muted := range mutedGroups {
+		result = append(result, models.MutedGroup{AppId: muted.AppId, GroupKey: muted.GroupKey, Until: muted.Until})
+	}
+	return result
+}
+
+// isMuted reports whether the client muted the given group of the app and the mute has not expired yet.
+func isMuted(info models.ClientInfo, appId string, groupKey string, now time.Time) bool {
+	for _, muted := range info.MutedGroups {
+		if muted.AppId == appId && muted.GroupKey == groupKey && muted.Until.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// mutedForUser reports whether the connected user muted the group of the notification. Muted
+// notifications are persisted, but neither pushed nor queued for a digest.
+func (t *ClientStore) mutedForUser(notification data.Notification) bool {
+	userKey := UserKey(notification.TenantId, notification.UserID)
+	if !t.IsConnected(userKey) {
+		return false
+	}
+	info, err := GetClientInfo(userKey)
+	if err != nil || !isMuted(info, notification.AppId, notification.GroupKey, time.Now()) {
+		return false
+	}
+	metrics.Inc("notifications.muted")
+	return true
+}
+
+// withMutedFlags flags the notifications of muted groups in frames listing notifications, so clients can
+// show them without alerting. Other frames are returned unchanged.
+func withMutedFlags(payload interface{}, info models.ClientInfo) interface{} {
+	if len(info.MutedGroups) == 0 {
+		return payload
+	}
+	now := time.Now()
+	flag := func(notifications []data.Notification) []data.Notification {
+		flagged := make([]data.Notification, len(notifications))
+		for i, notification := range notifications {
+			notification.Muted = isMuted(info, notification.AppId, notification.GroupKey, now)
+			flagged[i] = notification
+		}
+		return flagged
+	}
+	switch value := payload.(type) {
+	case data.NotificationList:
+		value.Data = flag(value.Data)
+		return value
+	case data.NotificationsResumed:
+		value.Data.Notifications = flag(value.Data.Notifications)
+		return value
+	case data.NotificationSearchResult:
+		value.Data.Items = flag(value.Data.Items)
+		return value
+	case data.NotificationsSince:
+		value.Data.Notifications = flag(value.Data.Notifications)
+		return value
+	}
+	return payload
+}
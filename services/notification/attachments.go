@@ -0,0 +1,43 @@
+package notificationService
+
+import (
+	"fmt"
+	"net/url"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/models"
+	"slices"
+)
+
+// Attachment types clients know how to render.
+var attachmentTypes = []string{data.ATTACHMENT_IMAGE, data.ATTACHMENT_LINK, data.ATTACHMENT_FILE}
+
+// ValidateAttachments checks the attachments of a new notification: there are at most MAX_ATTACHMENTS, each
+// has a known type and an absolute http or https URL, the optional thumbnail is an http or https URL too and
+// the size is not negative. It returns a validation error describing the first invalid attachment.
+func ValidateAttachments(attachments []models.NotificationAttachment) error {
+	if len(attachments) > data.MAX_ATTACHMENTS {
+		return apperrors.Validation(fmt.Sprintf("a notification can have at most %d attachments", data.MAX_ATTACHMENTS), nil)
+	}
+	for i, attachment := range attachments {
+		if !slices.Contains(attachmentTypes, attachment.Type) {
+			return apperrors.Validation(fmt.Sprintf("attachment %d has unknown type %q", i, attachment.Type), nil)
+		}
+		if !webURL(attachment.Url) {
+			return apperrors.Validation(fmt.Sprintf("attachment %d must have an http or https url", i), nil)
+		}
+		if attachment.ThumbnailUrl != "" && !webURL(attachment.ThumbnailUrl) {
+			return apperrors.Validation(fmt.Sprintf("thumbnailUrl of attachment %d must be an http or https url", i), nil)
+		}
+		if attachment.Size < 0 {
+			return apperrors.Validation(fmt.Sprintf("size of attachment %d must not be negative", i), nil)
+		}
+	}
+	return nil
+}
+
+// webURL reports whether value is an absolute http or https URL with a host.
+func webURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
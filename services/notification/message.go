@@ -0,0 +1,32 @@
+package notificationService
+
+import (
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"unicode/utf8"
+)
+
+// ApplyMessageLimit enforces MESSAGE_MAX_LENGTH, counted in characters, on the message of a new notification.
+// With the reject policy, a longer message is rejected with a validation error. With the truncate policy, the
+// message is cut to the maximum length, ending with an ellipsis, and the notification is flagged as truncated.
+// Notifications within the limit are returned as they are, so applying the limit twice changes nothing.
+func ApplyMessageLimit(notification models.Notification) (models.Notification, error) {
+	cfg := config.LoadConfig()
+	limit := cfg.MessageMaxLength
+	if utf8.RuneCountInString(notification.Message) <= limit {
+		return notification, nil
+	}
+	if cfg.MessageOverflowPolicy != data.MESSAGE_OVERFLOW_TRUNCATE {
+		metrics.Inc("notifications.message.rejected")
+		return notification, apperrors.Validation(fmt.Sprintf("message must not exceed %d characters", limit), nil)
+	}
+	runes := []rune(notification.Message)
+	notification.Message = string(runes[:limit-utf8.RuneCountInString(data.MESSAGE_ELLIPSIS)]) + data.MESSAGE_ELLIPSIS
+	notification.Truncated = true
+	metrics.Inc("notifications.message.truncated")
+	return notification, nil
+}
@@ -0,0 +1,57 @@
+package notificationService
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// dedupKey returns the Redis key under which the ID of a notification with the same tenantId, userId, appId,
+// groupKey and message is stored during the deduplication window.
+func dedupKey(notification models.Notification) string {
+	hash := sha256.New()
+	for _, field := range []string{notification.TenantId, notification.UserId, notification.AppId, notification.GroupKey, notification.Message} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	return "notifications:dedup:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// claimDedupKey claims the deduplication key of the notification for its ID for the given window and
+// reports whether the key was claimed. If another notification already claimed the key, the ID of that
+// notification is returned instead. Deduplication fails open: if Redis is unavailable, neither is returned
+// and the notification is treated as unique.
+func claimDedupKey(key string, id primitive.ObjectID, window time.Duration, userId string) (original primitive.ObjectID, claimed bool) {
+	claimed, err := config.RDB.SetNX(config.Ctx, key, id.Hex(), window).Result()
+	if err == nil && claimed {
+		return primitive.NilObjectID, true
+	}
+	if err == nil {
+		var value string
+		value, err = config.RDB.Get(config.Ctx, key).Result()
+		if err == nil {
+			if original, err = primitive.ObjectIDFromHex(value); err == nil {
+				return original, false
+			}
+		}
+	}
+	logger.Log.Warn(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "Deduplicate",
+		Message:   "Failed to check notification for duplicates, creating it for userId: " + userId,
+		Error:     err,
+		UserId:    userId,
+	})
+	return primitive.NilObjectID, false
+}
+
+// releaseDedupKey releases the deduplication key claimed for a notification that could not be created,
+// so a retry of the same notification is not reported as a duplicate.
+func releaseDedupKey(key string) {
+	config.RDB.Del(config.Ctx, key)
+}
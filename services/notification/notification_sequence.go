@@ -0,0 +1,105 @@
+package notificationService
+
+import (
+	"context"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// How long the number claimed for a notification inserted directly into the database is kept, so every
+// instance watching the change stream gives it the same number.
+const sequenceClaimTTL = time.Hour
+
+// claimSequenceScript returns the number claimed for a notification, claiming the next value of the counter
+// when it has none.
+var claimSequenceScript = redis.NewScript(`
+local claimed = redis.call("GET", KEYS[2])
+if claimed then
+	return tonumber(claimed)
+end
+local sequence = redis.call("INCR", KEYS[1])
+redis.call("SET", KEYS[2], sequence, "EX", ARGV[1])
+return sequence
+`)
+
+// sequenceKey returns the Redis key of the counter numbering the notifications of a user of a tenant. Users of
+// the default tenant are keyed by their user ID alone, like in the client store.
+func sequenceKey(tenantId string, userId string) string {
+	if tenantId == "" {
+		return data.SEQUENCE_KEY_PREFIX + userId
+	}
+	return data.SEQUENCE_KEY_PREFIX + tenantId + "/" + userId
+}
+
+// sequenceClaimKey returns the Redis key of the number claimed for the notification with the given ID. It is
+// tagged with the counter key, so both are in the same slot of a Redis cluster.
+func sequenceClaimKey(tenantId string, userId string, id string) string {
+	return "{" + sequenceKey(tenantId, userId) + "}:" + id
+}
+
+// nextSequence returns the next sequence number of the notifications of the user. A notification without a
+// number could be missed by clients without them noticing, so if Redis is unavailable a dependency unavailable
+// error is returned.
+func nextSequence(tenantId string, userId string) (int64, error) {
+	sequence, err := config.RDB.Incr(config.Ctx, sequenceKey(tenantId, userId)).Result()
+	if err != nil {
+		return 0, sequenceFailed(userId, err)
+	}
+	return sequence, nil
+}
+
+// sequenceFailed counts and logs a failure to number a notification of the user, and returns it as a
+// dependency unavailable error.
+func sequenceFailed(userId string, err error) error {
+	metrics.Inc("notifications.sequence.failed")
+	logger.Log.Warn(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "Sequence",
+		Message:   "Failed to assign a sequence number to a notification for userId: " + userId,
+		Error:     err,
+		UserId:    userId,
+	})
+	return apperrors.DependencyUnavailable("sequence counter unavailable", err)
+}
+
+// number stores the next sequence number of the user on the stored notification and returns the notification
+// with it. Notifications are only numbered once stored, so notifications that fail to be stored or are dropped
+// as duplicates leave no holes in the numbers.
+func (t *NotificationServiceImpl) number(ctx context.Context, notification models.Notification) (models.Notification, error) {
+	sequence, err := nextSequence(notification.TenantId, notification.UserId)
+	if err != nil {
+		return notification, err
+	}
+	if err := t.NotificationRepository.SetSequence(ctx, notification.TenantId, notification.UserId, notification.Id, sequence); err != nil {
+		return notification, err
+	}
+	notification.Sequence = sequence
+	return notification, nil
+}
+
+// Number numbers a notification inserted directly into the database and returns it with its sequence number.
+// Every instance delivering the notification gets the same number, which is claimed in Redis for
+// sequenceClaimTTL. If Redis is unavailable, a dependency unavailable error is returned and the notification
+// is left unnumbered.
+func (t *NotificationServiceImpl) Number(ctx context.Context, notification models.Notification) (models.Notification, error) {
+	keys := []string{
+		sequenceKey(notification.TenantId, notification.UserId),
+		sequenceClaimKey(notification.TenantId, notification.UserId, notification.Id.Hex()),
+	}
+	sequence, err := claimSequenceScript.Run(config.Ctx, config.RDB, keys, int64(sequenceClaimTTL.Seconds())).Int64()
+	if err != nil {
+		return notification, sequenceFailed(notification.UserId, err)
+	}
+	if err := t.NotificationRepository.SetSequence(ctx, notification.TenantId, notification.UserId, notification.Id, sequence); err != nil {
+		return notification, err
+	}
+	notification.Sequence = sequence
+	return notification, nil
+}
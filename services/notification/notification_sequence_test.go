@@ -0,0 +1,60 @@
+package notificationService
+
+import (
+	"context"
+	"r2-notify-server/config"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	notificationRepository "r2-notify-server/repository/notification"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap/zapcore"
+)
+
+// sequences is a notification repository recording the sequence numbers set on notifications.
+type sequences struct {
+	notificationRepository.NotificationRepository
+	set map[primitive.ObjectID]int64
+}
+
+func (t *sequences) SetSequence(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, sequence int64) error {
+	t.set[notificationId] = sequence
+	return nil
+}
+
+func TestNumberGivesEveryInstanceTheSameNumber(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	config.RDB = client
+	config.Ctx = context.Background()
+	logger.Log = logger.NewTestSink(zapcore.ErrorLevel).Logger
+
+	repository := &sequences{set: map[primitive.ObjectID]int64{}}
+	first := &NotificationServiceImpl{NotificationRepository: repository}
+	second := &NotificationServiceImpl{NotificationRepository: repository}
+	inserted := models.Notification{Id: primitive.NewObjectID(), UserId: "user"}
+	other := models.Notification{Id: primitive.NewObjectID(), UserId: "user"}
+
+	for _, number := range []struct {
+		service      *NotificationServiceImpl
+		notification models.Notification
+		want         int64
+	}{
+		{first, inserted, 1},
+		{second, inserted, 1},
+		{second, other, 2},
+		{first, other, 2},
+	} {
+		numbered, err := number.service.Number(context.Background(), number.notification)
+		if err != nil {
+			t.Fatalf("Number: %v", err)
+		}
+		if numbered.Sequence != number.want || repository.set[numbered.Id] != number.want {
+			t.Fatalf("notification %s numbered %d and stored as %d, want %d", numbered.Id.Hex(), numbered.Sequence, repository.set[numbered.Id], number.want)
+		}
+	}
+}
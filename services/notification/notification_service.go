@@ -1,22 +1,61 @@
 package notificationService
 
 import (
+	"context"
+	"errors"
 	"r2-notify-server/data"
 	"r2-notify-server/models"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ErrDuplicate is returned by Create, together with the ID of the original notification, when the same
+// notification was already created within the deduplication window. Callers should not deliver it again.
+var ErrDuplicate = errors.New("duplicate notification")
+
+// ErrReplaced is returned by Create, together with the ID of the replaced notification, when the notification
+// has a collapse key and replaced the previous notification of the user and app with the same key.
+// Callers should deliver it as a replacement rather than a new notification.
+var ErrReplaced = errors.New("notification replaced")
+
 type NotificationService interface {
-	FindAll(userId string) (notifications []data.Notification, err error)
-	FindById(id primitive.ObjectID, userId string) (notification data.Notification, err error)
-	Create(notification models.Notification) (primitive.ObjectID, error)
-	MarkAsRead(userId string) error
-	MarkAppAsRead(userId string, appId string) error
-	MarkGroupAsRead(userId string, appId string, groupKey string) error
-	MarkNotificationAsRead(userId string, notificationId string) error
-	DeleteNotifications(userId string) error
-	DeleteAppNotifications(userId string, appId string) error
-	DeleteGroupNotifications(userId string, appId string, groupKey string) error
-	DeleteNotification(userId string, notificationId string) error
+	FindAll(ctx context.Context, tenantId string, userId string, scope string) (notifications []data.Notification, err error)
+	FindList(ctx context.Context, tenantId string, userId string, query data.NotificationListQuery) ([]data.Notification, error)
+	FindById(ctx context.Context, tenantId string, id primitive.ObjectID, userId string) (notification data.Notification, err error)
+	Trace(ctx context.Context, tenantId string, userId string, notificationId string) (data.NotificationTrace, error)
+	Create(ctx context.Context, notification models.Notification) (models.Notification, error)
+	MarkAsRead(ctx context.Context, tenantId string, userId string, correlationId string) ([]string, error)
+	MarkAppAsRead(ctx context.Context, tenantId string, userId string, appId string, correlationId string) ([]string, error)
+	MarkGroupAsRead(ctx context.Context, tenantId string, userId string, appId string, groupKey string, correlationId string) ([]string, error)
+	MarkGroupOpened(ctx context.Context, tenantId string, userId string, appId string, groupKey string, openedAt time.Time, correlationId string) ([]string, error)
+	MarkNotificationAsRead(ctx context.Context, tenantId string, userId string, notificationId string) (data.Notification, error)
+	MarkThreadAsRead(ctx context.Context, tenantId string, userId string, notificationId string) (data.Notification, []string, error)
+	UpdateStatus(ctx context.Context, tenantId string, userId string, appId string, notificationId string, status string, correlationId string) (data.Notification, error)
+	RecordDelivery(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, delivery models.NotificationDelivery, timings models.NotificationTimings) error
+	DeleteNotifications(ctx context.Context, tenantId string, userId string, correlationId string) ([]string, error)
+	DeleteAppNotifications(ctx context.Context, tenantId string, userId string, appId string, correlationId string) ([]string, error)
+	DeleteGroupNotifications(ctx context.Context, tenantId string, userId string, appId string, groupKey string, correlationId string) ([]string, error)
+	DeleteNotification(ctx context.Context, tenantId string, userId string, notificationId string, correlationId string) ([]string, error)
+	Export(ctx context.Context, tenantId string, userId string, query data.NotificationExportQuery, write func(data.ExportedNotification) error) error
+	Search(ctx context.Context, tenantId string, userId string, query data.NotificationSearchQuery) (data.NotificationSearchResult, error)
+	RestoreDeleted(ctx context.Context, request data.RestoreDeletedRequest, correlationId string) (int64, error)
+	PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error)
+	DeleteExpired(ctx context.Context, appId string, readStatus bool, retention time.Duration) (int64, error)
+	TriggerAction(ctx context.Context, tenantId string, userId string, target data.NotificationActionTarget, correlationId string) (data.NotificationActionTriggered, error)
+	Stats(ctx context.Context, tenantId string, userId string) (data.NotificationStats, error)
+	SummarizeGroup(ctx context.Context, notification models.Notification) (data.GroupSummary, error)
+	FindChangedSince(ctx context.Context, tenantId string, userId string, since time.Time) (data.NotificationResume, error)
+	FindSince(ctx context.Context, tenantId string, userId string, query data.NotificationsSinceQuery) (data.NotificationsSince, error)
+	FindAfterSequence(ctx context.Context, tenantId string, userId string, query data.SequenceResyncQuery) (data.SequenceResync, error)
+	LastSequence(ctx context.Context, tenantId string, userId string) (int64, error)
+	Number(ctx context.Context, notification models.Notification) (models.Notification, error)
+	SyncReadState(ctx context.Context, tenantId string, userId string, request data.SyncReadStateRequest, correlationId string) (data.ReadStateSyncResult, error)
+	SetPinned(ctx context.Context, tenantId string, userId string, notificationId string, pinned bool, correlationId string) (data.Notification, error)
+	ClaimDueReminders(ctx context.Context, now time.Time, limit int) ([]data.Notification, error)
+}
+
+// ActionPublisher forwards the actions triggered by users to the source apps, for example over Event Hub.
+type ActionPublisher interface {
+	Publish(action data.NotificationActionTriggered) error
 }
@@ -1,11 +1,20 @@
 package notificationService
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
 	"r2-notify-server/data"
 	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
 	"r2-notify-server/models"
+	baseRepository "r2-notify-server/repository/base"
 	notificationRepository "r2-notify-server/repository/notification"
+	auditService "r2-notify-server/services/audit"
+	webhookService "r2-notify-server/services/webhook"
+	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,34 +22,53 @@ import (
 
 type NotificationServiceImpl struct {
 	NotificationRepository notificationRepository.NotificationRepository
+	WebhookService         webhookService.WebhookService
+	AuditService           auditService.AuditService
+	Transactor             baseRepository.Transactor
+	ActionPublisher        ActionPublisher
 	Validate               *validator.Validate
 }
 
 // NewNotificationServiceImpl returns a new instance of NotificationService
-// with the provided NotificationRepository and validator.Validate instance.
+// with the provided NotificationRepository, WebhookService, AuditService, Transactor, ActionPublisher and validator.Validate
+// instance. The WebhookService receives the created, read, deleted and action lifecycle events, and the AuditService
+// records the bulk read and delete operations and the triggered actions. The Transactor applies the group
+// operations together with their audit record. The ActionPublisher is optional;
+// when it is nil, triggered actions are only delivered to webhooks.
 // If the validator instance is nil, an error is returned.
-func NewNotificationServiceImpl(notificationRepository notificationRepository.NotificationRepository, validate *validator.Validate) (service NotificationService, err error) {
+func NewNotificationServiceImpl(notificationRepository notificationRepository.NotificationRepository, webhookService webhookService.WebhookService, auditService auditService.AuditService, transactor baseRepository.Transactor, actionPublisher ActionPublisher, validate *validator.Validate) (service NotificationService, err error) {
 	if validate == nil {
-		return nil, errors.New("validator instance cannot be nil")
+		return nil, apperrors.Internal("validator instance cannot be nil", nil)
 	}
 	return &NotificationServiceImpl{
 		NotificationRepository: notificationRepository,
+		WebhookService:         webhookService,
+		AuditService:           auditService,
+		Transactor:             transactor,
+		ActionPublisher:        actionPublisher,
 		Validate:               validate,
 	}, err
 }
 
-// FindAll returns a list of notifications for the given user ID. If no
-// notifications are found for the user, an empty list is returned with a nil
-// error. If an error occurs while fetching the notifications, the error is
-// returned.
-func (t NotificationServiceImpl) FindAll(userId string) (notifications []data.Notification, err error) {
+// FindAll returns a list of notifications for the given user ID within the given list scope. The unread
+// scope holds the unread and pinned notifications; the all scope adds the read notifications created in the
+// last LIST_HISTORY_DAYS. If no notifications are found for the user, an empty list is returned with a nil
+// error. Thread roots carry the number of their follow-ups. If an error occurs
+// while fetching the notifications, the error is returned.
+func (t NotificationServiceImpl) FindAll(ctx context.Context, tenantId string, userId string, scope string) (notifications []data.Notification, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "FindAll",
-		Message:   "Fetching all notifications for userId: " + userId,
+		Message:   "Fetching all notifications of scope " + scope + " for userId: " + userId,
 		UserId:    userId,
 	})
-	result, err := t.NotificationRepository.FindAll(userId)
+	var result []models.Notification
+	if scope == data.LIST_SCOPE_ALL {
+		since := time.Now().AddDate(0, 0, -config.LoadConfig().ListHistoryDays)
+		result, err = t.NotificationRepository.FindHistory(ctx, tenantId, userId, since)
+	} else {
+		result, err = t.NotificationRepository.FindAll(ctx, tenantId, userId)
+	}
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
@@ -53,18 +81,7 @@ func (t NotificationServiceImpl) FindAll(userId string) (notifications []data.No
 	}
 
 	for _, value := range result {
-		notification := data.Notification{
-			Id:         value.Id.Hex(),
-			AppId:      value.AppId,
-			GroupKey:   value.GroupKey,
-			Message:    value.Message,
-			ReadStatus: value.ReadStatus,
-			UserID:     value.UserId,
-			Status:     value.Status,
-			CreatedAt:  value.CreatedAt,
-			UpdatedAt:  value.UpdatedAt,
-		}
-		notifications = append(notifications, notification)
+		notifications = append(notifications, toNotification(value))
 	}
 	if len(notifications) == 0 {
 		logger.Log.Debug(logger.LogPayload{
@@ -81,21 +98,53 @@ func (t NotificationServiceImpl) FindAll(userId string) (notifications []data.No
 		Message:   "Successfully fetched notifications for userId: " + userId,
 		UserId:    userId,
 	})
-	return notifications, nil
+	return t.withReplyCounts(ctx, tenantId, userId, notifications), nil
+}
+
+// FindList retrieves the notifications of a user selected by the query, newest first. It is used for the
+// notification list sent when a client connects with the include, since or limit handshake parameters.
+// The limit is capped at MAX_LIST_LIMIT, and thread roots carry the number of their follow-ups. If an error
+// occurs during the operation, the error is returned.
+func (t NotificationServiceImpl) FindList(ctx context.Context, tenantId string, userId string, query data.NotificationListQuery) ([]data.Notification, error) {
+	if query.Limit > data.MAX_LIST_LIMIT {
+		query.Limit = data.MAX_LIST_LIMIT
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "FindList",
+		Message:   fmt.Sprintf("Fetching notification list for userId: %s | IncludeRead: %t, Limit: %d", userId, query.IncludeRead, query.Limit),
+		UserId:    userId,
+	})
+	result, err := t.NotificationRepository.FindList(ctx, tenantId, userId, query)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "FindList",
+			Message:   "Failed to fetch notification list for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return nil, err
+	}
+	notifications := make([]data.Notification, 0, len(result))
+	for _, value := range result {
+		notifications = append(notifications, toNotification(value))
+	}
+	return t.withReplyCounts(ctx, tenantId, userId, notifications), nil
 }
 
 // FindById retrieves a notification by its ID and user ID from the data store.
 // It returns the notification as a data.Notification struct. If the notification
 // is not found or an error occurs during the retrieval, it returns an empty
 // notification and the corresponding error.
-func (t *NotificationServiceImpl) FindById(id primitive.ObjectID, userId string) (notification data.Notification, err error) {
+func (t *NotificationServiceImpl) FindById(ctx context.Context, tenantId string, id primitive.ObjectID, userId string) (notification data.Notification, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "FindById",
 		Message:   "Fetching notification by ID for userId: " + userId,
 		UserId:    userId,
 	})
-	notificationModel, err := t.NotificationRepository.FindById(id, userId)
+	notificationModel, err := t.NotificationRepository.FindById(ctx, tenantId, id, userId)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
@@ -108,15 +157,29 @@ func (t *NotificationServiceImpl) FindById(id primitive.ObjectID, userId string)
 	}
 
 	notification = data.Notification{
-		Id:         notificationModel.Id.Hex(),
-		AppId:      notification.AppId,
-		GroupKey:   notificationModel.GroupKey,
-		Message:    notificationModel.Message,
-		ReadStatus: notificationModel.ReadStatus,
-		UserID:     notificationModel.UserId,
-		Status:     notificationModel.Status,
-		CreatedAt:  notificationModel.CreatedAt,
-		UpdatedAt:  notificationModel.UpdatedAt,
+		Id:              notificationModel.Id.Hex(),
+		TenantId:        notificationModel.TenantId,
+		AppId:           notificationModel.AppId,
+		GroupKey:        notificationModel.GroupKey,
+		Message:         notificationModel.Message,
+		ReadStatus:      notificationModel.ReadStatus,
+		UserID:          notificationModel.UserId,
+		Status:          notificationModel.Status,
+		CreatedAt:       notificationModel.CreatedAt,
+		UpdatedAt:       notificationModel.UpdatedAt,
+		Actions:         notificationModel.Actions,
+		ReadAt:          notificationModel.ReadAt,
+		SenderId:        notificationModel.SenderId,
+		SenderName:      notificationModel.SenderName,
+		SenderAvatarUrl: notificationModel.SenderAvatarUrl,
+		CollapseKey:     notificationModel.CollapseKey,
+		Attachments:     notificationModel.Attachments,
+		UIHints:         notificationModel.UIHints,
+		ExpiresAt:       notificationModel.ExpiresAt,
+		RemindAt:        notificationModel.RemindAt,
+		Truncated:       notificationModel.Truncated,
+		ParentId:        notificationModel.ParentId,
+		Pinned:          notificationModel.Pinned,
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Notification Service",
@@ -127,18 +190,124 @@ func (t *NotificationServiceImpl) FindById(id primitive.ObjectID, userId string)
 	return notification, nil
 }
 
-// Create creates a notification in the data store. It returns the newly created
-// notification's ID and an error if any. If an error occurs during the creation,
-// the error is returned.
-func (t *NotificationServiceImpl) Create(notification models.Notification) (primitive.ObjectID, error) {
+// Trace returns the notification of the user with the outcome of its last delivery and its timings, so
+// admins can tell whether a notification that arrived late was slow to be enqueued, persisted or delivered.
+// It returns a validation error if the ID is invalid and a not found error if the user has no such notification.
+func (t *NotificationServiceImpl) Trace(ctx context.Context, tenantId string, userId string, notificationId string) (data.NotificationTrace, error) {
+	id, err := primitive.ObjectIDFromHex(notificationId)
+	if err != nil {
+		return data.NotificationTrace{}, apperrors.Validation("invalid notification id", err)
+	}
+	notification, err := t.NotificationRepository.FindById(ctx, tenantId, id, userId)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "Trace",
+			Message:   "Failed to fetch notification " + notificationId + " for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return data.NotificationTrace{}, err
+	}
+	return data.NotificationTrace{
+		Notification: toNotification(notification),
+		Source:       notification.Source,
+		Delivery:     notification.Delivery,
+		Timings:      notification.Timings,
+	}, nil
+}
+
+// Create creates a notification in the data store. It returns the created notification, with its ID and
+// its sequence number among the notifications of the user, and an error if any. If an error occurs during
+// the creation, the error is returned. The notification is numbered once stored; if it cannot be numbered, it
+// is deleted again and the error is returned. Records written through the service are stamped with
+// the service origin so the change stream watcher does not deliver them twice.
+// If NOTIFICATION_DEDUP_WINDOW_SECONDS is set and a notification with the same userId, appId, groupKey
+// and message was created within the window, nothing is created and the notification is returned with the
+// original notification's ID and ErrDuplicate. A notification with a collapse key replaces the previous
+// notification of the user and app with the same key, and is returned with its ID and ErrReplaced; it is only
+// created when there is none to replace.
+func (t *NotificationServiceImpl) Create(ctx context.Context, notification models.Notification) (models.Notification, error) {
+	if !ValidStatus(notification.Status) {
+		return models.Notification{}, apperrors.Validation("unknown notification status "+notification.Status, nil)
+	}
+	if err := ValidateAttachments(notification.Attachments); err != nil {
+		return models.Notification{}, err
+	}
+	if err := ValidateUIHints(notification.UIHints); err != nil {
+		return models.Notification{}, err
+	}
+	if err := ValidateSource(notification.Source); err != nil {
+		return models.Notification{}, err
+	}
+	notification = ScheduleReminder(notification)
+	if err := ValidateReminder(notification); err != nil {
+		return models.Notification{}, err
+	}
+	notification, err := ApplyMessageLimit(notification)
+	if err != nil {
+		return models.Notification{}, err
+	}
+	if notification, err = t.resolveThread(ctx, notification); err != nil {
+		return models.Notification{}, err
+	}
+	notification.Origin = data.SERVICE_NAME
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "Create",
 		Message:   "Creating notification for userId: " + notification.UserId,
 		UserId:    notification.UserId,
 	})
-	recordId, err := t.NotificationRepository.Create(notification)
+	if notification.CollapseKey != "" {
+		replacedId, err := t.NotificationRepository.Collapse(ctx, notification)
+		if err == nil {
+			// The replaced notification keeps its previous number until it is numbered again, so a retry
+			// after a failure numbers it anew
+			notification.Id = replacedId
+			if notification, err = t.number(ctx, notification); err != nil {
+				return models.Notification{}, err
+			}
+			metrics.Inc("notifications.collapsed")
+			logger.Log.Info(logger.LogPayload{
+				Component: "Notification Service",
+				Operation: "Create",
+				Message:   "Replaced notification " + replacedId.Hex() + " with collapseKey: " + notification.CollapseKey + " for userId: " + notification.UserId,
+				UserId:    notification.UserId,
+				AppId:     notification.AppId,
+			})
+			t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_REPLACED, []string{notification.AppId}, toNotification(notification))
+			return notification, ErrReplaced
+		}
+		if apperrors.KindOf(err) != apperrors.KindNotFound {
+			return models.Notification{}, err
+		}
+	}
+	claimedKey := ""
+	if window := time.Duration(config.LoadConfig().NotificationDedupWindowSeconds) * time.Second; window > 0 {
+		key := dedupKey(notification)
+		notification.Id = primitive.NewObjectID()
+		original, claimed := claimDedupKey(key, notification.Id, window, notification.UserId)
+		if !original.IsZero() {
+			metrics.Inc("notifications.deduplicated")
+			logger.Log.Info(logger.LogPayload{
+				Component: "Notification Service",
+				Operation: "Create",
+				Message:   "Skipping duplicate of notification " + original.Hex() + " for userId: " + notification.UserId,
+				UserId:    notification.UserId,
+				AppId:     notification.AppId,
+			})
+			notification.Id = original
+			return notification, ErrDuplicate
+		}
+		if claimed {
+			claimedKey = key
+		}
+	}
+	recordId, err := t.NotificationRepository.Create(ctx, notification)
 	if err != nil {
+		if claimedKey != "" {
+			releaseDedupKey(claimedKey)
+		}
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
 			Operation: "Create",
@@ -146,7 +315,24 @@ func (t *NotificationServiceImpl) Create(notification models.Notification) (prim
 			Error:     err,
 			UserId:    notification.UserId,
 		})
-		return primitive.NilObjectID, err
+		return models.Notification{}, err
+	}
+	notification.Id = recordId
+	if notification, err = t.number(ctx, notification); err != nil {
+		// A notification without a number could be missed by clients, so it is not kept
+		if discardErr := t.NotificationRepository.Discard(ctx, notification.TenantId, notification.UserId, recordId); discardErr != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Notification Service",
+				Operation: "Create",
+				Message:   "Failed to discard unnumbered notification " + recordId.Hex() + " for userId: " + notification.UserId,
+				Error:     discardErr,
+				UserId:    notification.UserId,
+			})
+		}
+		if claimedKey != "" {
+			releaseDedupKey(claimedKey)
+		}
+		return models.Notification{}, err
 	}
 	logger.Log.Info(logger.LogPayload{
 		Component: "Notification Service",
@@ -154,13 +340,14 @@ func (t *NotificationServiceImpl) Create(notification models.Notification) (prim
 		Message:   "Successfully created notification for userId: " + notification.UserId,
 		UserId:    notification.UserId,
 	})
-	return recordId, nil
+	t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_CREATED, []string{notification.AppId}, toNotification(notification))
+	return notification, nil
 }
 
 // MarkAppAsRead marks all notifications of a given application as read for a user
-// given by the user ID. If an error occurs during the operation, the error is
-// returned.
-func (t *NotificationServiceImpl) MarkAppAsRead(userId string, appId string) (err error) {
+// given by the user ID and returns the IDs of the notifications that were unread.
+// If an error occurs during the operation, the error is returned.
+func (t *NotificationServiceImpl) MarkAppAsRead(ctx context.Context, tenantId string, userId string, appId string, correlationId string) (ids []string, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "MarkAppAsRead",
@@ -168,7 +355,11 @@ func (t *NotificationServiceImpl) MarkAppAsRead(userId string, appId string) (er
 		UserId:    userId,
 		AppId:     appId,
 	})
-	err = t.NotificationRepository.MarkAppAsRead(userId, appId)
+	ids, err = t.NotificationRepository.FindIds(ctx, tenantId, userId, appId, "", true)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := t.NotificationRepository.MarkAppAsRead(ctx, tenantId, userId, appId)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
@@ -178,14 +369,18 @@ func (t *NotificationServiceImpl) MarkAppAsRead(userId string, appId string) (er
 			UserId:    userId,
 			AppId:     appId,
 		})
+	} else {
+		t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_READ, []string{appId}, data.NotificationLifecycleChange{UserId: userId, AppId: appId, Scope: data.SCOPE_APP})
+		t.AuditService.Record(models.AuditEntry{Event: data.MARK_APP_AS_READ, UserId: userId, AppId: appId, CorrelationId: correlationId, Affected: affected})
+		return ids, nil
 	}
-	return err
+	return nil, err
 }
 
 // DeleteAppNotifications deletes all notifications of a given application for a user
-// given by the user ID. If an error occurs during the operation, the error is
-// returned.
-func (t *NotificationServiceImpl) DeleteAppNotifications(userId string, appId string) (err error) {
+// given by the user ID and returns the IDs of the deleted notifications.
+// If an error occurs during the operation, the error is returned.
+func (t *NotificationServiceImpl) DeleteAppNotifications(ctx context.Context, tenantId string, userId string, appId string, correlationId string) (ids []string, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "DeleteAppNotifications",
@@ -193,7 +388,11 @@ func (t *NotificationServiceImpl) DeleteAppNotifications(userId string, appId st
 		UserId:    userId,
 		AppId:     appId,
 	})
-	err = t.NotificationRepository.DeleteAppNotifications(userId, appId)
+	ids, err = t.NotificationRepository.FindIds(ctx, tenantId, userId, appId, "", false)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := t.NotificationRepository.DeleteAppNotifications(ctx, tenantId, userId, appId)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
@@ -203,14 +402,20 @@ func (t *NotificationServiceImpl) DeleteAppNotifications(userId string, appId st
 			UserId:    userId,
 			AppId:     appId,
 		})
+	} else {
+		t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_DELETED, []string{appId}, data.NotificationLifecycleChange{UserId: userId, AppId: appId, Scope: data.SCOPE_APP})
+		t.AuditService.Record(models.AuditEntry{Event: data.DELETE_APP_NOTIFICATIONS, UserId: userId, AppId: appId, CorrelationId: correlationId, Affected: affected})
+		return ids, nil
 	}
-	return err
+	return nil, err
 }
 
 // MarkGroupAsRead marks all notifications of a given application and group key
-// as read for a user given by the user ID. If an error occurs during the
+// as read for a user given by the user ID and returns the IDs of the notifications
+// that were unread. The notifications are looked up, marked and audited in a single
+// transaction, so the IDs returned are those marked. If an error occurs during the
 // operation, the error is returned.
-func (t *NotificationServiceImpl) MarkGroupAsRead(userId string, appId string, groupKey string) (err error) {
+func (t *NotificationServiceImpl) MarkGroupAsRead(ctx context.Context, tenantId string, userId string, appId string, groupKey string, correlationId string) (ids []string, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "MarkGroupAsRead",
@@ -218,7 +423,17 @@ func (t *NotificationServiceImpl) MarkGroupAsRead(userId string, appId string, g
 		UserId:    userId,
 		AppId:     appId,
 	})
-	err = t.NotificationRepository.MarkGroupAsRead(userId, appId, groupKey)
+	err = t.Transactor.WithTransaction(ctx, "MarkGroupAsRead", func(ctx context.Context) error {
+		ids, err = t.NotificationRepository.FindIds(ctx, tenantId, userId, appId, groupKey, true)
+		if err != nil {
+			return err
+		}
+		affected, err := t.NotificationRepository.MarkGroupAsRead(ctx, tenantId, userId, appId, groupKey)
+		if err != nil {
+			return err
+		}
+		return t.AuditService.RecordWithin(ctx, models.AuditEntry{Event: data.MARK_GROUP_AS_READ, UserId: userId, AppId: appId, GroupKey: groupKey, CorrelationId: correlationId, Affected: affected})
+	})
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
@@ -228,13 +443,53 @@ func (t *NotificationServiceImpl) MarkGroupAsRead(userId string, appId string, g
 			UserId:    userId,
 			AppId:     appId,
 		})
+		return nil, err
 	}
-	return err
+	t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_READ, []string{appId}, data.NotificationLifecycleChange{UserId: userId, AppId: appId, GroupKey: groupKey, Scope: data.SCOPE_GROUP})
+	return ids, nil
+}
+
+// MarkGroupOpened marks the unread notifications of a given application and group key created at or before
+// openedAt as read for a user given by the user ID, and returns the IDs of the notifications it marked.
+// Notifications that arrived after the user opened the group stay unread. An openedAt in the future is
+// treated as now. If an error occurs during the operation, the error is returned.
+func (t *NotificationServiceImpl) MarkGroupOpened(ctx context.Context, tenantId string, userId string, appId string, groupKey string, openedAt time.Time, correlationId string) ([]string, error) {
+	if now := time.Now(); openedAt.After(now) {
+		openedAt = now
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "Notification Service",
+		Operation:     "MarkGroupOpened",
+		Message:       "Marking group notifications created before " + openedAt.Format(time.RFC3339) + " as read for userId: " + userId + ", appId: " + appId + ", groupKey: " + groupKey,
+		UserId:        userId,
+		AppId:         appId,
+		CorrelationId: correlationId,
+	})
+	ids, err := t.NotificationRepository.MarkGroupAsReadBefore(ctx, tenantId, userId, appId, groupKey, openedAt)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "Notification Service",
+			Operation:     "MarkGroupOpened",
+			Message:       "Failed to mark opened group notifications as read for userId: " + userId + ", appId: " + appId + ", groupKey: " + groupKey,
+			Error:         err,
+			UserId:        userId,
+			AppId:         appId,
+			CorrelationId: correlationId,
+		})
+		return nil, err
+	}
+	if len(ids) > 0 {
+		t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_READ, []string{appId}, data.NotificationLifecycleChange{UserId: userId, AppId: appId, GroupKey: groupKey, Scope: data.SCOPE_GROUP})
+	}
+	t.AuditService.Record(models.AuditEntry{Event: data.GROUP_OPENED, UserId: userId, AppId: appId, GroupKey: groupKey, CorrelationId: correlationId, Affected: int64(len(ids))})
+	return ids, nil
 }
 
 // DeleteGroupNotifications deletes all notifications of a given application and group key
-// for a user given by the user ID. If an error occurs during the operation, the error is returned.
-func (t *NotificationServiceImpl) DeleteGroupNotifications(userId string, appId string, groupKey string) (err error) {
+// for a user given by the user ID and returns the IDs of the deleted notifications.
+// The notifications are looked up, deleted and audited in a single transaction, so the
+// IDs returned are those deleted. If an error occurs during the operation, the error is returned.
+func (t *NotificationServiceImpl) DeleteGroupNotifications(ctx context.Context, tenantId string, userId string, appId string, groupKey string, correlationId string) (ids []string, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "DeleteGroupNotifications",
@@ -242,7 +497,17 @@ func (t *NotificationServiceImpl) DeleteGroupNotifications(userId string, appId
 		UserId:    userId,
 		AppId:     appId,
 	})
-	err = t.NotificationRepository.DeleteGroupNotifications(userId, appId, groupKey)
+	err = t.Transactor.WithTransaction(ctx, "DeleteGroupNotifications", func(ctx context.Context) error {
+		ids, err = t.NotificationRepository.FindIds(ctx, tenantId, userId, appId, groupKey, false)
+		if err != nil {
+			return err
+		}
+		affected, err := t.NotificationRepository.DeleteGroupNotifications(ctx, tenantId, userId, appId, groupKey)
+		if err != nil {
+			return err
+		}
+		return t.AuditService.RecordWithin(ctx, models.AuditEntry{Event: data.DELETE_GROUP_NOTIFICATIONS, UserId: userId, AppId: appId, GroupKey: groupKey, CorrelationId: correlationId, Affected: affected})
+	})
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
@@ -252,20 +517,24 @@ func (t *NotificationServiceImpl) DeleteGroupNotifications(userId string, appId
 			UserId:    userId,
 			AppId:     appId,
 		})
+		return nil, err
 	}
-	return err
+	t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_DELETED, []string{appId}, data.NotificationLifecycleChange{UserId: userId, AppId: appId, GroupKey: groupKey, Scope: data.SCOPE_GROUP})
+	return ids, nil
 }
 
 // MarkNotificationAsRead marks a specific notification as read for a user given by the user ID
-// and notification ID. If an error occurs during the operation, the error is returned.
-func (t *NotificationServiceImpl) MarkNotificationAsRead(userId string, notificationId string) (err error) {
+// and notification ID and returns the updated notification. If an error occurs during the
+// operation, the error is returned.
+func (t *NotificationServiceImpl) MarkNotificationAsRead(ctx context.Context, tenantId string, userId string, notificationId string) (notification data.Notification, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "MarkNotificationAsRead",
 		Message:   "Marking notification as read for userId: " + userId,
 		UserId:    userId,
 	})
-	err = t.NotificationRepository.MarkNotificationAsRead(userId, notificationId)
+	appId := t.findNotificationAppId(ctx, tenantId, userId, notificationId)
+	_, err = t.NotificationRepository.MarkNotificationAsRead(ctx, tenantId, userId, notificationId)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
@@ -274,20 +543,85 @@ func (t *NotificationServiceImpl) MarkNotificationAsRead(userId string, notifica
 			Error:     err,
 			UserId:    userId,
 		})
+	} else {
+		t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_READ, []string{appId}, data.NotificationLifecycleChange{UserId: userId, AppId: appId, NotificationId: notificationId, Scope: data.SCOPE_NOTIFICATION})
+		return t.findUpdatedNotification(ctx, tenantId, userId, notificationId)
 	}
-	return err
+	return data.Notification{}, err
+}
+
+// UpdateStatus moves a notification of the given user to the given status and returns the updated
+// notification. When appId is not empty, only notifications of that app can be updated.
+// It returns a validation error if the status is unknown or the notification cannot move to it from its
+// current status, including when its status was changed concurrently, and a not found error if the
+// notification does not exist.
+func (t *NotificationServiceImpl) UpdateStatus(ctx context.Context, tenantId string, userId string, appId string, notificationId string, status string, correlationId string) (data.Notification, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "Notification Service",
+		Operation:     "UpdateStatus",
+		Message:       "Updating status of notification " + notificationId + " to " + status + " for userId: " + userId,
+		UserId:        userId,
+		AppId:         appId,
+		CorrelationId: correlationId,
+	})
+	if !ValidStatus(status) {
+		return data.Notification{}, apperrors.Validation("unknown notification status "+status, nil)
+	}
+	objID, err := primitive.ObjectIDFromHex(strings.Trim(strings.TrimSpace(notificationId), `"'`))
+	if err != nil {
+		return data.Notification{}, apperrors.Validation("invalid notification id", err)
+	}
+	notification, err := t.NotificationRepository.FindById(ctx, tenantId, objID, userId)
+	if err != nil {
+		return data.Notification{}, err
+	}
+	if appId != "" && notification.AppId != appId {
+		return data.Notification{}, apperrors.NotFound("notification not found")
+	}
+	if !CanTransition(notification.Status, status) {
+		return data.Notification{}, apperrors.Validation("notification status cannot change from "+notification.Status+" to "+status, nil)
+	}
+	affected, err := t.NotificationRepository.UpdateStatus(ctx, tenantId, userId, objID, notification.Status, status)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "Notification Service",
+			Operation:     "UpdateStatus",
+			Message:       "Failed to update status of notification " + notificationId + " for userId: " + userId,
+			Error:         err,
+			UserId:        userId,
+			AppId:         notification.AppId,
+			CorrelationId: correlationId,
+		})
+		return data.Notification{}, err
+	}
+	if affected == 0 {
+		return data.Notification{}, apperrors.Validation("notification status was changed concurrently", nil)
+	}
+	metrics.Inc("notifications.status." + status)
+	t.AuditService.Record(models.AuditEntry{Event: data.UPDATE_NOTIFICATION_STATUS, UserId: userId, AppId: notification.AppId, GroupKey: notification.GroupKey, NotificationId: notification.Id.Hex(), CorrelationId: correlationId, Affected: affected})
+	logger.Log.Info(logger.LogPayload{
+		Component:     "Notification Service",
+		Operation:     "UpdateStatus",
+		Message:       "Moved notification " + notification.Id.Hex() + " from " + notification.Status + " to " + status + " for userId: " + userId,
+		UserId:        userId,
+		AppId:         notification.AppId,
+		CorrelationId: correlationId,
+	})
+	return t.FindById(ctx, tenantId, objID, userId)
 }
 
 // DeleteNotification deletes a specific notification for a user given by the user ID
-// and notification ID. If an error occurs during the operation, the error is returned.
-func (t *NotificationServiceImpl) DeleteNotification(userId string, notificationId string) (err error) {
+// and notification ID and returns its ID if it was deleted. If an error occurs during the
+// operation, the error is returned.
+func (t *NotificationServiceImpl) DeleteNotification(ctx context.Context, tenantId string, userId string, notificationId string, correlationId string) (ids []string, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "DeleteNotification",
 		Message:   "Deleting notification for userId: " + userId,
 		UserId:    userId,
 	})
-	err = t.NotificationRepository.DeleteNotification(userId, notificationId)
+	appId := t.findNotificationAppId(ctx, tenantId, userId, notificationId)
+	affected, err := t.NotificationRepository.DeleteNotification(ctx, tenantId, userId, notificationId)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
@@ -296,20 +630,32 @@ func (t *NotificationServiceImpl) DeleteNotification(userId string, notification
 			Error:     err,
 			UserId:    userId,
 		})
+	} else {
+		t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_DELETED, []string{appId}, data.NotificationLifecycleChange{UserId: userId, AppId: appId, NotificationId: notificationId, Scope: data.SCOPE_NOTIFICATION})
+		t.AuditService.Record(models.AuditEntry{Event: data.DELETE_NOTIFICATION, UserId: userId, AppId: appId, NotificationId: notificationId, CorrelationId: correlationId, Affected: affected})
+		if affected > 0 {
+			ids = []string{notificationId}
+		}
+		return ids, nil
 	}
-	return err
+	return nil, err
 }
 
-// DeleteAllNotifications deletes all notifications for a given user ID.
-// If an error occurs during the operation, the error is returned.
-func (t *NotificationServiceImpl) DeleteNotifications(userId string) (err error) {
+// DeleteAllNotifications deletes all notifications for a given user ID and returns the IDs
+// of the deleted notifications. If an error occurs during the operation, the error is returned.
+func (t *NotificationServiceImpl) DeleteNotifications(ctx context.Context, tenantId string, userId string, correlationId string) (ids []string, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "DeleteNotifications",
 		Message:   "Deleting all notifications for userId: " + userId,
 		UserId:    userId,
 	})
-	err = t.NotificationRepository.DeleteNotifications(userId)
+	appIds, _ := t.NotificationRepository.FindAppIds(ctx, tenantId, userId)
+	ids, err = t.NotificationRepository.FindIds(ctx, tenantId, userId, "", "", false)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := t.NotificationRepository.DeleteNotifications(ctx, tenantId, userId)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
@@ -318,20 +664,29 @@ func (t *NotificationServiceImpl) DeleteNotifications(userId string) (err error)
 			Error:     err,
 			UserId:    userId,
 		})
+	} else {
+		t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_DELETED, appIds, data.NotificationLifecycleChange{UserId: userId, Scope: data.SCOPE_ALL})
+		t.AuditService.Record(models.AuditEntry{Event: data.DELETE_NOTIFICATIONS, UserId: userId, CorrelationId: correlationId, Affected: affected})
+		return ids, nil
 	}
-	return err
+	return nil, err
 }
 
-// MarkAsRead marks all notifications for a given user ID as read. If an error
-// occurs during the operation, the error is returned.
-func (t *NotificationServiceImpl) MarkAsRead(userId string) (err error) {
+// MarkAsRead marks all notifications for a given user ID as read and returns the IDs of the
+// notifications that were unread. If an error occurs during the operation, the error is returned.
+func (t *NotificationServiceImpl) MarkAsRead(ctx context.Context, tenantId string, userId string, correlationId string) (ids []string, err error) {
 	logger.Log.Debug(logger.LogPayload{
 		Component: "Notification Service",
 		Operation: "MarkAsRead",
 		Message:   "Marking all notifications as read for userId: " + userId,
 		UserId:    userId,
 	})
-	err = t.NotificationRepository.MarkAsRead(userId)
+	appIds, _ := t.NotificationRepository.FindAppIds(ctx, tenantId, userId)
+	ids, err = t.NotificationRepository.FindIds(ctx, tenantId, userId, "", "", true)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := t.NotificationRepository.MarkAsRead(ctx, tenantId, userId)
 	if err != nil {
 		logger.Log.Error(logger.LogPayload{
 			Component: "Notification Service",
@@ -340,6 +695,781 @@ func (t *NotificationServiceImpl) MarkAsRead(userId string) (err error) {
 			Error:     err,
 			UserId:    userId,
 		})
+	} else {
+		t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_READ, appIds, data.NotificationLifecycleChange{UserId: userId, Scope: data.SCOPE_ALL})
+		t.AuditService.Record(models.AuditEntry{Event: data.MARK_AS_READ, UserId: userId, CorrelationId: correlationId, Affected: affected})
+		return ids, nil
+	}
+	return nil, err
+}
+
+// Export passes every notification of the given userId matching the query to write, oldest first,
+// including read and soft-deleted notifications that have not been purged. Notifications are streamed
+// from the database one at a time. An error returned by write stops the export and is returned as is.
+func (t *NotificationServiceImpl) Export(ctx context.Context, tenantId string, userId string, query data.NotificationExportQuery, write func(data.ExportedNotification) error) error {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "Export",
+		Message:   "Exporting notifications for userId: " + userId,
+		UserId:    userId,
+		AppId:     query.AppId,
+	})
+	if err := t.Validate.Struct(query); err != nil {
+		return apperrors.Validation("invalid export query", err)
+	}
+	if query.From != nil && query.To != nil && query.To.Before(*query.From) {
+		return apperrors.Validation("to must not be before from", nil)
+	}
+	var exported int64
+	err := t.NotificationRepository.Export(ctx, tenantId, userId, query, func(value models.Notification) error {
+		exported++
+		return write(data.ExportedNotification{
+			Id:          value.Id.Hex(),
+			TenantId:    value.TenantId,
+			AppId:       value.AppId,
+			UserId:      value.UserId,
+			GroupKey:    value.GroupKey,
+			Message:     value.Message,
+			Status:      value.Status,
+			ReadStatus:  value.ReadStatus,
+			CreatedAt:   value.CreatedAt,
+			UpdatedAt:   value.UpdatedAt,
+			DeletedAt:   value.DeletedAt,
+			Actions:     value.Actions,
+			SenderId:    value.SenderId,
+			SenderName:  value.SenderName,
+			Attachments: value.Attachments,
+			UIHints:     value.UIHints,
+		})
+	})
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "Export",
+			Message:   "Failed to export notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return err
+	}
+	metrics.Add("notifications.exported", exported)
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "Export",
+		Message:   fmt.Sprintf("Exported %d notifications for userId: %s", exported, userId),
+		UserId:    userId,
+	})
+	return nil
+}
+
+// Search returns a page of the user's notifications matching the given search query.
+// The query is validated first; a zero page defaults to the first page and a zero page size
+// defaults to data.DEFAULT_SEARCH_PAGE_SIZE. If the query is invalid or the lookup fails,
+// the error is returned.
+func (t *NotificationServiceImpl) Search(ctx context.Context, tenantId string, userId string, query data.NotificationSearchQuery) (data.NotificationSearchResult, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "Search",
+		Message:   "Searching notifications for userId: " + userId,
+		UserId:    userId,
+		AppId:     query.AppId,
+	})
+	if err := t.Validate.Struct(query); err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "Search",
+			Message:   "Invalid search query for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return data.NotificationSearchResult{}, apperrors.Validation("invalid search query", err)
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = data.DEFAULT_SEARCH_PAGE_SIZE
+	}
+
+	result, total, err := t.NotificationRepository.Search(ctx, tenantId, userId, query)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "Search",
+			Message:   "Failed to search notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return data.NotificationSearchResult{}, err
+	}
+
+	items := make([]data.Notification, 0, len(result))
+	for _, value := range result {
+		items = append(items, toNotification(value))
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "Search",
+		Message:   "Successfully searched notifications for userId: " + userId,
+		UserId:    userId,
+	})
+	return data.NotificationSearchResult{
+		Event: data.Event{Event: data.SEARCH_RESULTS},
+		Data: data.NotificationSearchPage{
+			Items:    items,
+			Total:    total,
+			Page:     query.Page,
+			PageSize: query.PageSize,
+		},
+	}, nil
+}
+
+// RestoreDeleted restores the notifications of the requested user that were soft-deleted at or after
+// the requested time and records the restore in the audit log. It returns the number of notifications
+// restored. If the request is invalid or the update fails, the error is returned.
+func (t *NotificationServiceImpl) RestoreDeleted(ctx context.Context, request data.RestoreDeletedRequest, correlationId string) (int64, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "Notification Service",
+		Operation:     "RestoreDeleted",
+		Message:       "Restoring deleted notifications for userId: " + request.UserId,
+		UserId:        request.UserId,
+		CorrelationId: correlationId,
+	})
+	if err := t.Validate.Struct(request); err != nil {
+		return 0, apperrors.Validation("invalid restore request", err)
+	}
+	restored, err := t.NotificationRepository.RestoreDeleted(ctx, request.TenantId, request.UserId, request.Since)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "Notification Service",
+			Operation:     "RestoreDeleted",
+			Message:       "Failed to restore deleted notifications for userId: " + request.UserId,
+			Error:         err,
+			UserId:        request.UserId,
+			CorrelationId: correlationId,
+		})
+		return 0, err
+	}
+	t.AuditService.Record(models.AuditEntry{Event: data.RESTORE_DELETED, UserId: request.UserId, CorrelationId: correlationId, Affected: restored})
+	return restored, nil
+}
+
+// RecordDelivery stores the outcome of the delivery of the notification and its timings on the notification.
+func (t *NotificationServiceImpl) RecordDelivery(ctx context.Context, tenantId string, userId string, notificationId primitive.ObjectID, delivery models.NotificationDelivery, timings models.NotificationTimings) error {
+	return t.NotificationRepository.RecordDelivery(ctx, tenantId, userId, notificationId, delivery, timings)
+}
+
+// PurgeDeleted permanently removes the notifications that were soft-deleted longer ago than the
+// retention period. It returns the number of notifications removed.
+func (t *NotificationServiceImpl) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	return t.NotificationRepository.PurgeDeleted(ctx, time.Now().Add(-retention))
+}
+
+// DeleteExpired permanently removes the notifications of the app with the given read status that were
+// created longer ago than the retention period. It returns the number of notifications removed.
+func (t *NotificationServiceImpl) DeleteExpired(ctx context.Context, appId string, readStatus bool, retention time.Duration) (int64, error) {
+	return t.NotificationRepository.DeleteExpired(ctx, appId, readStatus, time.Now().Add(-retention))
+}
+
+// TriggerAction records that the user clicked the action button given by target.ActionId of the
+// notification given by target.Id, and forwards it to the notification.action webhooks of the source app
+// and, when configured, the action Event Hub. It returns a not found error if the notification does not
+// exist and a validation error if the notification has no such action.
+func (t *NotificationServiceImpl) TriggerAction(ctx context.Context, tenantId string, userId string, target data.NotificationActionTarget, correlationId string) (data.NotificationActionTriggered, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "Notification Service",
+		Operation:     "TriggerAction",
+		Message:       "Triggering action " + target.ActionId + " of notification " + target.Id + " for userId: " + userId,
+		UserId:        userId,
+		CorrelationId: correlationId,
+	})
+	objID, err := primitive.ObjectIDFromHex(strings.Trim(strings.TrimSpace(target.Id), `"'`))
+	if err != nil {
+		return data.NotificationActionTriggered{}, apperrors.Validation("invalid notification id", err)
+	}
+	notification, err := t.NotificationRepository.FindById(ctx, tenantId, objID, userId)
+	if err != nil {
+		return data.NotificationActionTriggered{}, err
+	}
+	var action *models.NotificationAction
+	for i := range notification.Actions {
+		if notification.Actions[i].ActionId == target.ActionId {
+			action = &notification.Actions[i]
+			break
+		}
+	}
+	if action == nil {
+		return data.NotificationActionTriggered{}, apperrors.Validation("unknown action "+target.ActionId, nil)
+	}
+
+	triggered := data.NotificationActionTriggered{
+		NotificationId: notification.Id.Hex(),
+		AppId:          notification.AppId,
+		UserId:         userId,
+		GroupKey:       notification.GroupKey,
+		ActionId:       action.ActionId,
+		Label:          action.Label,
+		Url:            action.Url,
+		TriggeredAt:    time.Now(),
+	}
+	t.AuditService.Record(models.AuditEntry{Event: data.NOTIFICATION_ACTION_TRIGGERED, UserId: userId, AppId: notification.AppId, GroupKey: notification.GroupKey, NotificationId: triggered.NotificationId, ActionId: action.ActionId, CorrelationId: correlationId, Affected: 1})
+	t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_ACTION, []string{notification.AppId}, triggered)
+	if t.ActionPublisher != nil {
+		if err := t.ActionPublisher.Publish(triggered); err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component:     "Notification Service",
+				Operation:     "TriggerAction",
+				Message:       "Failed to publish action " + action.ActionId + " of notification " + triggered.NotificationId,
+				Error:         err,
+				UserId:        userId,
+				AppId:         notification.AppId,
+				CorrelationId: correlationId,
+			})
+		}
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component:     "Notification Service",
+		Operation:     "TriggerAction",
+		Message:       "Successfully triggered action " + action.ActionId + " of notification " + triggered.NotificationId,
+		UserId:        userId,
+		AppId:         notification.AppId,
+		CorrelationId: correlationId,
+	})
+	return triggered, nil
+}
+
+// FindChangedSince returns the notifications of the given userId created or changed at or after the given
+// time, including those marked as read, and the IDs of the notifications deleted since then. It lets a
+// reconnecting client catch up on the changes it missed instead of reloading the full list.
+func (t *NotificationServiceImpl) FindChangedSince(ctx context.Context, tenantId string, userId string, since time.Time) (data.NotificationResume, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "FindChangedSince",
+		Message:   "Fetching notifications changed since " + since.Format(time.RFC3339) + " for userId: " + userId,
+		UserId:    userId,
+	})
+	changed, err := t.NotificationRepository.FindChangedSince(ctx, tenantId, userId, since)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "FindChangedSince",
+			Message:   "Failed to fetch changed notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return data.NotificationResume{}, err
+	}
+	resume := data.NotificationResume{
+		TenantId:      tenantId,
+		UserID:        userId,
+		Since:         since,
+		Notifications: []data.Notification{},
+		DeletedIds:    []string{},
+	}
+	for _, value := range changed {
+		if value.DeletedAt != nil {
+			resume.DeletedIds = append(resume.DeletedIds, value.Id.Hex())
+			continue
+		}
+		resume.Notifications = append(resume.Notifications, toNotification(value))
+	}
+	return resume, nil
+}
+
+// FindSince returns a page of the notifications of the given userId changed after the position of the query,
+// including those marked as read, and the IDs of the notifications deleted since then. It lets clients that
+// keep a local cache fetch only what changed instead of reloading the full list. Pages hold up to
+// data.DEFAULT_SINCE_LIMIT notifications unless the query sets a limit. It returns a validation error if the
+// query is invalid.
+func (t *NotificationServiceImpl) FindSince(ctx context.Context, tenantId string, userId string, query data.NotificationsSinceQuery) (data.NotificationsSince, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "FindSince",
+		Message:   "Fetching notifications changed since " + query.Since.Format(time.RFC3339Nano) + " for userId: " + userId,
+		UserId:    userId,
+	})
+	if err := t.Validate.Struct(query); err != nil {
+		return data.NotificationsSince{}, apperrors.Validation("invalid notifications since query", err)
+	}
+	var afterId primitive.ObjectID
+	if query.AfterId != "" {
+		id, err := primitive.ObjectIDFromHex(query.AfterId)
+		if err != nil {
+			return data.NotificationsSince{}, apperrors.Validation("invalid afterId", err)
+		}
+		afterId = id
+	}
+	limit := query.Limit
+	if limit == 0 {
+		limit = data.DEFAULT_SINCE_LIMIT
+	}
+
+	// One more notification than the page holds tells whether another page follows
+	changed, err := t.NotificationRepository.FindSince(ctx, tenantId, userId, query.Since, afterId, limit+1)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "FindSince",
+			Message:   "Failed to fetch changed notifications for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return data.NotificationsSince{}, err
+	}
+	page := data.NotificationsSincePage{
+		Notifications: []data.Notification{},
+		DeletedIds:    []string{},
+		NextSince:     query.Since,
+		NextAfterId:   query.AfterId,
+	}
+	if len(changed) > limit {
+		changed = changed[:limit]
+		page.HasMore = true
+	}
+	for _, value := range changed {
+		if value.DeletedAt != nil {
+			page.DeletedIds = append(page.DeletedIds, value.Id.Hex())
+		} else {
+			page.Notifications = append(page.Notifications, toNotification(value))
+		}
+		page.NextSince = value.UpdatedAt
+		page.NextAfterId = value.Id.Hex()
+	}
+	return data.NotificationsSince{
+		Event: data.Event{Event: data.NOTIFICATIONS_SINCE},
+		Data:  page,
+	}, nil
+}
+
+// FindAfterSequence returns a page of the notifications of the given userId numbered after the sequence
+// number of the query, in sequence order. It lets clients that noticed a gap in the sequence numbers of the
+// notifications they received fetch only the missing ones. Pages hold up to data.DEFAULT_SINCE_LIMIT
+// notifications unless the query sets a limit. The last sequence number of the page is the one to resume
+// from: the number of the last notification returned, or the requested one when none is. It is never raised
+// to the counter, whose latest numbers may belong to notifications still being stored, which would then be
+// skipped. It returns a validation error if the query is invalid.
+func (t *NotificationServiceImpl) FindAfterSequence(ctx context.Context, tenantId string, userId string, query data.SequenceResyncQuery) (data.SequenceResync, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "FindAfterSequence",
+		Message:   fmt.Sprintf("Fetching notifications after sequence %d for userId: %s", query.AfterSequence, userId),
+		UserId:    userId,
+	})
+	if err := t.Validate.Struct(query); err != nil {
+		return data.SequenceResync{}, apperrors.Validation("invalid sequence resync query", err)
+	}
+	limit := query.Limit
+	if limit == 0 {
+		limit = data.DEFAULT_SINCE_LIMIT
+	}
+
+	// One more notification than the page holds tells whether another page follows
+	missing, err := t.NotificationRepository.FindAfterSequence(ctx, tenantId, userId, query.AfterSequence, limit+1)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "FindAfterSequence",
+			Message:   "Failed to fetch notifications after sequence for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return data.SequenceResync{}, err
+	}
+	page := data.SequenceResyncPage{
+		Notifications: []data.Notification{},
+		LastSequence:  query.AfterSequence,
+	}
+	if len(missing) > limit {
+		missing = missing[:limit]
+		page.HasMore = true
+	}
+	for _, value := range missing {
+		page.Notifications = append(page.Notifications, toNotification(value))
+		page.LastSequence = value.Sequence
+	}
+	return data.SequenceResync{
+		Event: data.Event{Event: data.SEQUENCE_RESYNC},
+		Data:  page,
+	}, nil
+}
+
+// LastSequence returns the highest sequence number of the stored notifications of the given userId, 0 if none
+// is numbered. Numbers of notifications that have since been deleted or replaced are left out, so clients
+// resyncing up to it are sent every notification they can still receive.
+// If an error occurs while reading the notifications, the error is returned.
+func (t *NotificationServiceImpl) LastSequence(ctx context.Context, tenantId string, userId string) (int64, error) {
+	sequence, err := t.NotificationRepository.FindLastSequence(ctx, tenantId, userId)
+	if err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "LastSequence",
+			Message:   "Failed to read the last sequence number for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return 0, err
+	}
+	return sequence, nil
+}
+
+// SyncReadState merges the read status changes a client made while offline with the stored read state of
+// the given user's notifications, the last write winning, and returns the authoritative state of the
+// notifications after the merge. When a notification is changed more than once, only its latest change is
+// kept. Change times in the future are moved to now, so a client with a fast clock cannot override every
+// later change. It returns a validation error if a notification ID is invalid.
+func (t *NotificationServiceImpl) SyncReadState(ctx context.Context, tenantId string, userId string, request data.SyncReadStateRequest, correlationId string) (data.ReadStateSyncResult, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "Notification Service",
+		Operation:     "SyncReadState",
+		Message:       fmt.Sprintf("Syncing %d read state changes for userId: %s", len(request.Changes), userId),
+		UserId:        userId,
+		CorrelationId: correlationId,
+	})
+	now := time.Now()
+	changes := make([]models.ReadStateChange, 0, len(request.Changes))
+	index := make(map[primitive.ObjectID]int, len(request.Changes))
+	for _, change := range request.Changes {
+		objID, err := primitive.ObjectIDFromHex(strings.Trim(strings.TrimSpace(change.NotificationId), `"'`))
+		if err != nil {
+			return data.ReadStateSyncResult{}, apperrors.Validation("invalid notification id "+change.NotificationId, err)
+		}
+		readAt := change.ReadAt
+		if readAt.After(now) {
+			readAt = now
+		}
+		if i, ok := index[objID]; ok {
+			if readAt.After(changes[i].ReadAt) {
+				changes[i] = models.ReadStateChange{Id: objID, ReadStatus: change.ReadStatus, ReadAt: readAt}
+			}
+			continue
+		}
+		index[objID] = len(changes)
+		changes = append(changes, models.ReadStateChange{Id: objID, ReadStatus: change.ReadStatus, ReadAt: readAt})
+	}
+
+	applied, notifications, err := t.NotificationRepository.SyncReadState(ctx, tenantId, userId, changes)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "Notification Service",
+			Operation:     "SyncReadState",
+			Message:       "Failed to sync read state for userId: " + userId,
+			Error:         err,
+			UserId:        userId,
+			CorrelationId: correlationId,
+		})
+		return data.ReadStateSyncResult{}, err
+	}
+
+	result := data.ReadStateSyncResult{
+		TenantId:      tenantId,
+		UserID:        userId,
+		Applied:       applied,
+		Notifications: make([]data.Notification, len(changes)),
+		Missing:       []string{},
+	}
+	found := make([]bool, len(changes))
+	for _, value := range notifications {
+		i := index[value.Id]
+		result.Notifications[i] = toNotification(value)
+		found[i] = true
+	}
+	// Keep the notifications in the order of the changes and list the ones that were not found.
+	kept := result.Notifications[:0]
+	for i, notification := range result.Notifications {
+		if !found[i] {
+			result.Missing = append(result.Missing, changes[i].Id.Hex())
+			continue
+		}
+		kept = append(kept, notification)
+	}
+	result.Notifications = kept
+
+	appliedIds := make(map[string]bool, len(applied))
+	for _, id := range applied {
+		appliedIds[id] = true
+	}
+	for _, notification := range result.Notifications {
+		if appliedIds[notification.Id] && notification.ReadStatus {
+			t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_READ, []string{notification.AppId}, data.NotificationLifecycleChange{UserId: userId, AppId: notification.AppId, NotificationId: notification.Id, Scope: data.SCOPE_NOTIFICATION})
+		}
+	}
+	metrics.Add("notifications.readstate.applied", int64(len(applied)))
+	metrics.Add("notifications.readstate.superseded", int64(len(result.Notifications)-len(applied)))
+	t.AuditService.Record(models.AuditEntry{Event: data.SYNC_READ_STATE, UserId: userId, CorrelationId: correlationId, Affected: int64(len(applied))})
+	logger.Log.Info(logger.LogPayload{
+		Component:     "Notification Service",
+		Operation:     "SyncReadState",
+		Message:       fmt.Sprintf("Synced read state for userId: %s | Changes: %d | Applied: %d | Missing: %d", userId, len(changes), len(applied), len(result.Missing)),
+		UserId:        userId,
+		CorrelationId: correlationId,
+	})
+	return result, nil
+}
+
+// SetPinned pins or unpins a notification of the given user and returns the updated notification. Pinned
+// notifications are listed first and are left out of the operations marking or deleting all notifications of
+// the user, an app or a group. A user can pin at most PIN_LIMIT_PER_USER notifications; pinning more returns
+// a validation error. Pinning a pinned notification, or unpinning one that is not pinned, changes nothing.
+// It returns a not found error if the notification does not exist.
+func (t *NotificationServiceImpl) SetPinned(ctx context.Context, tenantId string, userId string, notificationId string, pinned bool, correlationId string) (data.Notification, error) {
+	event := data.UNPIN_NOTIFICATION
+	if pinned {
+		event = data.PIN_NOTIFICATION
+	}
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "Notification Service",
+		Operation:     "SetPinned",
+		Message:       fmt.Sprintf("Setting pinned to %t on notification %s for userId: %s", pinned, notificationId, userId),
+		UserId:        userId,
+		CorrelationId: correlationId,
+	})
+	objID, err := primitive.ObjectIDFromHex(strings.Trim(strings.TrimSpace(notificationId), `"'`))
+	if err != nil {
+		return data.Notification{}, apperrors.Validation("invalid notification id", err)
+	}
+	notification, err := t.NotificationRepository.FindById(ctx, tenantId, objID, userId)
+	if err != nil {
+		return data.Notification{}, err
+	}
+	if notification.Pinned == pinned {
+		return toNotification(notification), nil
+	}
+	if limit := config.LoadConfig().PinLimitPerUser; pinned && limit > 0 {
+		count, err := t.NotificationRepository.CountPinned(ctx, tenantId, userId)
+		if err != nil {
+			return data.Notification{}, err
+		}
+		if count >= int64(limit) {
+			metrics.Inc("notifications.pin.limit_reached")
+			return data.Notification{}, apperrors.Validation(fmt.Sprintf("cannot pin more than %d notifications", limit), nil)
+		}
+	}
+	affected, err := t.NotificationRepository.SetPinned(ctx, tenantId, userId, objID, pinned)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component:     "Notification Service",
+			Operation:     "SetPinned",
+			Message:       "Failed to set pinned on notification " + notificationId + " for userId: " + userId,
+			Error:         err,
+			UserId:        userId,
+			AppId:         notification.AppId,
+			CorrelationId: correlationId,
+		})
+		return data.Notification{}, err
+	}
+	t.AuditService.Record(models.AuditEntry{Event: event, UserId: userId, AppId: notification.AppId, GroupKey: notification.GroupKey, NotificationId: notification.Id.Hex(), CorrelationId: correlationId, Affected: affected})
+	return t.FindById(ctx, tenantId, objID, userId)
+}
+
+// ClaimDueReminders returns at most limit unread notifications whose reminder is due at the given time, after
+// recording that their reminder was sent. Reminders claimed by another instance in the meantime are left out,
+// so each reminder is returned by a single instance. Notifications that expired before their reminder was due
+// are never reminded.
+func (t *NotificationServiceImpl) ClaimDueReminders(ctx context.Context, now time.Time, limit int) ([]data.Notification, error) {
+	due, err := t.NotificationRepository.FindDueReminders(ctx, now, limit)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "ClaimDueReminders",
+			Message:   "Failed to fetch notifications to remind",
+			Error:     err,
+		})
+		return nil, err
+	}
+	claimed := make([]data.Notification, 0, len(due))
+	for _, notification := range due {
+		affected, err := t.NotificationRepository.MarkReminded(ctx, notification.Id, now)
+		if err != nil {
+			return claimed, err
+		}
+		if affected > 0 {
+			claimed = append(claimed, toNotification(notification))
+		}
+	}
+	return claimed, nil
+}
+
+// SummarizeGroup returns the summary of the unread notifications of the group of the given notification,
+// which is taken as the latest of them: their count, the message, status and sequence number of the
+// notification and the creation time of the oldest unread one. If an error occurs while counting, the error
+// is returned.
+func (t *NotificationServiceImpl) SummarizeGroup(ctx context.Context, notification models.Notification) (data.GroupSummary, error) {
+	count, err := t.NotificationRepository.CountUnreadInGroup(ctx, notification.TenantId, notification.UserId, notification.AppId, notification.GroupKey)
+	if err != nil {
+		return data.GroupSummary{}, err
+	}
+	earliestUnreadAt := count.OldestAt
+	if count.Count == 0 || notification.CreatedAt.Before(earliestUnreadAt) {
+		earliestUnreadAt = notification.CreatedAt
+	}
+	return data.GroupSummary{
+		TenantId:         notification.TenantId,
+		UserID:           notification.UserId,
+		AppId:            notification.AppId,
+		GroupKey:         notification.GroupKey,
+		Count:            count.Count,
+		LatestId:         notification.Id.Hex(),
+		LatestMessage:    notification.Message,
+		LatestStatus:     notification.Status,
+		LatestSequence:   notification.Sequence,
+		EarliestUnreadAt: earliestUnreadAt,
+	}, nil
+}
+
+// Stats returns the statistics of the notifications of the given userId: the total, read and unread
+// counts with their ratios, the age of the oldest unread notification, and the counts per appId,
+// per appId and groupKey, per status and per source type. Deleted notifications are not counted.
+func (t *NotificationServiceImpl) Stats(ctx context.Context, tenantId string, userId string) (data.NotificationStats, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Notification Service",
+		Operation: "Stats",
+		Message:   "Computing notification statistics for userId: " + userId,
+		UserId:    userId,
+	})
+	counts, err := t.NotificationRepository.CountByGroup(ctx, tenantId, userId)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "Stats",
+			Message:   "Failed to compute notification statistics for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return data.NotificationStats{}, err
+	}
+
+	stats := data.NotificationStats{UserId: userId}
+	apps := newStatsCounter()
+	groups := newStatsCounter()
+	statuses := newStatsCounter()
+	sources := newStatsCounter()
+	for _, count := range counts {
+		add := func(value *data.NotificationStatsCount) {
+			value.Total += count.Count
+			if count.ReadStatus {
+				value.Read += count.Count
+			} else {
+				value.Unread += count.Count
+			}
+		}
+		add(apps.get(data.NotificationStatsCount{AppId: count.AppId}))
+		add(groups.get(data.NotificationStatsCount{AppId: count.AppId, GroupKey: count.GroupKey}))
+		add(statuses.get(data.NotificationStatsCount{Status: count.Status}))
+		source := count.Source
+		if source == "" {
+			source = data.SOURCE_UNKNOWN
+		}
+		add(sources.get(data.NotificationStatsCount{Source: source}))
+		stats.Total += count.Count
+		if count.ReadStatus {
+			stats.Read += count.Count
+		} else {
+			stats.Unread += count.Count
+			if stats.OldestUnreadAt == nil || count.OldestAt.Before(*stats.OldestUnreadAt) {
+				oldest := count.OldestAt
+				stats.OldestUnreadAt = &oldest
+			}
+		}
+	}
+	if stats.Total > 0 {
+		stats.ReadRatio = float64(stats.Read) / float64(stats.Total)
+		stats.UnreadRatio = float64(stats.Unread) / float64(stats.Total)
+	}
+	if stats.OldestUnreadAt != nil {
+		stats.OldestUnreadAgeSeconds = int64(time.Since(*stats.OldestUnreadAt).Seconds())
+	}
+	stats.Apps = apps.values
+	stats.Groups = groups.values
+	stats.Statuses = statuses.values
+	stats.Sources = sources.values
+	return stats, nil
+}
+
+// statsCounter accumulates notification counts per key, keeping the order in which keys were first seen.
+type statsCounter struct {
+	index  map[data.NotificationStatsCount]int
+	values []data.NotificationStatsCount
+}
+
+func newStatsCounter() *statsCounter {
+	return &statsCounter{index: map[data.NotificationStatsCount]int{}, values: []data.NotificationStatsCount{}}
+}
+
+// get returns the count for the key, which only has its appId, groupKey, status and source set.
+func (c *statsCounter) get(key data.NotificationStatsCount) *data.NotificationStatsCount {
+	i, ok := c.index[key]
+	if !ok {
+		i = len(c.values)
+		c.index[key] = i
+		c.values = append(c.values, key)
+	}
+	return &c.values[i]
+}
+
+// toNotification converts a notification model into its data.Notification representation.
+func toNotification(value models.Notification) data.Notification {
+	return data.Notification{
+		Id:              value.Id.Hex(),
+		TenantId:        value.TenantId,
+		AppId:           value.AppId,
+		GroupKey:        value.GroupKey,
+		Message:         value.Message,
+		ReadStatus:      value.ReadStatus,
+		UserID:          value.UserId,
+		Status:          value.Status,
+		CreatedAt:       value.CreatedAt,
+		UpdatedAt:       value.UpdatedAt,
+		Actions:         value.Actions,
+		ReadAt:          value.ReadAt,
+		SenderId:        value.SenderId,
+		SenderName:      value.SenderName,
+		SenderAvatarUrl: value.SenderAvatarUrl,
+		CollapseKey:     value.CollapseKey,
+		Attachments:     value.Attachments,
+		UIHints:         value.UIHints,
+		ExpiresAt:       value.ExpiresAt,
+		RemindAt:        value.RemindAt,
+		Truncated:       value.Truncated,
+		ParentId:        value.ParentId,
+		Pinned:          value.Pinned,
+		Sequence:        value.Sequence,
+	}
+}
+
+// dispatchLifecycleEvent forwards a notification lifecycle event to the webhooks of each given appId.
+// Lifecycle changes that are not scoped to an app are reported to every app the change affects.
+func (t *NotificationServiceImpl) dispatchLifecycleEvent(event string, appIds []string, payload interface{}) {
+	if t.WebhookService == nil {
+		return
+	}
+	for _, appId := range appIds {
+		if change, ok := payload.(data.NotificationLifecycleChange); ok && change.AppId == "" {
+			change.AppId = appId
+			t.WebhookService.Dispatch(event, appId, change)
+			continue
+		}
+		t.WebhookService.Dispatch(event, appId, payload)
+	}
+}
+
+// findUpdatedNotification returns the given notification after an update.
+func (t *NotificationServiceImpl) findUpdatedNotification(ctx context.Context, tenantId string, userId string, notificationId string) (data.Notification, error) {
+	objID, err := primitive.ObjectIDFromHex(strings.Trim(strings.TrimSpace(notificationId), `"'`))
+	if err != nil {
+		return data.Notification{}, apperrors.Validation("invalid notification id", err)
+	}
+	return t.FindById(ctx, tenantId, objID, userId)
+}
+
+// findNotificationAppId returns the appId of the given notification, or an empty string if it cannot be found.
+func (t *NotificationServiceImpl) findNotificationAppId(ctx context.Context, tenantId string, userId string, notificationId string) string {
+	objID, err := primitive.ObjectIDFromHex(strings.Trim(strings.TrimSpace(notificationId), `"'`))
+	if err != nil {
+		return ""
+	}
+	notification, err := t.NotificationRepository.FindById(ctx, tenantId, objID, userId)
+	if err != nil {
+		return ""
 	}
-	return err
+	return notification.AppId
 }
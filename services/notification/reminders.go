@@ -0,0 +1,34 @@
+package notificationService
+
+import (
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/models"
+	"time"
+)
+
+// ScheduleReminder returns the notification with its reminder time set REMINDER_LEAD_SECONDS before its
+// expiry, when it expires and was not given a reminder time. The notification is returned as is otherwise,
+// or when the lead time is 0.
+func ScheduleReminder(notification models.Notification) models.Notification {
+	lead := time.Duration(config.LoadConfig().ReminderLeadSeconds) * time.Second
+	if notification.ExpiresAt == nil || notification.RemindAt != nil || lead <= 0 {
+		return notification
+	}
+	remindAt := notification.ExpiresAt.Add(-lead)
+	notification.RemindAt = &remindAt
+	return notification
+}
+
+// ValidateReminder checks the expiry and reminder time of a new notification, if any: the notification must
+// not have expired already and is reminded before it expires. A reminder time in the past sends the reminder
+// at once. It returns a validation error describing the first invalid time.
+func ValidateReminder(notification models.Notification) error {
+	if notification.ExpiresAt != nil && !notification.ExpiresAt.After(time.Now()) {
+		return apperrors.Validation("expiresAt must be in the future", nil)
+	}
+	if notification.ExpiresAt != nil && notification.RemindAt != nil && !notification.RemindAt.Before(*notification.ExpiresAt) {
+		return apperrors.Validation("remindAt must be before expiresAt", nil)
+	}
+	return nil
+}
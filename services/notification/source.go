@@ -0,0 +1,26 @@
+package notificationService
+
+import (
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/models"
+)
+
+// Maximum length of the producing service and instance of a notification source.
+const maxSourceLength = 100
+
+// ValidateSource checks the source of a new notification, if any: the producing service and instance given by
+// the publisher are at most 100 characters. Publishers over REST are validated with the request, while Event
+// Hub and Service Bus payloads and transformed events are only checked here.
+func ValidateSource(source *models.NotificationSource) error {
+	if source == nil {
+		return nil
+	}
+	if len(source.Service) > maxSourceLength {
+		return apperrors.Validation(fmt.Sprintf("sourceService must not exceed %d characters", maxSourceLength), nil)
+	}
+	if len(source.Instance) > maxSourceLength {
+		return apperrors.Validation(fmt.Sprintf("sourceInstance must not exceed %d characters", maxSourceLength), nil)
+	}
+	return nil
+}
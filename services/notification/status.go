@@ -0,0 +1,27 @@
+package notificationService
+
+import (
+	"r2-notify-server/data"
+	"slices"
+)
+
+// statusTransitions lists the statuses each status can move to. Success is final, a failed notification
+// can be retried, and info notifications carry no progress so their status cannot be changed.
+var statusTransitions = map[string][]string{
+	data.STATUS_PENDING:     {data.STATUS_IN_PROGRESS, data.STATUS_SUCCESS, data.STATUS_FAILED},
+	data.STATUS_IN_PROGRESS: {data.STATUS_SUCCESS, data.STATUS_FAILED},
+	data.STATUS_FAILED:      {data.STATUS_PENDING, data.STATUS_IN_PROGRESS},
+	data.STATUS_SUCCESS:     {},
+	data.STATUS_INFO:        {},
+}
+
+// ValidStatus reports whether the given status is a known notification status.
+func ValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether a notification with the from status can be moved to the to status.
+func CanTransition(from string, to string) bool {
+	return slices.Contains(statusTransitions[from], to)
+}
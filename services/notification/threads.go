@@ -0,0 +1,97 @@
+package notificationService
+
+import (
+	"context"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// resolveThread checks the parent of a new follow-up, which must be a notification of the same user, and
+// returns the notification attached to the root of the parent's thread, so threads are one level deep.
+// Notifications without a parent are returned as they are.
+func (t *NotificationServiceImpl) resolveThread(ctx context.Context, notification models.Notification) (models.Notification, error) {
+	if notification.ParentId == "" {
+		return notification, nil
+	}
+	parentId, err := primitive.ObjectIDFromHex(notification.ParentId)
+	if err != nil {
+		return notification, apperrors.Validation("invalid parentId", err)
+	}
+	parent, err := t.NotificationRepository.FindById(ctx, notification.TenantId, parentId, notification.UserId)
+	if apperrors.Is(err, apperrors.KindNotFound) {
+		return notification, apperrors.Validation("parent notification "+notification.ParentId+" not found", nil)
+	}
+	if err != nil {
+		return notification, err
+	}
+	if parent.ParentId != "" {
+		notification.ParentId = parent.ParentId
+	}
+	return notification, nil
+}
+
+// withReplyCounts sets the number of follow-ups, and of unread follow-ups, of the thread roots of the list.
+// The list is returned without counts if they cannot be fetched, so the user still gets the notifications.
+func (t NotificationServiceImpl) withReplyCounts(ctx context.Context, tenantId string, userId string, notifications []data.Notification) []data.Notification {
+	rootIds := make([]string, 0, len(notifications))
+	for _, notification := range notifications {
+		if notification.ParentId == "" {
+			rootIds = append(rootIds, notification.Id)
+		}
+	}
+	if len(rootIds) == 0 {
+		return notifications
+	}
+	counts, err := t.NotificationRepository.CountReplies(ctx, tenantId, userId, rootIds)
+	if err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "CountReplies",
+			Message:   "Sending notifications of userId: " + userId + " without reply counts",
+			Error:     err,
+			UserId:    userId,
+		})
+		return notifications
+	}
+	byRoot := make(map[string]models.ThreadCount, len(counts))
+	for _, count := range counts {
+		byRoot[count.RootId] = count
+	}
+	for i := range notifications {
+		if count, ok := byRoot[notifications[i].Id]; ok {
+			notifications[i].ReplyCount = count.Replies
+			notifications[i].UnreadReplyCount = count.Unread
+		}
+	}
+	return notifications
+}
+
+// MarkThreadAsRead marks a notification of the user as read together with its unread follow-ups, and returns
+// the updated notification with the IDs of the follow-ups it marked. Pinned follow-ups are left unread, and
+// marking a follow-up only marks the follow-up itself.
+func (t *NotificationServiceImpl) MarkThreadAsRead(ctx context.Context, tenantId string, userId string, notificationId string) (data.Notification, []string, error) {
+	notification, err := t.MarkNotificationAsRead(ctx, tenantId, userId, notificationId)
+	if err != nil || notification.ParentId != "" {
+		return notification, []string{}, err
+	}
+	ids, err := t.NotificationRepository.MarkThreadAsRead(ctx, tenantId, userId, notification.Id)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Notification Service",
+			Operation: "MarkThreadAsRead",
+			Message:   "Failed to mark follow-ups of notification " + notification.Id + " as read for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+			AppId:     notification.AppId,
+		})
+		return notification, nil, err
+	}
+	if len(ids) > 0 {
+		t.dispatchLifecycleEvent(data.WEBHOOK_NOTIFICATION_READ, []string{notification.AppId}, data.NotificationLifecycleChange{UserId: userId, AppId: notification.AppId, NotificationId: notification.Id, Scope: data.SCOPE_THREAD})
+	}
+	return notification, ids, nil
+}
@@ -0,0 +1,42 @@
+package notificationService
+
+import (
+	"encoding/json"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/models"
+	"regexp"
+)
+
+// Names of icons and sounds bundled with the clients, as opposed to URLs.
+var uiHintName = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,100}$`)
+
+// Colors in #RGB, #RRGGBB or #RRGGBBAA notation.
+var uiHintColor = regexp.MustCompile(`^#([0-9A-Fa-f]{3}|[0-9A-Fa-f]{6}|[0-9A-Fa-f]{8})$`)
+
+// ValidateUIHints checks the UI hints of a new notification, if any: the icon and sound are either a name of
+// up to 100 letters, digits and ._:- or an http or https URL, the color is a hex color and the hints take at
+// most MAX_UI_HINTS_SIZE bytes encoded as JSON. It returns a validation error describing the first invalid hint.
+func ValidateUIHints(hints *models.NotificationUIHints) error {
+	if hints == nil {
+		return nil
+	}
+	if hints.Icon != "" && !uiHintName.MatchString(hints.Icon) && !webURL(hints.Icon) {
+		return apperrors.Validation("uiHints.icon must be an icon name or an http or https url", nil)
+	}
+	if hints.Color != "" && !uiHintColor.MatchString(hints.Color) {
+		return apperrors.Validation(fmt.Sprintf("uiHints.color must be a hex color like #1e88e5, got %q", hints.Color), nil)
+	}
+	if hints.Sound != "" && !uiHintName.MatchString(hints.Sound) && !webURL(hints.Sound) {
+		return apperrors.Validation("uiHints.sound must be a sound name or an http or https url", nil)
+	}
+	encoded, err := json.Marshal(hints)
+	if err != nil {
+		return apperrors.Validation("invalid uiHints", err)
+	}
+	if len(encoded) > data.MAX_UI_HINTS_SIZE {
+		return apperrors.Validation(fmt.Sprintf("uiHints must not exceed %d bytes", data.MAX_UI_HINTS_SIZE), nil)
+	}
+	return nil
+}
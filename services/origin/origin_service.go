@@ -0,0 +1,13 @@
+package originService
+
+import (
+	"r2-notify-server/data"
+)
+
+type OriginService interface {
+	FindAll() ([]data.AppOrigins, error)
+	FindByAppId(appId string) (data.AppOrigins, error)
+	Update(appId string, request data.UpdateAppOriginsRequest) (data.AppOrigins, error)
+	Delete(appId string) error
+	IsAllowed(appId string, origin string) bool
+}
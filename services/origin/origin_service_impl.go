@@ -0,0 +1,174 @@
+package originService
+
+import (
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	originRepository "r2-notify-server/repository/origin"
+	"r2-notify-server/utils"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// cachedOrigins is the origin allow-list of an app as last read from the database. Apps without an
+// allow-list are cached with no origins, so unknown appIds do not reach the database on every connection.
+type cachedOrigins struct {
+	origins  []string
+	loadedAt time.Time
+}
+
+type OriginServiceImpl struct {
+	OriginRepository originRepository.OriginRepository
+	Validate         *validator.Validate
+
+	cacheTTL   time.Duration
+	cache      map[string]cachedOrigins
+	cacheMutex sync.RWMutex
+}
+
+// NewOriginServiceImpl returns a new instance of OriginService with the provided OriginRepository
+// and validator.Validate instance. Allow-lists are cached for ORIGIN_CACHE_TTL_SECONDS.
+// If the validator instance is nil, an error is returned.
+func NewOriginServiceImpl(originRepository originRepository.OriginRepository, validate *validator.Validate) (service OriginService, err error) {
+	if validate == nil {
+		return nil, apperrors.Internal("validator instance cannot be nil", nil)
+	}
+	return &OriginServiceImpl{
+		OriginRepository: originRepository,
+		Validate:         validate,
+		cacheTTL:         time.Duration(config.LoadConfig().OriginCacheTTLSeconds) * time.Second,
+		cache:            make(map[string]cachedOrigins),
+	}, err
+}
+
+// FindAll returns the origin allow-lists of every app.
+func (t *OriginServiceImpl) FindAll() ([]data.AppOrigins, error) {
+	appOrigins, err := t.OriginRepository.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]data.AppOrigins, 0, len(appOrigins))
+	for _, value := range appOrigins {
+		result = append(result, toAppOrigins(value))
+	}
+	return result, nil
+}
+
+// FindByAppId returns the origin allow-list of the given appId, or a not found error if it has none.
+func (t *OriginServiceImpl) FindByAppId(appId string) (data.AppOrigins, error) {
+	appOrigins, err := t.OriginRepository.FindByAppId(appId)
+	if err != nil {
+		return data.AppOrigins{}, err
+	}
+	return toAppOrigins(appOrigins), nil
+}
+
+// Update replaces the origin allow-list of the given appId. Each origin must be scheme://host[:port],
+// optionally with a "*." wildcard label at the start of the host; "*" alone is rejected so an app cannot
+// allow every origin. The cached allow-list of this instance is dropped, other instances pick up the
+// change when their cache expires.
+func (t *OriginServiceImpl) Update(appId string, request data.UpdateAppOriginsRequest) (data.AppOrigins, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Origin Service",
+		Operation: "Update",
+		Message:   "Updating origin allow-list for appId: " + appId,
+		AppId:     appId,
+	})
+	if err := t.Validate.Struct(request); err != nil {
+		return data.AppOrigins{}, apperrors.Validation("invalid origin allow-list", err)
+	}
+	origins := make([]string, 0, len(request.Origins))
+	for _, origin := range request.Origins {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if !utils.ValidOriginPattern(origin) {
+			return data.AppOrigins{}, apperrors.Validation("invalid origin "+origin+", expected scheme://host[:port] or scheme://*.host[:port]", nil)
+		}
+		if !slices.Contains(origins, origin) {
+			origins = append(origins, origin)
+		}
+	}
+	appOrigins := models.AppOrigins{AppId: appId, Origins: origins, UpdatedAt: time.Now()}
+	if err := t.OriginRepository.Upsert(appOrigins); err != nil {
+		return data.AppOrigins{}, err
+	}
+	t.invalidate(appId)
+	return toAppOrigins(appOrigins), nil
+}
+
+// Delete removes the origin allow-list of the given appId, so its connections are only accepted from
+// ALLOWED_ORIGINS. It returns a not found error if the app has no allow-list.
+func (t *OriginServiceImpl) Delete(appId string) error {
+	if err := t.OriginRepository.Delete(appId); err != nil {
+		return err
+	}
+	t.invalidate(appId)
+	return nil
+}
+
+// IsAllowed reports whether the origin matches the allow-list of the given appId. Allow-lists are served
+// from the cache while it is fresh. When the allow-list cannot be read, the expired cache entry is used if
+// there is one, otherwise the origin is refused.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *OriginServiceImpl) IsAllowed(appId string, origin string) bool {
+	origins, ok := t.lookup(appId)
+	if !ok {
+		return false
+	}
+	return slices.ContainsFunc(origins, func(pattern string) bool { return utils.MatchOrigin(pattern, origin) })
+}
+
+// lookup returns the allow-list of the app, reading it from the database when it is not cached or has
+// expired. It returns false if the allow-list is neither cached nor readable.
+func (t *OriginServiceImpl) lookup(appId string) ([]string, bool) {
+	t.cacheMutex.RLock()
+	cached, cachedOk := t.cache[appId]
+	t.cacheMutex.RUnlock()
+	if cachedOk && time.Since(cached.loadedAt) < t.cacheTTL {
+		metrics.Inc("origins.cache.hits")
+		return cached.origins, true
+	}
+	metrics.Inc("origins.cache.misses")
+
+	appOrigins, err := t.OriginRepository.FindByAppId(appId)
+	if err != nil && !apperrors.Is(err, apperrors.KindNotFound) {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Origin Service",
+			Operation: "IsAllowed",
+			Message:   "Failed to read origin allow-list for appId: " + appId + ", using the cached allow-list if any",
+			Error:     err,
+			AppId:     appId,
+		})
+		return cached.origins, cachedOk
+	}
+	t.cacheMutex.Lock()
+	t.cache[appId] = cachedOrigins{origins: appOrigins.Origins, loadedAt: time.Now()}
+	t.cacheMutex.Unlock()
+	return appOrigins.Origins, true
+}
+
+// invalidate drops the cached allow-list of the app.
+func (t *OriginServiceImpl) invalidate(appId string) {
+	t.cacheMutex.Lock()
+	delete(t.cache, appId)
+	t.cacheMutex.Unlock()
+}
+
+// toAppOrigins converts an origin allow-list model into its data.AppOrigins representation.
+func toAppOrigins(value models.AppOrigins) data.AppOrigins {
+	origins := value.Origins
+	if origins == nil {
+		origins = []string{}
+	}
+	return data.AppOrigins{
+		AppId:     value.AppId,
+		Origins:   origins,
+		UpdatedAt: value.UpdatedAt,
+	}
+}
@@ -0,0 +1,136 @@
+package policyService
+
+import (
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"r2-notify-server/pipeline"
+	webhookService "r2-notify-server/services/webhook"
+)
+
+// policyPlugin applies the delivery policies of the app in the notification pipeline:
+//   - suppress drops the notification before it is persisted,
+//   - storeOnly persists the notification but drops it before delivery,
+//   - route delivers the notification as usual and sends a notification.routed webhook event so the app
+//     can deliver it over the target channel too.
+//
+// Notifications inserted directly into MongoDB only run the delivery hooks, so suppress behaves like
+// storeOnly for them and route sends no webhook event.
+type policyPlugin struct {
+	pipeline.BasePlugin
+	service        PolicyService
+	webhookService webhookService.WebhookService
+	environment    string
+}
+
+// NewPolicyPlugin returns the pipeline plugin applying the delivery policies of the policy service.
+// Routed notifications are dispatched with the webhook service.
+func NewPolicyPlugin(service PolicyService, webhookService webhookService.WebhookService) pipeline.Plugin {
+	return &policyPlugin{
+		service:        service,
+		webhookService: webhookService,
+		environment:    config.LoadConfig().Environment,
+	}
+}
+
+func (p *policyPlugin) Name() string {
+	return "deliveryPolicies"
+}
+
+func (p *policyPlugin) BeforePersist(ctx pipeline.Context, notification *models.Notification) error {
+	policy, ok := p.service.Match(notification.AppId, p.notificationSubject(ctx, *notification))
+	if !ok || policy.Action != data.POLICY_SUPPRESS {
+		return nil
+	}
+	metrics.Inc("policies.suppressed")
+	p.logApplied(ctx, policy, notification.UserId)
+	return pipeline.ErrDropped
+}
+
+func (p *policyPlugin) AfterPersist(ctx pipeline.Context, notification models.Notification) {
+	policy, ok := p.service.Match(notification.AppId, p.notificationSubject(ctx, notification))
+	if !ok || policy.Action != data.POLICY_ROUTE {
+		return
+	}
+	metrics.Inc("policies.routed")
+	p.logApplied(ctx, policy, notification.UserId)
+	p.webhookService.Dispatch(data.WEBHOOK_NOTIFICATION_ROUTED, notification.AppId, data.NotificationRoutedEvent{
+		PolicyId:   policy.Id.Hex(),
+		PolicyName: policy.Name,
+		Target:     policy.Target,
+		Notification: data.Notification{
+			Id:              notification.Id.Hex(),
+			TenantId:        notification.TenantId,
+			UserID:          notification.UserId,
+			AppId:           notification.AppId,
+			GroupKey:        notification.GroupKey,
+			Message:         notification.Message,
+			Status:          notification.Status,
+			ReadStatus:      notification.ReadStatus,
+			CreatedAt:       notification.CreatedAt,
+			UpdatedAt:       notification.UpdatedAt,
+			Actions:         notification.Actions,
+			SenderId:        notification.SenderId,
+			SenderName:      notification.SenderName,
+			SenderAvatarUrl: notification.SenderAvatarUrl,
+			CollapseKey:     notification.CollapseKey,
+			Attachments:     notification.Attachments,
+			UIHints:         notification.UIHints,
+			ExpiresAt:       notification.ExpiresAt,
+			RemindAt:        notification.RemindAt,
+			Truncated:       notification.Truncated,
+			ParentId:        notification.ParentId,
+			Sequence:        notification.Sequence,
+		},
+	})
+}
+
+func (p *policyPlugin) BeforeDeliver(ctx pipeline.Context, payload *data.EventNotification) error {
+	notification := payload.Data
+	policy, ok := p.service.Match(notification.AppId, data.PolicySubject{
+		TenantId:    notification.TenantId,
+		UserId:      notification.UserID,
+		GroupKey:    notification.GroupKey,
+		Message:     notification.Message,
+		Status:      notification.Status,
+		CollapseKey: notification.CollapseKey,
+		SenderId:    notification.SenderId,
+		Source:      ctx.Source,
+		Environment: p.environment,
+	})
+	if !ok || (policy.Action != data.POLICY_STORE_ONLY && policy.Action != data.POLICY_SUPPRESS) {
+		return nil
+	}
+	metrics.Inc("policies.store_only")
+	p.logApplied(ctx, policy, notification.UserID)
+	return pipeline.ErrDropped
+}
+
+// notificationSubject returns the fields of the notification the policy conditions are evaluated against.
+func (p *policyPlugin) notificationSubject(ctx pipeline.Context, notification models.Notification) data.PolicySubject {
+	return data.PolicySubject{
+		TenantId:    notification.TenantId,
+		UserId:      notification.UserId,
+		GroupKey:    notification.GroupKey,
+		Message:     notification.Message,
+		Status:      notification.Status,
+		CollapseKey: notification.CollapseKey,
+		SenderId:    notification.SenderId,
+		Source:      ctx.Source,
+		Environment: p.environment,
+	}
+}
+
+// logApplied logs the policy applied to a notification of the given user.
+func (p *policyPlugin) logApplied(ctx pipeline.Context, policy models.DeliveryPolicy, userId string) {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "Policy Plugin",
+		Operation:     policy.Action,
+		Message:       "Delivery policy " + policy.Name + " (" + policy.Id.Hex() + ") applied to notification from " + ctx.Source + " for userId: " + userId,
+		UserId:        userId,
+		AppId:         policy.AppId,
+		CorrelationId: ctx.CorrelationId,
+	})
+}
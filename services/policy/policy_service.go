@@ -0,0 +1,16 @@
+package policyService
+
+import (
+	"r2-notify-server/data"
+	"r2-notify-server/models"
+)
+
+type PolicyService interface {
+	FindAll(appId string) ([]data.DeliveryPolicy, error)
+	FindById(id string, appId string) (data.DeliveryPolicy, error)
+	Create(appId string, request data.DeliveryPolicyRequest) (data.DeliveryPolicy, error)
+	Update(id string, appId string, request data.DeliveryPolicyRequest) (data.DeliveryPolicy, error)
+	Delete(id string, appId string) error
+	Evaluate(appId string, subject data.PolicySubject) (data.PolicyEvaluation, error)
+	Match(appId string, subject data.PolicySubject) (models.DeliveryPolicy, bool)
+}
@@ -0,0 +1,337 @@
+package policyService
+
+import (
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	policyRepository "r2-notify-server/repository/policy"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// cachedPolicies are the delivery policies of an app as last read from the database. Apps without policies
+// are cached too, so the pipeline does not reach the database for every notification.
+type cachedPolicies struct {
+	policies []models.DeliveryPolicy
+	loadedAt time.Time
+}
+
+type PolicyServiceImpl struct {
+	PolicyRepository policyRepository.PolicyRepository
+	Validate         *validator.Validate
+
+	cacheTTL   time.Duration
+	cache      map[string]cachedPolicies
+	cacheMutex sync.RWMutex
+}
+
+// NewPolicyServiceImpl returns a new instance of PolicyService with the provided PolicyRepository and
+// validator.Validate instance. The policies of each app are cached for POLICY_CACHE_TTL_SECONDS.
+// If the validator instance is nil, an error is returned.
+func NewPolicyServiceImpl(policyRepository policyRepository.PolicyRepository, validate *validator.Validate) (service PolicyService, err error) {
+	if validate == nil {
+		return nil, apperrors.Internal("validator instance cannot be nil", nil)
+	}
+	return &PolicyServiceImpl{
+		PolicyRepository: policyRepository,
+		Validate:         validate,
+		cacheTTL:         time.Duration(config.LoadConfig().PolicyCacheTTLSeconds) * time.Second,
+		cache:            make(map[string]cachedPolicies),
+	}, err
+}
+
+// FindAll returns the delivery policies of the given appId in evaluation order.
+func (t *PolicyServiceImpl) FindAll(appId string) ([]data.DeliveryPolicy, error) {
+	policies, err := t.PolicyRepository.FindAll(appId)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]data.DeliveryPolicy, 0, len(policies))
+	for _, value := range policies {
+		result = append(result, toDeliveryPolicy(value))
+	}
+	return result, nil
+}
+
+// FindById returns the delivery policy with the given ID of the given appId, or a not found error.
+func (t *PolicyServiceImpl) FindById(id string, appId string) (data.DeliveryPolicy, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return data.DeliveryPolicy{}, apperrors.NotFound("delivery policy not found")
+	}
+	policy, err := t.PolicyRepository.FindById(objID, appId)
+	if err != nil {
+		return data.DeliveryPolicy{}, err
+	}
+	return toDeliveryPolicy(policy), nil
+}
+
+// Create adds a delivery policy to the given appId. The cached policies of this instance are dropped,
+// other instances pick up the change when their cache expires.
+func (t *PolicyServiceImpl) Create(appId string, request data.DeliveryPolicyRequest) (data.DeliveryPolicy, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Policy Service",
+		Operation: "Create",
+		Message:   "Creating delivery policy " + request.Name + " for appId: " + appId,
+		AppId:     appId,
+	})
+	if err := t.validate(request); err != nil {
+		return data.DeliveryPolicy{}, err
+	}
+	now := time.Now()
+	policy := fromRequest(appId, request)
+	policy.CreatedAt = now
+	policy.UpdatedAt = now
+	id, err := t.PolicyRepository.Create(policy)
+	if err != nil {
+		return data.DeliveryPolicy{}, err
+	}
+	policy.Id = id
+	t.invalidate(appId)
+	return toDeliveryPolicy(policy), nil
+}
+
+// Update replaces the delivery policy with the given ID of the given appId. It returns a not found error if
+// the app has no such policy. The cached policies of this instance are dropped.
+func (t *PolicyServiceImpl) Update(id string, appId string, request data.DeliveryPolicyRequest) (data.DeliveryPolicy, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return data.DeliveryPolicy{}, apperrors.NotFound("delivery policy not found")
+	}
+	if err := t.validate(request); err != nil {
+		return data.DeliveryPolicy{}, err
+	}
+	existing, err := t.PolicyRepository.FindById(objID, appId)
+	if err != nil {
+		return data.DeliveryPolicy{}, err
+	}
+	policy := fromRequest(appId, request)
+	policy.Id = objID
+	policy.CreatedAt = existing.CreatedAt
+	policy.UpdatedAt = time.Now()
+	if err := t.PolicyRepository.Update(policy); err != nil {
+		return data.DeliveryPolicy{}, err
+	}
+	t.invalidate(appId)
+	return toDeliveryPolicy(policy), nil
+}
+
+// Delete removes the delivery policy with the given ID of the given appId. It returns a not found error if
+// the app has no such policy. The cached policies of this instance are dropped.
+func (t *PolicyServiceImpl) Delete(id string, appId string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return apperrors.NotFound("delivery policy not found")
+	}
+	if err := t.PolicyRepository.Delete(objID, appId); err != nil {
+		return err
+	}
+	t.invalidate(appId)
+	return nil
+}
+
+// Evaluate is a dry run of the delivery policies of the given appId against the subject, read from the
+// database rather than the cache so changes can be checked right away. The environment defaults to the
+// ENV of the server and the source to rest. Nothing is persisted or delivered.
+func (t *PolicyServiceImpl) Evaluate(appId string, subject data.PolicySubject) (data.PolicyEvaluation, error) {
+	if subject.Environment == "" {
+		subject.Environment = config.LoadConfig().Environment
+	}
+	if subject.Source == "" {
+		subject.Source = data.SOURCE_REST
+	}
+	policies, err := t.PolicyRepository.FindAll(appId)
+	if err != nil {
+		return data.PolicyEvaluation{}, err
+	}
+	evaluation := data.PolicyEvaluation{Action: data.POLICY_DELIVER, Matches: make([]data.PolicyMatch, 0, len(policies))}
+	for _, policy := range policies {
+		matched := matches(policy, subject)
+		evaluation.Matches = append(evaluation.Matches, data.PolicyMatch{
+			Id:      policy.Id.Hex(),
+			Name:    policy.Name,
+			Enabled: policy.Enabled,
+			Matched: matched,
+		})
+		if matched && policy.Enabled && evaluation.Policy == nil {
+			decided := toDeliveryPolicy(policy)
+			evaluation.Policy = &decided
+			evaluation.Action = policy.Action
+			evaluation.Target = policy.Target
+		}
+	}
+	return evaluation, nil
+}
+
+// Match returns the first enabled delivery policy of the given appId matching the subject, or false if
+// none matches. Policies are served from the cache while it is fresh. When they cannot be read, the expired
+// cache entry is used if there is one, otherwise no policy applies and the notification is delivered as usual.
+// It is safe to call this function concurrently from multiple goroutines.
+func (t *PolicyServiceImpl) Match(appId string, subject data.PolicySubject) (models.DeliveryPolicy, bool) {
+	for _, policy := range t.lookup(appId) {
+		if policy.Enabled && matches(policy, subject) {
+			return policy, true
+		}
+	}
+	return models.DeliveryPolicy{}, false
+}
+
+// lookup returns the policies of the app, reading them from the database when they are not cached or
+// have expired.
+func (t *PolicyServiceImpl) lookup(appId string) []models.DeliveryPolicy {
+	t.cacheMutex.RLock()
+	cached, cachedOk := t.cache[appId]
+	t.cacheMutex.RUnlock()
+	if cachedOk && time.Since(cached.loadedAt) < t.cacheTTL {
+		metrics.Inc("policies.cache.hits")
+		return cached.policies
+	}
+	metrics.Inc("policies.cache.misses")
+
+	policies, err := t.PolicyRepository.FindAll(appId)
+	if err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Policy Service",
+			Operation: "Match",
+			Message:   "Failed to read delivery policies for appId: " + appId + ", using the cached policies if any",
+			Error:     err,
+			AppId:     appId,
+		})
+		return cached.policies
+	}
+	t.cacheMutex.Lock()
+	t.cache[appId] = cachedPolicies{policies: policies, loadedAt: time.Now()}
+	t.cacheMutex.Unlock()
+	return policies
+}
+
+// invalidate drops the cached policies of the app.
+func (t *PolicyServiceImpl) invalidate(appId string) {
+	t.cacheMutex.Lock()
+	delete(t.cache, appId)
+	t.cacheMutex.Unlock()
+}
+
+// validate checks a policy request: the struct tags, and that the eq and neq operators compare with a
+// single value.
+func (t *PolicyServiceImpl) validate(request data.DeliveryPolicyRequest) error {
+	if err := t.Validate.Struct(request); err != nil {
+		return apperrors.Validation("invalid delivery policy", err)
+	}
+	for _, condition := range request.Conditions {
+		if (condition.Operator == data.POLICY_OP_EQ || condition.Operator == data.POLICY_OP_NEQ) && len(condition.Values) != 1 {
+			return apperrors.Validation("the "+condition.Operator+" operator of the "+condition.Field+" condition takes a single value", nil)
+		}
+	}
+	return nil
+}
+
+// matches reports whether every condition of the policy matches the subject. A policy without conditions
+// matches every notification.
+func matches(policy models.DeliveryPolicy, subject data.PolicySubject) bool {
+	for _, condition := range policy.Conditions {
+		if !conditionMatches(condition, fieldValue(subject, condition.Field)) {
+			return false
+		}
+	}
+	return true
+}
+
+// conditionMatches compares a field value with the values of the condition. Comparisons are case-sensitive;
+// contains and prefix match if the value contains or starts with any of the condition values.
+func conditionMatches(condition models.PolicyCondition, value string) bool {
+	switch condition.Operator {
+	case data.POLICY_OP_EQ:
+		return len(condition.Values) > 0 && value == condition.Values[0]
+	case data.POLICY_OP_NEQ:
+		return len(condition.Values) > 0 && value != condition.Values[0]
+	case data.POLICY_OP_IN:
+		return slices.Contains(condition.Values, value)
+	case data.POLICY_OP_NOT_IN:
+		return !slices.Contains(condition.Values, value)
+	case data.POLICY_OP_CONTAINS:
+		return slices.ContainsFunc(condition.Values, func(part string) bool { return strings.Contains(value, part) })
+	case data.POLICY_OP_PREFIX:
+		return slices.ContainsFunc(condition.Values, func(prefix string) bool { return strings.HasPrefix(value, prefix) })
+	}
+	return false
+}
+
+// fieldValue returns the value of the named field of the subject, or an empty string for unknown fields.
+func fieldValue(subject data.PolicySubject, field string) string {
+	switch field {
+	case "tenantId":
+		return subject.TenantId
+	case "userId":
+		return subject.UserId
+	case "groupKey":
+		return subject.GroupKey
+	case "message":
+		return subject.Message
+	case "status":
+		return subject.Status
+	case "collapseKey":
+		return subject.CollapseKey
+	case "senderId":
+		return subject.SenderId
+	case "source":
+		return subject.Source
+	case "environment":
+		return subject.Environment
+	}
+	return ""
+}
+
+// fromRequest builds the policy model of a create or update request. Policies are enabled unless the
+// request disables them.
+func fromRequest(appId string, request data.DeliveryPolicyRequest) models.DeliveryPolicy {
+	enabled := true
+	if request.Enabled != nil {
+		enabled = *request.Enabled
+	}
+	conditions := request.Conditions
+	if conditions == nil {
+		conditions = []models.PolicyCondition{}
+	}
+	target := ""
+	if request.Action == data.POLICY_ROUTE {
+		target = request.Target
+	}
+	return models.DeliveryPolicy{
+		AppId:      appId,
+		Name:       strings.TrimSpace(request.Name),
+		Order:      request.Order,
+		Enabled:    enabled,
+		Conditions: conditions,
+		Action:     request.Action,
+		Target:     target,
+	}
+}
+
+// toDeliveryPolicy converts a delivery policy model into its data.DeliveryPolicy representation.
+func toDeliveryPolicy(value models.DeliveryPolicy) data.DeliveryPolicy {
+	conditions := value.Conditions
+	if conditions == nil {
+		conditions = []models.PolicyCondition{}
+	}
+	return data.DeliveryPolicy{
+		Id:         value.Id.Hex(),
+		AppId:      value.AppId,
+		Name:       value.Name,
+		Order:      value.Order,
+		Enabled:    value.Enabled,
+		Conditions: conditions,
+		Action:     value.Action,
+		Target:     value.Target,
+		CreatedAt:  value.CreatedAt,
+		UpdatedAt:  value.UpdatedAt,
+	}
+}
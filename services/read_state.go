@@ -0,0 +1,160 @@
+package clientStore
+
+import (
+	"context"
+	"encoding/json"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/utils"
+)
+
+// Redis channel on which read and delete state changes are shared between instances.
+const readStateChannel = "notifications:readState"
+
+// instanceId identifies this instance, so it ignores the state changes it published itself.
+var instanceId = utils.GenerateUUID()
+
+// readStateMessage is a read or delete state change published to the other instances.
+// Exactly one of Change, Update, Synced, Erase, Broadcast and Reminder is set; Erase is the key of a user whose
+// data was erased, Broadcast a system announcement sent to every connection and Reminder the reminder of a
+// notification about to expire.
+type readStateMessage struct {
+	InstanceId string                   `json:"instanceId"`
+	Change     *data.NotificationChange `json:"change,omitempty"`
+	Update     *data.EventNotification  `json:"update,omitempty"`
+	Synced     *data.ReadStateSynced    `json:"synced,omitempty"`
+	Erase      string                   `json:"erase,omitempty"`
+	Broadcast  *data.SystemAnnouncement `json:"broadcast,omitempty"`
+	Reminder   *data.EventNotification  `json:"reminder,omitempty"`
+}
+
+// SendNotificationUpdateToUser sends an updated notification, such as one marked as read, to every
+// connection of the user identified by the UserID field of the notification as a notificationUpdated
+// delta event, including the connections held by other instances. State changes keep the user's devices
+// in sync, so they bypass the notification status check and are never held back for a digest.
+// Returns an error if encoding the payload fails.
+func (t *ClientStore) SendNotificationUpdateToUser(payload data.EventNotification) error {
+	if err := t.sendStateToLocalConnections(UserKey(payload.Data.TenantId, payload.Data.UserID), payload); err != nil {
+		return err
+	}
+	publishReadState(UserKey(payload.Data.TenantId, payload.Data.UserID), readStateMessage{InstanceId: instanceId, Update: &payload})
+	return nil
+}
+
+// SendNotificationChangeToUser sends a delta event listing the affected notification IDs to every
+// connection of the user identified by the UserID field of the change set, including the connections
+// held by other instances. State changes bypass the notification status check.
+// Returns an error if encoding the payload fails.
+func (t *ClientStore) SendNotificationChangeToUser(payload data.NotificationChange) error {
+	if err := t.sendStateToLocalConnections(UserKey(payload.Data.TenantId, payload.Data.UserID), payload); err != nil {
+		return err
+	}
+	publishReadState(UserKey(payload.Data.TenantId, payload.Data.UserID), readStateMessage{InstanceId: instanceId, Change: &payload})
+	return nil
+}
+
+// SendReadStateSyncedToUser sends the authoritative read state after a client synced its offline read status
+// changes to every connection of the user identified by the UserID field of the result, including the
+// connections held by other instances, so the user's other devices converge on the same state.
+// State changes bypass the notification status check.
+// Returns an error if encoding the payload fails.
+func (t *ClientStore) SendReadStateSyncedToUser(payload data.ReadStateSynced) error {
+	if err := t.sendStateToLocalConnections(UserKey(payload.Data.TenantId, payload.Data.UserID), payload); err != nil {
+		return err
+	}
+	publishReadState(UserKey(payload.Data.TenantId, payload.Data.UserID), readStateMessage{InstanceId: instanceId, Synced: &payload})
+	return nil
+}
+
+// StartReadStateSubscriber delivers the read and delete state changes published by other instances to
+// the connections of the affected users on this instance. It runs until the context is cancelled.
+func (t *ClientStore) StartReadStateSubscriber(ctx context.Context) {
+	subscription := config.RDB.Subscribe(ctx, readStateChannel)
+	defer subscription.Close()
+	messages := subscription.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down read state subscriber",
+				Component: "Client Store",
+				Operation: "Shutdown Read State Subscriber",
+			})
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			t.deliverReadState(message.Payload)
+		}
+	}
+}
+
+// deliverReadState delivers a state change received from another instance to the local connections.
+func (t *ClientStore) deliverReadState(body string) {
+	var message readStateMessage
+	if err := json.Unmarshal([]byte(body), &message); err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "DeliverReadState",
+			Message:   "Ignoring malformed read state message",
+			Error:     err,
+		})
+		return
+	}
+	if message.InstanceId == instanceId {
+		return
+	}
+	switch {
+	case message.Change != nil:
+		_ = t.sendStateToLocalConnections(UserKey(message.Change.Data.TenantId, message.Change.Data.UserID), *message.Change)
+	case message.Update != nil:
+		_ = t.sendStateToLocalConnections(UserKey(message.Update.Data.TenantId, message.Update.Data.UserID), *message.Update)
+	case message.Synced != nil:
+		_ = t.sendStateToLocalConnections(UserKey(message.Synced.Data.TenantId, message.Synced.Data.UserID), *message.Synced)
+	case message.Erase != "":
+		t.closeUserConnections(message.Erase)
+		dropDigests(message.Erase)
+	case message.Broadcast != nil:
+		_, _ = t.broadcastToLocalConnections(*message.Broadcast)
+	case message.Reminder != nil:
+		_ = t.sendReminderToLocalConnections(*message.Reminder)
+	}
+	metrics.Inc("readstate.received")
+}
+
+// sendStateToLocalConnections sends a state change to the user's connections on this instance.
+// Users without connections on this instance are skipped.
+func (t *ClientStore) sendStateToLocalConnections(userId string, payload interface{}) error {
+	if !t.IsConnected(userId) {
+		return nil
+	}
+	if err := t.sendToUser(userId, payload, true); err != nil && !apperrors.Is(err, apperrors.KindNotFound) {
+		return err
+	}
+	return nil
+}
+
+// publishReadState shares a state change with the other instances. Failures are logged; the devices
+// connected to this instance have already received the change.
+func publishReadState(userId string, message readStateMessage) {
+	body, err := json.Marshal(message)
+	if err == nil {
+		err = config.RDB.Publish(config.Ctx, readStateChannel, body).Err()
+	}
+	if err != nil {
+		metrics.Inc("readstate.publish.failed")
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "PublishReadState",
+			Message:   "Failed to publish read state change for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return
+	}
+	metrics.Inc("readstate.published")
+}
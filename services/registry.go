@@ -0,0 +1,203 @@
+package clientStore
+
+import (
+	"hash/fnv"
+	"r2-notify-server/models"
+	"slices"
+	"sync"
+)
+
+// ConnectionState is the state kept for a registered connection: the encoder negotiated by the client,
+// the device metadata captured at handshake time and the send queue writing to the connection.
+type ConnectionState struct {
+	Encoder Encoder
+	Device  models.DeviceInfo
+	queue   *sendQueue
+}
+
+// RegisteredConnection is a connection with its state.
+type RegisteredConnection struct {
+	Conn Connection
+	ConnectionState
+}
+
+// ClientRegistry tracks the connections to this instance, keyed by user key, and the state of each
+// connection. The client store reads and updates the connections only through the registry, so tests can
+// replace it with a mock and deployments with another implementation.
+// Implementations must be safe for concurrent use by multiple goroutines.
+type ClientRegistry interface {
+	// Add registers a connection of the user with its state.
+	Add(userId string, conn Connection, state ConnectionState)
+	// Remove unregisters a connection of the user. It returns the state of the connection and the number
+	// of connections the user has left, or false if the connection is not registered.
+	Remove(userId string, conn Connection) (ConnectionState, int, bool)
+	// RemoveUser unregisters every connection of the user and returns them.
+	RemoveUser(userId string) []RegisteredConnection
+	// Connections returns the connections of the user in the order they were registered.
+	Connections(userId string) []RegisteredConnection
+	// Get returns the state of a registered connection, or false if the connection is not registered.
+	Get(conn Connection) (ConnectionState, bool)
+	// UpdateDevice applies update to the device of a registered connection. It returns false if the
+	// connection is not registered.
+	UpdateDevice(conn Connection, update func(device *models.DeviceInfo)) bool
+	// All returns the connections of every user, keyed by user key.
+	All() map[string][]RegisteredConnection
+}
+
+// Number of shards of the in-memory registry. Users are spread over the shards by the hash of their key,
+// so registrations and lookups of different users rarely wait for each other.
+const registryShards = 64
+
+// InMemoryClientRegistry keeps the connections of this instance in memory, split into shards each guarded
+// by its own lock. The shard holding a connection is indexed by connection, so the connection lookups that
+// are not given the user key do not scan the shards.
+type InMemoryClientRegistry struct {
+	shards []*registryShard
+	owners sync.Map // Connection -> *registryShard
+}
+
+// registryShard holds the connections of the users whose key hashes to it.
+type registryShard struct {
+	mutex       sync.RWMutex
+	users       map[string][]Connection // user key -> connections, in registration order
+	connections map[Connection]ConnectionState
+}
+
+// NewInMemoryClientRegistry returns a ClientRegistry keeping the connections of this instance in memory.
+func NewInMemoryClientRegistry() ClientRegistry {
+	return newInMemoryClientRegistry(registryShards)
+}
+
+// newInMemoryClientRegistry returns an in-memory registry split into the given number of shards.
+func newInMemoryClientRegistry(count int) *InMemoryClientRegistry {
+	shards := make([]*registryShard, count)
+	for i := range shards {
+		shards[i] = &registryShard{
+			users:       make(map[string][]Connection),
+			connections: make(map[Connection]ConnectionState),
+		}
+	}
+	return &InMemoryClientRegistry{shards: shards}
+}
+
+// shard returns the shard of the user.
+func (t *InMemoryClientRegistry) shard(userId string) *registryShard {
+	return t.shards[shardOf(userId, len(t.shards))]
+}
+
+// shardOf returns the index of the shard of the user among the given number of shards.
+func shardOf(userId string, shards int) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(userId))
+	return int(hash.Sum32() % uint32(shards))
+}
+
+// owner returns the shard holding the connection, or false if the connection is not registered.
+func (t *InMemoryClientRegistry) owner(conn Connection) (*registryShard, bool) {
+	shard, ok := t.owners.Load(conn)
+	if !ok {
+		return nil, false
+	}
+	return shard.(*registryShard), true
+}
+
+func (t *InMemoryClientRegistry) Add(userId string, conn Connection, state ConnectionState) {
+	shard := t.shard(userId)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	shard.users[userId] = append(shard.users[userId], conn)
+	shard.connections[conn] = state
+	t.owners.Store(conn, shard)
+}
+
+func (t *InMemoryClientRegistry) Remove(userId string, conn Connection) (ConnectionState, int, bool) {
+	shard := t.shard(userId)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	conns := shard.users[userId]
+	index := slices.Index(conns, conn)
+	if index < 0 {
+		return ConnectionState{}, len(conns), false
+	}
+	state := shard.connections[conn]
+	delete(shard.connections, conn)
+	t.owners.Delete(conn)
+	remaining := slices.Delete(slices.Clone(conns), index, index+1)
+	if len(remaining) == 0 {
+		delete(shard.users, userId)
+	} else {
+		shard.users[userId] = remaining
+	}
+	return state, len(remaining), true
+}
+
+func (t *InMemoryClientRegistry) RemoveUser(userId string) []RegisteredConnection {
+	shard := t.shard(userId)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	removed := shard.registered(shard.users[userId])
+	for _, conn := range shard.users[userId] {
+		delete(shard.connections, conn)
+		t.owners.Delete(conn)
+	}
+	delete(shard.users, userId)
+	return removed
+}
+
+func (t *InMemoryClientRegistry) Connections(userId string) []RegisteredConnection {
+	shard := t.shard(userId)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	return shard.registered(shard.users[userId])
+}
+
+func (t *InMemoryClientRegistry) Get(conn Connection) (ConnectionState, bool) {
+	shard, ok := t.owner(conn)
+	if !ok {
+		return ConnectionState{}, false
+	}
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	// The connection may have been removed since its shard was looked up
+	state, ok := shard.connections[conn]
+	return state, ok
+}
+
+func (t *InMemoryClientRegistry) UpdateDevice(conn Connection, update func(device *models.DeviceInfo)) bool {
+	shard, ok := t.owner(conn)
+	if !ok {
+		return false
+	}
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	state, ok := shard.connections[conn]
+	if !ok {
+		return false
+	}
+	update(&state.Device)
+	shard.connections[conn] = state
+	return true
+}
+
+// All returns the connections of every user. The shards are read one after the other, so connections
+// registered or removed meanwhile may or may not be listed.
+func (t *InMemoryClientRegistry) All() map[string][]RegisteredConnection {
+	all := make(map[string][]RegisteredConnection)
+	for _, shard := range t.shards {
+		shard.mutex.RLock()
+		for userId, conns := range shard.users {
+			all[userId] = shard.registered(conns)
+		}
+		shard.mutex.RUnlock()
+	}
+	return all
+}
+
+// registered returns the given connections with their state. The caller must hold the mutex of the shard.
+func (shard *registryShard) registered(conns []Connection) []RegisteredConnection {
+	result := make([]RegisteredConnection, 0, len(conns))
+	for _, conn := range conns {
+		result = append(result, RegisteredConnection{Conn: conn, ConnectionState: shard.connections[conn]})
+	}
+	return result
+}
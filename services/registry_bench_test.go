@@ -0,0 +1,73 @@
+package clientStore
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// benchConnection is a connection that discards the frames written to it.
+type benchConnection struct {
+	id int
+}
+
+func (c *benchConnection) WriteMessage(messageType int, data []byte) error { return nil }
+func (c *benchConnection) Close() error                                    { return nil }
+
+// Connections registered before each benchmark, two per user.
+var benchConnectionCounts = []int{1_000, 10_000, 100_000}
+
+// benchmarkRegistry runs op in parallel against a single-lock registry and the sharded registry, each
+// holding every count of benchConnectionCounts. op is given the registry, the key of a registered user and
+// a fresh connection to register.
+func benchmarkRegistry(b *testing.B, op func(registry ClientRegistry, userId string, conn Connection)) {
+	for _, shards := range []int{1, registryShards} {
+		for _, count := range benchConnectionCounts {
+			b.Run(fmt.Sprintf("shards=%d/connections=%d", shards, count), func(b *testing.B) {
+				registry := newInMemoryClientRegistry(shards)
+				users := make([]string, count/2)
+				for i := range users {
+					users[i] = "user-" + strconv.Itoa(i)
+					registry.Add(users[i], &benchConnection{id: 2 * i}, ConnectionState{})
+					registry.Add(users[i], &benchConnection{id: 2*i + 1}, ConnectionState{})
+				}
+				var next atomic.Int64
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						i := int(next.Add(1))
+						op(registry, users[i%len(users)], &benchConnection{id: count + i})
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkRegistryAddRemove measures connections being registered and removed concurrently.
+func BenchmarkRegistryAddRemove(b *testing.B) {
+	benchmarkRegistry(b, func(registry ClientRegistry, userId string, conn Connection) {
+		registry.Add(userId, conn, ConnectionState{})
+		registry.Remove(userId, conn)
+	})
+}
+
+// BenchmarkRegistryConnections measures concurrent lookups of the connections of a user, as done for
+// every frame sent to a user.
+func BenchmarkRegistryConnections(b *testing.B) {
+	benchmarkRegistry(b, func(registry ClientRegistry, userId string, _ Connection) {
+		registry.Connections(userId)
+	})
+}
+
+// BenchmarkRegistryMixed measures a connection being registered, looked up with the other connections of
+// its user and removed, while other goroutines do the same for other users.
+func BenchmarkRegistryMixed(b *testing.B) {
+	benchmarkRegistry(b, func(registry ClientRegistry, userId string, conn Connection) {
+		registry.Add(userId, conn, ConnectionState{})
+		registry.Connections(userId)
+		registry.Remove(userId, conn)
+	})
+}
@@ -0,0 +1,31 @@
+package clientStore
+
+import (
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+)
+
+// SendReminderToUser sends a notificationReminder event for an unread notification that is about to expire to
+// every connection of the user identified by the UserID field of the notification, including the connections
+// held by other instances. Like new notifications, reminders are not sent to users who disabled notifications
+// or muted the group of the notification.
+// Returns an error if encoding the payload or writing it to the connections on this instance fails.
+func (t *ClientStore) SendReminderToUser(payload data.EventNotification) error {
+	err := t.sendReminderToLocalConnections(payload)
+	publishReadState(UserKey(payload.Data.TenantId, payload.Data.UserID), readStateMessage{InstanceId: instanceId, Reminder: &payload})
+	return err
+}
+
+// sendReminderToLocalConnections sends a reminder to the user's connections on this instance. Users without
+// connections on this instance, with notifications disabled or who muted the group are skipped.
+func (t *ClientStore) sendReminderToLocalConnections(payload data.EventNotification) error {
+	userId := UserKey(payload.Data.TenantId, payload.Data.UserID)
+	if !t.IsConnected(userId) || t.mutedForUser(payload.Data) {
+		return nil
+	}
+	err := t.sendToUser(userId, payload, false)
+	if err != nil && !apperrors.Is(err, apperrors.KindNotFound) && !apperrors.Is(err, apperrors.KindUnauthorized) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package clientStore
+
+import (
+	"encoding/base64"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"strconv"
+	"time"
+)
+
+// NewResumeToken returns an opaque resume token for the given time.
+func NewResumeToken(at time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(at.UnixMilli(), 10)))
+}
+
+// ParseResumeToken returns the time a resume token was issued, less data.RESUME_TOKEN_MARGIN so the
+// changes made while the token's frame was in flight are included. It returns a validation error if the
+// token is malformed or issued in the future.
+func ParseResumeToken(token string) (time.Time, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, apperrors.Validation("invalid resume token", err)
+	}
+	millis, err := strconv.ParseInt(string(decoded), 10, 64)
+	if err != nil {
+		return time.Time{}, apperrors.Validation("invalid resume token", err)
+	}
+	issuedAt := time.UnixMilli(millis)
+	if issuedAt.After(time.Now().Add(data.RESUME_TOKEN_MARGIN)) {
+		return time.Time{}, apperrors.Validation("invalid resume token", nil)
+	}
+	return issuedAt.Add(-data.RESUME_TOKEN_MARGIN), nil
+}
+
+// SendNotificationsResumedToUser sends the notifications changed since a client's resume token to the user
+// identified by the UserID field of the resume. Like the full list, it respects the notification status check.
+func (t *ClientStore) SendNotificationsResumedToUser(payload data.NotificationsResumed) error {
+	return t.sendToUser(UserKey(payload.Data.TenantId, payload.Data.UserID), payload, false)
+}
+
+// withResumeToken stamps frames carrying notifications with a resume token for the current time. Other
+// frames are returned unchanged.
+func withResumeToken(payload interface{}) interface{} {
+	token := NewResumeToken(time.Now())
+	switch value := payload.(type) {
+	case data.EventNotification:
+		value.ResumeToken = token
+		return value
+	case data.NotificationList:
+		value.ResumeToken = token
+		return value
+	case data.NotificationChange:
+		value.ResumeToken = token
+		return value
+	case data.NotificationsResumed:
+		value.ResumeToken = token
+		return value
+	case data.DigestNotification:
+		value.ResumeToken = token
+		return value
+	case data.GroupSummaryNotification:
+		value.ResumeToken = token
+		return value
+	}
+	return payload
+}
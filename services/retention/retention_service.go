@@ -0,0 +1,12 @@
+package retentionService
+
+import (
+	"r2-notify-server/data"
+)
+
+type RetentionService interface {
+	FindAll() ([]data.AppRetention, error)
+	FindByAppId(appId string) (data.AppRetention, error)
+	Update(appId string, request data.UpdateAppRetentionRequest) (data.AppRetention, error)
+	Delete(appId string) error
+}
@@ -0,0 +1,91 @@
+package retentionService
+
+import (
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/models"
+	retentionRepository "r2-notify-server/repository/retention"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type RetentionServiceImpl struct {
+	RetentionRepository retentionRepository.RetentionRepository
+	Validate            *validator.Validate
+}
+
+// NewRetentionServiceImpl returns a new instance of RetentionService with the provided RetentionRepository
+// and validator.Validate instance. If the validator instance is nil, an error is returned.
+func NewRetentionServiceImpl(retentionRepository retentionRepository.RetentionRepository, validate *validator.Validate) (service RetentionService, err error) {
+	if validate == nil {
+		return nil, apperrors.Internal("validator instance cannot be nil", nil)
+	}
+	return &RetentionServiceImpl{
+		RetentionRepository: retentionRepository,
+		Validate:            validate,
+	}, err
+}
+
+// FindAll returns the retention policies of every app.
+func (t *RetentionServiceImpl) FindAll() ([]data.AppRetention, error) {
+	appRetention, err := t.RetentionRepository.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]data.AppRetention, 0, len(appRetention))
+	for _, value := range appRetention {
+		result = append(result, toAppRetention(value))
+	}
+	return result, nil
+}
+
+// FindByAppId returns the retention policy of the given appId, or a not found error if it has none.
+func (t *RetentionServiceImpl) FindByAppId(appId string) (data.AppRetention, error) {
+	appRetention, err := t.RetentionRepository.FindByAppId(appId)
+	if err != nil {
+		return data.AppRetention{}, err
+	}
+	return toAppRetention(appRetention), nil
+}
+
+// Update replaces the retention policy of the given appId. The new policy is applied by the next nightly
+// cleanup.
+func (t *RetentionServiceImpl) Update(appId string, request data.UpdateAppRetentionRequest) (data.AppRetention, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Retention Service",
+		Operation: "Update",
+		Message:   "Updating retention policy for appId: " + appId,
+		AppId:     appId,
+	})
+	if err := t.Validate.Struct(request); err != nil {
+		return data.AppRetention{}, apperrors.Validation("invalid retention policy", err)
+	}
+	appRetention := models.AppRetention{
+		AppId:      appId,
+		ReadDays:   *request.ReadDays,
+		UnreadDays: *request.UnreadDays,
+		UpdatedAt:  time.Now(),
+	}
+	if err := t.RetentionRepository.Upsert(appRetention); err != nil {
+		return data.AppRetention{}, err
+	}
+	return toAppRetention(appRetention), nil
+}
+
+// Delete removes the retention policy of the given appId, so its notifications are kept forever.
+// It returns a not found error if the app has no retention policy.
+func (t *RetentionServiceImpl) Delete(appId string) error {
+	return t.RetentionRepository.Delete(appId)
+}
+
+// toAppRetention converts a retention policy model into its data.AppRetention representation.
+func toAppRetention(value models.AppRetention) data.AppRetention {
+	return data.AppRetention{
+		AppId:      value.AppId,
+		ReadDays:   value.ReadDays,
+		UnreadDays: value.UnreadDays,
+		UpdatedAt:  value.UpdatedAt,
+	}
+}
@@ -0,0 +1,317 @@
+package clientStore
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Interval at which the slow consumer monitor samples the send queue depth of each connection.
+const slowConsumerCheckInterval = time.Second
+
+// Deadline for writing a close frame, which may never be read by a connection that stopped reading.
+const closeFrameTimeout = time.Second
+
+// frame is a message waiting in a connection's send queue.
+type frame struct {
+	messageType int
+	data        []byte
+}
+
+// framePriority selects the tier of a connection's send queue a message waits in.
+type framePriority int
+
+const (
+	priorityNormal framePriority = iota // bulk frames, such as notification lists, and state changes
+	priorityHigh                        // new notifications and frames answering or alerting the client
+)
+
+// priorityOf returns the tier of the send queue the payload waits in. New notifications jump ahead of bulk
+// frames, as do errors, heartbeats and announcements. Updates of existing notifications keep their place
+// behind the lists queued before them, so a list fetched earlier cannot overwrite them.
+func priorityOf(payload interface{}) framePriority {
+	switch value := payload.(type) {
+	case data.EventNotification:
+		switch value.Event.Event {
+		case data.NEW_NOTIFICATION, data.NOTIFICATION_REPLACED, data.NOTIFICATION_REMINDER:
+			return priorityHigh
+		}
+	case data.DigestNotification, data.GroupSummaryNotification, data.ErrorEvent, data.HeartbeatResponse, data.HelloResponse, data.Connected:
+		return priorityHigh
+	}
+	return priorityNormal
+}
+
+// controlWriter is implemented by connections that can write control frames concurrently with
+// other writes, such as WebSocket connections.
+type controlWriter interface {
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+}
+
+// sendQueue buffers the messages sent to a connection and writes them from a dedicated goroutine,
+// so a client that stops reading cannot block delivery to other users. Messages wait in two tiers:
+// high priority messages are written first, but after maxBurst of them in a row a waiting normal
+// message is written, so bulk frames are delayed rather than starved.
+type sendQueue struct {
+	userId    string
+	conn      Connection
+	size      int // messages the two tiers hold together
+	priority  chan frame
+	normal    chan frame
+	maxBurst  int
+	burst     int // high priority messages written in a row while normal messages waited
+	done      chan struct{}
+	closeOnce sync.Once
+	overSince time.Time     // time the queue depth first exceeded the threshold, zero while below it
+	history   *frameHistory // last frames sent, nil unless CONNECTION_HISTORY_SIZE is set
+}
+
+var (
+	errQueueFull   = apperrors.Internal("send queue full", nil)
+	errQueueClosed = apperrors.Internal("connection closed", nil)
+)
+
+// newSendQueue creates the send queue of a connection and starts its writer.
+func newSendQueue(userId string, conn Connection) *sendQueue {
+	cfg := config.LoadConfig()
+	size := cfg.SendQueueSize
+	if size <= 0 {
+		size = 1
+	}
+	queue := &sendQueue{
+		userId:   userId,
+		conn:     conn,
+		size:     size,
+		priority: make(chan frame, size),
+		normal:   make(chan frame, size),
+		maxBurst: max(cfg.SendQueuePriorityBurst, 1),
+		done:     make(chan struct{}),
+		history:  newFrameHistory(cfg.ConnectionHistorySize),
+	}
+	go queue.run()
+	return queue
+}
+
+// run writes queued messages to the connection until the queue is stopped. If a write fails, the
+// connection is closed so its read loop removes it from the store.
+func (q *sendQueue) run() {
+	for {
+		f, ok := q.next()
+		if !ok {
+			return
+		}
+		if err := q.conn.WriteMessage(f.messageType, f.data); err != nil {
+			q.history.add(data.FRAME_FAILED, f.messageType, f.data)
+			logger.Log.Warn(logger.LogPayload{
+				Component: "Client Store",
+				Operation: "SendQueue",
+				Message:   "Failed to write message to connection for userId: " + q.userId,
+				Error:     err,
+				UserId:    q.userId,
+			})
+			q.stop()
+			_ = q.conn.Close()
+			return
+		}
+		q.history.add(data.FRAME_SENT, f.messageType, f.data)
+	}
+}
+
+// next waits for the next message to write, preferring high priority messages unless normal messages
+// have waited for maxBurst of them. It returns false once the queue is stopped.
+func (q *sendQueue) next() (frame, bool) {
+	if q.burst >= q.maxBurst && len(q.normal) > 0 {
+		q.burst = 0
+		metrics.Inc("connections.sendqueue.bulk_promoted")
+		return <-q.normal, true
+	}
+	select {
+	case <-q.done:
+		return frame{}, false
+	case f := <-q.priority:
+		q.countBurst()
+		return f, true
+	default:
+	}
+	select {
+	case <-q.done:
+		return frame{}, false
+	case f := <-q.priority:
+		q.countBurst()
+		return f, true
+	case f := <-q.normal:
+		q.burst = 0
+		return f, true
+	}
+}
+
+// countBurst counts a high priority message written ahead of waiting normal messages.
+func (q *sendQueue) countBurst() {
+	if len(q.normal) > 0 {
+		q.burst++
+	} else {
+		q.burst = 0
+	}
+}
+
+// depth returns the number of messages waiting in both tiers.
+func (q *sendQueue) depth() int {
+	return len(q.priority) + len(q.normal)
+}
+
+// enqueue adds a message to the tier of the given priority without blocking. It returns an error if
+// the queue holds size messages or has been stopped.
+func (q *sendQueue) enqueue(priority framePriority, messageType int, data []byte) error {
+	select {
+	case <-q.done:
+		return errQueueClosed
+	default:
+	}
+	if q.depth() >= q.size {
+		return errQueueFull
+	}
+	tier := q.normal
+	if priority == priorityHigh {
+		tier = q.priority
+	}
+	select {
+	case tier <- frame{messageType: messageType, data: data}:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// stop stops the writer. Messages still queued are discarded. It is safe to call more than once.
+func (q *sendQueue) stop() {
+	q.closeOnce.Do(func() { close(q.done) })
+}
+
+// writeToConnection queues a message on the tier of the given priority of the connection's send queue.
+// If the queue is full, the client has stopped reading and the connection is dropped as a slow consumer.
+// Messages that cannot be queued are recorded as dropped in the connection's history.
+func writeToConnection(registered RegisteredConnection, priority framePriority, messageType int, payload []byte) error {
+	queue := registered.queue
+	if queue == nil {
+		return registered.Conn.WriteMessage(messageType, payload)
+	}
+	if err := queue.enqueue(priority, messageType, payload); err != nil {
+		queue.history.add(data.FRAME_DROPPED, messageType, payload)
+		if err == errQueueFull {
+			dropSlowConsumer(queue, "send queue full")
+		}
+		return err
+	}
+	return nil
+}
+
+// releaseConnection stops the writer of a removed connection of the given user and the tracking of its activity,
+// and removes its device and heartbeat from Redis.
+func releaseConnection(userId string, registered RegisteredConnection) {
+	if registered.queue != nil {
+		registered.queue.stop()
+	}
+	forgetConnection(registered.Conn)
+	deleteConnection(userId, registered.Device.ConnectionId)
+}
+
+// StartSlowConsumerMonitor drops connections whose send queue stays deeper than SLOW_CONSUMER_THRESHOLD
+// for longer than SLOW_CONSUMER_TIMEOUT_SECONDS. Connections whose queue fills up completely are dropped
+// immediately when a message is sent. The deepest queue is reported in the connections.sendqueue.depth.max
+// gauge. The monitor runs until the context is cancelled.
+func (t *ClientStore) StartSlowConsumerMonitor(ctx context.Context) {
+	cfg := config.LoadConfig()
+	threshold := cfg.SlowConsumerThreshold
+	timeout := time.Duration(cfg.SlowConsumerTimeoutSeconds) * time.Second
+
+	ticker := time.NewTicker(slowConsumerCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Info(logger.LogPayload{
+				Message:   "Shutting down slow consumer monitor",
+				Component: "Client Store",
+				Operation: "Shutdown Slow Consumer Monitor",
+			})
+			return
+		case now := <-ticker.C:
+			t.checkSendQueues(now, threshold, timeout)
+		}
+	}
+}
+
+// checkSendQueues samples the depth of every send queue and drops the connections that have been
+// above the threshold for longer than the timeout.
+func (t *ClientStore) checkSendQueues(now time.Time, threshold int, timeout time.Duration) {
+	var snapshot []*sendQueue
+	for _, conns := range t.registry.All() {
+		for _, registered := range conns {
+			if registered.queue != nil {
+				snapshot = append(snapshot, registered.queue)
+			}
+		}
+	}
+
+	maxDepth := 0
+	for _, queue := range snapshot {
+		depth := queue.depth()
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		if depth < threshold {
+			queue.overSince = time.Time{}
+			continue
+		}
+		if queue.overSince.IsZero() {
+			queue.overSince = now
+			continue
+		}
+		if now.Sub(queue.overSince) >= timeout {
+			dropSlowConsumer(queue, fmt.Sprintf("send queue depth %d above %d for %s", depth, threshold, now.Sub(queue.overSince).Round(time.Second)))
+		}
+	}
+	metrics.SetGauge("connections.sendqueue.depth.max", int64(maxDepth))
+}
+
+// dropSlowConsumer stops the send queue of a connection that is not keeping up and closes it.
+// WebSocket clients receive a close frame with the slowConsumer reason; the read loop of the closed
+// connection removes it from the store.
+func dropSlowConsumer(queue *sendQueue, reason string) {
+	queue.stop()
+	writeCloseFrame(queue.conn, data.SLOW_CONSUMER_CLOSE, data.SLOW_CONSUMER)
+	if err := queue.conn.Close(); err != nil {
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "DropSlowConsumer",
+			Message:   "Failed to close slow connection for userId: " + queue.userId,
+			Error:     err,
+			UserId:    queue.userId,
+		})
+	}
+	metrics.Inc("connections.slow_consumer.dropped")
+	logger.Log.Warn(logger.LogPayload{
+		Component: "Client Store",
+		Operation: "DropSlowConsumer",
+		Message:   "Dropped slow consumer connection: " + reason,
+		UserId:    queue.userId,
+	})
+}
+
+// writeCloseFrame sends a close frame with the given code and reason. The frame is written as a control
+// message, which is safe while the connection's writer is busy. Connections that do not support close
+// frames, such as SSE streams, are skipped.
+func writeCloseFrame(conn Connection, code int, reason string) {
+	if writer, ok := conn.(controlWriter); ok {
+		closeFrame := websocket.FormatCloseMessage(code, reason)
+		_ = writer.WriteControl(websocket.CloseMessage, closeFrame, time.Now().Add(closeFrameTimeout))
+	}
+}
@@ -0,0 +1,9 @@
+package simulationService
+
+import (
+	"r2-notify-server/data"
+)
+
+type SimulationService interface {
+	Simulate(request data.SimulateRequest, correlationId string) (data.Simulation, error)
+}
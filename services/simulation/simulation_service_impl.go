@@ -0,0 +1,149 @@
+package simulationService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	"r2-notify-server/pipeline"
+	clientStore "r2-notify-server/services"
+	auditService "r2-notify-server/services/audit"
+	notificationService "r2-notify-server/services/notification"
+	"r2-notify-server/utils"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Statuses the simulated notifications cycle through, so clients render every kind of notification.
+var simulatedStatuses = []string{data.STATUS_INFO, data.STATUS_PENDING, data.STATUS_IN_PROGRESS, data.STATUS_SUCCESS, data.STATUS_FAILED}
+
+type SimulationServiceImpl struct {
+	ctx                 context.Context
+	NotificationService notificationService.NotificationService
+	AuditService        auditService.AuditService
+	ClientStore         *clientStore.ClientStore
+	Validate            *validator.Validate
+}
+
+// NewSimulationServiceImpl returns a new instance of SimulationService creating the simulated notifications
+// with the NotificationService and delivering them through the ClientStore. Simulations in progress are
+// stopped when the given context is cancelled.
+func NewSimulationServiceImpl(ctx context.Context, notificationService notificationService.NotificationService, auditService auditService.AuditService, clients *clientStore.ClientStore, validate *validator.Validate) SimulationService {
+	return &SimulationServiceImpl{
+		ctx:                 ctx,
+		NotificationService: notificationService,
+		AuditService:        auditService,
+		ClientStore:         clients,
+		Validate:            validate,
+	}
+}
+
+// Simulate starts sending a burst of synthetic notifications to a user, as if they were published over REST
+// but recorded with the source data.SOURCE_SIMULATION. The notifications are persisted and delivered like
+// any other, in the background, so the simulation is returned as soon as it is started. Returns a not found
+// error if simulations are disabled with SIMULATION_ENABLED, and a validation error if the request is invalid
+// or asks for more than SIMULATION_MAX_COUNT notifications. The simulation is recorded in the audit log.
+func (t *SimulationServiceImpl) Simulate(request data.SimulateRequest, correlationId string) (data.Simulation, error) {
+	cfg := config.LoadConfig()
+	if !cfg.SimulationEnabled {
+		return data.Simulation{}, apperrors.NotFound("simulations are not enabled")
+	}
+	if err := t.Validate.Struct(request); err != nil {
+		return data.Simulation{}, apperrors.Validation("invalid simulation request", err)
+	}
+	if request.Count > cfg.SimulationMaxCount {
+		return data.Simulation{}, apperrors.Validation(fmt.Sprintf("count must not exceed %d", cfg.SimulationMaxCount), nil)
+	}
+	appIds := request.AppIds
+	if len(appIds) == 0 {
+		appIds = []string{data.SIMULATION_DEFAULT_APP}
+	}
+
+	simulation := data.Simulation{
+		Id:         utils.GenerateUUID(),
+		TenantId:   request.TenantId,
+		UserId:     request.UserId,
+		Count:      request.Count,
+		IntervalMs: request.IntervalMs,
+		AppIds:     appIds,
+		StartedAt:  time.Now(),
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component:     "Simulation Service",
+		Operation:     "Simulate",
+		Message:       fmt.Sprintf("Starting simulation %s of %d notifications for userId: %s", simulation.Id, simulation.Count, simulation.UserId),
+		UserId:        simulation.UserId,
+		CorrelationId: correlationId,
+	})
+	metrics.Inc("simulations.started")
+	t.AuditService.Record(models.AuditEntry{Event: data.SIMULATE, UserId: simulation.UserId, CorrelationId: correlationId, Affected: int64(simulation.Count)})
+	go t.run(simulation, correlationId)
+	return simulation, nil
+}
+
+// run sends the notifications of the simulation, waiting the interval of the simulation between two of them.
+// A notification that fails is logged and skipped; the simulation stops early if the service shuts down.
+func (t *SimulationServiceImpl) run(simulation data.Simulation, correlationId string) {
+	ctx := pipeline.Context{Context: t.ctx, Source: data.SOURCE_SIMULATION, CorrelationId: correlationId}
+	interval := time.Duration(simulation.IntervalMs) * time.Millisecond
+	sent := 0
+	for i := 0; i < simulation.Count; i++ {
+		if i > 0 && interval > 0 {
+			timer := time.NewTimer(interval)
+			select {
+			case <-t.ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+		if t.ctx.Err() != nil {
+			break
+		}
+		notification := simulatedNotification(simulation, i)
+		if _, err := pipeline.Create(ctx, t.NotificationService, t.ClientStore, notification); err != nil && !errors.Is(err, pipeline.ErrDropped) {
+			metrics.Inc("simulations.notifications.failed")
+			logger.Log.Warn(logger.LogPayload{
+				Component:     "Simulation Service",
+				Operation:     "Simulate",
+				Message:       fmt.Sprintf("Failed to send notification %d of simulation %s", i+1, simulation.Id),
+				Error:         err,
+				UserId:        simulation.UserId,
+				AppId:         notification.AppId,
+				CorrelationId: correlationId,
+			})
+			continue
+		}
+		metrics.Inc("simulations.notifications.sent")
+		sent++
+	}
+	logger.Log.Info(logger.LogPayload{
+		Component:     "Simulation Service",
+		Operation:     "Simulate",
+		Message:       fmt.Sprintf("Finished simulation %s, sent %d of %d notifications for userId: %s", simulation.Id, sent, simulation.Count, simulation.UserId),
+		UserId:        simulation.UserId,
+		CorrelationId: correlationId,
+	})
+}
+
+// simulatedNotification returns the i-th notification of the simulation. The notifications cycle through
+// the apps of the simulation and the notification statuses, and are grouped per simulation.
+func simulatedNotification(simulation data.Simulation, i int) models.Notification {
+	now := time.Now()
+	return models.Notification{
+		TenantId:   simulation.TenantId,
+		UserId:     simulation.UserId,
+		AppId:      simulation.AppIds[i%len(simulation.AppIds)],
+		GroupKey:   "Simulation " + simulation.Id,
+		Message:    fmt.Sprintf("Simulated notification %d of %d", i+1, simulation.Count),
+		Status:     simulatedStatuses[i%len(simulatedStatuses)],
+		ReadStatus: false,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
@@ -0,0 +1,10 @@
+package ticketService
+
+import (
+	"r2-notify-server/data"
+)
+
+type TicketService interface {
+	Issue(tenantId string, userId string) (data.WsTicket, error)
+	Redeem(ticket string) (data.WsTicketClaims, error)
+}
@@ -0,0 +1,118 @@
+package ticketService
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/utils"
+	"strings"
+	"time"
+)
+
+// Redis key prefix under which the nonces of redeemed tickets are kept until the tickets expire.
+const redeemedKeyPrefix = "ws:ticket:"
+
+type TicketServiceImpl struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTicketServiceImpl returns a new instance of TicketService signing tickets with the given secret, valid
+// for the given TTL. Tickets are disabled when the secret is empty: issuing or redeeming one fails.
+func NewTicketServiceImpl(secret string, ttl time.Duration) TicketService {
+	return &TicketServiceImpl{secret: []byte(secret), ttl: ttl}
+}
+
+// Issue returns a ticket authenticating a single handshake of the given user of the tenant. The ticket holds
+// the user, a random nonce and its expiry, signed with HMAC-SHA256, so any instance can verify it without a
+// lookup. Returns a not found error if tickets are disabled.
+func (t *TicketServiceImpl) Issue(tenantId string, userId string) (data.WsTicket, error) {
+	if len(t.secret) == 0 {
+		return data.WsTicket{}, apperrors.NotFound("WebSocket tickets are not enabled")
+	}
+	expiresAt := time.Now().Add(t.ttl)
+	claims := data.WsTicketClaims{
+		TenantId:  tenantId,
+		UserId:    userId,
+		Nonce:     utils.GenerateUUID(),
+		ExpiresAt: expiresAt.Unix(),
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return data.WsTicket{}, apperrors.Internal("failed to encode ticket", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	metrics.Inc("ws.tickets.issued")
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Ticket Service",
+		Operation: "Issue",
+		Message:   "Issued handshake ticket for userId: " + userId,
+		UserId:    userId,
+	})
+	return data.WsTicket{
+		Ticket:    encoded + "." + t.sign(encoded),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+	}, nil
+}
+
+// Redeem verifies the signature and expiry of a ticket and consumes it, returning the user it was issued for.
+// A ticket can only be redeemed once, across every instance: its nonce is claimed in Redis until the ticket
+// expires. Returns an unauthorized error if the ticket is malformed, forged, expired or already redeemed, and
+// a dependency error if Redis is unavailable, since the ticket could otherwise be replayed.
+func (t *TicketServiceImpl) Redeem(ticket string) (data.WsTicketClaims, error) {
+	if len(t.secret) == 0 {
+		return data.WsTicketClaims{}, t.reject("WebSocket tickets are not enabled")
+	}
+	encoded, signature, ok := strings.Cut(ticket, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(t.sign(encoded))) {
+		return data.WsTicketClaims{}, t.reject("invalid ticket")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return data.WsTicketClaims{}, t.reject("invalid ticket")
+	}
+	var claims data.WsTicketClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.UserId == "" || claims.Nonce == "" {
+		return data.WsTicketClaims{}, t.reject("invalid ticket")
+	}
+	remaining := time.Until(time.Unix(claims.ExpiresAt, 0))
+	if remaining <= 0 {
+		return data.WsTicketClaims{}, t.reject("ticket expired")
+	}
+
+	claimed, err := config.RDB.SetNX(config.Ctx, redeemedKeyPrefix+claims.Nonce, claims.UserId, remaining+time.Second).Result()
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Ticket Service",
+			Operation: "Redeem",
+			Message:   "Failed to redeem handshake ticket for userId: " + claims.UserId,
+			Error:     err,
+			UserId:    claims.UserId,
+		})
+		return data.WsTicketClaims{}, apperrors.DependencyUnavailable("failed to redeem ticket", err)
+	}
+	if !claimed {
+		return data.WsTicketClaims{}, t.reject("ticket already used")
+	}
+	metrics.Inc("ws.tickets.redeemed")
+	return claims, nil
+}
+
+// sign returns the base64url encoded HMAC-SHA256 of the encoded claims.
+func (t *TicketServiceImpl) sign(encoded string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// reject counts a refused ticket and returns the unauthorized error with the given message.
+func (t *TicketServiceImpl) reject(message string) error {
+	metrics.Inc("ws.tickets.rejected")
+	return apperrors.Unauthorized(message)
+}
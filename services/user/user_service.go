@@ -0,0 +1,11 @@
+package userService
+
+import (
+	"context"
+	"r2-notify-server/data"
+)
+
+type UserService interface {
+	EraseData(ctx context.Context, tenantId string, userId string, correlationId string) (data.UserDataErasureReport, error)
+	Reachability(ctx context.Context, tenantId string, userId string, appId string, groupKey string) (data.Reachability, error)
+}
@@ -0,0 +1,173 @@
+package userService
+
+import (
+	"context"
+	"fmt"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	baseRepository "r2-notify-server/repository/base"
+	configurationRepository "r2-notify-server/repository/configuration"
+	notificationRepository "r2-notify-server/repository/notification"
+	clientStore "r2-notify-server/services"
+	auditService "r2-notify-server/services/audit"
+	configurationService "r2-notify-server/services/configuration"
+	"slices"
+	"time"
+)
+
+type UserServiceImpl struct {
+	NotificationRepository  notificationRepository.NotificationRepository
+	ConfigurationRepository configurationRepository.ConfigurationRepository
+	ConfigurationService    configurationService.ConfigurationService
+	AuditService            auditService.AuditService
+	Transactor              baseRepository.Transactor
+	ClientStore             *clientStore.ClientStore
+}
+
+// NewUserServiceImpl returns a new instance of UserService with the provided notification and
+// configuration repositories, the ConfigurationService reading cached configurations, the AuditService
+// recording erasures, the Transactor applying them and the ClientStore holding the user's connections.
+func NewUserServiceImpl(notificationRepository notificationRepository.NotificationRepository, configurationRepository configurationRepository.ConfigurationRepository, configurationService configurationService.ConfigurationService, auditService auditService.AuditService, transactor baseRepository.Transactor, clients *clientStore.ClientStore) UserService {
+	return &UserServiceImpl{
+		NotificationRepository:  notificationRepository,
+		ConfigurationRepository: configurationRepository,
+		ConfigurationService:    configurationService,
+		AuditService:            auditService,
+		Transactor:              transactor,
+		ClientStore:             clients,
+	}
+}
+
+// EraseData permanently erases the data stored for a user: the client info in Redis, the user's
+// connections and pending digests, every notification including soft-deleted ones, and the configuration.
+// The connections are closed first so a connected client cannot recreate its data while it is erased.
+// The notifications and the configuration are erased in a single transaction together with the record of
+// the erasure in the audit log, so a failed erasure leaves them in place. Erasing a user without data
+// succeeds with an empty report, so a failed erasure can simply be retried.
+func (t *UserServiceImpl) EraseData(ctx context.Context, tenantId string, userId string, correlationId string) (data.UserDataErasureReport, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component:     "User Service",
+		Operation:     "EraseData",
+		Message:       "Erasing data for userId: " + userId,
+		UserId:        userId,
+		CorrelationId: correlationId,
+	})
+	report := data.UserDataErasureReport{UserId: userId, TenantId: tenantId}
+
+	connections, redisKeys, err := t.ClientStore.EraseUser(clientStore.UserKey(tenantId, userId))
+	if err != nil {
+		return data.UserDataErasureReport{}, err
+	}
+	report.Connections = connections
+	report.RedisKeys = redisKeys
+
+	err = t.Transactor.WithTransaction(ctx, "EraseData", func(ctx context.Context) error {
+		notifications, err := t.NotificationRepository.Erase(ctx, tenantId, userId)
+		if err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component:     "User Service",
+				Operation:     "EraseData",
+				Message:       "Failed to erase notifications for userId: " + userId,
+				Error:         err,
+				UserId:        userId,
+				CorrelationId: correlationId,
+			})
+			return err
+		}
+		report.Notifications = notifications
+
+		report.Configurations = 0
+		if err := t.ConfigurationRepository.Delete(ctx, tenantId, userId); err == nil {
+			report.Configurations = 1
+		} else if !apperrors.Is(err, apperrors.KindNotFound) {
+			logger.Log.Error(logger.LogPayload{
+				Component:     "User Service",
+				Operation:     "EraseData",
+				Message:       "Failed to erase configuration for userId: " + userId,
+				Error:         err,
+				UserId:        userId,
+				CorrelationId: correlationId,
+			})
+			return err
+		}
+		return t.AuditService.RecordWithin(ctx, models.AuditEntry{Event: data.ERASE_USER_DATA, UserId: userId, CorrelationId: correlationId, Affected: notifications})
+	})
+	if err != nil {
+		return data.UserDataErasureReport{}, err
+	}
+	if report.Configurations > 0 {
+		configurationService.Invalidate(tenantId, userId)
+	}
+
+	report.ErasedAt = time.Now()
+	metrics.Inc("users.erased")
+	logger.Log.Info(logger.LogPayload{
+		Component:     "User Service",
+		Operation:     "EraseData",
+		Message:       fmt.Sprintf("Erased data for userId: %s | Notifications: %d | Configurations: %d | Keys: %d | Connections: %d", userId, report.Notifications, report.Configurations, report.RedisKeys, report.Connections),
+		UserId:        userId,
+		CorrelationId: correlationId,
+	})
+	return report, nil
+}
+
+// Reachability reports how a notification sent to the user now would be delivered: whether the user has
+// connections on any instance, whether notifications are enabled, the groups the user muted and the channels
+// the notification would be pushed to. Users without a configuration have notifications enabled, as they are
+// when they first connect. When appId is given, Muted and Digest tell whether the group of the app given by
+// groupKey is muted and whether the app is batched into digests, and the channels account for them.
+func (t *UserServiceImpl) Reachability(ctx context.Context, tenantId string, userId string, appId string, groupKey string) (data.Reachability, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "User Service",
+		Operation: "Reachability",
+		Message:   "Checking reachability of userId: " + userId,
+		UserId:    userId,
+		AppId:     appId,
+	})
+	reachability := data.Reachability{UserId: userId, TenantId: tenantId, EnableNotification: true, MutedGroups: []data.MutedGroup{}, Channels: []string{}}
+
+	configuration, err := t.ConfigurationService.FindByAppAndUser(ctx, tenantId, userId)
+	if err == nil {
+		reachability.EnableNotification = configuration.Data.EnableNotification
+		if configuration.Data.MutedGroups != nil {
+			reachability.MutedGroups = configuration.Data.MutedGroups
+		}
+	} else if !apperrors.Is(err, apperrors.KindNotFound) {
+		return data.Reachability{}, err
+	}
+	if appId != "" {
+		now := time.Now()
+		for _, muted := range reachability.MutedGroups {
+			if muted.AppId == appId && muted.GroupKey == groupKey && muted.Until.After(now) {
+				reachability.Muted = true
+			}
+		}
+		for _, digest := range configuration.Data.DigestApps {
+			if digest.AppId == appId {
+				reachability.Digest = true
+			}
+		}
+	}
+
+	devices := t.ClientStore.ConnectedDevices(clientStore.UserKey(tenantId, userId))
+	reachability.Connected = len(devices) > 0
+	reachability.Connections = len(devices)
+
+	// Offline users, users with notifications disabled and muted groups only get the notification stored
+	if reachability.Connected && reachability.EnableNotification && !reachability.Muted {
+		if reachability.Digest {
+			reachability.Channels = append(reachability.Channels, data.CHANNEL_DIGEST)
+		} else {
+			for _, device := range devices {
+				if !slices.Contains(reachability.Channels, device.Transport) {
+					reachability.Channels = append(reachability.Channels, device.Transport)
+				}
+			}
+		}
+	}
+	metrics.Inc("users.reachability.checked")
+	return reachability, nil
+}
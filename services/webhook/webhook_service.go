@@ -0,0 +1,17 @@
+package webhookService
+
+import (
+	"context"
+	"r2-notify-server/data"
+)
+
+type WebhookService interface {
+	FindAll(appId string) ([]data.Webhook, error)
+	FindById(id string, appId string) (data.Webhook, error)
+	Create(appId string, request data.CreateWebhookRequest) (data.Webhook, error)
+	Update(id string, appId string, request data.UpdateWebhookRequest) (data.Webhook, error)
+	Delete(id string, appId string) error
+	FindDeliveries(id string, appId string) ([]data.WebhookDelivery, error)
+	Dispatch(event string, appId string, payload interface{})
+	StartDeliveryWorkers(ctx context.Context)
+}
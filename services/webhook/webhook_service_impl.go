@@ -0,0 +1,402 @@
+package webhookService
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"r2-notify-server/apperrors"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/metrics"
+	"r2-notify-server/models"
+	webhookRepository "r2-notify-server/repository/webhook"
+	"r2-notify-server/utils"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Number of delivery attempts returned by FindDeliveries.
+const deliveryHistoryLimit = 50
+
+// dispatchedEvent is a lifecycle event waiting in the delivery queue for a delivery worker.
+type dispatchedEvent struct {
+	event   string
+	appId   string
+	payload interface{}
+}
+
+type WebhookServiceImpl struct {
+	WebhookRepository webhookRepository.WebhookRepository
+	Validate          *validator.Validate
+	HttpClient        *http.Client
+	MaxAttempts       int
+	Workers           int
+
+	queue chan dispatchedEvent
+}
+
+// NewWebhookServiceImpl returns a new instance of WebhookService with the provided WebhookRepository
+// and validator.Validate instance. The delivery timeout, number of attempts, delivery workers and queue size
+// are read from the config. Events are only delivered once StartDeliveryWorkers runs.
+// If the validator instance is nil, an error is returned.
+func NewWebhookServiceImpl(webhookRepository webhookRepository.WebhookRepository, validate *validator.Validate) (service WebhookService, err error) {
+	if validate == nil {
+		return nil, apperrors.Internal("validator instance cannot be nil", nil)
+	}
+	cfg := config.LoadConfig()
+	return &WebhookServiceImpl{
+		WebhookRepository: webhookRepository,
+		Validate:          validate,
+		HttpClient:        &http.Client{Timeout: time.Duration(cfg.WebhookTimeoutSeconds) * time.Second},
+		MaxAttempts:       max(cfg.WebhookMaxAttempts, 1),
+		Workers:           max(cfg.WebhookWorkers, 1),
+		queue:             make(chan dispatchedEvent, max(cfg.WebhookQueueSize, 1)),
+	}, err
+}
+
+// FindAll returns the webhooks registered for the given appId.
+func (t *WebhookServiceImpl) FindAll(appId string) ([]data.Webhook, error) {
+	result, err := t.WebhookRepository.FindAll(appId)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Service",
+			Operation: "FindAll",
+			Message:   "Failed to fetch webhooks for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return nil, err
+	}
+	webhooks := make([]data.Webhook, 0, len(result))
+	for _, value := range result {
+		webhooks = append(webhooks, toWebhook(value, false))
+	}
+	return webhooks, nil
+}
+
+// FindById returns the webhook with the given ID belonging to the given appId.
+// It returns a NotFound error if the webhook does not exist or the ID is malformed.
+func (t *WebhookServiceImpl) FindById(id string, appId string) (data.Webhook, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return data.Webhook{}, apperrors.NotFound("webhook not found")
+	}
+	result, err := t.WebhookRepository.FindById(objID, appId)
+	if err != nil {
+		return data.Webhook{}, err
+	}
+	return toWebhook(result, false), nil
+}
+
+// Create registers a new webhook for the given appId. If no secret is supplied, a random secret is
+// generated. The secret is only returned in the response of this call and is used to sign deliveries.
+func (t *WebhookServiceImpl) Create(appId string, request data.CreateWebhookRequest) (data.Webhook, error) {
+	logger.Log.Debug(logger.LogPayload{
+		Component: "Webhook Service",
+		Operation: "Create",
+		Message:   "Creating webhook for appId: " + appId,
+		AppId:     appId,
+	})
+	if err := t.Validate.Struct(request); err != nil {
+		return data.Webhook{}, apperrors.Validation("invalid webhook request", err)
+	}
+	secret := request.Secret
+	if secret == "" {
+		generated, err := generateSecret()
+		if err != nil {
+			return data.Webhook{}, apperrors.Internal("failed to generate webhook secret", err)
+		}
+		secret = generated
+	}
+	enabled := true
+	if request.Enabled != nil {
+		enabled = *request.Enabled
+	}
+	m := models.Webhook{
+		AppId:     appId,
+		Url:       request.Url,
+		Secret:    secret,
+		Events:    request.Events,
+		Enabled:   enabled,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	id, err := t.WebhookRepository.Create(m)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Webhook Service",
+			Operation: "Create",
+			Message:   "Failed to create webhook for appId: " + appId,
+			Error:     err,
+			AppId:     appId,
+		})
+		return data.Webhook{}, err
+	}
+	m.Id = id
+	return toWebhook(m, true), nil
+}
+
+// Update changes the url, events or enabled flag of a webhook. Fields omitted from the request are kept.
+// It returns a NotFound error if the webhook does not exist.
+func (t *WebhookServiceImpl) Update(id string, appId string, request data.UpdateWebhookRequest) (data.Webhook, error) {
+	if err := t.Validate.Struct(request); err != nil {
+		return data.Webhook{}, apperrors.Validation("invalid webhook request", err)
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return data.Webhook{}, apperrors.NotFound("webhook not found")
+	}
+	m, err := t.WebhookRepository.FindById(objID, appId)
+	if err != nil {
+		return data.Webhook{}, err
+	}
+	if request.Url != "" {
+		m.Url = request.Url
+	}
+	if len(request.Events) > 0 {
+		m.Events = request.Events
+	}
+	if request.Enabled != nil {
+		m.Enabled = *request.Enabled
+	}
+	if err := t.WebhookRepository.Update(m); err != nil {
+		return data.Webhook{}, err
+	}
+	m.UpdatedAt = time.Now()
+	return toWebhook(m, false), nil
+}
+
+// Delete removes the webhook with the given ID belonging to the given appId.
+// It returns a NotFound error if the webhook does not exist.
+func (t *WebhookServiceImpl) Delete(id string, appId string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return apperrors.NotFound("webhook not found")
+	}
+	return t.WebhookRepository.Delete(objID, appId)
+}
+
+// FindDeliveries returns the most recent delivery attempts of the webhook with the given ID.
+// It returns a NotFound error if the webhook does not exist.
+func (t *WebhookServiceImpl) FindDeliveries(id string, appId string) ([]data.WebhookDelivery, error) {
+	webhook, err := t.FindById(id, appId)
+	if err != nil {
+		return nil, err
+	}
+	objID, _ := primitive.ObjectIDFromHex(webhook.Id)
+	result, err := t.WebhookRepository.FindDeliveries(objID, deliveryHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]data.WebhookDelivery, 0, len(result))
+	for _, value := range result {
+		deliveries = append(deliveries, data.WebhookDelivery{
+			DeliveryId: value.DeliveryId,
+			WebhookId:  value.WebhookId.Hex(),
+			Event:      value.Event,
+			Attempt:    value.Attempt,
+			StatusCode: value.StatusCode,
+			Success:    value.Success,
+			Error:      value.Error,
+			CreatedAt:  value.CreatedAt,
+		})
+	}
+	return deliveries, nil
+}
+
+// Dispatch queues the given lifecycle event for delivery to every enabled webhook of the appId subscribed
+// to it. It never blocks the caller: when the delivery queue is full, the event is dropped and counted in
+// webhooks.dropped. Queued events are delivered by the workers started by StartDeliveryWorkers.
+func (t *WebhookServiceImpl) Dispatch(event string, appId string, payload interface{}) {
+	if appId == "" {
+		return
+	}
+	select {
+	case t.queue <- dispatchedEvent{event: event, appId: appId, payload: payload}:
+	default:
+		metrics.Inc("webhooks.dropped")
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Webhook Service",
+			Operation: "Dispatch",
+			Message:   "Webhook delivery queue full, dropping event: " + event,
+			AppId:     appId,
+		})
+	}
+}
+
+// StartDeliveryWorkers delivers the queued lifecycle events with WEBHOOK_WORKERS workers until the context
+// is cancelled. Failed deliveries are retried with exponential backoff, which is cut short when the context
+// is cancelled; events still queued on shutdown are not delivered.
+func (t *WebhookServiceImpl) StartDeliveryWorkers(ctx context.Context) {
+	var workers sync.WaitGroup
+	for range t.Workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case dispatched := <-t.queue:
+					t.dispatch(ctx, dispatched)
+				}
+			}
+		}()
+	}
+	workers.Wait()
+	logger.Log.Info(logger.LogPayload{
+		Message:   fmt.Sprintf("Shutting down webhook delivery workers, %d queued events not delivered", len(t.queue)),
+		Component: "Webhook Service",
+		Operation: "Shutdown Delivery Workers",
+	})
+}
+
+// dispatch delivers a queued lifecycle event to the webhooks of its app subscribed to it, one after the other.
+func (t *WebhookServiceImpl) dispatch(ctx context.Context, dispatched dispatchedEvent) {
+	webhooks, err := t.WebhookRepository.FindByEvent(dispatched.appId, dispatched.event)
+	if err != nil {
+		return
+	}
+	for _, webhook := range webhooks {
+		deliveryId := utils.GenerateUUID()
+		body, err := json.Marshal(data.WebhookPayload{
+			DeliveryId: deliveryId,
+			Event:      dispatched.event,
+			AppId:      dispatched.appId,
+			Timestamp:  time.Now(),
+			Data:       dispatched.payload,
+		})
+		if err != nil {
+			logger.Log.Error(logger.LogPayload{
+				Component: "Webhook Service",
+				Operation: "Dispatch",
+				Message:   "Failed to marshal webhook payload for event: " + dispatched.event,
+				Error:     err,
+				AppId:     dispatched.appId,
+			})
+			return
+		}
+		t.deliver(ctx, webhook, dispatched.event, deliveryId, body)
+	}
+}
+
+// deliver POSTs the signed body to the webhook URL, retrying with exponential backoff until a
+// 2xx response is received, the maximum number of attempts is reached or the context is cancelled.
+func (t *WebhookServiceImpl) deliver(ctx context.Context, webhook models.Webhook, event string, deliveryId string, body []byte) {
+	signature := sign(webhook.Secret, body)
+	backoff := time.Second
+
+	for attempt := 1; attempt <= t.MaxAttempts; attempt++ {
+		statusCode, err := t.post(ctx, webhook.Url, event, deliveryId, signature, body)
+		success := err == nil && statusCode >= 200 && statusCode < 300
+		delivery := models.WebhookDelivery{
+			DeliveryId: deliveryId,
+			WebhookId:  webhook.Id,
+			AppId:      webhook.AppId,
+			Event:      event,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Success:    success,
+			CreatedAt:  time.Now(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		_ = t.WebhookRepository.LogDelivery(delivery)
+
+		if success {
+			logger.Log.Debug(logger.LogPayload{
+				Component: "Webhook Service",
+				Operation: "Deliver",
+				Message:   fmt.Sprintf("Delivered %s to webhook %s on attempt %d", event, webhook.Id.Hex(), attempt),
+				AppId:     webhook.AppId,
+			})
+			return
+		}
+		logger.Log.Warn(logger.LogPayload{
+			Component: "Webhook Service",
+			Operation: "Deliver",
+			Message:   fmt.Sprintf("Delivery of %s to webhook %s failed on attempt %d with status %d", event, webhook.Id.Hex(), attempt, statusCode),
+			Error:     err,
+			AppId:     webhook.AppId,
+		})
+		if attempt < t.MaxAttempts {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+	}
+	logger.Log.Error(logger.LogPayload{
+		Component: "Webhook Service",
+		Operation: "Deliver",
+		Message:   fmt.Sprintf("Giving up delivery of %s to webhook %s after %d attempts", event, webhook.Id.Hex(), t.MaxAttempts),
+		AppId:     webhook.AppId,
+	})
+}
+
+// post sends a single delivery request and returns the response status code.
+func (t *WebhookServiceImpl) post(ctx context.Context, url string, event string, deliveryId string, signature string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-R2-Event", event)
+	req.Header.Set("X-R2-Delivery", deliveryId)
+	req.Header.Set("X-R2-Signature", "sha256="+signature)
+	resp, err := t.HttpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the body using the webhook secret.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateSecret returns a random 32 byte hex encoded signing secret.
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// toWebhook converts a webhook model into its data.Webhook representation.
+// The signing secret is only included when includeSecret is true.
+func toWebhook(value models.Webhook, includeSecret bool) data.Webhook {
+	webhook := data.Webhook{
+		Id:        value.Id.Hex(),
+		AppId:     value.AppId,
+		Url:       value.Url,
+		Events:    value.Events,
+		Enabled:   value.Enabled,
+		CreatedAt: value.CreatedAt,
+		UpdatedAt: value.UpdatedAt,
+	}
+	if includeSecret {
+		webhook.Secret = value.Secret
+	}
+	return webhook
+}
@@ -0,0 +1,34 @@
+package clientStore
+
+import (
+	"r2-notify-server/apperrors"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+)
+
+// SendConnectedToConnection sends the connected frame to the new connection it describes only, since the
+// connection ID and the frame's place at the start of the stream concern that connection. The frame bypasses
+// the notification status check. Returns an error if the connection is no longer registered or encoding the
+// payload fails.
+func (t *ClientStore) SendConnectedToConnection(userId string, conn Connection, payload data.Connected) error {
+	state, ok := t.registry.Get(conn)
+	if !ok {
+		return apperrors.NotFound("connection not found")
+	}
+	encoder := state.Encoder
+	if encoder == nil {
+		encoder = JSONEncoder
+	}
+	encoded, err := encoder.Marshal(payload)
+	if err != nil {
+		logger.Log.Error(logger.LogPayload{
+			Component: "Client Store",
+			Operation: "SendConnectedToConnection",
+			Message:   "Failed to marshal " + encoder.Format() + " connected frame for userId: " + userId,
+			Error:     err,
+			UserId:    userId,
+		})
+		return apperrors.Internal("failed to encode payload", err)
+	}
+	return writeToConnection(RegisteredConnection{Conn: conn, ConnectionState: state}, priorityHigh, encoder.MessageType(), encoded)
+}
@@ -0,0 +1,108 @@
+package tracing
+
+// Package tracing sets up OpenTelemetry tracing. Requests, Event Hub events, WebSocket events and database
+// calls are recorded as spans and exported to the OTLP endpoint configured with OTEL_EXPORTER_OTLP_ENDPOINT.
+
+import (
+	"context"
+	"r2-notify-server/config"
+	"r2-notify-server/data"
+	"r2-notify-server/logger"
+	"r2-notify-server/utils"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Init installs the global tracer provider and the W3C trace context propagator. Spans are exported over
+// OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT is set; the exporter reads the endpoint and the other standard
+// OTEL_EXPORTER_OTLP_* variables itself. Without an endpoint spans are still recorded, so correlation IDs
+// are derived from trace IDs, but nothing is exported. The returned function flushes the pending spans and
+// should be called on shutdown.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	cfg := config.LoadConfig()
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.OtelSampleRatio))),
+	}
+
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, sdktrace.WithResource(res))
+
+	if cfg.OtelExporterEndpoint != "" {
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+		logger.Log.Info(logger.LogPayload{
+			Component: "Tracing",
+			Operation: "Init",
+			Message:   "Exporting traces to " + cfg.OtelExporterEndpoint,
+		})
+	} else {
+		logger.Log.Info(logger.LogPayload{
+			Component: "Tracing",
+			Operation: "Init",
+			Message:   "OTEL_EXPORTER_OTLP_ENDPOINT is not set, traces are not exported",
+		})
+	}
+
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used for the spans of the service.
+func Tracer() trace.Tracer {
+	return otel.Tracer(data.SERVICE_NAME)
+}
+
+// Start starts a span as a child of the span in ctx, or as a new trace if ctx has none.
+func Start(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// CorrelationId returns the trace ID of the span in ctx, which is used as the correlation ID of the logs
+// written while handling it. A new UUID is returned when ctx has no valid span.
+func CorrelationId(ctx context.Context) string {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		return spanContext.TraceID().String()
+	}
+	return utils.GenerateUUID()
+}
+
+// Extract returns ctx with the remote span described by the W3C trace context headers in carrier, for
+// example the application properties of an Event Hub event.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// newResource describes the service in the exported spans.
+func newResource(ctx context.Context, cfg *config.Config) (*sdkresource.Resource, error) {
+	return sdkresource.New(ctx,
+		sdkresource.WithFromEnv(),
+		sdkresource.WithTelemetrySDK(),
+		sdkresource.WithHost(),
+		sdkresource.WithAttributes(semconv.ServiceName(cfg.OtelServiceName), semconv.DeploymentEnvironmentName(cfg.Environment)),
+	)
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"r2-notify-server/data"
+	"strings"
+)
+
+// ClientIP returns the IP address of the client that made the request. The first address of the
+// X-Forwarded-For header is preferred, so the client address is kept behind a load balancer.
+func ClientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// DeviceType derives a coarse device type from the User-Agent header: mobile, tablet, desktop or unknown.
+func DeviceType(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return data.DEVICE_TYPE_UNKNOWN
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return data.DEVICE_TYPE_TABLET
+	case strings.Contains(ua, "mobile") || strings.Contains(ua, "iphone") || strings.Contains(ua, "android"):
+		return data.DEVICE_TYPE_MOBILE
+	case strings.Contains(ua, "windows") || strings.Contains(ua, "macintosh") ||
+		strings.Contains(ua, "linux") || strings.Contains(ua, "cros"):
+		return data.DEVICE_TYPE_DESKTOP
+	default:
+		return data.DEVICE_TYPE_UNKNOWN
+	}
+}
@@ -18,6 +18,48 @@ func ProcessAllowedOrigins(origins string) []string {
 	return allowedOrigins
 }
 
+// MatchOrigin reports whether the origin matches the allowed origin pattern. A pattern is either an exact
+// origin, or an origin whose host starts with a "*." label, such as https://*.example.com, which matches
+// every subdomain of the host with the same scheme and port, but not the host itself.
+func MatchOrigin(pattern string, origin string) bool {
+	if pattern == origin {
+		return true
+	}
+	scheme, host, ok := strings.Cut(pattern, "://")
+	if !ok || !strings.HasPrefix(host, "*.") {
+		return false
+	}
+	originScheme, originHost, ok := strings.Cut(origin, "://")
+	if !ok || !strings.EqualFold(scheme, originScheme) {
+		return false
+	}
+	suffix := strings.ToLower(host[1:])
+	originHost = strings.ToLower(originHost)
+	if !strings.HasSuffix(originHost, suffix) {
+		return false
+	}
+	subdomain := strings.TrimSuffix(originHost, suffix)
+	return subdomain != "" && !strings.ContainsAny(subdomain, ":/@?#")
+}
+
+// ValidOriginPattern reports whether the pattern is an origin, scheme://host[:port] without a path, whose
+// host may start with a "*." wildcard label.
+func ValidOriginPattern(pattern string) bool {
+	scheme, host, ok := strings.Cut(pattern, "://")
+	if !ok || scheme == "" || host == "" || strings.ContainsAny(host, "/?#@ ") {
+		return false
+	}
+	host = strings.TrimPrefix(host, "*.")
+	return host != "" && !strings.HasPrefix(host, ".") && !strings.HasPrefix(host, ":") && !strings.Contains(host, "*")
+}
+
 func GenerateUUID() string {
 	return uuid.New().String()
 }
+
+// ValidTenantId reports whether the given tenant ID can be used to scope notifications. Tenant IDs are at
+// most 64 characters and cannot contain a slash, which separates the tenant from the user in client keys.
+// An empty tenant ID selects the default tenant.
+func ValidTenantId(tenantId string) bool {
+	return len(tenantId) <= 64 && !strings.Contains(tenantId, "/")
+}